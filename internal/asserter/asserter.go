@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -18,16 +19,157 @@ type Result struct {
 // Diff describes a single difference.
 type Diff struct {
 	Path     string `json:"path"`
+	Kind     string `json:"kind,omitempty"`
+	Severity string `json:"severity,omitempty"` // empty for failures, "warning" for tolerated differences
 	Expected any    `json:"expected"`
 	Actual   any    `json:"actual"`
 	Message  string `json:"message"`
 }
 
+// SeverityWarning marks a difference that is reported but does not fail the snapshot.
+const SeverityWarning = "warning"
+
+// IsWarning reports whether the diff is tolerated rather than a failure.
+func (d Diff) IsWarning() bool {
+	return d.Severity == SeverityWarning
+}
+
+// HasFailures reports whether any diff is a failure rather than a warning.
+func HasFailures(diffs []Diff) bool {
+	for _, d := range diffs {
+		if !d.IsWarning() {
+			return true
+		}
+	}
+	return false
+}
+
+// Warnings returns only the warning-level diffs.
+func Warnings(diffs []Diff) []Diff {
+	var out []Diff
+	for _, d := range diffs {
+		if d.IsWarning() {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// MarkWarnOnly downgrades the diffs at or below a path in opts.WarnOnly to
+// warnings, so drift in non-critical fields is reported without failing the
+// snapshot.
+func MarkWarnOnly(diffs []Diff, opts *Options) {
+	if opts == nil || len(opts.WarnOnly) == 0 {
+		return
+	}
+	for i := range diffs {
+		if isWarnOnly(diffs[i].Path, opts.WarnOnly) {
+			diffs[i].Severity = SeverityWarning
+		}
+	}
+}
+
+// isWarnOnly reports whether path matches one of patterns or lies below a
+// match, e.g. db.audit_log[0].action below db.audit_log.
+func isWarnOnly(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if isIgnored(path, []string{pattern, pattern + ".*", pattern + "[*"}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff kinds classify differences for machine consumption.
+const (
+	DiffKindStatusMismatch    = "status_mismatch"
+	DiffKindContentType       = "content_type_mismatch"
+	DiffKindValueMismatch     = "value_mismatch"
+	DiffKindTypeMismatch      = "type_mismatch"
+	DiffKindLengthMismatch    = "length_mismatch"
+	DiffKindMissingField      = "missing_field"
+	DiffKindUnexpectedField   = "unexpected_field"
+	DiffKindMissingElement    = "missing_element"
+	DiffKindUnexpectedElement = "unexpected_element"
+	DiffKindMissingRow        = "missing_row"
+	DiffKindUnexpectedRow     = "unexpected_row"
+	DiffKindRowCountMismatch  = "row_count_mismatch"
+	DiffKindMissingTable      = "missing_table"
+	DiffKindUnexpectedTable   = "unexpected_table"
+	DiffKindColumnAdded       = "column_added"
+	DiffKindColumnRemoved     = "column_removed"
+)
+
 // Options configures assertion behavior.
 type Options struct {
 	IgnoreFields     []string
 	OrderInsensitive map[string]bool // table/field paths where array order doesn't matter
 	IgnoreTables     map[string]bool // tables to skip during DB comparison
+	AllowAdditive    []string        // paths where unexpected fields in actual are warnings, not failures
+
+	NullEqualsMissing       bool // treat a null value and an absent key as equal
+	EmptyArrayEqualsMissing bool // treat an empty array and an absent key as equal
+
+	RowKeys map[string][]string // table -> unique key columns used to align rows
+
+	Matchers map[string]string // path glob -> dynamic matcher compared in place of the expected value
+
+	WarnOnly []string // paths whose differences, and those below them, are warnings, not failures
+}
+
+// Dynamic matchers, which match any value of a kind in place of a recorded
+// one, either as the expected value in a snapshot or by path in
+// Options.Matchers.
+const (
+	MatcherAny     = "__ANY__"
+	MatcherUUID    = "__UUID__"
+	MatcherISODate = "__ISO_DATE__"
+)
+
+// matcherFor returns the matcher configured for path: the one for the exact
+// path if any, otherwise the one of the first matching glob in sorted order.
+func (o *Options) matcherFor(path string) (string, bool) {
+	if o == nil || len(o.Matchers) == 0 {
+		return "", false
+	}
+	if m, ok := o.Matchers[path]; ok {
+		return m, true
+	}
+	patterns := make([]string, 0, len(o.Matchers))
+	for pattern := range o.Matchers {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if isIgnored(path, []string{pattern}) {
+			return o.Matchers[pattern], true
+		}
+	}
+	return "", false
+}
+
+// rowKeys returns the configured key columns for table, if any.
+func (o *Options) rowKeys(table string) []string {
+	if o == nil {
+		return nil
+	}
+	return o.RowKeys[table]
+}
+
+// equivalentToMissing reports whether v should compare equal to an absent key.
+func (o *Options) equivalentToMissing(v any) bool {
+	if o == nil {
+		return false
+	}
+	if v == nil {
+		return o.NullEqualsMissing
+	}
+	if o.EmptyArrayEqualsMissing {
+		if arr, ok := normalize(v).([]any); ok && len(arr) == 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // AssertResponse compares expected and actual HTTP responses.
@@ -40,17 +182,90 @@ func AssertResponse(expected, actual map[string]any, opts *Options) []Diff {
 			Path:     "response.status",
 			Expected: expected["status"],
 			Actual:   actual["status"],
+			Kind:     DiffKindStatusMismatch,
 			Message:  "Status code mismatch",
 		})
 	}
 
-	// Compare body
-	bodyDiffs := compareValues("response.body", expected["body"], actual["body"], opts)
+	// Compare content type when both sides have one. Callers pass normalized
+	// values, so "application/json; charset=utf-8" matches "application/json".
+	expectedCT, _ := expected["content_type"].(string)
+	actualCT, _ := actual["content_type"].(string)
+	if expectedCT != "" && actualCT != "" && expectedCT != actualCT &&
+		(opts == nil || !isIgnored("response.content_type", opts.IgnoreFields)) {
+		diffs = append(diffs, Diff{
+			Path:     "response.content_type",
+			Expected: expectedCT,
+			Actual:   actualCT,
+			Kind:     DiffKindContentType,
+			Message:  "Content type mismatch",
+		})
+	}
+
+	// Compare body, pairing the responses to a JSON-RPC batch by id
+	bodyDiffs := compareValues("response.body", expected["body"], alignJSONRPCBatch(expected["body"], actual["body"]), opts)
+	if isXMLBody(expected["body"]) {
+		describeXMLDiffs(bodyDiffs)
+	}
 	diffs = append(diffs, bodyDiffs...)
 
 	return diffs
 }
 
+// AssertWebSocket compares the recorded and replayed messages of a
+// WebSocket connection in order, under the path "websocket".
+func AssertWebSocket(expected, actual any, opts *Options) []Diff {
+	e, a := normalize(expected), normalize(actual)
+	if e == nil {
+		e = []any{}
+	}
+	if a == nil {
+		a = []any{}
+	}
+	return compareValues("websocket", e, a, opts)
+}
+
+// AssertTrailers compares the HTTP trailers of a response, such as
+// grpc-status, under the path "response.trailers".
+func AssertTrailers(expected, actual map[string]string, opts *Options) []Diff {
+	e := make(map[string]any, len(expected))
+	for k, v := range expected {
+		e[k] = v
+	}
+	a := make(map[string]any, len(actual))
+	for k, v := range actual {
+		a[k] = v
+	}
+	return compareValues("response.trailers", e, a, opts)
+}
+
+// AssertEvents compares the recorded and replayed Server-Sent Events of a
+// response in order, under the path "response.events". Event timing is
+// recorded for reference only and never compared.
+func AssertEvents(expected, actual any, opts *Options) []Diff {
+	e, a := normalize(expected), normalize(actual)
+	return compareValues("response.events", withoutOffsets(e), withoutOffsets(a), opts)
+}
+
+// withoutOffsets drops the offset_ms field from normalized events.
+func withoutOffsets(events any) []any {
+	list, _ := events.([]any)
+	out := make([]any, len(list))
+	for i, ev := range list {
+		if m, ok := ev.(map[string]any); ok {
+			c := make(map[string]any, len(m))
+			for k, v := range m {
+				if k != "offset_ms" {
+					c[k] = v
+				}
+			}
+			ev = c
+		}
+		out[i] = ev
+	}
+	return out
+}
+
 // AssertDBState compares expected and actual database states.
 func AssertDBState(expected, actual map[string][]map[string]any, opts *Options) []Diff {
 	var diffs []Diff
@@ -75,6 +290,7 @@ func AssertDBState(expected, actual map[string][]map[string]any, opts *Options)
 			diffs = append(diffs, Diff{
 				Path:    fmt.Sprintf("db.%s", table),
 				Actual:  actualRows,
+				Kind:    DiffKindUnexpectedTable,
 				Message: "Unexpected table in actual DB state",
 			})
 			continue
@@ -83,6 +299,7 @@ func AssertDBState(expected, actual map[string][]map[string]any, opts *Options)
 			diffs = append(diffs, Diff{
 				Path:     fmt.Sprintf("db.%s", table),
 				Expected: expectedRows,
+				Kind:     DiffKindMissingTable,
 				Message:  "Table missing from actual DB state",
 			})
 			continue
@@ -93,46 +310,54 @@ func AssertDBState(expected, actual map[string][]map[string]any, opts *Options)
 				Path:     fmt.Sprintf("db.%s.length", table),
 				Expected: len(expectedRows),
 				Actual:   len(actualRows),
+				Kind:     DiffKindRowCountMismatch,
 				Message:  fmt.Sprintf("Row count mismatch in table %s", table),
 			})
 		}
 
+		// Report schema changes once per column, then compare the shared columns
+		expectedRows, actualRows, columnDiffs := diffColumns(table, expectedRows, actualRows, opts)
+		diffs = append(diffs, columnDiffs...)
+
 		// Compare row by row (try to match by ID first)
 		orderInsensitive := opts != nil && opts.OrderInsensitive != nil && opts.OrderInsensitive[table]
-		tableDiffs := compareRowSets(fmt.Sprintf("db.%s", table), expectedRows, actualRows, orderInsensitive, opts)
+		tableDiffs := compareRowSets(fmt.Sprintf("db.%s", table), expectedRows, actualRows, orderInsensitive, opts.rowKeys(table), opts)
 		diffs = append(diffs, tableDiffs...)
 	}
 
 	return diffs
 }
 
-func compareRowSets(basePath string, expected, actual []map[string]any, orderInsensitive bool, opts *Options) []Diff {
+func compareRowSets(basePath string, expected, actual []map[string]any, orderInsensitive bool, keys []string, opts *Options) []Diff {
 	var diffs []Diff
 
-	if orderInsensitive {
-		// Match by best effort (try ID-based matching)
-		expectedByID := indexRows(expected)
-		actualByID := indexRows(actual)
+	// Configured row keys always align rows by key, regardless of order
+	if orderInsensitive || len(keys) > 0 {
+		// Match by best effort (try key-based matching)
+		expectedByID := indexRows(expected, keys)
+		actualByID := indexRows(actual, keys)
 
 		if expectedByID != nil && actualByID != nil {
 			for id, eRow := range expectedByID {
 				aRow, ok := actualByID[id]
 				if !ok {
 					diffs = append(diffs, Diff{
-						Path:     fmt.Sprintf("%s[id=%s]", basePath, id),
+						Path:     fmt.Sprintf("%s[%s]", basePath, id),
 						Expected: eRow,
+						Kind:     DiffKindMissingRow,
 						Message:  "Row missing from actual",
 					})
 					continue
 				}
-				rowDiffs := compareRow(fmt.Sprintf("%s[id=%s]", basePath, id), eRow, aRow, opts)
+				rowDiffs := compareRow(fmt.Sprintf("%s[%s]", basePath, id), eRow, aRow, opts)
 				diffs = append(diffs, rowDiffs...)
 			}
 			for id := range actualByID {
 				if _, ok := expectedByID[id]; !ok {
 					diffs = append(diffs, Diff{
-						Path:   fmt.Sprintf("%s[id=%s]", basePath, id),
+						Path:   fmt.Sprintf("%s[%s]", basePath, id),
 						Actual: actualByID[id],
+						Kind:    DiffKindUnexpectedRow,
 						Message: "Unexpected row in actual",
 					})
 				}
@@ -141,6 +366,7 @@ func compareRowSets(basePath string, expected, actual []map[string]any, orderIns
 		}
 
 		// No ID column — fall back to hash-based set comparison, excluding ignored fields
+
 		expectedHashes := make(map[string]bool)
 		actualHashes := make(map[string]bool)
 		for _, row := range expected {
@@ -156,6 +382,7 @@ func compareRowSets(basePath string, expected, actual []map[string]any, orderIns
 			if !actualHashes[h] {
 				diffs = append(diffs, Diff{
 					Path:    basePath,
+					Kind:    DiffKindMissingRow,
 					Message: "Row in expected but not in actual (order-insensitive set comparison)",
 				})
 			}
@@ -164,6 +391,7 @@ func compareRowSets(basePath string, expected, actual []map[string]any, orderIns
 			if !expectedHashes[h] {
 				diffs = append(diffs, Diff{
 					Path:    basePath,
+					Kind:    DiffKindUnexpectedRow,
 					Message: "Row in actual but not in expected (order-insensitive set comparison)",
 				})
 			}
@@ -182,12 +410,14 @@ func compareRowSets(basePath string, expected, actual []map[string]any, orderIns
 			diffs = append(diffs, Diff{
 				Path:    path,
 				Actual:  actual[i],
+				Kind:    DiffKindUnexpectedRow,
 				Message: "Extra row in actual",
 			})
 		} else if i >= len(actual) {
 			diffs = append(diffs, Diff{
 				Path:     path,
 				Expected: expected[i],
+				Kind:     DiffKindMissingRow,
 				Message:  "Missing row in actual",
 			})
 		} else {
@@ -216,18 +446,28 @@ func compareRow(basePath string, expected, actual map[string]any, opts *Options)
 
 		ev, eOk := expected[key]
 		av, aOk := actual[key]
+		if (!eOk && opts.equivalentToMissing(av)) || (!aOk && opts.equivalentToMissing(ev)) {
+			continue
+		}
 		if !eOk {
-			diffs = append(diffs, Diff{
+			diff := Diff{
 				Path:    path,
 				Actual:  av,
+				Kind:    DiffKindUnexpectedField,
 				Message: "Unexpected field",
-			})
+			}
+			if opts != nil && isIgnored(path, opts.AllowAdditive) {
+				diff.Severity = SeverityWarning
+				diff.Message = "Unexpected field (additive change tolerated)"
+			}
+			diffs = append(diffs, diff)
 			continue
 		}
 		if !aOk {
 			diffs = append(diffs, Diff{
 				Path:     path,
 				Expected: ev,
+				Kind:     DiffKindMissingField,
 				Message:  "Missing field",
 			})
 			continue
@@ -243,6 +483,9 @@ func compareValues(path string, expected, actual any, opts *Options) []Diff {
 	if opts != nil && isIgnored(path, opts.IgnoreFields) {
 		return nil
 	}
+	if m, ok := opts.matcherFor(path); ok {
+		expected = m
+	}
 
 	// Check dynamic matchers
 	if s, ok := expected.(string); ok {
@@ -259,14 +502,14 @@ func compareValues(path string, expected, actual any, opts *Options) []Diff {
 	case map[string]any:
 		av, ok := aNorm.(map[string]any)
 		if !ok {
-			return []Diff{{Path: path, Expected: expected, Actual: actual, Message: "Type mismatch"}}
+			return []Diff{{Path: path, Expected: expected, Actual: actual, Kind: DiffKindTypeMismatch, Message: "Type mismatch"}}
 		}
 		return compareRow(path, ev, av, opts)
 
 	case []any:
 		av, ok := aNorm.([]any)
 		if !ok {
-			return []Diff{{Path: path, Expected: expected, Actual: actual, Message: "Type mismatch"}}
+			return []Diff{{Path: path, Expected: expected, Actual: actual, Kind: DiffKindTypeMismatch, Message: "Type mismatch"}}
 		}
 		var diffs []Diff
 		maxLen := len(ev)
@@ -278,15 +521,16 @@ func compareValues(path string, expected, actual any, opts *Options) []Diff {
 				Path:     path + ".length",
 				Expected: len(ev),
 				Actual:   len(av),
+				Kind:     DiffKindLengthMismatch,
 				Message:  "Array length mismatch",
 			})
 		}
 		for i := 0; i < maxLen; i++ {
 			elemPath := fmt.Sprintf("%s[%d]", path, i)
 			if i >= len(ev) {
-				diffs = append(diffs, Diff{Path: elemPath, Actual: av[i], Message: "Extra element"})
+				diffs = append(diffs, Diff{Path: elemPath, Actual: av[i], Kind: DiffKindUnexpectedElement, Message: "Extra element"})
 			} else if i >= len(av) {
-				diffs = append(diffs, Diff{Path: elemPath, Expected: ev[i], Message: "Missing element"})
+				diffs = append(diffs, Diff{Path: elemPath, Expected: ev[i], Kind: DiffKindMissingElement, Message: "Missing element"})
 			} else {
 				diffs = append(diffs, compareValues(elemPath, ev[i], av[i], opts)...)
 			}
@@ -295,7 +539,7 @@ func compareValues(path string, expected, actual any, opts *Options) []Diff {
 
 	default:
 		if fmt.Sprintf("%v", eNorm) != fmt.Sprintf("%v", aNorm) {
-			return []Diff{{Path: path, Expected: expected, Actual: actual, Message: "Value mismatch"}}
+			return []Diff{{Path: path, Expected: expected, Actual: actual, Kind: DiffKindValueMismatch, Message: "Value mismatch"}}
 		}
 		return nil
 	}
@@ -304,16 +548,16 @@ func compareValues(path string, expected, actual any, opts *Options) []Diff {
 // matchesDynamic checks if a value matches a dynamic matcher pattern.
 func matchesDynamic(pattern string, actual any) bool {
 	switch pattern {
-	case "__ANY__":
+	case MatcherAny:
 		return true
-	case "__UUID__":
+	case MatcherUUID:
 		s, ok := actual.(string)
 		if !ok {
 			return false
 		}
 		uuidRegex := regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 		return uuidRegex.MatchString(s)
-	case "__ISO_DATE__":
+	case MatcherISODate:
 		s, ok := actual.(string)
 		if !ok {
 			return false
@@ -324,10 +568,12 @@ func matchesDynamic(pattern string, actual any) bool {
 	return false
 }
 
-// isIgnored checks if a field path matches any ignore pattern.
+// isIgnored checks if a field path matches any ignore pattern. Paths into
+// a SOAP envelope also match patterns using the soap: prefix.
 func isIgnored(path string, patterns []string) bool {
+	soap := soapPath(path)
 	for _, pattern := range patterns {
-		if matchGlob(pattern, path) {
+		if matchGlob(pattern, path) || (soap != path && matchGlob(pattern, soap)) {
 			return true
 		}
 	}
@@ -340,11 +586,11 @@ func matchGlob(pattern, path string) bool {
 		return true
 	}
 	// Handle *.field pattern (matches any prefix)
-	if strings.HasPrefix(pattern, "*.") {
+	if strings.HasPrefix(pattern, "*.") && !strings.Contains(pattern[1:], "*") {
 		suffix := pattern[1:] // .field
 		return strings.HasSuffix(path, suffix)
 	}
-	// Handle simple wildcard
+	// Handle simple wildcard, including array selectors like items[*].id
 	if strings.Contains(pattern, "*") {
 		regexStr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`) + "$"
 		if matched, err := regexp.MatchString(regexStr, path); err == nil {
@@ -354,18 +600,27 @@ func matchGlob(pattern, path string) bool {
 	return false
 }
 
-func indexRows(rows []map[string]any) map[string]map[string]any {
-	// Try common key columns in priority order
-	for _, keyCol := range []string{"id", "resource_id"} {
+// defaultRowKeys are the key columns tried, in priority order, for tables
+// without a configured row key.
+var defaultRowKeys = [][]string{{"id"}, {"resource_id"}}
+
+// indexRows indexes rows by a unique key rendered as "col=val[,col=val...]".
+// If keys is empty the default key columns are tried. Returns nil when no
+// candidate key is present and unique in every row.
+func indexRows(rows []map[string]any, keys []string) map[string]map[string]any {
+	candidates := defaultRowKeys
+	if len(keys) > 0 {
+		candidates = [][]string{keys}
+	}
+	for _, keyCols := range candidates {
 		idx := make(map[string]map[string]any)
 		ok := true
 		for _, row := range rows {
-			val, exists := row[keyCol]
+			key, exists := rowKey(row, keyCols)
 			if !exists {
 				ok = false
 				break
 			}
-			key := fmt.Sprintf("%v", val)
 			if _, dup := idx[key]; dup {
 				ok = false // Not a unique key
 				break
@@ -379,6 +634,19 @@ func indexRows(rows []map[string]any) map[string]map[string]any {
 	return nil
 }
 
+// rowKey renders the values of keyCols in row, or false if any column is absent.
+func rowKey(row map[string]any, keyCols []string) (string, bool) {
+	parts := make([]string, len(keyCols))
+	for i, col := range keyCols {
+		val, exists := row[col]
+		if !exists {
+			return "", false
+		}
+		parts[i] = fmt.Sprintf("%s=%v", col, val)
+	}
+	return strings.Join(parts, ","), true
+}
+
 // hashRowFiltered returns a deterministic hash of a row, excluding ignored fields.
 func hashRowFiltered(basePath string, row map[string]any, opts *Options) string {
 	filtered := make(map[string]any)
@@ -387,12 +655,116 @@ func hashRowFiltered(basePath string, row map[string]any, opts *Options) string
 		if opts != nil && isIgnored(fieldPath, opts.IgnoreFields) {
 			continue
 		}
+		// Drop values equivalent to an absent key so both spellings hash the same
+		if opts.equivalentToMissing(v) {
+			continue
+		}
 		filtered[k] = v
 	}
 	data, _ := json.Marshal(filtered)
 	return string(data)
 }
 
+// diffColumns compares the column sets of expected and actual rows and reports
+// one diff per column added or removed, rather than one per row. It returns the
+// rows with those columns dropped so row comparison only sees shared columns.
+func diffColumns(table string, expected, actual []map[string]any, opts *Options) ([]map[string]any, []map[string]any, []Diff) {
+	if len(expected) == 0 || len(actual) == 0 {
+		return expected, actual, nil
+	}
+	expectedCols := columnSet(expected)
+	actualCols := columnSet(actual)
+
+	var diffs []Diff
+	changed := make(map[string]bool)
+	for _, col := range sortedKeys(actualCols) {
+		if expectedCols[col] {
+			continue
+		}
+		changed[col] = true
+		path := fmt.Sprintf("db.%s.%s", table, col)
+		if (opts != nil && isIgnored(path, opts.IgnoreFields)) || allEquivalentToMissing(actual, col, opts) {
+			continue
+		}
+		diff := Diff{
+			Path:    path,
+			Actual:  col,
+			Kind:    DiffKindColumnAdded,
+			Message: fmt.Sprintf("Column %s added in table %s", col, table),
+		}
+		if opts != nil && isIgnored(path, opts.AllowAdditive) {
+			diff.Severity = SeverityWarning
+			diff.Message += " (additive change tolerated)"
+		}
+		diffs = append(diffs, diff)
+	}
+	for _, col := range sortedKeys(expectedCols) {
+		if actualCols[col] {
+			continue
+		}
+		changed[col] = true
+		path := fmt.Sprintf("db.%s.%s", table, col)
+		if (opts != nil && isIgnored(path, opts.IgnoreFields)) || allEquivalentToMissing(expected, col, opts) {
+			continue
+		}
+		diffs = append(diffs, Diff{
+			Path:     path,
+			Expected: col,
+			Kind:     DiffKindColumnRemoved,
+			Message:  fmt.Sprintf("Column %s removed from table %s", col, table),
+		})
+	}
+	if len(changed) == 0 {
+		return expected, actual, nil
+	}
+	return dropColumns(expected, changed), dropColumns(actual, changed), diffs
+}
+
+// allEquivalentToMissing reports whether col holds only values that opts
+// treats as equal to an absent key (e.g. all nulls with NullEqualsMissing).
+func allEquivalentToMissing(rows []map[string]any, col string, opts *Options) bool {
+	for _, row := range rows {
+		if v, ok := row[col]; ok && !opts.equivalentToMissing(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// columnSet returns the union of keys across rows.
+func columnSet(rows []map[string]any) map[string]bool {
+	cols := make(map[string]bool)
+	for _, row := range rows {
+		for k := range row {
+			cols[k] = true
+		}
+	}
+	return cols
+}
+
+func dropColumns(rows []map[string]any, cols map[string]bool) []map[string]any {
+	out := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		filtered := make(map[string]any, len(row))
+		for k, v := range row {
+			if !cols[k] {
+				filtered[k] = v
+			}
+		}
+		out[i] = filtered
+	}
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // normalize converts a value to a comparable form by round-tripping through JSON.
 func normalize(v any) any {
 	if v == nil {
@@ -418,7 +790,11 @@ func FormatDiffs(diffs []Diff) string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("Found %d difference(s):\n\n", len(diffs)))
 	for i, d := range diffs {
-		sb.WriteString(fmt.Sprintf("  %d) %s\n", i+1, d.Path))
+		if d.IsWarning() {
+			sb.WriteString(fmt.Sprintf("  %d) %s [warning]\n", i+1, d.Path))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %d) %s\n", i+1, d.Path))
+		}
 		sb.WriteString(fmt.Sprintf("     %s\n", d.Message))
 		if d.Expected != nil {
 			sb.WriteString(fmt.Sprintf("     expected: %v\n", formatValue(d.Expected)))
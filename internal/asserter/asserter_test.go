@@ -1,7 +1,9 @@
 package asserter
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestAssertResponse_Match(t *testing.T) {
@@ -97,6 +99,48 @@ func TestDynamicMatcher_ISODate(t *testing.T) {
 	}
 }
 
+func TestAssertResponse_Matchers(t *testing.T) {
+	expected := map[string]any{
+		"status": 200,
+		"body": map[string]any{
+			"id":    "8f14e45f-ceea-467f-a8a6-2b1f6f6b6f6a",
+			"items": []any{map[string]any{"created_at": "2024-01-15T10:30:00Z"}},
+		},
+	}
+	tests := []struct {
+		name     string
+		matchers map[string]string
+		id       any
+		created  any
+		want     []string
+	}{
+		{"no matchers", nil, "0b8e4b6c-3a9f-4d7e-9c1a-5f2e8d7b6a4c", "2025-02-01T00:00:00Z", []string{"response.body.id", "response.body.items[0].created_at"}},
+		{"exact path", map[string]string{"response.body.id": MatcherUUID}, "0b8e4b6c-3a9f-4d7e-9c1a-5f2e8d7b6a4c", "2024-01-15T10:30:00Z", nil},
+		{"glob", map[string]string{"*.created_at": MatcherISODate}, "8f14e45f-ceea-467f-a8a6-2b1f6f6b6f6a", "2025-02-01T00:00:00Z", nil},
+		{"not matching", map[string]string{"response.body.id": MatcherUUID}, "42", "2024-01-15T10:30:00Z", []string{"response.body.id"}},
+		{"exact path wins", map[string]string{"response.body.*": MatcherAny, "response.body.id": MatcherUUID}, "42", "2024-01-15T10:30:00Z", []string{"response.body.id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := map[string]any{
+				"status": 200,
+				"body": map[string]any{
+					"id":    tt.id,
+					"items": []any{map[string]any{"created_at": tt.created}},
+				},
+			}
+			diffs := AssertResponse(expected, actual, &Options{Matchers: tt.matchers})
+			var paths []string
+			for _, d := range diffs {
+				paths = append(paths, d.Path)
+			}
+			if strings.Join(paths, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected diffs at %v, got %v", tt.want, diffs)
+			}
+		})
+	}
+}
+
 func TestAssertDBState_Match(t *testing.T) {
 	state := map[string][]map[string]any{
 		"users": {
@@ -187,3 +231,460 @@ func TestIsIgnored(t *testing.T) {
 		}
 	}
 }
+
+func TestIsIgnored_ArrayPaths(t *testing.T) {
+	patterns := []string{"response.body.users[*].email", "*.items[*].token", "response.body.tags[0]"}
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"response.body.users[0].email", true},
+		{"response.body.users[12].email", true},
+		{"response.body.users[0].name", false},
+		{"response.body.order.items[3].token", true},
+		{"response.body.tags[0]", true},
+		{"response.body.tags[1]", false},
+	}
+
+	for _, tt := range tests {
+		got := isIgnored(tt.path, patterns)
+		if got != tt.ignored {
+			t.Errorf("isIgnored(%q) = %v, want %v", tt.path, got, tt.ignored)
+		}
+	}
+}
+
+func TestAssertResponse_AllowAdditive(t *testing.T) {
+	expected := map[string]any{
+		"status": 200,
+		"body":   map[string]any{"id": float64(1)},
+	}
+	actual := map[string]any{
+		"status": 200,
+		"body":   map[string]any{"id": float64(1), "nickname": "al"},
+	}
+
+	diffs := AssertResponse(expected, actual, nil)
+	if !HasFailures(diffs) {
+		t.Fatal("expected unexpected field to fail without allow_additive")
+	}
+
+	opts := &Options{AllowAdditive: []string{"response.body.*"}}
+	diffs = AssertResponse(expected, actual, opts)
+	if len(diffs) != 1 || !diffs[0].IsWarning() {
+		t.Fatalf("expected a single warning, got %v", diffs)
+	}
+	if HasFailures(diffs) {
+		t.Error("expected warnings not to count as failures")
+	}
+}
+
+func TestMarkWarnOnly(t *testing.T) {
+	diffs := []Diff{
+		{Path: "response.body.name"},
+		{Path: "response.headers.X-Request-Id"},
+		{Path: "db.audit_log.length"},
+		{Path: "db.audit_log[0].action"},
+		{Path: "db.audit_log_archive[0].action"},
+		{Path: "db.users[0].name"},
+	}
+	MarkWarnOnly(diffs, &Options{WarnOnly: []string{"response.headers.*", "db.audit_log"}})
+
+	want := []bool{false, true, true, true, false, false}
+	for i, d := range diffs {
+		if d.IsWarning() != want[i] {
+			t.Errorf("%s: expected warning %v, got %v", d.Path, want[i], d.IsWarning())
+		}
+	}
+	if !HasFailures(diffs) {
+		t.Error("expected the paths outside warn_only to still fail")
+	}
+}
+
+func TestAssertResponse_AllowAdditive_StillFailsOnChanges(t *testing.T) {
+	expected := map[string]any{
+		"status": 200,
+		"body":   map[string]any{"name": "Alice"},
+	}
+	actual := map[string]any{
+		"status": 200,
+		"body":   map[string]any{"name": "Bob", "nickname": "b"},
+	}
+
+	diffs := AssertResponse(expected, actual, &Options{AllowAdditive: []string{"response.body.*"}})
+	if !HasFailures(diffs) {
+		t.Error("expected changed value to still fail")
+	}
+	if len(Warnings(diffs)) != 1 {
+		t.Errorf("expected 1 warning, got %v", Warnings(diffs))
+	}
+}
+
+func TestAssertDBState_AllowAdditiveColumns(t *testing.T) {
+	expected := map[string][]map[string]any{
+		"users": {{"id": float64(1), "name": "Alice"}},
+		"tags":  {{"name": "a"}, {"name": "b"}},
+	}
+	actual := map[string][]map[string]any{
+		"users": {{"id": float64(1), "name": "Alice", "nickname": "al"}},
+		"tags":  {{"name": "b", "color": "red"}, {"name": "a", "color": "blue"}},
+	}
+	opts := &Options{
+		AllowAdditive:    []string{"db.*"},
+		OrderInsensitive: map[string]bool{"tags": true},
+	}
+
+	diffs := AssertDBState(expected, actual, opts)
+	if HasFailures(diffs) {
+		t.Fatalf("expected only warnings, got %v", diffs)
+	}
+	if len(diffs) != 2 {
+		t.Errorf("expected 2 warnings (one per new column), got %v", diffs)
+	}
+}
+
+func TestAssertResponse_NullEqualsMissing(t *testing.T) {
+	expected := map[string]any{
+		"status": 200,
+		"body":   map[string]any{"id": float64(1), "deleted_at": nil},
+	}
+	actual := map[string]any{
+		"status": 200,
+		"body":   map[string]any{"id": float64(1), "tags": []any{}},
+	}
+
+	if diffs := AssertResponse(expected, actual, nil); len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs without options, got %v", diffs)
+	}
+
+	diffs := AssertResponse(expected, actual, &Options{NullEqualsMissing: true})
+	if len(diffs) != 1 || diffs[0].Path != "response.body.tags" {
+		t.Errorf("expected only the empty array to differ, got %v", diffs)
+	}
+
+	diffs = AssertResponse(expected, actual, &Options{NullEqualsMissing: true, EmptyArrayEqualsMissing: true})
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %v", diffs)
+	}
+}
+
+func TestAssertResponse_NullEqualsMissing_NonNullStillDiffers(t *testing.T) {
+	expected := map[string]any{
+		"status": 200,
+		"body":   map[string]any{"note": nil},
+	}
+	actual := map[string]any{
+		"status": 200,
+		"body":   map[string]any{"note": "hi"},
+	}
+	if diffs := AssertResponse(expected, actual, &Options{NullEqualsMissing: true}); len(diffs) == 0 {
+		t.Error("expected null vs value to still differ")
+	}
+}
+
+func TestAssertDBState_NullEqualsMissing_HashedRows(t *testing.T) {
+	expected := map[string][]map[string]any{
+		"tags": {{"name": "a", "color": nil}},
+	}
+	actual := map[string][]map[string]any{
+		"tags": {{"name": "a"}},
+	}
+	opts := &Options{
+		NullEqualsMissing: true,
+		OrderInsensitive:  map[string]bool{"tags": true},
+	}
+	if diffs := AssertDBState(expected, actual, opts); len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %v", diffs)
+	}
+}
+
+func TestAssertDBState_RowKeys(t *testing.T) {
+	expected := map[string][]map[string]any{
+		"user_roles": {
+			{"user_id": float64(1), "role_id": float64(2), "granted_by": "alice"},
+			{"user_id": float64(1), "role_id": float64(3), "granted_by": "alice"},
+		},
+	}
+	actual := map[string][]map[string]any{
+		"user_roles": {
+			{"user_id": float64(1), "role_id": float64(3), "granted_by": "alice"},
+			{"user_id": float64(1), "role_id": float64(2), "granted_by": "bob"},
+		},
+	}
+	opts := &Options{RowKeys: map[string][]string{"user_roles": {"user_id", "role_id"}}}
+
+	diffs := AssertDBState(expected, actual, opts)
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %v", diffs)
+	}
+	if diffs[0].Path != "db.user_roles[user_id=1,role_id=2].granted_by" {
+		t.Errorf("unexpected path %q", diffs[0].Path)
+	}
+}
+
+func TestIndexRows_DuplicateKey(t *testing.T) {
+	rows := []map[string]any{
+		{"user_id": 1, "role_id": 2},
+		{"user_id": 1, "role_id": 2},
+	}
+	if idx := indexRows(rows, []string{"user_id", "role_id"}); idx != nil {
+		t.Errorf("expected nil index for non-unique key, got %v", idx)
+	}
+}
+
+func TestAssertDBState_ColumnDiffs(t *testing.T) {
+	expected := map[string][]map[string]any{
+		"users": {
+			{"id": float64(1), "name": "Alice", "legacy": "x"},
+			{"id": float64(2), "name": "Bob", "legacy": "y"},
+			{"id": float64(3), "name": "Carol", "legacy": "z"},
+		},
+	}
+	actual := map[string][]map[string]any{
+		"users": {
+			{"id": float64(1), "name": "Alice", "nickname": "al"},
+			{"id": float64(2), "name": "Bob", "nickname": "bo"},
+			{"id": float64(3), "name": "Carol", "nickname": "ca"},
+		},
+	}
+
+	diffs := AssertDBState(expected, actual, nil)
+	if len(diffs) != 2 {
+		t.Fatalf("expected one diff per changed column, got %d: %v", len(diffs), diffs)
+	}
+	kinds := map[string]string{}
+	for _, d := range diffs {
+		kinds[d.Path] = d.Kind
+	}
+	if kinds["db.users.nickname"] != DiffKindColumnAdded {
+		t.Errorf("expected column_added for nickname, got %v", kinds)
+	}
+	if kinds["db.users.legacy"] != DiffKindColumnRemoved {
+		t.Errorf("expected column_removed for legacy, got %v", kinds)
+	}
+}
+
+func TestAssertDBState_ColumnDiffs_IgnoredColumn(t *testing.T) {
+	expected := map[string][]map[string]any{
+		"users": {{"id": float64(1)}},
+	}
+	actual := map[string][]map[string]any{
+		"users": {{"id": float64(1), "updated_at": "2024-01-01"}},
+	}
+	diffs := AssertDBState(expected, actual, &Options{IgnoreFields: []string{"*.updated_at"}})
+	if len(diffs) != 0 {
+		t.Errorf("expected ignored column to produce no diffs, got %v", diffs)
+	}
+}
+
+func TestAssertResponse_XMLElementDiffs(t *testing.T) {
+	xmlBody := func(status, requestID string) map[string]any {
+		return map[string]any{
+			"encoding": "xml",
+			"data": map[string]any{
+				"soap:Envelope": map[string]any{
+					"soap:Body": map[string]any{
+						"Result": map[string]any{
+							"@requestId": requestID,
+							"status":     status,
+						},
+					},
+				},
+			},
+		}
+	}
+	expected := map[string]any{"status": 200, "body": xmlBody("ok", "abc")}
+	actual := map[string]any{"status": 200, "body": xmlBody("failed", "def")}
+
+	opts := &Options{IgnoreFields: []string{"*.@requestId"}}
+	diffs := AssertResponse(expected, actual, opts)
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %d: %v", len(diffs), diffs)
+	}
+	if diffs[0].Path != "response.body.data.soap:Envelope.soap:Body.Result.status" {
+		t.Errorf("expected element-level path, got %q", diffs[0].Path)
+	}
+}
+
+func TestAssertResponse_ContentTypeMismatch(t *testing.T) {
+	expected := map[string]any{"status": 200, "content_type": "application/json", "body": nil}
+	actual := map[string]any{"status": 200, "content_type": "text/html", "body": nil}
+
+	diffs := AssertResponse(expected, actual, nil)
+	if len(diffs) != 1 || diffs[0].Kind != DiffKindContentType {
+		t.Fatalf("expected a content type diff, got %v", diffs)
+	}
+
+	opts := &Options{IgnoreFields: []string{"response.content_type"}}
+	if diffs := AssertResponse(expected, actual, opts); len(diffs) != 0 {
+		t.Errorf("expected ignored content type, got %v", diffs)
+	}
+
+	// Snapshots recorded without a Content-Type don't fail on it
+	delete(expected, "content_type")
+	if diffs := AssertResponse(expected, actual, nil); len(diffs) != 0 {
+		t.Errorf("expected no diffs without an expected content type, got %v", diffs)
+	}
+}
+
+func TestAssertEvents_IgnoresTiming(t *testing.T) {
+	expected := []any{
+		map[string]any{"id": "1", "data": map[string]any{"n": 1}, "offset_ms": 5},
+		map[string]any{"id": "2", "data": "done", "offset_ms": 40},
+	}
+	actual := []any{
+		map[string]any{"id": "1", "data": map[string]any{"n": 1}, "offset_ms": 120},
+		map[string]any{"id": "2", "data": "failed", "offset_ms": 300},
+	}
+
+	diffs := AssertEvents(expected, actual, nil)
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %d: %v", len(diffs), diffs)
+	}
+	if diffs[0].Path != "response.events[1].data" {
+		t.Errorf("expected diff on the second event's data, got %q", diffs[0].Path)
+	}
+
+	if diffs := AssertEvents(expected, actual[:1], nil); len(diffs) == 0 {
+		t.Error("expected a diff for a missing event")
+	}
+}
+
+func TestAssertResponse_XMLDiffMessages(t *testing.T) {
+	doc := func(currency, amount string, order []any) map[string]any {
+		payment := map[string]any{"amount": amount, "#order": order}
+		if currency != "" {
+			payment["@currency"] = currency
+		}
+		return map[string]any{"encoding": "xml", "data": map[string]any{"payment": payment}}
+	}
+	expected := map[string]any{"status": 200, "body": doc("EUR", "10", []any{"amount", "fee"})}
+	actual := map[string]any{"status": 200, "body": doc("", "12", []any{"fee", "amount"})}
+
+	want := map[string]string{
+		"response.body.data.payment.@currency": "Attribute currency missing",
+		"response.body.data.payment.amount":    "Element amount mismatch",
+		"response.body.data.payment.#order[0]": "Element order mismatch",
+		"response.body.data.payment.#order[1]": "Element order mismatch",
+	}
+	diffs := AssertResponse(expected, actual, nil)
+	if len(diffs) != len(want) {
+		t.Fatalf("expected %d diffs, got %v", len(want), diffs)
+	}
+	for _, d := range diffs {
+		if want[d.Path] != d.Message {
+			t.Errorf("%s: message = %q, want %q", d.Path, d.Message, want[d.Path])
+		}
+	}
+}
+
+func TestAssertResponse_JSONRPCBatchOrder(t *testing.T) {
+	result := func(id any, result any) map[string]any {
+		return map[string]any{"jsonrpc": "2.0", "id": id, "result": result}
+	}
+	expected := map[string]any{"status": 200, "body": []any{result(1, "a"), result(2, "b"), result(3, "c")}}
+
+	actual := map[string]any{"status": 200, "body": []any{result(3, "c"), result(1, "a"), result(2, "b")}}
+	if diffs := AssertResponse(expected, actual, nil); len(diffs) != 0 {
+		t.Errorf("expected a reordered batch to match, got %v", diffs)
+	}
+
+	actual = map[string]any{"status": 200, "body": []any{result(2, "x"), result(1, "a"), result(3, "c")}}
+	diffs := AssertResponse(expected, actual, nil)
+	if len(diffs) != 1 || diffs[0].Path != "response.body[1].result" {
+		t.Errorf("expected one diff for id 2, got %v", diffs)
+	}
+
+	// Plain arrays keep their order
+	expected = map[string]any{"status": 200, "body": []any{1, 2}}
+	actual = map[string]any{"status": 200, "body": []any{2, 1}}
+	if diffs := AssertResponse(expected, actual, nil); len(diffs) != 2 {
+		t.Errorf("expected order to matter for plain arrays, got %v", diffs)
+	}
+}
+
+func TestIsIgnored_SOAPEnvelopePrefixes(t *testing.T) {
+	patterns := []string{"response.body.data.soap:Envelope.soap:Header", "*.soap:Body.*.@requestId"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"response.body.data.soapenv:Envelope.soapenv:Header", true},
+		{"response.body.data.SOAP-ENV:Envelope.SOAP-ENV:Body.GetPriceResponse.@requestId", true},
+		{"response.body.data.Envelope.Body.GetPriceResponse.@requestId", true},
+		{"response.body.data.soapenv:Envelope.soapenv:Body.GetPriceResponse.price", false},
+		{"response.body.data.Order.Body.@requestId", false},
+	}
+	for _, tt := range tests {
+		if got := isIgnored(tt.path, patterns); got != tt.want {
+			t.Errorf("isIgnored(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAssertLatency(t *testing.T) {
+	ms := time.Millisecond
+	opts := LatencyOptions{Tolerance: 0.5, MinDelta: 20 * ms}
+	tests := []struct {
+		name             string
+		recorded, actual time.Duration
+		opts             LatencyOptions
+		want             int
+	}{
+		{"within tolerance", 100 * ms, 140 * ms, opts, 0},
+		{"regression", 100 * ms, 200 * ms, opts, 1},
+		{"below min delta", 2 * ms, 15 * ms, opts, 0},
+		{"faster", 100 * ms, 10 * ms, opts, 0},
+		{"disabled", 100 * ms, 900 * ms, LatencyOptions{}, 0},
+		{"over max delta", 1000 * ms, 1300 * ms, LatencyOptions{Tolerance: 0.5, MaxDelta: 200 * ms}, 1},
+		{"max delta only", 1000 * ms, 1300 * ms, LatencyOptions{MaxDelta: 200 * ms}, 1},
+		{"within max delta", 1000 * ms, 1150 * ms, LatencyOptions{MaxDelta: 200 * ms}, 0},
+	}
+	for _, tt := range tests {
+		if diffs := AssertLatency(tt.recorded, tt.actual, tt.opts); len(diffs) != tt.want {
+			t.Errorf("%s: expected %d diff(s), got %v", tt.name, tt.want, diffs)
+		}
+	}
+
+	diffs := AssertLatency(100*ms, 200*ms, opts)
+	if !diffs[0].IsWarning() || diffs[0].Kind != DiffKindLatency || diffs[0].Expected != int64(100) {
+		t.Errorf("expected a latency warning, got %+v", diffs[0])
+	}
+	if diffs := AssertLatency(100*ms, 400*ms, LatencyOptions{Tolerance: 0.5, MaxDelta: 200 * ms}); !strings.Contains(diffs[0].Message, "(tolerance 50%, max delta 200ms)") {
+		t.Errorf("expected both exceeded limits in the message, got %q", diffs[0].Message)
+	}
+	opts.Fail = true
+	if diffs := AssertLatency(100*ms, 200*ms, opts); !HasFailures(diffs) {
+		t.Errorf("expected a failure with fail set, got %+v", diffs)
+	}
+}
+
+func TestAssertQueries(t *testing.T) {
+	type query struct {
+		SQL  string `json:"sql"`
+		Args []any  `json:"args,omitempty"`
+	}
+	recorded := []query{{SQL: "SELECT * FROM users WHERE id = ?", Args: []any{1}}, {SQL: "UPDATE users SET seen = ?", Args: []any{"2024-05-01"}}}
+
+	if diffs := AssertQueries(recorded, recorded, nil); len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %v", diffs)
+	}
+
+	changed := []query{recorded[0], {SQL: "UPDATE users SET seen = ?", Args: []any{"2024-06-01"}}}
+	if diffs := AssertQueries(recorded, changed, nil); len(diffs) != 1 || diffs[0].Path != "queries[1].args[0]" {
+		t.Errorf("expected a diff at queries[1].args[0], got %v", diffs)
+	}
+	if diffs := AssertQueries(recorded, changed, &Options{IgnoreFields: []string{"queries[1].args"}}); len(diffs) != 0 {
+		t.Errorf("expected ignore_fields to apply, got %v", diffs)
+	}
+
+	var missing []query
+	diffs := AssertQueries(recorded, missing, nil)
+	if len(diffs) != 1 || diffs[0].Kind != DiffKindQueriesNotCaptured || HasFailures(diffs) {
+		t.Errorf("expected a warning when queries are not reported, got %v", diffs)
+	}
+	if diffs := AssertQueries(recorded, []query{}, nil); !HasFailures(diffs) {
+		t.Errorf("expected missing queries to fail, got %v", diffs)
+	}
+}
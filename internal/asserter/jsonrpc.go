@@ -0,0 +1,68 @@
+package asserter
+
+import "fmt"
+
+// alignJSONRPCBatch reorders the actual responses to a JSON-RPC batch so
+// each lines up with the expected response of the same id, since servers
+// may answer the calls of a batch in any order. Responses without a
+// counterpart fill the remaining positions in their original order. Bodies
+// that aren't batch responses are returned unchanged.
+func alignJSONRPCBatch(expected, actual any) any {
+	e, ok := normalize(expected).([]any)
+	if !ok || !isJSONRPCBatch(e) {
+		return actual
+	}
+	a, ok := normalize(actual).([]any)
+	if !ok || !isJSONRPCBatch(a) {
+		return actual
+	}
+
+	matched := make([]any, len(e))
+	used := make([]bool, len(a))
+	for i, want := range e {
+		for j, got := range a {
+			if !used[j] && jsonRPCID(got) == jsonRPCID(want) {
+				matched[i] = got
+				used[j] = true
+				break
+			}
+		}
+	}
+	var rest []any
+	for j, got := range a {
+		if !used[j] {
+			rest = append(rest, got)
+		}
+	}
+	aligned := make([]any, 0, len(a))
+	for _, got := range matched {
+		if got == nil && len(rest) > 0 {
+			got, rest = rest[0], rest[1:]
+		}
+		if got != nil {
+			aligned = append(aligned, got)
+		}
+	}
+	return append(aligned, rest...)
+}
+
+// isJSONRPCBatch reports whether a list holds only JSON-RPC responses.
+func isJSONRPCBatch(list []any) bool {
+	if len(list) == 0 {
+		return false
+	}
+	for _, v := range list {
+		m, ok := v.(map[string]any)
+		if !ok || m["jsonrpc"] == nil {
+			return false
+		}
+		if _, ok := m["id"]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func jsonRPCID(response any) string {
+	return fmt.Sprintf("%v", response.(map[string]any)["id"])
+}
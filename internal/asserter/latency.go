@@ -0,0 +1,55 @@
+package asserter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DiffKindLatency marks a replayed request that took much longer than when
+// it was recorded.
+const DiffKindLatency = "latency_regression"
+
+// LatencyOptions configures AssertLatency.
+type LatencyOptions struct {
+	Tolerance float64       // allowed slowdown as a fraction of the recorded time; 0 disables the check
+	MinDelta  time.Duration // slowdowns smaller than this are ignored as noise
+	MaxDelta  time.Duration // slowdowns larger than this are reported whatever the tolerance; 0 disables the check
+	Fail      bool          // report a regression as a failure rather than a warning
+}
+
+// AssertLatency compares the time the service took to answer a replayed
+// request with the recorded time, under the path "response.latency". A
+// slowdown beyond the minimum delta is reported when it also exceeds the
+// tolerance or the maximum delta; faster responses never are.
+func AssertLatency(recorded, actual time.Duration, opts LatencyOptions) []Diff {
+	if opts.Tolerance <= 0 && opts.MaxDelta <= 0 {
+		return nil
+	}
+	delta := actual - recorded
+	if delta <= opts.MinDelta {
+		return nil
+	}
+	var limits []string
+	if opts.Tolerance > 0 && float64(actual) > float64(recorded)*(1+opts.Tolerance) {
+		limits = append(limits, fmt.Sprintf("tolerance %.0f%%", opts.Tolerance*100))
+	}
+	if opts.MaxDelta > 0 && delta > opts.MaxDelta {
+		limits = append(limits, fmt.Sprintf("max delta %dms", opts.MaxDelta.Milliseconds()))
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+	diff := Diff{
+		Path:     "response.latency",
+		Kind:     DiffKindLatency,
+		Expected: recorded.Milliseconds(),
+		Actual:   actual.Milliseconds(),
+		Message: fmt.Sprintf("Response took %dms, %dms more than the %dms recorded (%s)",
+			actual.Milliseconds(), delta.Milliseconds(), recorded.Milliseconds(), strings.Join(limits, ", ")),
+	}
+	if !opts.Fail {
+		diff.Severity = SeverityWarning
+	}
+	return []Diff{diff}
+}
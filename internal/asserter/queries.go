@@ -0,0 +1,26 @@
+package asserter
+
+// DiffKindQueriesNotCaptured marks a replayed request whose SQL statements
+// were not reported, although the snapshot recorded them.
+const DiffKindQueriesNotCaptured = "queries_not_captured"
+
+// AssertQueries compares the SQL statements and arguments recorded with a
+// snapshot with those executed on replay, in order, under the path
+// "queries". A nil actual means the service did not report its queries,
+// e.g. because it ran without the sqlcapture driver; that is a warning.
+func AssertQueries(expected, actual any, opts *Options) []Diff {
+	a := normalize(actual)
+	if a == nil {
+		return []Diff{{
+			Path:     "queries",
+			Kind:     DiffKindQueriesNotCaptured,
+			Severity: SeverityWarning,
+			Message:  "Queries were recorded but not reported on replay",
+		}}
+	}
+	e := normalize(expected)
+	if e == nil {
+		e = []any{}
+	}
+	return compareValues("queries", e, a, opts)
+}
@@ -0,0 +1,83 @@
+package asserter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Keys of the structured XML body representation; must match the XML*
+// constants in the snapshot package.
+const (
+	xmlEncoding   = "xml"
+	xmlAttrPrefix = "@"
+	xmlTextKey    = "#text"
+	xmlOrderKey   = "#order"
+	xmlDeclKey    = "?xml"
+)
+
+// isXMLBody reports whether a body holds a parsed XML document.
+func isXMLBody(body any) bool {
+	m, ok := normalize(body).(map[string]any)
+	return ok && m["encoding"] == xmlEncoding
+}
+
+// describeXMLDiffs rewords diffs found inside an XML body in terms of
+// attributes, text, elements and their order, which the generic messages
+// ("Missing field") obscure.
+func describeXMLDiffs(diffs []Diff) {
+	for i := range diffs {
+		d := &diffs[i]
+		if strings.Contains(d.Path, "."+xmlOrderKey) {
+			d.Message = "Element order mismatch"
+			continue
+		}
+		field := d.Path[strings.LastIndex(d.Path, ".")+1:]
+		if j := strings.Index(field, "["); j >= 0 {
+			field = field[:j]
+		}
+
+		var subject string
+		switch {
+		case strings.HasPrefix(field, xmlAttrPrefix):
+			subject = "Attribute " + strings.TrimPrefix(field, xmlAttrPrefix)
+		case field == xmlTextKey:
+			subject = "Element text"
+		case field == xmlDeclKey:
+			subject = "XML declaration"
+		default:
+			subject = "Element " + field
+		}
+
+		switch d.Kind {
+		case DiffKindMissingField, DiffKindMissingElement:
+			d.Message = subject + " missing"
+		case DiffKindUnexpectedField, DiffKindUnexpectedElement:
+			d.Message = subject + " unexpected"
+		case DiffKindValueMismatch:
+			d.Message = subject + " mismatch"
+		}
+	}
+}
+
+// soapEnvelopePath matches the SOAP envelope elements at the top of an XML
+// body path, whatever namespace prefix the document gives them.
+var soapEnvelopePath = regexp.MustCompile(`^(.*\.data\.)(?:[^.\[]+:)?Envelope(?:\.(?:[^.\[]+:)?(Body|Header))?(\.|\[|$)`)
+
+// soapPath rewrites the envelope elements of a path inside an XML body to
+// soap:Envelope, soap:Header and soap:Body, so ignore rules written with
+// those names hold for soapenv:, SOAP-ENV: and other prefixes. Other paths
+// are returned unchanged.
+func soapPath(path string) string {
+	if !strings.Contains(path, "Envelope") {
+		return path
+	}
+	m := soapEnvelopePath.FindStringSubmatchIndex(path)
+	if m == nil {
+		return path
+	}
+	canonical := path[:m[3]] + "soap:Envelope"
+	if m[4] >= 0 {
+		canonical += ".soap:" + path[m[4]:m[5]]
+	}
+	return canonical + path[m[6]:]
+}
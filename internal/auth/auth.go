@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Role is the access level granted to a token.
+type Role string
+
+// Supported roles (must match config auth.tokens[].role values).
+// Admin implies Read.
+const (
+	RoleRead  Role = "read"
+	RoleAdmin Role = "admin"
+)
+
+// Authenticator checks Bearer tokens against the configured token list.
+type Authenticator struct {
+	tokens []config.AuthToken
+}
+
+// New creates an Authenticator from the auth configuration.
+func New(cfg config.AuthConfig) *Authenticator {
+	return &Authenticator{tokens: cfg.Tokens}
+}
+
+// Enabled reports whether any tokens are configured.
+func (a *Authenticator) Enabled() bool {
+	return a != nil && len(a.tokens) > 0
+}
+
+// RoleFor returns the role granted to token, or false if the token is unknown.
+func (a *Authenticator) RoleFor(token string) (Role, bool) {
+	if a == nil || token == "" {
+		return "", false
+	}
+	for _, t := range a.tokens {
+		// Constant-time comparison so tokens cannot be guessed by timing
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return Role(t.Role), true
+		}
+	}
+	return "", false
+}
+
+// Allows reports whether granted satisfies the required role.
+func Allows(granted, required Role) bool {
+	if granted == RoleAdmin {
+		return true
+	}
+	return granted == required
+}
+
+// Require wraps a handler so it is only served to requests carrying a Bearer
+// token with at least the required role. Missing or unknown tokens yield 401
+// and insufficient roles yield 403.
+func (a *Authenticator) Require(required Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := bearerToken(req)
+		if !ok {
+			w.Header().Set(snapshot.HeaderWWWAuthenticate, `Bearer realm="snapshot-tester"`)
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+		role, known := a.RoleFor(token)
+		if !known {
+			w.Header().Set(snapshot.HeaderWWWAuthenticate, `Bearer realm="snapshot-tester", error="invalid_token"`)
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		if !Allows(role, required) {
+			http.Error(w, "Insufficient role, requires "+string(required), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func bearerToken(req *http.Request) (string, bool) {
+	h := req.Header.Get(snapshot.HeaderAuthorization)
+	if len(h) < len(snapshot.AuthSchemeBearer) || !strings.EqualFold(h[:len(snapshot.AuthSchemeBearer)], snapshot.AuthSchemeBearer) {
+		return "", false
+	}
+	return h[len(snapshot.AuthSchemeBearer):], true
+}
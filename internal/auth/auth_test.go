@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+func newTestAuthenticator() *Authenticator {
+	return New(config.AuthConfig{Tokens: []config.AuthToken{
+		{Token: "reader-token", Role: "read"},
+		{Token: "admin-token", Role: "admin"},
+	}})
+}
+
+func TestRequire(t *testing.T) {
+	authn := newTestAuthenticator()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		required Role
+		header   string
+		want     int
+	}{
+		{"missing token", RoleRead, "", http.StatusUnauthorized},
+		{"wrong scheme", RoleRead, "Basic reader-token", http.StatusUnauthorized},
+		{"unknown token", RoleRead, "Bearer nope", http.StatusUnauthorized},
+		{"reader on read endpoint", RoleRead, "Bearer reader-token", http.StatusOK},
+		{"reader on admin endpoint", RoleAdmin, "Bearer reader-token", http.StatusForbidden},
+		{"admin on read endpoint", RoleRead, "Bearer admin-token", http.StatusOK},
+		{"admin on admin endpoint", RoleAdmin, "bearer admin-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			authn.Require(tt.required, ok).ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header on 401")
+			}
+		})
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	if New(config.AuthConfig{}).Enabled() {
+		t.Error("expected authenticator without tokens to be disabled")
+	}
+	if !newTestAuthenticator().Enabled() {
+		t.Error("expected authenticator with tokens to be enabled")
+	}
+}
@@ -0,0 +1,205 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/httpclient"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Stats summarizes the latency of one endpoint across all iterations.
+type Stats struct {
+	Endpoint string        `json:"endpoint"`
+	Count    int           `json:"count"`
+	Errors   int           `json:"errors"`
+	P50      time.Duration `json:"p50"`
+	P95      time.Duration `json:"p95"`
+	P99      time.Duration `json:"p99"`
+}
+
+// Baseline maps endpoints to the stats of a previous run.
+type Baseline map[string]Stats
+
+// Runner fires snapshot requests repeatedly and measures their latency.
+// Responses are not asserted and the database is not restored.
+type Runner struct {
+	baseURL    string
+	timeoutMs  int
+	iterations int
+	fire       func(baseURL string, req snapshot.Request, timeoutMs int) (*snapshot.Response, error)
+}
+
+// New creates a Runner that replays each snapshot the given number of times.
+func New(cfg *config.Config, iterations int) (*Runner, error) {
+	if iterations < 1 {
+		iterations = 1
+	}
+	serviceTLS, err := httpclient.LoadTLS(cfg.Service.ClientCert, cfg.Service.ClientKey, cfg.Service.CACert)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{
+		baseURL:    cfg.Service.BaseURL,
+		timeoutMs:  cfg.Replay.TimeoutMs,
+		iterations: iterations,
+		fire: func(baseURL string, req snapshot.Request, timeoutMs int) (*snapshot.Response, error) {
+			return httpclient.FireRequestWith(baseURL, req, timeoutMs, httpclient.Options{TLS: serviceTLS})
+		},
+	}, nil
+}
+
+// Run replays every snapshot and returns per-endpoint stats sorted by endpoint.
+// Failed requests are counted as errors and excluded from the percentiles.
+func (r *Runner) Run(snapshots []*snapshot.Snapshot) []Stats {
+	samples := make(map[string][]time.Duration)
+	errCounts := make(map[string]int)
+
+	for i := 0; i < r.iterations; i++ {
+		for _, snap := range snapshots {
+			endpoint := Endpoint(snap.Request)
+			start := time.Now()
+			_, err := r.fire(r.baseURL, snap.Request, r.timeoutMs)
+			elapsed := time.Since(start)
+			if err != nil {
+				errCounts[endpoint]++
+				continue
+			}
+			samples[endpoint] = append(samples[endpoint], elapsed)
+		}
+	}
+
+	endpoints := make(map[string]bool)
+	for e := range samples {
+		endpoints[e] = true
+	}
+	for e := range errCounts {
+		endpoints[e] = true
+	}
+
+	stats := make([]Stats, 0, len(endpoints))
+	for e := range endpoints {
+		durations := samples[e]
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		stats = append(stats, Stats{
+			Endpoint: e,
+			Count:    len(durations),
+			Errors:   errCounts[e],
+			P50:      Percentile(durations, 50),
+			P95:      Percentile(durations, 95),
+			P99:      Percentile(durations, 99),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Endpoint < stats[j].Endpoint })
+	return stats
+}
+
+// Endpoint identifies a request by method and path, ignoring the query string,
+// and by operation for SOAP calls.
+func Endpoint(req snapshot.Request) string {
+	path, _, _ := strings.Cut(req.URL, "?")
+	if op := snapshot.SOAPOperation(req.Headers, req.Body); op != "" {
+		return req.Method + " " + path + "#" + op
+	}
+	return req.Method + " " + path
+}
+
+// Percentile returns the p-th percentile of sorted durations using the
+// nearest-rank method. It returns 0 for an empty slice.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// LoadBaseline reads a baseline previously written by SaveBaseline.
+func LoadBaseline(path string) (Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading baseline: %w", err)
+	}
+	var stats []Stats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("parsing baseline: %w", err)
+	}
+	baseline := make(Baseline, len(stats))
+	for _, s := range stats {
+		baseline[s.Endpoint] = s
+	}
+	return baseline, nil
+}
+
+// SaveBaseline writes stats to path for comparison by later runs.
+func SaveBaseline(path string, stats []Stats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling baseline: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing baseline: %w", err)
+	}
+	return nil
+}
+
+// Delta returns the relative change of current over base in percent.
+// It returns 0 when there is no base to compare against.
+func Delta(base, current time.Duration) float64 {
+	if base <= 0 {
+		return 0
+	}
+	return (float64(current) - float64(base)) / float64(base) * 100
+}
+
+// Regressions returns the endpoints whose p95 grew by more than maxPercent
+// compared with the baseline. Endpoints missing from the baseline are skipped.
+func Regressions(stats []Stats, baseline Baseline, maxPercent float64) []string {
+	var regressed []string
+	for _, s := range stats {
+		base, ok := baseline[s.Endpoint]
+		if !ok {
+			continue
+		}
+		if Delta(base.P95, s.P95) > maxPercent {
+			regressed = append(regressed, s.Endpoint)
+		}
+	}
+	return regressed
+}
+
+// Format renders stats as a table, with p95 deltas when a baseline is given.
+func Format(stats []Stats, baseline Baseline) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-40s %6s %6s %10s %10s %10s", "ENDPOINT", "COUNT", "ERRORS", "P50", "P95", "P99"))
+	if baseline != nil {
+		sb.WriteString(fmt.Sprintf(" %10s", "P95 DELTA"))
+	}
+	sb.WriteString("\n")
+
+	for _, s := range stats {
+		sb.WriteString(fmt.Sprintf("%-40s %6d %6d %10s %10s %10s", s.Endpoint, s.Count, s.Errors,
+			s.P50.Round(time.Microsecond), s.P95.Round(time.Microsecond), s.P99.Round(time.Microsecond)))
+		if baseline != nil {
+			if base, ok := baseline[s.Endpoint]; ok && base.P95 > 0 {
+				sb.WriteString(fmt.Sprintf(" %+9.1f%%", Delta(base.P95, s.P95)))
+			} else {
+				sb.WriteString(fmt.Sprintf(" %10s", "new"))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,104 @@
+package bench
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestPercentile(t *testing.T) {
+	var d []time.Duration
+	for i := 1; i <= 100; i++ {
+		d = append(d, time.Duration(i)*time.Millisecond)
+	}
+	cases := map[float64]time.Duration{50: 50 * time.Millisecond, 95: 95 * time.Millisecond, 99: 99 * time.Millisecond}
+	for p, want := range cases {
+		if got := Percentile(d, p); got != want {
+			t.Errorf("p%v = %s, want %s", p, got, want)
+		}
+	}
+	if Percentile(nil, 50) != 0 {
+		t.Error("expected 0 for empty samples")
+	}
+	if got := Percentile([]time.Duration{7}, 99); got != 7 {
+		t.Errorf("expected single sample, got %s", got)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	got := Endpoint(snapshot.Request{Method: "GET", URL: "/users?page=2"})
+	if got != "GET /users" {
+		t.Errorf("expected query string to be dropped, got %q", got)
+	}
+	got = Endpoint(snapshot.Request{Method: "POST", URL: "/ws", Headers: map[string]string{"SOAPAction": "urn:stock#GetPrice"}})
+	if got != "POST /ws#GetPrice" {
+		t.Errorf("expected SOAP operation in endpoint, got %q", got)
+	}
+}
+
+func TestRunnerRun(t *testing.T) {
+	calls := 0
+	r := &Runner{
+		iterations: 3,
+		fire: func(baseURL string, req snapshot.Request, timeoutMs int) (*snapshot.Response, error) {
+			calls++
+			if req.URL == "/fail" {
+				return nil, errors.New("boom")
+			}
+			return &snapshot.Response{Status: 200}, nil
+		},
+	}
+	stats := r.Run([]*snapshot.Snapshot{
+		{Request: snapshot.Request{Method: "GET", URL: "/users?a=1"}},
+		{Request: snapshot.Request{Method: "GET", URL: "/users?a=2"}},
+		{Request: snapshot.Request{Method: "GET", URL: "/fail"}},
+	})
+
+	if calls != 9 {
+		t.Errorf("expected 9 requests, got %d", calls)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 endpoints, got %+v", stats)
+	}
+	if stats[0].Endpoint != "GET /fail" || stats[0].Errors != 3 || stats[0].Count != 0 {
+		t.Errorf("unexpected stats for failing endpoint: %+v", stats[0])
+	}
+	if stats[1].Endpoint != "GET /users" || stats[1].Count != 6 {
+		t.Errorf("unexpected stats for /users: %+v", stats[1])
+	}
+}
+
+func TestBaselineRoundTripAndRegressions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	base := []Stats{{Endpoint: "GET /users", Count: 10, P95: 10 * time.Millisecond}}
+	if err := SaveBaseline(path, base); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baseline["GET /users"].P95 != 10*time.Millisecond {
+		t.Fatalf("unexpected baseline %+v", baseline)
+	}
+
+	current := []Stats{
+		{Endpoint: "GET /users", P95: 13 * time.Millisecond},
+		{Endpoint: "GET /new", P95: time.Second},
+	}
+	if got := Regressions(current, baseline, 20); len(got) != 1 || got[0] != "GET /users" {
+		t.Errorf("expected GET /users to regress, got %v", got)
+	}
+	if got := Regressions(current, baseline, 50); len(got) != 0 {
+		t.Errorf("expected no regressions above 50%%, got %v", got)
+	}
+
+	out := Format(current, baseline)
+	if !strings.Contains(out, "+30.0%") || !strings.Contains(out, "new") {
+		t.Errorf("expected deltas in output\n%s", out)
+	}
+}
@@ -1,9 +1,14 @@
 package cli
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/esse/snapshot-tester/internal/asserter"
 	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/replayer"
 	"github.com/esse/snapshot-tester/internal/snapshot"
 )
 
@@ -20,17 +25,38 @@ func TestFireRequestForUpdate_UsesSharedClient(t *testing.T) {
 		},
 	}
 
-	req := snapshot.Request{
-		Method: "GET",
-		URL:    "/api/test",
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method: "GET",
+			URL:    "/api/test",
+		},
 	}
 
-	_, err := fireRequestForUpdate(cfg, req)
+	_, err := fireRequestForUpdate(cfg, snap)
 	if err == nil {
 		t.Error("expected error for unreachable service")
 	}
 }
 
+func TestFireRequestForUpdate_SnapshotTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{BaseURL: server.URL},
+		Replay:  config.ReplayConfig{TimeoutMs: 50},
+	}
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{Method: "GET", URL: "/slow"},
+		Replay:  &snapshot.ReplayOptions{TimeoutMs: 2000},
+	}
+	if _, err := fireRequestForUpdate(cfg, snap); err != nil {
+		t.Errorf("expected the snapshot's timeout to apply, got %v", err)
+	}
+}
+
 func TestComputeDiffForUpdate(t *testing.T) {
 	before := map[string][]map[string]any{
 		"users": {
@@ -44,7 +70,7 @@ func TestComputeDiffForUpdate(t *testing.T) {
 		},
 	}
 
-	diff := computeDiffForUpdate(before, after)
+	diff := computeDiffForUpdate(&config.Config{}, before, after)
 	if diff == nil {
 		t.Fatal("expected non-nil diff")
 	}
@@ -66,8 +92,110 @@ func TestNewSnapshotterForUpdate_InvalidType(t *testing.T) {
 		},
 	}
 
-	_, err := newSnapshotterForUpdate(cfg, "test")
+	_, err := newSnapshotterForUpdate(cfg)
 	if err == nil {
 		t.Error("expected error for invalid database type")
 	}
 }
+
+func TestInSession(t *testing.T) {
+	snaps := []*snapshot.Snapshot{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	paths := []string{
+		"snapshots/nightly/api/GET_users/001_a.snapshot.json",
+		"snapshots/api/GET_users/001_b.snapshot.json",
+		"snapshots/nightly-2/api/GET_users/001_c.snapshot.json",
+	}
+	kept, keptPaths := inSession("snapshots/nightly", snaps, paths)
+	if len(kept) != 1 || kept[0].ID != "a" || keptPaths[0] != paths[0] {
+		t.Errorf("expected only the nightly snapshot, got %v", keptPaths)
+	}
+}
+
+func TestAcceptFailures(t *testing.T) {
+	cfg := &config.Config{}
+	store := snapshot.NewStore(t.TempDir(), "json")
+	users := []map[string]any{{"id": float64(1), "name": "Alice"}}
+	save := func(id string) (*snapshot.Snapshot, string) {
+		snap := &snapshot.Snapshot{
+			ID:            id,
+			Service:       "svc",
+			Request:       snapshot.Request{Method: "POST", URL: "/users"},
+			Response:      snapshot.Response{Status: 201, Body: map[string]any{"id": float64(2)}},
+			DBStateBefore: map[string][]map[string]any{"users": users},
+			DBStateAfter:  map[string][]map[string]any{"users": users},
+		}
+		path, err := store.Save(snap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snap, path
+	}
+	failed, failedPath := save("f1")
+	errored, erroredPath := save("e1")
+	passed, passedPath := save("p1")
+
+	after := map[string][]map[string]any{"users": {users[0], {"id": float64(2), "name": "Bob"}}}
+	results := []replayer.TestResult{
+		{
+			SnapshotPath:   failedPath,
+			ActualResponse: &snapshot.Response{Status: 200, Body: map[string]any{"id": float64(2), "name": "Bob"}},
+			ActualDBState:  after,
+			Diffs:          []asserter.Diff{{Path: "response.status"}, {Path: "db.users.length"}},
+		},
+		{SnapshotPath: erroredPath, Error: "connection refused"},
+		{SnapshotPath: passedPath, Passed: true},
+	}
+
+	updated, err := acceptFailures(cfg, store, []*snapshot.Snapshot{failed, errored, passed}, []string{failedPath, erroredPath, passedPath}, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 1 || !updated[failedPath] {
+		t.Fatalf("expected only the failed snapshot updated, got %v", updated)
+	}
+
+	got, err := store.Load(failedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Response.Status != 200 || len(got.DBStateAfter["users"]) != 2 || len(got.DBDiff["users"].Added) != 1 {
+		t.Errorf("expected the replayed response and DB state saved, got %+v", got)
+	}
+	if got, _ := store.Load(erroredPath); got.Response.Status != 201 {
+		t.Errorf("expected the errored snapshot left alone, got status %d", got.Response.Status)
+	}
+}
+
+func TestRewriteSnapshot_Redacts(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Recording.RedactFields = []string{"response.body.token"}
+	store := snapshot.NewStore(t.TempDir(), "json")
+	snap := &snapshot.Snapshot{ID: "r1", Service: "svc", Request: snapshot.Request{Method: "POST", URL: "/login"}, Response: snapshot.Response{Status: 200}}
+	path, err := store.Save(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &snapshot.Response{Status: 200, Body: map[string]any{"token": "s3cret"}}
+	if err := rewriteSnapshot(cfg, store, snap, path, resp, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := got.Response.Body.(map[string]any); body["token"] == "s3cret" {
+		t.Errorf("expected the token redacted, got %v", got.Response.Body)
+	}
+}
+
+func TestChangedPaths(t *testing.T) {
+	var diffs []asserter.Diff
+	for _, p := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		diffs = append(diffs, asserter.Diff{Path: p})
+	}
+	diffs = append(diffs, asserter.Diff{Path: "w", Severity: asserter.SeverityWarning})
+	if got := changedPaths(diffs); got != "a, b, c, d, e and 2 more" {
+		t.Errorf("unexpected summary %q", got)
+	}
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+// registerCompletions wires dynamic completion for --tag, --snapshot and --scenario flags
+// and snapshot path arguments on every subcommand that has them, at any depth.
+func registerCompletions(root *cobra.Command) {
+	registerFlagCompletions(root)
+	if show, _, err := root.Find([]string{"show"}); err == nil && show != root {
+		show.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeSnapshotPaths(cmd, args, toComplete)
+		}
+	}
+}
+
+// registerFlagCompletions registers the flag completions on the children of
+// cmd and, recursively, on theirs.
+func registerFlagCompletions(cmd *cobra.Command) {
+	for _, child := range cmd.Commands() {
+		if child.Flags().Lookup("tag") != nil {
+			child.RegisterFlagCompletionFunc("tag", completeTags)
+		}
+		if child.Flags().Lookup("snapshot") != nil {
+			child.RegisterFlagCompletionFunc("snapshot", completeSnapshotPaths)
+		}
+		if child.Flags().Lookup("scenario") != nil {
+			child.RegisterFlagCompletionFunc("scenario", completeScenarios)
+		}
+		registerFlagCompletions(child)
+	}
+}
+
+// completionStore opens the snapshot store named by the command's --config flag.
+func completionStore(cmd *cobra.Command) (*snapshot.Store, bool) {
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, false
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, false
+	}
+	return snapshot.NewStore(cfg.Recording.SnapshotDir, cfg.Recording.Format), true
+}
+
+// completeTags completes tag names from the store. Values may be
+// comma-separated, so only the part after the last comma is completed.
+func completeTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	store, ok := completionStore(cmd)
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	infos, err := store.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	prefix, partial := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, partial = toComplete[:i+1], toComplete[i+1:]
+	}
+	chosen := make(map[string]bool)
+	for _, t := range strings.Split(prefix, ",") {
+		chosen[t] = true
+	}
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, info := range infos {
+		for _, t := range info.Tags {
+			if seen[t] || chosen[t] || !strings.HasPrefix(t, partial) {
+				continue
+			}
+			seen[t] = true
+			tags = append(tags, prefix+t)
+		}
+	}
+	sort.Strings(tags)
+	return tags, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// completeSnapshotPaths completes snapshot file paths from the store. If the
+// config cannot be loaded, it falls back to regular file completion.
+func completeSnapshotPaths(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	store, ok := completionStore(cmd)
+	if !ok {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	infos, err := store.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	var paths []string
+	for _, info := range infos {
+		if strings.HasPrefix(info.Path, toComplete) {
+			paths = append(paths, info.Path)
+		}
+	}
+	return paths, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeScenarios completes the names of recorded scenarios.
+func completeScenarios(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	store, ok := completionStore(cmd)
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names, err := store.Scenarios()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var matches []string
+	for _, name := range names {
+		if strings.HasPrefix(name, toComplete) {
+			matches = append(matches, name)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+// completionFixture writes a config and two snapshots, returning a command
+// whose --config flag points at them.
+func completionFixture(t *testing.T) (*cobra.Command, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	snapDir := filepath.Join(dir, "snapshots")
+	configPath := filepath.Join(dir, "config.yml")
+	content := fmt.Sprintf(`
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: "test.db"
+recording:
+  snapshot_dir: %q
+`, snapDir)
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := snapshot.NewStore(snapDir, "json")
+	var paths []string
+	for _, tags := range [][]string{{"users", "smoke"}, {"orders"}} {
+		p, err := store.Save(&snapshot.Snapshot{ID: snapshot.GenerateID(), Service: "api", Tags: tags, Request: snapshot.Request{Method: "GET", URL: "/" + tags[0]}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("config", configPath, "")
+	return cmd, paths
+}
+
+func TestCompleteTags(t *testing.T) {
+	cmd, _ := completionFixture(t)
+
+	got, directive := completeTags(cmd, nil, "")
+	if len(got) != 3 || got[0] != "orders" || got[1] != "smoke" || got[2] != "users" {
+		t.Errorf("expected all tags sorted, got %v", got)
+	}
+	if directive&cobra.ShellCompDirectiveNoFileComp == 0 {
+		t.Error("expected file completion to be disabled")
+	}
+
+	got, _ = completeTags(cmd, nil, "users,s")
+	if len(got) != 1 || got[0] != "users,smoke" {
+		t.Errorf("expected completion after comma, got %v", got)
+	}
+}
+
+func TestCompleteSnapshotPaths(t *testing.T) {
+	cmd, paths := completionFixture(t)
+
+	got, _ := completeSnapshotPaths(cmd, nil, "")
+	if len(got) != 2 {
+		t.Fatalf("expected 2 paths, got %v", got)
+	}
+
+	got, _ = completeSnapshotPaths(cmd, nil, filepath.Dir(paths[1]))
+	if len(got) != 1 || got[0] != paths[1] {
+		t.Errorf("expected prefix-filtered path %s, got %v", paths[1], got)
+	}
+}
+
+func TestCompleteSnapshotPaths_BadConfigFallsBack(t *testing.T) {
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("config", filepath.Join(t.TempDir(), "missing.yml"), "")
+
+	got, directive := completeSnapshotPaths(cmd, nil, "")
+	if got != nil || directive != cobra.ShellCompDirectiveDefault {
+		t.Errorf("expected default file completion, got %v %v", got, directive)
+	}
+}
+
+func TestRegisterCompletions_NestedCommands(t *testing.T) {
+	root := &cobra.Command{Use: "snapshot-tester"}
+	root.AddCommand(newQuarantineCmd())
+	registerCompletions(root)
+
+	add, _, err := root.Find([]string{"quarantine", "add"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := add.GetFlagCompletionFunc("snapshot"); !ok {
+		t.Error("expected --snapshot completion on a nested subcommand")
+	}
+}
@@ -4,17 +4,62 @@ import (
 	"github.com/esse/snapshot-tester/internal/config"
 	dbpkg "github.com/esse/snapshot-tester/internal/db"
 	"github.com/esse/snapshot-tester/internal/httpclient"
+	"github.com/esse/snapshot-tester/internal/replayer"
 	"github.com/esse/snapshot-tester/internal/snapshot"
 )
 
-func newSnapshotterForUpdate(cfg *config.Config, connStr string) (dbpkg.Snapshotter, error) {
-	return dbpkg.NewSnapshotter(cfg.Database.Type, connStr, cfg.Database.Tables, cfg.Database.Namespaces)
+func newSnapshotterForUpdate(cfg *config.Config) (dbpkg.Snapshotter, error) {
+	return replayer.OpenTestDatabases(cfg)
 }
 
-func fireRequestForUpdate(cfg *config.Config, req snapshot.Request) (*snapshot.Response, error) {
-	return httpclient.FireRequest(cfg.Service.BaseURL, req, cfg.Replay.TimeoutMs)
+// updateOptions returns the options for re-firing requests against the
+// service, with its TLS settings.
+func updateOptions(cfg *config.Config) (httpclient.Options, error) {
+	serviceTLS, err := httpclient.LoadTLS(cfg.Service.ClientCert, cfg.Service.ClientKey, cfg.Service.CACert)
+	if err != nil {
+		return httpclient.Options{}, err
+	}
+	return httpclient.Options{TLS: serviceTLS}, nil
 }
 
-func computeDiffForUpdate(before, after map[string][]map[string]any) map[string]snapshot.TableDiff {
-	return dbpkg.ComputeDiff(before, after)
+// fireRequestForUpdate re-fires the snapshot's request, with its own
+// replay.timeout_ms if it sets one.
+func fireRequestForUpdate(cfg *config.Config, snap *snapshot.Snapshot) (*snapshot.Response, error) {
+	opts, err := updateOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return httpclient.FireRequestWith(cfg.Service.BaseURL, snap.Request, replayer.TimeoutMs(cfg, snap), opts)
+}
+
+// fireEventStreamForUpdate re-reads as many events as the snapshot recorded.
+func fireEventStreamForUpdate(cfg *config.Config, snap *snapshot.Snapshot) (*snapshot.Response, error) {
+	opts, err := updateOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts.MaxEvents = len(snap.Response.Events)
+	return httpclient.FireRequestWith(cfg.Service.BaseURL, snap.Request, replayer.TimeoutMs(cfg, snap), opts)
+}
+
+func fireWebSocketForUpdate(cfg *config.Config, snap *snapshot.Snapshot) (*snapshot.Response, []snapshot.Message, error) {
+	opts, err := updateOptions(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return httpclient.FireWebSocketWith(cfg.Service.BaseURL, snap.Request, snap.WebSocket, replayer.TimeoutMs(cfg, snap), opts)
+}
+
+func computeDiffForUpdate(cfg *config.Config, before, after map[string][]map[string]any) map[string]snapshot.TableDiff {
+	return dbpkg.ComputeDiff(before, after, cfg.Replay.RowKeys)
+}
+
+// newAuditedStore returns a store that records modifications in the audit log,
+// attributed to the given command.
+func newAuditedStore(cfg *config.Config, command string) *snapshot.Store {
+	store := snapshot.NewStore(cfg.Recording.SnapshotDir, cfg.Recording.Format)
+	store.DedupStates = cfg.Recording.DedupDBStates
+	store.BodyFileThreshold = cfg.Recording.BodyFileThreshold
+	store.Audit = snapshot.NewAuditLog(cfg.Recording.SnapshotDir, command)
+	return store
 }
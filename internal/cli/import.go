@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/importer"
+	"github.com/esse/snapshot-tester/internal/recorder"
+	"github.com/esse/snapshot-tester/internal/redact"
+	"github.com/esse/snapshot-tester/internal/security"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+func newImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Create snapshots from traffic captured by other tools",
+	}
+	cmd.AddCommand(newImportHARCmd(), newImportCollectionCmd())
+	return cmd
+}
+
+func newImportHARCmd() *cobra.Command {
+	var (
+		configPath string
+		host       string
+		tags       []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "har <file>",
+		Short: "Convert a HAR capture (e.g. exported from browser devtools) into snapshots",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := security.ValidateConfigPath(configPath); err != nil {
+				return fmt.Errorf("invalid config path: %w", err)
+			}
+
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("opening HAR file: %w", err)
+			}
+			defer f.Close()
+
+			snaps, err := importer.ReadHAR(f, importer.HAROptions{
+				Service:       cfg.Service.Name,
+				Host:          host,
+				Tags:          tags,
+				IgnoreHeaders: cfg.Recording.IgnoreHeaders,
+			})
+			if err != nil {
+				return err
+			}
+
+			store := snapshot.NewStore(cfg.Recording.SnapshotDir, cfg.Recording.Format)
+			store.DedupStates = cfg.Recording.DedupDBStates
+			store.BodyFileThreshold = cfg.Recording.BodyFileThreshold
+			for _, snap := range snaps {
+				if len(cfg.Recording.RedactFields) > 0 {
+					redactor := redact.New(cfg.Recording.RedactMode, cfg.Recording.RedactKey)
+					redact.Snapshot(snap, cfg.Recording.RedactFields, redactor)
+				}
+				path, err := store.Save(snap)
+				if err != nil {
+					return fmt.Errorf("saving snapshot: %w", err)
+				}
+				fmt.Printf("  %s %s -> %s\n", snap.Request.Method, snap.Request.URL, path)
+			}
+
+			fmt.Printf("Imported %d snapshot(s)\n", len(snaps))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "snapshot-tester.yml", "Path to config file")
+	cmd.Flags().StringVar(&host, "host", "", "Only import requests to this host (e.g. api.example.com:8080)")
+	cmd.Flags().StringSliceVar(&tags, "tag", nil, "Tag the imported snapshots (repeatable)")
+
+	return cmd
+}
+
+func newImportCollectionCmd() *cobra.Command {
+	var (
+		configPath string
+		vars       []string
+		tags       []string
+		scenario   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "collection <file>",
+		Short: "Record a snapshot of each request in a Postman collection or Insomnia export",
+		Long: `Sends the requests of a Postman collection (v2.0 or v2.1) or Insomnia export (v4)
+to the service in order, recording each like record-one: DB state before and
+after, outgoing calls and the response.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := security.ValidateConfigPath(configPath); err != nil {
+				return fmt.Errorf("invalid config path: %w", err)
+			}
+
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			values := make(map[string]string, len(vars))
+			for _, v := range vars {
+				name, value, ok := strings.Cut(v, "=")
+				if !ok || name == "" {
+					return fmt.Errorf("invalid --var %q: expected name=value", v)
+				}
+				values[name] = value
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("opening collection: %w", err)
+			}
+			requests, err := importer.ReadCollection(f, values)
+			f.Close()
+			if err != nil {
+				return err
+			}
+
+			rec, err := recorder.New(cfg, tags)
+			if err != nil {
+				return fmt.Errorf("creating recorder: %w", err)
+			}
+			defer rec.Close()
+			if err := rec.SetScenario(scenario); err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, cr := range requests {
+				snap, path, err := recordCollectionRequest(rec, cr)
+				if err != nil {
+					failed++
+					fmt.Printf("  %s: %s %s FAILED: %v\n", cr.Name, cr.Method, cr.URL, err)
+					continue
+				}
+				fmt.Printf("  %s: %s %s -> %d %s\n", cr.Name, cr.Method, cr.URL, snap.Response.Status, path)
+			}
+
+			fmt.Printf("Recorded %d snapshot(s)\n", len(requests)-failed)
+			if failed > 0 {
+				return fmt.Errorf("%d of %d request(s) not recorded", failed, len(requests))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "snapshot-tester.yml", "Path to config file")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Set a collection variable as name=value (repeatable)")
+	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Tags to apply to the recorded snapshots")
+	cmd.Flags().StringVar(&scenario, "scenario", "", "Add the snapshots, in collection order, to this scenario")
+
+	return cmd
+}
+
+func recordCollectionRequest(rec *recorder.Recorder, cr importer.CollectionRequest) (*snapshot.Snapshot, string, error) {
+	req, err := cr.HTTPRequest()
+	if err != nil {
+		return nil, "", err
+	}
+	return rec.RecordOne(req)
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/recorder"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// newInteractiveReview returns a review that prints a summary of each
+// captured snapshot to out and asks on in whether to keep, discard or tag
+// it. An empty answer keeps the snapshot; once in is exhausted, every
+// snapshot is kept without asking.
+func newInteractiveReview(in io.Reader, out io.Writer) recorder.ReviewFunc {
+	reader := bufio.NewReader(in)
+	closed := false
+	ask := func(prompt string) (string, bool) {
+		if closed {
+			return "", false
+		}
+		fmt.Fprint(out, prompt)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			closed = true
+			fmt.Fprintln(out)
+			return "", false
+		}
+		return strings.TrimSpace(line), true
+	}
+
+	return func(snap *snapshot.Snapshot) bool {
+		fmt.Fprint(out, reviewSummary(snap))
+		for {
+			answer, ok := ask("[k]eep, [d]iscard, [t]ag? ")
+			if !ok {
+				return true
+			}
+			switch strings.ToLower(answer) {
+			case "", "k", "keep":
+				return true
+			case "d", "discard":
+				return false
+			case "t", "tag":
+				tags, _ := ask("Tags (comma-separated): ")
+				for _, tag := range strings.Split(tags, ",") {
+					if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(snap.Tags, tag) {
+						snap.Tags = append(snap.Tags, tag)
+					}
+				}
+				return true
+			default:
+				fmt.Fprintf(out, "Unknown answer %q\n", answer)
+			}
+		}
+	}
+}
+
+// reviewSummary describes a captured snapshot in a few lines: the request
+// and status, the rows it changed per table and its outgoing calls.
+func reviewSummary(snap *snapshot.Snapshot) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n%s %s -> %d\n", snap.Request.Method, snap.Request.URL, snap.Response.Status)
+	if len(snap.Tags) > 0 {
+		fmt.Fprintf(&sb, "  tags: %s\n", strings.Join(snap.Tags, ", "))
+	}
+
+	tables := make([]string, 0, len(snap.DBDiff))
+	for table, diff := range snap.DBDiff {
+		if len(diff.Added)+len(diff.Removed)+len(diff.Modified) > 0 {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+	if len(tables) == 0 {
+		sb.WriteString("  db: no changes\n")
+	}
+	for _, table := range tables {
+		diff := snap.DBDiff[table]
+		fmt.Fprintf(&sb, "  db %s: +%d ~%d -%d\n", table, len(diff.Added), len(diff.Modified), len(diff.Removed))
+	}
+
+	for _, call := range snap.OutgoingRequests {
+		status := "no response"
+		if call.Response != nil {
+			status = fmt.Sprintf("%d", call.Response.Status)
+		}
+		fmt.Fprintf(&sb, "  outgoing: %s %s -> %s\n", call.Method, call.URL, status)
+	}
+	return sb.String()
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestInteractiveReview(t *testing.T) {
+	var out strings.Builder
+	review := newInteractiveReview(strings.NewReader("x\nd\nt\nslow, smoke\n\n"), &out)
+
+	snap := &snapshot.Snapshot{
+		Request:  snapshot.Request{Method: "POST", URL: "/orders"},
+		Response: snapshot.Response{Status: 201},
+		DBDiff: map[string]snapshot.TableDiff{
+			"orders": {Added: []map[string]any{{"id": 1}}},
+			"users":  {},
+		},
+		OutgoingRequests: []snapshot.OutgoingRequest{
+			{Method: "POST", URL: "http://payments/charge", Response: &snapshot.Response{Status: 200}},
+		},
+	}
+	if review(snap) {
+		t.Error("expected the snapshot to be discarded after an unknown answer")
+	}
+	for _, want := range []string{"POST /orders -> 201", "db orders: +1 ~0 -0", "outgoing: POST http://payments/charge -> 200", `Unknown answer "x"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected the summary to contain %q\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "db users") {
+		t.Error("expected unchanged tables to be left out")
+	}
+
+	tagged := &snapshot.Snapshot{Tags: []string{"smoke"}}
+	if !review(tagged) || !reflect.DeepEqual(tagged.Tags, []string{"smoke", "slow"}) {
+		t.Errorf("expected the snapshot to be kept with the new tag, got %v", tagged.Tags)
+	}
+	if !review(&snapshot.Snapshot{}) {
+		t.Error("expected an empty answer to keep the snapshot")
+	}
+	if !review(&snapshot.Snapshot{}) {
+		t.Error("expected snapshots to be kept once input ends")
+	}
+}
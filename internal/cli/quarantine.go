@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/security"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+func newQuarantineCmd() *cobra.Command {
+	var configPath string
+
+	cmd := &cobra.Command{
+		Use:   "quarantine",
+		Short: "Manage known-flaky snapshots whose failures don't fail replay",
+	}
+	cmd.PersistentFlags().StringVarP(&configPath, "config", "c", "snapshot-tester.yml", "Path to config file")
+
+	cmd.AddCommand(
+		newQuarantineAddCmd(&configPath),
+		newQuarantineRemoveCmd(&configPath),
+		newQuarantineListCmd(&configPath),
+	)
+	return cmd
+}
+
+// loadQuarantine loads the config at configPath and the quarantine list of
+// its snapshot directory.
+func loadQuarantine(configPath string) (*config.Config, *snapshot.Quarantine, error) {
+	if err := security.ValidateConfigPath(configPath); err != nil {
+		return nil, nil, fmt.Errorf("invalid config path: %w", err)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading config: %w", err)
+	}
+	q, err := snapshot.LoadQuarantine(cfg.Recording.SnapshotDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, q, nil
+}
+
+func newQuarantineAddCmd(configPath *string) *cobra.Command {
+	var (
+		snapshotPath string
+		reason       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add",
+		Short: "Quarantine a snapshot",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, q, err := loadQuarantine(*configPath)
+			if err != nil {
+				return err
+			}
+			if err := security.ValidateSnapshotPath(snapshotPath, cfg.Recording.SnapshotDir); err != nil {
+				return fmt.Errorf("invalid snapshot path: %w", err)
+			}
+			store := snapshot.NewStore(cfg.Recording.SnapshotDir, cfg.Recording.Format)
+			snap, err := store.Load(snapshotPath)
+			if err != nil {
+				return fmt.Errorf("loading snapshot: %w", err)
+			}
+
+			if !q.Add(snap, snapshotPath, reason) {
+				fmt.Printf("Already quarantined: %s\n", snapshotPath)
+				return nil
+			}
+			if err := q.Save(); err != nil {
+				return err
+			}
+			audit := snapshot.NewAuditLog(cfg.Recording.SnapshotDir, cmd.CommandPath())
+			if err := audit.Record(snapshot.AuditActionQuarantine, snapshotPath, snap.ID); err != nil {
+				return fmt.Errorf("recording audit entry: %w", err)
+			}
+			fmt.Printf("Quarantined snapshot: %s\n", snapshotPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "", "Path to snapshot file")
+	cmd.Flags().StringVar(&reason, "reason", "", "Why the snapshot is flaky, e.g. a ticket reference")
+	cmd.MarkFlagRequired("snapshot")
+	cmd.RegisterFlagCompletionFunc("snapshot", completeSnapshotPaths)
+
+	return cmd
+}
+
+func newQuarantineRemoveCmd(configPath *string) *cobra.Command {
+	var (
+		snapshotPath string
+		id           string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "remove",
+		Short: "Release a snapshot from quarantine",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, q, err := loadQuarantine(*configPath)
+			if err != nil {
+				return err
+			}
+			if snapshotPath != "" {
+				if err := security.ValidateSnapshotPath(snapshotPath, cfg.Recording.SnapshotDir); err != nil {
+					return fmt.Errorf("invalid snapshot path: %w", err)
+				}
+				store := snapshot.NewStore(cfg.Recording.SnapshotDir, cfg.Recording.Format)
+				snap, err := store.Load(snapshotPath)
+				if err != nil {
+					return fmt.Errorf("loading snapshot: %w", err)
+				}
+				id = snap.ID
+			}
+
+			// Audited under the path it was quarantined at, which --id
+			// releases without
+			path := snapshotPath
+			for _, e := range q.Entries() {
+				if e.SnapshotID == id {
+					path = e.Path
+				}
+			}
+			if !q.Remove(id) {
+				return fmt.Errorf("snapshot %s is not quarantined", id)
+			}
+			if err := q.Save(); err != nil {
+				return err
+			}
+			audit := snapshot.NewAuditLog(cfg.Recording.SnapshotDir, cmd.CommandPath())
+			if err := audit.Record(snapshot.AuditActionRelease, path, id); err != nil {
+				return fmt.Errorf("recording audit entry: %w", err)
+			}
+			fmt.Printf("Released snapshot %s from quarantine\n", id)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "", "Path to snapshot file")
+	cmd.Flags().StringVar(&id, "id", "", "ID of the snapshot, e.g. when its file was deleted")
+	cmd.MarkFlagsOneRequired("snapshot", "id")
+	cmd.MarkFlagsMutuallyExclusive("snapshot", "id")
+	cmd.RegisterFlagCompletionFunc("snapshot", completeSnapshotPaths)
+
+	return cmd
+}
+
+func newQuarantineListCmd(configPath *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List quarantined snapshots",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, q, err := loadQuarantine(*configPath)
+			if err != nil {
+				return err
+			}
+			entries := q.Entries()
+			if len(entries) == 0 {
+				fmt.Println("No snapshots are quarantined.")
+				return nil
+			}
+
+			fmt.Printf("%-28s %-20s %-12s %-50s %s\n", "ID", "ADDED", "BY", "PATH", "REASON")
+			fmt.Println(strings.Repeat("-", 130))
+			for _, e := range entries {
+				fmt.Printf("%-28s %-20s %-12s %-50s %s\n",
+					e.SnapshotID, e.AddedAt.Format("2006-01-02 15:04:05"), e.AddedBy, e.Path, e.Reason)
+			}
+			fmt.Printf("\nTotal: %d quarantined snapshot(s)\n", len(entries))
+			return nil
+		},
+	}
+	return cmd
+}
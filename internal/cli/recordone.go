@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/recorder"
+	"github.com/esse/snapshot-tester/internal/security"
+	"github.com/spf13/cobra"
+)
+
+func newRecordOneCmd() *cobra.Command {
+	var (
+		configPath string
+		method     string
+		target     string
+		data       string
+		headers    []string
+		tags       []string
+		scenario   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "record-one",
+		Short: "Send a single request to the service and record its snapshot, without the proxy",
+		Example: `  snapshot-tester record-one --url /api/users
+  snapshot-tester record-one --method POST --url /api/users -H 'Content-Type: application/json' --data @body.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := security.ValidateConfigPath(configPath); err != nil {
+				return fmt.Errorf("invalid config path: %w", err)
+			}
+
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			req, err := newRecordOneRequest(method, target, data, headers)
+			if err != nil {
+				return err
+			}
+
+			rec, err := recorder.New(cfg, tags)
+			if err != nil {
+				return fmt.Errorf("creating recorder: %w", err)
+			}
+			defer rec.Close()
+			if err := rec.SetScenario(scenario); err != nil {
+				return err
+			}
+
+			snap, path, err := rec.RecordOne(req)
+			if err != nil {
+				return fmt.Errorf("recording %s %s: %w", req.Method, req.URL.RequestURI(), err)
+			}
+
+			fmt.Printf("%s %s -> %d\n", snap.Request.Method, snap.Request.URL, snap.Response.Status)
+			fmt.Printf("Recorded snapshot: %s\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "snapshot-tester.yml", "Path to config file")
+	cmd.Flags().StringVarP(&method, "method", "X", "", "HTTP method (default GET, or POST with --data)")
+	cmd.Flags().StringVar(&target, "url", "", "Request path and query, resolved against service.base_url")
+	cmd.Flags().StringVarP(&data, "data", "d", "", "Request body; @file reads it from a file, @- from stdin")
+	cmd.Flags().StringArrayVarP(&headers, "header", "H", nil, "Request header as 'Name: value' (repeatable)")
+	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Tags to apply to the snapshot")
+	cmd.Flags().StringVar(&scenario, "scenario", "", "Add the snapshot to this scenario as its next step")
+	cmd.MarkFlagRequired("url")
+
+	return cmd
+}
+
+// newRecordOneRequest builds the request record-one sends, the way curl
+// reads the same options. A full URL is accepted, but only its path and
+// query are kept: the request always goes to service.base_url.
+func newRecordOneRequest(method, target, data string, headers []string) (*http.Request, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --url: %w", err)
+	}
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+
+	var body []byte
+	switch {
+	case data == "@-":
+		if body, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, fmt.Errorf("reading body from stdin: %w", err)
+		}
+	case strings.HasPrefix(data, "@"):
+		if body, err = os.ReadFile(data[1:]); err != nil {
+			return nil, fmt.Errorf("reading body: %w", err)
+		}
+	default:
+		body = []byte(data)
+	}
+
+	if method == "" {
+		method = http.MethodGet
+		if data != "" {
+			method = http.MethodPost
+		}
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(method), u.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --header %q: expected 'Name: value'", h)
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return req, nil
+}
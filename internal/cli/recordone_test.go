@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewRecordOneRequest(t *testing.T) {
+	bodyFile := filepath.Join(t.TempDir(), "body.json")
+	if err := os.WriteFile(bodyFile, []byte(`{"name":"Ann"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		data       string
+		wantMethod string
+		wantURI    string
+		wantBody   string
+	}{
+		{name: "get", target: "/api/users?page=2", wantMethod: "GET", wantURI: "/api/users?page=2"},
+		{name: "data implies post", target: "/api/users", data: "a=1", wantMethod: "POST", wantURI: "/api/users", wantBody: "a=1"},
+		{name: "body from file", method: "put", target: "/api/users/1", data: "@" + bodyFile, wantMethod: "PUT", wantURI: "/api/users/1", wantBody: `{"name":"Ann"}`},
+		{name: "full URL keeps path and query", target: "http://localhost:3000/api/users?q=x", wantMethod: "GET", wantURI: "/api/users?q=x"},
+		{name: "relative path", target: "health", wantMethod: "GET", wantURI: "/health"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := newRecordOneRequest(tt.method, tt.target, tt.data, []string{"Content-Type: application/json", "X-Trace:  abc "})
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(req.Body)
+			if req.Method != tt.wantMethod || req.URL.RequestURI() != tt.wantURI || string(body) != tt.wantBody {
+				t.Errorf("got %s %s %q, want %s %s %q", req.Method, req.URL.RequestURI(), body, tt.wantMethod, tt.wantURI, tt.wantBody)
+			}
+			if req.Header.Get("Content-Type") != "application/json" || req.Header.Get("X-Trace") != "abc" {
+				t.Errorf("unexpected headers %v", req.Header)
+			}
+		})
+	}
+}
+
+func TestNewRecordOneRequest_Errors(t *testing.T) {
+	if _, err := newRecordOneRequest("", "/", "", []string{"no colon"}); err == nil {
+		t.Error("expected a header without a colon to be rejected")
+	}
+	if _, err := newRecordOneRequest("", "/", "@"+filepath.Join(t.TempDir(), "missing"), nil); err == nil {
+		t.Error("expected a missing body file to be reported")
+	}
+}
@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/security"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+// Sections accepted by `show --section`.
+const (
+	sectionRequest  = "request"
+	sectionResponse = "response"
+	sectionDBDiff   = "db-diff"
+	sectionOutgoing = "outgoing"
+)
+
+var showSections = []string{sectionRequest, sectionResponse, sectionDBDiff, sectionOutgoing}
+
+// ANSI escape codes used for syntax highlighting.
+const (
+	ansiReset   = "\033[0m"
+	ansiBold    = "\033[1m"
+	ansiKey     = "\033[36m"
+	ansiString  = "\033[32m"
+	ansiNumber  = "\033[33m"
+	ansiLiteral = "\033[35m"
+	ansiDim     = "\033[2m"
+)
+
+// prettyPrinter renders JSON-like values with optional colors, shortening
+// long strings and arrays and capping the total number of lines.
+type prettyPrinter struct {
+	color     bool
+	maxString int // longest string value printed in full (0 = unlimited)
+	maxItems  int // array elements printed before eliding (0 = unlimited)
+}
+
+func newShowCmd() *cobra.Command {
+	var (
+		configPath string
+		section    string
+		maxLines   int
+		noColor    bool
+		printer    prettyPrinter
+	)
+
+	cmd := &cobra.Command{
+		Use:   "show <snapshot-path>",
+		Short: "Pretty-print a snapshot or one of its sections",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snapshotPath := args[0]
+
+			if section != "" && !slices.Contains(showSections, section) {
+				return fmt.Errorf("invalid section %q (must be one of %s)", section, strings.Join(showSections, ", "))
+			}
+
+			if err := security.ValidateConfigPath(configPath); err != nil {
+				return fmt.Errorf("invalid config path: %w", err)
+			}
+
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			if err := security.ValidateSnapshotPath(snapshotPath, cfg.Recording.SnapshotDir); err != nil {
+				return fmt.Errorf("invalid snapshot path: %w", err)
+			}
+
+			store := snapshot.NewStore(cfg.Recording.SnapshotDir, cfg.Recording.Format)
+			snap, err := store.Load(snapshotPath)
+			if err != nil {
+				return fmt.Errorf("loading snapshot: %w", err)
+			}
+
+			printer.color = !noColor && colorEnabled(os.Stdout)
+			fmt.Print(limitLines(printer.renderSnapshot(snap, section), maxLines))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "snapshot-tester.yml", "Path to config file")
+	cmd.Flags().StringVar(&section, "section", "", "Only show one section: "+strings.Join(showSections, ", "))
+	cmd.Flags().IntVar(&maxLines, "max-lines", 200, "Maximum lines of output (0 for unlimited)")
+	cmd.Flags().IntVar(&printer.maxString, "max-string", 200, "Truncate string values longer than this (0 for unlimited)")
+	cmd.Flags().IntVar(&printer.maxItems, "max-items", 20, "Show at most this many array elements (0 for unlimited)")
+	cmd.Flags().BoolVar(&noColor, "no-color", false, "Disable syntax highlighting")
+
+	return cmd
+}
+
+// renderSnapshot renders the requested section, or a header plus every
+// non-empty section when section is empty.
+func (p prettyPrinter) renderSnapshot(snap *snapshot.Snapshot, section string) string {
+	var sb strings.Builder
+
+	if section == "" {
+		sb.WriteString(p.heading("Snapshot"))
+		sb.WriteString(fmt.Sprintf("ID:        %s\n", snap.ID))
+		sb.WriteString(fmt.Sprintf("Service:   %s\n", snap.Service))
+		sb.WriteString(fmt.Sprintf("Timestamp: %s\n", snap.Timestamp.Format("2006-01-02 15:04:05 MST")))
+		if len(snap.Tags) > 0 {
+			sb.WriteString(fmt.Sprintf("Tags:      %s\n", strings.Join(snap.Tags, ", ")))
+		}
+	}
+
+	for _, name := range showSections {
+		if section != "" && section != name {
+			continue
+		}
+		var value any
+		switch name {
+		case sectionRequest:
+			value = snap.Request
+		case sectionResponse:
+			value = snap.Response
+		case sectionDBDiff:
+			value = snap.DBDiff
+		case sectionOutgoing:
+			// Most snapshots have no outgoing calls; only show them when asked or present
+			if len(snap.OutgoingRequests) == 0 && section == "" {
+				continue
+			}
+			value = snap.OutgoingRequests
+		}
+		if section == "" {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(p.heading(name))
+		sb.WriteString(p.render(value))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func (p prettyPrinter) heading(title string) string {
+	if p.color {
+		return ansiBold + "== " + title + " ==" + ansiReset + "\n"
+	}
+	return "== " + title + " ==\n"
+}
+
+// render pretty-prints v as indented JSON. Values are round-tripped through
+// JSON first so structs and maps print with the same keys as the snapshot file.
+func (p prettyPrinter) render(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return string(data)
+	}
+	var sb strings.Builder
+	p.writeValue(&sb, generic, "")
+	return sb.String()
+}
+
+func (p prettyPrinter) writeValue(sb *strings.Builder, v any, indent string) {
+	switch val := v.(type) {
+	case map[string]any:
+		if len(val) == 0 {
+			sb.WriteString("{}")
+			return
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		sb.WriteString("{\n")
+		for i, k := range keys {
+			sb.WriteString(indent + "  ")
+			sb.WriteString(p.paint(ansiKey, strconv.Quote(k)))
+			sb.WriteString(": ")
+			p.writeValue(sb, val[k], indent+"  ")
+			if i < len(keys)-1 {
+				sb.WriteString(",")
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString(indent + "}")
+	case []any:
+		if len(val) == 0 {
+			sb.WriteString("[]")
+			return
+		}
+		shown := len(val)
+		if p.maxItems > 0 && shown > p.maxItems {
+			shown = p.maxItems
+		}
+		sb.WriteString("[\n")
+		for i := 0; i < shown; i++ {
+			sb.WriteString(indent + "  ")
+			p.writeValue(sb, val[i], indent+"  ")
+			if i < len(val)-1 {
+				sb.WriteString(",")
+			}
+			sb.WriteString("\n")
+		}
+		if shown < len(val) {
+			sb.WriteString(indent + "  " + p.paint(ansiDim, fmt.Sprintf("... %d more item(s)", len(val)-shown)) + "\n")
+		}
+		sb.WriteString(indent + "]")
+	case string:
+		sb.WriteString(p.paint(ansiString, strconv.Quote(p.truncateString(val))))
+	case float64:
+		sb.WriteString(p.paint(ansiNumber, strconv.FormatFloat(val, 'f', -1, 64)))
+	case bool:
+		sb.WriteString(p.paint(ansiLiteral, strconv.FormatBool(val)))
+	case nil:
+		sb.WriteString(p.paint(ansiLiteral, "null"))
+	default:
+		sb.WriteString(fmt.Sprintf("%v", val))
+	}
+}
+
+// truncateString shortens s to maxString runes, noting how much was cut.
+func (p prettyPrinter) truncateString(s string) string {
+	if p.maxString <= 0 || utf8.RuneCountInString(s) <= p.maxString {
+		return s
+	}
+	runes := []rune(s)
+	return fmt.Sprintf("%s... (+%d chars)", string(runes[:p.maxString]), len(runes)-p.maxString)
+}
+
+func (p prettyPrinter) paint(code, s string) string {
+	if !p.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// limitLines keeps the first max lines of s, appending a note with the number
+// of lines dropped. max <= 0 means unlimited.
+func limitLines(s string, max int) string {
+	if max <= 0 {
+		return s
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= max {
+		return s
+	}
+	return strings.Join(lines[:max], "") + fmt.Sprintf("... %d more line(s), use --max-lines 0 or --section to see more\n", len(lines)-max)
+}
+
+// colorEnabled reports whether f is a terminal and NO_COLOR is unset.
+func colorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
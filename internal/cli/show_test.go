@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func sampleShowSnapshot() *snapshot.Snapshot {
+	return &snapshot.Snapshot{
+		ID:      "01ARYZ6S41TSV4RRFFQ69G5FAV",
+		Service: "users",
+		Request: snapshot.Request{Method: "POST", URL: "/users", Body: map[string]any{"name": strings.Repeat("a", 50)}},
+		Response: snapshot.Response{
+			Status: 201,
+			Body:   map[string]any{"items": []any{1, 2, 3, 4, 5}},
+		},
+	}
+}
+
+func TestRenderSnapshot_Section(t *testing.T) {
+	p := prettyPrinter{}
+	out := p.renderSnapshot(sampleShowSnapshot(), sectionResponse)
+
+	if !strings.HasPrefix(out, "== response ==") {
+		t.Errorf("expected response heading, got %q", out)
+	}
+	if strings.Contains(out, "== request ==") || strings.Contains(out, "ID:") {
+		t.Errorf("expected only the response section\n%s", out)
+	}
+	if !strings.Contains(out, `"status": 201`) {
+		t.Errorf("expected status in output\n%s", out)
+	}
+}
+
+func TestRenderSnapshot_AllSkipsEmptyOutgoing(t *testing.T) {
+	out := prettyPrinter{}.renderSnapshot(sampleShowSnapshot(), "")
+	for _, want := range []string{"ID:        01ARYZ6S41TSV4RRFFQ69G5FAV", "== request ==", "== response ==", "== db-diff =="} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "== outgoing ==") {
+		t.Error("expected outgoing section to be omitted when empty")
+	}
+}
+
+func TestPrettyPrinter_Truncation(t *testing.T) {
+	p := prettyPrinter{maxString: 10, maxItems: 2}
+	out := p.renderSnapshot(sampleShowSnapshot(), "")
+
+	if !strings.Contains(out, `"aaaaaaaaaa... (+40 chars)"`) {
+		t.Errorf("expected truncated string\n%s", out)
+	}
+	if !strings.Contains(out, "... 3 more item(s)") {
+		t.Errorf("expected elided array items\n%s", out)
+	}
+}
+
+func TestPrettyPrinter_Color(t *testing.T) {
+	out := prettyPrinter{color: true}.render(map[string]any{"ok": true})
+	if !strings.Contains(out, ansiKey+`"ok"`+ansiReset) || !strings.Contains(out, ansiLiteral+"true"+ansiReset) {
+		t.Errorf("expected highlighted output, got %q", out)
+	}
+}
+
+func TestLimitLines(t *testing.T) {
+	in := "a\nb\nc\nd\n"
+	if got := limitLines(in, 0); got != in {
+		t.Errorf("expected unlimited output, got %q", got)
+	}
+	got := limitLines(in, 2)
+	if !strings.HasPrefix(got, "a\nb\n... 2 more line(s)") {
+		t.Errorf("unexpected limited output %q", got)
+	}
+}
@@ -2,8 +2,16 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
 
+	"github.com/esse/snapshot-tester/internal/listen"
 	"gopkg.in/yaml.v3"
 )
 
@@ -12,6 +20,9 @@ const (
 	dbTypePostgres = "postgres"
 	dbTypeMySQL    = "mysql"
 	dbTypeSQLite   = "sqlite"
+	dbTypeMSSQL    = "mssql"
+	dbTypeRedis    = "redis"
+	dbTypeDynamoDB = "dynamodb"
 )
 
 // Snapshot format identifiers (must match snapshot.Format* constants).
@@ -20,6 +31,82 @@ const (
 	formatYAML = "yaml"
 )
 
+// Restore modes (must match db.RestoreMode* constants).
+const (
+	restoreModeInsert = "insert"
+	restoreModeBulk   = "bulk"
+)
+
+// Test database provisioning (must match db.ProvisionDocker).
+const provisionDocker = "docker"
+
+// Replay isolation strategy (must match replayer.IsolationDatabase).
+const isolationDatabase = "database"
+
+// Replay variable names, usable as {{name}} in snapshots (must match
+// snapshot.ValidateVariableName).
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// Service readiness checks (must match service.ReadyCheck* constants).
+const (
+	readyCheckSleep = "sleep"
+	readyCheckTCP   = "tcp"
+	readyCheckHTTP  = "http"
+)
+
+// Dynamic matchers (must match asserter.Matcher* constants).
+const (
+	matcherAny     = "__ANY__"
+	matcherUUID    = "__UUID__"
+	matcherISODate = "__ISO_DATE__"
+)
+
+// Service restart policies (must match replayer.Restart* constants).
+const (
+	restartSnapshot = "snapshot"
+	restartRun      = "run"
+)
+
+// Assertion scopes (must match replayer.Assert* constants).
+const (
+	assertAll      = "all"
+	assertResponse = "response"
+	assertDB       = "db"
+	assertDiff     = "diff"
+)
+
+// Clock value formats (must match replayer.ClockFormat* constants).
+const (
+	clockFormatRFC3339 = "rfc3339"
+	clockFormatUnix    = "unix"
+	clockFormatUnixMs  = "unix_ms"
+)
+
+// Redaction modes (must match redact.Mode* constants).
+const (
+	redactModeMask = "mask"
+	redactModeHMAC = "hmac"
+)
+
+// Oversized body handling (must match recorder.Oversized* constants).
+const (
+	oversizedTruncate = "truncate"
+	oversizedSkip     = "skip"
+)
+
+// Outgoing host actions (must match hostrule.* constants).
+const (
+	outgoingCapture     = "capture"
+	outgoingPassthrough = "passthrough"
+	outgoingBlock       = "block"
+)
+
+// Auth roles (must match auth.Role* constants).
+const (
+	authRoleRead  = "read"
+	authRoleAdmin = "admin"
+)
+
 // Default configuration values.
 const (
 	defaultSnapshotDir  = "./snapshots"
@@ -28,41 +115,228 @@ const (
 	defaultTimeoutMs    = 5000
 	defaultMockEnvVar   = "SNAPSHOT_MOCK_URL"
 	defaultStartupTimeMs = 2000
+	defaultReadyTimeoutMs = 30000
+	defaultRetryDelayMs = 100
+	defaultCacheFile    = ".replay-cache.json"
+	defaultLastRunFile  = ".last-run.json"
+	defaultCADir        = "./.snapshot-ca"
 )
 
+// defaultFaketimeLibs are the Debian/Ubuntu locations of libfaketime by
+// GOOS/GOARCH. Elsewhere replay.clock.faketime_lib has to be set.
+var defaultFaketimeLibs = map[string]string{
+	"linux/amd64": "/usr/lib/x86_64-linux-gnu/faketime/libfaketime.so.1",
+	"linux/arm64": "/usr/lib/aarch64-linux-gnu/faketime/libfaketime.so.1",
+}
+
 // Config represents the top-level configuration for snapshot-tester.
 type Config struct {
-	Service   ServiceConfig   `yaml:"service"`
-	Database  DatabaseConfig  `yaml:"database"`
-	Recording RecordingConfig `yaml:"recording"`
-	Replay    ReplayConfig    `yaml:"replay"`
+	Service   ServiceConfig    `yaml:"service"`
+	Database  DatabaseConfig   `yaml:"database"`
+	Databases []DatabaseConfig `yaml:"databases"` // Several named databases, instead of database
+	Recording RecordingConfig  `yaml:"recording"`
+	Replay    ReplayConfig     `yaml:"replay"`
+	Auth      AuthConfig       `yaml:"auth"`
+	Hooks     HooksConfig      `yaml:"hooks"`
+	Protobuf  ProtobufConfig   `yaml:"protobuf"`
 }
 
 type ServiceConfig struct {
 	Name          string `yaml:"name"`
 	BaseURL       string `yaml:"base_url"`
 	Command       string `yaml:"command"`         // Optional: command to start service as subprocess
-	StartupTimeMs int    `yaml:"startup_time_ms"` // Time to wait after starting service (default: 2000)
+	StartupTimeMs int    `yaml:"startup_time_ms"` // Time to wait after starting service, without ready_check (default: 2000)
+	ReadyCheck    string `yaml:"ready_check"`     // sleep | tcp | http (default: sleep)
+	ReadyPath     string `yaml:"ready_path"`      // path polled by the http check (default: /)
+	Restart       string `yaml:"restart"`         // snapshot | run: start command for every replayed snapshot or once per run (default: snapshot)
 	MockEnvVar    string `yaml:"mock_env_var"`    // Env var name to inject mock server URL (default: SNAPSHOT_MOCK_URL)
+
+	ReadyTimeoutMs int `yaml:"ready_timeout_ms"` // With ready_check, the longest wait for the service (default: 30000)
+
+	ClientCert string `yaml:"client_cert"` // PEM client certificate presented to an https service (mTLS)
+	ClientKey  string `yaml:"client_key"`  // PEM private key of client_cert
+	CACert     string `yaml:"ca_cert"`     // PEM CA trusted for the service's certificate, in addition to the system roots
 }
 
 type DatabaseConfig struct {
-	Type             string   `yaml:"type"` // postgres | mysql | sqlite
+	Name             string   `yaml:"name"` // Required in databases; prefixes table names in snapshots
+	Type             string   `yaml:"type"` // postgres | mysql | sqlite | mssql | redis | dynamodb
 	ConnectionString string   `yaml:"connection_string"`
 	Tables           []string `yaml:"tables"`
-	Namespaces       []string `yaml:"namespaces"` // Schemas (postgres) or databases (mysql) to scan; defaults to public/current
+	Namespaces       []string `yaml:"namespaces"` // Schemas (postgres, mssql) or databases (mysql) to scan; defaults to public/dbo/current
+
+	ExcludeColumns map[string][]string `yaml:"exclude_columns"` // table -> columns left out of capture, restore and diffs
+	Filters        map[string]string   `yaml:"filters"`         // table -> SQL condition selecting the rows to capture and restore
+	RestoreMode    string              `yaml:"restore_mode"`    // insert | bulk (default: insert)
+
+	IncludeViews             bool `yaml:"include_views"`              // snapshot views and materialized views; compared but never restored
+	RefreshMaterializedViews bool `yaml:"refresh_materialized_views"` // refresh materialized views before the after-request snapshot (postgres)
+}
+
+// tableEntry is one item of a tables list: a table name, or an object with a
+// name and a row filter.
+type tableEntry struct {
+	Name   string `yaml:"name"`
+	Filter string `yaml:"filter"`
+}
+
+func (t *tableEntry) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&t.Name)
+	}
+	type plain tableEntry
+	return value.Decode((*plain)(t))
+}
+
+// UnmarshalYAML accepts table entries of the form {name, filter} alongside
+// plain names, moving their filters into Filters.
+func (d *DatabaseConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain DatabaseConfig
+	var tablesNode *yaml.Node
+	if value.Kind == yaml.MappingNode {
+		rest := *value
+		rest.Content = nil
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			if value.Content[i].Value == "tables" {
+				tablesNode = value.Content[i+1]
+				continue
+			}
+			rest.Content = append(rest.Content, value.Content[i], value.Content[i+1])
+		}
+		value = &rest
+	}
+	if err := value.Decode((*plain)(d)); err != nil {
+		return err
+	}
+	if tablesNode == nil {
+		return nil
+	}
+
+	var entries []tableEntry
+	if err := tablesNode.Decode(&entries); err != nil {
+		return err
+	}
+	d.Tables = nil
+	for _, e := range entries {
+		if e.Name == "" {
+			return fmt.Errorf("line %d: table entry without a name", tablesNode.Line)
+		}
+		d.Tables = append(d.Tables, e.Name)
+		if e.Filter == "" {
+			continue
+		}
+		if d.Filters == nil {
+			d.Filters = make(map[string]string)
+		}
+		d.Filters[e.Name] = e.Filter
+	}
+	return nil
 }
 
 type RecordingConfig struct {
 	ProxyPort         int             `yaml:"proxy_port"`
 	OutgoingProxyPort int             `yaml:"outgoing_proxy_port"` // Port for forward proxy capturing outgoing requests (0 = auto)
+
+	// Listen addresses that replace the ports above: unix:///path, systemd or systemd:<name>
+	ProxyListen         string `yaml:"proxy_listen"`
+	OutgoingProxyListen string `yaml:"outgoing_proxy_listen"`
+
+	// Intercept HTTPS calls tunneled through the outgoing proxy with certificates from a local CA
+	OutgoingMITM  bool   `yaml:"outgoing_mitm"`
+	OutgoingCADir string `yaml:"outgoing_ca_dir"` // where the CA is generated and kept (default: ./.snapshot-ca)
+
+	// What the outgoing proxy does with calls per host; the first matching
+	// rule applies and calls to other hosts are captured
+	OutgoingHosts []OutgoingHostRule `yaml:"outgoing_hosts"`
+
+	// Header set on every recorded request with a unique ID; a service that
+	// copies it onto its outgoing calls has them assigned to the right
+	// snapshot under concurrency. "traceparent" matches calls by trace ID.
+	CorrelationHeader string `yaml:"correlation_header"` // default: X-Snapshot-Request-Id
+
 	SnapshotDir       string          `yaml:"snapshot_dir"`
 	Format            string          `yaml:"format"` // json | yaml
 	IgnoreHeaders     []string        `yaml:"ignore_headers"`
 	IgnoreFields      []string        `yaml:"ignore_fields"`
 	RedactFields      []string        `yaml:"redact_fields"`       // Fields to redact with [REDACTED] during recording
+	RedactMode        string          `yaml:"redact_mode"`         // mask | hmac (default: mask)
+	RedactKey         string          `yaml:"redact_key"`          // Secret key for hmac redaction mode
 	ProxyAuthToken    string          `yaml:"proxy_auth_token"`    // If set, require Bearer token for proxy access
 	RateLimit         RateLimitConfig `yaml:"rate_limit"`
+	OnSnapshotWebhook string          `yaml:"on_snapshot_webhook"` // URL that receives a POST for every saved snapshot
+	CaptureSchema     bool            `yaml:"capture_schema"`      // Record table columns and indexes; replay fails early if they changed
+	Incremental       bool            `yaml:"incremental"`         // Track changed rows with triggers instead of re-reading every table per request
+	DedupDBStates     bool            `yaml:"dedup_db_states"`     // Store identical DB states once under <snapshot_dir>/_states
+	BodyFileThreshold int             `yaml:"body_file_threshold"` // Write bodies of at least this many bytes to files under <snapshot_dir>/_bodies (0 = never)
+	CaptureChunks     bool            `yaml:"capture_chunks"`      // Record chunk boundaries and timing of responses streamed without a Content-Length
+	StreamResponses   bool            `yaml:"stream_responses"`    // Forward every response to the client as it arrives, not only streamed ones
+
+	// Requests to record; the rest are proxied without capture. Path patterns
+	// are globs where * matches within a segment and ** any number of segments.
+	IncludePaths   []string `yaml:"include_paths"`   // default: all paths
+	ExcludePaths   []string `yaml:"exclude_paths"`   // e.g. /health, /metrics
+	IncludeMethods []string `yaml:"include_methods"` // default: all methods
+	ExcludeMethods []string `yaml:"exclude_methods"` // e.g. OPTIONS
+
+	// Response statuses to record, as codes (404) or classes (2xx); snapshots
+	// of other responses are not saved (default: all statuses)
+	RecordStatus []string `yaml:"record_status"`
+
+	// Fraction of the requests above to record, from 0 to 1 (default: 1).
+	// The first sample_rates rule matching a request overrides sample_rate.
+	SampleRate  *float64     `yaml:"sample_rate"`
+	SampleRates []SampleRule `yaml:"sample_rates"`
+
+	TagRules []TagRule `yaml:"tag_rules"` // tags added to matching snapshots, besides those from --tag
+
+	// Bodies larger than this many bytes are not kept (0 = unlimited)
+	MaxBodyBytes    int64  `yaml:"max_body_bytes"`
+	OversizedBodies string `yaml:"oversized_bodies"` // truncate (store size, hash and first bytes) | skip (no snapshot); default: truncate
+}
+
+// TagRule adds tags to the snapshots of requests matching all its
+// conditions; empty conditions match every request.
+type TagRule struct {
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"`    // glob, as in include_paths
+	Headers map[string]string `yaml:"headers"` // header name -> value, where * matches any text
+	Tags    []string          `yaml:"tags"`
+
+	headerPatterns map[string]*regexp.Regexp // Headers values containing *, compiled by Load
+}
+
+// MatchesHeader reports whether value matches the rule's pattern for the
+// header name, where * matches any text, including slashes.
+func (t *TagRule) MatchesHeader(name, value string) bool {
+	pattern := t.Headers[name]
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+	re, ok := t.headerPatterns[name]
+	if !ok {
+		// A rule built in code rather than loaded
+		re = compileHeaderPattern(pattern)
+	}
+	return re.MatchString(value)
+}
+
+func compileHeaderPattern(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`) + "$")
+}
+
+// SampleRule sets the recording sample rate of an endpoint.
+type SampleRule struct {
+	Method string   `yaml:"method"` // empty matches any method
+	Path   string   `yaml:"path"`   // glob, as in include_paths
+	Rate   *float64 `yaml:"rate"`
+}
+
+// OutgoingHostRule sets how the outgoing proxy handles calls to matching
+// hosts: capture them into the snapshot, forward them without capturing
+// (passthrough) or refuse them (block).
+type OutgoingHostRule struct {
+	Host   string `yaml:"host"`   // glob, e.g. *.datadoghq.com; matched against host:port if it has a port
+	Action string `yaml:"action"` // capture | passthrough | block
 }
 
 // RateLimitConfig configures rate limiting for the recording proxy.
@@ -79,10 +353,165 @@ type ReplayConfig struct {
 	OrderInsensitive []string           `yaml:"order_insensitive"`
 	IgnoreFields     []string           `yaml:"ignore_fields"`
 	IgnoreTables     []string           `yaml:"ignore_tables"`
+	AllowAdditive    []string           `yaml:"allow_additive"` // paths where new fields in actual are warnings
+	WarnOnly         []string           `yaml:"warn_only"`      // paths whose differences are warnings, not failures
+
+	NullEqualsMissing       bool `yaml:"null_equals_missing"`        // null and an absent key compare equal
+	EmptyArrayEqualsMissing bool `yaml:"empty_array_equals_missing"` // [] and an absent key compare equal
+
+	RowKeys map[string][]string `yaml:"row_keys"` // table -> unique key columns for row alignment and recorded db_diff
+
+	Matchers map[string]string `yaml:"matchers"` // path glob -> dynamic matcher (e.g. __UUID__) used in place of the recorded value
+
+	Assert string `yaml:"assert"` // all | response | db | diff: what replay compares (default: all)
+
+	Variables     map[string]any `yaml:"variables"`      // name -> value replacing {{name}} in snapshots at replay time
+	VariablesFile string         `yaml:"variables_file"` // YAML or JSON file of more variables, taking precedence over variables
+
+	FingerprintCommand string `yaml:"fingerprint_command"` // prints the service build fingerprint for replay --cached
+	CacheFile          string `yaml:"cache_file"`          // where replay --cached stores passing results
+	LastRunFile        string `yaml:"last_run_file"`       // where replay stores the snapshots that failed, for replay --failed
+
+	Isolation string `yaml:"isolation"` // "database": each parallel worker replays against its own database copy and service instance
+	Workers   int    `yaml:"workers"`   // number of snapshots replayed at once with parallel (default 4)
+
+	CookieJar bool `yaml:"cookie_jar"` // replay in recording order, passing cookies the service sets on to later requests
+
+	MockAddress string `yaml:"mock_address"` // fixed host:port for the mock server, so a service not started by snapshot-tester can be pointed at it
+
+	Latency LatencyConfig `yaml:"latency"` // flag responses that got much slower than when recorded
+	Retry   RetryConfig   `yaml:"retry"`   // try again when a request fails to reach the service
+
+	FailFast bool `yaml:"fail_fast"` // stop after the first snapshot that fails or errors; the rest are reported as skipped
+
+	ExitPolicy ExitPolicyConfig `yaml:"exit_policy"` // how many failures and errors strict_mode tolerates
+
+	Clock ClockConfig `yaml:"clock"` // pin the service's notion of "now" to the time each snapshot was recorded
+}
+
+// ClockConfig tells the service what time each snapshot was recorded at, so
+// timestamps it derives from the current time match the recorded ones. The
+// service reads the time from a request header, or, when started by
+// service.command for every snapshot, from an environment variable or
+// libfaketime.
+type ClockConfig struct {
+	Header      string `yaml:"header"`       // request header set to the recorded time, e.g. X-Fake-Now
+	EnvVar      string `yaml:"env_var"`      // environment variable of a managed service set to the recorded time
+	Format      string `yaml:"format"`       // rfc3339 | unix | unix_ms: how header and env_var give the time (default: rfc3339)
+	Faketime    bool   `yaml:"faketime"`     // start a managed service under libfaketime, its clock frozen at the recorded time
+	FaketimeLib string `yaml:"faketime_lib"` // path to libfaketime (default: the Debian/Ubuntu location on linux/amd64 and linux/arm64)
+}
+
+// ExitPolicyConfig sets how many snapshots may fail, or error, before
+// replay exits non-zero with strict_mode. Failures (differences) and errors
+// (snapshots that could not be replayed) are counted separately, and each
+// must stay within every limit set for it. With no limit set, none are
+// tolerated. Rates are fractions of the snapshots replayed.
+type ExitPolicyConfig struct {
+	MaxFailures    *int     `yaml:"max_failures"`     // snapshots with differences tolerated
+	MaxFailureRate *float64 `yaml:"max_failure_rate"` // e.g. 0.02 = 2% of snapshots may fail
+	MaxErrors      *int     `yaml:"max_errors"`       // snapshots that errored tolerated
+	MaxErrorRate   *float64 `yaml:"max_error_rate"`
+}
+
+// RetryConfig retries a snapshot whose request got no answer from the
+// service, e.g. a connection reset while the service warms up. Snapshots
+// that got an answer are never retried, whatever it was.
+type RetryConfig struct {
+	Attempts int `yaml:"attempts"` // tries per snapshot, including the first (default 1: no retries)
+	DelayMs  int `yaml:"delay_ms"` // wait before the first retry, doubled before each further one (default 100)
+}
+
+// LatencyConfig compares the time the service takes to answer a replayed
+// request with the time recorded in the snapshot.
+type LatencyConfig struct {
+	Tolerance  float64 `yaml:"tolerance"`    // allowed slowdown as a fraction of the recorded time, e.g. 0.5 = 50% slower (0 = don't compare)
+	MinDeltaMs int64   `yaml:"min_delta_ms"` // slowdowns of fewer milliseconds are ignored as noise
+	MaxDeltaMs int64   `yaml:"max_delta_ms"` // slowdowns of more milliseconds are flagged whatever the tolerance (0 = no limit)
+	Fail       bool    `yaml:"fail"`         // fail the snapshot instead of warning
+
+	Endpoints []LatencyRule `yaml:"endpoints"` // thresholds for specific endpoints; the first matching rule applies
+}
+
+// LatencyRule overrides the latency thresholds of an endpoint. Thresholds
+// left out are taken from replay.latency.
+type LatencyRule struct {
+	Method     string   `yaml:"method"` // empty matches any method
+	Path       string   `yaml:"path"`   // request path; * matches one path segment
+	Tolerance  *float64 `yaml:"tolerance"`
+	MinDeltaMs *int64   `yaml:"min_delta_ms"`
+	MaxDeltaMs *int64   `yaml:"max_delta_ms"`
+	Fail       *bool    `yaml:"fail"`
+}
+
+// HooksConfig lists shell commands run around recording and replay. Each
+// command gets the snapshot context in SNAPSHOT_* environment variables.
+type HooksConfig struct {
+	BeforeRecord    []string `yaml:"before_record"`
+	BeforeReplayRun []string `yaml:"before_replay_run"` // once before a replay run, e.g. to run migrations
+	BeforeReplay    []string `yaml:"before_replay"`
+	AfterReplay     []string `yaml:"after_replay"`
+	AfterReplayRun  []string `yaml:"after_replay_run"` // once after a replay run, with the overall result
+}
+
+// AuthConfig configures token-based access control for the admin APIs.
+type AuthConfig struct {
+	Tokens []AuthToken `yaml:"tokens"`
+}
+
+// AuthToken grants a role to a Bearer token.
+type AuthToken struct {
+	Token string `yaml:"token"`
+	Role  string `yaml:"role"` // read | admin
+}
+
+// ProtobufConfig supplies message descriptors so protobuf bodies are stored
+// as JSON and encoded again on replay.
+type ProtobufConfig struct {
+	DescriptorSet string            `yaml:"descriptor_set"` // FileDescriptorSet written by protoc --descriptor_set_out --include_imports
+	ProtoDir      string            `yaml:"proto_dir"`      // directory of .proto sources, compiled at startup instead
+	Messages      []ProtobufMessage `yaml:"messages"`       // message types per endpoint; gRPC methods are resolved from their path
+}
+
+// ProtobufMessage maps an endpoint to the message types of its bodies.
+type ProtobufMessage struct {
+	Method   string `yaml:"method"`   // HTTP method (default: any)
+	Path     string `yaml:"path"`     // request path; * matches one path segment
+	Request  string `yaml:"request"`  // fully-qualified message type of the request body
+	Response string `yaml:"response"` // fully-qualified message type of the response body
 }
 
 type TestDatabaseConfig struct {
-	ConnectionString string `yaml:"connection_string"`
+	ConnectionString string            `yaml:"connection_string"`
+	Databases        map[string]string `yaml:"databases"` // database name -> connection string, for databases
+
+	Provision string `yaml:"provision"` // "docker": replay against a throwaway database container started for each run
+	Image     string `yaml:"image"`     // container image for provision (default: postgres:16-alpine or mysql:8.4)
+	Schema    string `yaml:"schema"`    // SQL file loaded into the provisioned database before replay
+}
+
+// DatabaseList returns the configured databases: the databases list, or the
+// single unnamed database.
+func (c *Config) DatabaseList() []DatabaseConfig {
+	if len(c.Databases) > 0 {
+		return c.Databases
+	}
+	return []DatabaseConfig{c.Database}
+}
+
+// ReplayConnectionString returns the connection string to replay against for
+// d: its replay.test_database override if set, otherwise its own.
+func (c *Config) ReplayConnectionString(d DatabaseConfig) string {
+	if d.Name == "" {
+		if c.Replay.TestDatabase.ConnectionString != "" {
+			return c.Replay.TestDatabase.ConnectionString
+		}
+		return d.ConnectionString
+	}
+	if connStr := c.Replay.TestDatabase.Databases[d.Name]; connStr != "" {
+		return connStr
+	}
+	return d.ConnectionString
 }
 
 // Load reads and parses a YAML configuration file.
@@ -101,6 +530,12 @@ func Load(path string) (*Config, error) {
 	// Expand environment variables in configuration
 	cfg.expandEnvVars()
 
+	if cfg.Replay.VariablesFile != "" {
+		if err := cfg.LoadVariables(cfg.Replay.VariablesFile); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := cfg.validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
@@ -124,6 +559,24 @@ func Load(path string) (*Config, error) {
 	if cfg.Service.StartupTimeMs == 0 {
 		cfg.Service.StartupTimeMs = defaultStartupTimeMs
 	}
+	if cfg.Service.ReadyTimeoutMs == 0 {
+		cfg.Service.ReadyTimeoutMs = defaultReadyTimeoutMs
+	}
+	if cfg.Replay.Retry.DelayMs == 0 {
+		cfg.Replay.Retry.DelayMs = defaultRetryDelayMs
+	}
+	if cfg.Replay.CacheFile == "" {
+		cfg.Replay.CacheFile = filepath.Join(cfg.Recording.SnapshotDir, defaultCacheFile)
+	}
+	if cfg.Replay.Clock.Faketime && cfg.Replay.Clock.FaketimeLib == "" {
+		cfg.Replay.Clock.FaketimeLib = defaultFaketimeLibs[runtime.GOOS+"/"+runtime.GOARCH]
+	}
+	if cfg.Replay.LastRunFile == "" {
+		cfg.Replay.LastRunFile = filepath.Join(cfg.Recording.SnapshotDir, defaultLastRunFile)
+	}
+	if cfg.Recording.OutgoingMITM && cfg.Recording.OutgoingCADir == "" {
+		cfg.Recording.OutgoingCADir = defaultCADir
+	}
 
 	return cfg, nil
 }
@@ -135,10 +588,48 @@ func (c *Config) expandEnvVars() {
 	c.Service.BaseURL = os.ExpandEnv(c.Service.BaseURL)
 	c.Service.Command = os.ExpandEnv(c.Service.Command)
 	c.Service.MockEnvVar = os.ExpandEnv(c.Service.MockEnvVar)
+	c.Service.ClientCert = os.ExpandEnv(c.Service.ClientCert)
+	c.Service.ClientKey = os.ExpandEnv(c.Service.ClientKey)
+	c.Service.CACert = os.ExpandEnv(c.Service.CACert)
 	c.Database.ConnectionString = os.ExpandEnv(c.Database.ConnectionString)
+	expandFilters(c.Database.Filters)
+	for i := range c.Databases {
+		c.Databases[i].ConnectionString = os.ExpandEnv(c.Databases[i].ConnectionString)
+		expandFilters(c.Databases[i].Filters)
+	}
 	c.Recording.SnapshotDir = os.ExpandEnv(c.Recording.SnapshotDir)
 	c.Recording.ProxyAuthToken = os.ExpandEnv(c.Recording.ProxyAuthToken)
+	c.Recording.RedactKey = os.ExpandEnv(c.Recording.RedactKey)
+	c.Recording.OnSnapshotWebhook = os.ExpandEnv(c.Recording.OnSnapshotWebhook)
+	c.Recording.ProxyListen = os.ExpandEnv(c.Recording.ProxyListen)
+	c.Recording.OutgoingProxyListen = os.ExpandEnv(c.Recording.OutgoingProxyListen)
+	c.Recording.OutgoingCADir = os.ExpandEnv(c.Recording.OutgoingCADir)
 	c.Replay.TestDatabase.ConnectionString = os.ExpandEnv(c.Replay.TestDatabase.ConnectionString)
+	for name, connStr := range c.Replay.TestDatabase.Databases {
+		c.Replay.TestDatabase.Databases[name] = os.ExpandEnv(connStr)
+	}
+	c.Replay.TestDatabase.Image = os.ExpandEnv(c.Replay.TestDatabase.Image)
+	c.Replay.TestDatabase.Schema = os.ExpandEnv(c.Replay.TestDatabase.Schema)
+	c.Replay.CacheFile = os.ExpandEnv(c.Replay.CacheFile)
+	c.Replay.LastRunFile = os.ExpandEnv(c.Replay.LastRunFile)
+	c.Replay.VariablesFile = os.ExpandEnv(c.Replay.VariablesFile)
+	c.Replay.Clock.FaketimeLib = os.ExpandEnv(c.Replay.Clock.FaketimeLib)
+	for name, value := range c.Replay.Variables {
+		if s, ok := value.(string); ok {
+			c.Replay.Variables[name] = os.ExpandEnv(s)
+		}
+	}
+	c.Protobuf.DescriptorSet = os.ExpandEnv(c.Protobuf.DescriptorSet)
+	c.Protobuf.ProtoDir = os.ExpandEnv(c.Protobuf.ProtoDir)
+	for i := range c.Auth.Tokens {
+		c.Auth.Tokens[i].Token = os.ExpandEnv(c.Auth.Tokens[i].Token)
+	}
+}
+
+func expandFilters(filters map[string]string) {
+	for table, filter := range filters {
+		filters[table] = os.ExpandEnv(filter)
+	}
 }
 
 // LoadForProxy reads a config file with relaxed validation suitable for proxy-only mode.
@@ -171,9 +662,476 @@ func (c *Config) validateProxy() error {
 	if c.Service.Name == "" {
 		return fmt.Errorf("service.name is required")
 	}
-	if c.Service.BaseURL == "" {
+	if err := validateBaseURL(c.Service.BaseURL); err != nil {
+		return err
+	}
+	if err := listen.Validate(c.Recording.ProxyListen); err != nil {
+		return fmt.Errorf("recording.proxy_listen: %w", err)
+	}
+	if err := c.validateClientCert(); err != nil {
+		return err
+	}
+	return c.validateAuth()
+}
+
+// validateClientCert requires client_cert and client_key together.
+func (c *Config) validateClientCert() error {
+	if (c.Service.ClientCert == "") != (c.Service.ClientKey == "") {
+		return fmt.Errorf("service.client_cert and service.client_key must be set together")
+	}
+	return nil
+}
+
+// validateBaseURL accepts http(s) and h2c URLs, including bracketed IPv6
+// hosts, and unix:// socket paths.
+func validateBaseURL(baseURL string) error {
+	if baseURL == "" {
 		return fmt.Errorf("service.base_url is required")
 	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("service.base_url is invalid: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "h2c":
+		if u.Host == "" {
+			return fmt.Errorf("service.base_url must include a host")
+		}
+	case "unix":
+		if u.Host+u.Path == "" {
+			return fmt.Errorf("service.base_url must include a socket path, e.g. unix:///var/run/app.sock")
+		}
+	default:
+		return fmt.Errorf("service.base_url must be an http, https, h2c or unix URL")
+	}
+	return nil
+}
+
+// validateLatency checks the global latency thresholds and those of each
+// endpoint rule.
+func (c *Config) validateLatency() error {
+	l := c.Replay.Latency
+	if l.Tolerance < 0 {
+		return fmt.Errorf("replay.latency.tolerance must not be negative")
+	}
+	if l.MinDeltaMs < 0 {
+		return fmt.Errorf("replay.latency.min_delta_ms must not be negative")
+	}
+	if l.MaxDeltaMs < 0 {
+		return fmt.Errorf("replay.latency.max_delta_ms must not be negative")
+	}
+	for i, rule := range l.Endpoints {
+		field := fmt.Sprintf("replay.latency.endpoints[%d]", i)
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("%s.path must start with /", field)
+		}
+		if _, err := path.Match(rule.Path, ""); err != nil {
+			return fmt.Errorf("%s.path: invalid pattern %q", field, rule.Path)
+		}
+		if rule.Tolerance != nil && *rule.Tolerance < 0 {
+			return fmt.Errorf("%s.tolerance must not be negative", field)
+		}
+		if rule.MinDeltaMs != nil && *rule.MinDeltaMs < 0 {
+			return fmt.Errorf("%s.min_delta_ms must not be negative", field)
+		}
+		if rule.MaxDeltaMs != nil && *rule.MaxDeltaMs < 0 {
+			return fmt.Errorf("%s.max_delta_ms must not be negative", field)
+		}
+	}
+	return nil
+}
+
+// validateParallel rejects parallel replay combined with settings that
+// need snapshots replayed one at a time.
+func (c *Config) validateParallel() error {
+	if c.Replay.Workers < 0 {
+		return fmt.Errorf("replay.workers must not be negative")
+	}
+	if !c.Replay.Parallel {
+		return nil
+	}
+	switch {
+	case c.Replay.CookieJar:
+		return fmt.Errorf("replay.cookie_jar requires sequential replay; unset replay.parallel")
+	case c.Service.Restart == restartRun:
+		return fmt.Errorf("service.restart: run requires sequential replay; unset replay.parallel")
+	case c.Replay.MockAddress != "":
+		return fmt.Errorf("replay.mock_address requires sequential replay; unset replay.parallel")
+	case c.Service.Command != "" && c.Replay.Isolation != isolationDatabase:
+		// Without isolation every worker would start the service on the
+		// same service.base_url port
+		return fmt.Errorf("service.command with replay.parallel requires replay.isolation: database")
+	}
+	return nil
+}
+
+// validateExitPolicy checks the limits of replay.exit_policy.
+func (c *Config) validateExitPolicy() error {
+	p := c.Replay.ExitPolicy
+	if p != (ExitPolicyConfig{}) && !c.Replay.StrictMode {
+		return fmt.Errorf("replay.exit_policy has no effect without replay.strict_mode")
+	}
+	// Fail-fast skips the rest of the run at the first failure, so the
+	// failures a policy tolerates would never be counted
+	if p != (ExitPolicyConfig{}) && c.Replay.FailFast {
+		return fmt.Errorf("replay.exit_policy cannot be combined with replay.fail_fast")
+	}
+	for _, limit := range []struct {
+		name  string
+		value *int
+	}{{"max_failures", p.MaxFailures}, {"max_errors", p.MaxErrors}} {
+		if limit.value != nil && *limit.value < 0 {
+			return fmt.Errorf("replay.exit_policy.%s must not be negative", limit.name)
+		}
+	}
+	for _, limit := range []struct {
+		name  string
+		value *float64
+	}{{"max_failure_rate", p.MaxFailureRate}, {"max_error_rate", p.MaxErrorRate}} {
+		if limit.value != nil && (*limit.value < 0 || *limit.value > 1) {
+			return fmt.Errorf("replay.exit_policy.%s must be between 0 and 1", limit.name)
+		}
+	}
+	return nil
+}
+
+// validateClock checks replay.clock. The environment of a managed service
+// is fixed when it starts, so env_var and faketime need one started for
+// every snapshot.
+func (c *Config) validateClock() error {
+	clock := c.Replay.Clock
+	switch clock.Format {
+	case "", clockFormatRFC3339, clockFormatUnix, clockFormatUnixMs:
+	default:
+		return fmt.Errorf("replay.clock.format must be rfc3339, unix or unix_ms")
+	}
+	if clock.EnvVar == "" && !clock.Faketime {
+		return nil
+	}
+	switch {
+	case c.Service.Command == "":
+		return fmt.Errorf("replay.clock.env_var and replay.clock.faketime need service.command")
+	case c.Service.Restart == restartRun:
+		return fmt.Errorf("replay.clock.env_var and replay.clock.faketime need a service started for every snapshot, not service.restart: run")
+	case clock.Faketime && clock.FaketimeLib == "" && defaultFaketimeLibs[runtime.GOOS+"/"+runtime.GOARCH] == "":
+		return fmt.Errorf("replay.clock.faketime_lib must be set on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	return nil
+}
+
+// SetWorkers overrides replay.workers, e.g. from the command line. More
+// than one worker turns parallel replay on, a single worker turns it off.
+func (c *Config) SetWorkers(n int) error {
+	if n < 1 {
+		return fmt.Errorf("workers must be at least 1")
+	}
+	c.Replay.Workers = n
+	c.Replay.Parallel = n > 1
+	return c.validateParallel()
+}
+
+// AddMatcher sets the dynamic matcher used for paths matching pattern,
+// e.g. from the command line, replacing any replay.matchers entry for it.
+func (c *Config) AddMatcher(pattern, matcher string) error {
+	if err := validateMatcher(pattern, matcher); err != nil {
+		return err
+	}
+	if c.Replay.Matchers == nil {
+		c.Replay.Matchers = make(map[string]string)
+	}
+	c.Replay.Matchers[pattern] = matcher
+	return nil
+}
+
+// SetFailFast turns replay.fail_fast on, e.g. from the command line.
+func (c *Config) SetFailFast() error {
+	c.Replay.FailFast = true
+	return c.validateExitPolicy()
+}
+
+// SetAssert overrides replay.assert, e.g. from the command line.
+func (c *Config) SetAssert(scope string) error {
+	c.Replay.Assert = scope
+	return c.validateAssert()
+}
+
+// validateAssert checks replay.assert.
+func (c *Config) validateAssert() error {
+	switch c.Replay.Assert {
+	case "", assertAll, assertResponse, assertDB, assertDiff:
+		return nil
+	default:
+		return fmt.Errorf("replay.assert must be all, response, db or diff")
+	}
+}
+
+// LoadVariables reads replay variables from a YAML or JSON file of name:
+// value pairs, e.g. the values for one tenant, replacing variables of the
+// same name already set.
+func (c *Config) LoadVariables(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading variables file: %w", err)
+	}
+	var vars map[string]any
+	if err := yaml.Unmarshal(data, &vars); err != nil {
+		return fmt.Errorf("parsing variables file %s: %w", path, err)
+	}
+	for name, value := range vars {
+		if err := c.SetVariable(name, value); err != nil {
+			return fmt.Errorf("variables file %s: %w", path, err)
+		}
+	}
+	c.Replay.VariablesFile = path
+	return nil
+}
+
+// SetVariable sets the value replacing {{name}} in snapshots at replay
+// time, e.g. from the command line.
+func (c *Config) SetVariable(name string, value any) error {
+	if err := validateVariableName(name); err != nil {
+		return err
+	}
+	if c.Replay.Variables == nil {
+		c.Replay.Variables = make(map[string]any)
+	}
+	c.Replay.Variables[name] = value
+	return nil
+}
+
+// validateVariableName checks that name can be used as {{name}} in a
+// snapshot.
+func validateVariableName(name string) error {
+	if !variableName.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q: must start with a letter or underscore and contain only letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// validateMatcher checks a replay.matchers entry.
+func validateMatcher(pattern, matcher string) error {
+	if pattern == "" {
+		return fmt.Errorf("replay.matchers: path must not be empty")
+	}
+	switch matcher {
+	case matcherAny, matcherUUID, matcherISODate:
+		return nil
+	}
+	return fmt.Errorf("replay.matchers.%s: unknown matcher %q (want %s, %s or %s)", pattern, matcher, matcherAny, matcherUUID, matcherISODate)
+}
+
+// validateIsolation checks that per-worker isolation can copy the database
+// and start one service instance per worker.
+func (c *Config) validateIsolation() error {
+	switch c.Replay.Isolation {
+	case "":
+		return nil
+	case isolationDatabase:
+		// checked below
+	default:
+		return fmt.Errorf("replay.isolation must be database")
+	}
+	switch {
+	case c.Service.Command == "":
+		return fmt.Errorf("replay.isolation requires service.command to start one service per worker")
+	case len(c.Databases) > 0:
+		return fmt.Errorf("replay.isolation supports a single database only")
+	case c.Database.Type != dbTypePostgres && c.Database.Type != dbTypeSQLite:
+		return fmt.Errorf("replay.isolation requires a postgres or sqlite database")
+	case strings.HasPrefix(c.Service.BaseURL, "unix:"):
+		return fmt.Errorf("replay.isolation requires an http or https service.base_url")
+	}
+	return nil
+}
+
+// validateProvision checks replay.test_database.provision, which replaces
+// the test database connection string with that of a new container.
+func (c *Config) validateProvision() error {
+	td := c.Replay.TestDatabase
+	switch td.Provision {
+	case "":
+		if td.Image != "" || td.Schema != "" {
+			return fmt.Errorf("replay.test_database.image and schema need replay.test_database.provision")
+		}
+		return nil
+	case provisionDocker:
+		// checked below
+	default:
+		return fmt.Errorf("replay.test_database.provision must be docker")
+	}
+	switch {
+	case len(c.Databases) > 0:
+		return fmt.Errorf("replay.test_database.provision supports a single database only")
+	case c.Database.Type != dbTypePostgres && c.Database.Type != dbTypeMySQL:
+		return fmt.Errorf("replay.test_database.provision requires a postgres or mysql database")
+	case td.ConnectionString != "":
+		return fmt.Errorf("replay.test_database.connection_string cannot be combined with provision, which creates the database")
+	}
+	return nil
+}
+
+func (c *Config) validateProtobuf() error {
+	p := c.Protobuf
+	if p.DescriptorSet != "" && p.ProtoDir != "" {
+		return fmt.Errorf("protobuf.descriptor_set and protobuf.proto_dir are mutually exclusive")
+	}
+	if len(p.Messages) > 0 && p.DescriptorSet == "" && p.ProtoDir == "" {
+		return fmt.Errorf("protobuf.messages requires protobuf.descriptor_set or protobuf.proto_dir")
+	}
+	for i, m := range p.Messages {
+		if !strings.HasPrefix(m.Path, "/") {
+			return fmt.Errorf("protobuf.messages[%d].path must start with /", i)
+		}
+		if m.Request == "" && m.Response == "" {
+			return fmt.Errorf("protobuf.messages[%d] needs a request or response message type", i)
+		}
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether host, from a host:port address, only
+// accepts connections from this machine. An empty host listens on every
+// interface.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (c *Config) validateAuth() error {
+	for i, t := range c.Auth.Tokens {
+		if t.Token == "" {
+			return fmt.Errorf("auth.tokens[%d].token is required", i)
+		}
+		if t.Role != authRoleRead && t.Role != authRoleAdmin {
+			return fmt.Errorf("auth.tokens[%d].role must be read or admin", i)
+		}
+	}
+	return nil
+}
+
+// validateDatabases checks either the single database or the databases list.
+func (c *Config) validateDatabases() error {
+	if len(c.Databases) == 0 {
+		return validateDatabase("database", c.Database)
+	}
+	if c.Database.Type != "" || c.Database.ConnectionString != "" {
+		return fmt.Errorf("database and databases cannot both be set")
+	}
+
+	seen := make(map[string]bool)
+	for i, d := range c.Databases {
+		field := fmt.Sprintf("databases[%d]", i)
+		if d.Name == "" {
+			return fmt.Errorf("%s.name is required", field)
+		}
+		// Names prefix table names as name.table
+		if strings.Contains(d.Name, ".") {
+			return fmt.Errorf("%s.name must not contain '.'", field)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("%s.name %q is used more than once", field, d.Name)
+		}
+		seen[d.Name] = true
+		if err := validateDatabase(field, d); err != nil {
+			return err
+		}
+	}
+	for name := range c.Replay.TestDatabase.Databases {
+		if !seen[name] {
+			return fmt.Errorf("replay.test_database.databases: unknown database %q", name)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateSampling() error {
+	if r := c.Recording.SampleRate; r != nil && (*r < 0 || *r > 1) {
+		return fmt.Errorf("recording.sample_rate must be between 0 and 1")
+	}
+	for i, rule := range c.Recording.SampleRates {
+		field := fmt.Sprintf("recording.sample_rates[%d]", i)
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("%s.path must start with /", field)
+		}
+		if _, err := path.Match(rule.Path, ""); err != nil {
+			return fmt.Errorf("%s.path: invalid pattern %q", field, rule.Path)
+		}
+		if rule.Rate == nil {
+			return fmt.Errorf("%s.rate is required", field)
+		}
+		if *rule.Rate < 0 || *rule.Rate > 1 {
+			return fmt.Errorf("%s.rate must be between 0 and 1", field)
+		}
+	}
+	return nil
+}
+
+// validatePathPatterns checks the URL path globs of a config field.
+func validatePathPatterns(field string, patterns []string) error {
+	for i, p := range patterns {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("%s[%d] must start with /", field, i)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("%s[%d]: invalid pattern %q", field, i, p)
+		}
+	}
+	return nil
+}
+
+// isStatusPattern reports whether s is an HTTP status code from 100 to 599
+// or a class of them, such as 2xx.
+func isStatusPattern(s string) bool {
+	s = strings.ToLower(s)
+	if len(s) != 3 || s[0] < '1' || s[0] > '5' {
+		return false
+	}
+	if s[1:] == "xx" {
+		return true
+	}
+	return s[1] >= '0' && s[1] <= '9' && s[2] >= '0' && s[2] <= '9'
+}
+
+func validateDatabase(field string, d DatabaseConfig) error {
+	if d.Type == "" {
+		return fmt.Errorf("%s.type is required", field)
+	}
+	switch d.Type {
+	case dbTypePostgres, dbTypeMySQL, dbTypeSQLite, dbTypeMSSQL, dbTypeRedis, dbTypeDynamoDB:
+		// ok
+	default:
+		return fmt.Errorf("unsupported database type: %s (must be postgres, mysql, sqlite, mssql, redis, or dynamodb)", d.Type)
+	}
+	if d.ConnectionString == "" {
+		return fmt.Errorf("%s.connection_string is required", field)
+	}
+	if len(d.Filters) > 0 && (d.Type == dbTypeRedis || d.Type == dbTypeDynamoDB) {
+		return fmt.Errorf("%s: table filters are not supported for %s", field, d.Type)
+	}
+	switch d.RestoreMode {
+	case "", restoreModeInsert:
+		// ok
+	case restoreModeBulk:
+		if d.Type == dbTypeRedis || d.Type == dbTypeDynamoDB {
+			return fmt.Errorf("%s.restore_mode: bulk is not supported for %s", field, d.Type)
+		}
+	default:
+		return fmt.Errorf("%s.restore_mode must be insert or bulk", field)
+	}
+	if d.IncludeViews && (d.Type == dbTypeRedis || d.Type == dbTypeDynamoDB) {
+		return fmt.Errorf("%s.include_views is not supported for %s", field, d.Type)
+	}
+	if d.RefreshMaterializedViews {
+		switch {
+		case d.Type != dbTypePostgres:
+			return fmt.Errorf("%s.refresh_materialized_views is only supported for postgres", field)
+		case !d.IncludeViews:
+			return fmt.Errorf("%s.refresh_materialized_views requires include_views", field)
+		}
+	}
 	return nil
 }
 
@@ -181,23 +1139,186 @@ func (c *Config) validate() error {
 	if c.Service.Name == "" {
 		return fmt.Errorf("service.name is required")
 	}
-	if c.Service.BaseURL == "" {
-		return fmt.Errorf("service.base_url is required")
+	if err := validateBaseURL(c.Service.BaseURL); err != nil {
+		return err
 	}
-	if c.Database.Type == "" {
-		return fmt.Errorf("database.type is required")
+	if err := c.validateClientCert(); err != nil {
+		return err
 	}
-	switch c.Database.Type {
-	case dbTypePostgres, dbTypeMySQL, dbTypeSQLite:
-		// ok
+	switch c.Service.ReadyCheck {
+	case "", readyCheckSleep, readyCheckTCP, readyCheckHTTP:
 	default:
-		return fmt.Errorf("unsupported database type: %s (must be postgres, mysql, or sqlite)", c.Database.Type)
+		return fmt.Errorf("service.ready_check must be sleep, tcp or http")
+	}
+	if c.Service.ReadyPath != "" && !strings.HasPrefix(c.Service.ReadyPath, "/") {
+		return fmt.Errorf("service.ready_path must start with /")
+	}
+	switch c.Service.Restart {
+	case "", restartSnapshot, restartRun:
+	default:
+		return fmt.Errorf("service.restart must be snapshot or run")
+	}
+	if err := c.validateDatabases(); err != nil {
+		return err
 	}
-	if c.Database.ConnectionString == "" {
-		return fmt.Errorf("database.connection_string is required")
+	if c.Recording.Incremental {
+		switch {
+		case len(c.Databases) > 0:
+			return fmt.Errorf("recording.incremental supports a single database only")
+		case c.Database.Type != dbTypePostgres && c.Database.Type != dbTypeMySQL && c.Database.Type != dbTypeSQLite:
+			return fmt.Errorf("recording.incremental requires a postgres, mysql or sqlite database")
+		case c.Database.IncludeViews:
+			return fmt.Errorf("recording.incremental does not support database.include_views")
+		}
 	}
 	if c.Recording.Format != "" && c.Recording.Format != formatJSON && c.Recording.Format != formatYAML {
 		return fmt.Errorf("recording.format must be json or yaml")
 	}
-	return nil
+	switch c.Recording.RedactMode {
+	case "", redactModeMask:
+		// ok
+	case redactModeHMAC:
+		if c.Recording.RedactKey == "" {
+			return fmt.Errorf("recording.redact_key is required when redact_mode is hmac")
+		}
+	default:
+		return fmt.Errorf("recording.redact_mode must be mask or hmac")
+	}
+	if c.Recording.BodyFileThreshold < 0 {
+		return fmt.Errorf("recording.body_file_threshold must not be negative")
+	}
+	if err := validatePathPatterns("recording.include_paths", c.Recording.IncludePaths); err != nil {
+		return err
+	}
+	if err := validatePathPatterns("recording.exclude_paths", c.Recording.ExcludePaths); err != nil {
+		return err
+	}
+	for i, status := range c.Recording.RecordStatus {
+		if !isStatusPattern(status) {
+			return fmt.Errorf("recording.record_status[%d] must be a status code like 404 or a class like 2xx, got %q", i, status)
+		}
+	}
+	if c.Recording.MaxBodyBytes < 0 {
+		return fmt.Errorf("recording.max_body_bytes must not be negative")
+	}
+	switch c.Recording.OversizedBodies {
+	case "", oversizedTruncate, oversizedSkip:
+		// ok
+	default:
+		return fmt.Errorf("recording.oversized_bodies must be truncate or skip")
+	}
+	if strings.ContainsAny(c.Recording.CorrelationHeader, " \t\r\n:") {
+		return fmt.Errorf("recording.correlation_header must be a header name")
+	}
+	if err := c.validateSampling(); err != nil {
+		return err
+	}
+	for i, rule := range c.Recording.TagRules {
+		field := fmt.Sprintf("recording.tag_rules[%d]", i)
+		if len(rule.Tags) == 0 {
+			return fmt.Errorf("%s must list at least one tag", field)
+		}
+		for name, pattern := range rule.Headers {
+			if !strings.Contains(pattern, "*") {
+				continue
+			}
+			if c.Recording.TagRules[i].headerPatterns == nil {
+				c.Recording.TagRules[i].headerPatterns = make(map[string]*regexp.Regexp)
+			}
+			c.Recording.TagRules[i].headerPatterns[name] = compileHeaderPattern(pattern)
+		}
+		if rule.Path == "" {
+			continue
+		}
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("%s.path must start with /", field)
+		}
+		if _, err := path.Match(rule.Path, ""); err != nil {
+			return fmt.Errorf("%s.path: invalid pattern %q", field, rule.Path)
+		}
+	}
+	for i, rule := range c.Recording.OutgoingHosts {
+		field := fmt.Sprintf("recording.outgoing_hosts[%d]", i)
+		if rule.Host == "" {
+			return fmt.Errorf("%s.host is required", field)
+		}
+		if _, err := path.Match(rule.Host, ""); err != nil {
+			return fmt.Errorf("%s.host: invalid pattern %q", field, rule.Host)
+		}
+		switch rule.Action {
+		case outgoingCapture, outgoingPassthrough, outgoingBlock:
+			// ok
+		default:
+			return fmt.Errorf("%s.action must be capture, passthrough or block", field)
+		}
+	}
+	if c.Recording.OnSnapshotWebhook != "" {
+		u, err := url.Parse(c.Recording.OnSnapshotWebhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("recording.on_snapshot_webhook must be an http(s) URL")
+		}
+	}
+	if err := listen.Validate(c.Recording.ProxyListen); err != nil {
+		return fmt.Errorf("recording.proxy_listen: %w", err)
+	}
+	if err := listen.Validate(c.Recording.OutgoingProxyListen); err != nil {
+		return fmt.Errorf("recording.outgoing_proxy_listen: %w", err)
+	}
+	if err := c.validateIsolation(); err != nil {
+		return err
+	}
+	if err := c.validateLatency(); err != nil {
+		return err
+	}
+	if err := c.validateExitPolicy(); err != nil {
+		return err
+	}
+	if err := c.validateAssert(); err != nil {
+		return err
+	}
+	if err := c.validateClock(); err != nil {
+		return err
+	}
+	if err := c.validateProvision(); err != nil {
+		return err
+	}
+	for name := range c.Replay.Variables {
+		if err := validateVariableName(name); err != nil {
+			return fmt.Errorf("replay.variables: %w", err)
+		}
+	}
+	if c.Replay.Retry.Attempts < 0 {
+		return fmt.Errorf("replay.retry.attempts must not be negative")
+	}
+	if c.Replay.Retry.DelayMs < 0 {
+		return fmt.Errorf("replay.retry.delay_ms must not be negative")
+	}
+	if c.Replay.MockAddress != "" {
+		host, _, err := net.SplitHostPort(c.Replay.MockAddress)
+		if err != nil {
+			return fmt.Errorf("replay.mock_address: %w", err)
+		}
+		// The mock server takes no tokens, so with auth it must not be
+		// reachable from other hosts
+		if len(c.Auth.Tokens) > 0 && !isLoopbackHost(host) {
+			return fmt.Errorf("replay.mock_address must be a loopback address when auth.tokens are set")
+		}
+	}
+	if err := c.validateParallel(); err != nil {
+		return err
+	}
+	for pattern, matcher := range c.Replay.Matchers {
+		if err := validateMatcher(pattern, matcher); err != nil {
+			return err
+		}
+	}
+	for table, keys := range c.Replay.RowKeys {
+		if len(keys) == 0 {
+			return fmt.Errorf("replay.row_keys.%s must list at least one column", table)
+		}
+	}
+	if err := c.validateProtobuf(); err != nil {
+		return err
+	}
+	return c.validateAuth()
 }
@@ -3,6 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -108,7 +111,7 @@ service:
   name: "api"
   base_url: "http://localhost:8080"
 database:
-  type: "redis"
+  type: "cassandra"
   connection_string: "localhost:6379"
 `
 	dir := t.TempDir()
@@ -180,3 +183,1020 @@ database:
 		t.Errorf("expected connection string %q, got %q", expected, cfg.Database.ConnectionString)
 	}
 }
+
+func TestLoad_RedactModeHMACRequiresKey(t *testing.T) {
+	content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: ":memory:"
+recording:
+  redact_mode: "hmac"
+  redact_fields:
+    - "*.email"
+`
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for hmac redact_mode without redact_key")
+	}
+
+	os.Setenv("TEST_REDACT_KEY", "s3cret")
+	defer os.Unsetenv("TEST_REDACT_KEY")
+	content += "  redact_key: \"${TEST_REDACT_KEY}\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Recording.RedactKey != "s3cret" {
+		t.Errorf("expected redact_key to be expanded, got %q", cfg.Recording.RedactKey)
+	}
+}
+
+func TestLoad_AuthTokens(t *testing.T) {
+	content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: ":memory:"
+auth:
+  tokens:
+    - token: "reader"
+      role: "read"
+    - token: "admin"
+      role: "owner"
+`
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for unknown auth role")
+	}
+}
+
+func TestLoad_RowKeysRequireColumns(t *testing.T) {
+	content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: "test.db"
+replay:
+  row_keys:
+    user_roles: []
+`
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for empty row_keys entry")
+	}
+}
+
+func TestLoad_InvalidWebhookURL(t *testing.T) {
+	content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: "test.db"
+recording:
+  on_snapshot_webhook: "not a url"
+`
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for invalid webhook URL")
+	}
+}
+
+func TestLoad_BaseURLForms(t *testing.T) {
+	tests := map[string]bool{
+		"http://localhost:8080":    true,
+		"http://[::1]:8080":        true,
+		"unix:///var/run/app.sock": true,
+		"unix://":                  false,
+		"localhost:8080":           false,
+		"ftp://example.com":        false,
+	}
+	for baseURL, valid := range tests {
+		content := `
+service:
+  name: "api"
+  base_url: "` + baseURL + `"
+database:
+  type: "sqlite"
+  connection_string: "test.db"
+`
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Load(path)
+		if valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", baseURL, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("%s: expected error", baseURL)
+		}
+	}
+}
+
+func TestLoad_ListenAddresses(t *testing.T) {
+	tests := map[string]bool{
+		`proxy_listen: "unix:///run/snapshot-tester.sock"`: true,
+		`outgoing_proxy_listen: "systemd:outgoing"`:        true,
+		`proxy_listen: "0.0.0.0:8080"`:                     false,
+		`outgoing_proxy_listen: "unix://"`:                 false,
+	}
+	for setting, valid := range tests {
+		content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: "test.db"
+recording:
+  ` + setting + "\n"
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Load(path)
+		if valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", setting, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("%s: expected error", setting)
+		}
+	}
+}
+
+func TestLoad_MultipleDatabases(t *testing.T) {
+	t.Setenv("CACHE_URL", "redis://localhost:6379/0")
+	content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+databases:
+  - name: "main"
+    type: "postgres"
+    connection_string: "postgres://localhost/app"
+  - name: "cache"
+    type: "redis"
+    connection_string: "${CACHE_URL}"
+    tables: ["session:*"]
+replay:
+  test_database:
+    databases:
+      main: "postgres://localhost/app_test"
+`
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs := cfg.DatabaseList()
+	if len(dbs) != 2 || dbs[0].Name != "main" || dbs[1].Name != "cache" {
+		t.Fatalf("unexpected databases: %+v", dbs)
+	}
+	if got := cfg.ReplayConnectionString(dbs[0]); got != "postgres://localhost/app_test" {
+		t.Errorf("expected test connection string for main, got %q", got)
+	}
+	if got := cfg.ReplayConnectionString(dbs[1]); got != "redis://localhost:6379/0" {
+		t.Errorf("expected cache to fall back to its own expanded connection string, got %q", got)
+	}
+}
+
+func TestLoad_MultipleDatabasesInvalid(t *testing.T) {
+	tests := map[string]string{
+		"missing name": `
+databases:
+  - type: "sqlite"
+    connection_string: "a.db"`,
+		"duplicate name": `
+databases:
+  - {name: "a", type: "sqlite", connection_string: "a.db"}
+  - {name: "a", type: "sqlite", connection_string: "b.db"}`,
+		"dotted name": `
+databases:
+  - {name: "a.b", type: "sqlite", connection_string: "a.db"}`,
+		"both forms": `
+database:
+  type: "sqlite"
+  connection_string: "a.db"
+databases:
+  - {name: "a", type: "sqlite", connection_string: "a.db"}`,
+		"unknown test database": `
+databases:
+  - {name: "a", type: "sqlite", connection_string: "a.db"}
+replay:
+  test_database:
+    databases:
+      b: "b.db"`,
+		"invalid type": `
+databases:
+  - {name: "a", type: "cassandra", connection_string: "a"}`,
+	}
+	for name, dbs := range tests {
+		content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+` + dbs + "\n"
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoad_TableFilters(t *testing.T) {
+	t.Setenv("TENANT_ID", "42")
+	content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "postgres"
+  connection_string: "postgres://localhost/app"
+  tables:
+    - users
+    - name: orders
+      filter: "tenant_id = ${TENANT_ID}"
+`
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Database.Tables, []string{"users", "orders"}) {
+		t.Errorf("unexpected tables: %v", cfg.Database.Tables)
+	}
+	if !reflect.DeepEqual(cfg.Database.Filters, map[string]string{"orders": "tenant_id = 42"}) {
+		t.Errorf("unexpected filters: %v", cfg.Database.Filters)
+	}
+}
+
+func TestLoad_TableFiltersInvalid(t *testing.T) {
+	tests := map[string]string{
+		"entry without name": `
+database:
+  type: "postgres"
+  connection_string: "postgres://localhost/app"
+  tables:
+    - filter: "tenant_id = 42"`,
+		"redis": `
+database:
+  type: "redis"
+  connection_string: "redis://localhost:6379"
+  tables:
+    - {name: "session:*", filter: "tenant_id = 42"}`,
+	}
+	for name, db := range tests {
+		content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+` + db + "\n"
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoad_RestoreMode(t *testing.T) {
+	tests := []struct {
+		db      string
+		wantErr bool
+	}{
+		{`{type: "postgres", connection_string: "postgres://localhost/app", restore_mode: "bulk"}`, false},
+		{`{type: "sqlite", connection_string: "a.db", restore_mode: "insert"}`, false},
+		{`{type: "sqlite", connection_string: "a.db", restore_mode: "copy"}`, true},
+		{`{type: "redis", connection_string: "redis://localhost:6379", restore_mode: "bulk"}`, true},
+	}
+	for _, tt := range tests {
+		content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database: ` + tt.db + "\n"
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.db, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_IncrementalRequiresSingleSQLDatabase(t *testing.T) {
+	tests := []struct {
+		dbs     string
+		wantErr bool
+	}{
+		{`database: {type: "sqlite", connection_string: "a.db"}`, false},
+		{`database: {type: "redis", connection_string: "redis://localhost:6379"}`, true},
+		{`database: {type: "mssql", connection_string: "sqlserver://localhost"}`, true},
+		{`databases: [{name: "a", type: "sqlite", connection_string: "a.db"}]`, true},
+	}
+	for _, tt := range tests {
+		content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+recording:
+  incremental: true
+` + tt.dbs + "\n"
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.dbs, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_ReplayIsolation(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   string
+		wantErr bool
+	}{
+		{"sqlite", `database: {type: "sqlite", connection_string: "a.db"}`, false},
+		{"postgres", `database: {type: "postgres", connection_string: "postgres://localhost/app"}`, false},
+		{"mysql", `database: {type: "mysql", connection_string: "root@/app"}`, true},
+		{"multiple databases", `databases: [{name: "a", type: "sqlite", connection_string: "a.db"}]`, true},
+		{"unknown strategy", "database: {type: \"sqlite\", connection_string: \"a.db\"}\nreplay: {isolation: \"schema\"}", true},
+	}
+	for _, tt := range tests {
+		content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+  command: "./app"
+` + tt.extra + "\n"
+		if !strings.Contains(tt.extra, "replay:") {
+			content += "replay: {parallel: true, isolation: \"database\"}\n"
+		}
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_ReplayIsolationRequiresCommand(t *testing.T) {
+	content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database: {type: "sqlite", connection_string: "a.db"}
+replay: {parallel: true, isolation: "database"}
+`
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "service.command") {
+		t.Errorf("expected a service.command error, got %v", err)
+	}
+}
+
+func TestLoad_Views(t *testing.T) {
+	tests := []struct {
+		db      string
+		wantErr bool
+	}{
+		{`{type: "sqlite", connection_string: "a.db", include_views: true}`, false},
+		{`{type: "postgres", connection_string: "postgres://localhost/app", include_views: true, refresh_materialized_views: true}`, false},
+		{`{type: "postgres", connection_string: "postgres://localhost/app", refresh_materialized_views: true}`, true},
+		{`{type: "mysql", connection_string: "root@/app", include_views: true, refresh_materialized_views: true}`, true},
+		{`{type: "redis", connection_string: "redis://localhost:6379", include_views: true}`, true},
+	}
+	for _, tt := range tests {
+		content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database: ` + tt.db + "\n"
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.db, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_OutgoingMITM(t *testing.T) {
+	content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: "a.db"
+recording:
+  outgoing_mitm: true
+`
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Recording.OutgoingMITM {
+		t.Error("expected outgoing_mitm to be enabled")
+	}
+	if cfg.Recording.OutgoingCADir != defaultCADir {
+		t.Errorf("expected default CA dir %q, got %q", defaultCADir, cfg.Recording.OutgoingCADir)
+	}
+}
+
+func TestLoad_CookieJarRequiresSequentialReplay(t *testing.T) {
+	content := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: "a.db"
+replay:
+  cookie_jar: true
+  parallel: true
+`
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "cookie_jar") {
+		t.Errorf("expected a cookie_jar error, got %v", err)
+	}
+}
+
+func TestLoad_Latency(t *testing.T) {
+	base := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: "a.db"
+replay:
+  latency:
+`
+	tests := []struct {
+		name    string
+		section string
+		wantErr string
+	}{
+		{"valid", "    tolerance: 0.5\n    min_delta_ms: 50\n    fail: true\n", ""},
+		{"negative tolerance", "    tolerance: -1\n", "replay.latency.tolerance must not be negative"},
+		{"negative delta", "    min_delta_ms: -5\n", "replay.latency.min_delta_ms must not be negative"},
+		{"negative max delta", "    max_delta_ms: -5\n", "replay.latency.max_delta_ms must not be negative"},
+		{"endpoint without path", "    endpoints:\n      - method: GET\n", "replay.latency.endpoints[0].path must start with /"},
+		{"endpoint bad pattern", "    endpoints:\n      - path: \"/[\"\n", "replay.latency.endpoints[0].path: invalid pattern"},
+		{"endpoint negative tolerance", "    endpoints:\n      - path: /reports\n        tolerance: -1\n", "replay.latency.endpoints[0].tolerance must not be negative"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(base+tt.section), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(path)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			} else if l := cfg.Replay.Latency; l.Tolerance != 0.5 || l.MinDeltaMs != 50 || !l.Fail {
+				t.Errorf("%s: unexpected latency config %+v", tt.name, l)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestLoad_Protobuf(t *testing.T) {
+	base := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: "a.db"
+`
+	tests := []struct {
+		name    string
+		section string
+		wantErr string
+	}{
+		{"valid", "protobuf:\n  descriptor_set: api.binpb\n  messages:\n    - {method: GET, path: /v1/users/*, response: acme.User}\n", ""},
+		{"no descriptors", "protobuf:\n  messages:\n    - {path: /v1/users, response: acme.User}\n", "descriptor_set or protobuf.proto_dir"},
+		{"both sources", "protobuf:\n  descriptor_set: api.binpb\n  proto_dir: proto\n", "mutually exclusive"},
+		{"relative path", "protobuf:\n  proto_dir: proto\n  messages:\n    - {path: v1/users, response: acme.User}\n", "must start with /"},
+		{"no types", "protobuf:\n  proto_dir: proto\n  messages:\n    - {path: /v1/users}\n", "request or response"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(base+tt.section), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(path)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			} else if len(cfg.Protobuf.Messages) != 1 || cfg.Protobuf.Messages[0].Response != "acme.User" {
+				t.Errorf("%s: unexpected protobuf config %+v", tt.name, cfg.Protobuf)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestLoad_RecordingOptions(t *testing.T) {
+	base := `
+service:
+  name: "api"
+  base_url: "http://localhost:8080"
+database:
+  type: "sqlite"
+  connection_string: "a.db"
+recording:
+`
+	tests := []struct {
+		name    string
+		section string
+		wantErr string
+	}{
+		{"valid", "  include_paths: [/api/**]\n  exclude_paths: [/health, /metrics]\n  exclude_methods: [OPTIONS]\n  record_status: [2xx, 3XX, 404]\n  sample_rate: 0.05\n  sample_rates:\n    - {method: POST, path: /api/orders, rate: 1}\n  tag_rules:\n    - {method: POST, tags: [mutations]}\n", ""},
+		{"relative path", "  exclude_paths: [health]\n", "recording.exclude_paths[0] must start with /"},
+		{"bad pattern", "  include_paths: [\"/users/[\"]\n", "invalid pattern"},
+		{"sample rate too high", "  sample_rate: 5\n", "recording.sample_rate must be between 0 and 1"},
+		{"sample rule without rate", "  sample_rates:\n    - {path: /search}\n", "recording.sample_rates[0].rate is required"},
+		{"sample rule relative path", "  sample_rates:\n    - {path: search, rate: 0.1}\n", "recording.sample_rates[0].path must start with /"},
+		{"tag rule without tags", "  tag_rules:\n    - {path: /api/admin/**}\n", "recording.tag_rules[0] must list at least one tag"},
+		{"tag rule relative path", "  tag_rules:\n    - {path: admin, tags: [admin]}\n", "recording.tag_rules[0].path must start with /"},
+		{"negative max body", "  max_body_bytes: -1\n", "recording.max_body_bytes must not be negative"},
+		{"oversized mode", "  max_body_bytes: 1024\n  oversized_bodies: drop\n", "recording.oversized_bodies must be truncate or skip"},
+		{"bad status", "  record_status: [2x]\n", "recording.record_status[0] must be a status code"},
+		{"status out of range", "  record_status: [700]\n", "recording.record_status[0] must be a status code"},
+		{"correlation header", "  correlation_header: \"X-Request-Id: 1\"\n", "recording.correlation_header must be a header name"},
+		{"outgoing host action", "  outgoing_hosts:\n    - {host: datadog-agent, action: ignore}\n", "recording.outgoing_hosts[0].action must be capture, passthrough or block"},
+		{"outgoing host missing", "  outgoing_hosts:\n    - {action: block}\n", "recording.outgoing_hosts[0].host is required"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(base+tt.section), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(path)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			} else if len(cfg.Recording.ExcludePaths) != 2 || cfg.Recording.ExcludeMethods[0] != "OPTIONS" ||
+				*cfg.Recording.SampleRate != 0.05 || *cfg.Recording.SampleRates[0].Rate != 1 || len(cfg.Recording.RecordStatus) != 3 {
+				t.Errorf("%s: unexpected recording config %+v", tt.name, cfg.Recording)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestLoad_ClientCertRequiresKey(t *testing.T) {
+	content := `
+service:
+  name: "api"
+  base_url: "https://staging:8443"
+  client_cert: "client.pem"
+database: {type: "sqlite", connection_string: "a.db"}
+`
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "service.client_key") {
+		t.Errorf("expected a service.client_key error, got %v", err)
+	}
+}
+
+func TestLoad_ReadyCheck(t *testing.T) {
+	load := func(service string) (*Config, error) {
+		content := "service:\n  name: \"api\"\n  base_url: \"http://localhost:3000\"\n" + service +
+			"database: {type: \"sqlite\", connection_string: \"a.db\"}\n"
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(path)
+	}
+
+	cfg, err := load("  ready_check: tcp\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Service.ReadyTimeoutMs != defaultReadyTimeoutMs {
+		t.Errorf("expected the ready timeout default %d, got %d", defaultReadyTimeoutMs, cfg.Service.ReadyTimeoutMs)
+	}
+	if cfg.Service.StartupTimeMs != defaultStartupTimeMs {
+		t.Errorf("expected startup_time_ms to keep its default %d with a check, got %d", defaultStartupTimeMs, cfg.Service.StartupTimeMs)
+	}
+	if cfg, err = load(""); err != nil || cfg.Service.StartupTimeMs != defaultStartupTimeMs {
+		t.Errorf("expected the startup sleep default %d, got %v %v", defaultStartupTimeMs, cfg, err)
+	}
+	if _, err := load("  ready_check: exec\n"); err == nil || !strings.Contains(err.Error(), "service.ready_check") {
+		t.Errorf("expected a service.ready_check error, got %v", err)
+	}
+	if _, err := load("  ready_check: http\n  ready_path: healthz\n"); err == nil || !strings.Contains(err.Error(), "service.ready_path") {
+		t.Errorf("expected a service.ready_path error, got %v", err)
+	}
+}
+
+func TestLoad_ServiceRestart(t *testing.T) {
+	tests := []struct {
+		extra   string
+		wantErr string
+	}{
+		{"service: {name: api, base_url: \"http://localhost:3000\", restart: run}\n", ""},
+		{"service: {name: api, base_url: \"http://localhost:3000\", restart: always}\n", "service.restart must be snapshot or run"},
+		{"service: {name: api, base_url: \"http://localhost:3000\", restart: run}\nreplay: {parallel: true}\n", "service.restart: run requires sequential replay"},
+		{"service: {name: api, base_url: \"http://localhost:3000\", command: ./bin/api}\nreplay: {parallel: true}\n", "requires replay.isolation: database"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		content := tt.extra + "database: {type: \"sqlite\", connection_string: \"a.db\"}\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.extra, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%q: expected %q, got %v", tt.extra, tt.wantErr, err)
+		}
+	}
+}
+
+func TestSetWorkers(t *testing.T) {
+	cfg := &Config{}
+	if err := cfg.SetWorkers(3); err != nil || !cfg.Replay.Parallel || cfg.Replay.Workers != 3 {
+		t.Errorf("expected 3 parallel workers, got parallel=%v workers=%d err=%v", cfg.Replay.Parallel, cfg.Replay.Workers, err)
+	}
+	if err := cfg.SetWorkers(1); err != nil || cfg.Replay.Parallel {
+		t.Errorf("expected one worker to turn parallel replay off, got parallel=%v err=%v", cfg.Replay.Parallel, err)
+	}
+	if err := cfg.SetWorkers(0); err == nil {
+		t.Error("expected an error for 0 workers")
+	}
+	cfg.Replay.CookieJar = true
+	if err := cfg.SetWorkers(2); err == nil || !strings.Contains(err.Error(), "replay.cookie_jar") {
+		t.Errorf("expected a replay.cookie_jar error, got %v", err)
+	}
+}
+
+func TestLoad_Retry(t *testing.T) {
+	load := func(replay string) (*Config, error) {
+		content := "service: {name: api, base_url: \"http://localhost:3000\"}\n" +
+			"database: {type: \"sqlite\", connection_string: \"a.db\"}\n" + replay
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(path)
+	}
+
+	cfg, err := load("replay: {retry: {attempts: 3}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Replay.Retry.DelayMs != defaultRetryDelayMs {
+		t.Errorf("expected the default retry delay, got %d", cfg.Replay.Retry.DelayMs)
+	}
+	if _, err := load("replay: {retry: {attempts: -1}}\n"); err == nil || !strings.Contains(err.Error(), "replay.retry.attempts") {
+		t.Errorf("expected a replay.retry.attempts error, got %v", err)
+	}
+}
+
+func TestLoad_Matchers(t *testing.T) {
+	load := func(replay string) (*Config, error) {
+		content := "service: {name: api, base_url: \"http://localhost:3000\"}\n" +
+			"database: {type: \"sqlite\", connection_string: \"a.db\"}\n" + replay
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(path)
+	}
+
+	cfg, err := load("replay: {matchers: {\"response.body.id\": __UUID__}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Replay.Matchers["response.body.id"] != "__UUID__" {
+		t.Errorf("unexpected matchers %v", cfg.Replay.Matchers)
+	}
+	if _, err := load("replay: {matchers: {\"response.body.id\": __UUIDS__}}\n"); err == nil || !strings.Contains(err.Error(), "unknown matcher") {
+		t.Errorf("expected an unknown matcher error, got %v", err)
+	}
+
+	if err := cfg.AddMatcher("*.created_at", "__ISO_DATE__"); err != nil || len(cfg.Replay.Matchers) != 2 {
+		t.Errorf("expected a second matcher, got %v (err %v)", cfg.Replay.Matchers, err)
+	}
+	if err := cfg.AddMatcher("", "__ANY__"); err == nil {
+		t.Error("expected an error for an empty path")
+	}
+}
+
+func TestLoad_MockAddress(t *testing.T) {
+	load := func(replay string) error {
+		content := "service: {name: api, base_url: \"http://localhost:3000\"}\n" +
+			"database: {type: \"sqlite\", connection_string: \"a.db\"}\n" + replay
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		return err
+	}
+
+	if err := load("replay: {mock_address: \"127.0.0.1:9090\"}\n"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := load("replay: {mock_address: \"9090\"}\n"); err == nil || !strings.Contains(err.Error(), "replay.mock_address") {
+		t.Errorf("expected a replay.mock_address error, got %v", err)
+	}
+	if err := load("replay: {mock_address: \"127.0.0.1:9090\", parallel: true}\n"); err == nil || !strings.Contains(err.Error(), "sequential replay") {
+		t.Errorf("expected a sequential replay error, got %v", err)
+	}
+
+	auth := "auth: {tokens: [{token: secret, role: read}]}\n"
+	for _, addr := range []string{"127.0.0.1:9090", "localhost:9090", "[::1]:9090"} {
+		if err := load(auth + "replay: {mock_address: \"" + addr + "\"}\n"); err != nil {
+			t.Errorf("%s: unexpected error with auth tokens: %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"0.0.0.0:9090", ":9090", "10.0.0.5:9090"} {
+		if err := load(auth + "replay: {mock_address: \"" + addr + "\"}\n"); err == nil || !strings.Contains(err.Error(), "must be a loopback address") {
+			t.Errorf("%s: expected a loopback error with auth tokens, got %v", addr, err)
+		}
+	}
+}
+
+func TestLoad_ExitPolicy(t *testing.T) {
+	load := func(replay string) (*Config, error) {
+		content := "service: {name: api, base_url: \"http://localhost:3000\"}\n" +
+			"database: {type: \"sqlite\", connection_string: \"a.db\"}\n" + replay
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(path)
+	}
+
+	cfg, err := load("replay: {strict_mode: true, exit_policy: {max_failures: 5, max_failure_rate: 0.02, max_errors: 0}}\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := cfg.Replay.ExitPolicy
+	if p.MaxFailures == nil || *p.MaxFailures != 5 || p.MaxFailureRate == nil || *p.MaxFailureRate != 0.02 || p.MaxErrors == nil || *p.MaxErrors != 0 || p.MaxErrorRate != nil {
+		t.Errorf("unexpected exit policy: %+v", p)
+	}
+
+	for replay, want := range map[string]string{
+		"replay: {exit_policy: {max_failures: 5}}\n":                                     "without replay.strict_mode",
+		"replay: {strict_mode: true, exit_policy: {max_errors: -1}}\n":                   "replay.exit_policy.max_errors must not be negative",
+		"replay: {strict_mode: true, exit_policy: {max_failure_rate: 2}}\n":              "replay.exit_policy.max_failure_rate must be between 0 and 1",
+		"replay: {strict_mode: true, exit_policy: {max_error_rate: -0.1}}\n":             "replay.exit_policy.max_error_rate must be between 0 and 1",
+		"replay: {strict_mode: true, fail_fast: true, exit_policy: {max_failures: 5}}\n": "cannot be combined with replay.fail_fast",
+	} {
+		if _, err := load(replay); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", strings.TrimSpace(replay), want, err)
+		}
+	}
+
+	if err := cfg.SetFailFast(); err == nil || !strings.Contains(err.Error(), "replay.fail_fast") {
+		t.Errorf("expected --fail-fast to be rejected with an exit policy, got %v", err)
+	}
+}
+
+func TestSetAssert(t *testing.T) {
+	cfg := &Config{}
+	for _, scope := range []string{"all", "response", "db", "diff"} {
+		if err := cfg.SetAssert(scope); err != nil || cfg.Replay.Assert != scope {
+			t.Errorf("SetAssert(%q): unexpected error %v", scope, err)
+		}
+	}
+	if err := cfg.SetAssert("headers"); err == nil || !strings.Contains(err.Error(), "replay.assert must be all, response, db or diff") {
+		t.Errorf("expected an invalid scope error, got %v", err)
+	}
+}
+
+func TestLoad_Variables(t *testing.T) {
+	dir := t.TempDir()
+	valuesPath := filepath.Join(dir, "acme.yml")
+	if err := os.WriteFile(valuesPath, []byte("tenant: acme\nuser_id: 42\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_REGION", "eu")
+	content := "service: {name: api, base_url: \"http://localhost:3000\"}\n" +
+		"database: {type: \"sqlite\", connection_string: \"a.db\"}\n" +
+		"replay: {variables: {tenant: default, region: \"${TEST_REGION}\"}, variables_file: \"" + valuesPath + "\"}\n"
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"tenant": "acme", "user_id": 42, "region": "eu"}
+	if !reflect.DeepEqual(cfg.Replay.Variables, want) {
+		t.Errorf("expected variables %v, got %v", want, cfg.Replay.Variables)
+	}
+
+	if err := cfg.SetVariable("tenant", "globex"); err != nil || cfg.Replay.Variables["tenant"] != "globex" {
+		t.Errorf("SetVariable: unexpected error %v, variables %v", err, cfg.Replay.Variables)
+	}
+	if err := cfg.SetVariable("user id", "1"); err == nil {
+		t.Error("expected an invalid variable name error")
+	}
+	if err := cfg.LoadVariables(filepath.Join(dir, "missing.yml")); err == nil || !strings.Contains(err.Error(), "reading variables file") {
+		t.Errorf("expected a read error, got %v", err)
+	}
+}
+
+func TestLoad_Clock(t *testing.T) {
+	load := func(service, replay string) (*Config, error) {
+		content := "service: {name: api, base_url: \"http://localhost:3000\"" + service + "}\n" +
+			"database: {type: \"sqlite\", connection_string: \"a.db\"}\n" + replay
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(path)
+	}
+
+	cfg, err := load(", command: ./bin/api", "replay: {clock: {header: X-Fake-Now, env_var: FAKE_NOW, faketime: true}}\n")
+	if lib := defaultFaketimeLibs[runtime.GOOS+"/"+runtime.GOARCH]; lib == "" {
+		if err == nil || !strings.Contains(err.Error(), "replay.clock.faketime_lib must be set") {
+			t.Errorf("expected faketime_lib to be required without a default, got %v", err)
+		}
+	} else if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if cfg.Replay.Clock.FaketimeLib != lib {
+		t.Errorf("expected the default libfaketime path %q, got %q", lib, cfg.Replay.Clock.FaketimeLib)
+	}
+	if cfg, err := load(", command: ./bin/api", "replay: {clock: {faketime: true, faketime_lib: /opt/libfaketime.so}}\n"); err != nil || cfg.Replay.Clock.FaketimeLib != "/opt/libfaketime.so" {
+		t.Errorf("expected faketime_lib to be kept, got error %v", err)
+	}
+	if _, err := load("", "replay: {clock: {header: X-Fake-Now, format: unix_ms}}\n"); err != nil {
+		t.Errorf("expected a header without a managed service to be accepted, got %v", err)
+	}
+
+	for _, tt := range []struct {
+		service, replay, want string
+	}{
+		{"", "replay: {clock: {header: X-Fake-Now, format: iso}}\n", "replay.clock.format must be rfc3339, unix or unix_ms"},
+		{"", "replay: {clock: {env_var: FAKE_NOW}}\n", "need service.command"},
+		{", command: ./bin/api, restart: run", "replay: {clock: {faketime: true}}\n", "not service.restart: run"},
+	} {
+		if _, err := load(tt.service, tt.replay); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q, got %v", strings.TrimSpace(tt.replay), tt.want, err)
+		}
+	}
+}
+
+func TestLoad_Provision(t *testing.T) {
+	load := func(database, replay string) error {
+		content := "service: {name: api, base_url: \"http://localhost:3000\"}\n" + database + replay
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		return err
+	}
+	postgres := "database: {type: postgres, connection_string: \"postgres://localhost/app\"}\n"
+
+	if err := load(postgres, "replay: {test_database: {provision: docker, image: \"postgres:15\", schema: schema.sql}}\n"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		database, replay, want string
+	}{
+		{postgres, "replay: {test_database: {provision: podman}}\n", "provision must be docker"},
+		{"database: {type: sqlite, connection_string: a.db}\n", "replay: {test_database: {provision: docker}}\n", "requires a postgres or mysql database"},
+		{postgres, "replay: {test_database: {provision: docker, connection_string: \"postgres://localhost/test\"}}\n", "cannot be combined with provision"},
+		{postgres, "replay: {test_database: {schema: schema.sql}}\n", "need replay.test_database.provision"},
+	} {
+		if err := load(tt.database, tt.replay); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q, got %v", strings.TrimSpace(tt.replay), tt.want, err)
+		}
+	}
+}
+
+func TestLoad_TagRuleHeaderPatterns(t *testing.T) {
+	content := "service: {name: api, base_url: \"http://localhost:3000\"}\n" +
+		"database: {type: \"sqlite\", connection_string: \"a.db\"}\n" +
+		"recording: {tag_rules: [{headers: {User-Agent: \"Mobile*/ios\", X-Tenant: acme}, tags: [mobile]}]}\n"
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	rule := &cfg.Recording.TagRules[0]
+	if _, ok := rule.headerPatterns["User-Agent"]; !ok {
+		t.Error("expected the wildcard header pattern to be compiled at load")
+	}
+	if _, ok := rule.headerPatterns["X-Tenant"]; ok {
+		t.Error("expected a literal header value not to be compiled")
+	}
+
+	for _, tt := range []struct {
+		name, value string
+		want        bool
+	}{
+		{"User-Agent", "MobileApp/2.1/ios", true},
+		{"User-Agent", "MobileApp/2.1/android", false},
+		{"X-Tenant", "acme", true},
+		{"X-Tenant", "acme-eu", false},
+	} {
+		if got := rule.MatchesHeader(tt.name, tt.value); got != tt.want {
+			t.Errorf("MatchesHeader(%q, %q) = %v, want %v", tt.name, tt.value, got, tt.want)
+		}
+	}
+
+	built := TagRule{Headers: map[string]string{"User-Agent": "curl/*"}, Tags: []string{"cli"}}
+	if !built.MatchesHeader("User-Agent", "curl/8.4") {
+		t.Error("expected a rule built in code to match without being loaded")
+	}
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// binaryColumnTypes are the database type names, as reported by the
+// drivers, of columns holding raw bytes.
+var binaryColumnTypes = map[string]bool{
+	"BYTEA":      true, // postgres
+	"BLOB":       true, // mysql, sqlite
+	"TINYBLOB":   true,
+	"MEDIUMBLOB": true,
+	"LONGBLOB":   true,
+	"BINARY":     true, // mysql, mssql
+	"VARBINARY":  true,
+	"GEOMETRY":   true, // mysql stores geometries in a binary format
+	"IMAGE":      true, // mssql
+}
+
+// isBinaryColumn reports whether a []byte value read from column holds raw
+// bytes rather than text the driver did not convert.
+func (b *baseSnapshotter) isBinaryColumn(column *sql.ColumnType) bool {
+	// SQLite returns TEXT values as strings, so any []byte is a BLOB
+	if b.dbType == DBTypeSQLite {
+		return true
+	}
+	return column != nil && binaryColumnTypes[strings.ToUpper(column.DatabaseTypeName())]
+}
+
+// encodeBinary stores raw bytes the way binary bodies are stored, as
+// base64 data with its encoding, so non-UTF-8 values survive the snapshot
+// file. It is a plain map so a value read from the database compares equal
+// to the same value loaded from a snapshot.
+func encodeBinary(raw []byte) map[string]any {
+	return map[string]any{
+		"data":     base64.StdEncoding.EncodeToString(raw),
+		"encoding": snapshot.BodyEncodingBase64,
+	}
+}
+
+// decodeBinary returns the bytes of a value written by encodeBinary.
+func decodeBinary(val any) ([]byte, bool, error) {
+	m, ok := val.(map[string]any)
+	if !ok || len(m) != 2 || m["encoding"] != snapshot.BodyEncodingBase64 {
+		return nil, false, nil
+	}
+	data, ok := m["data"].(string)
+	if !ok {
+		return nil, false, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, true, err
+	}
+	return raw, true, nil
+}
+
+// decodeBinaryRows returns rows with base64-encoded binary values turned
+// back into bytes for restoring. Plain strings in the binary columns given,
+// the way snapshots recorded before binary columns were encoded hold them,
+// are restored as their bytes too. Rows without such values are shared with
+// the input, which is never modified.
+func decodeBinaryRows(table string, rows []map[string]any, binary map[string]bool) ([]map[string]any, error) {
+	var out []map[string]any
+	for i, row := range rows {
+		var decoded map[string]any
+		for col, val := range row {
+			raw, ok, err := decodeBinary(val)
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s.%s: %w", table, col, err)
+			}
+			if s, legacy := val.(string); legacy && binary[col] {
+				raw, ok = []byte(s), true
+			}
+			if !ok {
+				continue
+			}
+			if decoded == nil {
+				decoded = make(map[string]any, len(row))
+				for k, v := range row {
+					decoded[k] = v
+				}
+			}
+			decoded[col] = raw
+		}
+		if decoded != nil && out == nil {
+			out = make([]map[string]any, len(rows))
+			copy(out, rows)
+		}
+		if decoded != nil {
+			out[i] = decoded
+		}
+	}
+	if out == nil {
+		return rows, nil
+	}
+	return out, nil
+}
+
+// binaryColumns returns the binary columns of table, for restoring rows
+// recorded before binary columns were encoded. SQLite reads text back as
+// text whatever the column's type, so it needs none.
+func (b *baseSnapshotter) binaryColumns(table string, rows []map[string]any) (map[string]bool, error) {
+	if b.dbType == DBTypeSQLite || !hasStrings(rows) {
+		return nil, nil
+	}
+	b.binaryMu.Lock()
+	defer b.binaryMu.Unlock()
+	if cols, ok := b.binaryCols[table]; ok {
+		return cols, nil
+	}
+
+	result, err := b.db.Query("SELECT * FROM " + b.quoteIdentifier(table) + " WHERE 1 = 0")
+	if err != nil {
+		return nil, fmt.Errorf("reading columns of %s: %w", table, err)
+	}
+	defer result.Close()
+	columnTypes, err := result.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("reading columns of %s: %w", table, err)
+	}
+	cols := make(map[string]bool)
+	for _, ct := range columnTypes {
+		if b.isBinaryColumn(ct) {
+			cols[ct.Name()] = true
+		}
+	}
+	if b.binaryCols == nil {
+		b.binaryCols = make(map[string]map[string]bool)
+	}
+	b.binaryCols[table] = cols
+	return cols, nil
+}
+
+func hasStrings(rows []map[string]any) bool {
+	for _, row := range rows {
+		for _, val := range row {
+			if _, ok := val.(string); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LegacyBinaryState returns actual with the values of binary columns that
+// expected holds as plain strings turned back into such strings, the way
+// snapshots recorded before binary columns were base64-encoded stored them,
+// so those snapshots keep comparing equal without being re-recorded. actual
+// is not modified.
+func LegacyBinaryState(expected, actual map[string][]map[string]any) map[string][]map[string]any {
+	var out map[string][]map[string]any
+	for table, rows := range actual {
+		legacy := legacyBinaryColumns(expected[table], rows)
+		if len(legacy) == 0 {
+			continue
+		}
+		converted := make([]map[string]any, len(rows))
+		for i, row := range rows {
+			converted[i] = make(map[string]any, len(row))
+			for col, val := range row {
+				if raw, ok, err := decodeBinary(val); ok && err == nil && legacy[col] {
+					val = legacyString(raw)
+				}
+				converted[i][col] = val
+			}
+		}
+		if out == nil {
+			out = make(map[string][]map[string]any, len(actual))
+			for t, r := range actual {
+				out[t] = r
+			}
+		}
+		out[table] = converted
+	}
+	if out == nil {
+		return actual
+	}
+	return out
+}
+
+// legacyBinaryColumns returns the columns holding strings in expected and
+// encoded binary values in actual.
+func legacyBinaryColumns(expected, actual []map[string]any) map[string]bool {
+	strs := make(map[string]bool)
+	for _, row := range expected {
+		for col, val := range row {
+			if _, ok := val.(string); ok {
+				strs[col] = true
+			}
+		}
+	}
+	var legacy map[string]bool
+	for _, row := range actual {
+		for col, val := range row {
+			if _, ok, _ := decodeBinary(val); ok && strs[col] {
+				if legacy == nil {
+					legacy = make(map[string]bool)
+				}
+				legacy[col] = true
+			}
+		}
+	}
+	return legacy
+}
+
+// legacyString returns raw as older snapshots hold it: converted to a string
+// and written to JSON, which replaces invalid UTF-8.
+func legacyString(raw []byte) string {
+	data, err := json.Marshal(string(raw))
+	if err != nil {
+		return string(raw)
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return string(raw)
+	}
+	return s
+}
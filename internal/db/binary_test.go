@@ -0,0 +1,132 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSQLiteSnapshotter_BinaryRoundTrip(t *testing.T) {
+	dbPath := setupTestDB(t)
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	avatar := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe}
+	if _, err := conn.Exec("CREATE TABLE files (id INTEGER PRIMARY KEY, name TEXT, content BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("INSERT INTO files VALUES (1, 'logo.png', ?)", avatar); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSnapshotter(DBTypeSQLite, dbPath, []string{"files"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	state, err := s.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := state["files"][0]
+	if row["name"] != "logo.png" {
+		t.Errorf("expected text columns to stay strings, got %#v", row["name"])
+	}
+	want := map[string]any{"data": "iVBORwD//g==", "encoding": "base64"}
+	if !reflect.DeepEqual(row["content"], want) {
+		t.Fatalf("content = %#v, want %#v", row["content"], want)
+	}
+
+	// Round-trip through JSON like a snapshot file
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded map[string][]map[string]any
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Exec("UPDATE files SET content = x'00'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RestoreAll(loaded); err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	if err := conn.QueryRow("SELECT content FROM files WHERE id = 1").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, avatar) {
+		t.Errorf("restored content = %x, want %x", got, avatar)
+	}
+
+	after, err := s.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after["files"][0]["content"], loaded["files"][0]["content"]) {
+		t.Errorf("expected the value read back to equal the loaded one, got %#v", after["files"][0]["content"])
+	}
+}
+
+func TestDecodeBinaryRows(t *testing.T) {
+	rows := []map[string]any{
+		{"id": 1, "content": map[string]any{"data": "AAE=", "encoding": "base64"}},
+		{"id": 2, "meta": map[string]any{"data": "AAE=", "encoding": "base64", "extra": true}},
+		{"id": 3, "content": "legacy", "name": "a.txt"},
+	}
+	out, err := decodeBinaryRows("files", rows, map[string]bool{"content": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := out[0]["content"].([]byte); !ok || !bytes.Equal(got, []byte{0, 1}) {
+		t.Errorf("expected decoded bytes, got %#v", out[0]["content"])
+	}
+	if _, ok := rows[0]["content"].(map[string]any); !ok {
+		t.Error("expected the input rows to be left unchanged")
+	}
+	if _, ok := out[1]["meta"].(map[string]any); !ok {
+		t.Errorf("expected other objects to be left alone, got %#v", out[1]["meta"])
+	}
+	if got, ok := out[2]["content"].([]byte); !ok || string(got) != "legacy" {
+		t.Errorf("expected a legacy string in a binary column restored as bytes, got %#v", out[2]["content"])
+	}
+	if out[2]["name"] != "a.txt" {
+		t.Errorf("expected strings in other columns left alone, got %#v", out[2]["name"])
+	}
+
+	if _, err := decodeBinaryRows("files", []map[string]any{{"content": map[string]any{"data": "!", "encoding": "base64"}}}, nil); err == nil {
+		t.Error("expected an error for invalid base64")
+	}
+}
+
+func TestLegacyBinaryState(t *testing.T) {
+	expected := map[string][]map[string]any{
+		"files": {{"id": 1.0, "content": "hello"}},
+		"blobs": {{"id": 1.0, "content": map[string]any{"data": "aGk=", "encoding": "base64"}}},
+	}
+	actual := map[string][]map[string]any{
+		"files": {{"id": 1.0, "content": encodeBinary([]byte("hello"))}},
+		"blobs": {{"id": 1.0, "content": encodeBinary([]byte("hi"))}},
+	}
+
+	got := LegacyBinaryState(expected, actual)
+	if got["files"][0]["content"] != "hello" {
+		t.Errorf("expected the legacy column compared as a string, got %#v", got["files"][0]["content"])
+	}
+	if !reflect.DeepEqual(got["blobs"], actual["blobs"]) {
+		t.Errorf("expected encoded snapshots compared as recorded, got %#v", got["blobs"])
+	}
+	if _, ok := actual["files"][0]["content"].(map[string]any); !ok {
+		t.Error("expected actual to be left unchanged")
+	}
+	if legacyString([]byte{0xff, 'a'}) != "\ufffda" {
+		t.Errorf("expected invalid UTF-8 replaced as in older snapshots, got %q", legacyString([]byte{0xff, 'a'}))
+	}
+}
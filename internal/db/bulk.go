@@ -0,0 +1,169 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Restore modes, selecting how RestoreTable writes rows.
+const (
+	RestoreModeInsert = "insert" // one INSERT per row (default)
+	RestoreModeBulk   = "bulk"   // COPY on Postgres, multi-row INSERTs elsewhere
+)
+
+// Bind parameter limits per statement. SQL Server also caps a VALUES list at
+// 1000 rows.
+const (
+	maxParamsMySQL  = 65535
+	maxParamsSQLite = 32766
+	maxParamsMSSQL  = 2099
+	maxRowsMSSQL    = 1000
+)
+
+// rowGroup is a run of rows with the same columns, as positional values.
+type rowGroup struct {
+	columns []string
+	values  [][]any
+}
+
+// groupByColumns groups rows by their column sets, in order of first
+// appearance, so each group can be written with one column list. Rows
+// without columns are skipped.
+func groupByColumns(rows []map[string]any) []*rowGroup {
+	var groups []*rowGroup
+	byColumns := make(map[string]*rowGroup)
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		columns := sortedKeys(row)
+		signature := strings.Join(columns, "\x00")
+		g, ok := byColumns[signature]
+		if !ok {
+			g = &rowGroup{columns: columns}
+			byColumns[signature] = g
+			groups = append(groups, g)
+		}
+		values := make([]any, len(columns))
+		for i, col := range columns {
+			values[i] = row[col]
+		}
+		g.values = append(g.values, values)
+	}
+	return groups
+}
+
+// insertRows inserts rows one at a time, or in multi-row batches in bulk
+// mode.
+func (b *baseSnapshotter) insertRows(db execer, table string, rows []map[string]any) error {
+	if b.restoreMode != RestoreModeBulk {
+		for _, row := range rows {
+			if err := b.insertRow(db, table, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, g := range groupByColumns(rows) {
+		batchSize := b.batchSize(len(g.columns))
+		for start := 0; start < len(g.values); start += batchSize {
+			end := min(start+batchSize, len(g.values))
+			if err := b.insertBatch(db, table, g.columns, g.values[start:end]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// batchSize returns how many rows of the given width fit in one statement.
+func (b *baseSnapshotter) batchSize(columns int) int {
+	switch b.dbType {
+	case DBTypeMySQL:
+		return max(1, maxParamsMySQL/columns)
+	case DBTypeMSSQL:
+		return max(1, min(maxRowsMSSQL, maxParamsMSSQL/columns))
+	default:
+		return max(1, maxParamsSQLite/columns)
+	}
+}
+
+// insertBatch inserts rows sharing the same columns with one parameterized
+// INSERT ... VALUES (...), (...) statement.
+func (b *baseSnapshotter) insertBatch(db execer, table string, columns []string, rows [][]any) error {
+	quotedColumns := make([]string, len(columns))
+	for i, col := range columns {
+		quotedColumns[i] = b.quoteIdentifier(col)
+	}
+
+	tuples := make([]string, len(rows))
+	args := make([]any, 0, len(rows)*len(columns))
+	placeholders := make([]string, len(columns))
+	for r, values := range rows {
+		for i := range columns {
+			placeholders[i] = b.placeholder(len(args) + i)
+		}
+		tuples[r] = "(" + strings.Join(placeholders, ", ") + ")"
+		args = append(args, values...)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+		b.quoteIdentifier(table),
+		strings.Join(quotedColumns, ", "),
+		strings.Join(tuples, ", "))
+	if _, err := db.Exec(query, args...); err != nil {
+		return fmt.Errorf("inserting into %s: %w", table, err)
+	}
+	return nil
+}
+
+// copyPostgresTable replaces a table's rows using COPY FROM STDIN, in one
+// transaction. COPY runs on the transaction's connection, so foreign key
+// triggers are disabled there too rather than relying on the session
+// setting from RestoreAll.
+func (b *baseSnapshotter) copyPostgresTable(table string, rows []map[string]any) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SET LOCAL session_replication_role = 'replica'"); err != nil {
+		return fmt.Errorf("disabling FK checks: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM " + b.quoteIdentifier(table) + b.where(table)); err != nil {
+		return fmt.Errorf("truncating table %s: %w", table, err)
+	}
+
+	schema, name := splitQualifiedName(table)
+	for _, g := range groupByColumns(rows) {
+		var query string
+		if schema != "" {
+			query = pq.CopyInSchema(schema, name, g.columns...)
+		} else {
+			query = pq.CopyIn(name, g.columns...)
+		}
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return fmt.Errorf("copying into %s: %w", table, err)
+		}
+		for _, values := range g.values {
+			if _, err := stmt.Exec(values...); err != nil {
+				stmt.Close()
+				return fmt.Errorf("copying into %s: %w", table, err)
+			}
+		}
+		// The final Exec without arguments flushes the buffered rows
+		if _, err := stmt.Exec(); err != nil {
+			stmt.Close()
+			return fmt.Errorf("copying into %s: %w", table, err)
+		}
+		if err := stmt.Close(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
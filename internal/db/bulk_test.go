@@ -0,0 +1,72 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGroupByColumns(t *testing.T) {
+	rows := []map[string]any{
+		{"id": 1, "name": "a"},
+		{"id": 2},
+		{},
+		{"name": "c", "id": 3},
+	}
+	groups := groupByColumns(rows)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	if !reflect.DeepEqual(groups[0].columns, []string{"id", "name"}) ||
+		!reflect.DeepEqual(groups[0].values, [][]any{{1, "a"}, {3, "c"}}) {
+		t.Errorf("unexpected first group: %+v", groups[0])
+	}
+	if !reflect.DeepEqual(groups[1].columns, []string{"id"}) || len(groups[1].values) != 1 {
+		t.Errorf("unexpected second group: %+v", groups[1])
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	mssql := &baseSnapshotter{dbType: DBTypeMSSQL}
+	if got := mssql.batchSize(1); got != maxRowsMSSQL {
+		t.Errorf("expected SQL Server batches to be capped at %d rows, got %d", maxRowsMSSQL, got)
+	}
+	if got := mssql.batchSize(3000); got != 1 {
+		t.Errorf("expected at least one row per batch, got %d", got)
+	}
+}
+
+func TestSQLiteSnapshotter_BulkRestore(t *testing.T) {
+	dbPath := setupTestDB(t)
+	snap, err := Open([]Target{{
+		Type:        DBTypeSQLite,
+		ConnString:  dbPath,
+		Tables:      []string{"users"},
+		RestoreMode: RestoreModeBulk,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	// Enough rows for several statements, plus rows with a different column set
+	var rows []map[string]any
+	for i := 1; i <= 25000; i++ {
+		rows = append(rows, map[string]any{"id": int64(i), "name": fmt.Sprintf("user%d", i), "email": nil})
+	}
+	rows = append(rows, map[string]any{"id": int64(25001), "name": "no email"})
+	if err := snap.RestoreTable("users", rows); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := snap.SnapshotTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != len(rows) {
+		t.Fatalf("expected %d rows, got %d", len(rows), len(restored))
+	}
+	if last := restored[len(restored)-1]; last["name"] != "no email" || last["email"] != nil {
+		t.Errorf("unexpected last row: %v", last)
+	}
+}
@@ -0,0 +1,286 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// changeLogTable receives one row per changed database row while change
+// tracking is installed. It is never snapshotted itself.
+const changeLogTable = "_snapshot_tester_changes"
+
+// changeTriggerPrefix starts the names of the triggers (and the Postgres
+// trigger function) that write to changeLogTable.
+const changeTriggerPrefix = "_snapshot_tester_"
+
+// rowChange is one entry of the change log: the table and the primary key
+// of a changed row. key is nil for tables without a primary key.
+type rowChange struct {
+	table string
+	key   []any
+}
+
+// withoutChangeLog drops the change log table from discovered tables.
+func withoutChangeLog(tables []string) []string {
+	kept := tables[:0:0]
+	for _, table := range tables {
+		if _, name := splitQualifiedName(table); name != changeLogTable {
+			kept = append(kept, table)
+		}
+	}
+	return kept
+}
+
+// primaryKey returns the primary key columns of table in key order, or nil
+// if it has none.
+func (b *baseSnapshotter) primaryKey(table string) ([]string, error) {
+	switch b.dbType {
+	case DBTypePostgres:
+		return b.queryStrings(`SELECT a.attname
+			FROM pg_index i
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+			WHERE i.indrelid = $1::regclass AND i.indisprimary
+			ORDER BY array_position(i.indkey::int2[], a.attnum)`, b.quoteIdentifier(table))
+	case DBTypeMySQL:
+		schema, name := splitQualifiedName(table)
+		return b.queryStrings(`SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE
+			WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'
+			ORDER BY ORDINAL_POSITION`, schema, name)
+	case DBTypeSQLite:
+		return b.queryStrings("SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk", table)
+	}
+	return nil, fmt.Errorf("%s does not support incremental capture", b.dbType)
+}
+
+// changeObject returns the quoted name of a change tracking object (the log
+// table or trigger function), qualified with the schema it lives in so
+// triggers on tables in other schemas find it.
+func (b *baseSnapshotter) changeObject(name string) string {
+	if b.changeSchema == "" {
+		return b.quoteSingleIdentifier(name)
+	}
+	return b.quoteSingleIdentifier(b.changeSchema) + "." + b.quoteSingleIdentifier(name)
+}
+
+// installChangeTracking creates the change log table and a trigger on each
+// table that logs the primary key of every inserted, updated or deleted
+// row. Leftovers from an earlier run that did not shut down cleanly are
+// removed first.
+func (b *baseSnapshotter) installChangeTracking(tables []string, keys map[string][]string) error {
+	var err error
+	switch b.dbType {
+	case DBTypePostgres:
+		err = b.db.QueryRow("SELECT current_schema()").Scan(&b.changeSchema)
+	case DBTypeMySQL:
+		err = b.db.QueryRow("SELECT DATABASE()").Scan(&b.changeSchema)
+	}
+	if err != nil {
+		return fmt.Errorf("looking up current schema: %w", err)
+	}
+	if err := b.removeChangeTracking(tables); err != nil {
+		return err
+	}
+	logTable := b.changeObject(changeLogTable)
+	logFunction := b.changeObject(changeTriggerPrefix + "log")
+
+	var statements []string
+	switch b.dbType {
+	case DBTypePostgres:
+		statements = append(statements,
+			"CREATE TABLE "+logTable+" (id BIGSERIAL PRIMARY KEY, table_name TEXT NOT NULL, row_key TEXT)",
+			// Logs OLD and/or NEW; trigger arguments are the table name followed
+			// by its primary key columns
+			`CREATE FUNCTION `+logFunction+`() RETURNS trigger LANGUAGE plpgsql AS $$
+			DECLARE
+				r jsonb;
+				k jsonb;
+			BEGIN
+				FOREACH r IN ARRAY ARRAY[
+					CASE WHEN TG_OP <> 'INSERT' THEN to_jsonb(OLD) END,
+					CASE WHEN TG_OP <> 'DELETE' THEN to_jsonb(NEW) END
+				] LOOP
+					CONTINUE WHEN r IS NULL;
+					k := NULL;
+					IF TG_NARGS > 1 THEN
+						k := '[]'::jsonb;
+						FOR i IN 1 .. TG_NARGS - 1 LOOP
+							k := k || jsonb_build_array(r -> TG_ARGV[i]);
+						END LOOP;
+					END IF;
+					INSERT INTO `+logTable+` (table_name, row_key) VALUES (TG_ARGV[0], k::text);
+				END LOOP;
+				RETURN NULL;
+			END $$`)
+		for _, table := range tables {
+			args := []string{sqlLiteral(table)}
+			for _, col := range keys[table] {
+				args = append(args, sqlLiteral(col))
+			}
+			statements = append(statements, fmt.Sprintf(
+				"CREATE TRIGGER %s AFTER INSERT OR UPDATE OR DELETE ON %s FOR EACH ROW EXECUTE FUNCTION %s(%s)",
+				changeLogTable, b.quoteIdentifier(table), logFunction, strings.Join(args, ", ")))
+		}
+	case DBTypeMySQL, DBTypeSQLite:
+		if b.dbType == DBTypeMySQL {
+			statements = append(statements, "CREATE TABLE "+logTable+" (id BIGINT AUTO_INCREMENT PRIMARY KEY, table_name VARCHAR(255) NOT NULL, row_key TEXT)")
+		} else {
+			statements = append(statements, "CREATE TABLE "+logTable+" (id INTEGER PRIMARY KEY AUTOINCREMENT, table_name TEXT NOT NULL, row_key TEXT)")
+		}
+		for _, table := range tables {
+			for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+				var tuples []string
+				if event != "INSERT" {
+					tuples = append(tuples, b.changeLogTuple(table, "OLD", keys[table]))
+				}
+				if event != "DELETE" {
+					tuples = append(tuples, b.changeLogTuple(table, "NEW", keys[table]))
+				}
+				insert := fmt.Sprintf("INSERT INTO %s (table_name, row_key) VALUES %s", logTable, strings.Join(tuples, ", "))
+				if b.dbType == DBTypeSQLite {
+					insert = "BEGIN " + insert + "; END"
+				}
+				statements = append(statements, fmt.Sprintf("CREATE TRIGGER %s AFTER %s ON %s FOR EACH ROW %s",
+					b.changeTrigger(table, event), event, b.quoteIdentifier(table), insert))
+			}
+		}
+	default:
+		return fmt.Errorf("%s does not support incremental capture", b.dbType)
+	}
+
+	for _, stmt := range statements {
+		if _, err := b.db.Exec(stmt); err != nil {
+			b.removeChangeTracking(tables)
+			return fmt.Errorf("installing change tracking: %w", err)
+		}
+	}
+	return nil
+}
+
+// changeLogTuple returns the VALUES tuple logging the OLD or NEW row of a
+// MySQL or SQLite trigger.
+func (b *baseSnapshotter) changeLogTuple(table, row string, key []string) string {
+	keyExpr := "NULL"
+	if len(key) > 0 {
+		cols := make([]string, len(key))
+		for i, col := range key {
+			cols[i] = row + "." + b.quoteSingleIdentifier(col)
+		}
+		fn := "json_array"
+		if b.dbType == DBTypeMySQL {
+			fn = "JSON_ARRAY"
+		}
+		keyExpr = fn + "(" + strings.Join(cols, ", ") + ")"
+	}
+	return "(" + sqlLiteral(table) + ", " + keyExpr + ")"
+}
+
+// changeTrigger returns the quoted name of the MySQL or SQLite trigger for
+// one event on one table. MySQL triggers live in their table's schema.
+func (b *baseSnapshotter) changeTrigger(table, event string) string {
+	schema, name := splitQualifiedName(table)
+	trigger := b.quoteSingleIdentifier(changeTriggerPrefix + name + "_" + strings.ToLower(event))
+	if schema != "" {
+		return b.quoteSingleIdentifier(schema) + "." + trigger
+	}
+	return trigger
+}
+
+// removeChangeTracking drops the triggers, trigger function and change log
+// table, ignoring the ones that do not exist.
+func (b *baseSnapshotter) removeChangeTracking(tables []string) error {
+	var statements []string
+	for _, table := range tables {
+		switch b.dbType {
+		case DBTypePostgres:
+			statements = append(statements, "DROP TRIGGER IF EXISTS "+changeLogTable+" ON "+b.quoteIdentifier(table))
+		default:
+			for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+				statements = append(statements, "DROP TRIGGER IF EXISTS "+b.changeTrigger(table, event))
+			}
+		}
+	}
+	if b.dbType == DBTypePostgres {
+		statements = append(statements, "DROP FUNCTION IF EXISTS "+b.changeObject(changeTriggerPrefix+"log")+"()")
+	}
+	statements = append(statements, "DROP TABLE IF EXISTS "+b.changeObject(changeLogTable))
+
+	for _, stmt := range statements {
+		if _, err := b.db.Exec(stmt); err != nil {
+			return fmt.Errorf("removing change tracking: %w", err)
+		}
+	}
+	return nil
+}
+
+// drainChanges returns and deletes the logged changes, oldest first.
+func (b *baseSnapshotter) drainChanges() ([]rowChange, error) {
+	logTable := b.changeObject(changeLogTable)
+	rows, err := b.db.Query("SELECT id, table_name, row_key FROM " + logTable + " ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("reading change log: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []rowChange
+	var lastID int64
+	for rows.Next() {
+		var table string
+		var key *string
+		if err := rows.Scan(&lastID, &table, &key); err != nil {
+			return nil, err
+		}
+		c := rowChange{table: table}
+		if key != nil {
+			dec := json.NewDecoder(strings.NewReader(*key))
+			dec.UseNumber()
+			if err := dec.Decode(&c.key); err != nil {
+				return nil, fmt.Errorf("decoding change log key %q: %w", *key, err)
+			}
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(changes) > 0 {
+		if _, err := b.db.Exec("DELETE FROM "+logTable+" WHERE id <= "+b.placeholder(0), lastID); err != nil {
+			return nil, fmt.Errorf("clearing change log: %w", err)
+		}
+	}
+	return changes, nil
+}
+
+// snapshotRow reads the row of table with the given primary key, honoring
+// the table's filter and excluded columns. It returns nil if the row no
+// longer exists or no longer matches the filter.
+func (b *baseSnapshotter) snapshotRow(table string, keyColumns []string, key []any) (map[string]any, error) {
+	selectList, err := b.selectList(table)
+	if err != nil {
+		return nil, err
+	}
+	conditions := make([]string, len(keyColumns))
+	for i, col := range keyColumns {
+		conditions[i] = b.quoteSingleIdentifier(col) + " = " + b.placeholder(i)
+	}
+	if filter := b.filters[table]; filter != "" {
+		conditions = append(conditions, "("+filter+")")
+	}
+	query := "SELECT " + selectList + " FROM " + b.quoteIdentifier(table) + " WHERE " + strings.Join(conditions, " AND ")
+	rows, err := b.db.Query(query, key...)
+	if err != nil {
+		return nil, fmt.Errorf("querying table %s: %w", table, err)
+	}
+	result, err := b.scanRows(rows)
+	if err != nil || len(result) == 0 {
+		return nil, err
+	}
+	return result[0], nil
+}
+
+// sqlLiteral quotes s as a SQL string literal.
+func sqlLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
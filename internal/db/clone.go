@@ -0,0 +1,129 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// CloneDatabase creates a private copy of the database at connString for
+// parallel replay worker n. It returns the copy's connection string and a
+// function that removes the copy again. SQLite databases are copied with
+// VACUUM INTO; PostgreSQL databases are created from the original as a
+// template, which requires that nobody is connected to it.
+func CloneDatabase(dbType, connString string, n int) (string, func() error, error) {
+	switch dbType {
+	case DBTypeSQLite:
+		return cloneSQLite(connString, n)
+	case DBTypePostgres:
+		return clonePostgres(connString, n)
+	default:
+		return "", nil, fmt.Errorf("cloning is not supported for %s databases", dbType)
+	}
+}
+
+func cloneSQLite(connString string, n int) (string, func() error, error) {
+	f, err := os.CreateTemp("", fmt.Sprintf("snapshot-tester-worker-%d-*.db", n))
+	if err != nil {
+		return "", nil, err
+	}
+	path := f.Name()
+	f.Close()
+	// VACUUM INTO refuses to overwrite an existing file
+	os.Remove(path)
+
+	src, err := sql.Open(DriverSQLite, connString)
+	if err != nil {
+		return "", nil, err
+	}
+	defer src.Close()
+	if _, err := src.Exec("VACUUM INTO ?", path); err != nil {
+		os.Remove(path)
+		return "", nil, fmt.Errorf("copying database: %w", err)
+	}
+	return path, func() error { return os.Remove(path) }, nil
+}
+
+func clonePostgres(connString string, n int) (string, func() error, error) {
+	source, err := postgresDatabaseName(connString)
+	if err != nil {
+		return "", nil, err
+	}
+	clone := fmt.Sprintf("%s_worker_%d", source, n)
+	cloneConn, err := postgresWithDatabase(connString, clone)
+	if err != nil {
+		return "", nil, err
+	}
+	// CREATE and DROP DATABASE run from the maintenance database, since a
+	// session connected to the template would block the copy
+	adminConn, err := postgresWithDatabase(connString, "postgres")
+	if err != nil {
+		return "", nil, err
+	}
+	admin, err := sql.Open(DriverPostgres, adminConn)
+	if err != nil {
+		return "", nil, err
+	}
+
+	quote := func(name string) string { return `"` + strings.ReplaceAll(name, `"`, `""`) + `"` }
+	drop := func() error {
+		_, err := admin.Exec("DROP DATABASE IF EXISTS " + quote(clone))
+		return err
+	}
+	// A copy left behind by an interrupted run would make CREATE fail
+	if err := drop(); err != nil {
+		admin.Close()
+		return "", nil, fmt.Errorf("dropping stale copy %s: %w", clone, err)
+	}
+	if _, err := admin.Exec("CREATE DATABASE " + quote(clone) + " TEMPLATE " + quote(source)); err != nil {
+		admin.Close()
+		return "", nil, fmt.Errorf("creating %s from %s: %w", clone, source, err)
+	}
+	return cloneConn, func() error {
+		defer admin.Close()
+		return drop()
+	}, nil
+}
+
+var postgresDBNameParam = regexp.MustCompile(`(^|\s)dbname=('(?:[^'\\]|\\.)*'|\S+)`)
+
+// postgresDatabaseName returns the database named in a postgres:// URL or a
+// key=value connection string.
+func postgresDatabaseName(connString string) (string, error) {
+	if isPostgresURL(connString) {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return "", err
+		}
+		if name := strings.TrimPrefix(u.Path, "/"); name != "" {
+			return name, nil
+		}
+	} else if m := postgresDBNameParam.FindStringSubmatch(connString); m != nil {
+		return strings.Trim(m[2], "'"), nil
+	}
+	return "", fmt.Errorf("connection string does not name a database")
+}
+
+// postgresWithDatabase returns connString pointing at database name instead.
+func postgresWithDatabase(connString, name string) (string, error) {
+	if isPostgresURL(connString) {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return "", err
+		}
+		u.Path = "/" + name
+		return u.String(), nil
+	}
+	param := "dbname='" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name) + "'"
+	if postgresDBNameParam.MatchString(connString) {
+		return postgresDBNameParam.ReplaceAllString(connString, "${1}"+strings.ReplaceAll(param, "$", "$$")), nil
+	}
+	return connString + " " + param, nil
+}
+
+func isPostgresURL(connString string) bool {
+	return strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://")
+}
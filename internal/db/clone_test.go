@@ -0,0 +1,79 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestCloneDatabase_SQLite(t *testing.T) {
+	dbPath := setupTestDB(t)
+
+	clonePath, drop, err := CloneDatabase(DBTypeSQLite, dbPath, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := sql.Open("sqlite3", clonePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clone.Exec("DELETE FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	clone.Close()
+
+	// The original is untouched by writes to the copy
+	s, err := NewSnapshotter(DBTypeSQLite, dbPath, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	rows, err := s.SnapshotTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Errorf("expected 2 users in the original, got %d", len(rows))
+	}
+
+	if err := drop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(clonePath); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", clonePath, err)
+	}
+}
+
+func TestCloneDatabase_Unsupported(t *testing.T) {
+	if _, _, err := CloneDatabase(DBTypeMySQL, "root@/app", 1); err == nil {
+		t.Error("expected an error for mysql")
+	}
+}
+
+func TestPostgresWithDatabase(t *testing.T) {
+	tests := []struct {
+		connString string
+		wantName   string
+		want       string
+	}{
+		{"postgres://u:p@localhost:5432/app?sslmode=disable", "app", "postgres://u:p@localhost:5432/app_worker_1?sslmode=disable"},
+		{"postgresql://localhost/app", "app", "postgresql://localhost/app_worker_1"},
+		{"host=localhost dbname=app sslmode=disable", "app", "host=localhost dbname='app_worker_1' sslmode=disable"},
+		{"dbname='app' host=localhost", "app", "dbname='app_worker_1' host=localhost"},
+	}
+	for _, tt := range tests {
+		name, err := postgresDatabaseName(tt.connString)
+		if err != nil || name != tt.wantName {
+			t.Errorf("postgresDatabaseName(%q) = %q, %v; want %q", tt.connString, name, err, tt.wantName)
+		}
+		got, err := postgresWithDatabase(tt.connString, tt.wantName+"_worker_1")
+		if err != nil || got != tt.want {
+			t.Errorf("postgresWithDatabase(%q) = %q, %v; want %q", tt.connString, got, err, tt.want)
+		}
+	}
+
+	if _, err := postgresDatabaseName("host=localhost"); err == nil {
+		t.Error("expected an error when no database is named")
+	}
+}
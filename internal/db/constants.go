@@ -5,6 +5,9 @@ const (
 	DBTypePostgres = "postgres"
 	DBTypeMySQL    = "mysql"
 	DBTypeSQLite   = "sqlite"
+	DBTypeMSSQL    = "mssql"
+	DBTypeRedis    = "redis"
+	DBTypeDynamoDB = "dynamodb"
 )
 
 // SQL driver names used with database/sql.Open().
@@ -12,11 +15,13 @@ const (
 	DriverPostgres = "postgres"
 	DriverMySQL    = "mysql"
 	DriverSQLite   = "sqlite3"
+	DriverMSSQL    = "sqlserver"
 )
 
 // Table discovery queries for each database type.
 const (
 	PostgresDiscoverTablesQuery = "SELECT tablename FROM pg_tables WHERE schemaname = 'public'"
-	MySQLDiscoverTablesQuery    = "SHOW TABLES"
+	MySQLDiscoverTablesQuery    = "SELECT TABLE_NAME FROM information_schema.tables WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME"
 	SQLiteDiscoverTablesQuery   = "SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'"
+	MSSQLDiscoverTablesQuery    = "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = 'dbo' AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME"
 )
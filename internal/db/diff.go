@@ -4,12 +4,15 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/esse/snapshot-tester/internal/snapshot"
 )
 
-// ComputeDiff computes the diff between two database states.
-func ComputeDiff(before, after map[string][]map[string]any) map[string]snapshot.TableDiff {
+// ComputeDiff computes the diff between two database states. rowKeys maps a
+// table to the columns that uniquely identify its rows (e.g. both columns of
+// a join table); tables without an entry are matched by "id" or "key".
+func ComputeDiff(before, after map[string][]map[string]any, rowKeys map[string][]string) map[string]snapshot.TableDiff {
 	diffs := make(map[string]snapshot.TableDiff)
 
 	// Process all tables in after state
@@ -24,13 +27,17 @@ func ComputeDiff(before, after map[string][]map[string]any) map[string]snapshot.
 	for table := range allTables {
 		beforeRows := before[table]
 		afterRows := after[table]
-		diffs[table] = diffTable(beforeRows, afterRows)
+		if sameRows(beforeRows, afterRows) {
+			diffs[table] = diffTable(nil, nil, nil)
+			continue
+		}
+		diffs[table] = diffTable(beforeRows, afterRows, rowKeys[table])
 	}
 
 	return diffs
 }
 
-func diffTable(before, after []map[string]any) snapshot.TableDiff {
+func diffTable(before, after []map[string]any, keys []string) snapshot.TableDiff {
 	diff := snapshot.TableDiff{
 		Added:    []map[string]any{},
 		Removed:  []map[string]any{},
@@ -40,9 +47,9 @@ func diffTable(before, after []map[string]any) snapshot.TableDiff {
 	beforeByHash := make(map[string]map[string]any)
 	afterByHash := make(map[string]map[string]any)
 
-	// Try to match by primary key first (look for "id" column)
-	beforeByID := indexByID(before)
-	afterByID := indexByID(after)
+	// Try to match by primary key first: the configured key columns, or else
+	// an "id" column, or "key" for Redis
+	beforeByID, afterByID := indexByRowKey(before, after, keys)
 
 	if beforeByID != nil && afterByID != nil {
 		// Match by ID
@@ -89,19 +96,55 @@ func diffTable(before, after []map[string]any) snapshot.TableDiff {
 	return diff
 }
 
-func indexByID(rows []map[string]any) map[string]map[string]any {
+// rowKeyColumns are the columns tried, in order, to match rows between the
+// before and after states of tables without configured keys.
+var rowKeyColumns = [][]string{{"id"}, {RedisColumnKey}}
+
+// indexByRowKey indexes both states by keys, or by the first entry of
+// rowKeyColumns that every row has. It returns nils when no such key exists.
+func indexByRowKey(before, after []map[string]any, keys []string) (map[string]map[string]any, map[string]map[string]any) {
+	candidates := rowKeyColumns
+	if len(keys) > 0 {
+		candidates = [][]string{keys}
+	}
+	for _, columns := range candidates {
+		beforeIdx := indexByColumns(before, columns)
+		afterIdx := indexByColumns(after, columns)
+		if beforeIdx != nil && afterIdx != nil {
+			return beforeIdx, afterIdx
+		}
+	}
+	return nil, nil
+}
+
+// indexByColumns indexes rows by the values of columns. It returns nil if a
+// row lacks one of the columns or two rows share a key.
+func indexByColumns(rows []map[string]any, columns []string) map[string]map[string]any {
 	idx := make(map[string]map[string]any)
+	parts := make([]string, len(columns))
 	for _, row := range rows {
-		id, ok := row["id"]
-		if !ok {
-			return nil // Not all rows have "id"
+		for i, column := range columns {
+			val, ok := row[column]
+			if !ok {
+				return nil // Not all rows have the column
+			}
+			parts[i] = fmt.Sprintf("%v", val)
+		}
+		key := strings.Join(parts, "\x00")
+		if _, dup := idx[key]; dup {
+			return nil // Not a unique key
 		}
-		key := fmt.Sprintf("%v", id)
 		idx[key] = row
 	}
 	return idx
 }
 
+// sameRows reports whether a and b are the same slice, as returned by
+// Incremental for tables that did not change.
+func sameRows(a, b []map[string]any) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
 func rowsEqual(a, b map[string]any) bool {
 	if len(a) != len(b) {
 		return false
@@ -118,6 +161,14 @@ func rowsEqual(a, b map[string]any) bool {
 	return true
 }
 
+// HashState returns a deterministic SHA-256 digest of a database state.
+func HashState(state map[string][]map[string]any) string {
+	// json.Marshal sorts map keys, so equal states always hash equally
+	data, _ := json.Marshal(state)
+	h := sha256.Sum256(data)
+	return fmt.Sprintf("%x", h)
+}
+
 func hashRow(row map[string]any) string {
 	data, _ := json.Marshal(row)
 	h := sha256.Sum256(data)
@@ -17,7 +17,7 @@ func TestComputeDiff_AddedRow(t *testing.T) {
 		},
 	}
 
-	diffs := ComputeDiff(before, after)
+	diffs := ComputeDiff(before, after, nil)
 
 	userDiff, ok := diffs["users"]
 	if !ok {
@@ -44,7 +44,7 @@ func TestComputeDiff_RemovedRow(t *testing.T) {
 		},
 	}
 
-	diffs := ComputeDiff(before, after)
+	diffs := ComputeDiff(before, after, nil)
 
 	userDiff := diffs["users"]
 	if len(userDiff.Removed) != 1 {
@@ -64,7 +64,7 @@ func TestComputeDiff_ModifiedRow(t *testing.T) {
 		},
 	}
 
-	diffs := ComputeDiff(before, after)
+	diffs := ComputeDiff(before, after, nil)
 
 	userDiff := diffs["users"]
 	if len(userDiff.Modified) != 1 {
@@ -72,6 +72,50 @@ func TestComputeDiff_ModifiedRow(t *testing.T) {
 	}
 }
 
+func TestComputeDiff_CompositeRowKeys(t *testing.T) {
+	before := map[string][]map[string]any{
+		"user_roles": {
+			{"user_id": 1, "role_id": 1, "granted_by": "alice"},
+			{"user_id": 1, "role_id": 2, "granted_by": "alice"},
+		},
+	}
+	after := map[string][]map[string]any{
+		"user_roles": {
+			{"user_id": 1, "role_id": 1, "granted_by": "bob"},
+			{"user_id": 1, "role_id": 2, "granted_by": "alice"},
+			{"user_id": 2, "role_id": 1, "granted_by": "bob"},
+		},
+	}
+
+	// Without keys the changed row can only be seen as removed and re-added
+	diffs := ComputeDiff(before, after, nil)
+	if d := diffs["user_roles"]; len(d.Modified) != 0 || len(d.Removed) != 1 || len(d.Added) != 2 {
+		t.Errorf("expected hash-based matching, got %+v", d)
+	}
+
+	diffs = ComputeDiff(before, after, map[string][]string{"user_roles": {"user_id", "role_id"}})
+	d := diffs["user_roles"]
+	if len(d.Modified) != 1 || len(d.Added) != 1 || len(d.Removed) != 0 {
+		t.Fatalf("expected 1 modified and 1 added row, got %+v", d)
+	}
+	if d.Modified[0].After["granted_by"] != "bob" || d.Added[0]["user_id"] != 2 {
+		t.Errorf("unexpected diff: %+v", d)
+	}
+}
+
+func TestComputeDiff_NonUniqueRowKeysFallBack(t *testing.T) {
+	before := map[string][]map[string]any{
+		"events": {{"kind": "a", "n": 1}, {"kind": "a", "n": 2}},
+	}
+	after := map[string][]map[string]any{
+		"events": {{"kind": "a", "n": 1}, {"kind": "a", "n": 3}},
+	}
+	d := ComputeDiff(before, after, map[string][]string{"events": {"kind"}})["events"]
+	if len(d.Modified) != 0 || len(d.Removed) != 1 || len(d.Added) != 1 {
+		t.Errorf("expected a non-unique key to fall back to hash matching, got %+v", d)
+	}
+}
+
 func TestComputeDiff_NoChanges(t *testing.T) {
 	state := map[string][]map[string]any{
 		"users": {
@@ -79,7 +123,7 @@ func TestComputeDiff_NoChanges(t *testing.T) {
 		},
 	}
 
-	diffs := ComputeDiff(state, state)
+	diffs := ComputeDiff(state, state, nil)
 
 	userDiff := diffs["users"]
 	if len(userDiff.Added) != 0 || len(userDiff.Removed) != 0 || len(userDiff.Modified) != 0 {
@@ -95,7 +139,7 @@ func TestComputeDiff_NewTable(t *testing.T) {
 		},
 	}
 
-	diffs := ComputeDiff(before, after)
+	diffs := ComputeDiff(before, after, nil)
 
 	orderDiff, ok := diffs["orders"]
 	if !ok {
@@ -114,10 +158,28 @@ func TestComputeDiff_EmptyStates(t *testing.T) {
 		"users": {},
 	}
 
-	diffs := ComputeDiff(before, after)
+	diffs := ComputeDiff(before, after, nil)
 
 	userDiff := diffs["users"]
 	if len(userDiff.Added) != 0 || len(userDiff.Removed) != 0 {
 		t.Error("expected no diffs for empty tables")
 	}
 }
+
+func TestHashState_Deterministic(t *testing.T) {
+	a := map[string][]map[string]any{
+		"users":  {{"id": 1, "name": "Alice"}},
+		"orders": {},
+	}
+	b := map[string][]map[string]any{
+		"orders": {},
+		"users":  {{"name": "Alice", "id": 1}},
+	}
+	if HashState(a) != HashState(b) {
+		t.Error("expected equal states to hash equally regardless of map order")
+	}
+	b["users"][0]["name"] = "Bob"
+	if HashState(a) == HashState(b) {
+		t.Error("expected different states to hash differently")
+	}
+}
@@ -0,0 +1,474 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dynamoBatchSize is the maximum number of requests in one BatchWriteItem.
+const dynamoBatchSize = 25
+
+// dynamoMaxRetries bounds how often unprocessed batch items are resubmitted.
+const dynamoMaxRetries = 8
+
+// Resubmitted items wait a random time up to an exponentially growing bound
+// ("full jitter"), as AWS recommends for unprocessed items, so throttled
+// writers back off instead of hammering the table.
+var (
+	dynamoRetryBase = 50 * time.Millisecond
+	dynamoRetryMax  = 5 * time.Second
+)
+
+// dynamoBackoff returns how long to wait before resubmitting unprocessed
+// items for the given retry, counted from 1.
+func dynamoBackoff(retry int) time.Duration {
+	bound := dynamoRetryMax
+	if shift := retry - 1; shift < 16 && dynamoRetryBase<<shift < bound {
+		bound = dynamoRetryBase << shift
+	}
+	return rand.N(bound) + 1
+}
+
+// Tags for attribute types that have no plain JSON equivalent. Such values
+// are stored as a single-key object, e.g. {"SS": ["a", "b"]} or {"B": "aGk="}.
+const (
+	dynamoTagNumber    = "N"
+	dynamoTagBinary    = "B"
+	dynamoTagStringSet = "SS"
+	dynamoTagNumberSet = "NS"
+	dynamoTagBinarySet = "BS"
+)
+
+// dynamoAPI is the subset of the DynamoDB client the snapshotter uses.
+type dynamoAPI interface {
+	dynamodb.ScanAPIClient
+	dynamodb.ListTablesAPIClient
+	DescribeTable(context.Context, *dynamodb.DescribeTableInput, ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	BatchWriteItem(context.Context, *dynamodb.BatchWriteItemInput, ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// dynamoSnapshotter captures DynamoDB tables as rows, one per item.
+//
+// Strings, booleans, nulls, lists and maps are stored as their JSON
+// equivalents. Numbers are stored as JSON numbers when that is exact and as
+// {"N": "..."} otherwise. Binary values and sets use the tags above; set
+// members are sorted so their order never causes a diff.
+type dynamoSnapshotter struct {
+	client           dynamoAPI
+	configuredTables []string
+	excluded         excludedColumns
+}
+
+// newDynamoSnapshotter connects using the default AWS credential chain. The
+// connection string is dynamodb://<region>, optionally with an endpoint for
+// DynamoDB Local or LocalStack:
+//
+//	dynamodb://us-east-1
+//	dynamodb://us-east-1?endpoint=http://localhost:8000
+//	dynamodb://                      (region from AWS_REGION / AWS config)
+func newDynamoSnapshotter(connString string, tables []string) (Snapshotter, error) {
+	region, endpoint, err := parseDynamoConnString(connString)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	// Fail early on bad credentials or endpoints, like Ping for SQL databases
+	if _, err := client.ListTables(context.Background(), &dynamodb.ListTablesInput{Limit: aws.Int32(1)}); err != nil {
+		return nil, err
+	}
+	return &dynamoSnapshotter{client: client, configuredTables: tables}, nil
+}
+
+func parseDynamoConnString(connString string) (region, endpoint string, err error) {
+	if !strings.HasPrefix(connString, "dynamodb://") {
+		return "", "", fmt.Errorf("dynamodb connection string must start with dynamodb://, got %q", connString)
+	}
+	u, err := url.Parse(connString)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing dynamodb connection string: %w", err)
+	}
+	return u.Host, u.Query().Get("endpoint"), nil
+}
+
+func (d *dynamoSnapshotter) Close() error {
+	return nil
+}
+
+func (d *dynamoSnapshotter) Tables() ([]string, error) {
+	if len(d.configuredTables) > 0 {
+		return d.configuredTables, nil
+	}
+
+	var tables []string
+	p := dynamodb.NewListTablesPaginator(d.client, &dynamodb.ListTablesInput{})
+	for p.HasMorePages() {
+		page, err := p.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("listing tables: %w", err)
+		}
+		tables = append(tables, page.TableNames...)
+	}
+	return tables, nil
+}
+
+func (d *dynamoSnapshotter) SnapshotAll() (map[string][]map[string]any, error) {
+	tables, err := d.Tables()
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(map[string][]map[string]any)
+	for _, table := range tables {
+		rows, err := d.SnapshotTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("snapshotting table %s: %w", table, err)
+		}
+		state[table] = rows
+	}
+	return state, nil
+}
+
+// SnapshotTable scans every item in the table, sorted by key so that scan
+// order doesn't affect the snapshot.
+func (d *dynamoSnapshotter) SnapshotTable(table string) ([]map[string]any, error) {
+	keys, err := d.keyAttributes(table)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []map[string]any{}
+	p := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName:      aws.String(table),
+		ConsistentRead: aws.Bool(true),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("scanning table %s: %w", table, err)
+		}
+		for _, item := range page.Items {
+			rows = append(rows, dynamoItemToRow(item))
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := fmt.Sprintf("%v", rows[i][k]), fmt.Sprintf("%v", rows[j][k])
+			if a != b {
+				return a < b
+			}
+		}
+		return false
+	})
+	return d.excluded.drop(table, rows), nil
+}
+
+// RestoreTable deletes every item in the table and writes the given rows.
+func (d *dynamoSnapshotter) RestoreTable(table string, rows []map[string]any) error {
+	ctx := context.Background()
+	keys, err := d.keyAttributes(table)
+	if err != nil {
+		return err
+	}
+
+	// Truncate: scan only the key attributes and delete them in batches
+	projection := make([]string, len(keys))
+	names := make(map[string]string, len(keys))
+	for i, k := range keys {
+		placeholder := fmt.Sprintf("#k%d", i)
+		projection[i] = placeholder
+		names[placeholder] = k
+	}
+	var deletes []types.WriteRequest
+	p := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName:                aws.String(table),
+		ProjectionExpression:     aws.String(strings.Join(projection, ", ")),
+		ExpressionAttributeNames: names,
+		ConsistentRead:           aws.Bool(true),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("scanning table %s: %w", table, err)
+		}
+		for _, key := range page.Items {
+			deletes = append(deletes, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}})
+		}
+	}
+	if err := d.batchWrite(ctx, table, deletes); err != nil {
+		return fmt.Errorf("truncating table %s: %w", table, err)
+	}
+
+	puts := make([]types.WriteRequest, 0, len(rows))
+	for _, row := range d.excluded.drop(table, rows) {
+		item, err := dynamoRowToItem(row)
+		if err != nil {
+			return fmt.Errorf("converting item for %s: %w", table, err)
+		}
+		puts = append(puts, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+	if err := d.batchWrite(ctx, table, puts); err != nil {
+		return fmt.Errorf("writing items to %s: %w", table, err)
+	}
+	return nil
+}
+
+func (d *dynamoSnapshotter) RestoreAll(state map[string][]map[string]any) error {
+	for table, rows := range state {
+		if err := d.RestoreTable(table, rows); err != nil {
+			return fmt.Errorf("restoring table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// keyAttributes returns the table's partition key followed by its sort key,
+// if any.
+func (d *dynamoSnapshotter) keyAttributes(table string) ([]string, error) {
+	out, err := d.client.DescribeTable(context.Background(), &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return nil, fmt.Errorf("describing table %s: %w", table, err)
+	}
+	var keys []string
+	for _, k := range out.Table.KeySchema {
+		if k.KeyType == types.KeyTypeHash {
+			keys = append([]string{aws.ToString(k.AttributeName)}, keys...)
+		} else {
+			keys = append(keys, aws.ToString(k.AttributeName))
+		}
+	}
+	return keys, nil
+}
+
+// batchWrite sends requests in batches of 25, resubmitting unprocessed items
+// with backoff.
+func (d *dynamoSnapshotter) batchWrite(ctx context.Context, table string, requests []types.WriteRequest) error {
+	for start := 0; start < len(requests); start += dynamoBatchSize {
+		end := min(start+dynamoBatchSize, len(requests))
+		pending := requests[start:end]
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == dynamoMaxRetries {
+				return fmt.Errorf("%d items still unprocessed after %d attempts", len(pending), attempt)
+			}
+			if attempt > 0 {
+				select {
+				case <-time.After(dynamoBackoff(attempt)):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			out, err := d.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{table: pending},
+			})
+			if err != nil {
+				return err
+			}
+			pending = out.UnprocessedItems[table]
+		}
+	}
+	return nil
+}
+
+// dynamoItemToRow converts an item to its snapshot form.
+func dynamoItemToRow(item map[string]types.AttributeValue) map[string]any {
+	row := make(map[string]any, len(item))
+	for name, av := range item {
+		row[name] = dynamoValue(av)
+	}
+	return row
+}
+
+func dynamoValue(av types.AttributeValue) any {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return dynamoNumber(v.Value)
+	case *types.AttributeValueMemberBOOL:
+		return v.Value
+	case *types.AttributeValueMemberNULL:
+		return nil
+	case *types.AttributeValueMemberB:
+		return map[string]any{dynamoTagBinary: base64.StdEncoding.EncodeToString(v.Value)}
+	case *types.AttributeValueMemberSS:
+		return map[string]any{dynamoTagStringSet: sortedStrings(v.Value)}
+	case *types.AttributeValueMemberNS:
+		return map[string]any{dynamoTagNumberSet: sortedStrings(v.Value)}
+	case *types.AttributeValueMemberBS:
+		encoded := make([]string, len(v.Value))
+		for i, b := range v.Value {
+			encoded[i] = base64.StdEncoding.EncodeToString(b)
+		}
+		return map[string]any{dynamoTagBinarySet: sortedStrings(encoded)}
+	case *types.AttributeValueMemberL:
+		list := make([]any, len(v.Value))
+		for i, item := range v.Value {
+			list[i] = dynamoValue(item)
+		}
+		return list
+	case *types.AttributeValueMemberM:
+		return dynamoItemToRow(v.Value)
+	default:
+		return nil
+	}
+}
+
+// dynamoNumber returns n as a float64 when that represents it exactly, and
+// as {"N": n} otherwise (large integers, high-precision decimals).
+func dynamoNumber(n string) any {
+	f, err := strconv.ParseFloat(n, 64)
+	if err == nil && strconv.FormatFloat(f, 'f', -1, 64) == n {
+		return f
+	}
+	return map[string]any{dynamoTagNumber: n}
+}
+
+// dynamoRowToItem converts a snapshot row back to an item.
+func dynamoRowToItem(row map[string]any) (map[string]types.AttributeValue, error) {
+	item := make(map[string]types.AttributeValue, len(row))
+	for name, val := range row {
+		av, err := dynamoAttribute(val)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		item[name] = av
+	}
+	return item, nil
+}
+
+func dynamoAttribute(val any) (types.AttributeValue, error) {
+	switch v := val.(type) {
+	case nil:
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	case string:
+		return &types.AttributeValueMemberS{Value: v}, nil
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: v}, nil
+	case float64:
+		return &types.AttributeValueMemberN{Value: strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case int:
+		return &types.AttributeValueMemberN{Value: strconv.Itoa(v)}, nil
+	case int64:
+		return &types.AttributeValueMemberN{Value: strconv.FormatInt(v, 10)}, nil
+	case []any:
+		list := make([]types.AttributeValue, len(v))
+		for i, item := range v {
+			av, err := dynamoAttribute(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = av
+		}
+		return &types.AttributeValueMemberL{Value: list}, nil
+	case map[string]any:
+		if av, ok, err := dynamoTaggedAttribute(v); ok || err != nil {
+			return av, err
+		}
+		m, err := dynamoRowToItem(v)
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", val)
+	}
+}
+
+// dynamoTaggedAttribute decodes a single-key {"<tag>": ...} object written
+// by dynamoValue. It reports false for ordinary maps.
+func dynamoTaggedAttribute(m map[string]any) (types.AttributeValue, bool, error) {
+	if len(m) != 1 {
+		return nil, false, nil
+	}
+	for tag, val := range m {
+		switch tag {
+		case dynamoTagNumber:
+			s, ok := val.(string)
+			if !ok {
+				return nil, false, nil
+			}
+			return &types.AttributeValueMemberN{Value: s}, true, nil
+		case dynamoTagBinary:
+			s, ok := val.(string)
+			if !ok {
+				return nil, false, nil
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, true, fmt.Errorf("decoding binary value: %w", err)
+			}
+			return &types.AttributeValueMemberB{Value: b}, true, nil
+		case dynamoTagStringSet, dynamoTagNumberSet, dynamoTagBinarySet:
+			members, ok := stringList(val)
+			if !ok {
+				return nil, false, nil
+			}
+			switch tag {
+			case dynamoTagStringSet:
+				return &types.AttributeValueMemberSS{Value: members}, true, nil
+			case dynamoTagNumberSet:
+				return &types.AttributeValueMemberNS{Value: members}, true, nil
+			}
+			decoded := make([][]byte, len(members))
+			for i, s := range members {
+				b, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return nil, true, fmt.Errorf("decoding binary set member: %w", err)
+				}
+				decoded[i] = b
+			}
+			return &types.AttributeValueMemberBS{Value: decoded}, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// stringList returns val as a non-empty []string if it is a list of strings.
+// DynamoDB rejects empty sets, so an empty list is not treated as one.
+func stringList(val any) ([]string, bool) {
+	list, ok := val.([]any)
+	if !ok || len(list) == 0 {
+		return nil, false
+	}
+	out := make([]string, len(list))
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		out[i] = s
+	}
+	return out, true
+}
+
+func sortedStrings(values []string) []any {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return toAnySlice(sorted)
+}
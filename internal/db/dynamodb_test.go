@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamo is an in-memory dynamoAPI. Scans return one item per page and
+// the first batch write leaves one item unprocessed, so pagination and
+// retries are exercised.
+type fakeDynamo struct {
+	keys       map[string][]string // table -> key attributes
+	items      map[string]map[string]map[string]types.AttributeValue
+	throttled  bool
+	batchCalls int
+}
+
+func newFakeDynamo() *fakeDynamo {
+	return &fakeDynamo{
+		keys:  make(map[string][]string),
+		items: make(map[string]map[string]map[string]types.AttributeValue),
+	}
+}
+
+func (f *fakeDynamo) createTable(name string, keys ...string) {
+	f.keys[name] = keys
+	f.items[name] = make(map[string]map[string]types.AttributeValue)
+}
+
+func (f *fakeDynamo) itemKey(table string, item map[string]types.AttributeValue) string {
+	var key string
+	for _, k := range f.keys[table] {
+		key += fmt.Sprintf("%v|", dynamoValue(item[k]))
+	}
+	return key
+}
+
+func (f *fakeDynamo) put(table string, item map[string]types.AttributeValue) {
+	f.items[table][f.itemKey(table, item)] = item
+}
+
+func (f *fakeDynamo) ListTables(_ context.Context, _ *dynamodb.ListTablesInput, _ ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error) {
+	var names []string
+	for name := range f.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &dynamodb.ListTablesOutput{TableNames: names}, nil
+}
+
+func (f *fakeDynamo) DescribeTable(_ context.Context, in *dynamodb.DescribeTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	keys, ok := f.keys[aws.ToString(in.TableName)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("table not found")}
+	}
+	// Sort key first, to check the partition key is still ordered first
+	var schema []types.KeySchemaElement
+	for i := len(keys) - 1; i >= 0; i-- {
+		keyType := types.KeyTypeRange
+		if i == 0 {
+			keyType = types.KeyTypeHash
+		}
+		schema = append(schema, types.KeySchemaElement{AttributeName: aws.String(keys[i]), KeyType: keyType})
+	}
+	return &dynamodb.DescribeTableOutput{Table: &types.TableDescription{KeySchema: schema}}, nil
+}
+
+func (f *fakeDynamo) Scan(_ context.Context, in *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	table := aws.ToString(in.TableName)
+	var ids []string
+	for id := range f.items[table] {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	start := 0
+	if in.ExclusiveStartKey != nil {
+		after := f.itemKey(table, in.ExclusiveStartKey)
+		for i, id := range ids {
+			if id == after {
+				start = i + 1
+			}
+		}
+	}
+	if start >= len(ids) {
+		return &dynamodb.ScanOutput{}, nil
+	}
+	item := f.items[table][ids[start]]
+	out := &dynamodb.ScanOutput{Items: []map[string]types.AttributeValue{item}}
+	if start+1 < len(ids) {
+		out.LastEvaluatedKey = item
+	}
+	return out, nil
+}
+
+func (f *fakeDynamo) BatchWriteItem(_ context.Context, in *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.batchCalls++
+	out := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	for table, requests := range in.RequestItems {
+		if len(requests) > dynamoBatchSize {
+			return nil, fmt.Errorf("batch of %d exceeds limit", len(requests))
+		}
+		if !f.throttled && len(requests) > 1 {
+			f.throttled = true
+			out.UnprocessedItems[table] = requests[len(requests)-1:]
+			requests = requests[:len(requests)-1]
+		}
+		for _, req := range requests {
+			if req.PutRequest != nil {
+				f.put(table, req.PutRequest.Item)
+			}
+			if req.DeleteRequest != nil {
+				delete(f.items[table], f.itemKey(table, req.DeleteRequest.Key))
+			}
+		}
+	}
+	return out, nil
+}
+
+func setupFakeDynamo() (*fakeDynamo, *dynamoSnapshotter) {
+	f := newFakeDynamo()
+	f.createTable("orders", "customer", "order_id")
+	f.put("orders", map[string]types.AttributeValue{
+		"customer": &types.AttributeValueMemberS{Value: "alice"},
+		"order_id": &types.AttributeValueMemberN{Value: "2"},
+		"total":    &types.AttributeValueMemberN{Value: "19.99"},
+		"tags":     &types.AttributeValueMemberSS{Value: []string{"gift", "express"}},
+		"receipt":  &types.AttributeValueMemberB{Value: []byte("hi")},
+	})
+	f.put("orders", map[string]types.AttributeValue{
+		"customer": &types.AttributeValueMemberS{Value: "alice"},
+		"order_id": &types.AttributeValueMemberN{Value: "1"},
+		"big":      &types.AttributeValueMemberN{Value: "12345678901234567890"},
+		"paid":     &types.AttributeValueMemberBOOL{Value: true},
+		"note":     &types.AttributeValueMemberNULL{Value: true},
+		"lines": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"sku": &types.AttributeValueMemberS{Value: "A1"},
+				"qty": &types.AttributeValueMemberN{Value: "3"},
+			}},
+		}},
+		"scores":   &types.AttributeValueMemberNS{Value: []string{"3", "1"}},
+		"checksum": &types.AttributeValueMemberBS{Value: [][]byte{[]byte("b"), []byte("a")}},
+	})
+	return f, &dynamoSnapshotter{client: f}
+}
+
+func TestDynamoSnapshotter_SnapshotTable(t *testing.T) {
+	_, snap := setupFakeDynamo()
+
+	rows, err := snap.SnapshotTable("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(rows))
+	}
+	if rows[0]["order_id"] != 1.0 || rows[1]["order_id"] != 2.0 {
+		t.Errorf("expected items sorted by key, got %v then %v", rows[0]["order_id"], rows[1]["order_id"])
+	}
+
+	first, second := rows[0], rows[1]
+	if first["big"].(map[string]any)["N"] != "12345678901234567890" {
+		t.Errorf("expected inexact number to be tagged, got %v", first["big"])
+	}
+	if first["paid"] != true || first["note"] != nil {
+		t.Errorf("unexpected bool/null values: %v %v", first["paid"], first["note"])
+	}
+	wantLines := []any{map[string]any{"sku": "A1", "qty": 3.0}}
+	if !reflect.DeepEqual(first["lines"], wantLines) {
+		t.Errorf("unexpected list value: %v", first["lines"])
+	}
+	if !reflect.DeepEqual(first["scores"], map[string]any{"NS": []any{"1", "3"}}) {
+		t.Errorf("unexpected number set: %v", first["scores"])
+	}
+	if !reflect.DeepEqual(first["checksum"], map[string]any{"BS": []any{"YQ==", "Yg=="}}) {
+		t.Errorf("unexpected binary set: %v", first["checksum"])
+	}
+	if !reflect.DeepEqual(second["tags"], map[string]any{"SS": []any{"express", "gift"}}) {
+		t.Errorf("expected sorted string set, got %v", second["tags"])
+	}
+	if !reflect.DeepEqual(second["receipt"], map[string]any{"B": "aGk="}) {
+		t.Errorf("unexpected binary value: %v", second["receipt"])
+	}
+	if second["total"] != 19.99 {
+		t.Errorf("expected total 19.99, got %v", second["total"])
+	}
+}
+
+func TestDynamoSnapshotter_RestoreTable(t *testing.T) {
+	f, snap := setupFakeDynamo()
+
+	state, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := roundTrip(t, state)
+
+	// Mutate: replace an item and add one
+	f.put("orders", map[string]types.AttributeValue{
+		"customer": &types.AttributeValueMemberS{Value: "alice"},
+		"order_id": &types.AttributeValueMemberN{Value: "2"},
+		"total":    &types.AttributeValueMemberN{Value: "0"},
+	})
+	f.put("orders", map[string]types.AttributeValue{
+		"customer": &types.AttributeValueMemberS{Value: "bob"},
+		"order_id": &types.AttributeValueMemberN{Value: "9"},
+	})
+
+	if err := snap.RestoreAll(saved); err != nil {
+		t.Fatal(err)
+	}
+	if !f.throttled || f.batchCalls < 3 {
+		t.Errorf("expected unprocessed items to be retried, got %d batch calls", f.batchCalls)
+	}
+
+	restored, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roundTrip(t, restored), saved) {
+		t.Errorf("restored state differs:\n got %v\nwant %v", restored, saved)
+	}
+
+	// Sets and binary values must come back with their DynamoDB types
+	for _, item := range f.items["orders"] {
+		if _, ok := item["tags"]; ok {
+			if _, ok := item["tags"].(*types.AttributeValueMemberSS); !ok {
+				t.Errorf("expected tags restored as a string set, got %T", item["tags"])
+			}
+			if _, ok := item["receipt"].(*types.AttributeValueMemberB); !ok {
+				t.Errorf("expected receipt restored as binary, got %T", item["receipt"])
+			}
+		}
+		if big, ok := item["big"].(*types.AttributeValueMemberN); ok && big.Value != "12345678901234567890" {
+			t.Errorf("expected big number restored exactly, got %s", big.Value)
+		}
+	}
+}
+
+func TestDynamoSnapshotter_BatchesLargeRestores(t *testing.T) {
+	f := newFakeDynamo()
+	f.createTable("events", "id")
+	snap := &dynamoSnapshotter{client: f}
+
+	rows := make([]map[string]any, 60)
+	for i := range rows {
+		rows[i] = map[string]any{"id": fmt.Sprintf("e%02d", i)}
+	}
+	if err := snap.RestoreTable("events", rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.items["events"]) != 60 {
+		t.Errorf("expected 60 items, got %d", len(f.items["events"]))
+	}
+}
+
+func TestDynamoAttribute_PlainMapsAreNotTagged(t *testing.T) {
+	av, err := dynamoAttribute(map[string]any{"N": 5.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := av.(*types.AttributeValueMemberM); !ok {
+		t.Errorf("expected a map whose N is not a string to stay a map, got %T", av)
+	}
+}
+
+func TestParseDynamoConnString(t *testing.T) {
+	region, endpoint, err := parseDynamoConnString("dynamodb://eu-west-1?endpoint=http://localhost:8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if region != "eu-west-1" || endpoint != "http://localhost:8000" {
+		t.Errorf("unexpected region %q endpoint %q", region, endpoint)
+	}
+	if _, _, err := parseDynamoConnString("us-east-1"); err == nil {
+		t.Error("expected error without dynamodb:// scheme")
+	}
+}
+
+func TestDynamoBackoff(t *testing.T) {
+	for retry := 1; retry <= 20; retry++ {
+		bound := dynamoRetryMax
+		if retry < 10 && dynamoRetryBase<<(retry-1) < bound {
+			bound = dynamoRetryBase << (retry - 1)
+		}
+		for i := 0; i < 50; i++ {
+			if d := dynamoBackoff(retry); d <= 0 || d > bound {
+				t.Fatalf("retry %d: backoff %v outside (0, %v]", retry, d, bound)
+			}
+		}
+	}
+}
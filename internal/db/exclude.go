@@ -0,0 +1,86 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// excludedColumns maps a table name to the columns left out of its
+// snapshots. Excluded columns are never captured, are stripped from rows
+// before restore (so the database fills in their defaults), and therefore
+// never show up in diffs.
+type excludedColumns map[string]map[string]bool
+
+func newExcludedColumns(byTable map[string][]string) excludedColumns {
+	if len(byTable) == 0 {
+		return nil
+	}
+	e := make(excludedColumns, len(byTable))
+	for table, columns := range byTable {
+		e[table] = make(map[string]bool, len(columns))
+		for _, c := range columns {
+			e[table][c] = true
+		}
+	}
+	return e
+}
+
+// drop returns rows without the table's excluded columns. Rows are copied,
+// not modified in place, since they may belong to a loaded snapshot.
+func (e excludedColumns) drop(table string, rows []map[string]any) []map[string]any {
+	skip := e[table]
+	if len(skip) == 0 {
+		return rows
+	}
+	out := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		kept := make(map[string]any, len(row))
+		for col, val := range row {
+			if !skip[col] {
+				kept[col] = val
+			}
+		}
+		out[i] = kept
+	}
+	return out
+}
+
+// columnExcluder is implemented by the snapshotters that support column
+// exclusion.
+type columnExcluder interface {
+	excludeColumns(e excludedColumns)
+}
+
+func (b *baseSnapshotter) excludeColumns(e excludedColumns)   { b.excluded = e }
+func (r *redisSnapshotter) excludeColumns(e excludedColumns)  { r.excluded = e }
+func (d *dynamoSnapshotter) excludeColumns(e excludedColumns) { d.excluded = e }
+
+// selectList returns the column list for querying table: "*", or the
+// table's columns minus the excluded ones, so large excluded values such as
+// blobs are never read.
+func (b *baseSnapshotter) selectList(table string) (string, error) {
+	skip := b.excluded[table]
+	if len(skip) == 0 {
+		return "*", nil
+	}
+	rows, err := b.db.Query("SELECT * FROM " + b.quoteIdentifier(table) + " WHERE 1 = 0")
+	if err != nil {
+		return "", fmt.Errorf("querying columns of %s: %w", table, err)
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return "", err
+	}
+
+	var kept []string
+	for _, c := range columns {
+		if !skip[c] {
+			kept = append(kept, b.quoteIdentifier(c))
+		}
+	}
+	if len(kept) == 0 {
+		return "", fmt.Errorf("every column of %s is excluded", table)
+	}
+	return strings.Join(kept, ", "), nil
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Incremental is a Snapshotter that reads the full state once and then keeps
+// it up to date from the change log written by triggers, so each
+// SnapshotAll only re-reads rows that changed since the previous one.
+//
+// Tables that did not change are returned as the same slice as in the
+// previous state, which ComputeDiff uses to skip them; callers must not
+// modify the returned rows.
+type Incremental struct {
+	*baseSnapshotter
+
+	mu     sync.Mutex
+	tables []string
+	keys   map[string][]string // table -> primary key columns; nil for tables without one
+	state  map[string][]map[string]any
+}
+
+// NewIncremental installs change tracking on the tables of s, which must be
+// a single PostgreSQL, MySQL or SQLite database, and reads their initial
+// state. Close removes the triggers again.
+func NewIncremental(s Snapshotter) (*Incremental, error) {
+	b, ok := s.(*baseSnapshotter)
+	if !ok || b.dbType == DBTypeMSSQL {
+		return nil, fmt.Errorf("incremental capture requires a single PostgreSQL, MySQL or SQLite database")
+	}
+	if len(b.views) > 0 {
+		return nil, fmt.Errorf("incremental capture does not support views")
+	}
+	tables, err := b.Tables()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		key, err := b.primaryKey(table)
+		if err != nil {
+			return nil, fmt.Errorf("reading primary key of %s: %w", table, err)
+		}
+		if len(key) == 0 {
+			slog.Warn("table has no primary key; it is re-read in full whenever it changes", "table", table)
+		}
+		keys[table] = key
+	}
+
+	// Install first, so changes made while the initial state is read are
+	// logged and picked up by the next SnapshotAll
+	if err := b.installChangeTracking(tables, keys); err != nil {
+		return nil, err
+	}
+	inc := &Incremental{baseSnapshotter: b, tables: tables, keys: keys}
+	inc.state, err = b.SnapshotAll()
+	if err != nil {
+		b.removeChangeTracking(tables)
+		return nil, err
+	}
+	return inc, nil
+}
+
+// Tables returns the tracked tables.
+func (i *Incremental) Tables() ([]string, error) {
+	return i.tables, nil
+}
+
+// SnapshotAll applies the logged changes to the cached state and returns
+// it.
+func (i *Incremental) SnapshotAll() (map[string][]map[string]any, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	changes, err := i.drainChanges()
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the distinct changed keys per table; a nil entry means the
+	// table is re-read in full
+	changedKeys := make(map[string]map[string][]any)
+	for _, c := range changes {
+		if _, tracked := i.state[c.table]; !tracked {
+			continue
+		}
+		if changedKeys[c.table] == nil {
+			changedKeys[c.table] = make(map[string][]any)
+		}
+		if c.key != nil {
+			changedKeys[c.table][keyString(c.key)] = c.key
+		}
+	}
+
+	next := make(map[string][]map[string]any, len(i.state))
+	for table, rows := range i.state {
+		next[table] = rows
+	}
+	for table, keys := range changedKeys {
+		rows, err := i.refreshTable(table, i.state[table], keys)
+		if err != nil {
+			return nil, fmt.Errorf("refreshing table %s: %w", table, err)
+		}
+		next[table] = rows
+	}
+	i.state = next
+
+	result := make(map[string][]map[string]any, len(next))
+	for table, rows := range next {
+		result[table] = rows
+	}
+	return result, nil
+}
+
+// refreshTable returns a new slice of table's rows with the changed keys
+// re-read: updated rows are replaced in place, deleted rows dropped and new
+// rows appended.
+func (i *Incremental) refreshTable(table string, rows []map[string]any, keys map[string][]any) ([]map[string]any, error) {
+	keyColumns := i.keys[table]
+	if len(keyColumns) == 0 {
+		return i.SnapshotTable(table)
+	}
+
+	fresh := make(map[string]map[string]any, len(keys))
+	for k, key := range keys {
+		row, err := i.snapshotRow(table, keyColumns, key)
+		if err != nil {
+			return nil, err
+		}
+		fresh[k] = row
+	}
+
+	out := make([]map[string]any, 0, len(rows)+len(keys))
+	for _, row := range rows {
+		k := keyString(rowKeyValues(row, keyColumns))
+		if newRow, changed := fresh[k]; changed {
+			delete(fresh, k)
+			if newRow == nil {
+				continue
+			}
+			row = newRow
+		}
+		out = append(out, row)
+	}
+	// Remaining keys are rows that were not in the state before
+	for _, k := range sortedKeys(fresh) {
+		if row := fresh[k]; row != nil {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// Close removes change tracking and closes the connection.
+func (i *Incremental) Close() error {
+	if err := i.removeChangeTracking(i.tables); err != nil {
+		slog.Warn("failed to remove change tracking triggers", "error", err)
+	}
+	return i.baseSnapshotter.Close()
+}
+
+func rowKeyValues(row map[string]any, columns []string) []any {
+	values := make([]any, len(columns))
+	for j, col := range columns {
+		values[j] = row[col]
+	}
+	return values
+}
+
+// keyString renders key values so a key logged as JSON by a trigger and the
+// same key read from the table compare equal.
+func keyString(values []any) string {
+	parts := make([]string, len(values))
+	for j, v := range values {
+		parts[j] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(parts, "\x00")
+}
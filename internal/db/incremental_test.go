@@ -0,0 +1,110 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestIncremental_TracksChanges(t *testing.T) {
+	dbPath := setupTestDB(t)
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec("CREATE TABLE audit (action TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := NewSnapshotter(DBTypeSQLite, dbPath, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc, err := NewIncremental(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inc.Close()
+
+	before, err := inc.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := before[changeLogTable]; ok {
+		t.Fatal("expected the change log table not to be snapshotted")
+	}
+
+	// Changes made by the service's own connection
+	_, err = conn.Exec(`
+		UPDATE users SET name = 'Alicia' WHERE id = 1;
+		DELETE FROM users WHERE id = 2;
+		INSERT INTO users (id, name, email) VALUES (3, 'Carol', 'carol@example.com');
+		INSERT INTO audit (action) VALUES ('signup');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := inc.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := base.(*baseSnapshotter).SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if HashState(after) != HashState(full) {
+		t.Errorf("incremental state differs from a full snapshot:\n got %v\nwant %v", after, full)
+	}
+
+	diffs := ComputeDiff(before, after, nil)
+	if d := diffs["users"]; len(d.Modified) != 1 || len(d.Removed) != 1 || len(d.Added) != 1 {
+		t.Errorf("unexpected users diff: %+v", d)
+	}
+	if d := diffs["audit"]; len(d.Added) != 1 {
+		t.Errorf("expected the row added to a table without primary key, got %+v", d)
+	}
+	if !sameRows(before["orders"], after["orders"]) {
+		t.Error("expected unchanged table to be reused")
+	}
+}
+
+func TestIncremental_CloseRemovesTriggers(t *testing.T) {
+	dbPath := setupTestDB(t)
+	base, err := NewSnapshotter(DBTypeSQLite, dbPath, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc, err := NewIncremental(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var count int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name LIKE '\\_snapshot\\_tester\\_%' ESCAPE '\\'").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected change tracking objects to be removed, found %d", count)
+	}
+}
+
+func TestIncremental_Unsupported(t *testing.T) {
+	dbPath := setupTestDB(t)
+	multi, err := Open([]Target{{Name: "main", Type: DBTypeSQLite, ConnString: dbPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer multi.Close()
+	if _, err := NewIncremental(multi); err == nil {
+		t.Error("expected incremental capture to require a single SQL database")
+	}
+}
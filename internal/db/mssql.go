@@ -0,0 +1,152 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// mssqlDefaultSchema is scanned when no namespaces are configured. Its tables
+// are returned unqualified, like PostgreSQL's public schema.
+const mssqlDefaultSchema = "dbo"
+
+func newMSSQLSnapshotter(connString string, tables, namespaces []string) (Snapshotter, error) {
+	db, err := sql.Open(DriverMSSQL, connString)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &baseSnapshotter{
+		db:               db,
+		configuredTables: tables,
+		namespaces:       namespaces,
+		dbType:           DBTypeMSSQL,
+	}, nil
+}
+
+// discoverMSSQLTables discovers tables in the configured schemas.
+// When scanning only dbo, table names are unqualified; otherwise they are
+// schema-qualified (schema.table).
+func (b *baseSnapshotter) discoverMSSQLTables() ([]string, error) {
+	namespaces := b.namespaces
+	if len(namespaces) == 0 || (len(namespaces) == 1 && namespaces[0] == mssqlDefaultSchema) {
+		return b.queryStrings(MSSQLDiscoverTablesQuery)
+	}
+
+	placeholders := make([]string, len(namespaces))
+	args := make([]any, len(namespaces))
+	for i, ns := range namespaces {
+		placeholders[i] = b.placeholder(i)
+		args[i] = ns
+	}
+
+	query := fmt.Sprintf(
+		"SELECT TABLE_SCHEMA + '.' + TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA IN (%s) AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_SCHEMA, TABLE_NAME",
+		strings.Join(placeholders, ", "),
+	)
+
+	rows, err := b.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// restoreMSSQLTable truncates and refills a table in one transaction.
+// SQL Server rejects explicit values for identity columns unless
+// IDENTITY_INSERT is on, and that setting is per session, so the whole
+// restore must run on a single connection.
+func (b *baseSnapshotter) restoreMSSQLTable(table string, rows []map[string]any) error {
+	quotedTable := b.quoteIdentifier(table)
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM " + quotedTable + b.where(table)); err != nil {
+		return fmt.Errorf("truncating table %s: %w", table, err)
+	}
+
+	identityInsert := false
+	if len(rows) > 0 {
+		column, err := mssqlIdentityColumn(tx, quotedTable)
+		if err != nil {
+			return fmt.Errorf("looking up identity column of %s: %w", table, err)
+		}
+		// Rows recorded without the identity column let SQL Server assign it
+		if _, ok := rows[0][column]; column != "" && ok {
+			identityInsert = true
+		}
+	}
+	if identityInsert {
+		if _, err := tx.Exec("SET IDENTITY_INSERT " + quotedTable + " ON"); err != nil {
+			return fmt.Errorf("enabling identity insert on %s: %w", table, err)
+		}
+	}
+
+	if err := b.insertRows(tx, table, rows); err != nil {
+		return err
+	}
+
+	if identityInsert {
+		if _, err := tx.Exec("SET IDENTITY_INSERT " + quotedTable + " OFF"); err != nil {
+			return fmt.Errorf("disabling identity insert on %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// alterMSSQLConstraints runs ALTER TABLE ... <action> CONSTRAINT ALL on each
+// table. Re-enabling uses CHECK without WITH CHECK, so restored rows are not
+// revalidated, matching FOREIGN_KEY_CHECKS = 1 on MySQL.
+func (b *baseSnapshotter) alterMSSQLConstraints(tables []string, action string) error {
+	for _, table := range tables {
+		if _, err := b.db.Exec("ALTER TABLE " + b.quoteIdentifier(table) + " " + action + " CONSTRAINT ALL"); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// mssqlIdentityColumn returns the name of the table's identity column, or ""
+// if it has none.
+func mssqlIdentityColumn(q queryRower, quotedTable string) (string, error) {
+	var name string
+	err := q.QueryRow("SELECT name FROM sys.identity_columns WHERE object_id = OBJECT_ID(@p1)", quotedTable).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+// mssqlValue converts driver values that don't read well as strings.
+// UNIQUEIDENTIFIER columns arrive as 16 bytes in SQL Server's mixed-endian
+// layout and are formatted as the usual GUID string.
+func mssqlValue(columnType *sql.ColumnType, val any) any {
+	raw, ok := val.([]byte)
+	if !ok || columnType == nil || columnType.DatabaseTypeName() != "UNIQUEIDENTIFIER" {
+		return val
+	}
+	var id mssql.UniqueIdentifier
+	if err := id.Scan(raw); err != nil {
+		return val
+	}
+	return id.String()
+}
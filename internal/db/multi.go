@@ -0,0 +1,186 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Target describes one database to snapshot.
+type Target struct {
+	Name       string // prefixes table names as "name.table"; "" for a single unnamed database
+	Type       string
+	ConnString string
+	Tables     []string
+	Namespaces []string
+
+	ExcludeColumns map[string][]string // table -> columns left out of snapshots
+	Filters        map[string]string   // table -> SQL condition selecting the rows to snapshot
+	RestoreMode    string              // RestoreModeInsert (default) or RestoreModeBulk
+
+	IncludeViews bool // snapshot views and materialized views; they are compared but never restored
+	RefreshViews bool // refresh materialized views before after-request snapshots (PostgreSQL)
+}
+
+// Open connects to every target and returns a single Snapshotter over all of
+// them. A single unnamed target is returned as-is, so its table names stay
+// unprefixed.
+func Open(targets []Target) (Snapshotter, error) {
+	if len(targets) == 1 && targets[0].Name == "" {
+		return openTarget(targets[0])
+	}
+
+	multi := &multiSnapshotter{}
+	for _, t := range targets {
+		s, err := openTarget(t)
+		if err != nil {
+			multi.Close()
+			return nil, fmt.Errorf("database %s: %w", t.Name, err)
+		}
+		multi.members = append(multi.members, namedSnapshotter{name: t.Name, Snapshotter: s})
+	}
+	return multi, nil
+}
+
+func openTarget(t Target) (Snapshotter, error) {
+	s, err := NewSnapshotter(t.Type, t.ConnString, t.Tables, t.Namespaces)
+	if err != nil {
+		return nil, err
+	}
+	if excluded := newExcludedColumns(t.ExcludeColumns); excluded != nil {
+		ex, ok := s.(columnExcluder)
+		if !ok {
+			s.Close()
+			return nil, fmt.Errorf("%s does not support exclude_columns", t.Type)
+		}
+		ex.excludeColumns(excluded)
+	}
+	if len(t.Filters) > 0 || t.RestoreMode == RestoreModeBulk {
+		b, ok := s.(*baseSnapshotter)
+		if !ok {
+			s.Close()
+			return nil, fmt.Errorf("%s does not support table filters or bulk restore", t.Type)
+		}
+		b.filters = t.Filters
+		b.restoreMode = t.RestoreMode
+	}
+	if t.IncludeViews {
+		b, ok := s.(*baseSnapshotter)
+		if !ok {
+			s.Close()
+			return nil, fmt.Errorf("%s does not support views", t.Type)
+		}
+		if err := b.loadViews(); err != nil {
+			s.Close()
+			return nil, err
+		}
+		b.refreshViews = t.RefreshViews
+	}
+	return s, nil
+}
+
+type namedSnapshotter struct {
+	name string
+	Snapshotter
+}
+
+// multiSnapshotter combines several databases into one state. Table names are
+// prefixed with the database name ("main.users", "cache.session:*"), so a
+// database's state is everything under its prefix.
+type multiSnapshotter struct {
+	members []namedSnapshotter
+}
+
+func (m *multiSnapshotter) Close() error {
+	var firstErr error
+	for _, member := range m.members {
+		if err := member.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *multiSnapshotter) Tables() ([]string, error) {
+	var tables []string
+	for _, member := range m.members {
+		memberTables, err := member.Tables()
+		if err != nil {
+			return nil, fmt.Errorf("database %s: %w", member.name, err)
+		}
+		for _, table := range memberTables {
+			tables = append(tables, member.name+"."+table)
+		}
+	}
+	return tables, nil
+}
+
+func (m *multiSnapshotter) SnapshotTable(table string) ([]map[string]any, error) {
+	member, name, err := m.resolve(table)
+	if err != nil {
+		return nil, err
+	}
+	return member.SnapshotTable(name)
+}
+
+func (m *multiSnapshotter) SnapshotAll() (map[string][]map[string]any, error) {
+	state := make(map[string][]map[string]any)
+	for _, member := range m.members {
+		memberState, err := member.SnapshotAll()
+		if err != nil {
+			return nil, fmt.Errorf("database %s: %w", member.name, err)
+		}
+		for table, rows := range memberState {
+			state[member.name+"."+table] = rows
+		}
+	}
+	return state, nil
+}
+
+func (m *multiSnapshotter) RestoreTable(table string, rows []map[string]any) error {
+	member, name, err := m.resolve(table)
+	if err != nil {
+		return err
+	}
+	return member.RestoreTable(name, rows)
+}
+
+// RestoreAll splits the state by database and restores each database's part
+// in one RestoreAll call, so per-database work such as disabling foreign key
+// checks happens once.
+func (m *multiSnapshotter) RestoreAll(state map[string][]map[string]any) error {
+	parts := make(map[string]map[string][]map[string]any)
+	for table, rows := range state {
+		member, name, err := m.resolve(table)
+		if err != nil {
+			return err
+		}
+		if parts[member.name] == nil {
+			parts[member.name] = make(map[string][]map[string]any)
+		}
+		parts[member.name][name] = rows
+	}
+
+	for _, member := range m.members {
+		part, ok := parts[member.name]
+		if !ok {
+			continue
+		}
+		if err := member.RestoreAll(part); err != nil {
+			return fmt.Errorf("database %s: %w", member.name, err)
+		}
+	}
+	return nil
+}
+
+// resolve splits "name.table" into the named database and its table name.
+func (m *multiSnapshotter) resolve(table string) (namedSnapshotter, string, error) {
+	name, rest, ok := strings.Cut(table, ".")
+	if ok {
+		for _, member := range m.members {
+			if member.name == name {
+				return member, rest, nil
+			}
+		}
+	}
+	return namedSnapshotter{}, "", fmt.Errorf("table %q does not belong to a configured database (expected <database>.<table>)", table)
+}
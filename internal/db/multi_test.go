@@ -0,0 +1,217 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestOpen_SingleUnnamedTargetIsNotPrefixed(t *testing.T) {
+	dbPath := setupTestDB(t)
+
+	snap, err := Open([]Target{{Type: DBTypeSQLite, ConnString: dbPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	state, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state["users"]; !ok {
+		t.Errorf("expected unprefixed table names, got %v", keysOf(state))
+	}
+}
+
+func TestOpen_MultipleDatabases(t *testing.T) {
+	dbPath := setupTestDB(t)
+	mr := miniredis.RunT(t)
+	mr.Set("session:1", "alice")
+
+	snap, err := Open([]Target{
+		{Name: "main", Type: DBTypeSQLite, ConnString: dbPath, Tables: []string{"users"}},
+		{Name: "cache", Type: DBTypeRedis, ConnString: "redis://" + mr.Addr(), Tables: []string{"session:*"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	tables, err := snap.Tables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 || tables[0] != "main.users" || tables[1] != "cache.session:*" {
+		t.Errorf("unexpected tables: %v", tables)
+	}
+
+	state, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state["main.users"]) != 2 || len(state["cache.session:*"]) != 1 {
+		t.Fatalf("unexpected state: %v", state)
+	}
+
+	// Change both databases, then restore
+	mr.Set("session:1", "mallory")
+	if err := snap.RestoreTable("main.users", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.RestoreAll(state); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored["main.users"]) != 2 {
+		t.Errorf("expected users restored, got %v", restored["main.users"])
+	}
+	if v, _ := mr.Get("session:1"); v != "alice" {
+		t.Errorf("expected session restored, got %q", v)
+	}
+}
+
+func TestOpen_MultipleDatabasesUnknownPrefix(t *testing.T) {
+	dbPath := setupTestDB(t)
+
+	snap, err := Open([]Target{{Name: "main", Type: DBTypeSQLite, ConnString: dbPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	if err := snap.RestoreAll(map[string][]map[string]any{"users": {}}); err == nil {
+		t.Error("expected error for a table without a database prefix")
+	}
+	if _, err := snap.SnapshotTable("other.users"); err == nil {
+		t.Error("expected error for an unknown database")
+	}
+}
+
+func keysOf(state map[string][]map[string]any) []string {
+	var keys []string
+	for k := range state {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestOpen_ExcludeColumns(t *testing.T) {
+	dbPath := setupTestDB(t)
+
+	snap, err := Open([]Target{{
+		Type:           DBTypeSQLite,
+		ConnString:     dbPath,
+		Tables:         []string{"users", "orders"},
+		ExcludeColumns: map[string][]string{"users": {"email"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	state, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range state["users"] {
+		if _, ok := row["email"]; ok {
+			t.Errorf("expected email to be excluded, got %v", row)
+		}
+		if _, ok := row["name"]; !ok {
+			t.Errorf("expected other columns to be kept, got %v", row)
+		}
+	}
+	if _, ok := state["orders"][0]["total"]; !ok {
+		t.Error("expected exclusions to apply only to their table")
+	}
+
+	// Rows from older snapshots may still carry the column; it is not restored
+	old := map[string][]map[string]any{
+		"users": {{"id": int64(5), "name": "Eve", "email": "eve@example.com"}},
+	}
+	if err := snap.RestoreAll(old); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := old["users"][0]["email"]; !ok {
+		t.Error("expected restore not to modify the given rows")
+	}
+
+	raw, err := NewSnapshotter(DBTypeSQLite, dbPath, []string{"users"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	rows, err := raw.SnapshotTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["email"] != nil {
+		t.Errorf("expected excluded column to be left to its default, got %v", rows)
+	}
+}
+
+func TestOpen_Filters(t *testing.T) {
+	dbPath := setupTestDB(t)
+
+	snap, err := Open([]Target{{
+		Type:       DBTypeSQLite,
+		ConnString: dbPath,
+		Tables:     []string{"users", "orders"},
+		Filters:    map[string]string{"users": "id = 1"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	state, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state["users"]) != 1 || state["users"][0]["name"] != "Alice" {
+		t.Errorf("expected only the filtered user, got %v", state["users"])
+	}
+	if len(state["orders"]) != 1 {
+		t.Errorf("expected unfiltered table to be captured in full, got %v", state["orders"])
+	}
+
+	// Restore replaces the filtered rows and leaves the others alone
+	state["users"][0]["name"] = "Alicia"
+	if err := snap.RestoreAll(state); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := NewSnapshotter(DBTypeSQLite, dbPath, []string{"users"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	rows, err := raw.SnapshotTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected rows outside the filter to survive restore, got %v", rows)
+	}
+	for _, row := range rows {
+		if row["id"] == int64(1) && row["name"] != "Alicia" {
+			t.Errorf("expected filtered row to be restored, got %v", row)
+		}
+	}
+}
+
+func TestOpen_FiltersUnsupported(t *testing.T) {
+	mr := miniredis.RunT(t)
+	_, err := Open([]Target{{
+		Type:       DBTypeRedis,
+		ConnString: "redis://" + mr.Addr(),
+		Filters:    map[string]string{"*": "1 = 1"},
+	}})
+	if err == nil {
+		t.Error("expected filters to be rejected for redis")
+	}
+}
@@ -2,12 +2,23 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
+// mysqlDefaultPort is used for URL-style connection strings without a port.
+const mysqlDefaultPort = "3306"
+
 func newMySQLSnapshotter(connString string, tables, namespaces []string) (Snapshotter, error) {
-	db, err := sql.Open(DriverMySQL, connString)
+	dsn, err := mysqlDSN(connString)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(DriverMySQL, dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -22,3 +33,48 @@ func newMySQLSnapshotter(connString string, tables, namespaces []string) (Snapsh
 		dbType:           DBTypeMySQL,
 	}, nil
 }
+
+// mysqlDSN converts URL-style connection strings to the driver's DSN format,
+// so hosts can be written like other databases' URLs:
+//
+//	mysql://user:pass@[::1]:3306/app          -> user:pass@tcp([::1]:3306)/app
+//	mysql://user:pass@/app?socket=/run/my.sock -> user:pass@unix(/run/my.sock)/app
+//
+// Strings already in DSN form, e.g. user:pass@tcp(host:3306)/app, are
+// returned unchanged.
+func mysqlDSN(connString string) (string, error) {
+	if !strings.HasPrefix(connString, "mysql://") {
+		return connString, nil
+	}
+	u, err := url.Parse(connString)
+	if err != nil {
+		return "", fmt.Errorf("parsing mysql connection URL: %w", err)
+	}
+
+	var dsn strings.Builder
+	if u.User != nil {
+		dsn.WriteString(u.User.Username())
+		if pass, ok := u.User.Password(); ok {
+			dsn.WriteString(":" + pass)
+		}
+		dsn.WriteString("@")
+	}
+
+	query := u.Query()
+	if socket := query.Get("socket"); socket != "" {
+		query.Del("socket")
+		dsn.WriteString("unix(" + socket + ")")
+	} else if u.Host != "" {
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), mysqlDefaultPort)
+		}
+		dsn.WriteString("tcp(" + host + ")")
+	}
+
+	dsn.WriteString("/" + strings.TrimPrefix(u.Path, "/"))
+	if len(query) > 0 {
+		dsn.WriteString("?" + query.Encode())
+	}
+	return dsn.String(), nil
+}
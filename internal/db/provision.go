@@ -0,0 +1,234 @@
+package db
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ProvisionDocker starts replay.test_database.provision databases as docker
+// containers.
+const ProvisionDocker = "docker"
+
+// ContainerLabel marks the containers started by Provision, its value the
+// process ID of the run that started them.
+const ContainerLabel = "snapshot-tester.test-database"
+
+// provisionedDatabase is the database created in a provisioned container.
+const provisionedDatabase = "snapshot_test"
+
+// provisionTimeout bounds the wait for a provisioned database to accept
+// connections, including pulling its image. A variable so tests can
+// shorten it.
+var provisionTimeout = 2 * time.Minute
+
+// containerSpec describes how to run a database image and reach it.
+type containerSpec struct {
+	image string // default image
+	port  string // port the database listens on inside the container
+	env   func(password string) []string
+	conn  func(hostPort, password string) string
+}
+
+var containerSpecs = map[string]containerSpec{
+	DBTypePostgres: {
+		image: "postgres:16-alpine",
+		port:  "5432",
+		env: func(password string) []string {
+			return []string{"POSTGRES_PASSWORD=" + password, "POSTGRES_DB=" + provisionedDatabase}
+		},
+		conn: func(hostPort, password string) string {
+			return (&url.URL{
+				Scheme:   "postgres",
+				User:     url.UserPassword("postgres", password),
+				Host:     hostPort,
+				Path:     "/" + provisionedDatabase,
+				RawQuery: "sslmode=disable",
+			}).String()
+		},
+	},
+	DBTypeMySQL: {
+		image: "mysql:8.4",
+		port:  "3306",
+		env: func(password string) []string {
+			return []string{"MYSQL_ROOT_PASSWORD=" + password, "MYSQL_DATABASE=" + provisionedDatabase}
+		},
+		conn: func(hostPort, password string) string {
+			return (&url.URL{
+				Scheme: "mysql",
+				User:   url.UserPassword("root", password),
+				Host:   hostPort,
+				Path:   "/" + provisionedDatabase,
+			}).String()
+		},
+	},
+}
+
+// Provision starts a throwaway dbType database in a docker container, from
+// image or the default image for the type, and loads the SQL file schema
+// into it if given. It returns the database's connection string and a
+// function that removes the container again. The database's port is
+// published on 127.0.0.1 only. Containers left behind by earlier runs that
+// were killed are removed first.
+func Provision(dbType, image, schema string) (string, func() error, error) {
+	spec, ok := containerSpecs[dbType]
+	if !ok {
+		return "", nil, fmt.Errorf("provisioning is not supported for %s databases", dbType)
+	}
+	if image == "" {
+		image = spec.image
+	}
+	var ddl []byte
+	if schema != "" {
+		var err error
+		if ddl, err = os.ReadFile(schema); err != nil {
+			return "", nil, fmt.Errorf("reading schema: %w", err)
+		}
+	}
+
+	secret := make([]byte, 12)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	password := hex.EncodeToString(secret)
+
+	removeStaleContainers()
+
+	// The label finds containers left behind by an interrupted run
+	args := []string{"run", "--detach", "--rm", "--label", ContainerLabel + "=" + strconv.Itoa(os.Getpid()), "--publish", "127.0.0.1::" + spec.port}
+	for _, env := range spec.env(password) {
+		args = append(args, "--env", env)
+	}
+	id, err := docker(append(args, image)...)
+	if err != nil {
+		return "", nil, fmt.Errorf("starting %s container: %w", image, err)
+	}
+	remove := func() error {
+		_, err := docker("rm", "--force", id)
+		return err
+	}
+
+	// The first line is the IPv4 binding
+	out, err := docker("port", id, spec.port+"/tcp")
+	if err != nil {
+		remove()
+		return "", nil, fmt.Errorf("finding the published port: %w", err)
+	}
+	hostPort, _, _ := strings.Cut(out, "\n")
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		remove()
+		return "", nil, fmt.Errorf("unexpected published port %q", hostPort)
+	}
+	connString := spec.conn(hostPort, password)
+
+	if err := waitForDatabase(dbType, connString, ddl); err != nil {
+		remove()
+		return "", nil, err
+	}
+	return connString, remove, nil
+}
+
+// removeStaleContainers removes the containers Provision started in runs
+// that are no longer running, e.g. killed before they could clean up.
+// Containers of runs still going on, this one included, are left alone.
+func removeStaleContainers() {
+	out, err := docker("ps", "--all", "--filter", "label="+ContainerLabel, "--format", `{{.ID}} {{.Label "`+ContainerLabel+`"}}`)
+	if err != nil {
+		slog.Warn("failed to list test database containers", "error", err)
+		return
+	}
+	for _, line := range strings.Split(out, "\n") {
+		id, owner, _ := strings.Cut(line, " ")
+		if id == "" || processRunning(owner) {
+			continue
+		}
+		slog.Info("removing stale test database container", "container", id)
+		if _, err := docker("rm", "--force", id); err != nil {
+			slog.Warn("failed to remove stale test database container", "container", id, "error", err)
+		}
+	}
+}
+
+// processRunning reports whether the process with ID pid is still running
+// on this host.
+func processRunning(pid string) bool {
+	n, err := strconv.Atoi(pid)
+	if err != nil || n <= 0 {
+		return false
+	}
+	if n == os.Getpid() {
+		return true
+	}
+	p, err := os.FindProcess(n)
+	if err != nil {
+		return false
+	}
+	// Signal 0 only checks that the process exists
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+// waitForDatabase waits until the database at connString accepts
+// connections, then runs ddl in it. Database images only listen on TCP
+// once their initialization is done.
+func waitForDatabase(dbType, connString string, ddl []byte) error {
+	driver, dsn := DriverPostgres, connString
+	if dbType == DBTypeMySQL {
+		var err error
+		if dsn, err = mysqlDSN(connString + "?multiStatements=true"); err != nil {
+			return err
+		}
+		driver = DriverMySQL
+	}
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(provisionTimeout)
+	for {
+		err := conn.Ping()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("database not ready after %s: %w", provisionTimeout, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if len(ddl) > 0 {
+		if _, err := conn.Exec(string(ddl)); err != nil {
+			return fmt.Errorf("loading schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// docker runs the docker CLI and returns its trimmed output.
+func docker(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("docker %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("docker %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
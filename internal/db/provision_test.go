@@ -0,0 +1,85 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDocker puts a docker command on PATH that logs its arguments and
+// answers like docker for a container nothing listens in, listing a stale
+// container and one of this process.
+func fakeDocker(t *testing.T) string {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "docker.log")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$1" in
+ps) printf 'deadbeef 0\nfeedface ` + strconv.Itoa(os.Getpid()) + `\n' ;;
+run) echo c0ffee ;;
+port) printf '127.0.0.1:1\n[::]:1\n' ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestProvision_NotReady(t *testing.T) {
+	log := fakeDocker(t)
+	timeout := provisionTimeout
+	provisionTimeout = 100 * time.Millisecond
+	defer func() { provisionTimeout = timeout }()
+
+	_, _, err := Provision(DBTypePostgres, "", "")
+	if err == nil || !strings.Contains(err.Error(), "database not ready") {
+		t.Fatalf("expected a readiness error, got %v", err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(calls) != 5 {
+		t.Fatalf("expected ps, rm, run, port and rm, got %q", calls)
+	}
+	if !strings.HasPrefix(calls[0], "ps --all --filter label="+ContainerLabel+" ") || calls[1] != "rm --force deadbeef" {
+		t.Errorf("expected only the stale container removed, got %q", calls[:2])
+	}
+	calls = calls[2:]
+	for _, want := range []string{"run --detach --rm --label " + ContainerLabel + "=" + strconv.Itoa(os.Getpid()) + " --publish 127.0.0.1::5432 ", "--env POSTGRES_DB=snapshot_test ", " postgres:16-alpine"} {
+		if !strings.Contains(calls[0], want) {
+			t.Errorf("expected %q in %q", want, calls[0])
+		}
+	}
+	if calls[1] != "port c0ffee 5432/tcp" || calls[2] != "rm --force c0ffee" {
+		t.Errorf("expected the port looked up and the container removed, got %q", calls[1:])
+	}
+}
+
+func TestProvision_Errors(t *testing.T) {
+	fakeDocker(t)
+	if _, _, err := Provision(DBTypeSQLite, "", ""); err == nil || !strings.Contains(err.Error(), "not supported for sqlite") {
+		t.Errorf("expected an unsupported type error, got %v", err)
+	}
+	if _, _, err := Provision(DBTypeMySQL, "", filepath.Join(t.TempDir(), "missing.sql")); err == nil || !strings.Contains(err.Error(), "reading schema") {
+		t.Errorf("expected a schema error, got %v", err)
+	}
+}
+
+func TestContainerSpecs_ConnString(t *testing.T) {
+	if got := containerSpecs[DBTypePostgres].conn("127.0.0.1:55432", "pw"); got != "postgres://postgres:pw@127.0.0.1:55432/snapshot_test?sslmode=disable" {
+		t.Errorf("unexpected postgres connection string %q", got)
+	}
+	conn := containerSpecs[DBTypeMySQL].conn("127.0.0.1:53306", "pw")
+	dsn, err := mysqlDSN(conn)
+	if err != nil || dsn != "root:pw@tcp(127.0.0.1:53306)/snapshot_test" {
+		t.Errorf("unexpected mysql connection string %q (DSN %q, %v)", conn, dsn, err)
+	}
+}
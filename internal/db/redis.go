@@ -0,0 +1,447 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis value types captured by the Redis snapshotter.
+const (
+	RedisTypeString = "string"
+	RedisTypeHash   = "hash"
+	RedisTypeList   = "list"
+	RedisTypeSet    = "set"
+	RedisTypeZSet   = "zset"
+)
+
+// Columns of a row produced by the Redis snapshotter.
+const (
+	RedisColumnKey   = "key"
+	RedisColumnType  = "type"
+	RedisColumnValue = "value"
+	RedisColumnTTL   = "ttl" // seconds until expiry, or -1 for keys without one
+)
+
+// redisDefaultPattern snapshots every key when no patterns are configured.
+const redisDefaultPattern = "*"
+
+// redisScanCount is the SCAN page size hint.
+const redisScanCount = 500
+
+// redisSnapshotter captures Redis keys as rows. Each configured key pattern
+// (e.g. "session:*") acts as a table whose rows are the matching keys:
+//
+//	{"key": "session:42", "type": "hash", "value": {"user": "7"}, "ttl": 3600}
+//
+// Values are strings (string), maps (hash), arrays (list, sorted set), or
+// sorted arrays (set, so member order never causes a diff). Sorted set
+// members are {"member": ..., "score": ...} objects.
+type redisSnapshotter struct {
+	client   *redis.Client
+	patterns []string
+	excluded excludedColumns
+}
+
+func newRedisSnapshotter(connString string, patterns []string) (Snapshotter, error) {
+	opts, err := redis.ParseURL(connString)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis connection string: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		patterns = []string{redisDefaultPattern}
+	}
+	return &redisSnapshotter{client: client, patterns: patterns}, nil
+}
+
+func (r *redisSnapshotter) Close() error {
+	return r.client.Close()
+}
+
+// Tables returns the configured key patterns.
+func (r *redisSnapshotter) Tables() ([]string, error) {
+	return r.patterns, nil
+}
+
+func (r *redisSnapshotter) SnapshotAll() (map[string][]map[string]any, error) {
+	state := make(map[string][]map[string]any)
+	for _, pattern := range r.patterns {
+		rows, err := r.SnapshotTable(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("snapshotting keys %s: %w", pattern, err)
+		}
+		state[pattern] = rows
+	}
+	return state, nil
+}
+
+// SnapshotTable reads every key matching pattern, sorted by key. A key that
+// also matches an earlier pattern belongs to that pattern only.
+func (r *redisSnapshotter) SnapshotTable(pattern string) ([]map[string]any, error) {
+	ctx := context.Background()
+	keys, err := r.ownedKeys(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []map[string]any{}
+	for _, key := range keys {
+		row, err := r.snapshotKey(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("reading key %s: %w", key, err)
+		}
+		if row != nil {
+			rows = append(rows, row)
+		}
+	}
+	return r.excluded.drop(pattern, rows), nil
+}
+
+func (r *redisSnapshotter) snapshotKey(ctx context.Context, key string) (map[string]any, error) {
+	keyType, err := r.client.Type(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch keyType {
+	case "none":
+		// Expired or deleted between SCAN and TYPE
+		return nil, nil
+	case RedisTypeString:
+		value, err = r.client.Get(ctx, key).Result()
+	case RedisTypeHash:
+		var fields map[string]string
+		fields, err = r.client.HGetAll(ctx, key).Result()
+		m := make(map[string]any, len(fields))
+		for f, v := range fields {
+			m[f] = v
+		}
+		value = m
+	case RedisTypeList:
+		var items []string
+		items, err = r.client.LRange(ctx, key, 0, -1).Result()
+		value = toAnySlice(items)
+	case RedisTypeSet:
+		var members []string
+		members, err = r.client.SMembers(ctx, key).Result()
+		sort.Strings(members)
+		value = toAnySlice(members)
+	case RedisTypeZSet:
+		var members []redis.Z
+		members, err = r.client.ZRangeWithScores(ctx, key, 0, -1).Result()
+		items := make([]any, len(members))
+		for i, z := range members {
+			items[i] = map[string]any{"member": z.Member, "score": z.Score}
+		}
+		value = items
+	default:
+		// Streams and module types have no row representation
+		slog.Warn("skipping redis key of unsupported type", "key", key, "type", keyType)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		RedisColumnKey:   key,
+		RedisColumnType:  keyType,
+		RedisColumnValue: value,
+		RedisColumnTTL:   ttlSeconds(ttl),
+	}, nil
+}
+
+// RestoreTable deletes every key matching pattern and writes the given rows.
+func (r *redisSnapshotter) RestoreTable(pattern string, rows []map[string]any) error {
+	ctx := context.Background()
+	keys, err := r.ownedKeys(ctx, pattern)
+	if err != nil {
+		return err
+	}
+	rows = r.excluded.drop(pattern, rows)
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(keys) > 0 {
+			pipe.Del(ctx, keys...)
+		}
+		for _, row := range rows {
+			if err := restoreRedisRow(ctx, pipe, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("restoring keys %s: %w", pattern, err)
+	}
+	return nil
+}
+
+func (r *redisSnapshotter) RestoreAll(state map[string][]map[string]any) error {
+	for pattern, rows := range state {
+		if err := r.RestoreTable(pattern, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreRedisRow(ctx context.Context, pipe redis.Pipeliner, row map[string]any) error {
+	key, ok := row[RedisColumnKey].(string)
+	if !ok || key == "" {
+		return fmt.Errorf("row without a key: %v", row)
+	}
+	keyType, _ := row[RedisColumnType].(string)
+	value := row[RedisColumnValue]
+
+	pipe.Del(ctx, key)
+	switch keyType {
+	case RedisTypeString:
+		pipe.Set(ctx, key, redisString(value), 0)
+	case RedisTypeHash:
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("key %s: hash value must be an object", key)
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		args := make([]any, 0, len(fields)*2)
+		for f, v := range fields {
+			args = append(args, f, redisString(v))
+		}
+		pipe.HSet(ctx, key, args...)
+	case RedisTypeList, RedisTypeSet:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("key %s: %s value must be an array", key, keyType)
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		args := make([]any, len(items))
+		for i, item := range items {
+			args[i] = redisString(item)
+		}
+		if keyType == RedisTypeList {
+			pipe.RPush(ctx, key, args...)
+		} else {
+			pipe.SAdd(ctx, key, args...)
+		}
+	case RedisTypeZSet:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("key %s: zset value must be an array", key)
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		members := make([]redis.Z, 0, len(items))
+		for _, item := range items {
+			m, ok := item.(map[string]any)
+			if !ok {
+				return fmt.Errorf("key %s: zset members must be objects with member and score", key)
+			}
+			score, err := toFloat(m["score"])
+			if err != nil {
+				return fmt.Errorf("key %s: %w", key, err)
+			}
+			members = append(members, redis.Z{Member: redisString(m["member"]), Score: score})
+		}
+		pipe.ZAdd(ctx, key, members...)
+	default:
+		return fmt.Errorf("key %s: unsupported redis type %q", key, keyType)
+	}
+
+	if ttl, err := toFloat(row[RedisColumnTTL]); err == nil && ttl > 0 {
+		pipe.Expire(ctx, key, time.Duration(ttl)*time.Second)
+	}
+	return nil
+}
+
+// ownedKeys returns the keys matching pattern that don't match an earlier
+// pattern, sorted.
+func (r *redisSnapshotter) ownedKeys(ctx context.Context, pattern string) ([]string, error) {
+	var earlier []string
+	for _, p := range r.patterns {
+		if p == pattern {
+			break
+		}
+		earlier = append(earlier, p)
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	iter := r.client.Scan(ctx, 0, pattern, redisScanCount).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if seen[key] {
+			// SCAN may return a key more than once
+			continue
+		}
+		seen[key] = true
+		if matchesAnyPattern(key, earlier) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("scanning keys %s: %w", pattern, err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// ttlSeconds converts a PTTL result to whole seconds, rounding up so a key
+// restored with that TTL reads back the same value. Keys without an expiry
+// report -1.
+func ttlSeconds(ttl time.Duration) int64 {
+	if ttl < 0 {
+		return -1
+	}
+	return int64(math.Ceil(ttl.Seconds()))
+}
+
+func redisString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func toFloat(v any) (float64, error) {
+	switch val := v.(type) {
+	case float64:
+		return val, nil
+	case int:
+		return float64(val), nil
+	case int64:
+		return float64(val), nil
+	case string:
+		return strconv.ParseFloat(val, 64)
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", v)
+	}
+}
+
+func toAnySlice(items []string) []any {
+	out := make([]any, len(items))
+	for i, s := range items {
+		out[i] = s
+	}
+	return out
+}
+
+func matchesAnyPattern(key string, patterns []string) bool {
+	for _, p := range patterns {
+		if redisGlobMatch(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redisGlobMatch reports whether s matches a Redis glob pattern (as used by
+// KEYS and SCAN MATCH): * and ? match any characters including '/', [abc],
+// [^abc] and [a-z] match sets, and \ escapes the next character.
+func redisGlobMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if redisGlobMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		case '[':
+			if s == "" {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// Unterminated class matches a literal '['
+				if s[0] != '[' {
+					return false
+				}
+				pattern, s = pattern[1:], s[1:]
+				continue
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			if matchesClass(class, s[0]) == negate {
+				return false
+			}
+			pattern, s = pattern[end+2:], s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return s == ""
+}
+
+func matchesClass(class string, c byte) bool {
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			lo, hi := class[i], class[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				return true
+			}
+			i += 2
+			continue
+		}
+		if class[i] == c {
+			return true
+		}
+	}
+	return false
+}
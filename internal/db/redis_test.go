@@ -0,0 +1,204 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func setupTestRedis(t *testing.T, patterns []string) (*miniredis.Miniredis, Snapshotter) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+
+	mr.Set("session:1", "alice")
+	mr.SetTTL("session:1", 90*time.Second)
+	mr.HSet("cache:user:1", "name", "Alice", "email", "alice@example.com")
+	mr.Lpush("queue:jobs", "b")
+	mr.Lpush("queue:jobs", "a")
+	mr.SetAdd("tags", "z", "a", "m")
+	mr.ZAdd("leaderboard", 2.5, "bob")
+	mr.ZAdd("leaderboard", 1, "alice")
+
+	snap, err := NewSnapshotter(DBTypeRedis, "redis://"+mr.Addr(), patterns, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { snap.Close() })
+	return mr, snap
+}
+
+// roundTrip passes state through JSON the way the snapshot store does.
+func roundTrip(t *testing.T, state map[string][]map[string]any) map[string][]map[string]any {
+	t.Helper()
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string][]map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRedisSnapshotter_SnapshotAll(t *testing.T) {
+	_, snap := setupTestRedis(t, nil)
+
+	state, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := state["*"]
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 keys, got %d: %v", len(rows), rows)
+	}
+
+	byKey := make(map[string]map[string]any)
+	for _, row := range rows {
+		byKey[row[RedisColumnKey].(string)] = row
+	}
+
+	session := byKey["session:1"]
+	if session[RedisColumnValue] != "alice" || session[RedisColumnType] != RedisTypeString {
+		t.Errorf("unexpected string row: %v", session)
+	}
+	if session[RedisColumnTTL] != int64(90) {
+		t.Errorf("expected ttl 90, got %v", session[RedisColumnTTL])
+	}
+	if byKey["tags"][RedisColumnTTL] != int64(-1) {
+		t.Errorf("expected ttl -1 for key without expiry, got %v", byKey["tags"][RedisColumnTTL])
+	}
+
+	wantHash := map[string]any{"name": "Alice", "email": "alice@example.com"}
+	if !reflect.DeepEqual(byKey["cache:user:1"][RedisColumnValue], wantHash) {
+		t.Errorf("unexpected hash value: %v", byKey["cache:user:1"][RedisColumnValue])
+	}
+	if !reflect.DeepEqual(byKey["queue:jobs"][RedisColumnValue], []any{"a", "b"}) {
+		t.Errorf("unexpected list value: %v", byKey["queue:jobs"][RedisColumnValue])
+	}
+	if !reflect.DeepEqual(byKey["tags"][RedisColumnValue], []any{"a", "m", "z"}) {
+		t.Errorf("expected sorted set members, got %v", byKey["tags"][RedisColumnValue])
+	}
+	wantZSet := []any{
+		map[string]any{"member": "alice", "score": 1.0},
+		map[string]any{"member": "bob", "score": 2.5},
+	}
+	if !reflect.DeepEqual(byKey["leaderboard"][RedisColumnValue], wantZSet) {
+		t.Errorf("unexpected zset value: %v", byKey["leaderboard"][RedisColumnValue])
+	}
+}
+
+func TestRedisSnapshotter_Patterns(t *testing.T) {
+	_, snap := setupTestRedis(t, []string{"session:*", "cache:*", "*"})
+
+	state, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state["session:*"]) != 1 || len(state["cache:*"]) != 1 {
+		t.Errorf("expected one key per prefix pattern, got %v", state)
+	}
+	// Keys already captured by an earlier pattern are not repeated
+	if len(state["*"]) != 3 {
+		t.Errorf("expected 3 remaining keys under *, got %d", len(state["*"]))
+	}
+}
+
+func TestRedisSnapshotter_RestoreAll(t *testing.T) {
+	mr, snap := setupTestRedis(t, []string{"session:*", "*"})
+
+	state, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := roundTrip(t, state)
+
+	// Mutate: change, add and delete keys
+	mr.Set("session:1", "mallory")
+	mr.Set("session:2", "eve")
+	mr.Del("tags")
+	mr.HSet("cache:user:1", "name", "Changed")
+
+	if err := snap.RestoreAll(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roundTrip(t, restored), saved) {
+		t.Errorf("restored state differs:\n got %v\nwant %v", restored, saved)
+	}
+	if mr.Exists("session:2") {
+		t.Error("expected key created after the snapshot to be removed")
+	}
+	if ttl := mr.TTL("session:1"); ttl != 90*time.Second {
+		t.Errorf("expected ttl to be restored, got %v", ttl)
+	}
+}
+
+func TestComputeDiff_RedisKeys(t *testing.T) {
+	before := map[string][]map[string]any{
+		"*": {{"key": "a", "type": "string", "value": "1", "ttl": -1}},
+	}
+	after := map[string][]map[string]any{
+		"*": {{"key": "a", "type": "string", "value": "2", "ttl": -1}},
+	}
+	diffs := ComputeDiff(before, after, nil)
+	d := diffs["*"]
+	if len(d.Modified) != 1 || len(d.Added) != 0 || len(d.Removed) != 0 {
+		t.Errorf("expected key to be matched as modified, got %+v", d)
+	}
+}
+
+func TestRedisGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"*", "any/thing", true},
+		{"session:*", "session:1", true},
+		{"session:*", "cache:1", false},
+		{"user:?", "user:1", true},
+		{"user:?", "user:12", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{`literal\*`, "literal*", true},
+		{`literal\*`, "literalx", false},
+	}
+	for _, tt := range tests {
+		if got := redisGlobMatch(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("redisGlobMatch(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRedisSnapshotter_ExcludeTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.Set("session:1", "alice")
+	mr.SetTTL("session:1", time.Minute)
+
+	snap, err := Open([]Target{{
+		Type:           DBTypeRedis,
+		ConnString:     "redis://" + mr.Addr(),
+		Tables:         []string{"session:*"},
+		ExcludeColumns: map[string][]string{"session:*": {RedisColumnTTL}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	rows, err := snap.SnapshotTable("session:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rows[0][RedisColumnTTL]; ok || rows[0][RedisColumnValue] != "alice" {
+		t.Errorf("expected ttl to be excluded, got %v", rows[0])
+	}
+}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// SchemaSnapshotter is implemented by snapshotters that can describe the
+// structure of their tables. The SQL snapshotters support it; Redis and
+// DynamoDB have no fixed schema.
+type SchemaSnapshotter interface {
+	// SnapshotSchema returns the columns and indexes of every table.
+	SnapshotSchema() (map[string]snapshot.TableSchema, error)
+}
+
+func (b *baseSnapshotter) SnapshotSchema() (map[string]snapshot.TableSchema, error) {
+	tables, err := b.Tables()
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make(map[string]snapshot.TableSchema, len(tables))
+	for _, table := range tables {
+		ts, err := b.tableSchema(table)
+		if err != nil {
+			return nil, fmt.Errorf("reading schema of %s: %w", table, err)
+		}
+		schema[table] = ts
+	}
+	return schema, nil
+}
+
+func (b *baseSnapshotter) tableSchema(table string) (snapshot.TableSchema, error) {
+	columnsQuery, indexesQuery, args := b.schemaQueries(table)
+	ts := snapshot.TableSchema{Columns: []snapshot.ColumnSchema{}}
+
+	rows, err := b.db.Query(columnsQuery, args...)
+	if err != nil {
+		return ts, err
+	}
+	for rows.Next() {
+		var c snapshot.ColumnSchema
+		if err := rows.Scan(&c.Name, &c.Type, &c.Nullable); err != nil {
+			rows.Close()
+			return ts, err
+		}
+		c.Type = strings.ToLower(c.Type)
+		ts.Columns = append(ts.Columns, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return ts, err
+	}
+	if len(ts.Columns) == 0 {
+		return ts, fmt.Errorf("table not found")
+	}
+
+	// One row per index column, ordered by index name and column position
+	rows, err = b.db.Query(indexesQuery, args...)
+	if err != nil {
+		return ts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, column string
+		var unique bool
+		if err := rows.Scan(&name, &unique, &column); err != nil {
+			return ts, err
+		}
+		if n := len(ts.Indexes); n > 0 && ts.Indexes[n-1].Name == name {
+			ts.Indexes[n-1].Columns = append(ts.Indexes[n-1].Columns, column)
+			continue
+		}
+		ts.Indexes = append(ts.Indexes, snapshot.IndexSchema{Name: name, Columns: []string{column}, Unique: unique})
+	}
+	return ts, rows.Err()
+}
+
+// schemaQueries returns the queries listing a table's columns as
+// (name, type, nullable) and its index columns as (index, unique, column).
+func (b *baseSnapshotter) schemaQueries(table string) (columns, indexes string, args []any) {
+	switch b.dbType {
+	case DBTypePostgres:
+		return `SELECT a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull
+				FROM pg_attribute a
+				WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+				ORDER BY a.attnum`,
+			`SELECT c.relname, ix.indisunique, pg_get_indexdef(ix.indexrelid, k + 1, true)
+				FROM pg_index ix
+				JOIN pg_class c ON c.oid = ix.indexrelid
+				CROSS JOIN LATERAL generate_subscripts(ix.indkey, 1) AS k
+				WHERE ix.indrelid = $1::regclass
+				ORDER BY c.relname, k`,
+			[]any{b.quoteIdentifier(table)}
+	case DBTypeMySQL:
+		schema, name := splitQualifiedName(table)
+		return `SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE = 'YES'
+				FROM information_schema.COLUMNS
+				WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?
+				ORDER BY ORDINAL_POSITION`,
+			`SELECT INDEX_NAME, NON_UNIQUE = 0, COLUMN_NAME
+				FROM information_schema.STATISTICS
+				WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?
+				ORDER BY INDEX_NAME, SEQ_IN_INDEX`,
+			[]any{schema, name}
+	case DBTypeMSSQL:
+		quotedTable := b.quoteIdentifier(table)
+		return `SELECT c.name, TYPE_NAME(c.user_type_id) +
+					CASE WHEN TYPE_NAME(c.user_type_id) IN ('varchar', 'char', 'varbinary', 'binary')
+						THEN '(' + CASE WHEN c.max_length = -1 THEN 'max' ELSE CAST(c.max_length AS varchar(10)) END + ')'
+					WHEN TYPE_NAME(c.user_type_id) IN ('nvarchar', 'nchar')
+						THEN '(' + CASE WHEN c.max_length = -1 THEN 'max' ELSE CAST(c.max_length / 2 AS varchar(10)) END + ')'
+					WHEN TYPE_NAME(c.user_type_id) IN ('decimal', 'numeric')
+						THEN '(' + CAST(c.precision AS varchar(10)) + ',' + CAST(c.scale AS varchar(10)) + ')'
+					ELSE '' END,
+					c.is_nullable
+				FROM sys.columns c
+				WHERE c.object_id = OBJECT_ID(@p1)
+				ORDER BY c.column_id`,
+			`SELECT i.name, i.is_unique, c.name
+				FROM sys.indexes i
+				JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+				JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+				WHERE i.object_id = OBJECT_ID(@p1) AND i.name IS NOT NULL AND ic.key_ordinal > 0
+				ORDER BY i.name, ic.key_ordinal`,
+			[]any{quotedTable}
+	default:
+		return `SELECT name, type, "notnull" = 0 FROM pragma_table_info(?) ORDER BY cid`,
+			`SELECT il.name, il."unique", ii.name
+				FROM pragma_index_list(?1) AS il, pragma_index_info(il.name) AS ii
+				ORDER BY il.name, ii.seqno`,
+			[]any{table}
+	}
+}
+
+// SnapshotSchema returns the schemas of the member databases that support
+// it, with table names prefixed like the state.
+func (m *multiSnapshotter) SnapshotSchema() (map[string]snapshot.TableSchema, error) {
+	schema := make(map[string]snapshot.TableSchema)
+	for _, member := range m.members {
+		ss, ok := member.Snapshotter.(SchemaSnapshotter)
+		if !ok {
+			continue
+		}
+		memberSchema, err := ss.SnapshotSchema()
+		if err != nil {
+			return nil, fmt.Errorf("database %s: %w", member.name, err)
+		}
+		for table, ts := range memberSchema {
+			schema[member.name+"."+table] = ts
+		}
+	}
+	return schema, nil
+}
+
+// DiffSchema compares the recorded schema of each table with its current
+// schema and describes every difference, e.g. "users.email: type text, now
+// varchar(255)". Tables that exist only in actual are not reported, since
+// the recording never touched them.
+func DiffSchema(expected, actual map[string]snapshot.TableSchema) []string {
+	var diffs []string
+	for _, table := range sortedKeys(expected) {
+		want := expected[table]
+		got, ok := actual[table]
+		if !ok {
+			diffs = append(diffs, table+": table no longer exists")
+			continue
+		}
+		diffs = append(diffs, diffColumns(table, want.Columns, got.Columns)...)
+		diffs = append(diffs, diffIndexes(table, want.Indexes, got.Indexes)...)
+	}
+	return diffs
+}
+
+func diffColumns(table string, want, got []snapshot.ColumnSchema) []string {
+	var diffs []string
+	gotByName := make(map[string]snapshot.ColumnSchema, len(got))
+	for _, c := range got {
+		gotByName[c.Name] = c
+	}
+	wantNames := make(map[string]bool, len(want))
+	for _, w := range want {
+		wantNames[w.Name] = true
+		g, ok := gotByName[w.Name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s.%s: column removed", table, w.Name))
+			continue
+		}
+		if !strings.EqualFold(w.Type, g.Type) {
+			diffs = append(diffs, fmt.Sprintf("%s.%s: type %s, now %s", table, w.Name, w.Type, g.Type))
+		}
+		if w.Nullable != g.Nullable {
+			diffs = append(diffs, fmt.Sprintf("%s.%s: %s, now %s", table, w.Name, nullability(w.Nullable), nullability(g.Nullable)))
+		}
+	}
+	for _, g := range got {
+		if !wantNames[g.Name] {
+			diffs = append(diffs, fmt.Sprintf("%s.%s: column added (%s %s)", table, g.Name, g.Type, nullability(g.Nullable)))
+		}
+	}
+	return diffs
+}
+
+func diffIndexes(table string, want, got []snapshot.IndexSchema) []string {
+	var diffs []string
+	gotByName := make(map[string]snapshot.IndexSchema, len(got))
+	for _, ix := range got {
+		gotByName[ix.Name] = ix
+	}
+	wantNames := make(map[string]bool, len(want))
+	for _, w := range want {
+		wantNames[w.Name] = true
+		g, ok := gotByName[w.Name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: index %s removed", table, w.Name))
+			continue
+		}
+		if describeIndex(w) != describeIndex(g) {
+			diffs = append(diffs, fmt.Sprintf("%s: index %s was %s, now %s", table, w.Name, describeIndex(w), describeIndex(g)))
+		}
+	}
+	for _, g := range got {
+		if !wantNames[g.Name] {
+			diffs = append(diffs, fmt.Sprintf("%s: index %s added %s", table, g.Name, describeIndex(g)))
+		}
+	}
+	return diffs
+}
+
+func describeIndex(ix snapshot.IndexSchema) string {
+	desc := "(" + strings.Join(ix.Columns, ", ") + ")"
+	if ix.Unique {
+		desc = "unique " + desc
+	}
+	return desc
+}
+
+func nullability(nullable bool) string {
+	if nullable {
+		return "nullable"
+	}
+	return "NOT NULL"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
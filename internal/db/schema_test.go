@@ -0,0 +1,92 @@
+package db
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestSQLiteSnapshotter_SnapshotSchema(t *testing.T) {
+	dbPath := setupTestDB(t)
+	raw, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec("CREATE UNIQUE INDEX idx_users_email ON users (email, name)"); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := NewSnapshotter("sqlite", dbPath, []string{"users"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	schema, err := snap.(SchemaSnapshotter).SnapshotSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := snapshot.TableSchema{
+		Columns: []snapshot.ColumnSchema{
+			{Name: "id", Type: "integer", Nullable: true},
+			{Name: "name", Type: "text", Nullable: true},
+			{Name: "email", Type: "text", Nullable: true},
+		},
+		Indexes: []snapshot.IndexSchema{
+			{Name: "idx_users_email", Columns: []string{"email", "name"}, Unique: true},
+		},
+	}
+	if !reflect.DeepEqual(schema["users"], want) {
+		t.Errorf("unexpected schema:\n got %+v\nwant %+v", schema["users"], want)
+	}
+}
+
+func TestDiffSchema(t *testing.T) {
+	expected := map[string]snapshot.TableSchema{
+		"users": {
+			Columns: []snapshot.ColumnSchema{
+				{Name: "id", Type: "integer"},
+				{Name: "email", Type: "text", Nullable: true},
+				{Name: "nickname", Type: "text", Nullable: true},
+			},
+			Indexes: []snapshot.IndexSchema{
+				{Name: "idx_email", Columns: []string{"email"}},
+				{Name: "idx_old", Columns: []string{"nickname"}},
+			},
+		},
+		"audit": {Columns: []snapshot.ColumnSchema{{Name: "id", Type: "integer"}}},
+	}
+	actual := map[string]snapshot.TableSchema{
+		"users": {
+			Columns: []snapshot.ColumnSchema{
+				{Name: "id", Type: "INTEGER"},
+				{Name: "email", Type: "varchar(255)"},
+				{Name: "age", Type: "integer", Nullable: true},
+			},
+			Indexes: []snapshot.IndexSchema{
+				{Name: "idx_email", Columns: []string{"email"}, Unique: true},
+			},
+		},
+		"unrelated": {Columns: []snapshot.ColumnSchema{{Name: "id", Type: "integer"}}},
+	}
+
+	want := []string{
+		"audit: table no longer exists",
+		"users.email: type text, now varchar(255)",
+		"users.email: nullable, now NOT NULL",
+		"users.nickname: column removed",
+		"users.age: column added (integer nullable)",
+		"users: index idx_email was (email), now unique (email)",
+		"users: index idx_old removed",
+	}
+	if got := DiffSchema(expected, actual); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected schema diff:\n got %q\nwant %q", got, want)
+	}
+
+	if got := DiffSchema(expected, expected); len(got) != 0 {
+		t.Errorf("expected no differences for identical schemas, got %q", got)
+	}
+}
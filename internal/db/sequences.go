@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// queryRower is satisfied by *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// resetSequences points each restored table's ID generator just past the
+// highest restored ID, so rows inserted during replay get the same IDs they
+// got when the snapshot was recorded. DELETE leaves these counters where
+// they were, so without this every replay would hand out new IDs.
+func (b *baseSnapshotter) resetSequences(tables []string) error {
+	for _, table := range tables {
+		var err error
+		switch b.dbType {
+		case DBTypePostgres:
+			err = b.resetPostgresSequences(table)
+		case DBTypeMySQL:
+			err = b.resetMySQLAutoIncrement(table)
+		case DBTypeSQLite:
+			err = b.resetSQLiteSequence(table)
+		case DBTypeMSSQL:
+			err = b.resetMSSQLIdentity(table)
+		}
+		if err != nil {
+			return fmt.Errorf("resetting sequences for %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// resetPostgresSequences resets the sequences owned by serial and identity
+// columns with setval, so the next value is MAX(column) + 1.
+func (b *baseSnapshotter) resetPostgresSequences(table string) error {
+	quotedTable := b.quoteIdentifier(table)
+	rows, err := b.db.Query(`SELECT a.attname, pg_get_serial_sequence($1, a.attname)
+		FROM pg_attribute a
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		AND pg_get_serial_sequence($1, a.attname) IS NOT NULL`, quotedTable)
+	if err != nil {
+		return err
+	}
+	type sequence struct{ column, name string }
+	var sequences []sequence
+	for rows.Next() {
+		var s sequence
+		if err := rows.Scan(&s.column, &s.name); err != nil {
+			rows.Close()
+			return err
+		}
+		sequences = append(sequences, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range sequences {
+		query := fmt.Sprintf("SELECT setval($1, COALESCE((SELECT MAX(%s) FROM %s), 0) + 1, false)",
+			b.quoteIdentifier(s.column), quotedTable)
+		if _, err := b.db.Exec(query, s.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetMySQLAutoIncrement lowers the AUTO_INCREMENT counter of tables that
+// have one. InnoDB never sets the counter at or below the highest value in
+// use, so asking for 1 yields MAX(column) + 1.
+func (b *baseSnapshotter) resetMySQLAutoIncrement(table string) error {
+	schema, name := splitQualifiedName(table)
+	var count int
+	err := b.db.QueryRow(`SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ? AND EXTRA LIKE '%auto_increment%'`,
+		schema, name).Scan(&count)
+	if err != nil || count == 0 {
+		return err
+	}
+	_, err = b.db.Exec("ALTER TABLE " + b.quoteIdentifier(table) + " AUTO_INCREMENT = 1")
+	return err
+}
+
+// resetSQLiteSequence resets the sqlite_sequence entry of AUTOINCREMENT
+// tables. Other tables already reuse MAX(rowid) + 1.
+func (b *baseSnapshotter) resetSQLiteSequence(table string) error {
+	var exists int
+	if err := b.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'").Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return nil
+	}
+	_, err := b.db.Exec("UPDATE sqlite_sequence SET seq = (SELECT COALESCE(MAX(rowid), 0) FROM "+b.quoteIdentifier(table)+") WHERE name = ?", table)
+	return err
+}
+
+// resetMSSQLIdentity reseeds the identity column so the next value is
+// MAX(column) + increment, or the seed for an empty table.
+func (b *baseSnapshotter) resetMSSQLIdentity(table string) error {
+	quotedTable := b.quoteIdentifier(table)
+	column, err := mssqlIdentityColumn(b.db, quotedTable)
+	if err != nil || column == "" {
+		return err
+	}
+	literal := "N'" + strings.ReplaceAll(quotedTable, "'", "''") + "'"
+	query := fmt.Sprintf(`DECLARE @reseed BIGINT = (SELECT MAX(%s) FROM %s);
+		IF @reseed IS NULL SET @reseed = IDENT_SEED(%s) - IDENT_INCR(%s);
+		DBCC CHECKIDENT (%s, RESEED, @reseed) WITH NO_INFOMSGS;`,
+		b.quoteIdentifier(column), quotedTable, literal, literal, literal)
+	_, err = b.db.Exec(query)
+	return err
+}
+
+// splitQualifiedName splits "schema.table" into its parts; schema is "" for
+// an unqualified name.
+func splitQualifiedName(table string) (schema, name string) {
+	if s, n, ok := strings.Cut(table, "."); ok {
+		return s, n
+	}
+	return "", table
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
 )
 
 // Snapshotter captures and restores database state.
@@ -24,8 +25,8 @@ type Snapshotter interface {
 }
 
 // NewSnapshotter creates a Snapshotter for the given database type.
-// The namespaces parameter specifies which schemas (postgres) or databases (mysql) to scan.
-// If empty, defaults to "public" for postgres or the current database for mysql.
+// The namespaces parameter specifies which schemas (postgres, mssql) or databases (mysql) to scan.
+// If empty, defaults to "public" for postgres, "dbo" for mssql or the current database for mysql.
 func NewSnapshotter(dbType, connString string, tables, namespaces []string) (Snapshotter, error) {
 	switch dbType {
 	case DBTypePostgres:
@@ -34,6 +35,12 @@ func NewSnapshotter(dbType, connString string, tables, namespaces []string) (Sna
 		return newMySQLSnapshotter(connString, tables, namespaces)
 	case DBTypeSQLite:
 		return newSQLiteSnapshotter(connString, tables)
+	case DBTypeMSSQL:
+		return newMSSQLSnapshotter(connString, tables, namespaces)
+	case DBTypeRedis:
+		return newRedisSnapshotter(connString, tables)
+	case DBTypeDynamoDB:
+		return newDynamoSnapshotter(connString, tables)
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
@@ -43,8 +50,17 @@ func NewSnapshotter(dbType, connString string, tables, namespaces []string) (Sna
 type baseSnapshotter struct {
 	db               *sql.DB
 	configuredTables []string
-	namespaces       []string // schemas (postgres) or databases (mysql) to scan
+	namespaces       []string // schemas (postgres, mssql) or databases (mysql) to scan
 	dbType           string
+	excluded         excludedColumns
+	filters          map[string]string // table -> WHERE condition limiting snapshot and restore
+	restoreMode      string            // RestoreModeInsert or RestoreModeBulk
+	changeSchema     string            // schema holding the change log, once change tracking is installed
+	views            map[string]bool   // view -> materialized, when views are included; never restored
+	refreshViews     bool              // refresh materialized views before after-request snapshots
+
+	binaryMu   sync.Mutex
+	binaryCols map[string]map[string]bool // table -> binary columns, looked up to restore legacy string values
 }
 
 func (b *baseSnapshotter) Close() error {
@@ -69,43 +85,68 @@ func (b *baseSnapshotter) SnapshotAll() (map[string][]map[string]any, error) {
 }
 
 func (b *baseSnapshotter) RestoreAll(state map[string][]map[string]any) error {
+	tables := make([]string, 0, len(state))
+	for table := range state {
+		if !b.isView(table) {
+			tables = append(tables, table)
+		}
+	}
+
 	// Disable FK checks during restore
-	if err := b.disableFKChecks(); err != nil {
+	if err := b.disableFKChecks(tables); err != nil {
 		return fmt.Errorf("disabling FK checks: %w", err)
 	}
 	defer func() {
-		if err := b.enableFKChecks(); err != nil {
+		if err := b.enableFKChecks(tables); err != nil {
 			slog.Warn("failed to re-enable FK checks", "error", err)
 		}
 	}()
 
-	for table, rows := range state {
-		if err := b.RestoreTable(table, rows); err != nil {
+	for _, table := range tables {
+		if err := b.RestoreTable(table, state[table]); err != nil {
 			return fmt.Errorf("restoring table %s: %w", table, err)
 		}
 	}
-	return nil
+	return b.resetSequences(tables)
 }
 
 func (b *baseSnapshotter) Tables() ([]string, error) {
 	if len(b.configuredTables) > 0 {
 		return b.configuredTables, nil
 	}
-	return b.discoverTables()
+	tables, err := b.discoverTables()
+	if err != nil {
+		return nil, err
+	}
+	return append(withoutChangeLog(tables), b.viewNames()...), nil
 }
 
 func (b *baseSnapshotter) SnapshotTable(table string) ([]map[string]any, error) {
 	quotedTable := b.quoteIdentifier(table)
-	rows, err := b.db.Query("SELECT * FROM " + quotedTable)
+	selectList, err := b.selectList(table)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := b.db.Query("SELECT " + selectList + " FROM " + quotedTable + b.where(table))
 	if err != nil {
 		return nil, fmt.Errorf("querying table %s: %w", table, err)
 	}
+	return b.scanRows(rows)
+}
+
+// scanRows reads every row of a query result into column -> value maps and
+// closes rows.
+func (b *baseSnapshotter) scanRows(rows *sql.Rows) ([]map[string]any, error) {
 	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
 		return nil, err
 	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
 
 	var result []map[string]any
 	for rows.Next() {
@@ -122,9 +163,17 @@ func (b *baseSnapshotter) SnapshotTable(table string) ([]map[string]any, error)
 		row := make(map[string]any)
 		for i, col := range columns {
 			val := values[i]
-			// Convert []byte to string for readability
-			if b, ok := val.([]byte); ok {
-				row[col] = string(b)
+			if b.dbType == DBTypeMSSQL {
+				val = mssqlValue(columnTypes[i], val)
+			}
+			// Convert []byte to string for readability; binary columns are
+			// base64-encoded so non-UTF-8 bytes survive
+			if raw, ok := val.([]byte); ok {
+				if b.isBinaryColumn(columnTypes[i]) {
+					row[col] = encodeBinary(raw)
+				} else {
+					row[col] = string(raw)
+				}
 			} else {
 				row[col] = val
 			}
@@ -142,39 +191,75 @@ func (b *baseSnapshotter) SnapshotTable(table string) ([]map[string]any, error)
 // Security: This function uses parameterized queries for all data values to prevent SQL injection.
 // Table and column names are quoted using quoteIdentifier() to handle special characters safely.
 func (b *baseSnapshotter) RestoreTable(table string, rows []map[string]any) error {
+	if b.isView(table) {
+		// Views are derived from the tables and restored with them
+		return nil
+	}
+	rows = b.excluded.drop(table, rows)
+	binary, err := b.binaryColumns(table, rows)
+	if err != nil {
+		return err
+	}
+	rows, err = decodeBinaryRows(table, rows, binary)
+	if err != nil {
+		return err
+	}
+	if b.dbType == DBTypeMSSQL {
+		return b.restoreMSSQLTable(table, rows)
+	}
+	if b.dbType == DBTypePostgres && b.restoreMode == RestoreModeBulk {
+		return b.copyPostgresTable(table, rows)
+	}
 	quotedTable := b.quoteIdentifier(table)
 
-	// Truncate (using DELETE instead of TRUNCATE for better compatibility)
-	if _, err := b.db.Exec("DELETE FROM " + quotedTable); err != nil {
+	// Truncate (using DELETE instead of TRUNCATE for better compatibility).
+	// A filtered table only loses the rows its snapshot covers.
+	if _, err := b.db.Exec("DELETE FROM " + quotedTable + b.where(table)); err != nil {
 		return fmt.Errorf("truncating table %s: %w", table, err)
 	}
 
-	// Insert rows
-	for _, row := range rows {
-		if len(row) == 0 {
-			continue
-		}
-		columns := make([]string, 0, len(row))
-		placeholders := make([]string, 0, len(row))
-		values := make([]any, 0, len(row))
-
-		i := 0
-		for col, val := range row {
-			columns = append(columns, b.quoteIdentifier(col))
-			placeholders = append(placeholders, b.placeholder(i))
-			values = append(values, val)
-			i++
-		}
+	return b.insertRows(b.db, table, rows)
+}
 
-		// Use parameterized query for values (SQL injection safe)
-		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-			quotedTable,
-			strings.Join(columns, ", "),
-			strings.Join(placeholders, ", "))
+// where returns the WHERE clause for a filtered table, or "" for an
+// unfiltered one. Filters come from the config file and are trusted SQL.
+func (b *baseSnapshotter) where(table string) string {
+	if filter := b.filters[table]; filter != "" {
+		return " WHERE " + filter
+	}
+	return ""
+}
 
-		if _, err := b.db.Exec(query, values...); err != nil {
-			return fmt.Errorf("inserting into %s: %w", table, err)
-		}
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertRow inserts one row with a parameterized query.
+func (b *baseSnapshotter) insertRow(db execer, table string, row map[string]any) error {
+	if len(row) == 0 {
+		return nil
+	}
+	columns := make([]string, 0, len(row))
+	placeholders := make([]string, 0, len(row))
+	values := make([]any, 0, len(row))
+
+	i := 0
+	for col, val := range row {
+		columns = append(columns, b.quoteIdentifier(col))
+		placeholders = append(placeholders, b.placeholder(i))
+		values = append(values, val)
+		i++
+	}
+
+	// Use parameterized query for values (SQL injection safe)
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		b.quoteIdentifier(table),
+		strings.Join(columns, ", "),
+		strings.Join(placeholders, ", "))
+
+	if _, err := db.Exec(query, values...); err != nil {
+		return fmt.Errorf("inserting into %s: %w", table, err)
 	}
 	return nil
 }
@@ -187,6 +272,8 @@ func (b *baseSnapshotter) discoverTables() ([]string, error) {
 		return b.discoverMySQLTables()
 	case DBTypeSQLite:
 		return b.queryStrings(SQLiteDiscoverTablesQuery)
+	case DBTypeMSSQL:
+		return b.discoverMSSQLTables()
 	default:
 		return nil, fmt.Errorf("unsupported db type for discovery: %s", b.dbType)
 	}
@@ -238,7 +325,8 @@ func (b *baseSnapshotter) discoverPostgresTables() ([]string, error) {
 
 // discoverMySQLTables discovers tables in the configured databases.
 // When scanning multiple databases, table names are database-qualified (database.table).
-// When no namespaces are configured, uses SHOW TABLES for the current database.
+// When no namespaces are configured, scans the current database. Views are
+// left out; they are added by Tables when views are included.
 func (b *baseSnapshotter) discoverMySQLTables() ([]string, error) {
 	if len(b.namespaces) == 0 {
 		return b.queryStrings(MySQLDiscoverTablesQuery)
@@ -274,8 +362,8 @@ func (b *baseSnapshotter) discoverMySQLTables() ([]string, error) {
 	return result, rows.Err()
 }
 
-func (b *baseSnapshotter) queryStrings(query string) ([]string, error) {
-	rows, err := b.db.Query(query)
+func (b *baseSnapshotter) queryStrings(query string, args ...any) ([]string, error) {
+	rows, err := b.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -295,6 +383,7 @@ func (b *baseSnapshotter) queryStrings(query string) ([]string, error) {
 // quoteIdentifier properly quotes database identifiers (table/column names) to prevent SQL injection.
 // Different databases use different quoting mechanisms:
 //   - MySQL: backticks `table_name`
+//   - SQL Server: brackets [table_name]
 //   - PostgreSQL/SQLite: double quotes "table_name"
 //
 // Supports schema-qualified names (e.g., "myschema.mytable") by splitting on "." and quoting
@@ -319,6 +408,8 @@ func (b *baseSnapshotter) quoteSingleIdentifier(name string) string {
 	switch b.dbType {
 	case DBTypeMySQL:
 		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	case DBTypeMSSQL:
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
 	default:
 		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
 	}
@@ -328,12 +419,17 @@ func (b *baseSnapshotter) placeholder(index int) string {
 	switch b.dbType {
 	case DBTypePostgres:
 		return fmt.Sprintf("$%d", index+1)
+	case DBTypeMSSQL:
+		return fmt.Sprintf("@p%d", index+1)
 	default:
 		return "?"
 	}
 }
 
-func (b *baseSnapshotter) disableFKChecks() error {
+// disableFKChecks turns off foreign key enforcement while tables are
+// restored. SQL Server has no session switch, so the constraints of each
+// table being restored are disabled instead.
+func (b *baseSnapshotter) disableFKChecks(tables []string) error {
 	switch b.dbType {
 	case DBTypePostgres:
 		_, err := b.db.Exec("SET session_replication_role = 'replica'")
@@ -344,11 +440,13 @@ func (b *baseSnapshotter) disableFKChecks() error {
 	case DBTypeSQLite:
 		_, err := b.db.Exec("PRAGMA foreign_keys = OFF")
 		return err
+	case DBTypeMSSQL:
+		return b.alterMSSQLConstraints(tables, "NOCHECK")
 	}
 	return nil
 }
 
-func (b *baseSnapshotter) enableFKChecks() error {
+func (b *baseSnapshotter) enableFKChecks(tables []string) error {
 	var err error
 	switch b.dbType {
 	case DBTypePostgres:
@@ -357,6 +455,8 @@ func (b *baseSnapshotter) enableFKChecks() error {
 		_, err = b.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
 	case DBTypeSQLite:
 		_, err = b.db.Exec("PRAGMA foreign_keys = ON")
+	case DBTypeMSSQL:
+		err = b.alterMSSQLConstraints(tables, "CHECK")
 	}
 	return err
 }
@@ -167,6 +167,49 @@ func TestSQLiteSnapshotter_RestoreAll(t *testing.T) {
 	}
 }
 
+func TestSQLiteSnapshotter_RestoreResetsAutoincrement(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "seq.db")
+	raw, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	_, err = raw.Exec(`
+		CREATE TABLE events (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT);
+		INSERT INTO events (name) VALUES ('a'), ('b');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := NewSnapshotter("sqlite", dbPath, []string{"events"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	recorded, err := snap.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A previous replay inserted more rows, advancing the counter
+	if _, err := raw.Exec("INSERT INTO events (name) VALUES ('c'), ('d')"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := snap.RestoreAll(recorded); err != nil {
+		t.Fatal(err)
+	}
+	res, err := raw.Exec("INSERT INTO events (name) VALUES ('new')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := res.LastInsertId(); id != 3 {
+		t.Errorf("expected the next id after restore to be 3, got %d", id)
+	}
+}
+
 func TestSQLiteSnapshotter_EmptyTable(t *testing.T) {
 	dir := t.TempDir()
 	dbPath := filepath.Join(dir, "empty.db")
@@ -204,7 +247,7 @@ func TestSQLiteSnapshotter_InvalidPath(t *testing.T) {
 }
 
 func TestUnsupportedDBType(t *testing.T) {
-	_, err := NewSnapshotter("redis", "localhost:6379", nil, nil)
+	_, err := NewSnapshotter("cassandra", "localhost:9042", nil, nil)
 	if err == nil {
 		t.Fatal("expected error for unsupported db type")
 	}
@@ -234,6 +277,40 @@ func TestQuoteIdentifier_SchemaQualified(t *testing.T) {
 	}
 }
 
+func TestQuoteIdentifier_MSSQL(t *testing.T) {
+	ms := &baseSnapshotter{dbType: DBTypeMSSQL}
+
+	tests := map[string]string{
+		"users":        "[users]",
+		"sales.orders": "[sales].[orders]",
+		"odd]name":     "[odd]]name]",
+		"with space":   "[with space]",
+	}
+	for in, want := range tests {
+		if got := ms.quoteIdentifier(in); got != want {
+			t.Errorf("mssql quoteIdentifier(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	tests := []struct {
+		dbType string
+		want   string
+	}{
+		{DBTypePostgres, "$2"},
+		{DBTypeMySQL, "?"},
+		{DBTypeSQLite, "?"},
+		{DBTypeMSSQL, "@p2"},
+	}
+	for _, tt := range tests {
+		b := &baseSnapshotter{dbType: tt.dbType}
+		if got := b.placeholder(1); got != tt.want {
+			t.Errorf("%s placeholder: expected %q, got %q", tt.dbType, tt.want, got)
+		}
+	}
+}
+
 func TestNamespacesStoredInSnapshotter(t *testing.T) {
 	dbPath := setupTestDB(t)
 
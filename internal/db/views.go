@@ -0,0 +1,155 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ViewRefresher is implemented by snapshotters that snapshot materialized
+// views, which only reflect the tables they are derived from once refreshed.
+type ViewRefresher interface {
+	// RefreshViews refreshes every snapshotted materialized view.
+	RefreshViews() error
+}
+
+// RefreshViews refreshes the materialized views of s, if it has any. Call it
+// before the snapshot taken after a request, so a materialized view that
+// would disagree with its tables is caught.
+func RefreshViews(s Snapshotter) error {
+	if vr, ok := s.(ViewRefresher); ok {
+		return vr.RefreshViews()
+	}
+	return nil
+}
+
+// loadViews discovers the views and materialized views of the scanned
+// namespaces. Views are snapshotted like tables but never restored.
+func (b *baseSnapshotter) loadViews() error {
+	var query string
+	var args []any
+	switch b.dbType {
+	case DBTypePostgres:
+		namespaces := b.namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{"public"}
+		}
+		placeholders := make([]string, len(namespaces))
+		for i, ns := range namespaces {
+			placeholders[i] = b.placeholder(i)
+			args = append(args, ns)
+		}
+		in := strings.Join(placeholders, ", ")
+		query = fmt.Sprintf(
+			"SELECT schemaname, viewname, false FROM pg_views WHERE schemaname IN (%s) "+
+				"UNION ALL SELECT schemaname, matviewname, true FROM pg_matviews WHERE schemaname IN (%s)",
+			in, in)
+	case DBTypeMySQL:
+		query = "SELECT TABLE_SCHEMA, TABLE_NAME, false FROM information_schema.views WHERE TABLE_SCHEMA = DATABASE()"
+		if len(b.namespaces) > 0 {
+			placeholders := make([]string, len(b.namespaces))
+			for i, ns := range b.namespaces {
+				placeholders[i] = "?"
+				args = append(args, ns)
+			}
+			query = fmt.Sprintf("SELECT TABLE_SCHEMA, TABLE_NAME, false FROM information_schema.views WHERE TABLE_SCHEMA IN (%s)", strings.Join(placeholders, ", "))
+		}
+	case DBTypeSQLite:
+		query = "SELECT 'main', name, 0 FROM sqlite_master WHERE type = 'view'"
+	case DBTypeMSSQL:
+		namespaces := b.namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{mssqlDefaultSchema}
+		}
+		placeholders := make([]string, len(namespaces))
+		for i, ns := range namespaces {
+			placeholders[i] = b.placeholder(i)
+			args = append(args, ns)
+		}
+		query = fmt.Sprintf("SELECT TABLE_SCHEMA, TABLE_NAME, 0 FROM INFORMATION_SCHEMA.VIEWS WHERE TABLE_SCHEMA IN (%s)", strings.Join(placeholders, ", "))
+	default:
+		return fmt.Errorf("views are not supported for %s", b.dbType)
+	}
+
+	rows, err := b.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("discovering views: %w", err)
+	}
+	defer rows.Close()
+
+	b.views = make(map[string]bool)
+	for rows.Next() {
+		var schema, name string
+		var materialized bool
+		if err := rows.Scan(&schema, &name, &materialized); err != nil {
+			return err
+		}
+		b.views[b.qualifyDiscovered(schema, name)] = materialized
+	}
+	return rows.Err()
+}
+
+// qualifyDiscovered names a discovered table or view the way table
+// discovery does: unqualified in the default namespace, schema.name
+// otherwise.
+func (b *baseSnapshotter) qualifyDiscovered(schema, name string) string {
+	switch b.dbType {
+	case DBTypePostgres:
+		if len(b.namespaces) == 0 || (len(b.namespaces) == 1 && b.namespaces[0] == "public") {
+			return name
+		}
+	case DBTypeMySQL:
+		if len(b.namespaces) == 0 {
+			return name
+		}
+	case DBTypeMSSQL:
+		if len(b.namespaces) == 0 || (len(b.namespaces) == 1 && b.namespaces[0] == mssqlDefaultSchema) {
+			return name
+		}
+	default:
+		return name
+	}
+	return schema + "." + name
+}
+
+// viewNames returns the discovered views in name order.
+func (b *baseSnapshotter) viewNames() []string {
+	names := make([]string, 0, len(b.views))
+	for name := range b.views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isView reports whether table is a discovered view or materialized view.
+func (b *baseSnapshotter) isView(table string) bool {
+	_, ok := b.views[table]
+	return ok
+}
+
+// RefreshViews refreshes the materialized views when refreshing is enabled.
+func (b *baseSnapshotter) RefreshViews() error {
+	if !b.refreshViews {
+		return nil
+	}
+	for _, name := range b.viewNames() {
+		if !b.views[name] {
+			continue
+		}
+		if _, err := b.db.Exec("REFRESH MATERIALIZED VIEW " + b.quoteIdentifier(name)); err != nil {
+			return fmt.Errorf("refreshing materialized view %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// RefreshViews refreshes the materialized views of every member database.
+func (m *multiSnapshotter) RefreshViews() error {
+	for _, member := range m.members {
+		if err := RefreshViews(member.Snapshotter); err != nil {
+			return fmt.Errorf("database %s: %w", member.name, err)
+		}
+	}
+	return nil
+}
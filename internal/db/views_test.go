@@ -0,0 +1,105 @@
+package db
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+)
+
+func setupViewDB(t *testing.T) string {
+	t.Helper()
+	dbPath := setupTestDB(t)
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec("CREATE VIEW user_totals AS SELECT u.id, COUNT(o.id) AS orders FROM users u LEFT JOIN orders o ON o.user_id = u.id GROUP BY u.id"); err != nil {
+		t.Fatal(err)
+	}
+	return dbPath
+}
+
+func TestOpen_IncludeViews(t *testing.T) {
+	dbPath := setupViewDB(t)
+
+	s, err := Open([]Target{{Type: DBTypeSQLite, ConnString: dbPath, IncludeViews: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tables, err := s.Tables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(tables, "user_totals") {
+		t.Fatalf("expected user_totals in %v", tables)
+	}
+
+	state, err := s.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state["user_totals"]) != 2 {
+		t.Fatalf("expected 2 user_totals rows, got %v", state["user_totals"])
+	}
+
+	// Restoring skips the view; its rows follow from the restored tables
+	state["users"] = state["users"][:1]
+	state["user_totals"] = nil
+	if err := s.RestoreAll(state); err != nil {
+		t.Fatal(err)
+	}
+	after, err := s.SnapshotAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after["user_totals"]) != 1 {
+		t.Errorf("expected 1 user_totals row after restore, got %v", after["user_totals"])
+	}
+	if err := RefreshViews(s); err != nil {
+		t.Errorf("expected refreshing without materialized views to succeed, got %v", err)
+	}
+}
+
+func TestOpen_ViewsExcludedByDefault(t *testing.T) {
+	dbPath := setupViewDB(t)
+
+	s, err := Open([]Target{{Type: DBTypeSQLite, ConnString: dbPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tables, err := s.Tables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(tables, "user_totals") {
+		t.Errorf("expected views to be skipped, got %v", tables)
+	}
+}
+
+func TestQualifyDiscovered(t *testing.T) {
+	tests := []struct {
+		dbType     string
+		namespaces []string
+		want       string
+	}{
+		{DBTypePostgres, nil, "totals"},
+		{DBTypePostgres, []string{"public"}, "totals"},
+		{DBTypePostgres, []string{"public", "billing"}, "billing.totals"},
+		{DBTypeMySQL, nil, "totals"},
+		{DBTypeMySQL, []string{"billing"}, "billing.totals"},
+		{DBTypeMSSQL, []string{"dbo"}, "totals"},
+		{DBTypeMSSQL, []string{"billing"}, "billing.totals"},
+		{DBTypeSQLite, nil, "totals"},
+	}
+	for _, tt := range tests {
+		b := &baseSnapshotter{dbType: tt.dbType, namespaces: tt.namespaces}
+		if got := b.qualifyDiscovered("billing", "totals"); got != tt.want {
+			t.Errorf("%s %v: got %q, want %q", tt.dbType, tt.namespaces, got, tt.want)
+		}
+	}
+}
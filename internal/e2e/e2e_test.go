@@ -1,22 +1,35 @@
 package e2e
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 
+	"github.com/esse/snapshot-tester/internal/asserter"
 	"github.com/esse/snapshot-tester/internal/config"
 	"github.com/esse/snapshot-tester/internal/db"
+	"github.com/esse/snapshot-tester/internal/importer"
 	"github.com/esse/snapshot-tester/internal/recorder"
 	"github.com/esse/snapshot-tester/internal/replayer"
 	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/esse/snapshot-tester/internal/sqlcapture"
+	"github.com/esse/snapshot-tester/internal/websocket"
 )
 
 // setupSQLiteDB creates a temp SQLite database with a users table and returns the path.
@@ -802,3 +815,1288 @@ func createReplayer(t *testing.T, cfg *config.Config, dbPath string) *replayer.R
 	snapshotter.Close()
 	return rep
 }
+
+// wsEchoService upgrades every request to a WebSocket connection and answers
+// each text message with prefix followed by the message.
+func wsEchoService(prefix *atomic.Value) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			websocket.AcceptKey(r.Header.Get("Sec-WebSocket-Key")))
+		buf.Flush()
+		for {
+			f, err := websocket.ReadFrame(buf.Reader)
+			if err != nil {
+				return
+			}
+			switch f.Opcode {
+			case websocket.OpText:
+				reply := prefix.Load().(string) + string(f.Payload)
+				websocket.WriteFrame(conn, &websocket.Frame{Fin: true, Opcode: websocket.OpText, Payload: []byte(reply)}, false)
+			case websocket.OpClose:
+				websocket.WriteFrame(conn, &websocket.Frame{Fin: true, Opcode: websocket.OpClose, Payload: f.Payload}, false)
+				return
+			}
+		}
+	})
+}
+
+// TestE2E_WebSocket records a WebSocket conversation through the recording
+// proxy and replays it.
+func TestE2E_WebSocket(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	var prefix atomic.Value
+	prefix.Store("echo: ")
+	service := httptest.NewServer(wsEchoService(&prefix))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Name:       "e2e-test",
+			BaseURL:    service.URL,
+			MockEnvVar: "SNAPSHOT_MOCK_URL",
+		},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{
+			SnapshotDir: snapshotDir,
+			Format:      "json",
+		},
+		Replay: config.ReplayConfig{
+			TimeoutMs: 5000,
+		},
+	}
+
+	// --- RECORD PHASE ---
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", proxy.URL+"/ws", nil)
+	ws, resp, err := websocket.Handshake(conn, req)
+	if err != nil || ws == nil {
+		t.Fatalf("handshake through proxy: %v (response %v)", err, resp)
+	}
+	for _, msg := range []string{"hello", `{"op":"ping"}`} {
+		if err := ws.WriteMessage(websocket.OpText, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		_, reply, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(reply) != "echo: "+msg {
+			t.Errorf("expected reply %q, got %q", "echo: "+msg, reply)
+		}
+	}
+	ws.WriteMessage(websocket.OpClose, websocket.ClosePayload(1000))
+	if op, _, err := ws.ReadMessage(); err != nil || op != websocket.OpClose {
+		t.Fatalf("expected a close reply, got %d %v", op, err)
+	}
+	ws.Close()
+
+	// The snapshot is saved once the proxy has seen the connection close
+	store := snapshot.NewStore(snapshotDir, "json")
+	var snaps []*snapshot.Snapshot
+	var paths []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if snaps, paths, err = store.LoadAll(); err == nil && len(snaps) == 1 {
+			break
+		}
+	}
+	if len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d (%v)", len(snaps), err)
+	}
+	snap := snaps[0]
+	if snap.Response.Status != http.StatusSwitchingProtocols {
+		t.Errorf("expected status 101, got %d", snap.Response.Status)
+	}
+	want := []snapshot.Message{
+		{Direction: "client", Type: "text", Data: "hello"},
+		{Direction: "server", Type: "text", Data: "echo: hello"},
+		{Direction: "client", Type: "text", Data: map[string]any{"op": "ping"}},
+		{Direction: "server", Type: "text", Data: `echo: {"op":"ping"}`},
+		{Direction: "client", Type: "close", Data: float64(1000)},
+		{Direction: "server", Type: "close", Data: float64(1000)},
+	}
+	if !reflect.DeepEqual(snap.WebSocket, want) {
+		t.Fatalf("recorded messages = %#v\nwant %#v", snap.WebSocket, want)
+	}
+
+	// --- REPLAY PHASE ---
+	rep := createReplayer(t, cfg, dbPath)
+	defer rep.Close()
+
+	result := rep.ReplayOne(snap, paths[0])
+	if result.Error != "" {
+		t.Fatalf("replay error: %s", result.Error)
+	}
+	if !result.Passed {
+		t.Errorf("expected replay to pass, got diffs: %v", result.Diffs)
+	}
+
+	prefix.Store("reply: ")
+	result = rep.ReplayOne(snap, paths[0])
+	if result.Passed {
+		t.Fatal("expected replay to fail when the service answers differently")
+	}
+	if len(result.Diffs) != 2 || result.Diffs[0].Path != "websocket[1].data" {
+		t.Errorf("expected diffs for the two server messages, got %v", result.Diffs)
+	}
+}
+
+func TestE2E_ServerSentEvents(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	var status atomic.Value
+	status.Store("done")
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "id: 1\nevent: progress\ndata: {\"percent\":50}\n\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(30 * time.Millisecond)
+		fmt.Fprintf(w, "id: 2\nevent: progress\ndata: %s\n\n", status.Load())
+	}))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Name:       "e2e-test",
+			BaseURL:    service.URL,
+			MockEnvVar: "SNAPSHOT_MOCK_URL",
+		},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{
+			SnapshotDir: snapshotDir,
+			Format:      "json",
+		},
+		Replay: config.ReplayConfig{
+			TimeoutMs: 5000,
+		},
+	}
+
+	// --- RECORD PHASE ---
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/jobs/1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first event must reach the client before the stream ends
+	buf := make([]byte, 256)
+	n, _ := resp.Body.Read(buf)
+	if !strings.Contains(string(buf[:n]), `{"percent":50}`) {
+		t.Errorf("expected the first event to be streamed, got %q", buf[:n])
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	store := snapshot.NewStore(snapshotDir, "json")
+	snaps, paths, err := store.LoadAll()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d (%v)", len(snaps), err)
+	}
+	snap := snaps[0]
+	if snap.Response.Body != nil {
+		t.Errorf("expected events in place of the body, got %v", snap.Response.Body)
+	}
+	events := snap.Response.Events
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %#v", events)
+	}
+	if events[0].Event != "progress" || !reflect.DeepEqual(events[0].Data, map[string]any{"percent": float64(50)}) {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[1].OffsetMs < 30 {
+		t.Errorf("expected the second event at least 30ms in, got %dms", events[1].OffsetMs)
+	}
+
+	// --- REPLAY PHASE ---
+	rep := createReplayer(t, cfg, dbPath)
+	defer rep.Close()
+
+	result := rep.ReplayOne(snap, paths[0])
+	if result.Error != "" {
+		t.Fatalf("replay error: %s", result.Error)
+	}
+	if !result.Passed {
+		t.Errorf("expected replay to pass, got diffs: %v", result.Diffs)
+	}
+
+	status.Store("failed")
+	result = rep.ReplayOne(snap, paths[0])
+	if result.Passed {
+		t.Fatal("expected replay to fail when an event changes")
+	}
+	if len(result.Diffs) != 1 || result.Diffs[0].Path != "response.events[1].data" {
+		t.Errorf("expected a diff on the second event, got %v", result.Diffs)
+	}
+}
+
+func TestE2E_ChunkedStreaming(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"row":1}`)
+		w.(http.Flusher).Flush()
+		time.Sleep(30 * time.Millisecond)
+		fmt.Fprintln(w, `{"row":2}`)
+	}))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Name:       "e2e-test",
+			BaseURL:    service.URL,
+			MockEnvVar: "SNAPSHOT_MOCK_URL",
+		},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{
+			SnapshotDir:   snapshotDir,
+			Format:        "json",
+			CaptureChunks: true,
+		},
+		Replay: config.ReplayConfig{
+			TimeoutMs: 5000,
+		},
+	}
+
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first chunk reaches the client before the service finishes
+	buf := make([]byte, 64)
+	n, _ := resp.Body.Read(buf)
+	if string(buf[:n]) != "{\"row\":1}\n" {
+		t.Errorf("expected the first chunk to be streamed, got %q", buf[:n])
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	store := snapshot.NewStore(snapshotDir, "json")
+	snaps, paths, err := store.LoadAll()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d (%v)", len(snaps), err)
+	}
+	snap := snaps[0]
+	chunks := snap.Response.Chunks
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %#v", chunks)
+	}
+	firstRows := map[string]any{"data": []any{map[string]any{"row": float64(1)}}, "encoding": "ndjson"}
+	if chunks[0].Size != 10 || !reflect.DeepEqual(chunks[0].Data, firstRows) {
+		t.Errorf("unexpected first chunk: %+v", chunks[0])
+	}
+	if chunks[1].OffsetMs < 30 {
+		t.Errorf("expected the second chunk at least 30ms in, got %dms", chunks[1].OffsetMs)
+	}
+	allRows := map[string]any{"data": []any{map[string]any{"row": float64(1)}, map[string]any{"row": float64(2)}}, "encoding": "ndjson"}
+	if !reflect.DeepEqual(snap.Response.Body, allRows) {
+		t.Errorf("expected the whole body to be recorded too, got %#v", snap.Response.Body)
+	}
+
+	// Replay compares the body, not the chunk boundaries
+	rep := createReplayer(t, cfg, dbPath)
+	defer rep.Close()
+	result := rep.ReplayOne(snap, paths[0])
+	if result.Error != "" || !result.Passed {
+		t.Errorf("expected replay to pass, got error %q diffs %v", result.Error, result.Diffs)
+	}
+}
+
+// TestE2E_H2CTrailers records and replays a service that only speaks
+// HTTP/2 over cleartext and reports its outcome in a trailer, as gRPC does.
+func TestE2E_H2CTrailers(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	var status atomic.Value
+	status.Store("0")
+	service := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			http.Error(w, "HTTP/2 required", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte(`{"ok":true}`))
+		w.Header().Set("Grpc-Status", status.Load().(string))
+	}))
+	service.Config.Protocols = new(http.Protocols)
+	service.Config.Protocols.SetUnencryptedHTTP2(true)
+	service.Start()
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Name:       "e2e-test",
+			BaseURL:    "h2c://" + strings.TrimPrefix(service.URL, "http://"),
+			MockEnvVar: "SNAPSHOT_MOCK_URL",
+		},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{
+			SnapshotDir: snapshotDir,
+			Format:      "json",
+		},
+		Replay: config.ReplayConfig{
+			TimeoutMs: 5000,
+		},
+	}
+
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	recResp := httptest.NewRecorder()
+	rec.ServeHTTP(recResp, httptest.NewRequest("POST", "/pkg.Service/Call", strings.NewReader(`{}`)))
+	if recResp.Code != 200 {
+		t.Fatalf("expected recording response 200, got %d: %s", recResp.Code, recResp.Body.String())
+	}
+
+	store := snapshot.NewStore(snapshotDir, "json")
+	snaps, paths, err := store.LoadAll()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d (%v)", len(snaps), err)
+	}
+	snap := snaps[0]
+	if !reflect.DeepEqual(snap.Response.Trailers, map[string]string{"Grpc-Status": "0"}) {
+		t.Errorf("expected the Grpc-Status trailer to be recorded, got %v", snap.Response.Trailers)
+	}
+	if _, ok := snap.Response.Headers["Grpc-Status"]; ok {
+		t.Errorf("expected the trailer not to be recorded as a header, got %v", snap.Response.Headers)
+	}
+
+	rep := createReplayer(t, cfg, dbPath)
+	defer rep.Close()
+	result := rep.ReplayOne(snap, paths[0])
+	if result.Error != "" || !result.Passed {
+		t.Errorf("expected replay to pass, got error %q diffs %v", result.Error, result.Diffs)
+	}
+
+	status.Store("13")
+	result = rep.ReplayOne(snap, paths[0])
+	if result.Passed {
+		t.Fatal("expected replay to fail when the trailer changes")
+	}
+	found := false
+	for _, d := range result.Diffs {
+		if d.Path == "response.trailers.Grpc-Status" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a diff at response.trailers.Grpc-Status, got %v", result.Diffs)
+	}
+}
+
+func TestE2E_MaxBodyBytes(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	report := strings.Repeat("report line\n", 100)
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		if r.Method == "POST" {
+			fmt.Fprintf(w, "received %d bytes", n)
+			return
+		}
+		io.WriteString(w, report)
+	}))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Name:       "e2e-test",
+			BaseURL:    service.URL,
+			MockEnvVar: "SNAPSHOT_MOCK_URL",
+		},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{
+			SnapshotDir:  snapshotDir,
+			Format:       "json",
+			MaxBodyBytes: 64,
+		},
+		Replay: config.ReplayConfig{
+			TimeoutMs: 5000,
+		},
+	}
+
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	proxy := httptest.NewServer(rec)
+
+	upload := strings.Repeat("u", 1000)
+	resp, err := http.Post(proxy.URL+"/upload", "text/plain", strings.NewReader(upload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "received 1000 bytes" {
+		t.Errorf("expected the whole upload to reach the service, got %q", body)
+	}
+	resp, err = http.Get(proxy.URL + "/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != report {
+		t.Errorf("expected the whole report to reach the client, got %d bytes", len(body))
+	}
+	proxy.Close()
+	rec.Close()
+
+	store := snapshot.NewStore(snapshotDir, "json")
+	snaps, paths, err := store.LoadAll()
+	if err != nil || len(snaps) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d (%v)", len(snaps), err)
+	}
+	for i, snap := range snaps {
+		var marker any
+		var size int
+		switch snap.Request.Method {
+		case "POST":
+			marker, size = snap.Request.Body, len(upload)
+			if snap.Response.Body != "received 1000 bytes" {
+				t.Errorf("expected the small response to be kept, got %v", snap.Response.Body)
+			}
+		default:
+			marker, size = snap.Response.Body, len(report)
+
+			// The replayed report compares by size and hash
+			rep := createReplayer(t, cfg, dbPath)
+			result := rep.ReplayOne(snap, paths[i])
+			rep.Close()
+			if result.Error != "" || !result.Passed {
+				t.Errorf("expected replay to pass, got error %q diffs %v", result.Error, result.Diffs)
+			}
+		}
+		m, _ := marker.(map[string]any)
+		data, _ := m["data"].(map[string]any)
+		if m["encoding"] != "truncated" || data["size"] != float64(size) || len(data["head"].(string)) != 64 {
+			t.Errorf("%s: expected a truncation marker for %d bytes, got %v", snap.Request.Method, size, marker)
+		}
+	}
+
+	// With oversized_bodies: skip, nothing is recorded
+	skipDir := t.TempDir()
+	cfg.Recording.SnapshotDir = skipDir
+	cfg.Recording.OversizedBodies = "skip"
+	rec, err = recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	proxy = httptest.NewServer(rec)
+	defer proxy.Close()
+	for _, send := range []func() (*http.Response, error){
+		func() (*http.Response, error) {
+			return http.Post(proxy.URL+"/upload", "text/plain", strings.NewReader(upload))
+		},
+		func() (*http.Response, error) { return http.Get(proxy.URL + "/report") },
+	} {
+		resp, err := send()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Errorf("expected skipped requests to be proxied, got status %d", resp.StatusCode)
+		}
+	}
+	if snaps, _, _ := snapshot.NewStore(skipDir, "json").LoadAll(); len(snaps) != 0 {
+		t.Errorf("expected no snapshots with oversized_bodies: skip, got %d", len(snaps))
+	}
+}
+
+func TestE2E_ControlHeaders(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	var leaked atomic.Bool
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(recorder.HeaderRecord) != "" || r.Header.Get(recorder.HeaderTags) != "" {
+			leaked.Store(true)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer service.Close()
+
+	never := 0.0
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "e2e-test", BaseURL: service.URL},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{
+			SnapshotDir: snapshotDir,
+			Format:      "json",
+			SampleRate:  &never, // record only on request
+		},
+	}
+	rec, err := recorder.New(cfg, []string{"cli"})
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	for _, record := range []string{"", "on"} {
+		req, _ := http.NewRequest("GET", proxy.URL+"/users", nil)
+		if record != "" {
+			req.Header.Set(recorder.HeaderRecord, record)
+			req.Header.Set(recorder.HeaderTags, "smoke")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if leaked.Load() {
+		t.Error("expected control headers to be removed before proxying")
+	}
+
+	snaps, _, err := snapshot.NewStore(snapshotDir, "json").LoadAll()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("expected only the opted-in request to be recorded, got %d (%v)", len(snaps), err)
+	}
+	if !reflect.DeepEqual(snaps[0].Tags, []string{"cli", "smoke"}) {
+		t.Errorf("unexpected tags %v", snaps[0].Tags)
+	}
+	if _, ok := snaps[0].Request.Headers[recorder.HeaderRecord]; ok {
+		t.Error("expected control headers to be left out of the snapshot")
+	}
+}
+
+// TestE2E_Scenario records a login, create and delete flow as a scenario and
+// replays it in order: the session cookie from the replayed login is used by
+// later steps, and each step runs on the DB state the previous one left.
+func TestE2E_Scenario(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	var session atomic.Value
+	session.Store("")
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			token := fmt.Sprint(time.Now().UnixNano())
+			session.Store(token)
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: token, Path: "/"})
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"ok":true}`)
+			return
+		}
+		if c, err := r.Cookie("session"); err != nil || c.Value != session.Load().(string) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		sqlDB, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		defer sqlDB.Close()
+		switch r.Method {
+		case "POST":
+			if _, err := sqlDB.Exec(`INSERT INTO users (id, name, email) VALUES (2, 'Bob', 'bob@test.com')`); err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(201)
+			fmt.Fprint(w, `{"id":2}`)
+		case "DELETE":
+			res, err := sqlDB.Exec(`DELETE FROM users WHERE id = 2`)
+			if n, _ := res.RowsAffected(); err != nil || n == 0 {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(204)
+		}
+	}))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "e2e-scenario", BaseURL: service.URL},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{SnapshotDir: snapshotDir, Format: "json"},
+		Replay:    config.ReplayConfig{TimeoutMs: 5000},
+	}
+
+	// --- RECORD PHASE ---
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	send := func(method, path string) {
+		req, _ := http.NewRequest(method, proxy.URL+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			t.Fatalf("%s %s: status %d", method, path, resp.StatusCode)
+		}
+	}
+	if err := rec.SetScenario("crud"); err != nil {
+		t.Fatal(err)
+	}
+	send("POST", "/login")
+	send("POST", "/users")
+	send("DELETE", "/users/2")
+	rec.SetScenario("")
+	send("POST", "/login") // not part of the scenario
+
+	store := snapshot.NewStore(snapshotDir, "json")
+	_, snaps, paths, err := store.LoadScenario("crud")
+	if err != nil {
+		t.Fatalf("loading scenario: %v", err)
+	}
+	if len(snaps) != 3 || snaps[0].Request.URL != "/login" || snaps[2].Request.Method != "DELETE" {
+		t.Fatalf("expected the three steps in order, got %d", len(snaps))
+	}
+
+	// --- REPLAY PHASE ---
+	// A later step's recorded state must not be restored: if it were, the
+	// delete would find no user to remove
+	snaps[2].DBStateBefore = snaps[0].DBStateBefore
+
+	rep := createReplayer(t, cfg, dbPath)
+	defer rep.Close()
+
+	results := rep.ReplayScenario(snaps, paths)
+	for _, r := range results {
+		if r.Error != "" || !r.Passed {
+			t.Errorf("step %s %s failed: %s %v", r.Method, r.URL, r.Error, r.Diffs)
+		}
+	}
+}
+
+// TestE2E_LatencyRegression records a fast response and replays it against
+// a service that became slower, which is reported as a warning, or as a
+// failure with replay.latency.fail.
+func TestE2E_LatencyRegression(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	var delay atomic.Int64
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(delay.Load()))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "e2e-latency", BaseURL: service.URL},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{SnapshotDir: snapshotDir, Format: "json"},
+		Replay: config.ReplayConfig{
+			TimeoutMs: 5000,
+			Latency:   config.LatencyConfig{Tolerance: 0.5, MinDeltaMs: 100},
+		},
+	}
+
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	rec.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil))
+
+	snaps, paths, err := snapshot.NewStore(snapshotDir, "json").LoadAll()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d (%v)", len(snaps), err)
+	}
+	timing := snaps[0].Timing
+	if timing == nil || timing.DurationMs < timing.UpstreamMs {
+		t.Fatalf("expected timing to be recorded, got %+v", timing)
+	}
+
+	rep := createReplayer(t, cfg, dbPath)
+	defer rep.Close()
+	if result := rep.ReplayOne(snaps[0], paths[0]); !result.Passed || len(result.Diffs) != 0 {
+		t.Errorf("expected an unchanged service to pass cleanly, got %v", result.Diffs)
+	}
+
+	delay.Store(int64(300 * time.Millisecond))
+	result := rep.ReplayOne(snaps[0], paths[0])
+	if !result.Passed || len(result.Diffs) != 1 || result.Diffs[0].Kind != asserter.DiffKindLatency || !result.Diffs[0].IsWarning() {
+		t.Errorf("expected a latency warning, got passed=%v %v", result.Passed, result.Diffs)
+	}
+	if result.Latency < 300*time.Millisecond {
+		t.Errorf("expected the replayed latency to be measured, got %s", result.Latency)
+	}
+
+	cfg.Replay.Latency.Fail = true
+	if result := rep.ReplayOne(snaps[0], paths[0]); result.Passed {
+		t.Error("expected the regression to fail with latency.fail set")
+	}
+}
+
+// TestE2E_ImportedHAR replays a snapshot imported from a HAR capture, which
+// has no DB state, against a service that writes to the database: only the
+// response is compared.
+func TestE2E_ImportedHAR(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sqlDB, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		defer sqlDB.Close()
+		if _, err := sqlDB.Exec(`INSERT INTO users (id, name, email) VALUES (3, 'Cy', 'cy@test.com')`); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		fmt.Fprint(w, `{"id":3}`)
+	}))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "e2e-har", BaseURL: service.URL},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{SnapshotDir: snapshotDir, Format: "json"},
+		Replay:    config.ReplayConfig{TimeoutMs: 5000},
+	}
+
+	capture := `{"log":{"entries":[{
+		"startedDateTime": "2024-05-01T10:00:00Z", "time": 12,
+		"request": {"method": "POST", "url": "https://api.example.com/users",
+			"headers": [{"name": "Content-Type", "value": "application/json"}],
+			"postData": {"mimeType": "application/json", "text": "{\"name\":\"Cy\"}"}},
+		"response": {"status": 201, "headers": [{"name": "Content-Type", "value": "application/json"}],
+			"content": {"mimeType": "application/json", "text": "{\"id\":3}"}},
+		"timings": {"send": 1, "wait": 10, "receive": 1}}]}}`
+	imported, err := importer.ReadHAR(strings.NewReader(capture), importer.HAROptions{Service: cfg.Service.Name})
+	if err != nil {
+		t.Fatalf("importing HAR: %v", err)
+	}
+	store := snapshot.NewStore(snapshotDir, "json")
+	for _, snap := range imported {
+		if _, err := store.Save(snap); err != nil {
+			t.Fatalf("saving snapshot: %v", err)
+		}
+	}
+
+	snaps, paths, err := store.LoadAll()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("expected 1 imported snapshot, got %d (%v)", len(snaps), err)
+	}
+
+	rep := createReplayer(t, cfg, dbPath)
+	defer rep.Close()
+
+	result := rep.ReplayOne(snaps[0], paths[0])
+	if result.Error != "" || !result.Passed {
+		t.Errorf("expected the imported snapshot to pass, got error %q diffs %v", result.Error, result.Diffs)
+	}
+}
+
+// TestE2E_RecordOne records a single request without the proxy, even though
+// the recording filters exclude its path.
+func TestE2E_RecordOne(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != "POST" || r.URL.RequestURI() != "/users?notify=1" || string(body) != `{"name":"Dee"}` {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		sqlDB, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		defer sqlDB.Close()
+		if _, err := sqlDB.Exec(`INSERT INTO users (id, name, email) VALUES (4, 'Dee', 'dee@test.com')`); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		fmt.Fprint(w, `{"id":4}`)
+	}))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "e2e-record-one", BaseURL: service.URL},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{SnapshotDir: snapshotDir, Format: "json", ExcludePaths: []string{"/users"}},
+	}
+
+	rec, err := recorder.New(cfg, []string{"scripted"})
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+
+	req, _ := http.NewRequest("POST", "/users?notify=1", strings.NewReader(`{"name":"Dee"}`))
+	req.Header.Set("Content-Type", "application/json")
+	snap, path, err := rec.RecordOne(req)
+	if err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	if snap.Response.Status != 201 || !reflect.DeepEqual(snap.Tags, []string{"scripted"}) {
+		t.Errorf("unexpected snapshot: status %d, tags %v", snap.Response.Status, snap.Tags)
+	}
+	if diff := snap.DBDiff["users"]; len(diff.Added) != 1 {
+		t.Errorf("expected the inserted user in the DB diff, got %+v", diff)
+	}
+	saved, err := snapshot.NewStore(snapshotDir, "json").Load(path)
+	if err != nil || saved.ID != snap.ID {
+		t.Errorf("expected the snapshot saved to %s: %v", path, err)
+	}
+}
+
+// TestE2E_Review discards or tags snapshots before they are saved.
+func TestE2E_Review(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "e2e-review", BaseURL: service.URL},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{SnapshotDir: snapshotDir, Format: "json"},
+	}
+
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+
+	var reviewed []string
+	rec.SetReview(func(snap *snapshot.Snapshot) bool {
+		reviewed = append(reviewed, snap.Request.URL)
+		snap.Tags = append(snap.Tags, "reviewed")
+		return snap.Request.URL != "/discard"
+	})
+
+	req, _ := http.NewRequest("GET", "/discard", nil)
+	if _, _, err := rec.RecordOne(req); err == nil {
+		t.Error("expected an error for the discarded snapshot")
+	}
+	req, _ = http.NewRequest("GET", "/keep", nil)
+	snap, path, err := rec.RecordOne(req)
+	if err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	if !reflect.DeepEqual(reviewed, []string{"/discard", "/keep"}) {
+		t.Errorf("expected both snapshots to be reviewed, got %v", reviewed)
+	}
+
+	_, paths, err := snapshot.NewStore(snapshotDir, "json").LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != path || !reflect.DeepEqual(snap.Tags, []string{"reviewed"}) {
+		t.Errorf("expected only the kept snapshot, tagged, got %v %v", paths, snap.Tags)
+	}
+}
+
+// TestE2E_MaxSnapshots stops the recording proxy once the snapshot limit is
+// reached, after saving the last snapshot.
+func TestE2E_MaxSnapshots(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+	// Unix socket paths are limited to about 100 bytes, which TempDir can exceed
+	sockDir, err := os.MkdirTemp("", "rec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sockDir)
+	socket := filepath.Join(sockDir, "proxy.sock")
+
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "e2e-max", BaseURL: service.URL},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{SnapshotDir: snapshotDir, Format: "json", ProxyListen: "unix://" + socket},
+	}
+
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	rec.SetMaxSnapshots(2)
+
+	done := make(chan error, 1)
+	go func() { done <- rec.Start() }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	for i := 1; i <= 2; i++ {
+		var resp *http.Response
+		for attempt := 0; attempt < 50; attempt++ {
+			if resp, err = client.Get(fmt.Sprintf("http://recorder/items/%d", i)); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected Start to return nil after the limit, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the recorder to stop after 2 snapshots")
+	}
+
+	_, paths, err := snapshot.NewStore(snapshotDir, "json").LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Errorf("expected 2 snapshots, got %v", paths)
+	}
+}
+
+// TestE2E_RecordStartsService runs service.command while recording, with
+// HTTP_PROXY set to the outgoing capture proxy, and stops it afterwards.
+func TestE2E_RecordStartsService(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	sockDir, err := os.MkdirTemp("", "rec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sockDir)
+	envFile := filepath.Join(sockDir, "env")
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Name:          "e2e-managed",
+			BaseURL:       "http://127.0.0.1:1",
+			Command:       `echo "$$ $HTTP_PROXY" > ` + envFile + `; exec sleep 30`,
+			StartupTimeMs: 10,
+		},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{
+			SnapshotDir: t.TempDir(),
+			Format:      "json",
+			ProxyListen: "unix://" + filepath.Join(sockDir, "proxy.sock"),
+		},
+	}
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	rec.SetStartService(true)
+
+	done := make(chan error, 1)
+	go func() { done <- rec.Start() }()
+
+	var fields []string
+	for attempt := 0; attempt < 100 && len(fields) < 2; attempt++ {
+		time.Sleep(20 * time.Millisecond)
+		data, _ := os.ReadFile(envFile)
+		fields = strings.Fields(string(data))
+	}
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "http://127.0.0.1:") {
+		t.Fatalf("expected the service to get the outgoing proxy in HTTP_PROXY, got %q", fields)
+	}
+
+	rec.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected Start to return nil, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the recorder to stop")
+	}
+	var pid int
+	fmt.Sscan(fields[0], &pid)
+	if proc, err := os.FindProcess(pid); err == nil && proc.Signal(syscall.Signal(0)) == nil {
+		t.Errorf("expected the service (pid %d) to be stopped with the recorder", pid)
+	}
+}
+
+// TestE2E_Middleware records requests in-process by wrapping the service's
+// handler, with no base URL configured, and replays the snapshot over HTTP.
+func TestE2E_Middleware(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sqlDB, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		defer sqlDB.Close()
+		if r.Method == "POST" {
+			if _, err := sqlDB.Exec(`INSERT INTO users (id, name, email) VALUES (5, 'Eve', 'eve@test.com')`); err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		fmt.Fprint(w, `{"id":5}`)
+	})
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "e2e-middleware"},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{SnapshotDir: snapshotDir, Format: "json"},
+		Replay:    config.ReplayConfig{TimeoutMs: 5000},
+	}
+
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	if err := rec.Start(); err == nil || !strings.Contains(err.Error(), "base_url") {
+		t.Errorf("expected the proxy to require a base URL, got %v", err)
+	}
+
+	server := httptest.NewServer(rec.Middleware(app))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/users", "application/json", strings.NewReader(`{"name":"Eve"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 201 || string(body) != `{"id":5}` {
+		t.Fatalf("expected the handler's response to reach the client, got %d %s", resp.StatusCode, body)
+	}
+
+	snaps, paths, err := snapshot.NewStore(snapshotDir, "json").LoadAll()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d (%v)", len(snaps), err)
+	}
+	if diff := snaps[0].DBDiff["users"]; len(diff.Added) != 1 {
+		t.Errorf("expected the inserted user in the DB diff, got %+v", diff)
+	}
+
+	// --- REPLAY PHASE ---
+	cfg.Service.BaseURL = server.URL
+	rep := createReplayer(t, cfg, dbPath)
+	defer rep.Close()
+	if result := rep.ReplayOne(snaps[0], paths[0]); result.Error != "" || !result.Passed {
+		t.Errorf("expected the snapshot to replay, got error %q diffs %v", result.Error, result.Diffs)
+	}
+}
+
+func init() {
+	sqlcapture.Register("sqlite3-captured", &sqlite3.SQLiteDriver{})
+}
+
+// TestE2E_Queries records the SQL a service executes through the sqlcapture
+// driver and flags a replay that executes different statements.
+func TestE2E_Queries(t *testing.T) {
+	dbPath := setupSQLiteDB(t)
+	snapshotDir := t.TempDir()
+
+	var column atomic.Value
+	column.Store("name")
+	app := sqlcapture.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sqlDB, err := sql.Open("sqlite3-captured", dbPath)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		defer sqlDB.Close()
+		var name string
+		query := `SELECT ` + column.Load().(string) + ` FROM users WHERE id = ?`
+		if err := sqlDB.QueryRowContext(r.Context(), query, 1).Scan(&name); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"ok":true}`)
+	}))
+	service := httptest.NewServer(app)
+	defer service.Close()
+
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "e2e-queries", BaseURL: service.URL},
+		Database: config.DatabaseConfig{
+			Type:             "sqlite",
+			ConnectionString: dbPath,
+			Tables:           []string{"users"},
+		},
+		Recording: config.RecordingConfig{SnapshotDir: snapshotDir, Format: "json"},
+		Replay:    config.ReplayConfig{TimeoutMs: 5000},
+	}
+
+	// --- RECORD PHASE ---
+	rec, err := recorder.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("creating recorder: %v", err)
+	}
+	defer rec.Close()
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	snaps, paths, err := snapshot.NewStore(snapshotDir, "json").LoadAll()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d (%v)", len(snaps), err)
+	}
+	want := []snapshot.Query{{SQL: `SELECT name FROM users WHERE id = ?`, Args: []any{float64(1)}}}
+	if !reflect.DeepEqual(snaps[0].Queries, want) {
+		t.Errorf("expected queries %+v, got %+v", want, snaps[0].Queries)
+	}
+	if _, ok := snaps[0].Response.Headers[sqlcapture.Header]; ok {
+		t.Error("expected the queries header to be left out of the snapshot")
+	}
+
+	// --- REPLAY PHASE ---
+	rep := createReplayer(t, cfg, dbPath)
+	defer rep.Close()
+
+	if result := rep.ReplayOne(snaps[0], paths[0]); result.Error != "" || !result.Passed || len(result.Diffs) != 0 {
+		t.Errorf("expected the same queries to pass, got error %q diffs %v", result.Error, result.Diffs)
+	}
+
+	column.Store("email")
+	result := rep.ReplayOne(snaps[0], paths[0])
+	if result.Passed {
+		t.Error("expected a changed query to fail")
+	}
+	if len(result.Diffs) != 1 || result.Diffs[0].Path != "queries[0].sql" {
+		t.Errorf("expected a diff at queries[0].sql, got %v", result.Diffs)
+	}
+}
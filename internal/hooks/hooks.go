@@ -0,0 +1,130 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+// Hook events (must match the keys of the hooks config section).
+const (
+	EventBeforeRecord    = "before_record"
+	EventBeforeReplayRun = "before_replay_run"
+	EventBeforeReplay    = "before_replay"
+	EventAfterReplay     = "after_replay"
+	EventAfterReplayRun  = "after_replay_run"
+)
+
+// Replay results passed to after_replay and after_replay_run hooks.
+const (
+	ResultPass  = "pass"
+	ResultFail  = "fail"
+	ResultError = "error"
+)
+
+// Context describes the snapshot a hook runs for. Fields that are not known
+// yet for an event (e.g. the ID before recording) are empty; run events
+// describe the whole run instead of a snapshot.
+type Context struct {
+	Event        string
+	SnapshotID   string
+	SnapshotPath string
+	Method       string
+	URL          string
+	Result       string // after_replay and after_replay_run only: pass, fail or error
+	Snapshots    int    // run events only: number of snapshots in the run
+}
+
+// Env returns the context as environment variables for shell hooks.
+func (c Context) Env() []string {
+	return []string{
+		"SNAPSHOT_HOOK_EVENT=" + c.Event,
+		"SNAPSHOT_ID=" + c.SnapshotID,
+		"SNAPSHOT_PATH=" + c.SnapshotPath,
+		"SNAPSHOT_METHOD=" + c.Method,
+		"SNAPSHOT_URL=" + c.URL,
+		"SNAPSHOT_RESULT=" + c.Result,
+		"SNAPSHOT_COUNT=" + strconv.Itoa(c.Snapshots),
+	}
+}
+
+// Func is a Go callback registered for an event.
+type Func func(ctx Context) error
+
+// Runner runs the shell commands configured for each event, followed by any
+// registered Go callbacks. It is safe for concurrent use.
+type Runner struct {
+	mu       sync.RWMutex
+	commands map[string][]string
+	funcs    map[string][]Func
+}
+
+// New creates a Runner with the shell commands from the hooks config.
+func New(cfg config.HooksConfig) *Runner {
+	return &Runner{
+		commands: map[string][]string{
+			EventBeforeRecord:    cfg.BeforeRecord,
+			EventBeforeReplayRun: cfg.BeforeReplayRun,
+			EventBeforeReplay:    cfg.BeforeReplay,
+			EventAfterReplay:     cfg.AfterReplay,
+			EventAfterReplayRun:  cfg.AfterReplayRun,
+		},
+		funcs: make(map[string][]Func),
+	}
+}
+
+// Register adds a Go callback for event. Callbacks run in registration order
+// after the configured shell commands.
+func (r *Runner) Register(event string, fn Func) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.funcs[event] = append(r.funcs[event], fn)
+}
+
+// Run executes every hook for ctx.Event, stopping at the first failure.
+// A nil Runner runs nothing.
+func (r *Runner) Run(ctx Context) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	commands := r.commands[ctx.Event]
+	funcs := append([]Func(nil), r.funcs[ctx.Event]...)
+	r.mu.RUnlock()
+
+	for _, command := range commands {
+		if err := runCommand(command, ctx); err != nil {
+			return fmt.Errorf("%s hook %q: %w", ctx.Event, command, err)
+		}
+	}
+	for i, fn := range funcs {
+		if err := fn(ctx); err != nil {
+			return fmt.Errorf("%s hook #%d: %w", ctx.Event, i+1, err)
+		}
+	}
+	return nil
+}
+
+func runCommand(command string, ctx Context) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(context.Background(), "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(context.Background(), "sh", "-c", command)
+	}
+
+	// Inherit current environment and add the snapshot context
+	cmd.Env = append(os.Environ(), ctx.Env()...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	slog.Debug("running hook", "event", ctx.Event, "command", command, "snapshot", ctx.SnapshotID)
+	return cmd.Run()
+}
@@ -0,0 +1,110 @@
+package hooks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+func TestRunner_ShellCommandGetsContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	out := filepath.Join(t.TempDir(), "hook.out")
+	r := New(config.HooksConfig{
+		AfterReplay: []string{`echo "$SNAPSHOT_HOOK_EVENT $SNAPSHOT_ID $SNAPSHOT_RESULT" > ` + out},
+	})
+
+	err := r.Run(Context{Event: EventAfterReplay, SnapshotID: "abc", Result: ResultFail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(data)) != "after_replay abc fail" {
+		t.Errorf("unexpected hook output %q", data)
+	}
+}
+
+func TestRunner_RunEvents(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	out := filepath.Join(t.TempDir(), "hook.out")
+	r := New(config.HooksConfig{
+		BeforeReplayRun: []string{`echo "$SNAPSHOT_HOOK_EVENT $SNAPSHOT_COUNT" >> ` + out},
+		AfterReplayRun:  []string{`echo "$SNAPSHOT_HOOK_EVENT $SNAPSHOT_COUNT $SNAPSHOT_RESULT" >> ` + out},
+	})
+
+	if err := r.Run(Context{Event: EventBeforeReplayRun, Snapshots: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(Context{Event: EventAfterReplayRun, Snapshots: 3, Result: ResultPass}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "before_replay_run 3\nafter_replay_run 3 pass\n" {
+		t.Errorf("unexpected hook output %q", data)
+	}
+}
+
+func TestRunner_CommandFailureStops(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	r := New(config.HooksConfig{BeforeReplay: []string{"exit 3"}})
+	called := false
+	r.Register(EventBeforeReplay, func(Context) error {
+		called = true
+		return nil
+	})
+
+	if err := r.Run(Context{Event: EventBeforeReplay}); err == nil {
+		t.Fatal("expected failing command to return an error")
+	}
+	if called {
+		t.Error("expected callbacks to be skipped after a failing command")
+	}
+}
+
+func TestRunner_Callbacks(t *testing.T) {
+	r := New(config.HooksConfig{})
+	var got []string
+	r.Register(EventBeforeRecord, func(ctx Context) error {
+		got = append(got, "first "+ctx.URL)
+		return nil
+	})
+	r.Register(EventBeforeRecord, func(ctx Context) error {
+		got = append(got, "second")
+		return errors.New("boom")
+	})
+	r.Register(EventAfterReplay, func(Context) error {
+		t.Error("callback for another event should not run")
+		return nil
+	})
+
+	err := r.Run(Context{Event: EventBeforeRecord, URL: "/users"})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected callback error, got %v", err)
+	}
+	if len(got) != 2 || got[0] != "first /users" {
+		t.Errorf("expected callbacks in registration order, got %v", got)
+	}
+}
+
+func TestRunner_Nil(t *testing.T) {
+	var r *Runner
+	if err := r.Run(Context{Event: EventBeforeReplay}); err != nil {
+		t.Errorf("expected nil runner to be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+// Package hostrule matches the destinations of a service's outgoing calls
+// against recording.outgoing_hosts, for the outgoing proxy when recording
+// and the mock server when replaying.
+package hostrule
+
+import (
+	"net"
+	"path"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+// Actions, set per host by recording.outgoing_hosts.
+const (
+	Capture     = "capture"     // forward the call and add it to the snapshot
+	Passthrough = "passthrough" // forward the call without capturing it
+	Block       = "block"       // answer the call with 403 Forbidden
+)
+
+// Action returns the action the first matching rule sets for a call to
+// authority (host or host:port), or Capture if none matches. Rules with a
+// port match the whole authority, others the host name alone.
+func Action(rules []config.OutgoingHostRule, authority string) string {
+	host := authority
+	if h, _, err := net.SplitHostPort(authority); err == nil {
+		host = h
+	}
+	for _, rule := range rules {
+		target := host
+		if strings.Contains(rule.Host, ":") {
+			target = authority
+		}
+		if ok, _ := path.Match(strings.ToLower(rule.Host), strings.ToLower(target)); ok {
+			return rule.Action
+		}
+	}
+	return Capture
+}
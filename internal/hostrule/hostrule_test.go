@@ -0,0 +1,29 @@
+package hostrule
+
+import (
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+func TestAction(t *testing.T) {
+	rules := []config.OutgoingHostRule{
+		{Host: "*.blocked.test", Action: Block},
+		{Host: "localhost:9000", Action: Passthrough},
+		{Host: "Localhost", Action: Block},
+	}
+	tests := []struct {
+		authority, want string
+	}{
+		{"api.blocked.test", Block},
+		{"api.blocked.test:443", Block},
+		{"localhost:9000", Passthrough},
+		{"localhost:8080", Block},
+		{"example.com", Capture},
+	}
+	for _, tt := range tests {
+		if got := Action(rules, tt.authority); got != tt.want {
+			t.Errorf("Action(%q) = %q, want %q", tt.authority, got, tt.want)
+		}
+	}
+}
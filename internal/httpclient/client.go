@@ -2,9 +2,11 @@ package httpclient
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/esse/snapshot-tester/internal/snapshot"
@@ -12,8 +14,51 @@ import (
 
 // FireRequest sends an HTTP request to the given base URL and returns the parsed response.
 // This is the shared implementation used by both the replayer and the CLI update command.
+// baseURL may be an http(s) URL, including bracketed IPv6 hosts, or a
+// unix:// socket path.
 func FireRequest(baseURL string, req snapshot.Request, timeoutMs int) (*snapshot.Response, error) {
-	fullURL := baseURL + req.URL
+	return FireRequestWith(baseURL, req, timeoutMs, Options{})
+}
+
+// FireEventStream is FireRequest for requests answered with Server-Sent
+// Events: it stops reading a text/event-stream response once maxEvents
+// events have arrived, so streams the service keeps open can be replayed.
+// A maxEvents of 0 reads until the service closes the stream.
+func FireEventStream(baseURL string, req snapshot.Request, timeoutMs, maxEvents int) (*snapshot.Response, error) {
+	return FireRequestWith(baseURL, req, timeoutMs, Options{MaxEvents: maxEvents})
+}
+
+// Options adjust how FireRequestWith sends a request and reads the response.
+type Options struct {
+	// MaxEvents stops reading an event stream after this many events; see
+	// FireEventStream.
+	MaxEvents int
+
+	// Jar threads cookies between requests: its cookies replace recorded
+	// cookies of the same name, and cookies the response sets are stored
+	// in it.
+	Jar http.CookieJar
+
+	// MaxBodyBytes replaces a response body larger than this with a
+	// truncation marker, as recording.max_body_bytes does when recording,
+	// so the two compare by size and hash. Head keeps the marker's first
+	// bytes. Zero reads bodies whole.
+	MaxBodyBytes int64
+	Head         bool
+
+	// TLS is used for https services, e.g. to present a client
+	// certificate; see LoadTLS.
+	TLS *tls.Config
+}
+
+// FireRequestWith is FireRequest with options.
+func FireRequestWith(baseURL string, req snapshot.Request, timeoutMs int, opts Options) (*snapshot.Response, error) {
+	target, err := ParseTarget(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	target.TLS = opts.TLS
+	fullURL := target.BaseURL() + req.URL
 
 	var bodyReader io.Reader
 	if req.Body != nil {
@@ -21,6 +66,16 @@ func FireRequest(baseURL string, req snapshot.Request, timeoutMs int) (*snapshot
 		if err != nil {
 			return nil, fmt.Errorf("decoding request body: %w", err)
 		}
+		// Bodies are stored as UTF-8; send them in the charset the headers declare
+		data, err = snapshot.EncodeCharset(data, req.Headers[snapshot.HeaderContentType])
+		if err != nil {
+			return nil, err
+		}
+		// and compress them the way they were recorded
+		data, err = snapshot.CompressBody(data, req.Headers[snapshot.HeaderContentEncoding])
+		if err != nil {
+			return nil, err
+		}
 		bodyReader = bytes.NewReader(data)
 	}
 
@@ -32,9 +87,13 @@ func FireRequest(baseURL string, req snapshot.Request, timeoutMs int) (*snapshot
 	for k, v := range req.Headers {
 		httpReq.Header.Set(k, v)
 	}
+	if opts.Jar != nil {
+		applyJar(httpReq, opts.Jar)
+	}
 
 	client := &http.Client{
-		Timeout: time.Duration(timeoutMs) * time.Millisecond,
+		Timeout:   time.Duration(timeoutMs) * time.Millisecond,
+		Transport: target.Transport(),
 	}
 
 	resp, err := client.Do(httpReq)
@@ -42,10 +101,8 @@ func FireRequest(baseURL string, req snapshot.Request, timeoutMs int) (*snapshot
 		return nil, fmt.Errorf("executing request: %w", err)
 	}
 	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("reading response body: %w", err)
+	if opts.Jar != nil {
+		opts.Jar.SetCookies(httpReq.URL, resp.Cookies())
 	}
 
 	headers := make(map[string]string)
@@ -53,6 +110,41 @@ func FireRequest(baseURL string, req snapshot.Request, timeoutMs int) (*snapshot
 		headers[k] = v[0]
 	}
 
+	if snapshot.IsEventStream(resp.Header.Get(snapshot.HeaderContentType)) {
+		events, err := readEvents(resp.Body, opts.MaxEvents)
+		if err != nil {
+			return nil, fmt.Errorf("reading event stream: %w", err)
+		}
+		return &snapshot.Response{
+			Status:  resp.StatusCode,
+			Headers: headers,
+			Events:  events,
+		}, nil
+	}
+
+	var respBody []byte
+	if opts.MaxBodyBytes > 0 {
+		digest := snapshot.NewBodyDigest(opts.MaxBodyBytes)
+		if _, err := io.Copy(digest, resp.Body); err != nil {
+			return nil, fmt.Errorf("reading response body: %w", err)
+		}
+		if digest.Truncated() {
+			return &snapshot.Response{
+				Status:   resp.StatusCode,
+				Headers:  headers,
+				Body:     digest.Body(opts.Head),
+				Trailers: Trailers(resp.Trailer),
+			}, nil
+		}
+		respBody = digest.Bytes()
+	} else if respBody, err = io.ReadAll(resp.Body); err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	// Bodies the recorder could not decompress were stored as they came, so
+	// keep them the same way here
+	respBody, _ = snapshot.DecompressBody(respBody, resp.Header.Get(snapshot.HeaderContentEncoding))
+
 	var parsedBody any
 	if len(respBody) > 0 {
 		respContentType := resp.Header.Get(snapshot.HeaderContentType)
@@ -60,8 +152,76 @@ func FireRequest(baseURL string, req snapshot.Request, timeoutMs int) (*snapshot
 	}
 
 	return &snapshot.Response{
-		Status:  resp.StatusCode,
-		Headers: headers,
-		Body:    parsedBody,
+		Status:   resp.StatusCode,
+		Headers:  headers,
+		Body:     parsedBody,
+		Trailers: Trailers(resp.Trailer),
 	}, nil
 }
+
+// Trailers flattens the trailers of a fully read response for a snapshot,
+// or returns nil if it sent none.
+func Trailers(trailer http.Header) map[string]string {
+	var trailers map[string]string
+	for k, v := range trailer {
+		if len(v) == 0 {
+			continue // announced but never sent
+		}
+		if trailers == nil {
+			trailers = make(map[string]string)
+		}
+		trailers[k] = strings.Join(v, ", ")
+	}
+	return trailers
+}
+
+// readEvents parses an event stream as it arrives, until it ends or
+// maxEvents events have been read.
+func readEvents(body io.Reader, maxEvents int) ([]snapshot.Event, error) {
+	parser := snapshot.NewEventParser(time.Now())
+	buf := make([]byte, 4096)
+	for maxEvents <= 0 || len(parser.Events) < maxEvents {
+		n, err := body.Read(buf)
+		parser.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if maxEvents > 0 && len(parser.Events) > maxEvents {
+		return parser.Events[:maxEvents], nil
+	}
+	return parser.Events, nil
+}
+
+// applyJar rewrites the Cookie header of req: cookies the jar holds for the
+// URL replace recorded cookies of the same name, and are added when the
+// recording had none.
+func applyJar(req *http.Request, jar http.CookieJar) {
+	fresh := jar.Cookies(req.URL)
+	if len(fresh) == 0 {
+		return
+	}
+	values := make(map[string]string, len(fresh))
+	for _, c := range fresh {
+		values[c.Name] = c.Value
+	}
+
+	var pairs []string
+	for _, c := range req.Cookies() {
+		if v, ok := values[c.Name]; ok {
+			pairs = append(pairs, c.Name+"="+v)
+			delete(values, c.Name)
+		} else {
+			pairs = append(pairs, c.Name+"="+c.Value)
+		}
+	}
+	for _, c := range fresh {
+		if _, ok := values[c.Name]; ok {
+			pairs = append(pairs, c.Name+"="+c.Value)
+		}
+	}
+	req.Header.Set("Cookie", strings.Join(pairs, "; "))
+}
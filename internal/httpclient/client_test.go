@@ -1,9 +1,13 @@
 package httpclient
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	"github.com/esse/snapshot-tester/internal/snapshot"
@@ -90,3 +94,105 @@ func TestFireRequest_NilBody(t *testing.T) {
 		t.Errorf("expected status 204, got %d", resp.Status)
 	}
 }
+
+func TestFireRequest_EncodesDeclaredCharset(t *testing.T) {
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain; charset=ISO-8859-1")
+		w.Write([]byte("d\xe9j\xe0 vu"))
+	}))
+	defer server.Close()
+
+	req := snapshot.Request{
+		Method:  "POST",
+		URL:     "/echo",
+		Headers: map[string]string{"Content-Type": "text/plain; charset=iso-8859-1"},
+		Body:    &snapshot.EncodedBody{Data: "café", Encoding: snapshot.BodyEncodingText},
+	}
+
+	resp, err := FireRequest(server.URL, req, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(received) != "caf\xe9" {
+		t.Errorf("expected body sent as ISO-8859-1, got %q", received)
+	}
+	if resp.Body != "déjà vu" {
+		t.Errorf("expected response decoded to UTF-8, got %q", resp.Body)
+	}
+}
+
+func TestFireEventStream_StopsAfterMaxEvents(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 1; i <= 2; i++ {
+			fmt.Fprintf(w, "id: %d\ndata: {\"n\":%d}\n\n", i, i)
+		}
+		w.(http.Flusher).Flush()
+		// Keep the stream open like a live feed would
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	resp, err := FireEventStream(server.URL, snapshot.Request{Method: "GET", URL: "/events"}, 5000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != nil {
+		t.Errorf("expected no body for an event stream, got %v", resp.Body)
+	}
+	if len(resp.Events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(resp.Events))
+	}
+	if resp.Events[1].ID != "2" || !reflect.DeepEqual(resp.Events[1].Data, map[string]any{"n": float64(2)}) {
+		t.Errorf("unexpected second event: %+v", resp.Events[1])
+	}
+}
+
+func TestFireRequest_ContentEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("expected gzip request, got %q", r.Header.Get("Content-Encoding"))
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("request body is not gzip: %v", err)
+			return
+		}
+		reqBody, _ := io.ReadAll(gz)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "br")
+		data, _ := snapshot.CompressBody(reqBody, "br")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	req := snapshot.Request{
+		Method: "POST",
+		URL:    "/echo",
+		Headers: map[string]string{
+			"Content-Type":     "application/json",
+			"Content-Encoding": "gzip",
+			"Accept-Encoding":  "br",
+		},
+		Body: map[string]any{"name": "Alice"},
+	}
+	resp, err := FireRequest(server.URL, req, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, ok := resp.Body.(map[string]any)
+	if !ok || body["name"] != "Alice" {
+		t.Errorf("expected decoded JSON body, got %v", resp.Body)
+	}
+	if resp.Headers["Content-Encoding"] != "br" {
+		t.Errorf("expected the encoding header to be kept, got %q", resp.Headers["Content-Encoding"])
+	}
+}
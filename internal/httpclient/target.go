@@ -0,0 +1,131 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// SchemeUnix selects a unix domain socket target, e.g. unix:///var/run/app.sock.
+const SchemeUnix = "unix"
+
+// SchemeH2C selects a service speaking HTTP/2 without TLS, such as a gRPC
+// server, e.g. h2c://localhost:50051. Connections use HTTP/2 with prior
+// knowledge.
+const SchemeH2C = "h2c"
+
+// unixHost is the Host sent to services reached over a unix socket, which
+// have no network address of their own.
+const unixHost = "localhost"
+
+// Target is the parsed service base URL. HTTP(S) targets, including bracketed
+// IPv6 hosts like http://[::1]:8080, are used as-is; unix:// targets are
+// rewritten to http://localhost and dialed through SocketPath; h2c:// targets
+// are rewritten to http:// and set H2C. TLS, when set, is used for https
+// targets, e.g. to present a client certificate.
+type Target struct {
+	URL        *url.URL
+	SocketPath string
+	H2C        bool
+	TLS        *tls.Config
+}
+
+// ParseTarget parses a service base URL.
+func ParseTarget(baseURL string) (*Target, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing service base URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case SchemeUnix:
+		socket := u.Path
+		if u.Host != "" {
+			// unix://relative/app.sock
+			socket = u.Host + u.Path
+		}
+		if socket == "" {
+			return nil, fmt.Errorf("service base URL %q has no socket path", baseURL)
+		}
+		return &Target{URL: &url.URL{Scheme: "http", Host: unixHost}, SocketPath: socket}, nil
+	case "http", "https", SchemeH2C:
+		if u.Host == "" {
+			return nil, fmt.Errorf("service base URL %q has no host", baseURL)
+		}
+		// url.Parse accepts "http://::1:8080" with a host of "::1:8080", which cannot be dialed
+		if strings.Count(u.Host, ":") > 1 && !strings.HasPrefix(u.Host, "[") {
+			return nil, fmt.Errorf("IPv6 address in service base URL %q must be in brackets, e.g. http://[::1]:8080", baseURL)
+		}
+		if u.Scheme == SchemeH2C {
+			plain := *u
+			plain.Scheme = "http"
+			return &Target{URL: &plain, H2C: true}, nil
+		}
+		return &Target{URL: u}, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q in service base URL (must be http, https, h2c or unix)", u.Scheme)
+	}
+}
+
+// BaseURL returns the URL requests are sent to, without a trailing slash.
+func (t *Target) BaseURL() string {
+	return strings.TrimSuffix(t.URL.String(), "/")
+}
+
+// Transport returns the transport for reaching the target. Unix socket
+// targets dial the socket for every connection, h2c targets speak HTTP/2
+// without TLS; others use the default, with the target's TLS settings.
+func (t *Target) Transport() http.RoundTripper {
+	if t.H2C {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+		return transport
+	}
+	if t.SocketPath == "" {
+		if t.TLS == nil {
+			return http.DefaultTransport
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = t.TLS.Clone()
+		return transport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", t.SocketPath)
+	}
+	return transport
+}
+
+// ServerProtocols returns the protocols a proxy in front of the target
+// should accept: HTTP/1 and, for h2c targets, HTTP/2 without TLS, so h2c
+// clients can reach the service through it. nil means the server default.
+func (t *Target) ServerProtocols() *http.Protocols {
+	if !t.H2C {
+		return nil
+	}
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	p.SetUnencryptedHTTP2(true)
+	return p
+}
+
+// NewReverseProxy returns a reverse proxy forwarding to the service at
+// baseURL, with the given TLS settings (nil for the default).
+func NewReverseProxy(baseURL string, tlsConfig *tls.Config) (*httputil.ReverseProxy, error) {
+	target, err := ParseTarget(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	target.TLS = tlsConfig
+	proxy := httputil.NewSingleHostReverseProxy(target.URL)
+	proxy.Transport = target.Transport()
+	return proxy, nil
+}
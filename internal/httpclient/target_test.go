@@ -0,0 +1,126 @@
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		wantURL string
+		socket  string
+	}{
+		{"http://localhost:8080", "http://localhost:8080", ""},
+		{"http://localhost:8080/", "http://localhost:8080", ""},
+		{"http://[::1]:8080", "http://[::1]:8080", ""},
+		{"https://[2001:db8::1]/api", "https://[2001:db8::1]/api", ""},
+		{"unix:///var/run/app.sock", "http://localhost", "/var/run/app.sock"},
+		{"unix://run/app.sock", "http://localhost", "run/app.sock"},
+	}
+	for _, tt := range tests {
+		target, err := ParseTarget(tt.baseURL)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.baseURL, err)
+			continue
+		}
+		if target.BaseURL() != tt.wantURL || target.SocketPath != tt.socket {
+			t.Errorf("%s: got %s (socket %q), want %s (socket %q)", tt.baseURL, target.BaseURL(), target.SocketPath, tt.wantURL, tt.socket)
+		}
+	}
+}
+
+func TestParseTarget_H2C(t *testing.T) {
+	target, err := ParseTarget("h2c://localhost:50051")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.BaseURL() != "http://localhost:50051" || !target.H2C {
+		t.Errorf("got %s (h2c %v), want http://localhost:50051 over h2c", target.BaseURL(), target.H2C)
+	}
+	if p := target.ServerProtocols(); p == nil || !p.UnencryptedHTTP2() {
+		t.Errorf("expected server protocols to include unencrypted HTTP/2, got %v", p)
+	}
+}
+
+func TestParseTarget_Errors(t *testing.T) {
+	for _, baseURL := range []string{"unix://", "ftp://host", "http://", "http://::1:8080", "localhost:8080"} {
+		if _, err := ParseTarget(baseURL); err == nil {
+			t.Errorf("expected error for %q", baseURL)
+		}
+	}
+}
+
+func TestFireRequest_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	resp, err := FireRequest("unix://"+socket, snapshot.Request{Method: "GET", URL: "/api/health"}, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, ok := resp.Body.(map[string]any)
+	if !ok || body["path"] != "/api/health" {
+		t.Errorf("unexpected response %v", resp.Body)
+	}
+}
+
+func TestFireRequest_IPv6(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	resp, err := FireRequest(server.URL, snapshot.Request{Method: "GET", URL: "/"}, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", resp.Status)
+	}
+}
+
+func TestNewReverseProxy_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via socket"))
+	}))
+	backend.Listener = listener
+	backend.Start()
+	defer backend.Close()
+
+	proxy, err := NewReverseProxy("unix://"+socket, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest("GET", "/anything", nil))
+	if w.Body.String() != "via socket" {
+		t.Errorf("expected response from socket backend, got %d %q", w.Code, w.Body.String())
+	}
+}
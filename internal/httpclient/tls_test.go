@@ -0,0 +1,124 @@
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// writeCert signs a certificate for template with parent (self-signed when
+// parent is nil) and writes it and its key as PEM files under dir.
+func writeCert(t *testing.T, dir, name string, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestFireRequest_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	notAfter := time.Now().Add(time.Hour)
+	ca, caKey := writeCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	server, serverKey := writeCert(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotAfter:     notAfter,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeCert(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "snapshot-tester"},
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.Raw}, PrivateKey: serverKey}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	req := snapshot.Request{Method: "GET", URL: "/"}
+
+	withCA, err := LoadTLS("", "", filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FireRequestWith(srv.URL, req, 5000, Options{TLS: withCA}); err == nil {
+		t.Error("expected the service to reject a request without a client certificate")
+	}
+
+	mutual, err := LoadTLS(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem"), filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := FireRequestWith(srv.URL, req, 5000, Options{TLS: mutual})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "snapshot-tester" {
+		t.Errorf("expected the service to see the client certificate, got %v", resp.Body)
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	if cfg, err := LoadTLS("", "", ""); cfg != nil || err != nil {
+		t.Errorf("expected no TLS settings, got %v, %v", cfg, err)
+	}
+	if _, err := LoadTLS("missing.pem", "missing-key.pem", ""); err == nil || !strings.Contains(err.Error(), "client certificate") {
+		t.Errorf("expected a client certificate error, got %v", err)
+	}
+	empty := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0o600)
+	if _, err := LoadTLS("", "", empty); err == nil || !strings.Contains(err.Error(), "no certificates") {
+		t.Errorf("expected a CA error, got %v", err)
+	}
+}
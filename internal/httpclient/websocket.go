@@ -0,0 +1,152 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/esse/snapshot-tester/internal/websocket"
+)
+
+// Dial opens a raw connection to the target: its unix socket, or its host
+// over TCP, with TLS for https.
+func (t *Target) Dial(timeout time.Duration) (net.Conn, error) {
+	d := &net.Dialer{Timeout: timeout}
+	if t.SocketPath != "" {
+		return d.Dial("unix", t.SocketPath)
+	}
+	host := t.URL.Host
+	if t.URL.Port() == "" {
+		port := "80"
+		if t.URL.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(t.URL.Hostname(), port)
+	}
+	if t.URL.Scheme == "https" {
+		cfg := &tls.Config{}
+		if t.TLS != nil {
+			cfg = t.TLS.Clone()
+		}
+		cfg.ServerName = t.URL.Hostname()
+		return tls.DialWithDialer(d, "tcp", host, cfg)
+	}
+	return d.Dial("tcp", host)
+}
+
+// FireWebSocket opens a WebSocket connection for req and replays a recorded
+// conversation: client messages are sent in order, and at each recorded
+// server message the next message from the service is read. It returns the
+// handshake response and the conversation as it happened, which matches
+// the recording message for message when the service behaves the same. If
+// the service does not switch protocols, its response is returned with no
+// messages.
+func FireWebSocket(baseURL string, req snapshot.Request, messages []snapshot.Message, timeoutMs int) (*snapshot.Response, []snapshot.Message, error) {
+	return FireWebSocketWith(baseURL, req, messages, timeoutMs, Options{})
+}
+
+// FireWebSocketWith is FireWebSocket with options; only TLS applies.
+func FireWebSocketWith(baseURL string, req snapshot.Request, messages []snapshot.Message, timeoutMs int, opts Options) (*snapshot.Response, []snapshot.Message, error) {
+	target, err := ParseTarget(baseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	target.TLS = opts.TLS
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+
+	conn, err := target.Dial(timeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting: %w", err)
+	}
+	defer conn.Close()
+
+	httpReq, err := http.NewRequest(req.Method, target.BaseURL()+req.URL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating request: %w", err)
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	ws, resp, err := websocket.Handshake(conn, httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	headers := make(map[string]string)
+	for k, v := range resp.Header {
+		headers[k] = v[0]
+	}
+	result := &snapshot.Response{Status: resp.StatusCode, Headers: headers}
+	if ws == nil {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading response body: %w", err)
+		}
+		if len(body) > 0 {
+			result.Body = snapshot.ParseBody(body, resp.Header.Get(snapshot.HeaderContentType))
+		}
+		return result, nil, nil
+	}
+
+	var actual []snapshot.Message
+	read := func() (snapshot.Message, error) {
+		ws.SetReadDeadline(time.Now().Add(timeout))
+		opcode, payload, err := ws.ReadMessage()
+		if err != nil {
+			return snapshot.Message{}, err
+		}
+		return snapshot.NewMessage(snapshot.DirectionServer, websocket.MessageType(opcode), payload), nil
+	}
+
+	closed := false
+	for _, m := range messages {
+		if m.Direction == snapshot.DirectionClient {
+			opcode, err := websocket.Opcode(m.Type)
+			if err != nil {
+				return nil, nil, err
+			}
+			payload, err := m.Payload()
+			if err != nil {
+				return nil, nil, fmt.Errorf("encoding message: %w", err)
+			}
+			if err := ws.WriteMessage(opcode, payload); err != nil {
+				break
+			}
+			actual = append(actual, m)
+			continue
+		}
+		got, err := read()
+		if err != nil {
+			// The remaining recorded messages show up as missing
+			closed = true
+			break
+		}
+		actual = append(actual, got)
+		if got.Type == snapshot.MessageClose {
+			closed = true
+			break
+		}
+	}
+
+	// The recording ended without a close handshake: close the connection,
+	// reporting any further messages the service sends as extra
+	if !closed {
+		ws.WriteMessage(websocket.OpClose, websocket.ClosePayload(1000))
+		for {
+			got, err := read()
+			if err != nil || got.Type == snapshot.MessageClose {
+				break
+			}
+			actual = append(actual, got)
+		}
+	}
+	return result, actual, nil
+}
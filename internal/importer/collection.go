@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// CollectionRequest is a request defined in an API client collection.
+type CollectionRequest struct {
+	Name    string // folders and request name, joined with "/"
+	Method  string
+	URL     string // path and query; the host is left to service.base_url
+	Headers http.Header
+	Body    []byte
+}
+
+// HTTPRequest returns the request, ready to be sent to the service.
+func (c CollectionRequest) HTTPRequest() (*http.Request, error) {
+	req, err := http.NewRequest(c.Method, c.URL, bytes.NewReader(c.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = c.Headers.Clone()
+	return req, nil
+}
+
+// ReadCollection reads the requests of a Postman collection (v2.0 or v2.1)
+// or an Insomnia export (v4), in the order they appear. {{name}} variables
+// are resolved from vars, then from the collection's variables or Insomnia's
+// base environment. Only the path and query of request URLs are kept, so a
+// variable standing for the host, like {{baseUrl}}, need not be defined.
+func ReadCollection(r io.Reader, vars map[string]string) ([]CollectionRequest, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var probe struct {
+		Type string `json:"_type"`
+		Info *struct {
+			Schema string `json:"schema"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("parsing collection: %w", err)
+	}
+	switch {
+	case probe.Info != nil && strings.Contains(probe.Info.Schema, "postman"):
+		return readPostman(data, vars)
+	case probe.Type == "export":
+		return readInsomnia(data, vars)
+	default:
+		return nil, errors.New("not a Postman v2 collection or Insomnia export")
+	}
+}
+
+// variablePattern matches {{name}} and Insomnia's {{ _.name }}.
+var variablePattern = regexp.MustCompile(`\{\{\s*(?:_\.)?([^{}\s]+)\s*\}\}`)
+
+// leadingVariable matches a variable holding the scheme and host of a URL.
+var leadingVariable = regexp.MustCompile(`^\{\{[^{}]*\}\}`)
+
+// resolver substitutes collection variables.
+type resolver map[string]string
+
+func newResolver(defined map[string]string, vars map[string]string) resolver {
+	r := make(resolver, len(defined)+len(vars))
+	for k, v := range defined {
+		r[k] = v
+	}
+	for k, v := range vars {
+		r[k] = v
+	}
+	return r
+}
+
+func (r resolver) resolve(s string) (string, error) {
+	var missing []string
+	out := variablePattern.ReplaceAllStringFunc(s, func(m string) string {
+		name := variablePattern.FindStringSubmatch(m)[1]
+		if v, ok := r[name]; ok {
+			return v
+		}
+		missing = append(missing, name)
+		return m
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %q (set it with --var)", missing[0])
+	}
+	return out, nil
+}
+
+// requestURI resolves raw and returns its path and query.
+func (r resolver) requestURI(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if m := leadingVariable.FindString(raw); m != "" {
+		if _, err := r.resolve(m); err != nil {
+			raw = strings.TrimPrefix(raw, m)
+		}
+	}
+	resolved, err := r.resolve(raw)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(resolved, "://") && !strings.HasPrefix(resolved, "/") {
+		// A host without a scheme, as Postman allows
+		resolved = "http://" + resolved
+	}
+	u, err := url.Parse(resolved)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", resolved, err)
+	}
+	uri := u.RequestURI()
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
+	}
+	return uri, nil
+}
+
+// addAuth sets the Authorization (or API key) header for the schemes both
+// clients share; other schemes are left to explicit headers.
+func addAuth(h http.Header, query url.Values, kind string, params map[string]string) {
+	switch strings.ToLower(kind) {
+	case "bearer":
+		if h.Get("Authorization") == "" && params["token"] != "" {
+			h.Set("Authorization", "Bearer "+params["token"])
+		}
+	case "basic":
+		if h.Get("Authorization") == "" {
+			h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(params["username"]+":"+params["password"])))
+		}
+	case "apikey":
+		if params["key"] == "" {
+			return
+		}
+		if strings.EqualFold(params["in"], "query") || strings.EqualFold(params["addTo"], "queryParams") {
+			query.Set(params["key"], params["value"])
+		} else if h.Get(params["key"]) == "" {
+			h.Set(params["key"], params["value"])
+		}
+	}
+}
+
+// withQuery adds query parameters to a request URI.
+func withQuery(uri string, query url.Values) string {
+	if len(query) == 0 {
+		return uri
+	}
+	sep := "?"
+	if strings.Contains(uri, "?") {
+		sep = "&"
+	}
+	return uri + sep + query.Encode()
+}
+
+// formBody URL-encodes form fields, keeping their order.
+func formBody(fields [][2]string) string {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = url.QueryEscape(f[0]) + "=" + url.QueryEscape(f[1])
+	}
+	return strings.Join(parts, "&")
+}
+
+// multipartBody encodes form fields as multipart/form-data and returns the
+// body with its Content-Type.
+func multipartBody(fields [][2]string) ([]byte, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, f := range fields {
+		w.WriteField(f[0], f[1])
+	}
+	w.Close()
+	return buf.Bytes(), w.FormDataContentType()
+}
@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+const testPostman = `{
+  "info": {"name": "Users", "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},
+  "variable": [{"key": "baseUrl", "value": "https://api.example.com"}, {"key": "userId", "value": 7}],
+  "auth": {"type": "bearer", "bearer": [{"key": "token", "value": "{{token}}"}]},
+  "item": [
+    {
+      "name": "Users",
+      "item": [
+        {
+          "name": "Create",
+          "request": {
+            "method": "POST",
+            "header": [{"key": "X-Off", "value": "1", "disabled": true}],
+            "url": {"raw": "{{baseUrl}}/users?notify=1", "host": ["{{baseUrl}}"], "path": ["users"]},
+            "body": {"mode": "raw", "raw": "{\"name\":\"{{name}}\"}", "options": {"raw": {"language": "json"}}}
+          }
+        },
+        {
+          "name": "Get",
+          "request": {"method": "GET", "url": "{{baseUrl}}/users/{{userId}}", "auth": {"type": "noauth"}}
+        }
+      ]
+    },
+    {
+      "name": "Login",
+      "request": {
+        "method": "POST",
+        "url": "{{host}}/login",
+        "auth": {"type": "basic", "basic": {"username": "ann", "password": "secret"}},
+        "body": {"mode": "urlencoded", "urlencoded": [{"key": "remember", "value": "yes"}, {"key": "skip", "value": "x", "disabled": true}]}
+      }
+    },
+    {
+      "name": "Upload",
+      "request": {
+        "method": "POST",
+        "url": "localhost:3000/upload",
+        "header": [{"key": "Content-Type", "value": "multipart/form-data"}],
+        "body": {"mode": "formdata", "formdata": [{"key": "title", "value": "hi", "type": "text"}]}
+      }
+    },
+    {
+      "name": "Query",
+      "request": {
+        "method": "POST",
+        "url": "/graphql",
+        "auth": {"type": "apikey", "apikey": [{"key": "key", "value": "api_key"}, {"key": "value", "value": "k1"}, {"key": "in", "value": "query"}]},
+        "body": {"mode": "graphql", "graphql": {"query": "{ user(id: {{userId}}) { name } }", "variables": "{\"a\": 1}"}}
+      }
+    }
+  ]
+}`
+
+func TestReadCollection_Postman(t *testing.T) {
+	reqs, err := ReadCollection(strings.NewReader(testPostman), map[string]string{"token": "t0k", "name": "Ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 5 {
+		t.Fatalf("expected 5 requests, got %d", len(reqs))
+	}
+
+	create := reqs[0]
+	if create.Name != "Users/Create" || create.Method != "POST" || create.URL != "/users?notify=1" {
+		t.Errorf("unexpected request %s: %s %s", create.Name, create.Method, create.URL)
+	}
+	if string(create.Body) != `{"name":"Ann"}` || create.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected body %q (%s)", create.Body, create.Headers.Get("Content-Type"))
+	}
+	if create.Headers.Get("Authorization") != "Bearer t0k" || create.Headers.Get("X-Off") != "" {
+		t.Errorf("unexpected headers %v", create.Headers)
+	}
+
+	get := reqs[1]
+	if get.URL != "/users/7" || get.Headers.Get("Authorization") != "" {
+		t.Errorf("expected noauth to override the collection auth, got %s %v", get.URL, get.Headers)
+	}
+
+	login := reqs[2]
+	if login.URL != "/login" {
+		t.Errorf("expected an undefined host variable to be dropped, got %s", login.URL)
+	}
+	if login.Headers.Get("Authorization") != "Basic YW5uOnNlY3JldA==" {
+		t.Errorf("unexpected basic auth %q", login.Headers.Get("Authorization"))
+	}
+	if string(login.Body) != "remember=yes" || login.Headers.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("unexpected form body %q", login.Body)
+	}
+
+	upload := reqs[3]
+	mediaType, params, _ := mime.ParseMediaType(upload.Headers.Get("Content-Type"))
+	if upload.URL != "/upload" || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		t.Fatalf("expected a multipart body with its boundary, got %s %s", upload.URL, upload.Headers.Get("Content-Type"))
+	}
+	part, err := multipart.NewReader(strings.NewReader(string(upload.Body)), params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := io.ReadAll(part); part.FormName() != "title" || string(value) != "hi" {
+		t.Errorf("unexpected form field %s=%s", part.FormName(), value)
+	}
+
+	query := reqs[4]
+	if query.URL != "/graphql?api_key=k1" {
+		t.Errorf("expected the API key in the query, got %s", query.URL)
+	}
+	if string(query.Body) != `{"query":"{ user(id: 7) { name } }","variables":{"a":1}}` {
+		t.Errorf("unexpected GraphQL body %s", query.Body)
+	}
+
+	req, err := create.HTTPRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(req.Body); req.URL.RequestURI() != "/users?notify=1" || string(body) != `{"name":"Ann"}` {
+		t.Errorf("unexpected HTTP request %s %q", req.URL.RequestURI(), body)
+	}
+}
+
+const testInsomnia = `{
+  "_type": "export",
+  "__export_format": 4,
+  "resources": [
+    {"_id": "wrk_1", "_type": "workspace", "name": "API"},
+    {"_id": "env_1", "_type": "environment", "parentId": "wrk_1", "data": {"base_url": "http://localhost:3000", "auth": {"token": "abc"}}},
+    {"_id": "env_2", "_type": "environment", "parentId": "env_1", "data": {"base_url": "https://staging"}},
+    {"_id": "fld_1", "_type": "request_group", "parentId": "wrk_1", "name": "Items"},
+    {
+      "_id": "req_1", "_type": "request", "parentId": "fld_1", "name": "Create item",
+      "method": "post", "url": "{{ _.base_url }}/items",
+      "headers": [{"name": "Content-Type", "value": "application/json"}, {"name": "X-Off", "value": "1", "disabled": true}],
+      "parameters": [{"name": "dry", "value": "false"}],
+      "body": {"mimeType": "application/json", "text": "{\"n\": 1}"},
+      "authentication": {"type": "bearer", "token": "{{ _.auth.token }}"}
+    },
+    {
+      "_id": "req_2", "_type": "request", "parentId": "wrk_1", "name": "Search",
+      "method": "POST", "url": "{{ _.base_url }}/search",
+      "body": {"mimeType": "application/x-www-form-urlencoded", "params": [{"name": "q", "value": "a b"}]},
+      "authentication": {"type": "bearer", "token": "x", "disabled": true}
+    }
+  ]
+}`
+
+func TestReadCollection_Insomnia(t *testing.T) {
+	reqs, err := ReadCollection(strings.NewReader(testInsomnia), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+
+	create := reqs[0]
+	if create.Name != "Items/Create item" || create.Method != "POST" || create.URL != "/items?dry=false" {
+		t.Errorf("unexpected request %s: %s %s", create.Name, create.Method, create.URL)
+	}
+	if create.Headers.Get("Authorization") != "Bearer abc" || create.Headers.Get("X-Off") != "" {
+		t.Errorf("unexpected headers %v", create.Headers)
+	}
+	if string(create.Body) != `{"n": 1}` {
+		t.Errorf("unexpected body %q", create.Body)
+	}
+
+	search := reqs[1]
+	if string(search.Body) != "q=a+b" || search.Headers.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("unexpected form body %q (%s)", search.Body, search.Headers.Get("Content-Type"))
+	}
+	if search.Headers.Get("Authorization") != "" {
+		t.Error("expected disabled authentication to be left out")
+	}
+}
+
+func TestReadCollection_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"not JSON", `nope`, "parsing collection"},
+		{"unknown format", `{"openapi": "3.0.0"}`, "not a Postman"},
+		{"undefined variable", `{"info": {"schema": "https://schema.getpostman.com/json/collection/v2.1.0/"},
+			"item": [{"name": "Get", "request": {"method": "GET", "url": "/users/{{id}}"}}]}`, `request "Get": undefined variable "id"`},
+		{"file upload", `{"info": {"schema": "https://schema.getpostman.com/json/collection/v2.0.0/"},
+			"item": [{"name": "Up", "request": {"method": "POST", "url": "/up",
+				"body": {"mode": "formdata", "formdata": [{"key": "f", "type": "file", "src": "a.png"}]}}}]}`, "file uploads are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadCollection(strings.NewReader(tt.data), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Package importer converts traffic captured by other tools into snapshots.
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// har is the subset of the HAR 1.2 format (http://www.softwareishard.com/blog/har-12-spec/)
+// that snapshots can hold.
+type har struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method   string       `json:"method"`
+	URL      string       `json:"url"`
+	Headers  []harNameVal `json:"headers"`
+	PostData *struct {
+		MimeType string       `json:"mimeType"`
+		Text     string       `json:"text"`
+		Params   []harNameVal `json:"params"`
+	} `json:"postData"`
+}
+
+type harResponse struct {
+	Status  int          `json:"status"`
+	Headers []harNameVal `json:"headers"`
+	Content struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Encoding string `json:"encoding"` // "base64" for binary content
+	} `json:"content"`
+}
+
+type harNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harTimings are in milliseconds; -1 marks a phase that does not apply.
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// ImportedFromHAR is the Snapshot.ImportedFrom of snapshots converted by
+// ReadHAR.
+const ImportedFromHAR = "har"
+
+// HAROptions configures ReadHAR.
+type HAROptions struct {
+	Service       string   // service name stored in the snapshots
+	Host          string   // only import requests to this host (with port, if any); empty imports all
+	Tags          []string // tags added to every snapshot
+	IgnoreHeaders []string // headers left out, as recording.ignore_headers
+}
+
+// ReadHAR converts the entries of a HAR capture, such as one exported from
+// browser devtools, into snapshots, in the order they were captured.
+// Entries the browser never got an answer for and WebSocket upgrades are
+// skipped. The snapshots have no DB state and are marked as imported, so
+// they are replayed without comparing the database.
+func ReadHAR(r io.Reader, opts HAROptions) ([]*snapshot.Snapshot, error) {
+	var doc har
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing HAR: %w", err)
+	}
+
+	ignore := make(map[string]bool)
+	for _, h := range opts.IgnoreHeaders {
+		ignore[strings.ToLower(h)] = true
+	}
+
+	var snapshots []*snapshot.Snapshot
+	for i, entry := range doc.Log.Entries {
+		if entry.Response.Status == 0 || entry.Response.Status == http.StatusSwitchingProtocols {
+			continue
+		}
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: invalid URL %q: %w", i, entry.Request.URL, err)
+		}
+		if opts.Host != "" && !strings.EqualFold(u.Host, opts.Host) {
+			continue
+		}
+		snap, err := harSnapshot(entry, u, ignore)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d (%s %s): %w", i, entry.Request.Method, entry.Request.URL, err)
+		}
+		snap.Service = opts.Service
+		snap.Tags = append([]string(nil), opts.Tags...)
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, nil
+}
+
+func harSnapshot(entry harEntry, u *url.URL, ignore map[string]bool) (*snapshot.Snapshot, error) {
+	reqHeaders := harHeaders(entry.Request.Headers, ignore)
+	delete(reqHeaders, "Host")
+	delete(reqHeaders, "Content-Length")
+	var reqBody any
+	if pd := entry.Request.PostData; pd != nil {
+		contentType := reqHeaders[snapshot.HeaderContentType]
+		if contentType == "" {
+			contentType = pd.MimeType
+		}
+		raw := []byte(pd.Text)
+		if pd.Text == "" && len(pd.Params) > 0 {
+			form := url.Values{}
+			for _, p := range pd.Params {
+				form.Add(p.Name, p.Value)
+			}
+			raw = []byte(form.Encode())
+		}
+		reqBody = snapshot.ParseBody(raw, contentType)
+	}
+
+	content := entry.Response.Content
+	raw := []byte(content.Text)
+	if content.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(content.Text)
+		if err != nil {
+			return nil, fmt.Errorf("decoding response content: %w", err)
+		}
+		raw = decoded
+	}
+	respHeaders := harHeaders(entry.Response.Headers, ignore)
+	contentType := respHeaders[snapshot.HeaderContentType]
+	if contentType == "" {
+		contentType = content.MimeType
+	}
+
+	timestamp := entry.StartedDateTime.UTC()
+	if timestamp.IsZero() {
+		timestamp = time.Now().UTC()
+	}
+	return &snapshot.Snapshot{
+		ID:           snapshot.GenerateID(),
+		Timestamp:    timestamp,
+		ImportedFrom: ImportedFromHAR,
+		Request: snapshot.Request{
+			Method:  strings.ToUpper(entry.Request.Method),
+			URL:     u.RequestURI(),
+			Headers: reqHeaders,
+			Body:    reqBody,
+		},
+		Response: snapshot.Response{
+			Status:  entry.Response.Status,
+			Headers: respHeaders,
+			Body:    snapshot.ParseBody(raw, contentType),
+		},
+		Timing: &snapshot.Timing{
+			DurationMs: int64(entry.Time),
+			UpstreamMs: int64(phase(entry.Timings.Send) + phase(entry.Timings.Wait) + phase(entry.Timings.Receive)),
+		},
+	}, nil
+}
+
+// harHeaders flattens HAR headers like recorded ones: repeated headers are
+// joined with ", " and Content-Type is normalized. HTTP/2 pseudo-headers
+// are left out.
+func harHeaders(list []harNameVal, ignore map[string]bool) map[string]string {
+	h := make(http.Header)
+	for _, nv := range list {
+		if strings.HasPrefix(nv.Name, ":") || ignore[strings.ToLower(nv.Name)] {
+			continue
+		}
+		h.Add(nv.Name, nv.Value)
+	}
+	headers := make(map[string]string, len(h))
+	for k, v := range h {
+		value := strings.Join(v, ", ")
+		if k == snapshot.HeaderContentType {
+			value = snapshot.NormalizeContentType(value)
+		}
+		headers[k] = value
+	}
+	return headers
+}
+
+func phase(ms float64) float64 {
+	if ms < 0 {
+		return 0
+	}
+	return ms
+}
@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+const testHAR = `{
+  "log": {
+    "version": "1.2",
+    "entries": [
+      {
+        "startedDateTime": "2024-05-01T10:00:00.000+02:00",
+        "time": 42.5,
+        "request": {
+          "method": "post",
+          "url": "https://api.example.com/users?notify=1",
+          "headers": [
+            {"name": ":authority", "value": "api.example.com"},
+            {"name": "Host", "value": "api.example.com"},
+            {"name": "Content-Type", "value": "application/json; charset=UTF-8"},
+            {"name": "Content-Length", "value": "15"},
+            {"name": "Accept", "value": "application/json"},
+            {"name": "Accept", "value": "text/plain"},
+            {"name": "X-Request-Start", "value": "123"}
+          ],
+          "postData": {"mimeType": "application/json", "text": "{\"name\":\"Ann\"}"}
+        },
+        "response": {
+          "status": 201,
+          "headers": [{"name": "content-type", "value": "application/json"}],
+          "content": {"mimeType": "application/json", "text": "eyJpZCI6MX0=", "encoding": "base64"}
+        },
+        "timings": {"blocked": 2, "dns": -1, "send": 1, "wait": 30, "receive": 4}
+      },
+      {
+        "startedDateTime": "2024-05-01T10:00:01.000Z",
+        "time": 10,
+        "request": {
+          "method": "POST",
+          "url": "https://api.example.com/login",
+          "headers": [],
+          "postData": {"mimeType": "application/x-www-form-urlencoded", "params": [{"name": "user", "value": "ann"}]}
+        },
+        "response": {"status": 200, "headers": [], "content": {"mimeType": "text/plain", "text": "ok"}},
+        "timings": {"send": -1, "wait": 8, "receive": -1}
+      },
+      {
+        "startedDateTime": "2024-05-01T10:00:02.000Z",
+        "request": {"method": "GET", "url": "https://cdn.example.com/app.js", "headers": []},
+        "response": {"status": 200, "headers": [], "content": {"mimeType": "text/javascript", "text": ""}},
+        "timings": {}
+      },
+      {
+        "startedDateTime": "2024-05-01T10:00:03.000Z",
+        "request": {"method": "GET", "url": "https://api.example.com/slow", "headers": []},
+        "response": {"status": 0, "headers": [], "content": {}},
+        "timings": {}
+      }
+    ]
+  }
+}`
+
+func TestReadHAR(t *testing.T) {
+	snaps, err := ReadHAR(strings.NewReader(testHAR), HAROptions{
+		Service:       "api",
+		Host:          "API.example.com",
+		Tags:          []string{"imported"},
+		IgnoreHeaders: []string{"x-request-start"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 {
+		t.Fatalf("expected the 2 answered api.example.com requests, got %d", len(snaps))
+	}
+
+	snap := snaps[0]
+	if snap.ID == "" || snap.Service != "api" || !reflect.DeepEqual(snap.Tags, []string{"imported"}) {
+		t.Errorf("unexpected metadata: id=%q service=%q tags=%v", snap.ID, snap.Service, snap.Tags)
+	}
+	if got := snap.Timestamp.Format("2006-01-02T15:04:05Z07:00"); got != "2024-05-01T08:00:00Z" {
+		t.Errorf("expected the capture time in UTC, got %s", got)
+	}
+	if snap.Request.Method != "POST" || snap.Request.URL != "/users?notify=1" {
+		t.Errorf("unexpected request line %s %s", snap.Request.Method, snap.Request.URL)
+	}
+	wantHeaders := map[string]string{
+		"Content-Type": "application/json",
+		"Accept":       "application/json, text/plain",
+	}
+	if !reflect.DeepEqual(snap.Request.Headers, wantHeaders) {
+		t.Errorf("expected request headers %v, got %v", wantHeaders, snap.Request.Headers)
+	}
+	if !reflect.DeepEqual(snap.Request.Body, map[string]any{"name": "Ann"}) {
+		t.Errorf("expected a parsed JSON request body, got %#v", snap.Request.Body)
+	}
+	if snap.Response.Status != 201 || snap.Response.Headers["Content-Type"] != "application/json" {
+		t.Errorf("unexpected response %d %v", snap.Response.Status, snap.Response.Headers)
+	}
+	if !reflect.DeepEqual(snap.Response.Body, map[string]any{"id": float64(1)}) {
+		t.Errorf("expected the base64 response content decoded, got %#v", snap.Response.Body)
+	}
+	if snap.Timing == nil || snap.Timing.DurationMs != 42 || snap.Timing.UpstreamMs != 35 {
+		t.Errorf("expected timing 42ms/35ms, got %+v", snap.Timing)
+	}
+	if snap.DBStateBefore != nil || snap.DBStateAfter != nil || snap.ImportedFrom != ImportedFromHAR {
+		t.Errorf("expected no DB state and the snapshot marked as imported, got %q", snap.ImportedFrom)
+	}
+
+	login := snaps[1]
+	if form, ok := login.Request.Body.(*snapshot.EncodedBody); !ok || !reflect.DeepEqual(form.Data, map[string]any{"user": "ann"}) {
+		t.Errorf("expected the form params as a form body, got %#v", login.Request.Body)
+	}
+	if login.Timing.UpstreamMs != 8 {
+		t.Errorf("expected phases marked -1 to be ignored, got %dms", login.Timing.UpstreamMs)
+	}
+	if login.Response.Body != "ok" {
+		t.Errorf("expected the text response body, got %#v", login.Response.Body)
+	}
+}
+
+func TestReadHAR_Errors(t *testing.T) {
+	if _, err := ReadHAR(strings.NewReader("not json"), HAROptions{}); err == nil {
+		t.Error("expected invalid JSON to be rejected")
+	}
+	bad := `{"log":{"entries":[{"request":{"method":"GET","url":"https://x/"},
+		"response":{"status":200,"content":{"text":"%%%","encoding":"base64"}}}]}}`
+	if _, err := ReadHAR(strings.NewReader(bad), HAROptions{}); err == nil || !strings.Contains(err.Error(), "entry 0") {
+		t.Errorf("expected the broken entry to be reported, got %v", err)
+	}
+}
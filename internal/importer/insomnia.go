@@ -0,0 +1,178 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// insomniaExport is the subset of the Insomnia export format (v4) that
+// describes requests and their base environment.
+type insomniaExport struct {
+	Resources []insomniaResource `json:"resources"`
+}
+
+type insomniaResource struct {
+	ID       string `json:"_id"`
+	Type     string `json:"_type"`
+	ParentID string `json:"parentId"`
+	Name     string `json:"name"`
+
+	// request
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers []insomniaNameVal `json:"headers"`
+	Params  []insomniaNameVal `json:"parameters"`
+	Body    struct {
+		MimeType string            `json:"mimeType"`
+		Text     string            `json:"text"`
+		Params   []insomniaNameVal `json:"params"`
+	} `json:"body"`
+	Authentication map[string]any `json:"authentication"`
+
+	// environment
+	Data map[string]any `json:"data"`
+}
+
+type insomniaNameVal struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Type     string `json:"type"` // "file" for file form fields
+	Disabled bool   `json:"disabled"`
+}
+
+func readInsomnia(data []byte, vars map[string]string) ([]CollectionRequest, error) {
+	var export insomniaExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("parsing Insomnia export: %w", err)
+	}
+
+	byID := make(map[string]insomniaResource)
+	for _, r := range export.Resources {
+		byID[r.ID] = r
+	}
+	defined := make(map[string]string)
+	for _, r := range export.Resources {
+		// The base environment belongs to the workspace; sub-environments,
+		// which belong to it, are alternatives to choose from
+		if r.Type == "environment" && byID[r.ParentID].Type == "workspace" {
+			flattenEnvironment(defined, "", r.Data)
+		}
+	}
+	res := newResolver(defined, vars)
+
+	var requests []CollectionRequest
+	for _, r := range export.Resources {
+		if r.Type != "request" {
+			continue
+		}
+		name := r.Name
+		for p := byID[r.ParentID]; p.Type == "request_group"; p = byID[p.ParentID] {
+			name = p.Name + "/" + name
+		}
+		req, err := insomniaToRequest(r, res)
+		if err != nil {
+			return nil, fmt.Errorf("request %q: %w", name, err)
+		}
+		req.Name = name
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+// flattenEnvironment adds environment values to vars, nested objects under
+// dotted names, as Insomnia's {{ _.a.b }} refers to them.
+func flattenEnvironment(vars map[string]string, prefix string, data map[string]any) {
+	for k, v := range data {
+		if nested, ok := v.(map[string]any); ok {
+			flattenEnvironment(vars, prefix+k+".", nested)
+			continue
+		}
+		vars[prefix+k] = fmt.Sprint(v)
+	}
+}
+
+func insomniaToRequest(r insomniaResource, res resolver) (CollectionRequest, error) {
+	uri, err := res.requestURI(r.URL)
+	if err != nil {
+		return CollectionRequest{}, err
+	}
+	req := CollectionRequest{Method: strings.ToUpper(r.Method), Headers: make(http.Header)}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	for _, h := range r.Headers {
+		if h.Disabled || h.Name == "" {
+			continue
+		}
+		value, err := res.resolve(h.Value)
+		if err != nil {
+			return CollectionRequest{}, err
+		}
+		req.Headers.Add(h.Name, value)
+	}
+
+	query := url.Values{}
+	for _, p := range r.Params {
+		if p.Disabled {
+			continue
+		}
+		value, err := res.resolve(p.Value)
+		if err != nil {
+			return CollectionRequest{}, err
+		}
+		query.Add(p.Name, value)
+	}
+	if disabled, _ := r.Authentication["disabled"].(bool); !disabled && r.Authentication != nil {
+		params := make(map[string]string)
+		for k, v := range r.Authentication {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			if params[k], err = res.resolve(s); err != nil {
+				return CollectionRequest{}, err
+			}
+		}
+		addAuth(req.Headers, query, params["type"], params)
+	}
+	req.URL = withQuery(uri, query)
+
+	contentType := r.Body.MimeType
+	switch {
+	case len(r.Body.Params) > 0:
+		fields := make([][2]string, 0, len(r.Body.Params))
+		for _, p := range r.Body.Params {
+			if p.Disabled {
+				continue
+			}
+			if p.Type == "file" {
+				return CollectionRequest{}, fmt.Errorf("form field %q: file uploads are not supported", p.Name)
+			}
+			value, err := res.resolve(p.Value)
+			if err != nil {
+				return CollectionRequest{}, err
+			}
+			fields = append(fields, [2]string{p.Name, value})
+		}
+		if strings.HasPrefix(contentType, "multipart/") {
+			// The boundary is new, so a Content-Type header can't be kept
+			req.Body, contentType = multipartBody(fields)
+			req.Headers.Set("Content-Type", contentType)
+		} else {
+			req.Body = []byte(formBody(fields))
+		}
+	case r.Body.Text != "":
+		text, err := res.resolve(r.Body.Text)
+		if err != nil {
+			return CollectionRequest{}, err
+		}
+		req.Body = []byte(text)
+	}
+	if contentType != "" && req.Headers.Get("Content-Type") == "" {
+		req.Headers.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
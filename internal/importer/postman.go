@@ -0,0 +1,281 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// postmanCollection is the subset of the Postman collection format
+// (https://schema.postman.com) that describes requests.
+type postmanCollection struct {
+	Item     []postmanItem `json:"item"`
+	Variable []postmanKV   `json:"variable"`
+	Auth     *postmanAuth  `json:"auth"`
+}
+
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item"` // set for folders
+	Request json.RawMessage `json:"request"`
+	Auth    *postmanAuth    `json:"auth"` // folder auth
+}
+
+type postmanRequest struct {
+	Method string          `json:"method"`
+	Header []postmanKV     `json:"header"`
+	URL    json.RawMessage `json:"url"` // a string or {"raw": ...}
+	Body   *struct {
+		Mode       string      `json:"mode"`
+		Raw        string      `json:"raw"`
+		URLEncoded []postmanKV `json:"urlencoded"`
+		FormData   []postmanKV `json:"formdata"`
+		GraphQL    *struct {
+			Query     string `json:"query"`
+			Variables string `json:"variables"`
+		} `json:"graphql"`
+		Options struct {
+			Raw struct {
+				Language string `json:"language"`
+			} `json:"raw"`
+		} `json:"options"`
+	} `json:"body"`
+	Auth *postmanAuth `json:"auth"`
+}
+
+type postmanKV struct {
+	Key      string `json:"key"`
+	Value    any    `json:"value"`
+	Type     string `json:"type"` // "file" for file form fields
+	Disabled bool   `json:"disabled"`
+}
+
+func (kv postmanKV) value() string {
+	if kv.Value == nil {
+		return ""
+	}
+	if s, ok := kv.Value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(kv.Value)
+}
+
+// postmanAuth holds its parameters under the key named by Type, as a list
+// of key/value pairs (v2.1) or an object (v2.0).
+type postmanAuth struct {
+	Type   string
+	Params map[string]string
+}
+
+func (a *postmanAuth) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw["type"], &a.Type); err != nil {
+		return fmt.Errorf("auth type: %w", err)
+	}
+	a.Params = make(map[string]string)
+	params := raw[a.Type]
+	var list []postmanKV
+	if err := json.Unmarshal(params, &list); err == nil {
+		for _, kv := range list {
+			a.Params[kv.Key] = kv.value()
+		}
+		return nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(params, &obj); err == nil {
+		for k, v := range obj {
+			a.Params[k] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// postmanLanguages maps raw body languages to the Content-Type Postman sends.
+var postmanLanguages = map[string]string{
+	"json":       "application/json",
+	"xml":        "application/xml",
+	"html":       "text/html",
+	"javascript": "application/javascript",
+	"text":       "text/plain",
+}
+
+func readPostman(data []byte, vars map[string]string) ([]CollectionRequest, error) {
+	var coll postmanCollection
+	if err := json.Unmarshal(data, &coll); err != nil {
+		return nil, fmt.Errorf("parsing Postman collection: %w", err)
+	}
+	defined := make(map[string]string)
+	for _, v := range coll.Variable {
+		if !v.Disabled {
+			defined[v.Key] = v.value()
+		}
+	}
+	res := newResolver(defined, vars)
+
+	var requests []CollectionRequest
+	var walk func(items []postmanItem, prefix string, auth *postmanAuth) error
+	walk = func(items []postmanItem, prefix string, auth *postmanAuth) error {
+		for _, item := range items {
+			name := prefix + item.Name
+			if item.Request == nil {
+				inherited := auth
+				if item.Auth != nil {
+					inherited = item.Auth
+				}
+				if err := walk(item.Item, name+"/", inherited); err != nil {
+					return err
+				}
+				continue
+			}
+			req, err := postmanToRequest(item.Request, auth, res)
+			if err != nil {
+				return fmt.Errorf("request %q: %w", name, err)
+			}
+			req.Name = name
+			requests = append(requests, req)
+		}
+		return nil
+	}
+	if err := walk(coll.Item, "", coll.Auth); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func postmanToRequest(raw json.RawMessage, inherited *postmanAuth, res resolver) (CollectionRequest, error) {
+	var pr postmanRequest
+	var rawURL string
+	if err := json.Unmarshal(raw, &rawURL); err == nil {
+		// A request given as just its URL
+		pr.Method = http.MethodGet
+	} else if err := json.Unmarshal(raw, &pr); err != nil {
+		return CollectionRequest{}, err
+	} else if err := json.Unmarshal(pr.URL, &rawURL); err != nil {
+		var u struct {
+			Raw string `json:"raw"`
+		}
+		json.Unmarshal(pr.URL, &u)
+		rawURL = u.Raw
+	}
+
+	uri, err := res.requestURI(rawURL)
+	if err != nil {
+		return CollectionRequest{}, err
+	}
+	req := CollectionRequest{Method: strings.ToUpper(pr.Method), Headers: make(http.Header)}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	for _, h := range pr.Header {
+		if h.Disabled {
+			continue
+		}
+		value, err := res.resolve(h.value())
+		if err != nil {
+			return CollectionRequest{}, err
+		}
+		req.Headers.Add(h.Key, value)
+	}
+
+	auth := inherited
+	if pr.Auth != nil {
+		auth = pr.Auth
+	}
+	query := url.Values{}
+	if auth != nil {
+		params := make(map[string]string, len(auth.Params))
+		for k, v := range auth.Params {
+			if params[k], err = res.resolve(v); err != nil {
+				return CollectionRequest{}, err
+			}
+		}
+		addAuth(req.Headers, query, auth.Type, params)
+	}
+	req.URL = withQuery(uri, query)
+
+	if pr.Body != nil {
+		body, contentType, err := postmanBody(pr, res)
+		if err != nil {
+			return CollectionRequest{}, err
+		}
+		req.Body = body
+		// A multipart boundary is new, so a Content-Type header can't be kept
+		if contentType != "" && (req.Headers.Get("Content-Type") == "" || strings.HasPrefix(contentType, "multipart/")) {
+			req.Headers.Set("Content-Type", contentType)
+		}
+	}
+	return req, nil
+}
+
+// postmanBody encodes a request body and returns the Content-Type Postman
+// would send with it.
+func postmanBody(pr postmanRequest, res resolver) ([]byte, string, error) {
+	b := pr.Body
+	switch b.Mode {
+	case "raw":
+		text, err := res.resolve(b.Raw)
+		if err != nil {
+			return nil, "", err
+		}
+		contentType := postmanLanguages[b.Options.Raw.Language]
+		if contentType == "" && text != "" {
+			contentType = "text/plain"
+		}
+		return []byte(text), contentType, nil
+	case "urlencoded", "formdata":
+		list := b.URLEncoded
+		if b.Mode == "formdata" {
+			list = b.FormData
+		}
+		fields := make([][2]string, 0, len(list))
+		for _, kv := range list {
+			if kv.Disabled {
+				continue
+			}
+			if kv.Type == "file" {
+				return nil, "", fmt.Errorf("form field %q: file uploads are not supported", kv.Key)
+			}
+			value, err := res.resolve(kv.value())
+			if err != nil {
+				return nil, "", err
+			}
+			fields = append(fields, [2]string{kv.Key, value})
+		}
+		if b.Mode == "formdata" {
+			body, contentType := multipartBody(fields)
+			return body, contentType, nil
+		}
+		return []byte(formBody(fields)), "application/x-www-form-urlencoded", nil
+	case "graphql":
+		if b.GraphQL == nil {
+			return nil, "", nil
+		}
+		query, err := res.resolve(b.GraphQL.Query)
+		if err != nil {
+			return nil, "", err
+		}
+		payload := map[string]any{"query": query}
+		if v := strings.TrimSpace(b.GraphQL.Variables); v != "" {
+			resolved, err := res.resolve(v)
+			if err != nil {
+				return nil, "", err
+			}
+			var variables any
+			if err := json.Unmarshal([]byte(resolved), &variables); err != nil {
+				return nil, "", fmt.Errorf("GraphQL variables: %w", err)
+			}
+			payload["variables"] = variables
+		}
+		data, err := json.Marshal(payload)
+		return data, "application/json", err
+	case "", "none":
+		return nil, "", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported body mode %q", b.Mode)
+	}
+}
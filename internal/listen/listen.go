@@ -0,0 +1,154 @@
+package listen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Listen spec forms accepted by Open, in addition to "" for a TCP port.
+const (
+	prefixUnix    = "unix://"
+	specSystemd   = "systemd"
+	prefixSystemd = "systemd:"
+)
+
+// systemd socket activation protocol (see sd_listen_fds(3)).
+const (
+	envListenPID     = "LISTEN_PID"
+	envListenFDs     = "LISTEN_FDS"
+	envListenFDNames = "LISTEN_FDNAMES"
+	listenFDsStart   = 3
+)
+
+// Open returns a listener for spec:
+//
+//   - ""                      TCP on host:port (host "" means all interfaces)
+//   - "unix:///run/app.sock"  a unix domain socket; a stale socket file is replaced
+//   - "systemd"               the first socket passed by systemd socket activation
+//   - "systemd:<name>"        the activated socket named <name> (FileDescriptorName=)
+func Open(spec string, port int, host string) (net.Listener, error) {
+	switch {
+	case spec == "":
+		return net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	case strings.HasPrefix(spec, prefixUnix):
+		return openUnix(strings.TrimPrefix(spec, prefixUnix))
+	case spec == specSystemd:
+		return openSystemd("")
+	case strings.HasPrefix(spec, prefixSystemd):
+		return openSystemd(strings.TrimPrefix(spec, prefixSystemd))
+	default:
+		return nil, fmt.Errorf("invalid listen address %q (must be unix:///path, systemd or systemd:<name>)", spec)
+	}
+}
+
+// Validate reports whether spec is a form Open accepts, without opening it.
+func Validate(spec string) error {
+	switch {
+	case spec == "", spec == specSystemd:
+		return nil
+	case strings.HasPrefix(spec, prefixUnix):
+		if strings.TrimPrefix(spec, prefixUnix) == "" {
+			return fmt.Errorf("listen address %q has no socket path", spec)
+		}
+		return nil
+	case strings.HasPrefix(spec, prefixSystemd):
+		if strings.TrimPrefix(spec, prefixSystemd) == "" {
+			return fmt.Errorf("listen address %q has no socket name", spec)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid listen address %q (must be unix:///path, systemd or systemd:<name>)", spec)
+	}
+}
+
+// IsTCP reports whether l listens on a TCP address that clients can dial
+// with a host:port URL.
+func IsTCP(l net.Listener) bool {
+	_, ok := l.Addr().(*net.TCPAddr)
+	return ok
+}
+
+func openUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("unix listen address has no socket path")
+	}
+	// A socket left behind by a previous run would make the bind fail
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket %s: %w", path, err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+var (
+	systemdOnce      sync.Once
+	systemdMu        sync.Mutex
+	systemdListeners []namedListener
+	systemdErr       error
+)
+
+type namedListener struct {
+	name     string
+	listener net.Listener
+}
+
+// openSystemd hands out a socket inherited from systemd. Each socket can be
+// taken once; name selects by FileDescriptorName, "" takes the next one.
+func openSystemd(name string) (net.Listener, error) {
+	systemdOnce.Do(func() {
+		systemdListeners, systemdErr = inheritSystemdListeners()
+	})
+	if systemdErr != nil {
+		return nil, systemdErr
+	}
+
+	systemdMu.Lock()
+	defer systemdMu.Unlock()
+	for i, nl := range systemdListeners {
+		if nl.listener == nil || (name != "" && nl.name != name) {
+			continue
+		}
+		systemdListeners[i].listener = nil
+		return nl.listener, nil
+	}
+	if name != "" {
+		return nil, fmt.Errorf("no systemd socket named %q was passed (check FileDescriptorName= in the .socket unit)", name)
+	}
+	return nil, errors.New("no unused systemd socket was passed (is the service socket-activated?)")
+}
+
+// inheritSystemdListeners converts the file descriptors passed by systemd
+// into listeners.
+func inheritSystemdListeners() ([]namedListener, error) {
+	if pid := os.Getenv(envListenPID); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, fmt.Errorf("systemd sockets were passed to process %s, not this one", pid)
+	}
+	count, err := strconv.Atoi(os.Getenv(envListenFDs))
+	if err != nil || count < 1 {
+		return nil, errors.New("no systemd sockets were passed (LISTEN_FDS is not set)")
+	}
+	names := strings.Split(os.Getenv(envListenFDNames), ":")
+
+	listeners := make([]namedListener, 0, count)
+	for i := 0; i < count; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("systemd socket %d (%s): %w", listenFDsStart+i, name, err)
+		}
+		listeners = append(listeners, namedListener{name: name, listener: ln})
+	}
+	return listeners, nil
+}
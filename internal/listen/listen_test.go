@@ -0,0 +1,145 @@
+package listen
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpen_TCP(t *testing.T) {
+	ln, err := Open("", 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if !IsTCP(ln) {
+		t.Errorf("expected TCP listener, got %s", ln.Addr().Network())
+	}
+}
+
+func TestOpen_UnixReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+
+	first, err := Open("unix://"+path, 0, "")
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	// Simulate a crash that left the socket file behind
+	first.(*net.UnixListener).SetUnlinkOnClose(false)
+	first.Close()
+
+	second, err := Open("unix://"+path, 0, "")
+	if err != nil {
+		t.Fatalf("expected stale socket to be replaced, got %v", err)
+	}
+	defer second.Close()
+	if IsTCP(second) {
+		t.Error("expected unix listener")
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestOpen_UnixRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open("unix://"+path, 0, ""); err == nil {
+		t.Error("expected error when a regular file is in the way")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected regular file to be left alone: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []string{"", "unix:///run/app.sock", "systemd", "systemd:proxy"}
+	for _, spec := range valid {
+		if err := Validate(spec); err != nil {
+			t.Errorf("Validate(%q): unexpected error %v", spec, err)
+		}
+	}
+	invalid := []string{"unix://", "systemd:", ":8080", "tcp://0.0.0.0:80"}
+	for _, spec := range invalid {
+		if err := Validate(spec); err == nil {
+			t.Errorf("Validate(%q): expected error", spec)
+		}
+	}
+}
+
+func TestOpen_SystemdWithoutSockets(t *testing.T) {
+	if os.Getenv(envListenFDs) != "" {
+		t.Skip("running under socket activation")
+	}
+	if _, err := Open("systemd", 0, ""); err == nil {
+		t.Error("expected error when no sockets were passed")
+	}
+}
+
+// TestOpen_Systemd re-runs the test binary with two listening sockets passed
+// the way systemd does: as fds 3 and 4 with LISTEN_FDS and LISTEN_FDNAMES.
+func TestOpen_Systemd(t *testing.T) {
+	if os.Getenv("LISTEN_TEST_CHILD") != "" {
+		t.Skip("helper process")
+	}
+
+	var files []*os.File
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		f, err := ln.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		files = append(files, f)
+		addrs = append(addrs, ln.Addr().String())
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdHelperProcess$")
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		"LISTEN_TEST_CHILD=1",
+		envListenFDs+"=2",
+		envListenFDNames+"=admin:proxy",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("helper failed: %v\n%s", err, out)
+	}
+	want := fmt.Sprintf("proxy=%s admin=%s", addrs[1], addrs[0])
+	if !strings.Contains(string(out), want) {
+		t.Errorf("expected %q in helper output:\n%s", want, out)
+	}
+}
+
+func TestSystemdHelperProcess(t *testing.T) {
+	if os.Getenv("LISTEN_TEST_CHILD") == "" {
+		t.Skip("only runs as a helper for TestOpen_Systemd")
+	}
+	proxy, err := Open("systemd:proxy", 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := Open("systemd", 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open("systemd", 0, ""); err == nil {
+		t.Fatal("expected every socket to be handed out only once")
+	}
+	fmt.Printf("proxy=%s admin=%s\n", proxy.Addr(), next.Addr())
+}
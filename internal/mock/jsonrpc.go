@@ -0,0 +1,132 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// jsonRPCResult is a recorded answer to one JSON-RPC call.
+type jsonRPCResult struct {
+	response map[string]any     // the call's response object
+	http     *snapshot.Response // the HTTP response it came in
+}
+
+// indexJSONRPC records the responses to the JSON-RPC calls in an outgoing
+// request under their call keys. Requests that aren't JSON-RPC, and
+// notifications, which have no response, are skipped.
+func indexJSONRPC(index map[string][]jsonRPCResult, o *snapshot.OutgoingRequest) {
+	calls, _, ok := jsonRPCCalls(o.Body)
+	if !ok || o.Response == nil {
+		return
+	}
+	byID := make(map[string]map[string]any)
+	responses, isBatch := o.Response.Body.([]any)
+	if !isBatch {
+		responses = []any{o.Response.Body}
+	}
+	for _, r := range responses {
+		if m, ok := r.(map[string]any); ok {
+			byID[fmt.Sprintf("%v", m["id"])] = m
+		}
+	}
+	path := urlPath(o.URL)
+	for _, call := range calls {
+		id, hasID := call["id"]
+		if !hasID {
+			continue
+		}
+		if response, ok := byID[fmt.Sprintf("%v", id)]; ok {
+			key := jsonRPCKey(path, call)
+			index[key] = append(index[key], jsonRPCResult{response: response, http: o.Response})
+		}
+	}
+}
+
+// answerJSONRPC builds the response to a JSON-RPC request from the recorded
+// responses to calls with the same method and params, whatever ids the
+// service picked, and keeps the order of the calls in a batch. Repeated
+// calls get the recorded responses in turn, the last one being reused.
+// ok is false unless every call with an id has a recorded response.
+func (s *Server) answerJSONRPC(path string, calls []map[string]any, batch bool) (*snapshot.Response, bool) {
+	var keys []string
+	var ids []any
+	for _, call := range calls {
+		id, hasID := call["id"]
+		if !hasID {
+			continue
+		}
+		key := jsonRPCKey(path, call)
+		if len(s.jsonRPC[key]) == 0 {
+			return nil, false
+		}
+		keys = append(keys, key)
+		ids = append(ids, id)
+	}
+	if len(keys) == 0 {
+		return nil, false
+	}
+
+	var status int
+	var answers []any
+	for i, key := range keys {
+		results := s.jsonRPC[key]
+		result := results[0]
+		if len(results) > 1 {
+			s.jsonRPC[key] = results[1:]
+		}
+		if status == 0 {
+			status = result.http.Status
+		}
+		answer := make(map[string]any, len(result.response))
+		for k, v := range result.response {
+			answer[k] = v
+		}
+		answer["id"] = ids[i]
+		answers = append(answers, answer)
+	}
+	if !batch {
+		return &snapshot.Response{Status: status, Body: answers[0]}, true
+	}
+	return &snapshot.Response{Status: status, Body: answers}, true
+}
+
+// jsonRPCCalls returns the calls in a JSON-RPC request body, which holds a
+// single call or a batch of them. ok is false for other bodies.
+func jsonRPCCalls(body any) (calls []map[string]any, batch bool, ok bool) {
+	list, batch := body.([]any)
+	if !batch {
+		list = []any{body}
+	}
+	if len(list) == 0 {
+		return nil, false, false
+	}
+	for _, v := range list {
+		call, isMap := v.(map[string]any)
+		if !isMap || call["jsonrpc"] == nil {
+			return nil, false, false
+		}
+		if _, hasMethod := call["method"].(string); !hasMethod {
+			return nil, false, false
+		}
+		calls = append(calls, call)
+	}
+	return calls, batch, true
+}
+
+// jsonRPCKey identifies a call by endpoint path, method and params. Params
+// are marshalled with sorted keys, so equal params give equal keys.
+func jsonRPCKey(path string, call map[string]any) string {
+	params, _ := json.Marshal(call["params"])
+	return fmt.Sprintf("%s %s %s", path, call["method"], params)
+}
+
+// urlPath returns the path of a recorded URL, which may be absolute.
+func urlPath(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Path
+	}
+	return rawURL
+}
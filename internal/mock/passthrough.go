@@ -0,0 +1,84 @@
+package mock
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+// passthroughDialTimeout bounds connecting to the destination of a
+// passed-through CONNECT tunnel.
+const passthroughDialTimeout = 10 * time.Second
+
+// SetPassthrough makes the server forward calls it receives as an HTTP
+// proxy to the hosts pass reports true for (host or host:port), instead of
+// answering them from the expectations, as the outgoing proxy does for
+// recording.outgoing_hosts passthrough rules. HTTPS tunnels are relayed
+// without interception. Forwarded calls are not recorded. Call before
+// Start.
+func (s *Server) SetPassthrough(pass func(authority string) bool) {
+	s.passthrough = pass
+}
+
+// forward passes r on to its destination and reports true if it is a
+// proxied call to a passthrough host.
+func (s *Server) forward(w http.ResponseWriter, r *http.Request) bool {
+	if s.passthrough == nil {
+		return false
+	}
+	authority := r.Host
+	if r.Method != http.MethodConnect {
+		if r.URL.Host == "" {
+			// Addressed to the mock server itself
+			return false
+		}
+		authority = r.URL.Host
+	}
+	if !s.passthrough(authority) {
+		return false
+	}
+	if r.Method == http.MethodConnect {
+		tunnel(w, r)
+	} else {
+		// The request URL is absolute, so it is sent where the service meant it to go
+		(&httputil.ReverseProxy{Rewrite: func(*httputil.ProxyRequest) {}}).ServeHTTP(w, r)
+	}
+	return true
+}
+
+// tunnel connects a CONNECT tunnel straight to its destination.
+func tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, passthroughDialTimeout)
+	if err != nil {
+		http.Error(w, "failed to reach upstream: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "connection cannot be tunneled", http.StatusInternalServerError)
+		return
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		slog.Error("failed to hijack CONNECT", "component", "mock", "error", err)
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+
+	// Closing either side ends both copies
+	go func() {
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
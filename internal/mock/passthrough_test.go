@@ -0,0 +1,76 @@
+package mock
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestMockServer_Passthrough(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "from upstream")
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	server := NewServer(nil)
+	server.SetPassthrough(func(authority string) bool { return authority == upstreamURL.Host })
+	addr, err := server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: addr})}}
+	resp, err := client.Get(upstream.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "from upstream" {
+		t.Errorf("expected the call forwarded to upstream, got %d %q", resp.StatusCode, body)
+	}
+	if calls := server.Calls(); len(calls) != 0 {
+		t.Errorf("expected forwarded calls not to be recorded, got %v", calls)
+	}
+
+	resp, err = client.Get("http://other.invalid/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected other hosts to be mocked, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockServer_PassthroughTunnel(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "over tls")
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	server := NewServer(nil)
+	server.SetPassthrough(func(authority string) bool { return authority == upstreamURL.Host })
+	addr, err := server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	transport := upstream.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: addr})
+	resp, err := (&http.Client{Transport: transport}).Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "over tls" {
+		t.Errorf("expected the tunnel relayed to upstream, got %q", body)
+	}
+}
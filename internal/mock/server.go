@@ -16,43 +16,86 @@ import (
 // Server intercepts outgoing HTTP calls during replay and returns recorded responses.
 type Server struct {
 	expectations map[string]*snapshot.OutgoingRequest
+	jsonRPC      map[string][]jsonRPCResult           // JSON-RPC call key -> recorded responses
+	soap         map[string]*snapshot.OutgoingRequest // SOAP operation key -> expectation
 	calls        []RecordedCall
 	mu           sync.Mutex
 	listener     net.Listener
 	server       *http.Server
+
+	passthrough func(authority string) bool // hosts forwarded rather than mocked; see SetPassthrough
 }
 
 // RecordedCall tracks an intercepted outgoing call for recording mode.
 type RecordedCall struct {
-	Method   string
-	URL      string
-	Headers  map[string]string
-	Body     any
-	Response *snapshot.Response
+	Method   string             `json:"method"`
+	URL      string             `json:"url"`
+	Headers  map[string]string  `json:"headers,omitempty"`
+	Body     any                `json:"body,omitempty"`
+	Response *snapshot.Response `json:"response,omitempty"` // nil if no expectation matched
 }
 
 // NewServer creates a mock server loaded with expected outgoing requests.
 func NewServer(outgoing []snapshot.OutgoingRequest) *Server {
+	s := &Server{}
+	s.Load(outgoing)
+	return s
+}
+
+// Load replaces the expected outgoing requests and forgets the calls made
+// so far, so a running server can serve one snapshot after another.
+func (s *Server) Load(outgoing []snapshot.OutgoingRequest) {
 	expectations := make(map[string]*snapshot.OutgoingRequest)
+	jsonRPC := make(map[string][]jsonRPCResult)
+	soap := make(map[string]*snapshot.OutgoingRequest)
 	for i := range outgoing {
 		key := requestKey(outgoing[i].Method, outgoing[i].URL)
 		expectations[key] = &outgoing[i]
+		indexJSONRPC(jsonRPC, &outgoing[i])
+		if op := snapshot.SOAPOperation(outgoing[i].Headers, outgoing[i].Body); op != "" {
+			soap[soapKey(outgoing[i].Method, urlPath(outgoing[i].URL), op)] = &outgoing[i]
+		}
 	}
-	return &Server{expectations: expectations}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expectations, s.jsonRPC, s.soap, s.calls = expectations, jsonRPC, soap, nil
 }
 
 // Start launches the mock server on a random port and returns the address.
 func (s *Server) Start() (string, error) {
+	return s.StartOn("127.0.0.1")
+}
+
+// StartOn is like Start but listens on the given loopback host, e.g. "::1"
+// for services that only reach IPv6 addresses.
+func (s *Server) StartOn(host string) (string, error) {
+	return s.StartAt(net.JoinHostPort(host, "0"))
+}
+
+// StartAt is like Start but listens on addr (host:port), so a service can
+// be configured with the mock server's address before it starts.
+func (s *Server) StartAt(addr string) (string, error) {
 	var err error
-	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	s.listener, err = net.Listen("tcp", addr)
 	if err != nil {
 		return "", fmt.Errorf("starting mock server: %w", err)
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleRequest)
+	// Calls to passthrough hosts are forwarded before routing, as the mux
+	// doesn't route CONNECT tunnels
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.forward(w, r) {
+			mux.ServeHTTP(w, r)
+		}
+	})
 
-	s.server = &http.Server{Handler: mux}
+	// Accept HTTP/2 without TLS as well, so gRPC clients can be served
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	s.server = &http.Server{Handler: handler, Protocols: protocols}
 	go s.server.Serve(s.listener)
 
 	return s.listener.Addr().String(), nil
@@ -86,14 +129,19 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	// Read body
 	var body any
+	var data []byte
 	if r.Body != nil {
-		data, err := io.ReadAll(r.Body)
+		var err error
+		data, err = io.ReadAll(r.Body)
 		if err != nil {
 			slog.Error("failed to read request body", "component", "mock", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(`{"error": "failed to read request body"}`))
 			return
 		}
+		if decoded, err := snapshot.DecompressBody(data, r.Header.Get(snapshot.HeaderContentEncoding)); err == nil {
+			data = decoded
+		}
 		if len(data) > 0 {
 			if err := json.Unmarshal(data, &body); err != nil {
 				body = string(data)
@@ -108,11 +156,25 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Look up expectation using multiple matching strategies:
-	// 1. Exact match on method + full URL
-	// 2. Match on method + path only (supports forward proxy-style requests with absolute URLs)
-	// 3. Match on method + path suffix (for partial path matching)
+	// 1. JSON-RPC calls by method + params, whatever their ids
+	// 2. SOAP calls by method + path + operation
+	// 3. Exact match on method + full URL
+	// 4. Match on method + path only (supports forward proxy-style requests with absolute URLs)
+	// 5. Match on method + path suffix (for partial path matching)
+	var response *snapshot.Response
+	if calls, batch, isRPC := jsonRPCCalls(body); isRPC && len(s.jsonRPC) > 0 {
+		response, _ = s.answerJSONRPC(r.URL.Path, calls, batch)
+	}
+	var exp *snapshot.OutgoingRequest
+	var ok bool
+	if len(s.soap) > 0 {
+		op := snapshot.SOAPOperation(headers, snapshot.ParseBody(data, r.Header.Get(snapshot.HeaderContentType)))
+		exp, ok = s.soap[soapKey(r.Method, r.URL.Path, op)]
+	}
 	key := requestKey(r.Method, r.URL.String())
-	exp, ok := s.expectations[key]
+	if !ok {
+		exp, ok = s.expectations[key]
+	}
 	if !ok {
 		// Try matching by method + path
 		pathKey := requestKey(r.Method, r.URL.Path)
@@ -136,21 +198,37 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 		Body:    body,
 	}
 
-	if ok && exp.Response != nil {
-		call.Response = exp.Response
+	if response == nil && ok {
+		response = exp.Response
+	}
+
+	if response != nil {
+		call.Response = response
 		s.calls = append(s.calls, call)
 
-		w.Header().Set(snapshot.HeaderContentType, snapshot.ContentTypeJSON)
-		w.WriteHeader(exp.Response.Status)
-		if exp.Response.Body != nil {
-			data, err := json.Marshal(exp.Response.Body)
-			if err != nil {
-				slog.Error("failed to marshal response body", "component", "mock", "error", err)
+		data, contentType, err := encodeResponseBody(response)
+		if err != nil {
+			slog.Error("failed to marshal response body", "component", "mock", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// Compress the body the way the recorded upstream did
+		if encoding := response.Headers[snapshot.HeaderContentEncoding]; encoding != "" && data != nil {
+			if data, err = snapshot.CompressBody(data, encoding); err != nil {
+				slog.Error("failed to compress response body", "component", "mock", "error", err)
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
+			w.Header().Set(snapshot.HeaderContentEncoding, encoding)
+		}
+		w.Header().Set(snapshot.HeaderContentType, contentType)
+		w.WriteHeader(response.Status)
+		if data != nil {
 			w.Write(data)
 		}
+		for k, v := range response.Trailers {
+			w.Header().Set(http.TrailerPrefix+k, v)
+		}
 	} else {
 		slog.Warn("unexpected outgoing request", "component", "mock", "method", r.Method, "url", r.URL.String())
 		s.calls = append(s.calls, call)
@@ -159,6 +237,72 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// encodeResponseBody renders a recorded response body. XML, msgpack, CBOR,
+// form and protobuf bodies are rebuilt from their decoded document and keep
+// the recorded Content-Type, as do binary bodies, such as gRPC messages
+// recorded without descriptors; everything else is served as JSON.
+func encodeResponseBody(resp *snapshot.Response) ([]byte, string, error) {
+	if snapshot.IsTruncatedBody(resp.Body) {
+		return nil, "", snapshot.ErrTruncatedBody
+	}
+	if resp.Body == nil {
+		return nil, snapshot.ContentTypeJSON, nil
+	}
+	if encoding := documentEncoding(resp.Body); encoding != "" {
+		data, err := snapshot.DecodeBody(resp.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		contentType := resp.Headers[snapshot.HeaderContentType]
+		if contentType == "" {
+			switch encoding {
+			case snapshot.BodyEncodingForm:
+				contentType = "application/x-www-form-urlencoded"
+			case snapshot.BodyEncodingNDJSON:
+				contentType = "application/x-ndjson"
+			default:
+				contentType = "application/" + encoding
+			}
+		}
+		data, err = snapshot.EncodeCharset(data, contentType)
+		return data, contentType, err
+	}
+	if contentType := resp.Headers[snapshot.HeaderContentType]; contentType != "" && bodyEncoding(resp.Body) == snapshot.BodyEncodingBase64 {
+		data, err := snapshot.DecodeBody(resp.Body)
+		return data, contentType, err
+	}
+	data, err := json.Marshal(resp.Body)
+	return data, snapshot.ContentTypeJSON, err
+}
+
+// documentEncoding returns the encoding of a structured body (see
+// snapshot.EncodedBody.Structured), or "" for other bodies.
+func documentEncoding(body any) string {
+	eb := snapshot.EncodedBody{Encoding: bodyEncoding(body)}
+	if !eb.Structured() {
+		return ""
+	}
+	return eb.Encoding
+}
+
+// bodyEncoding returns the encoding a stored body declares, or "" for
+// plain JSON bodies.
+func bodyEncoding(body any) string {
+	switch b := body.(type) {
+	case *snapshot.EncodedBody:
+		return b.Encoding
+	case map[string]any:
+		encoding, _ := b["encoding"].(string)
+		return encoding
+	}
+	return ""
+}
+
+// soapKey identifies a SOAP operation at an endpoint.
+func soapKey(method, path, op string) string {
+	return requestKey(method, path) + "#" + op
+}
+
 func requestKey(method, url string) string {
 	return method + ":" + url
 }
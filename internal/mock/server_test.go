@@ -1,9 +1,11 @@
 package mock
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -72,3 +74,329 @@ func TestMockServer_UnmatchedRequest(t *testing.T) {
 		t.Errorf("expected 502 for unmatched request, got %d", resp.StatusCode)
 	}
 }
+
+func TestMockServer_ReturnsXMLResponse(t *testing.T) {
+	raw := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><ok>true</ok></soap:Body></soap:Envelope>`
+	outgoing := []snapshot.OutgoingRequest{
+		{
+			Method: "POST",
+			URL:    "/soap",
+			Response: &snapshot.Response{
+				Status:  200,
+				Headers: map[string]string{snapshot.HeaderContentType: "text/xml; charset=utf-8"},
+				Body:    snapshot.ParseBody([]byte(raw), "text/xml"),
+			},
+		},
+	}
+
+	server := NewServer(outgoing)
+	addr, err := server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	resp, err := http.Post("http://"+addr+"/soap", "text/xml", strings.NewReader(`<ping/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get(snapshot.HeaderContentType); ct != "text/xml; charset=utf-8" {
+		t.Errorf("expected recorded content type, got %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != raw {
+		t.Errorf("expected %s, got %s", raw, body)
+	}
+}
+
+func TestMockServer_ReturnsMsgPackResponse(t *testing.T) {
+	raw, _ := snapshot.EncodeMsgPack(map[string]any{"id": 7, "ok": true})
+	outgoing := []snapshot.OutgoingRequest{
+		{
+			Method: "GET",
+			URL:    "/items/7",
+			Response: &snapshot.Response{
+				Status:  200,
+				Headers: map[string]string{snapshot.HeaderContentType: "application/msgpack"},
+				Body:    snapshot.ParseBody(raw, "application/msgpack"),
+			},
+		},
+	}
+
+	server := NewServer(outgoing)
+	addr, err := server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	resp, err := http.Get("http://" + addr + "/items/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get(snapshot.HeaderContentType); ct != "application/msgpack" {
+		t.Errorf("expected recorded content type, got %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, raw) {
+		t.Errorf("expected %x, got %x", raw, body)
+	}
+}
+
+func TestMockServer_CompressesLikeRecorded(t *testing.T) {
+	outgoing := []snapshot.OutgoingRequest{
+		{
+			Method: "POST",
+			URL:    "/send",
+			Response: &snapshot.Response{
+				Status:  200,
+				Headers: map[string]string{"Content-Encoding": "gzip"},
+				Body:    map[string]any{"sent": true},
+			},
+		},
+	}
+
+	server := NewServer(outgoing)
+	addr, err := server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	reqBody, _ := snapshot.CompressBody([]byte(`{"to":"test@example.com"}`), "br")
+	req, _ := http.NewRequest("POST", "http://"+addr+"/send", bytes.NewReader(reqBody))
+	req.Header.Set("Content-Encoding", "br")
+	// Ask for gzip explicitly so the client does not decompress transparently
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip response, got %q", resp.Header.Get("Content-Encoding"))
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	body, err := snapshot.DecompressBody(raw, "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"sent":true}` {
+		t.Errorf("unexpected body %s", body)
+	}
+
+	calls := server.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if got, ok := calls[0].Body.(map[string]any); !ok || got["to"] != "test@example.com" {
+		t.Errorf("expected decompressed request body, got %v", calls[0].Body)
+	}
+}
+
+func TestMockServer_JSONRPCMatchesByMethodAndParams(t *testing.T) {
+	rpc := func(id float64, method string, params any) map[string]any {
+		return map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+	}
+	result := func(id float64, result any) map[string]any {
+		return map[string]any{"jsonrpc": "2.0", "id": id, "result": result}
+	}
+	outgoing := []snapshot.OutgoingRequest{
+		{
+			Method:   "POST",
+			URL:      "http://node.example/rpc",
+			Body:     rpc(1, "getBalance", []any{"alice"}),
+			Response: &snapshot.Response{Status: 200, Body: result(1, 10.0)},
+		},
+		{
+			Method: "POST",
+			URL:    "http://node.example/rpc",
+			Body: []any{
+				rpc(2, "getBalance", []any{"bob"}),
+				rpc(3, "getBlock", map[string]any{"number": 7.0, "full": false}),
+				map[string]any{"jsonrpc": "2.0", "method": "ping"},
+			},
+			// Answered out of order
+			Response: &snapshot.Response{Status: 200, Body: []any{result(3, "0xabc"), result(2, 20.0)}},
+		},
+	}
+	server := NewServer(outgoing)
+	addr, err := server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	post := func(body string) any {
+		t.Helper()
+		resp, err := http.Post("http://"+addr+"/rpc", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		var parsed any
+		json.NewDecoder(resp.Body).Decode(&parsed)
+		return parsed
+	}
+
+	// The service picks new ids and reorders the batch and the params
+	got := post(`[{"jsonrpc":"2.0","id":"b","method":"getBlock","params":{"full":false,"number":7}},` +
+		`{"jsonrpc":"2.0","id":"a","method":"getBalance","params":["bob"]}]`)
+	want := []any{
+		map[string]any{"jsonrpc": "2.0", "id": "b", "result": "0xabc"},
+		map[string]any{"jsonrpc": "2.0", "id": "a", "result": 20.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("batch: got %v, want %v", got, want)
+	}
+
+	got = post(`{"jsonrpc":"2.0","id":99,"method":"getBalance","params":["alice"]}`)
+	if want := map[string]any{"jsonrpc": "2.0", "id": 99.0, "result": 10.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("single call: got %v, want %v", got, want)
+	}
+
+	// Unknown calls fall back to matching by URL
+	if got := post(`{"jsonrpc":"2.0","id":5,"method":"getBalance","params":["carol"]}`); got == nil {
+		t.Error("expected the URL expectation to answer an unknown call")
+	}
+}
+
+func TestMockServer_SOAPMatchesByOperation(t *testing.T) {
+	envelope := func(op string) any {
+		return snapshot.ParseBody([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><`+op+`/></s:Body></s:Envelope>`), "text/xml")
+	}
+	outgoing := []snapshot.OutgoingRequest{
+		{
+			Method:   "POST",
+			URL:      "http://stock.example/ws",
+			Headers:  map[string]string{"Content-Type": "text/xml"},
+			Body:     envelope("GetPrice"),
+			Response: &snapshot.Response{Status: 200, Body: map[string]any{"price": 10.0}},
+		},
+		{
+			Method:   "POST",
+			URL:      "http://stock.example/ws",
+			Headers:  map[string]string{"SOAPAction": "urn:stock#SetPrice"},
+			Body:     envelope("SetPrice"),
+			Response: &snapshot.Response{Status: 500, Body: map[string]any{"fault": "read only"}},
+		},
+	}
+	server := NewServer(outgoing)
+	addr, err := server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	// Identified by the body element
+	resp, err := http.Post("http://"+addr+"/ws", "text/xml", strings.NewReader(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><GetPrice>ACME</GetPrice></soap:Body></soap:Envelope>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected GetPrice to be answered with 200, got %d", resp.StatusCode)
+	}
+
+	// Identified by the SOAPAction header
+	req, _ := http.NewRequest("POST", "http://"+addr+"/ws", strings.NewReader(`<Envelope/>`))
+	req.Header.Set("SOAPAction", `"urn:stock#SetPrice"`)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected SetPrice to be answered with 500, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockServer_ServesGRPCOverH2C(t *testing.T) {
+	frame := []byte{0, 0, 0, 0, 2, 0x08, 0x01}
+	outgoing := []snapshot.OutgoingRequest{
+		{
+			Method: "POST",
+			URL:    "/pkg.Pricing/Quote",
+			Response: &snapshot.Response{
+				Status:   200,
+				Headers:  map[string]string{"Content-Type": "application/grpc"},
+				Body:     snapshot.ParseBody(frame, "application/grpc"),
+				Trailers: map[string]string{"Grpc-Status": "0"},
+			},
+		},
+	}
+
+	server := NewServer(outgoing)
+	addr, err := server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	req, _ := http.NewRequest("POST", "http://"+addr+"/pkg.Pricing/Quote", bytes.NewReader([]byte{0, 0, 0, 0, 2, 0x08, 0x2a}))
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, got %s", resp.Proto)
+	}
+	if !bytes.Equal(body, frame) {
+		t.Errorf("expected the recorded gRPC frame, got %v", body)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/grpc" {
+		t.Errorf("expected Content-Type application/grpc, got %q", got)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("expected Grpc-Status trailer 0, got %q", got)
+	}
+}
+
+func TestMockServer_Load(t *testing.T) {
+	server := NewServer([]snapshot.OutgoingRequest{
+		{Method: "GET", URL: "/a", Response: &snapshot.Response{Status: 200}},
+	})
+	addr, err := server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	get := func(path string) int {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get("/a"); status != 200 {
+		t.Fatalf("expected 200 for /a, got %d", status)
+	}
+	server.Load([]snapshot.OutgoingRequest{
+		{Method: "GET", URL: "/b", Response: &snapshot.Response{Status: 201}},
+	})
+	if calls := server.Calls(); len(calls) != 0 {
+		t.Errorf("expected Load to forget earlier calls, got %d", len(calls))
+	}
+	if status := get("/a"); status != http.StatusBadGateway {
+		t.Errorf("expected the old expectation to be gone, got %d", status)
+	}
+	if status := get("/b"); status != 201 {
+		t.Errorf("expected 201 for /b, got %d", status)
+	}
+}
@@ -0,0 +1,340 @@
+// Package protobuf stores protobuf and gRPC bodies as JSON, using message
+// descriptors from protobuf.descriptor_set or protobuf.proto_dir, and encodes
+// them again for replay and mocks.
+package protobuf
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// grpcFrameHeaderLen is the size of the header before each gRPC message:
+// a compressed flag and a big-endian message length.
+const grpcFrameHeaderLen = 5
+
+// Codec converts protobuf bodies between their wire form and JSON.
+// A nil Codec leaves bodies untouched.
+type Codec struct {
+	files    *protoregistry.Files
+	types    *dynamicpb.Types
+	messages []config.ProtobufMessage
+}
+
+// New loads the configured descriptors and registers the codec with the
+// snapshot package, so DecodeBody can encode protobuf bodies again. It
+// returns nil if no descriptors are configured.
+func New(cfg config.ProtobufConfig) (*Codec, error) {
+	var files *protoregistry.Files
+	var err error
+	switch {
+	case cfg.DescriptorSet != "":
+		files, err = loadDescriptorSet(cfg.DescriptorSet)
+	case cfg.ProtoDir != "":
+		files, err = compileProtoDir(cfg.ProtoDir)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Codec{files: files, types: dynamicpb.NewTypes(files), messages: cfg.Messages}
+	for i, m := range cfg.Messages {
+		for _, name := range []string{m.Request, m.Response} {
+			if name == "" {
+				continue
+			}
+			if _, err := c.messageType(name); err != nil {
+				return nil, fmt.Errorf("protobuf.messages[%d]: %w", i, err)
+			}
+		}
+	}
+	snapshot.RegisterBodyEncoder(snapshot.BodyEncodingProtobuf, c.encodeMessage)
+	snapshot.RegisterBodyEncoder(snapshot.BodyEncodingGRPC, c.encodeGRPC)
+	return c, nil
+}
+
+func loadDescriptorSet(file string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading descriptor set: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing descriptor set %s: %w", file, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("loading descriptor set %s (was it written with --include_imports?): %w", file, err)
+	}
+	return files, nil
+}
+
+// compileProtoDir compiles every .proto file under dir, resolving imports
+// relative to dir and from the well-known types.
+func compileProtoDir(dir string) (*protoregistry.Files, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(p, ".proto") {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading proto directory: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no .proto files in %s", dir)
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{dir}}),
+	}
+	compiled, err := compiler.Compile(context.Background(), names...)
+	if err != nil {
+		return nil, fmt.Errorf("compiling %s: %w", dir, err)
+	}
+	files := new(protoregistry.Files)
+	for _, f := range compiled {
+		if err := registerFile(files, f); err != nil {
+			return nil, fmt.Errorf("loading %s: %w", f.Path(), err)
+		}
+	}
+	return files, nil
+}
+
+// registerFile registers fd after the files it imports.
+func registerFile(files *protoregistry.Files, fd protoreflect.FileDescriptor) error {
+	if _, err := files.FindFileByPath(fd.Path()); err == nil {
+		return nil
+	}
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		if err := registerFile(files, imports.Get(i).FileDescriptor); err != nil {
+			return err
+		}
+	}
+	return files.RegisterFile(fd)
+}
+
+// DecodeRequestBody returns the JSON form of a binary request body whose
+// message type is configured for the endpoint or, for gRPC, given by the
+// method. Other bodies are returned unchanged.
+func (c *Codec) DecodeRequestBody(method, rawURL, contentType string, body any) any {
+	if c == nil {
+		return body
+	}
+	return c.decode(body, contentType, c.bodyType(method, rawURL, contentType, true))
+}
+
+// DecodeResponseBody is DecodeRequestBody for the response to a request.
+func (c *Codec) DecodeResponseBody(method, rawURL, contentType string, body any) any {
+	if c == nil {
+		return body
+	}
+	return c.decode(body, contentType, c.bodyType(method, rawURL, contentType, false))
+}
+
+// bodyType returns the message type of a request or response body, or "".
+func (c *Codec) bodyType(method, rawURL, contentType string, request bool) string {
+	urlPath := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		urlPath = u.Path
+	}
+	for _, m := range c.messages {
+		if m.Method != "" && !strings.EqualFold(m.Method, method) {
+			continue
+		}
+		if !snapshot.MatchPath(m.Path, urlPath) {
+			continue
+		}
+		if request {
+			return m.Request
+		}
+		return m.Response
+	}
+
+	if !isGRPC(contentType) {
+		return ""
+	}
+	// gRPC paths are /<package>.<Service>/<Method>
+	service, name, ok := strings.Cut(strings.TrimPrefix(urlPath, "/"), "/")
+	if !ok {
+		return ""
+	}
+	d, err := c.files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return ""
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return ""
+	}
+	md := sd.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return ""
+	}
+	if request {
+		return string(md.Input().FullName())
+	}
+	return string(md.Output().FullName())
+}
+
+// decode converts a base64-encoded body of the given message type. Bodies
+// that can't be decoded, or that JSON can't hold exactly (unknown fields,
+// compressed gRPC messages), stay base64-encoded.
+func (c *Codec) decode(body any, contentType, typeName string) any {
+	eb, ok := body.(*snapshot.EncodedBody)
+	if typeName == "" || !ok || eb.Encoding != snapshot.BodyEncodingBase64 {
+		return body
+	}
+	s, _ := eb.Data.(string)
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return body
+	}
+	md, err := c.messageType(typeName)
+	if err != nil {
+		return body
+	}
+
+	if !isGRPC(contentType) {
+		v, err := c.toJSON(raw, md)
+		if err != nil {
+			return body
+		}
+		return &snapshot.EncodedBody{Data: v, Encoding: snapshot.BodyEncodingProtobuf, Type: typeName}
+	}
+
+	var messages []any
+	for len(raw) > 0 {
+		if len(raw) < grpcFrameHeaderLen || raw[0] != 0 {
+			return body
+		}
+		n := binary.BigEndian.Uint32(raw[1:grpcFrameHeaderLen])
+		if uint64(len(raw)-grpcFrameHeaderLen) < uint64(n) {
+			return body
+		}
+		v, err := c.toJSON(raw[grpcFrameHeaderLen:grpcFrameHeaderLen+int(n)], md)
+		if err != nil {
+			return body
+		}
+		messages = append(messages, v)
+		raw = raw[grpcFrameHeaderLen+int(n):]
+	}
+	return &snapshot.EncodedBody{Data: messages, Encoding: snapshot.BodyEncodingGRPC, Type: typeName}
+}
+
+func (c *Codec) toJSON(raw []byte, md protoreflect.MessageDescriptor) (any, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := (proto.UnmarshalOptions{Resolver: c.types}).Unmarshal(raw, msg); err != nil {
+		return nil, err
+	}
+	js, err := protojson.MarshalOptions{UseProtoNames: true, Resolver: c.types}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown fields have no JSON form; check nothing is lost on the way back
+	back := dynamicpb.NewMessage(md)
+	if err := (protojson.UnmarshalOptions{Resolver: c.types}).Unmarshal(js, back); err != nil {
+		return nil, err
+	}
+	if !proto.Equal(msg, back) {
+		return nil, fmt.Errorf("%s message has fields missing from its descriptor", md.FullName())
+	}
+	var v any
+	if err := json.Unmarshal(js, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *Codec) fromJSON(v any, md protoreflect.MessageDescriptor) ([]byte, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := (protojson.UnmarshalOptions{Resolver: c.types}).Unmarshal(js, msg); err != nil {
+		return nil, fmt.Errorf("encoding %s body: %w", md.FullName(), err)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+func (c *Codec) encodeMessage(eb *snapshot.EncodedBody) ([]byte, error) {
+	md, err := c.messageType(eb.Type)
+	if err != nil {
+		return nil, err
+	}
+	return c.fromJSON(eb.Data, md)
+}
+
+func (c *Codec) encodeGRPC(eb *snapshot.EncodedBody) ([]byte, error) {
+	md, err := c.messageType(eb.Type)
+	if err != nil {
+		return nil, err
+	}
+	messages, ok := eb.Data.([]any)
+	if !ok {
+		return nil, fmt.Errorf("grpc body of type %s must be a list of messages", eb.Type)
+	}
+	var buf bytes.Buffer
+	for _, m := range messages {
+		data, err := c.fromJSON(m, md)
+		if err != nil {
+			return nil, err
+		}
+		var header [grpcFrameHeaderLen]byte
+		binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+		buf.Write(header[:])
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Codec) messageType(name string) (protoreflect.MessageDescriptor, error) {
+	d, err := c.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown message type %s", name)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", name)
+	}
+	return md, nil
+}
+
+// isGRPC reports whether a content type carries length-prefixed gRPC
+// messages (application/grpc, application/grpc-web and their +proto forms).
+func isGRPC(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return strings.HasPrefix(ct, "application/grpc") && !strings.HasPrefix(ct, "application/grpc-web-text")
+}
@@ -0,0 +1,208 @@
+package protobuf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+const usersProto = `syntax = "proto3";
+package acme.users.v1;
+
+import "google/protobuf/timestamp.proto";
+
+message GetUserRequest {
+  int64 id = 1;
+}
+
+message User {
+  int64 id = 1;
+  string name = 2;
+  repeated string roles = 3;
+  google.protobuf.Timestamp created_at = 4;
+}
+
+service Users {
+  rpc GetUser(GetUserRequest) returns (User);
+}
+`
+
+func newTestCodec(t *testing.T, messages ...config.ProtobufMessage) *Codec {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "acme"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "acme", "users.proto"), []byte(usersProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(config.ProtobufConfig{ProtoDir: dir, Messages: messages})
+	if err != nil {
+		t.Fatalf("loading protos: %v", err)
+	}
+	return c
+}
+
+// encode builds the wire form of a message from its JSON form.
+func encode(t *testing.T, c *Codec, typeName, js string) []byte {
+	t.Helper()
+	md, err := c.messageType(typeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := (protojson.UnmarshalOptions{Resolver: c.types}).Unmarshal([]byte(js), msg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNew_Unconfigured(t *testing.T) {
+	c, err := New(config.ProtobufConfig{})
+	if err != nil || c != nil {
+		t.Fatalf("expected no codec, got %v (%v)", c, err)
+	}
+	// A nil codec leaves bodies alone
+	body := &snapshot.EncodedBody{Data: "CAE=", Encoding: snapshot.BodyEncodingBase64}
+	if got := c.DecodeResponseBody("GET", "/users/1", "application/protobuf", body); got != body {
+		t.Errorf("expected body unchanged, got %v", got)
+	}
+}
+
+func TestNew_UnknownMessageType(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "users.proto"), []byte(usersProto), 0o644)
+	_, err := New(config.ProtobufConfig{
+		ProtoDir: dir,
+		Messages: []config.ProtobufMessage{{Path: "/users/*", Response: "acme.users.v1.Missing"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "acme.users.v1.Missing") {
+		t.Errorf("expected unknown message type error, got %v", err)
+	}
+}
+
+func TestDecodeResponseBody_MappedEndpoint(t *testing.T) {
+	c := newTestCodec(t, config.ProtobufMessage{Method: "GET", Path: "/v1/users/*", Response: "acme.users.v1.User"})
+	raw := encode(t, c, "acme.users.v1.User", `{"id": "7", "name": "Alice", "roles": ["admin"], "createdAt": "2024-01-02T03:04:05Z"}`)
+	body := snapshot.ParseBody(raw, "application/x-protobuf")
+
+	decoded := c.DecodeResponseBody("GET", "/v1/users/7?expand=roles", "application/x-protobuf", body)
+	eb, ok := decoded.(*snapshot.EncodedBody)
+	if !ok || eb.Encoding != snapshot.BodyEncodingProtobuf || eb.Type != "acme.users.v1.User" {
+		t.Fatalf("expected a protobuf body, got %#v", decoded)
+	}
+	want := map[string]any{"id": "7", "name": "Alice", "roles": []any{"admin"}, "created_at": "2024-01-02T03:04:05Z"}
+	if !reflect.DeepEqual(eb.Data, want) {
+		t.Errorf("got %v, want %v", eb.Data, want)
+	}
+
+	// Unmapped endpoints and methods stay base64-encoded
+	if got := c.DecodeResponseBody("POST", "/v1/users/7", "application/x-protobuf", body); got != body {
+		t.Errorf("expected unmapped method to be left alone, got %v", got)
+	}
+	if got := c.DecodeRequestBody("GET", "/v1/users/7", "application/x-protobuf", body); got != body {
+		t.Errorf("expected request without a mapped type to be left alone, got %v", got)
+	}
+
+	encoded, err := snapshot.DecodeBody(eb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Errorf("re-encoded %x, want %x", encoded, raw)
+	}
+}
+
+func TestDecodeRequestBody_GRPC(t *testing.T) {
+	c := newTestCodec(t)
+	msg := encode(t, c, "acme.users.v1.GetUserRequest", `{"id": "42"}`)
+	raw := append([]byte{0, 0, 0, 0, byte(len(msg))}, msg...)
+	body := snapshot.ParseBody(raw, "application/grpc")
+
+	decoded := c.DecodeRequestBody("POST", "/acme.users.v1.Users/GetUser", "application/grpc", body)
+	eb, ok := decoded.(*snapshot.EncodedBody)
+	if !ok || eb.Encoding != snapshot.BodyEncodingGRPC || eb.Type != "acme.users.v1.GetUserRequest" {
+		t.Fatalf("expected a grpc body, got %#v", decoded)
+	}
+	if !reflect.DeepEqual(eb.Data, []any{map[string]any{"id": "42"}}) {
+		t.Errorf("unexpected messages %v", eb.Data)
+	}
+
+	// Bodies loaded from JSON snapshots are maps; they encode the same way
+	loaded := map[string]any{"data": eb.Data, "encoding": eb.Encoding, "type": eb.Type}
+	encoded, err := snapshot.DecodeBody(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Errorf("re-encoded %x, want %x", encoded, raw)
+	}
+
+	// Compressed messages can't be decoded and stay base64-encoded
+	compressed := snapshot.ParseBody(append([]byte{1}, raw[1:]...), "application/grpc")
+	if got := c.DecodeRequestBody("POST", "/acme.users.v1.Users/GetUser", "application/grpc", compressed); got != compressed {
+		t.Errorf("expected compressed message to be left alone, got %v", got)
+	}
+}
+
+func TestDecodeResponseBody_UnknownFieldsStayBinary(t *testing.T) {
+	c := newTestCodec(t, config.ProtobufMessage{Path: "/v1/users/*", Response: "acme.users.v1.User"})
+	// Field 9 is not in the descriptor, so JSON would drop it
+	raw := append(encode(t, c, "acme.users.v1.User", `{"id": "1"}`), 0x48, 0x01)
+	body := &snapshot.EncodedBody{Data: base64.StdEncoding.EncodeToString(raw), Encoding: snapshot.BodyEncodingBase64}
+	if got := c.DecodeResponseBody("GET", "/v1/users/1", "application/protobuf", body); got != body {
+		t.Errorf("expected body with unknown fields to stay base64-encoded, got %v", got)
+	}
+}
+
+func TestNew_DescriptorSet(t *testing.T) {
+	c := newTestCodec(t)
+	fd, err := c.files.FindFileByPath("acme/users.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := c.files.FindFileByPath("google/protobuf/timestamp.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(ts),
+		protodesc.ToFileDescriptorProto(fd),
+	}}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "users.binpb")
+	os.WriteFile(path, data, 0o644)
+
+	loaded, err := New(config.ProtobufConfig{
+		DescriptorSet: path,
+		Messages:      []config.ProtobufMessage{{Path: "/v1/users/*", Response: "acme.users.v1.User"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := encode(t, loaded, "acme.users.v1.User", `{"name": "Bob"}`)
+	decoded := loaded.DecodeResponseBody("GET", "/v1/users/2", "application/protobuf", snapshot.ParseBody(raw, "application/protobuf"))
+	if eb, ok := decoded.(*snapshot.EncodedBody); !ok || !reflect.DeepEqual(eb.Data, map[string]any{"name": "Bob"}) {
+		t.Errorf("unexpected body %#v", decoded)
+	}
+}
@@ -0,0 +1,94 @@
+package recorder
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/auth"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// AdminPathPrefix is the URL prefix reserved for the recorder admin API.
+// Requests under this prefix are never proxied to the service.
+const AdminPathPrefix = "/__snapshot-tester/"
+
+// adminStatus is the payload returned by GET /__snapshot-tester/status.
+type adminStatus struct {
+	Service     string   `json:"service"`
+	Target      string   `json:"target"`
+	SnapshotDir string   `json:"snapshot_dir"`
+	Tags        []string `json:"tags"`
+	Scenario    string   `json:"scenario,omitempty"`
+	Recorded    int      `json:"recorded"`
+}
+
+// adminTagsRequest is the payload accepted by PUT /__snapshot-tester/tags.
+type adminTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// adminHandler builds the admin API. Read-only endpoints require the read role,
+// endpoints that change recorder state require the admin role.
+func (r *Recorder) adminHandler(authn *auth.Authenticator) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(AdminPathPrefix+"status", authn.Require(auth.RoleRead, http.HandlerFunc(r.handleAdminStatus)))
+	mux.Handle(AdminPathPrefix+"tags", authn.Require(auth.RoleAdmin, http.HandlerFunc(r.handleAdminTags)))
+	mux.Handle(AdminPathPrefix+"scenario", authn.Require(auth.RoleAdmin, http.HandlerFunc(r.handleAdminScenario)))
+	return mux
+}
+
+// withAdmin routes admin API requests to admin and everything else to next.
+// The admin API is only exposed when auth tokens are configured.
+func (r *Recorder) withAdmin(authn *auth.Authenticator, next http.Handler) http.Handler {
+	if !authn.Enabled() {
+		return next
+	}
+	admin := r.adminHandler(authn)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, AdminPathPrefix) {
+			admin.ServeHTTP(w, req)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (r *Recorder) handleAdminStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.mu.Lock()
+	status := adminStatus{
+		Service:     r.config.Service.Name,
+		Target:      r.config.Service.BaseURL,
+		SnapshotDir: r.config.Recording.SnapshotDir,
+		Tags:        append([]string{}, r.tags...),
+		Scenario:    r.scenario,
+		Recorded:    r.recorded,
+	}
+	r.mu.Unlock()
+	writeAdminJSON(w, status)
+}
+
+func (r *Recorder) handleAdminTags(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body adminTagsRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.tags = body.Tags
+	r.mu.Unlock()
+	writeAdminJSON(w, body)
+}
+
+func writeAdminJSON(w http.ResponseWriter, v any) {
+	w.Header().Set(snapshot.HeaderContentType, snapshot.ContentTypeJSON)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,95 @@
+package recorder
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/auth"
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+func newAdminTestRecorder() (*Recorder, *auth.Authenticator) {
+	cfg := &config.Config{
+		Service:   config.ServiceConfig{Name: "svc", BaseURL: "http://localhost:3000"},
+		Recording: config.RecordingConfig{SnapshotDir: "./snapshots"},
+		Auth: config.AuthConfig{Tokens: []config.AuthToken{
+			{Token: "reader", Role: "read"},
+			{Token: "admin", Role: "admin"},
+		}},
+	}
+	return &Recorder{config: cfg, tags: []string{"initial"}}, auth.New(cfg.Auth)
+}
+
+func TestWithAdmin_StatusRequiresRead(t *testing.T) {
+	r, authn := newAdminTestRecorder()
+	proxied := false
+	handler := r.withAdmin(authn, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied = true
+	}))
+
+	req := httptest.NewRequest("GET", AdminPathPrefix+"status", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", AdminPathPrefix+"status", nil)
+	req.Header.Set("Authorization", "Bearer reader")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var status adminStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Service != "svc" || len(status.Tags) != 1 || status.Tags[0] != "initial" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if proxied {
+		t.Error("admin requests must not be proxied to the service")
+	}
+}
+
+func TestWithAdmin_TagsRequiresAdmin(t *testing.T) {
+	r, authn := newAdminTestRecorder()
+	handler := r.withAdmin(authn, http.NotFoundHandler())
+
+	req := httptest.NewRequest("PUT", AdminPathPrefix+"tags", strings.NewReader(`{"tags":["smoke"]}`))
+	req.Header.Set("Authorization", "Bearer reader")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for read-only token, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("PUT", AdminPathPrefix+"tags", strings.NewReader(`{"tags":["smoke"]}`))
+	req.Header.Set("Authorization", "Bearer admin")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if len(r.tags) != 1 || r.tags[0] != "smoke" {
+		t.Errorf("expected tags to be updated, got %v", r.tags)
+	}
+}
+
+func TestWithAdmin_DisabledWithoutTokens(t *testing.T) {
+	r := &Recorder{config: &config.Config{}}
+	proxied := false
+	handler := r.withAdmin(auth.New(config.AuthConfig{}), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied = true
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", AdminPathPrefix+"status", nil))
+	if !proxied {
+		t.Error("expected admin prefix to be proxied when auth is not configured")
+	}
+}
@@ -0,0 +1,62 @@
+package recorder
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// What to do with requests whose request or response body is larger than
+// recording.max_body_bytes (must match config recording.oversized_bodies
+// values).
+const (
+	OversizedTruncate = "truncate" // store a truncation marker in place of the body
+	OversizedSkip     = "skip"     // proxy the request without a snapshot
+)
+
+// readRequestBody buffers a request body for the snapshot and replaces it
+// with one the proxy can read. With a max_body_bytes limit, only the first
+// bytes of a larger body are buffered: the rest streams to the service and
+// through the returned digest, which is nil when there is no limit.
+func (r *Recorder) readRequestBody(req *http.Request) ([]byte, *snapshot.BodyDigest, error) {
+	if req.Body == nil {
+		return nil, nil, nil
+	}
+	limit := r.config.Recording.MaxBodyBytes
+	if limit <= 0 {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return body, nil, nil
+	}
+
+	head, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	digest := snapshot.NewBodyDigest(limit)
+	digest.Write(head)
+	if !digest.Truncated() {
+		req.Body = io.NopCloser(bytes.NewReader(head))
+		return head, digest, nil
+	}
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(head), io.TeeReader(req.Body, digest)))
+	return digest.Bytes(), digest, nil
+}
+
+// skipOversized reports whether a request with the given body digest must
+// not be recorded.
+func (r *Recorder) skipOversized(digest *snapshot.BodyDigest) bool {
+	return digest != nil && digest.Truncated() && r.config.Recording.OversizedBodies == OversizedSkip
+}
+
+// truncatedBody returns the marker stored for an oversized body. Its first
+// bytes are left out when redact_fields are configured, since a field cut
+// in two can't be found to redact.
+func (r *Recorder) truncatedBody(digest *snapshot.BodyDigest) *snapshot.EncodedBody {
+	return digest.Body(len(r.config.Recording.RedactFields) == 0)
+}
@@ -0,0 +1,86 @@
+package recorder
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// DefaultCorrelationHeader carries the ID the recorder gives each recorded
+// request when recording.correlation_header is not set. A service that
+// copies it onto the outgoing calls it makes lets the outgoing proxy assign
+// those calls to the right snapshot when requests overlap.
+const DefaultCorrelationHeader = "X-Snapshot-Request-Id"
+
+// headerTraceparent is the W3C Trace Context header. When it is the
+// correlation header, calls are matched by trace ID, which tracing libraries
+// propagate without changes to the service.
+const headerTraceparent = "Traceparent"
+
+// correlate marks req with a correlation key not used by any request in
+// flight and registers the key with the outgoing proxy. It returns the key
+// and the header's original values, which restoreHeader puts back once the
+// request was proxied, so the snapshot records the request as sent.
+func (r *Recorder) correlate(req *http.Request) (key string, original []string) {
+	name := r.correlationHeader
+	original = req.Header.Values(name)
+	if isTraceparent(name) {
+		// Keep the caller's trace unless another request in flight shares it
+		if key = correlationKey(name, req.Header.Get(name)); key != "" && r.outgoingProxy.Begin(key) {
+			return key, original
+		}
+		for {
+			traceID, parentID := randomHex(16), randomHex(8)
+			if r.outgoingProxy.Begin(traceID) {
+				req.Header.Set(name, "00-"+traceID+"-"+parentID+"-01")
+				return traceID, original
+			}
+		}
+	}
+	for {
+		key = randomHex(16)
+		if r.outgoingProxy.Begin(key) {
+			req.Header.Set(name, key)
+			return key, original
+		}
+	}
+}
+
+// restoreHeader sets header name back to its values before correlate.
+func restoreHeader(h http.Header, name string, values []string) {
+	if len(values) == 0 {
+		h.Del(name)
+		return
+	}
+	h[http.CanonicalHeaderKey(name)] = values
+}
+
+// correlationKey extracts the correlation key from a value of the
+// correlation header: the trace ID of a traceparent, else the value itself.
+// It returns "" if there is none.
+func correlationKey(name, value string) string {
+	value = strings.TrimSpace(value)
+	if !isTraceparent(name) {
+		return value
+	}
+	// version-traceid-parentid-flags
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	return strings.ToLower(parts[1])
+}
+
+func isTraceparent(name string) bool {
+	return strings.EqualFold(name, headerTraceparent)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
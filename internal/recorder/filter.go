@@ -0,0 +1,167 @@
+package recorder
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Control headers let a caller opt a request in or out of recording, tag
+// its snapshot and add it to a scenario. The recorder removes them before
+// proxying.
+const (
+	HeaderRecord   = "X-Snapshot-Record"   // on: record despite filters and sampling; off: don't record
+	HeaderTags     = "X-Snapshot-Tags"     // comma-separated tags added to the snapshot
+	HeaderScenario = "X-Snapshot-Scenario" // scenario the snapshot is added to as the next step
+)
+
+// control holds the control headers of a request.
+type control struct {
+	force bool // X-Snapshot-Record: on
+	skip  bool // X-Snapshot-Record: off
+	tags  []string
+
+	scenario string
+}
+
+// takeControlHeaders reads the control headers of a request and removes
+// them, so neither the service nor the snapshot sees them.
+func takeControlHeaders(req *http.Request) control {
+	var c control
+	switch v := strings.ToLower(strings.TrimSpace(req.Header.Get(HeaderRecord))); v {
+	case "":
+	case "on", "true", "1":
+		c.force = true
+	case "off", "false", "0":
+		c.skip = true
+	default:
+		slog.Warn("ignoring invalid "+HeaderRecord+" header", "value", v)
+	}
+	for _, tag := range strings.Split(req.Header.Get(HeaderTags), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			c.tags = append(c.tags, tag)
+		}
+	}
+	c.scenario = strings.TrimSpace(req.Header.Get(HeaderScenario))
+	if err := snapshot.ValidateScenarioName(c.scenario); c.scenario != "" && err != nil {
+		slog.Warn("ignoring invalid "+HeaderScenario+" header", "error", err)
+		c.scenario = ""
+	}
+	req.Header.Del(HeaderRecord)
+	req.Header.Del(HeaderTags)
+	req.Header.Del(HeaderScenario)
+	return c
+}
+
+// shouldRecord reports whether a request passes the recording.include_* and
+// exclude_* filters. Other requests are proxied without a snapshot.
+func (r *Recorder) shouldRecord(req *http.Request) bool {
+	rec := r.config.Recording
+	if len(rec.IncludeMethods) > 0 && !containsFold(rec.IncludeMethods, req.Method) {
+		return false
+	}
+	if containsFold(rec.ExcludeMethods, req.Method) {
+		return false
+	}
+	if len(rec.IncludePaths) > 0 && !matchAnyPath(rec.IncludePaths, req.URL.Path) {
+		return false
+	}
+	return !matchAnyPath(rec.ExcludePaths, req.URL.Path)
+}
+
+// statusRecorded reports whether a response status passes
+// recording.record_status. Snapshots of other responses are not saved.
+func (r *Recorder) statusRecorded(status int) bool {
+	patterns := r.config.Recording.RecordStatus
+	if len(patterns) == 0 {
+		return true
+	}
+	code := strconv.Itoa(status)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if p == code || strings.HasSuffix(p, "xx") && p[0] == code[0] && len(code) == 3 {
+			return true
+		}
+	}
+	return false
+}
+
+// sampled decides whether to record a request that passed the filters,
+// using the rate of the first matching recording.sample_rates rule or else
+// recording.sample_rate.
+func (r *Recorder) sampled(req *http.Request) bool {
+	rate := 1.0
+	if r.config.Recording.SampleRate != nil {
+		rate = *r.config.Recording.SampleRate
+	}
+	for _, rule := range r.config.Recording.SampleRates {
+		if (rule.Method == "" || strings.EqualFold(rule.Method, req.Method)) && snapshot.MatchPath(rule.Path, req.URL.Path) {
+			rate = *rule.Rate
+			break
+		}
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// withRuleTags returns tags extended with those of the recording.tag_rules
+// matching a request. tags itself is not modified.
+func (r *Recorder) withRuleTags(req *http.Request, tags []string) []string {
+	out := tags
+	for i := range r.config.Recording.TagRules {
+		rule := &r.config.Recording.TagRules[i]
+		if tagRuleMatches(rule, req) {
+			out = addTags(out, rule.Tags)
+		}
+	}
+	return out
+}
+
+// addTags returns tags extended with the extra tags it doesn't have yet.
+// tags itself is not modified.
+func addTags(tags, extra []string) []string {
+	out := tags
+	for _, tag := range extra {
+		if !containsFold(out, tag) {
+			out = append(out[:len(out):len(out)], tag)
+		}
+	}
+	return out
+}
+
+func tagRuleMatches(rule *config.TagRule, req *http.Request) bool {
+	if rule.Method != "" && !strings.EqualFold(rule.Method, req.Method) {
+		return false
+	}
+	if rule.Path != "" && !snapshot.MatchPath(rule.Path, req.URL.Path) {
+		return false
+	}
+	for name := range rule.Headers {
+		if !rule.MatchesHeader(name, req.Header.Get(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyPath(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if snapshot.MatchPath(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
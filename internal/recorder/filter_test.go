@@ -0,0 +1,139 @@
+package recorder
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+func TestShouldRecord(t *testing.T) {
+	r := &Recorder{config: &config.Config{Recording: config.RecordingConfig{
+		IncludePaths:   []string{"/api/**"},
+		ExcludePaths:   []string{"/api/health"},
+		ExcludeMethods: []string{"options"},
+	}}}
+	tests := []struct {
+		method, target string
+		want           bool
+	}{
+		{"GET", "/api/users?page=2", true},
+		{"POST", "/api/users", true},
+		{"GET", "/api/health", false},
+		{"OPTIONS", "/api/users", false},
+		{"GET", "/metrics", false},
+	}
+	for _, tt := range tests {
+		if got := r.shouldRecord(httptest.NewRequest(tt.method, tt.target, nil)); got != tt.want {
+			t.Errorf("%s %s: shouldRecord = %v, want %v", tt.method, tt.target, got, tt.want)
+		}
+	}
+
+	r.config.Recording = config.RecordingConfig{IncludeMethods: []string{"POST", "PUT"}}
+	if r.shouldRecord(httptest.NewRequest("GET", "/users", nil)) || !r.shouldRecord(httptest.NewRequest("PUT", "/users/1", nil)) {
+		t.Error("expected only included methods to be recorded")
+	}
+}
+
+func TestSampled(t *testing.T) {
+	rate := func(r float64) *float64 { return &r }
+	r := &Recorder{config: &config.Config{Recording: config.RecordingConfig{
+		SampleRate: rate(0),
+		SampleRates: []config.SampleRule{
+			{Method: "POST", Path: "/orders", Rate: rate(1)},
+			{Path: "/search/**", Rate: rate(0.5)},
+		},
+	}}}
+
+	if r.sampled(httptest.NewRequest("GET", "/users", nil)) {
+		t.Error("expected the global rate of 0 to skip the request")
+	}
+	if !r.sampled(httptest.NewRequest("POST", "/orders", nil)) {
+		t.Error("expected the endpoint rate of 1 to record the request")
+	}
+	if r.sampled(httptest.NewRequest("GET", "/orders", nil)) {
+		t.Error("expected the rule for POST not to apply to GET")
+	}
+
+	recorded := 0
+	for i := 0; i < 2000; i++ {
+		if r.sampled(httptest.NewRequest("GET", "/search/users?q=a", nil)) {
+			recorded++
+		}
+	}
+	if recorded < 800 || recorded > 1200 {
+		t.Errorf("expected about half of 2000 requests to be sampled, got %d", recorded)
+	}
+
+	// Without a rate every request is recorded
+	r.config.Recording = config.RecordingConfig{}
+	if !r.sampled(httptest.NewRequest("GET", "/users", nil)) {
+		t.Error("expected requests to be recorded by default")
+	}
+}
+
+func TestWithRuleTags(t *testing.T) {
+	r := &Recorder{config: &config.Config{Recording: config.RecordingConfig{TagRules: []config.TagRule{
+		{Path: "/api/admin/**", Tags: []string{"admin"}},
+		{Method: "POST", Tags: []string{"mutations"}},
+		{Headers: map[string]string{"User-Agent": "MyApp/*"}, Tags: []string{"mobile", "smoke"}},
+	}}}}
+
+	cli := []string{"smoke"}
+	req := httptest.NewRequest("POST", "/api/admin/users", nil)
+	req.Header.Set("User-Agent", "MyApp/2.1 (iOS)")
+	got := r.withRuleTags(req, cli)
+	want := []string{"smoke", "admin", "mutations", "mobile"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got tags %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(cli, []string{"smoke"}) {
+		t.Errorf("expected the CLI tags to be left alone, got %v", cli)
+	}
+
+	if got := r.withRuleTags(httptest.NewRequest("GET", "/api/users", nil), nil); len(got) != 0 {
+		t.Errorf("expected no tags for an unmatched request, got %v", got)
+	}
+}
+
+func TestTakeControlHeaders(t *testing.T) {
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set(HeaderRecord, "On")
+	req.Header.Set(HeaderTags, "smoke, exploratory,,")
+	req.Header.Set(HeaderScenario, "checkout")
+	c := takeControlHeaders(req)
+	if !c.force || c.skip || !reflect.DeepEqual(c.tags, []string{"smoke", "exploratory"}) || c.scenario != "checkout" {
+		t.Errorf("unexpected control %+v", c)
+	}
+	if req.Header.Get(HeaderRecord) != "" || req.Header.Get(HeaderTags) != "" || req.Header.Get(HeaderScenario) != "" {
+		t.Error("expected control headers to be removed")
+	}
+
+	req = httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set(HeaderRecord, "off")
+	if c := takeControlHeaders(req); !c.skip || c.force {
+		t.Errorf("expected off to skip recording, got %+v", c)
+	}
+
+	req = httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set(HeaderRecord, "maybe")
+	req.Header.Set(HeaderScenario, "../escape")
+	if c := takeControlHeaders(req); c.skip || c.force || c.scenario != "" {
+		t.Errorf("expected invalid values to be ignored, got %+v", c)
+	}
+}
+
+func TestStatusRecorded(t *testing.T) {
+	r := &Recorder{config: &config.Config{Recording: config.RecordingConfig{RecordStatus: []string{"2xx", "3XX", "404"}}}}
+	for status, want := range map[int]bool{200: true, 204: true, 301: true, 404: true, 401: false, 500: false} {
+		if got := r.statusRecorded(status); got != want {
+			t.Errorf("statusRecorded(%d) = %v, want %v", status, got, want)
+		}
+	}
+
+	r.config.Recording.RecordStatus = nil
+	if !r.statusRecorded(503) {
+		t.Error("expected every status to be recorded by default")
+	}
+}
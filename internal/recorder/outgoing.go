@@ -2,6 +2,7 @@ package recorder
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log/slog"
@@ -9,7 +10,11 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/hostrule"
+	"github.com/esse/snapshot-tester/internal/protobuf"
 	"github.com/esse/snapshot-tester/internal/snapshot"
 )
 
@@ -18,11 +23,17 @@ import (
 // to route its outgoing HTTP traffic through this proxy (e.g., via HTTP_PROXY).
 type OutgoingProxy struct {
 	mu            sync.Mutex
-	calls         []snapshot.OutgoingRequest
+	calls         []snapshot.OutgoingRequest            // calls captured without correlation, for Drain
+	inFlight      map[string][]snapshot.OutgoingRequest // calls by correlation key of requests being recorded
+	correlation   string                                // header holding the correlation key; "" disables correlation
 	listener      net.Listener
 	server        *http.Server
 	ignoreHeaders map[string]bool
 	client        *http.Client
+	h2c           *http.Client              // forwards HTTP/2 calls to plaintext upstreams, e.g. gRPC
+	ca            *certAuthority            // set when HTTPS interception is enabled
+	hostRules     []config.OutgoingHostRule // per-host capture, passthrough or block; see SetHostRules
+	proto         *protobuf.Codec           // decodes protobuf bodies; nil leaves them base64-encoded
 }
 
 // NewOutgoingProxy creates a forward proxy that captures outgoing HTTP requests.
@@ -34,23 +45,73 @@ func NewOutgoingProxy(ignoreHeaders []string) *OutgoingProxy {
 	return &OutgoingProxy{
 		ignoreHeaders: ignore,
 		client:        &http.Client{},
+		h2c:           newH2CClient(),
+		inFlight:      make(map[string][]snapshot.OutgoingRequest),
 	}
 }
 
+// SetCorrelationHeader makes the proxy assign calls that carry the header to
+// the request registered with Begin under the same key. The header itself is
+// not captured, since its value differs on every run.
+func (p *OutgoingProxy) SetCorrelationHeader(name string) {
+	p.correlation = name
+	p.ignoreHeaders[strings.ToLower(name)] = true
+}
+
+// SetClientTLS makes forwarded HTTPS calls present the client certificate
+// in cfg to upstreams that ask for one and trust its CA, for services whose
+// dependencies require mutual TLS as well. nil keeps the defaults.
+func (p *OutgoingProxy) SetClientTLS(cfg *tls.Config) {
+	if cfg == nil {
+		return
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg.Clone()
+	p.client.Transport = transport
+}
+
+// newH2CClient returns a client speaking HTTP/2 with prior knowledge to
+// plaintext upstreams.
+func newH2CClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Protocols = new(http.Protocols)
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: transport}
+}
+
+// EnableMITM makes the proxy intercept HTTPS: CONNECT tunnels are answered
+// with a certificate for the tunneled host signed by a local CA, and the
+// requests inside are captured like plain HTTP. The CA is loaded from caDir,
+// or generated there on first use; its certificate's path is returned so
+// the service can be configured to trust it.
+func (p *OutgoingProxy) EnableMITM(caDir string) (string, error) {
+	ca, err := loadOrCreateCA(caDir)
+	if err != nil {
+		return "", err
+	}
+	p.ca = ca
+	return ca.certPath, nil
+}
+
 // Start launches the outgoing proxy. If port is 0, a random port is chosen.
 // Returns the listener address (e.g., "127.0.0.1:12345").
 func (p *OutgoingProxy) Start(port int) (string, error) {
 	addr := fmt.Sprintf("127.0.0.1:%d", port)
-	var err error
-	p.listener, err = net.Listen("tcp", addr)
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return "", fmt.Errorf("starting outgoing proxy: %w", err)
 	}
+	return p.Serve(ln), nil
+}
 
+// Serve runs the proxy on an existing listener, such as a unix socket, and
+// returns the listener's address.
+func (p *OutgoingProxy) Serve(ln net.Listener) string {
+	p.listener = ln
 	p.server = &http.Server{Handler: p}
 	go p.server.Serve(p.listener)
 
-	return p.listener.Addr().String(), nil
+	return p.listener.Addr().String()
 }
 
 // Stop shuts down the outgoing proxy.
@@ -60,9 +121,10 @@ func (p *OutgoingProxy) Stop() {
 	}
 }
 
-// Drain returns all captured outgoing requests and resets the internal buffer.
-// This should be called after each incoming request cycle to collect the
-// outgoing requests associated with that incoming request.
+// Drain returns all captured outgoing requests and resets the internal
+// buffer, when the proxy correlates no calls. This should be called after
+// each incoming request cycle to collect the outgoing requests associated
+// with that incoming request.
 func (p *OutgoingProxy) Drain() []snapshot.OutgoingRequest {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -71,12 +133,53 @@ func (p *OutgoingProxy) Drain() []snapshot.OutgoingRequest {
 	return calls
 }
 
+// Begin registers the correlation key of a request about to be proxied, so
+// calls carrying it are kept for Take. It returns false if the key is
+// already in use by another request.
+func (p *OutgoingProxy) Begin(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.inFlight[key]; ok {
+		return false
+	}
+	p.inFlight[key] = nil
+	return true
+}
+
+// Take returns the calls made for the request with the given correlation
+// key, and unregisters the key.
+func (p *OutgoingProxy) Take(key string) []snapshot.OutgoingRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	calls := p.inFlight[key]
+	delete(p.inFlight, key)
+	return calls
+}
+
 // ServeHTTP handles forward proxy requests. It forwards the request to the
 // actual destination, captures both the request and response, and stores them.
 func (p *OutgoingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// CONNECT method (HTTPS tunneling) is not supported for capture
+	passthrough := false
+	switch p.hostAction(requestAuthority(r)) {
+	case hostrule.Block:
+		slog.Info("outgoing request blocked", "component", "outgoing_proxy", "method", r.Method, "host", requestAuthority(r))
+		http.Error(w, "blocked by recording.outgoing_hosts", http.StatusForbidden)
+		return
+	case hostrule.Passthrough:
+		if r.Method == http.MethodConnect {
+			p.passTunnel(w, r)
+			return
+		}
+		passthrough = true
+	}
+
+	// CONNECT method (HTTPS tunneling) can only be captured by intercepting TLS
 	if r.Method == http.MethodConnect {
-		http.Error(w, "HTTPS tunneling (CONNECT) not supported for outgoing capture; use plain HTTP", http.StatusMethodNotAllowed)
+		if p.ca == nil {
+			http.Error(w, "HTTPS tunneling (CONNECT) not supported for outgoing capture; use plain HTTP or enable recording.outgoing_mitm", http.StatusMethodNotAllowed)
+			return
+		}
+		p.serveTunnel(w, r)
 		return
 	}
 
@@ -120,9 +223,19 @@ func (p *OutgoingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			outReq.Header.Add(k, v)
 		}
 	}
+	// gRPC servers require "TE: trailers", the one TE value HTTP/2 allows
+	if strings.EqualFold(r.Header.Get("Te"), "trailers") {
+		outReq.Header.Set("Te", "trailers")
+	}
 
-	// Forward the request
-	resp, err := p.client.Do(outReq)
+	// Forward the request. HTTP/2 calls to plaintext upstreams, such as
+	// gRPC without TLS, can't be downgraded to HTTP/1.1, so they use h2c.
+	client := p.client
+	if r.ProtoMajor == 2 && outReq.URL.Scheme == "http" {
+		client = p.h2c
+	}
+	start := time.Now()
+	resp, err := client.Do(outReq)
 	if err != nil {
 		slog.Error("failed to forward request", "component", "outgoing_proxy", "url", targetURL, "error", err)
 		http.Error(w, fmt.Sprintf("failed to reach upstream: %v", err), http.StatusBadGateway)
@@ -137,17 +250,41 @@ func (p *OutgoingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to read response body", http.StatusBadGateway)
 		return
 	}
+	elapsed := time.Since(start)
+
+	if !passthrough {
+		p.captureCall(r, reqBodyRaw, resp, respBodyRaw, elapsed)
+	}
+
+	// Write response back to the service
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBodyRaw)
+	for k, vv := range resp.Trailer {
+		for _, v := range vv {
+			w.Header().Add(http.TrailerPrefix+k, v)
+		}
+	}
+}
 
+// captureCall records a forwarded call and its response.
+func (p *OutgoingProxy) captureCall(r *http.Request, reqBodyRaw []byte, resp *http.Response, respBodyRaw []byte, elapsed time.Duration) {
 	// Build captured headers (filtering ignored ones)
 	reqHeaders := p.filterHeaders(r.Header)
 	respHeaders := p.filterHeaders(resp.Header)
 
 	// Parse bodies using content-type-aware encoding
 	reqContentType := r.Header.Get(snapshot.HeaderContentType)
-	parsedReqBody := snapshot.ParseBody(reqBodyRaw, reqContentType)
+	parsedReqBody := snapshot.ParseBody(decompress(reqBodyRaw, r.Header), reqContentType)
+	parsedReqBody = p.proto.DecodeRequestBody(r.Method, r.URL.RequestURI(), reqContentType, parsedReqBody)
 
 	respContentType := resp.Header.Get(snapshot.HeaderContentType)
-	parsedRespBody := snapshot.ParseBody(respBodyRaw, respContentType)
+	parsedRespBody := snapshot.ParseBody(decompress(respBodyRaw, resp.Header), respContentType)
+	parsedRespBody = p.proto.DecodeResponseBody(r.Method, r.URL.RequestURI(), respContentType, parsedRespBody)
 
 	// Record the outgoing request
 	outgoing := snapshot.OutgoingRequest{
@@ -156,38 +293,143 @@ func (p *OutgoingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Headers: reqHeaders,
 		Body:    parsedReqBody,
 		Response: &snapshot.Response{
-			Status:  resp.StatusCode,
-			Headers: respHeaders,
-			Body:    parsedRespBody,
+			Status:   resp.StatusCode,
+			Headers:  respHeaders,
+			Body:     parsedRespBody,
+			Trailers: p.filterTrailers(resp.Trailer),
 		},
+		DurationMs: elapsed.Milliseconds(),
 	}
 
-	p.mu.Lock()
-	p.calls = append(p.calls, outgoing)
-	p.mu.Unlock()
+	p.capture(correlationKey(p.correlation, r.Header.Get(p.correlation)), outgoing)
 
 	slog.Debug("outgoing request captured", "method", r.Method, "url", r.URL.RequestURI(), "status", resp.StatusCode)
+}
 
-	// Write response back to the service
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
+// capture stores a call for the request with the given correlation key.
+// Calls with a key no request in flight uses, such as those a service makes
+// after answering, or while serving a request that isn't recorded, are
+// dropped rather than given to another request. Calls without a key, from
+// services that don't propagate the correlation header, go to the request
+// in flight only while there is just one; otherwise they are dropped too.
+func (p *OutgoingProxy) capture(key string, call snapshot.OutgoingRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.correlation == "" {
+		p.calls = append(p.calls, call)
+		return
+	}
+	if key == "" {
+		if len(p.inFlight) != 1 {
+			slog.Warn("dropping outgoing request without a correlation header", "method", call.Method, "url", call.URL, "requests_in_flight", len(p.inFlight), "header", p.correlation)
+			return
+		}
+		for only := range p.inFlight {
+			key = only
 		}
 	}
-	w.WriteHeader(resp.StatusCode)
-	w.Write(respBodyRaw)
+	calls, ok := p.inFlight[key]
+	if !ok {
+		slog.Debug("dropping outgoing request of no recorded request", "method", call.Method, "url", call.URL, "correlation", key)
+		return
+	}
+	p.inFlight[key] = append(calls, call)
+}
+
+// serveTunnel accepts a CONNECT tunnel and serves the requests inside it
+// through ServeHTTP, aimed at the tunnel's destination. TLS is terminated
+// with a certificate for the tunneled host; tunnels that don't start with a
+// TLS handshake, such as those of plaintext gRPC clients, are served as
+// they come. Both HTTP/1.1 and HTTP/2 are accepted inside the tunnel.
+func (p *OutgoingProxy) serveTunnel(w http.ResponseWriter, r *http.Request) {
+	authority := r.Host
+	host, _, err := net.SplitHostPort(authority)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid CONNECT target %q", authority), http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be tunneled", http.StatusInternalServerError)
+		return
+	}
+	raw, rw, err := hijacker.Hijack()
+	if err != nil {
+		slog.Error("failed to hijack CONNECT", "component", "outgoing_proxy", "error", err)
+		return
+	}
+	if _, err := raw.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		raw.Close()
+		return
+	}
+	conn := &bufferedConn{Conn: raw, r: rw.Reader}
+	first, err := conn.r.Peek(1)
+	if err != nil {
+		raw.Close()
+		return
+	}
+
+	scheme := "http"
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	var tunneled net.Conn = conn
+	if first[0] == tlsRecordHandshake {
+		scheme = "https"
+		protocols = nil
+		tunneled = tls.Server(conn, &tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				if hello.ServerName != "" {
+					return p.ca.certFor(hello.ServerName)
+				}
+				return p.ca.certFor(host)
+			},
+			NextProtos: []string{"h2", "http/1.1"},
+		})
+	}
+
+	ln := newSingleConnListener(tunneled)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.URL.Scheme = scheme
+			req.URL.Host = authority
+			p.ServeHTTP(w, req)
+		}),
+		Protocols: protocols,
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				ln.Close()
+			}
+		},
+	}
+	go server.Serve(ln)
 }
 
 func (p *OutgoingProxy) filterHeaders(h http.Header) map[string]string {
 	result := make(map[string]string)
 	for k, v := range h {
 		if !p.ignoreHeaders[strings.ToLower(k)] {
-			result[k] = strings.Join(v, ", ")
+			result[k] = headerValue(k, v)
 		}
 	}
 	return result
 }
 
+// filterTrailers flattens response trailers like filterHeaders, returning
+// nil when none were sent.
+func (p *OutgoingProxy) filterTrailers(trailer http.Header) map[string]string {
+	trailers := p.filterHeaders(trailer)
+	for k, v := range trailers {
+		if v == "" {
+			delete(trailers, k) // announced but never sent
+		}
+	}
+	if len(trailers) == 0 {
+		return nil
+	}
+	return trailers
+}
+
 func isHopByHopHeader(h string) bool {
 	switch h {
 	case "connection", "keep-alive", "proxy-authenticate",
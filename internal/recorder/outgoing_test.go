@@ -1,13 +1,26 @@
 package recorder
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/hostrule"
+	"github.com/esse/snapshot-tester/internal/snapshot"
 )
 
 func TestOutgoingProxy_CapturesRequests(t *testing.T) {
@@ -145,3 +158,383 @@ func TestOutgoingProxy_ConnectRejected(t *testing.T) {
 		t.Errorf("expected 405 for CONNECT, got %d", resp.StatusCode)
 	}
 }
+
+func TestOutgoingProxy_MITMCapturesHTTPS(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"charged": true})
+	}))
+	defer target.Close()
+
+	caDir := t.TempDir()
+	proxy := NewOutgoingProxy(nil)
+	caPath, err := proxy.EnableMITM(caDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Trust the test server's self-signed certificate upstream
+	proxy.client = target.Client()
+	addr, err := proxy.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Stop()
+
+	// The service side trusts only the generated CA
+	caPEM, err := os.ReadFile(caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatal("CA certificate is not valid PEM")
+	}
+	proxyURL, _ := url.Parse("http://" + addr)
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(target.URL+"/v1/charges", "application/json", strings.NewReader(`{"amount":100}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+	}
+
+	calls := proxy.Drain()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 captured calls over one tunnel, got %d", len(calls))
+	}
+	if calls[0].URL != "/v1/charges" || calls[0].Method != "POST" {
+		t.Errorf("unexpected call: %s %s", calls[0].Method, calls[0].URL)
+	}
+	if body, ok := calls[0].Body.(map[string]any); !ok || body["amount"] != float64(100) {
+		t.Errorf("expected captured request body, got %v", calls[0].Body)
+	}
+	if body, ok := calls[0].Response.Body.(map[string]any); !ok || body["charged"] != true {
+		t.Errorf("expected captured response body, got %v", calls[0].Response.Body)
+	}
+
+	// A second proxy reuses the CA instead of generating a new one
+	again, err := NewOutgoingProxy(nil).EnableMITM(caDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused, _ := os.ReadFile(again); string(reused) != string(caPEM) {
+		t.Error("expected the stored CA to be reused")
+	}
+}
+
+func TestOutgoingProxy_CorrelatesCalls(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	defer target.Close()
+
+	proxy := NewOutgoingProxy(nil)
+	proxy.SetCorrelationHeader(DefaultCorrelationHeader)
+	addr, err := proxy.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Stop()
+
+	proxyURL, _ := url.Parse("http://" + addr)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	send := func(path, key string) {
+		req, _ := http.NewRequest("GET", target.URL+path, nil)
+		if key != "" {
+			req.Header.Set(DefaultCorrelationHeader, key)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if !proxy.Begin("a") || !proxy.Begin("b") {
+		t.Fatal("expected new keys to be accepted")
+	}
+	if proxy.Begin("a") {
+		t.Error("expected a key in flight to be refused")
+	}
+	// Calls of the two requests interleave
+	send("/b1", "b")
+	send("/a1", "a")
+	send("/b2", "b")
+	send("/late", "finished") // not in flight: dropped
+	send("/dropped", "")      // two requests in flight: dropped
+
+	paths := func(calls []snapshot.OutgoingRequest) []string {
+		var out []string
+		for _, c := range calls {
+			out = append(out, c.URL)
+			if _, ok := c.Headers[DefaultCorrelationHeader]; ok {
+				t.Errorf("expected the correlation header not to be captured on %s", c.URL)
+			}
+		}
+		return out
+	}
+	if got := paths(proxy.Take("b")); !reflect.DeepEqual(got, []string{"/b1", "/b2"}) {
+		t.Errorf("request b: got calls %v", got)
+	}
+	send("/untagged", "") // a alone in flight: its call
+	if got := paths(proxy.Take("a")); !reflect.DeepEqual(got, []string{"/a1", "/untagged"}) {
+		t.Errorf("request a: got calls %v", got)
+	}
+	send("/idle", "") // nothing in flight: dropped
+	if proxy.Begin("c"); len(proxy.Take("c")) != 0 {
+		t.Error("expected calls made between requests to be dropped")
+	}
+	if !proxy.Begin("a") {
+		t.Error("expected a taken key to be free again")
+	}
+}
+
+func TestCorrelationKey(t *testing.T) {
+	tests := []struct {
+		header, value, want string
+	}{
+		{DefaultCorrelationHeader, " abc ", "abc"},
+		{"traceparent", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"traceparent", "garbage", ""},
+	}
+	for _, tt := range tests {
+		if got := correlationKey(tt.header, tt.value); got != tt.want {
+			t.Errorf("correlationKey(%q, %q) = %q, want %q", tt.header, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCorrelate_Traceparent(t *testing.T) {
+	r := &Recorder{outgoingProxy: NewOutgoingProxy(nil), correlationHeader: "traceparent"}
+	r.outgoingProxy.SetCorrelationHeader(r.correlationHeader)
+
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", incoming)
+	key, original := r.correlate(req)
+	if key != "4bf92f3577b34da6a3ce929d0e0e4736" || req.Header.Get("traceparent") != incoming {
+		t.Errorf("expected the caller's trace to be kept, got key %q", key)
+	}
+
+	// A second request in the same trace gets a trace of its own
+	req2 := httptest.NewRequest("GET", "/", nil)
+	req2.Header.Set("traceparent", incoming)
+	key2, original2 := r.correlate(req2)
+	if key2 == key || correlationKey("traceparent", req2.Header.Get("traceparent")) != key2 {
+		t.Errorf("expected a new trace, got key %q and header %q", key2, req2.Header.Get("traceparent"))
+	}
+	restoreHeader(req2.Header, "traceparent", original2)
+	if req2.Header.Get("traceparent") != incoming {
+		t.Errorf("expected the original header back, got %q", req2.Header.Get("traceparent"))
+	}
+	restoreHeader(req.Header, "traceparent", original)
+}
+
+func TestOutgoingProxy_HostRules(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	port := strings.TrimPrefix(target.URL, "http://127.0.0.1:")
+
+	proxy := NewOutgoingProxy(nil)
+	proxy.SetHostRules([]config.OutgoingHostRule{
+		{Host: "*.blocked.test", Action: hostrule.Block},
+		{Host: "localhost", Action: hostrule.Passthrough},
+	})
+	addr, err := proxy.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Stop()
+	proxyURL, _ := url.Parse("http://" + addr)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	for _, tt := range []struct {
+		url    string
+		status int
+	}{
+		{"http://localhost:" + port + "/metrics", 200},
+		{"http://127.0.0.1:" + port + "/charge", 200},
+		{"http://api.blocked.test/x", 403},
+	} {
+		resp, err := client.Get(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.url, tt.status, resp.StatusCode)
+		}
+	}
+
+	calls := proxy.Drain()
+	if len(calls) != 1 || calls[0].URL != "/charge" {
+		t.Errorf("expected only the call to the unmatched host to be captured, got %+v", calls)
+	}
+}
+
+func TestOutgoingProxy_PassthroughTunnel(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer target.Close()
+
+	// Without MITM, only passed-through tunnels are accepted
+	proxy := NewOutgoingProxy(nil)
+	proxy.SetHostRules([]config.OutgoingHostRule{{Host: "127.0.0.1", Action: hostrule.Passthrough}})
+	addr, err := proxy.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Stop()
+	proxyURL, _ := url.Parse("http://" + addr)
+	transport := target.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+
+	resp, err := (&http.Client{Transport: transport}).Get(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "secret" {
+		t.Errorf("expected the tunneled response, got %q", body)
+	}
+	if calls := proxy.Drain(); len(calls) != 0 {
+		t.Errorf("expected nothing captured, got %+v", calls)
+	}
+}
+
+func TestOutgoingProxy_CapturesGRPCOverTunnel(t *testing.T) {
+	target := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Te") != "trailers" {
+			http.Error(w, "gRPC needs HTTP/2 and TE: trailers", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte{0, 0, 0, 0, 2, 0x08, 0x01})
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	target.Config.Protocols = new(http.Protocols)
+	target.Config.Protocols.SetUnencryptedHTTP2(true)
+	target.Start()
+	defer target.Close()
+
+	proxy := NewOutgoingProxy(nil)
+	if _, err := proxy.EnableMITM(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := proxy.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Stop()
+
+	// A plaintext gRPC client tunnels through the proxy and speaks h2c inside
+	targetHost := strings.TrimPrefix(target.URL, "http://")
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", targetHost, targetHost)
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil || resp.StatusCode != 200 {
+				conn.Close()
+				return nil, fmt.Errorf("CONNECT failed: %v %v", resp, err)
+			}
+			return conn, nil
+		},
+		Protocols: new(http.Protocols),
+	}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+
+	req, _ := http.NewRequest("POST", target.URL+"/pkg.Pricing/Quote", bytes.NewReader([]byte{0, 0, 0, 0, 2, 0x08, 0x2a}))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Fatalf("expected a gRPC response with trailers, got %d %v", resp.StatusCode, resp.Trailer)
+	}
+
+	calls := proxy.Drain()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 captured call, got %d", len(calls))
+	}
+	if calls[0].URL != "/pkg.Pricing/Quote" || calls[0].Response.Status != 200 {
+		t.Errorf("unexpected call: %s %s -> %d", calls[0].Method, calls[0].URL, calls[0].Response.Status)
+	}
+	if calls[0].Response.Trailers["Grpc-Status"] != "0" {
+		t.Errorf("expected the Grpc-Status trailer to be captured, got %v", calls[0].Response.Trailers)
+	}
+}
+
+func TestOutgoingProxy_MITMServesHTTP2(t *testing.T) {
+	var upstreamProto int
+	target := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamProto = r.ProtoMajor
+		w.WriteHeader(204)
+	}))
+	target.EnableHTTP2 = true
+	target.StartTLS()
+	defer target.Close()
+
+	proxy := NewOutgoingProxy(nil)
+	caPath, err := proxy.EnableMITM(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.client = target.Client()
+	addr, err := proxy.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Stop()
+
+	caPEM, _ := os.ReadFile(caPath)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	proxyURL, _ := url.Parse("http://" + addr)
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyURL(proxyURL),
+			TLSClientConfig:   &tls.Config{RootCAs: roots},
+			ForceAttemptHTTP2: true,
+		},
+	}
+	resp, err := client.Get(target.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2 inside the tunnel, got %s", resp.Proto)
+	}
+	if upstreamProto != 2 {
+		t.Errorf("expected HTTP/2 upstream, got HTTP/%d", upstreamProto)
+	}
+	if calls := proxy.Drain(); len(calls) != 1 || calls[0].URL != "/health" {
+		t.Errorf("expected the call to be captured, got %+v", calls)
+	}
+}
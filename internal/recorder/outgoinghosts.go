@@ -0,0 +1,71 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/hostrule"
+)
+
+// tunnelDialTimeout bounds connecting to the destination of a passed-through
+// CONNECT tunnel.
+const tunnelDialTimeout = 10 * time.Second
+
+// SetHostRules sets how calls are handled per destination host. The first
+// matching rule applies; calls to other hosts are captured.
+func (p *OutgoingProxy) SetHostRules(rules []config.OutgoingHostRule) {
+	p.hostRules = rules
+}
+
+func (p *OutgoingProxy) hostAction(authority string) string {
+	return hostrule.Action(p.hostRules, authority)
+}
+
+// requestAuthority returns the host (and port, if given) a proxied request
+// is for.
+func requestAuthority(r *http.Request) string {
+	if r.Method != http.MethodConnect && r.URL.Host != "" {
+		return r.URL.Host
+	}
+	return r.Host
+}
+
+// passTunnel connects a CONNECT tunnel straight to its destination, without
+// intercepting what goes through it.
+func (p *OutgoingProxy) passTunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, tunnelDialTimeout)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to reach upstream: %v", err), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "connection cannot be tunneled", http.StatusInternalServerError)
+		return
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		slog.Error("failed to hijack CONNECT", "component", "outgoing_proxy", "error", err)
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+
+	// Closing either side ends both copies
+	go func() {
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
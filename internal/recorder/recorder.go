@@ -1,20 +1,31 @@
 package recorder
 
 import (
-	"bytes"
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/esse/snapshot-tester/internal/auth"
 	"github.com/esse/snapshot-tester/internal/config"
 	"github.com/esse/snapshot-tester/internal/db"
+	"github.com/esse/snapshot-tester/internal/hooks"
+	"github.com/esse/snapshot-tester/internal/httpclient"
+	"github.com/esse/snapshot-tester/internal/listen"
+	"github.com/esse/snapshot-tester/internal/protobuf"
+	"github.com/esse/snapshot-tester/internal/redact"
+	"github.com/esse/snapshot-tester/internal/service"
 	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/esse/snapshot-tester/internal/sqlcapture"
+	"github.com/esse/snapshot-tester/internal/websocket"
 	"golang.org/x/time/rate"
 )
 
@@ -24,50 +35,170 @@ type Recorder struct {
 	snapshotter   db.Snapshotter
 	store         *snapshot.Store
 	proxy         *httputil.ReverseProxy
+	serviceTLS    *tls.Config // client certificate and CA for reaching the service; nil for the defaults
 	tags          []string
 	outgoingProxy *OutgoingProxy
+	hooks         *hooks.Runner
+	proto         *protobuf.Codec // nil unless protobuf descriptors are configured
+
+	correlationHeader string // set on proxied requests to attribute outgoing calls; see correlate
+	startService      bool   // run service.command while recording; see SetStartService
+
+	mu       sync.Mutex // guards tags, scenario and recorded, which the admin API reads and updates, review and the stop state
+	recorded int
+	scenario string     // scenario snapshots are added to; see SetScenario
+	review   ReviewFunc // approves snapshots before they are saved; see SetReview
+
+	maxSnapshots int           // stop after saving this many; see SetMaxSnapshots
+	server       *http.Server  // set while Start serves; see Stop
+	shutdown     chan struct{} // closed when Stop has shut server down
+	stopped      bool
+
+	reviewMu   sync.Mutex // runs reviews one at a time
+	scenarioMu sync.Mutex // serializes writes to scenario files
+
+	webhooks sync.WaitGroup // deliveries in flight; see waitForWebhooks
+
+	service *service.Process // started by Start with SetStartService; nil otherwise
 }
 
 // New creates a new Recorder.
 func New(cfg *config.Config, tags []string) (*Recorder, error) {
-	snapshotter, err := db.NewSnapshotter(cfg.Database.Type, cfg.Database.ConnectionString, cfg.Database.Tables, cfg.Database.Namespaces)
+	var targets []db.Target
+	for _, d := range cfg.DatabaseList() {
+		targets = append(targets, db.Target{
+			Name:       d.Name,
+			Type:       d.Type,
+			ConnString: d.ConnectionString,
+			Tables:     d.Tables,
+			Namespaces: d.Namespaces,
+
+			ExcludeColumns: d.ExcludeColumns,
+			Filters:        d.Filters,
+			RestoreMode:    d.RestoreMode,
+
+			IncludeViews: d.IncludeViews,
+			RefreshViews: d.RefreshMaterializedViews,
+		})
+	}
+	snapshotter, err := db.Open(targets)
 	if err != nil {
 		return nil, fmt.Errorf("connecting to database: %w", err)
 	}
+	if cfg.Recording.Incremental {
+		inc, err := db.NewIncremental(snapshotter)
+		if err != nil {
+			snapshotter.Close()
+			return nil, fmt.Errorf("setting up incremental capture: %w", err)
+		}
+		snapshotter = inc
+	}
 
 	store := snapshot.NewStore(cfg.Recording.SnapshotDir, cfg.Recording.Format)
+	store.DedupStates = cfg.Recording.DedupDBStates
+	store.BodyFileThreshold = cfg.Recording.BodyFileThreshold
 
-	target, err := url.Parse(cfg.Service.BaseURL)
+	serviceTLS, err := httpclient.LoadTLS(cfg.Service.ClientCert, cfg.Service.ClientKey, cfg.Service.CACert)
 	if err != nil {
-		return nil, fmt.Errorf("parsing service base URL: %w", err)
+		snapshotter.Close()
+		return nil, err
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(target)
+	// Without a base URL, the recorder can only be used as Middleware
+	var proxy *httputil.ReverseProxy
+	if cfg.Service.BaseURL != "" {
+		if proxy, err = httpclient.NewReverseProxy(cfg.Service.BaseURL, serviceTLS); err != nil {
+			snapshotter.Close()
+			return nil, err
+		}
+		if cfg.Recording.StreamResponses {
+			// Flush after every write; streams without a Content-Length are
+			// flushed this way regardless
+			proxy.FlushInterval = -1
+		}
+	}
+
+	codec, err := protobuf.New(cfg.Protobuf)
+	if err != nil {
+		snapshotter.Close()
+		return nil, fmt.Errorf("loading protobuf descriptors: %w", err)
+	}
 
 	outgoingProxy := NewOutgoingProxy(cfg.Recording.IgnoreHeaders)
+	outgoingProxy.proto = codec
+	outgoingProxy.SetClientTLS(serviceTLS)
+	outgoingProxy.SetHostRules(cfg.Recording.OutgoingHosts)
+	correlationHeader := cfg.Recording.CorrelationHeader
+	if correlationHeader == "" {
+		correlationHeader = DefaultCorrelationHeader
+	}
+	outgoingProxy.SetCorrelationHeader(correlationHeader)
+	if cfg.Recording.OutgoingMITM {
+		caPath, err := outgoingProxy.EnableMITM(cfg.Recording.OutgoingCADir)
+		if err != nil {
+			snapshotter.Close()
+			return nil, fmt.Errorf("setting up HTTPS interception: %w", err)
+		}
+		slog.Info("intercepting outgoing HTTPS", "ca", caPath, "hint", "make the service trust this certificate")
+	}
 
 	return &Recorder{
 		config:        cfg,
 		snapshotter:   snapshotter,
 		store:         store,
 		proxy:         proxy,
+		serviceTLS:    serviceTLS,
 		tags:          tags,
 		outgoingProxy: outgoingProxy,
+		hooks:         hooks.New(cfg.Hooks),
+		proto:         codec,
+
+		correlationHeader: correlationHeader,
 	}, nil
 }
 
+// Hooks returns the lifecycle hook runner, for registering Go callbacks.
+func (r *Recorder) Hooks() *hooks.Runner {
+	return r.hooks
+}
+
 // Start begins the recording proxy on the configured port.
 func (r *Recorder) Start() error {
+	if r.proxy == nil {
+		return errors.New("service.base_url is required to start the recording proxy")
+	}
+
 	// Start outgoing capture proxy
-	outAddr, err := r.outgoingProxy.Start(r.config.Recording.OutgoingProxyPort)
+	outListener, err := listen.Open(r.config.Recording.OutgoingProxyListen, r.config.Recording.OutgoingProxyPort, "127.0.0.1")
 	if err != nil {
 		return fmt.Errorf("starting outgoing proxy: %w", err)
 	}
+	outAddr := r.outgoingProxy.Serve(outListener)
 	defer r.outgoingProxy.Stop()
-	slog.Info("outgoing capture proxy started", "addr", outAddr, "hint", "set HTTP_PROXY=http://"+outAddr+" on service")
+	if listen.IsTCP(outListener) {
+		hint := "set HTTP_PROXY=http://" + outAddr + " on service"
+		if r.config.Recording.OutgoingMITM {
+			hint = "set HTTP_PROXY and HTTPS_PROXY=http://" + outAddr + " on service"
+		}
+		slog.Info("outgoing capture proxy started", "addr", outAddr, "hint", hint)
+	} else {
+		slog.Info("outgoing capture proxy started", "addr", outAddr)
+	}
 
-	addr := fmt.Sprintf(":%d", r.config.Recording.ProxyPort)
-	slog.Info("recording proxy started", "addr", addr, "target", r.config.Service.BaseURL)
+	if r.startService {
+		proc, err := r.runService(outAddr, listen.IsTCP(outListener))
+		if err != nil {
+			return err
+		}
+		r.service = proc
+		defer proc.Stop()
+	}
+
+	ln, err := listen.Open(r.config.Recording.ProxyListen, r.config.Recording.ProxyPort, "")
+	if err != nil {
+		return fmt.Errorf("starting recording proxy: %w", err)
+	}
+	slog.Info("recording proxy started", "addr", ln.Addr().String(), "target", r.config.Service.BaseURL)
 	slog.Info("snapshot directory configured", "dir", r.config.Recording.SnapshotDir)
 
 	var handler http.Handler = r
@@ -84,26 +215,83 @@ func (r *Recorder) Start() error {
 		slog.Info("proxy authentication enabled")
 	}
 
+	authn := auth.New(r.config.Auth)
+	if authn.Enabled() {
+		handler = r.withAdmin(authn, handler)
+		slog.Info("admin API enabled", "prefix", AdminPathPrefix)
+	}
+
 	server := &http.Server{
-		Addr:    addr,
 		Handler: handler,
 	}
+	if target, err := httpclient.ParseTarget(r.config.Service.BaseURL); err == nil {
+		server.Protocols = target.ServerProtocols()
+	}
 
-	return server.ListenAndServe()
+	return r.serveUntilStopped(server, ln)
 }
 
 // ServeHTTP handles each proxied request.
 func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// 1. Read request body
-	var reqBody []byte
-	if req.Body != nil {
-		var err error
-		reqBody, err = io.ReadAll(req.Body)
-		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+	if r.proxy == nil {
+		http.Error(w, "service.base_url is not set", http.StatusBadGateway)
+		return
+	}
+	r.serve(w, req, r.proxy)
+}
+
+// Middleware returns a handler that records the requests it passes to next,
+// so a Go service can record in-process, e.g. in its integration tests,
+// instead of behind the proxy. Requests are recorded as by ServeHTTP, except
+// that WebSocket upgrades pass through unrecorded and the service's
+// outgoing calls are not captured. service.base_url is not used.
+func (r *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if websocket.IsUpgrade(req) {
+			next.ServeHTTP(w, req)
 			return
 		}
-		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+		r.serve(w, req, next)
+	})
+}
+
+// serve passes a request to next, recording it unless the control
+// headers, filters or sampling say otherwise.
+func (r *Recorder) serve(w http.ResponseWriter, req *http.Request, next http.Handler) {
+	ctl := takeControlHeaders(req)
+	// Sampling would leave gaps in a scenario, so its requests are exempt
+	scenario := r.scenarioFor(ctl)
+	if ctl.skip || !ctl.force && (!r.shouldRecord(req) || scenario == "" && !r.sampled(req)) {
+		next.ServeHTTP(w, req)
+		return
+	}
+	r.record(w, req, ctl, scenario, next)
+}
+
+// record passes a request to next and saves its snapshot. Failures are
+// logged, and answered with an error status if the request was not passed
+// on yet; the returned error says why no snapshot was saved, for RecordOne.
+func (r *Recorder) record(w http.ResponseWriter, req *http.Request, ctl control, scenario string, next http.Handler) (*snapshot.Snapshot, string, error) {
+	received := time.Now()
+
+	// 1. Read request body
+	reqBody, reqDigest, err := r.readRequestBody(req)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return nil, "", fmt.Errorf("reading request body: %w", err)
+	}
+	if r.skipOversized(reqDigest) {
+		slog.Info("request body over max_body_bytes, not recording", "method", req.Method, "path", req.URL.Path)
+		next.ServeHTTP(w, req)
+		return nil, "", errors.New("request body over max_body_bytes")
+	}
+
+	// Run before_record hooks so their side effects land before db_state_before
+	hookCtx := hooks.Context{Event: hooks.EventBeforeRecord, Method: req.Method, URL: req.URL.RequestURI()}
+	if err := r.hooks.Run(hookCtx); err != nil {
+		slog.Error("before_record hook failed", "error", err)
+		http.Error(w, "before_record hook failed", http.StatusInternalServerError)
+		return nil, "", fmt.Errorf("before_record hook: %w", err)
 	}
 
 	// 2. Snapshot DB before
@@ -111,45 +299,108 @@ func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		slog.Error("failed to snapshot DB before request", "error", err)
 		http.Error(w, "Failed to snapshot database", http.StatusInternalServerError)
-		return
+		return nil, "", fmt.Errorf("snapshotting database before request: %w", err)
 	}
 
-	// 3. Drain any stale outgoing requests before proxying
-	r.outgoingProxy.Drain()
+	// 3. Tag the request so the outgoing calls it triggers can be told
+	// apart from those of concurrent requests
+	corrKey, corrHeader := r.correlate(req)
 
 	// 4. Proxy the request and capture the response
 	recorder := &responseRecorder{
 		ResponseWriter: w,
 		statusCode:     200,
+		captureChunks:  r.config.Recording.CaptureChunks,
+	}
+	if limit := r.config.Recording.MaxBodyBytes; limit > 0 {
+		recorder.digest = snapshot.NewBodyDigest(limit)
 	}
 
-	r.proxy.ServeHTTP(recorder, req)
+	var messages []snapshot.Message
+	logOffset := r.service.LogOffset()
+	upstreamStart := time.Now()
+	if websocket.IsUpgrade(req) {
+		messages = r.proxyWebSocket(recorder, req)
+	} else {
+		next.ServeHTTP(recorder, req)
+	}
+	upstream := time.Since(upstreamStart)
 
 	// 5. Collect outgoing requests made by the service during this request
-	outgoingRequests := r.outgoingProxy.Drain()
+	outgoingRequests := r.outgoingProxy.Take(corrKey)
+	queries := takeQueries(recorder)
+	restoreHeader(req.Header, r.correlationHeader, corrHeader)
+	if reqDigest != nil && reqDigest.Truncated() {
+		// Read what the service left unread, so the size and hash are complete
+		io.Copy(io.Discard, req.Body)
+	}
+	if r.skipOversized(recorder.digest) {
+		slog.Info("response body over max_body_bytes, not recording", "method", req.Method, "path", req.URL.Path)
+		return nil, "", errors.New("response body over max_body_bytes")
+	}
+	if !ctl.force && !r.statusRecorded(recorder.statusCode) {
+		slog.Info("response status not in record_status, not recording", "method", req.Method, "path", req.URL.Path, "status", recorder.statusCode)
+		return nil, "", fmt.Errorf("response status %d not in record_status", recorder.statusCode)
+	}
 
 	// 6. Snapshot DB after
+	if err := db.RefreshViews(r.snapshotter); err != nil {
+		slog.Error("failed to refresh materialized views", "error", err)
+		return nil, "", fmt.Errorf("refreshing materialized views: %w", err)
+	}
 	dbAfter, err := r.snapshotter.SnapshotAll()
 	if err != nil {
 		slog.Error("failed to snapshot DB after request", "error", err)
-		return
+		return nil, "", fmt.Errorf("snapshotting database after request: %w", err)
 	}
 
 	// 7. Build snapshot
-	snap := r.buildSnapshot(req, reqBody, recorder, dbBefore, dbAfter, outgoingRequests)
+	snap := r.buildSnapshot(req, reqBody, reqDigest, recorder, dbBefore, dbAfter, outgoingRequests)
+	snap.WebSocket = messages
+	snap.Queries = queries
+	snap.ServiceLogs, _ = r.service.LogsSince(logOffset)
+	snap.Tags = addTags(snap.Tags, ctl.tags)
+	if r.config.Recording.CaptureSchema {
+		snap.DBSchema = r.captureSchema()
+	}
+
+	snap.Timing = &snapshot.Timing{
+		DurationMs: time.Since(received).Milliseconds(),
+		UpstreamMs: upstream.Milliseconds(),
+	}
 
-	// 8. Save snapshot
+	// 8. Save snapshot, unless the review discards it
+	if !r.reviewed(w, snap) {
+		slog.Info("snapshot discarded", "method", req.Method, "path", req.URL.Path)
+		return nil, "", errDiscarded
+	}
+	if !r.reserve() {
+		slog.Info("snapshot limit reached, not recording", "method", req.Method, "path", req.URL.Path)
+		return nil, "", errLimitReached
+	}
 	path, err := r.store.Save(snap)
 	if err != nil {
+		r.release()
 		slog.Error("failed to save snapshot", "error", err)
-		return
+		return nil, "", fmt.Errorf("saving snapshot: %w", err)
+	}
+
+	if scenario != "" {
+		r.addScenarioStep(scenario, snap, path)
 	}
 
+	r.notifyWebhook(snap, path)
+
 	outCount := len(outgoingRequests)
 	slog.Info("snapshot recorded", "method", req.Method, "path", req.URL.Path, "status", recorder.statusCode, "file", path, "outgoing_count", outCount)
+	if r.limitReached() {
+		slog.Info("snapshot limit reached, stopping")
+		go r.Stop()
+	}
+	return snap, path, nil
 }
 
-func (r *Recorder) buildSnapshot(req *http.Request, reqBody []byte, resp *responseRecorder, dbBefore, dbAfter map[string][]map[string]any, outgoingRequests []snapshot.OutgoingRequest) *snapshot.Snapshot {
+func (r *Recorder) buildSnapshot(req *http.Request, reqBody []byte, reqDigest *snapshot.BodyDigest, resp *responseRecorder, dbBefore, dbAfter map[string][]map[string]any, outgoingRequests []snapshot.OutgoingRequest) *snapshot.Snapshot {
 	// Build request headers (filtering ignored ones)
 	headers := make(map[string]string)
 	ignoreSet := make(map[string]bool)
@@ -158,34 +409,69 @@ func (r *Recorder) buildSnapshot(req *http.Request, reqBody []byte, resp *respon
 	}
 	for k, v := range req.Header {
 		if !ignoreSet[strings.ToLower(k)] {
-			headers[k] = strings.Join(v, ", ")
+			headers[k] = headerValue(k, v)
 		}
 	}
 
 	// Parse request body (handles JSON, text, and binary/RPC payloads like protobuf)
 	reqContentType := req.Header.Get(snapshot.HeaderContentType)
-	parsedReqBody := snapshot.ParseBody(reqBody, reqContentType)
+	parsedReqBody := snapshot.ParseBody(decompress(reqBody, req.Header), reqContentType)
+	parsedReqBody = r.proto.DecodeRequestBody(req.Method, req.URL.RequestURI(), reqContentType, parsedReqBody)
+	if reqDigest != nil && reqDigest.Truncated() {
+		parsedReqBody = r.truncatedBody(reqDigest)
+	}
 
 	// Parse response body (handles JSON, text, and binary/RPC payloads like protobuf)
 	respContentType := resp.Header().Get(snapshot.HeaderContentType)
-	parsedRespBody := snapshot.ParseBody(resp.body, respContentType)
+	parsedRespBody := snapshot.ParseBody(decompress(resp.body, resp.Header()), respContentType)
+	parsedRespBody = r.proto.DecodeResponseBody(req.Method, req.URL.RequestURI(), respContentType, parsedRespBody)
+	if resp.digest != nil && resp.digest.Truncated() {
+		parsedRespBody = r.truncatedBody(resp.digest)
+	}
+	var events []snapshot.Event
+	if resp.events != nil {
+		events, parsedRespBody = resp.events.Events, nil
+	}
+	chunks := r.buildChunks(resp)
 
-	// Response headers
+	// Response headers, as sent before the body; trailers are set on the
+	// same map afterwards
+	sentHeader := resp.sentHeader
+	if sentHeader == nil {
+		sentHeader = resp.Header()
+	}
 	respHeaders := make(map[string]string)
-	for k, v := range resp.Header() {
+	for k, v := range sentHeader {
+		if k == "Trailer" {
+			continue // the trailers themselves are recorded below
+		}
 		if !ignoreSet[strings.ToLower(k)] {
-			respHeaders[k] = strings.Join(v, ", ")
+			respHeaders[k] = headerValue(k, v)
 		}
 	}
+	var respTrailers map[string]string
+	for k, v := range resp.trailers() {
+		if !ignoreSet[strings.ToLower(k)] {
+			if respTrailers == nil {
+				respTrailers = make(map[string]string)
+			}
+			respTrailers[k] = headerValue(k, v)
+		}
+	}
+
+	// Compute diff, matching rows by the same keys replay uses
+	dbDiff := db.ComputeDiff(dbBefore, dbAfter, r.config.Replay.RowKeys)
 
-	// Compute diff
-	dbDiff := db.ComputeDiff(dbBefore, dbAfter)
+	r.mu.Lock()
+	tags := r.tags
+	r.mu.Unlock()
+	tags = r.withRuleTags(req, tags)
 
 	snap := &snapshot.Snapshot{
 		ID:        snapshot.GenerateID(),
 		Timestamp: time.Now().UTC(),
 		Service:   r.config.Service.Name,
-		Tags:      r.tags,
+		Tags:      tags,
 		DBStateBefore: dbBefore,
 		Request: snapshot.Request{
 			Method:  req.Method,
@@ -198,6 +484,10 @@ func (r *Recorder) buildSnapshot(req *http.Request, reqBody []byte, resp *respon
 			Status:  resp.statusCode,
 			Headers: respHeaders,
 			Body:    parsedRespBody,
+			Events:  events,
+			Chunks:  chunks,
+
+			Trailers: respTrailers,
 		},
 		DBStateAfter: dbAfter,
 		DBDiff:       dbDiff,
@@ -205,14 +495,94 @@ func (r *Recorder) buildSnapshot(req *http.Request, reqBody []byte, resp *respon
 
 	// Apply field-level redaction if configured
 	if len(r.config.Recording.RedactFields) > 0 {
-		redactSnapshot(snap, r.config.Recording.RedactFields)
+		redactor := redact.New(r.config.Recording.RedactMode, r.config.Recording.RedactKey)
+		redact.Snapshot(snap, r.config.Recording.RedactFields, redactor)
 	}
 
 	return snap
 }
 
+// takeQueries removes the queries reported by sqlcapture.Middleware from the
+// response headers and returns them.
+func takeQueries(resp *responseRecorder) []snapshot.Query {
+	value := resp.Header().Get(sqlcapture.Header)
+	resp.Header().Del(sqlcapture.Header)
+	if resp.sentHeader != nil {
+		value = resp.sentHeader.Get(sqlcapture.Header)
+		resp.sentHeader.Del(sqlcapture.Header)
+	}
+	if value == "" {
+		return nil
+	}
+	queries, err := sqlcapture.Decode(value)
+	if err != nil {
+		slog.Warn("ignoring captured queries", "error", err)
+		return nil
+	}
+	return queries
+}
+
+// buildChunks returns the recorded chunks of a streamed response. Chunk
+// data is parsed like bodies, so newline-delimited JSON reads naturally;
+// compressed chunks are kept base64-encoded. With redact_fields configured
+// only sizes and timing are stored, since a chunk can hold part of a field.
+func (r *Recorder) buildChunks(resp *responseRecorder) []snapshot.Chunk {
+	if len(resp.chunks) == 0 {
+		return nil
+	}
+	contentType := resp.Header().Get(snapshot.HeaderContentType)
+	if resp.Header().Get(snapshot.HeaderContentEncoding) != "" {
+		contentType = "application/octet-stream"
+	}
+	chunks := make([]snapshot.Chunk, len(resp.chunks))
+	for i, c := range resp.chunks {
+		chunks[i] = snapshot.Chunk{Size: len(c.data), OffsetMs: c.at.Milliseconds()}
+		if len(r.config.Recording.RedactFields) == 0 {
+			chunks[i].Data = snapshot.ParseBody(c.data, contentType)
+		}
+	}
+	return chunks
+}
+
+// decompress returns a body with its Content-Encoding removed, so the
+// snapshot stores readable data. Bodies in an unsupported or corrupt
+// encoding are stored as they came.
+func decompress(body []byte, header http.Header) []byte {
+	data, err := snapshot.DecompressBody(body, header.Get(snapshot.HeaderContentEncoding))
+	if err != nil {
+		slog.Warn("storing compressed body as is", "error", err)
+	}
+	return data
+}
+
+// headerValue joins a header's values for storage. Content-Type is
+// normalized so equivalent values are recorded identically.
+func headerValue(name string, values []string) string {
+	value := strings.Join(values, ", ")
+	if http.CanonicalHeaderKey(name) == snapshot.HeaderContentType {
+		return snapshot.NormalizeContentType(value)
+	}
+	return value
+}
+
+// captureSchema returns the current table schemas, or nil if the database
+// can't describe them.
+func (r *Recorder) captureSchema() map[string]snapshot.TableSchema {
+	ss, ok := r.snapshotter.(db.SchemaSnapshotter)
+	if !ok {
+		return nil
+	}
+	schema, err := ss.SnapshotSchema()
+	if err != nil {
+		slog.Warn("failed to capture DB schema; recording without it", "error", err)
+		return nil
+	}
+	return schema
+}
+
 // Close cleans up resources.
 func (r *Recorder) Close() error {
+	r.waitForWebhooks()
 	r.outgoingProxy.Stop()
 	return r.snapshotter.Close()
 }
@@ -227,11 +597,13 @@ func (r *Recorder) withAuth(token string, next http.Handler) http.Handler {
 			return
 		}
 		if len(auth) < len(snapshot.AuthSchemeBearer) || !strings.EqualFold(auth[:len(snapshot.AuthSchemeBearer)], snapshot.AuthSchemeBearer) {
+			w.Header().Set(snapshot.HeaderWWWAuthenticate, `Bearer realm="snapshot-tester"`)
 			http.Error(w, "Invalid authorization scheme, expected Bearer", http.StatusUnauthorized)
 			return
 		}
-		if auth[len(snapshot.AuthSchemeBearer):] != token {
-			http.Error(w, "Invalid token", http.StatusForbidden)
+		if subtle.ConstantTimeCompare([]byte(auth[len(snapshot.AuthSchemeBearer):]), []byte(token)) != 1 {
+			w.Header().Set(snapshot.HeaderWWWAuthenticate, `Bearer realm="snapshot-tester", error="invalid_token"`)
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 		// Strip the auth header before proxying so it doesn't leak to the service
@@ -276,149 +648,83 @@ func (r *Recorder) withRateLimit(cfg config.RateLimitConfig, next http.Handler)
 	})
 }
 
-const redactedValue = "[REDACTED]"
+// responseRecorder captures the response for snapshot storage while also writing to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       []byte
+	events     *snapshot.EventParser // set for text/event-stream responses
+
+	captureChunks bool
+	streamStart   time.Time
+	chunks        []rawChunk // set for responses without a Content-Length when captureChunks is on
 
-// redactSnapshot replaces sensitive field values with [REDACTED] in a snapshot.
-// Supports paths like "request.headers.Authorization", "response.body.password",
-// and wildcard paths like "*.password" that match at any depth.
-func redactSnapshot(snap *snapshot.Snapshot, fields []string) {
-	for _, field := range fields {
-		parts := strings.Split(field, ".")
-		if len(parts) < 2 {
-			continue
-		}
+	sentHeader http.Header // headers as of WriteHeader
 
-		switch parts[0] {
-		case "request":
-			redactInRequest(&snap.Request, parts[1:])
-		case "response":
-			redactInResponse(&snap.Response, parts[1:])
-		case "*":
-			// Wildcard: redact in both request and response bodies and headers
-			redactInRequest(&snap.Request, parts[1:])
-			redactInResponse(&snap.Response, parts[1:])
-			// Also redact in outgoing requests
-			for i := range snap.OutgoingRequests {
-				subReq := snapshot.Request{
-					Method:  snap.OutgoingRequests[i].Method,
-					URL:     snap.OutgoingRequests[i].URL,
-					Headers: snap.OutgoingRequests[i].Headers,
-					Body:    snap.OutgoingRequests[i].Body,
-				}
-				redactInRequest(&subReq, parts[1:])
-				snap.OutgoingRequests[i].Headers = subReq.Headers
-				snap.OutgoingRequests[i].Body = subReq.Body
-				if snap.OutgoingRequests[i].Response != nil {
-					redactInResponse(snap.OutgoingRequests[i].Response, parts[1:])
-				}
-			}
-		}
-	}
+	digest *snapshot.BodyDigest // set when max_body_bytes limits the body kept
 }
 
-func redactInRequest(req *snapshot.Request, path []string) {
-	if len(path) == 0 {
-		return
-	}
-	switch path[0] {
-	case "headers":
-		if len(path) == 2 && req.Headers != nil {
-			if _, ok := req.Headers[path[1]]; ok {
-				req.Headers[path[1]] = redactedValue
-			}
-		}
-	case "body":
-		if len(path) >= 2 {
-			req.Body = redactInBody(req.Body, path[1:])
-		}
-	default:
-		// Treat as a body field name at any depth
-		req.Body = redactFieldRecursive(req.Body, path[0])
-		if req.Headers != nil {
-			if _, ok := req.Headers[path[0]]; ok {
-				req.Headers[path[0]] = redactedValue
-			}
-		}
-	}
+// rawChunk is one write of a streamed response body.
+type rawChunk struct {
+	data []byte
+	at   time.Duration
 }
 
-func redactInResponse(resp *snapshot.Response, path []string) {
-	if len(path) == 0 {
-		return
-	}
-	switch path[0] {
-	case "headers":
-		if len(path) == 2 && resp.Headers != nil {
-			if _, ok := resp.Headers[path[1]]; ok {
-				resp.Headers[path[1]] = redactedValue
-			}
-		}
-	case "body":
-		if len(path) >= 2 {
-			resp.Body = redactInBody(resp.Body, path[1:])
-		}
-	default:
-		resp.Body = redactFieldRecursive(resp.Body, path[0])
-		if resp.Headers != nil {
-			if _, ok := resp.Headers[path[0]]; ok {
-				resp.Headers[path[0]] = redactedValue
-			}
-		}
+func (rr *responseRecorder) WriteHeader(code int) {
+	rr.statusCode = code
+	rr.sentHeader = rr.Header().Clone()
+	rr.streamStart = time.Now()
+	if snapshot.IsEventStream(rr.Header().Get(snapshot.HeaderContentType)) {
+		rr.events = snapshot.NewEventParser(rr.streamStart)
+	} else if rr.captureChunks && rr.Header().Get("Content-Length") == "" {
+		rr.chunks = []rawChunk{}
 	}
+	rr.ResponseWriter.WriteHeader(code)
 }
 
-func redactInBody(body any, path []string) any {
-	if body == nil || len(path) == 0 {
-		return body
-	}
-	m, ok := body.(map[string]any)
-	if !ok {
-		return body
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.digest != nil {
+		rr.digest.Write(b)
+		rr.body = rr.digest.Bytes()
+	} else {
+		rr.body = append(rr.body, b...)
 	}
-	if len(path) == 1 {
-		if _, exists := m[path[0]]; exists {
-			m[path[0]] = redactedValue
-		}
-		return m
+	if rr.events != nil {
+		rr.events.Write(b)
 	}
-	if nested, exists := m[path[0]]; exists {
-		m[path[0]] = redactInBody(nested, path[1:])
+	if rr.chunks != nil {
+		rr.chunks = append(rr.chunks, rawChunk{data: append([]byte(nil), b...), at: time.Since(rr.streamStart)})
 	}
-	return m
+	return rr.ResponseWriter.Write(b)
 }
 
-func redactFieldRecursive(body any, fieldName string) any {
-	if body == nil {
-		return body
-	}
-	m, ok := body.(map[string]any)
-	if !ok {
-		return body
+// trailers returns the trailers set after the headers were written: those
+// announced in the Trailer header, and those set with http.TrailerPrefix.
+func (rr *responseRecorder) trailers() http.Header {
+	if rr.sentHeader == nil {
+		return nil
 	}
-	if _, exists := m[fieldName]; exists {
-		m[fieldName] = redactedValue
+	trailers := make(http.Header)
+	for _, announced := range rr.sentHeader.Values("Trailer") {
+		for _, name := range strings.Split(announced, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if v := rr.Header().Values(name); len(v) > 0 {
+				trailers[name] = v
+			}
+		}
 	}
-	for k, v := range m {
-		if nested, isMap := v.(map[string]any); isMap {
-			m[k] = redactFieldRecursive(nested, fieldName)
+	for k, v := range rr.Header() {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			trailers[http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = v
 		}
 	}
-	return m
-}
-
-// responseRecorder captures the response for snapshot storage while also writing to the client.
-type responseRecorder struct {
-	http.ResponseWriter
-	statusCode int
-	body       []byte
-}
-
-func (rr *responseRecorder) WriteHeader(code int) {
-	rr.statusCode = code
-	rr.ResponseWriter.WriteHeader(code)
+	return trailers
 }
 
-func (rr *responseRecorder) Write(b []byte) (int, error) {
-	rr.body = append(rr.body, b...)
-	return rr.ResponseWriter.Write(b)
+// Flush passes flushes through so streamed responses such as Server-Sent
+// Events reach the client as they are written.
+func (rr *responseRecorder) Flush() {
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 }
@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
 )
 
 func TestWithAuth_ValidToken(t *testing.T) {
@@ -66,8 +69,11 @@ func TestWithAuth_WrongToken(t *testing.T) {
 
 	handler.ServeHTTP(w, req)
 
-	if w.Code != http.StatusForbidden {
-		t.Errorf("expected 403, got %d", w.Code)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Error("expected WWW-Authenticate header on 401")
 	}
 }
 
@@ -89,3 +95,38 @@ func TestWithAuth_InvalidScheme(t *testing.T) {
 		t.Errorf("expected 401, got %d", w.Code)
 	}
 }
+
+func TestHeaderValue_NormalizesContentType(t *testing.T) {
+	if got := headerValue("content-type", []string{"Application/JSON; charset=UTF-8"}); got != "application/json" {
+		t.Errorf("expected normalized content type, got %q", got)
+	}
+	if got := headerValue("Accept", []string{"text/html", "Application/JSON"}); got != "text/html, Application/JSON" {
+		t.Errorf("expected other headers untouched, got %q", got)
+	}
+}
+
+func TestSetOverwrite_Audits(t *testing.T) {
+	dir := t.TempDir()
+	users := snapshot.Request{Method: "GET", URL: "/users"}
+	old := snapshot.NewStore(dir, "json")
+	if _, err := old.Save(&snapshot.Snapshot{ID: "old1", Service: "api", Request: users}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Recorder{
+		config: &config.Config{Recording: config.RecordingConfig{SnapshotDir: dir}},
+		store:  snapshot.NewStore(dir, "json"),
+	}
+	r.SetOverwrite(true, "snapshot-tester record")
+	if _, err := r.store.Save(&snapshot.Snapshot{ID: "new1", Service: "api", Request: users}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := snapshot.ReadAuditLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != snapshot.AuditActionDelete || entries[0].SnapshotID != "old1" || entries[0].Command != "snapshot-tester record" {
+		t.Errorf("expected the replaced snapshot's deletion audited, got %+v", entries)
+	}
+}
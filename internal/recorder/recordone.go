@@ -0,0 +1,45 @@
+package recorder
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/esse/snapshot-tester/internal/listen"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// RecordOne sends a single request to the service and saves its snapshot,
+// without a proxy in between: req.URL holds the path and query, which are
+// resolved against service.base_url. The request is recorded regardless of
+// the recording filters, sampling and record_status, as with
+// X-Snapshot-Record: on. The outgoing capture proxy listens for the duration
+// of the call, unless its address is taken, e.g. by a running recorder.
+func (r *Recorder) RecordOne(req *http.Request) (*snapshot.Snapshot, string, error) {
+	if r.proxy == nil {
+		return nil, "", errors.New("service.base_url is not set")
+	}
+	ctl := takeControlHeaders(req)
+	ctl.force = true
+
+	outListener, err := listen.Open(r.config.Recording.OutgoingProxyListen, r.config.Recording.OutgoingProxyPort, "127.0.0.1")
+	if err != nil {
+		slog.Warn("outgoing calls are not captured", "error", err)
+	} else {
+		r.outgoingProxy.Serve(outListener)
+		defer r.outgoingProxy.Stop()
+	}
+
+	return r.record(&discardResponse{header: make(http.Header)}, req, ctl, r.scenarioFor(ctl), r.proxy)
+}
+
+// discardResponse is the ResponseWriter of a request recorded without a
+// client: the responseRecorder wrapping it captures the response, so it only
+// has to hold the headers.
+type discardResponse struct {
+	header http.Header
+}
+
+func (d *discardResponse) Header() http.Header         { return d.header }
+func (d *discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardResponse) WriteHeader(int)             {}
@@ -0,0 +1,40 @@
+package recorder
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// ReviewFunc decides whether a captured snapshot is saved. It may change the
+// snapshot, e.g. add tags, before it is saved.
+type ReviewFunc func(snap *snapshot.Snapshot) bool
+
+// errDiscarded is returned by record for snapshots the review rejected.
+var errDiscarded = errors.New("snapshot discarded")
+
+// SetReview makes every captured snapshot go through fn before it is saved.
+// Reviews run one at a time, after the response has been sent to the
+// client. nil saves every snapshot.
+func (r *Recorder) SetReview(fn ReviewFunc) {
+	r.mu.Lock()
+	r.review = fn
+	r.mu.Unlock()
+}
+
+// reviewed reports whether snap should be saved, flushing the response to
+// the client first so it isn't held up by the review.
+func (r *Recorder) reviewed(w http.ResponseWriter, snap *snapshot.Snapshot) bool {
+	r.mu.Lock()
+	fn := r.review
+	r.mu.Unlock()
+	if fn == nil {
+		return true
+	}
+	http.NewResponseController(w).Flush()
+
+	r.reviewMu.Lock()
+	defer r.reviewMu.Unlock()
+	return fn(snap)
+}
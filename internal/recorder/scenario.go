@@ -0,0 +1,67 @@
+package recorder
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// SetScenario adds every snapshot recorded from now on to the named
+// scenario, in the order they are saved. An empty name stops the scenario.
+// A request's X-Snapshot-Scenario header takes precedence.
+func (r *Recorder) SetScenario(name string) error {
+	if name != "" {
+		if err := snapshot.ValidateScenarioName(name); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	r.scenario = name
+	r.mu.Unlock()
+	return nil
+}
+
+// scenarioFor returns the scenario a request's snapshot belongs to, if any.
+func (r *Recorder) scenarioFor(ctl control) string {
+	if ctl.scenario != "" {
+		return ctl.scenario
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.scenario
+}
+
+// addScenarioStep appends a saved snapshot to its scenario. Steps are
+// appended one at a time, so the scenario file keeps the order in which
+// snapshots were saved.
+func (r *Recorder) addScenarioStep(name string, snap *snapshot.Snapshot, path string) {
+	r.scenarioMu.Lock()
+	defer r.scenarioMu.Unlock()
+	if err := r.store.AddScenarioStep(name, snap, path); err != nil {
+		slog.Error("failed to add snapshot to scenario", "scenario", name, "file", path, "error", err)
+	}
+}
+
+// adminScenarioRequest is the payload accepted by PUT /__snapshot-tester/scenario.
+type adminScenarioRequest struct {
+	Name string `json:"name"`
+}
+
+func (r *Recorder) handleAdminScenario(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body adminScenarioRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if err := r.SetScenario(body.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeAdminJSON(w, body)
+}
@@ -0,0 +1,33 @@
+package recorder
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/esse/snapshot-tester/internal/service"
+)
+
+// SetStartService makes Start run service.command once the outgoing capture
+// proxy is listening, with HTTP_PROXY (and, with recording.outgoing_mitm,
+// HTTPS_PROXY) pointing at it, and stop the service when recording ends.
+func (r *Recorder) SetStartService(start bool) {
+	r.startService = start
+}
+
+// runService starts service.command with its outgoing calls routed through
+// the capture proxy at outAddr. A proxy on a unix socket can't be set as
+// HTTP_PROXY, so the service is then started without it.
+func (r *Recorder) runService(outAddr string, tcp bool) (*service.Process, error) {
+	var env []string
+	if tcp {
+		env = service.ProxyEnv("http://"+outAddr, r.config.Recording.OutgoingMITM)
+	} else {
+		slog.Warn("outgoing capture proxy listens on a unix socket; the service is started without HTTP_PROXY", "addr", outAddr)
+	}
+	env = append(env, service.SocketEnv(r.config)...)
+	proc, err := service.Start(r.config, env)
+	if err != nil {
+		return nil, fmt.Errorf("starting service: %w", err)
+	}
+	return proc, nil
+}
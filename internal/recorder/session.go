@@ -0,0 +1,27 @@
+package recorder
+
+import "github.com/esse/snapshot-tester/internal/snapshot"
+
+// SetSession saves the snapshots recorded from now on under the named
+// subdirectory of the snapshot directory. An empty name saves into the
+// snapshot directory itself. Call it before recording starts.
+func (r *Recorder) SetSession(name string) error {
+	if name != "" {
+		if err := snapshot.ValidateSessionName(name); err != nil {
+			return err
+		}
+	}
+	r.store.Session = name
+	return nil
+}
+
+// SetOverwrite makes the first snapshot recorded for an endpoint replace the
+// snapshots the endpoint already has, instead of appending to them. The
+// snapshots replaced are recorded in the audit log, attributed to command.
+// Call it before recording starts.
+func (r *Recorder) SetOverwrite(overwrite bool, command string) {
+	r.store.Overwrite = overwrite
+	if overwrite {
+		r.store.Audit = snapshot.NewAuditLog(r.config.Recording.SnapshotDir, command)
+	}
+}
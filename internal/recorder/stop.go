@@ -0,0 +1,97 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout bounds how long Stop waits for requests being recorded.
+const shutdownTimeout = 30 * time.Second
+
+// errLimitReached is returned by record once max snapshots are saved.
+var errLimitReached = errors.New("snapshot limit reached")
+
+// SetMaxSnapshots stops the recording proxy, as Stop does, once n snapshots
+// have been saved; snapshots of requests still in flight at that point are
+// not saved. 0 means no limit.
+func (r *Recorder) SetMaxSnapshots(n int) {
+	r.mu.Lock()
+	r.maxSnapshots = n
+	r.mu.Unlock()
+}
+
+// reserve counts a snapshot about to be saved, reporting false if the limit
+// is reached. Callers call release if the snapshot is not saved after all.
+func (r *Recorder) reserve() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSnapshots > 0 && r.recorded >= r.maxSnapshots {
+		return false
+	}
+	r.recorded++
+	return true
+}
+
+func (r *Recorder) release() {
+	r.mu.Lock()
+	r.recorded--
+	r.mu.Unlock()
+}
+
+// limitReached reports whether the last allowed snapshot has been saved.
+func (r *Recorder) limitReached() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.maxSnapshots > 0 && r.recorded >= r.maxSnapshots
+}
+
+// Stop shuts the recording proxy down gracefully: it stops accepting
+// connections and waits for the requests being recorded to be saved and
+// their webhooks delivered, after which Start returns nil. Calling Stop before Start makes Start return
+// right away.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	server, done := r.server, r.shutdown
+	alreadyStopped := r.stopped
+	r.stopped = true
+	r.mu.Unlock()
+	if server == nil || alreadyStopped {
+		return nil
+	}
+	defer close(done)
+	// Requests finishing during shutdown may still announce their snapshots
+	defer r.waitForWebhooks()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("requests still in flight after shutdown timeout", "error", err)
+		return server.Close()
+	}
+	return nil
+}
+
+// serveUntilStopped serves ln until Stop is called and has finished
+// shutting the server down.
+func (r *Recorder) serveUntilStopped(server *http.Server, ln net.Listener) error {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	r.server = server
+	r.shutdown = make(chan struct{})
+	done := r.shutdown
+	r.mu.Unlock()
+
+	if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-done
+	return nil
+}
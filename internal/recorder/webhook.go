@@ -0,0 +1,96 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// webhookTimeout bounds each webhook delivery so a slow receiver cannot pile
+// up goroutines during a long recording session.
+const webhookTimeout = 5 * time.Second
+
+// webhookDrainTimeout bounds how long Stop and Close wait for deliveries
+// still in flight. Each is bounded by webhookTimeout, and all run at once.
+const webhookDrainTimeout = webhookTimeout + time.Second
+
+// webhookEvent is the payload POSTed to recording.on_snapshot_webhook.
+type webhookEvent struct {
+	Event     string    `json:"event"`
+	ID        string    `json:"id"`
+	Service   string    `json:"service"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Status    int       `json:"status"`
+	Tags      []string  `json:"tags"`
+	Path      string    `json:"path"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// webhookEventRecorded is the event name sent when a snapshot is saved.
+const webhookEventRecorded = "snapshot.recorded"
+
+// notifyWebhook posts a summary of a saved snapshot in the background.
+// Delivery failures are logged and never affect the proxied request. Stop and
+// Close wait for deliveries in flight; see waitForWebhooks.
+func (r *Recorder) notifyWebhook(snap *snapshot.Snapshot, path string) {
+	webhookURL := r.config.Recording.OnSnapshotWebhook
+	if webhookURL == "" {
+		return
+	}
+	event := webhookEvent{
+		Event:     webhookEventRecorded,
+		ID:        snap.ID,
+		Service:   snap.Service,
+		Method:    snap.Request.Method,
+		URL:       snap.Request.URL,
+		Status:    snap.Response.Status,
+		Tags:      snap.Tags,
+		Path:      path,
+		Timestamp: snap.Timestamp,
+	}
+	r.webhooks.Add(1)
+	go func() {
+		defer r.webhooks.Done()
+		if err := postWebhook(webhookURL, event); err != nil {
+			slog.Warn("snapshot webhook failed", "url", webhookURL, "snapshot", snap.ID, "error", err)
+		}
+	}()
+}
+
+// waitForWebhooks waits up to webhookDrainTimeout for webhook deliveries in
+// flight, so snapshots saved just before recording stops are still announced.
+func (r *Recorder) waitForWebhooks() {
+	done := make(chan struct{})
+	go func() {
+		r.webhooks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(webhookDrainTimeout):
+		slog.Warn("snapshot webhook deliveries still pending after timeout")
+	}
+}
+
+func postWebhook(webhookURL string, event webhookEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshaling webhook payload: %w", err)
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(webhookURL, snapshot.ContentTypeJSON, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
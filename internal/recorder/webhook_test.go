@@ -0,0 +1,79 @@
+package recorder
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestNotifyWebhook(t *testing.T) {
+	received := make(chan webhookEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", req.Method)
+		}
+		var event webhookEvent
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			t.Error(err)
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	r := &Recorder{config: &config.Config{
+		Recording: config.RecordingConfig{OnSnapshotWebhook: server.URL},
+	}}
+	snap := &snapshot.Snapshot{
+		ID:       "abc",
+		Service:  "svc",
+		Tags:     []string{"smoke"},
+		Request:  snapshot.Request{Method: "POST", URL: "/users"},
+		Response: snapshot.Response{Status: 201},
+	}
+	r.notifyWebhook(snap, "snapshots/svc/POST_users/001_abc.snapshot.json")
+
+	select {
+	case event := <-received:
+		if event.Event != webhookEventRecorded || event.ID != "abc" || event.Method != "POST" ||
+			event.Status != 201 || event.Path != "snapshots/svc/POST_users/001_abc.snapshot.json" || event.Tags[0] != "smoke" {
+			t.Errorf("unexpected webhook payload: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestWaitForWebhooks(t *testing.T) {
+	var delivered atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		delivered.Store(true)
+	}))
+	defer server.Close()
+
+	r := &Recorder{config: &config.Config{
+		Recording: config.RecordingConfig{OnSnapshotWebhook: server.URL},
+	}}
+	r.notifyWebhook(&snapshot.Snapshot{ID: "abc"}, "001_abc.snapshot.json")
+	r.waitForWebhooks()
+	if !delivered.Load() {
+		t.Error("expected the delivery in flight to finish before waitForWebhooks returns")
+	}
+}
+
+func TestPostWebhook_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := postWebhook(server.URL, webhookEvent{}); err == nil {
+		t.Error("expected error for 500 response")
+	}
+}
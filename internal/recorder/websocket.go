@@ -0,0 +1,125 @@
+package recorder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/httpclient"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/esse/snapshot-tester/internal/websocket"
+)
+
+// wsDialTimeout bounds connecting to the service for a WebSocket upgrade.
+const wsDialTimeout = 10 * time.Second
+
+// wsCloseTimeout is how long the other side of a WebSocket connection gets
+// to finish the close handshake once one side has closed.
+const wsCloseTimeout = 5 * time.Second
+
+// proxyWebSocket relays an upgrade request to the service and, once the
+// service switches protocols, relays frames both ways until the connection
+// closes. It returns the messages in the order the proxy saw them. A
+// service that declines the upgrade has its response passed on like any
+// other.
+func (r *Recorder) proxyWebSocket(w *responseRecorder, req *http.Request) []snapshot.Message {
+	target, err := httpclient.ParseTarget(r.config.Service.BaseURL)
+	if err != nil {
+		http.Error(w, "Invalid service URL", http.StatusBadGateway)
+		return nil
+	}
+	target.TLS = r.serviceTLS
+	backend, err := target.Dial(wsDialTimeout)
+	if err != nil {
+		slog.Error("failed to connect to service for WebSocket", "error", err)
+		http.Error(w, "Failed to connect to service", http.StatusBadGateway)
+		return nil
+	}
+	defer backend.Close()
+
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+	// Frames are relayed and recorded as they are, so no extension such as
+	// permessage-deflate may be negotiated
+	out.Header.Del("Sec-WebSocket-Extensions")
+	if err := out.Write(backend); err != nil {
+		slog.Error("failed to send WebSocket handshake", "error", err)
+		http.Error(w, "Failed to reach service", http.StatusBadGateway)
+		return nil
+	}
+	backendBuf := bufio.NewReader(backend)
+	resp, err := http.ReadResponse(backendBuf, out)
+	if err != nil {
+		slog.Error("failed to read WebSocket handshake response", "error", err)
+		http.Error(w, "Invalid response from service", http.StatusBadGateway)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return nil
+	}
+
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket upgrade not supported", http.StatusInternalServerError)
+		return nil
+	}
+	client, clientBuf, err := hj.Hijack()
+	if err != nil {
+		slog.Error("failed to take over client connection", "error", err)
+		return nil
+	}
+	defer client.Close()
+	w.statusCode = resp.StatusCode
+
+	fmt.Fprintf(clientBuf, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(clientBuf)
+	clientBuf.WriteString("\r\n")
+	if err := clientBuf.Flush(); err != nil {
+		slog.Error("failed to complete WebSocket handshake", "error", err)
+		return nil
+	}
+
+	var mu sync.Mutex
+	var messages []snapshot.Message
+	record := func(direction string) func(byte, []byte) {
+		return func(opcode byte, payload []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			messages = append(messages, snapshot.NewMessage(direction, websocket.MessageType(opcode), payload))
+		}
+	}
+
+	done := make(chan error, 2)
+	go func() {
+		done <- websocket.Relay(clientBuf.Reader, backend, true, record(snapshot.DirectionClient))
+	}()
+	go func() {
+		done <- websocket.Relay(backendBuf, client, false, record(snapshot.DirectionServer))
+	}()
+
+	if err := <-done; err != nil {
+		// A side dropped the connection without a close handshake
+		client.Close()
+		backend.Close()
+	} else {
+		deadline := time.Now().Add(wsCloseTimeout)
+		client.SetDeadline(deadline)
+		backend.SetDeadline(deadline)
+	}
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	return messages
+}
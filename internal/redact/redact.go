@@ -0,0 +1,298 @@
+// Package redact replaces sensitive values in snapshots, masking them or
+// pseudonymizing them with a keyed HMAC, for recording and replay alike.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Redaction modes (must match config recording.redact_mode values).
+const (
+	ModeMask = "mask"
+	ModeHMAC = "hmac"
+)
+
+const redactedValue = "[REDACTED]"
+
+// hmacTokenPrefix marks values that were pseudonymized with a keyed HMAC.
+const hmacTokenPrefix = "hmac:"
+
+// Redactor returns the replacement stored in place of a sensitive value.
+type Redactor func(value any) any
+
+// New returns the Redactor for the given mode.
+// In hmac mode, values are replaced with a truncated HMAC-SHA256 of the original
+// keyed by key, so equal inputs produce equal tokens across record and replay
+// without the raw value ever being written to disk. Any other mode masks values
+// with [REDACTED].
+func New(mode, key string) Redactor {
+	if mode == ModeHMAC {
+		return hmacRedactor([]byte(key))
+	}
+	return maskRedactor
+}
+
+func maskRedactor(any) any {
+	return redactedValue
+}
+
+func hmacRedactor(key []byte) Redactor {
+	return func(value any) any {
+		var data []byte
+		if s, ok := value.(string); ok {
+			data = []byte(s)
+		} else {
+			// Non-string values (numbers, objects) are hashed by their JSON form
+			data, _ = json.Marshal(value)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return hmacTokenPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+	}
+}
+
+// redactSnapshot replaces sensitive field values with [REDACTED] in a snapshot.
+// Supports paths like "request.headers.Authorization", "response.body.password",
+// array paths like "response.body.users[*].email" or "response.body.items[0].token",
+// and wildcard paths like "*.password" that match at any depth.
+func redactSnapshot(snap *snapshot.Snapshot, fields []string) {
+	Snapshot(snap, fields, maskRedactor)
+}
+
+// Snapshot replaces sensitive field values in a snapshot using redact.
+// Field paths follow the same syntax as recording.redact_fields.
+func Snapshot(snap *snapshot.Snapshot, fields []string, redact Redactor) {
+	for _, field := range fields {
+		parts := splitRedactPath(field)
+		if len(parts) < 2 {
+			continue
+		}
+
+		switch parts[0] {
+		case "request":
+			redactInRequest(&snap.Request, parts[1:], redact)
+		case "response":
+			redactInResponse(&snap.Response, parts[1:], redact)
+		case "*":
+			// Wildcard: redact in both request and response bodies and headers
+			redactInRequest(&snap.Request, parts[1:], redact)
+			redactInResponse(&snap.Response, parts[1:], redact)
+			// Also redact in outgoing requests
+			for i := range snap.OutgoingRequests {
+				subReq := snapshot.Request{
+					Method:  snap.OutgoingRequests[i].Method,
+					URL:     snap.OutgoingRequests[i].URL,
+					Headers: snap.OutgoingRequests[i].Headers,
+					Body:    snap.OutgoingRequests[i].Body,
+				}
+				redactInRequest(&subReq, parts[1:], redact)
+				snap.OutgoingRequests[i].Headers = subReq.Headers
+				snap.OutgoingRequests[i].Body = subReq.Body
+				if snap.OutgoingRequests[i].Response != nil {
+					redactInResponse(snap.OutgoingRequests[i].Response, parts[1:], redact)
+				}
+			}
+		}
+	}
+}
+
+func redactInRequest(req *snapshot.Request, path []string, redact Redactor) {
+	if len(path) == 0 {
+		return
+	}
+	switch path[0] {
+	case "headers":
+		if len(path) == 2 && req.Headers != nil {
+			if v, ok := req.Headers[path[1]]; ok {
+				req.Headers[path[1]] = redactHeader(v, redact)
+			}
+		}
+	case "body":
+		if len(path) >= 2 {
+			req.Body = redactInBody(req.Body, path[1:], redact)
+		}
+	default:
+		// Treat as a body field name at any depth
+		req.Body = redactFieldRecursive(req.Body, path[0], redact)
+		if req.Headers != nil {
+			if v, ok := req.Headers[path[0]]; ok {
+				req.Headers[path[0]] = redactHeader(v, redact)
+			}
+		}
+	}
+}
+
+func redactInResponse(resp *snapshot.Response, path []string, redact Redactor) {
+	if len(path) == 0 {
+		return
+	}
+	switch path[0] {
+	case "headers":
+		if len(path) == 2 && resp.Headers != nil {
+			if v, ok := resp.Headers[path[1]]; ok {
+				resp.Headers[path[1]] = redactHeader(v, redact)
+			}
+		}
+	case "body":
+		if len(path) >= 2 {
+			resp.Body = redactInBody(resp.Body, path[1:], redact)
+		}
+	case "events":
+		// Server-Sent Event data: events[*].data or events[0].data.token
+		idx, ok := arraySelector(path[1])
+		if !ok || len(path) < 3 || path[2] != "data" {
+			return
+		}
+		for i := range resp.Events {
+			if idx >= 0 && i != idx {
+				continue
+			}
+			if len(path) == 3 {
+				resp.Events[i].Data = redact(resp.Events[i].Data)
+			} else {
+				resp.Events[i].Data = redactInBody(resp.Events[i].Data, path[3:], redact)
+			}
+		}
+	default:
+		resp.Body = redactFieldRecursive(resp.Body, path[0], redact)
+		for i := range resp.Events {
+			resp.Events[i].Data = redactFieldRecursive(resp.Events[i].Data, path[0], redact)
+		}
+		if resp.Headers != nil {
+			if v, ok := resp.Headers[path[0]]; ok {
+				resp.Headers[path[0]] = redactHeader(v, redact)
+			}
+		}
+	}
+}
+
+// redactHeader applies redact to a header value, which must stay a string.
+func redactHeader(value string, redact Redactor) string {
+	if s, ok := redact(value).(string); ok {
+		return s
+	}
+	return redactedValue
+}
+
+// splitRedactPath splits a redaction path on "." and separates array selectors,
+// so "body.users[*].email" becomes ["body", "users", "[*]", "email"].
+func splitRedactPath(field string) []string {
+	var parts []string
+	for _, part := range strings.Split(field, ".") {
+		for {
+			open := strings.IndexByte(part, '[')
+			if open < 0 {
+				break
+			}
+			if open > 0 {
+				parts = append(parts, part[:open])
+			}
+			end := strings.IndexByte(part[open:], ']')
+			if end < 0 {
+				break
+			}
+			parts = append(parts, part[open:open+end+1])
+			part = part[open+end+1:]
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// arraySelector parses "[*]" (returns -1) or "[N]" (returns N).
+func arraySelector(segment string) (int, bool) {
+	if !strings.HasPrefix(segment, "[") || !strings.HasSuffix(segment, "]") {
+		return 0, false
+	}
+	inner := segment[1 : len(segment)-1]
+	if inner == "*" {
+		return -1, true
+	}
+	idx, err := strconv.Atoi(inner)
+	if err != nil || idx < 0 {
+		return 0, false
+	}
+	return idx, true
+}
+
+func redactInBody(body any, path []string, redact Redactor) any {
+	if body == nil || len(path) == 0 {
+		return body
+	}
+	// Structured XML, msgpack and CBOR bodies are addressed as stored:
+	// body.data.<field>...
+	if eb, ok := body.(*snapshot.EncodedBody); ok {
+		if eb.Structured() && path[0] == "data" && len(path) > 1 {
+			eb.Data = redactInBody(eb.Data, path[1:], redact)
+		}
+		return eb
+	}
+	if idx, isSelector := arraySelector(path[0]); isSelector {
+		arr, ok := body.([]any)
+		if !ok {
+			return body
+		}
+		for i := range arr {
+			if idx >= 0 && i != idx {
+				continue
+			}
+			if len(path) == 1 {
+				arr[i] = redact(arr[i])
+			} else {
+				arr[i] = redactInBody(arr[i], path[1:], redact)
+			}
+		}
+		return arr
+	}
+	m, ok := body.(map[string]any)
+	if !ok {
+		return body
+	}
+	if len(path) == 1 {
+		if v, exists := m[path[0]]; exists {
+			m[path[0]] = redact(v)
+		}
+		return m
+	}
+	if nested, exists := m[path[0]]; exists {
+		m[path[0]] = redactInBody(nested, path[1:], redact)
+	}
+	return m
+}
+
+func redactFieldRecursive(body any, fieldName string, redact Redactor) any {
+	switch v := body.(type) {
+	case *snapshot.EncodedBody:
+		if v.Structured() {
+			v.Data = redactFieldRecursive(v.Data, fieldName, redact)
+		}
+		return v
+	case map[string]any:
+		if fv, exists := v[fieldName]; exists {
+			v[fieldName] = redact(fv)
+		}
+		for k, nested := range v {
+			if k == fieldName {
+				continue
+			}
+			v[k] = redactFieldRecursive(nested, fieldName, redact)
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = redactFieldRecursive(v[i], fieldName, redact)
+		}
+		return v
+	default:
+		return body
+	}
+}
@@ -0,0 +1,434 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestRedactSnapshot_RequestHeader(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method:  "POST",
+			URL:     "/api/login",
+			Headers: map[string]string{"Authorization": "Bearer secret-token", "Content-Type": "application/json"},
+			Body:    map[string]any{"user": "alice"},
+		},
+		Response: snapshot.Response{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    map[string]any{"token": "abc123"},
+		},
+	}
+
+	redactSnapshot(snap, []string{"request.headers.Authorization"})
+
+	if snap.Request.Headers["Authorization"] != redactedValue {
+		t.Errorf("expected Authorization to be redacted, got %q", snap.Request.Headers["Authorization"])
+	}
+	if snap.Request.Headers["Content-Type"] != "application/json" {
+		t.Errorf("expected Content-Type to be preserved, got %q", snap.Request.Headers["Content-Type"])
+	}
+}
+
+func TestRedactSnapshot_ResponseBodyField(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method: "GET",
+			URL:    "/api/user",
+		},
+		Response: snapshot.Response{
+			Status: 200,
+			Body:   map[string]any{"name": "Alice", "ssn": "123-45-6789"},
+		},
+	}
+
+	redactSnapshot(snap, []string{"response.body.ssn"})
+
+	body := snap.Response.Body.(map[string]any)
+	if body["ssn"] != redactedValue {
+		t.Errorf("expected ssn to be redacted, got %v", body["ssn"])
+	}
+	if body["name"] != "Alice" {
+		t.Errorf("expected name to be preserved, got %v", body["name"])
+	}
+}
+
+func TestRedactSnapshot_WildcardField(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method: "POST",
+			URL:    "/api/register",
+			Body:   map[string]any{"username": "alice", "password": "secret123"},
+		},
+		Response: snapshot.Response{
+			Status: 200,
+			Body:   map[string]any{"message": "ok", "password": "should-also-redact"},
+		},
+	}
+
+	redactSnapshot(snap, []string{"*.password"})
+
+	reqBody := snap.Request.Body.(map[string]any)
+	if reqBody["password"] != redactedValue {
+		t.Errorf("expected request password to be redacted, got %v", reqBody["password"])
+	}
+
+	respBody := snap.Response.Body.(map[string]any)
+	if respBody["password"] != redactedValue {
+		t.Errorf("expected response password to be redacted, got %v", respBody["password"])
+	}
+}
+
+func TestRedactSnapshot_NestedBodyField(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method: "POST",
+			URL:    "/api/data",
+			Body: map[string]any{
+				"user": map[string]any{
+					"name":     "Alice",
+					"password": "secret",
+				},
+			},
+		},
+		Response: snapshot.Response{
+			Status: 200,
+		},
+	}
+
+	redactSnapshot(snap, []string{"request.body.user.password"})
+
+	body := snap.Request.Body.(map[string]any)
+	user := body["user"].(map[string]any)
+	if user["password"] != redactedValue {
+		t.Errorf("expected nested password to be redacted, got %v", user["password"])
+	}
+	if user["name"] != "Alice" {
+		t.Errorf("expected name to be preserved, got %v", user["name"])
+	}
+}
+
+func TestRedactSnapshot_WildcardRecursive(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method: "POST",
+			URL:    "/api/data",
+			Body: map[string]any{
+				"data": map[string]any{
+					"nested": map[string]any{
+						"secret": "top-secret-value",
+					},
+				},
+				"secret": "also-secret",
+			},
+		},
+		Response: snapshot.Response{
+			Status: 200,
+		},
+	}
+
+	redactSnapshot(snap, []string{"*.secret"})
+
+	body := snap.Request.Body.(map[string]any)
+	if body["secret"] != redactedValue {
+		t.Errorf("expected top-level secret to be redacted, got %v", body["secret"])
+	}
+	nested := body["data"].(map[string]any)["nested"].(map[string]any)
+	if nested["secret"] != redactedValue {
+		t.Errorf("expected deeply nested secret to be redacted, got %v", nested["secret"])
+	}
+}
+
+func TestRedactSnapshot_OutgoingRequests(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method: "GET",
+			URL:    "/api/fetch",
+		},
+		Response: snapshot.Response{
+			Status: 200,
+		},
+		OutgoingRequests: []snapshot.OutgoingRequest{
+			{
+				Method:  "GET",
+				URL:     "/external/api",
+				Headers: map[string]string{"Authorization": "Bearer ext-token"},
+				Body:    map[string]any{"api_key": "key123"},
+				Response: &snapshot.Response{
+					Status: 200,
+					Body:   map[string]any{"api_key": "response-key"},
+				},
+			},
+		},
+	}
+
+	redactSnapshot(snap, []string{"*.api_key"})
+
+	outBody := snap.OutgoingRequests[0].Body.(map[string]any)
+	if outBody["api_key"] != redactedValue {
+		t.Errorf("expected outgoing request api_key to be redacted, got %v", outBody["api_key"])
+	}
+	respBody := snap.OutgoingRequests[0].Response.Body.(map[string]any)
+	if respBody["api_key"] != redactedValue {
+		t.Errorf("expected outgoing response api_key to be redacted, got %v", respBody["api_key"])
+	}
+}
+
+func TestRedactSnapshot_NoMatchDoesNothing(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method:  "GET",
+			URL:     "/api/users",
+			Headers: map[string]string{"Accept": "application/json"},
+			Body:    map[string]any{"name": "Alice"},
+		},
+		Response: snapshot.Response{
+			Status: 200,
+			Body:   map[string]any{"id": 1},
+		},
+	}
+
+	redactSnapshot(snap, []string{"request.headers.NonExistent", "response.body.nonexistent"})
+
+	// Nothing should change
+	if snap.Request.Headers["Accept"] != "application/json" {
+		t.Errorf("expected Accept header preserved, got %q", snap.Request.Headers["Accept"])
+	}
+	body := snap.Request.Body.(map[string]any)
+	if body["name"] != "Alice" {
+		t.Errorf("expected name preserved, got %v", body["name"])
+	}
+}
+
+func TestRedactSnapshot_HMACMode(t *testing.T) {
+	newSnap := func(email string) *snapshot.Snapshot {
+		return &snapshot.Snapshot{
+			Request: snapshot.Request{
+				Method:  "POST",
+				URL:     "/api/users",
+				Headers: map[string]string{"Authorization": "Bearer secret-token"},
+				Body:    map[string]any{"email": email, "age": float64(42)},
+			},
+			Response: snapshot.Response{Status: 201},
+		}
+	}
+
+	redactor := New(ModeHMAC, "test-key")
+	fields := []string{"request.body.email", "request.body.age", "request.headers.Authorization"}
+
+	a := newSnap("alice@example.com")
+	b := newSnap("alice@example.com")
+	c := newSnap("bob@example.com")
+	Snapshot(a, fields, redactor)
+	Snapshot(b, fields, redactor)
+	Snapshot(c, fields, redactor)
+
+	aBody := a.Request.Body.(map[string]any)
+	token, ok := aBody["email"].(string)
+	if !ok || !strings.HasPrefix(token, hmacTokenPrefix) {
+		t.Fatalf("expected hmac token, got %v", aBody["email"])
+	}
+	if strings.Contains(token, "alice") {
+		t.Errorf("expected raw value not to appear in token, got %q", token)
+	}
+	if b.Request.Body.(map[string]any)["email"] != token {
+		t.Errorf("expected equal inputs to produce equal tokens")
+	}
+	if c.Request.Body.(map[string]any)["email"] == token {
+		t.Errorf("expected different inputs to produce different tokens")
+	}
+	if age, ok := aBody["age"].(string); !ok || !strings.HasPrefix(age, hmacTokenPrefix) {
+		t.Errorf("expected numeric field to be pseudonymized, got %v", aBody["age"])
+	}
+	if !strings.HasPrefix(a.Request.Headers["Authorization"], hmacTokenPrefix) {
+		t.Errorf("expected header to be pseudonymized, got %q", a.Request.Headers["Authorization"])
+	}
+
+	other := newSnap("alice@example.com")
+	Snapshot(other, fields, New(ModeHMAC, "other-key"))
+	if other.Request.Body.(map[string]any)["email"] == token {
+		t.Errorf("expected different keys to produce different tokens")
+	}
+}
+
+func TestRedactSnapshot_ArrayWildcardPath(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{Method: "GET", URL: "/api/users"},
+		Response: snapshot.Response{
+			Status: 200,
+			Body: map[string]any{
+				"users": []any{
+					map[string]any{"name": "Alice", "email": "alice@example.com"},
+					map[string]any{"name": "Bob", "email": "bob@example.com"},
+				},
+			},
+		},
+	}
+
+	redactSnapshot(snap, []string{"response.body.users[*].email"})
+
+	users := snap.Response.Body.(map[string]any)["users"].([]any)
+	for i, u := range users {
+		user := u.(map[string]any)
+		if user["email"] != redactedValue {
+			t.Errorf("expected users[%d].email to be redacted, got %v", i, user["email"])
+		}
+		if user["name"] == redactedValue {
+			t.Errorf("expected users[%d].name to be preserved", i)
+		}
+	}
+}
+
+func TestRedactSnapshot_ArrayIndexPath(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method: "POST",
+			URL:    "/api/batch",
+			Body: []any{
+				map[string]any{"token": "first"},
+				map[string]any{"token": "second"},
+			},
+		},
+		Response: snapshot.Response{Status: 200},
+	}
+
+	redactSnapshot(snap, []string{"request.body[1].token"})
+
+	items := snap.Request.Body.([]any)
+	if items[0].(map[string]any)["token"] != "first" {
+		t.Errorf("expected item 0 to be preserved, got %v", items[0])
+	}
+	if items[1].(map[string]any)["token"] != redactedValue {
+		t.Errorf("expected item 1 token to be redacted, got %v", items[1])
+	}
+}
+
+func TestRedactSnapshot_WildcardInsideArrays(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{Method: "GET", URL: "/api/orders"},
+		Response: snapshot.Response{
+			Status: 200,
+			Body: map[string]any{
+				"orders": []any{
+					map[string]any{"id": float64(1), "card": map[string]any{"number": "4111"}},
+					[]any{map[string]any{"number": "5500"}},
+				},
+			},
+		},
+	}
+
+	redactSnapshot(snap, []string{"*.number"})
+
+	orders := snap.Response.Body.(map[string]any)["orders"].([]any)
+	card := orders[0].(map[string]any)["card"].(map[string]any)
+	if card["number"] != redactedValue {
+		t.Errorf("expected number inside array element to be redacted, got %v", card["number"])
+	}
+	nested := orders[1].([]any)[0].(map[string]any)
+	if nested["number"] != redactedValue {
+		t.Errorf("expected number inside nested array to be redacted, got %v", nested["number"])
+	}
+}
+
+func TestSplitRedactPath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"response.body.email", []string{"response", "body", "email"}},
+		{"response.body.users[*].email", []string{"response", "body", "users", "[*]", "email"}},
+		{"request.body[0].token", []string{"request", "body", "[0]", "token"}},
+		{"response.body.matrix[1][*]", []string{"response", "body", "matrix", "[1]", "[*]"}},
+	}
+	for _, tt := range tests {
+		got := splitRedactPath(tt.in)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("splitRedactPath(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactSnapshot_XMLBody(t *testing.T) {
+	raw := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<Login><user>alice</user><password>hunter2</password></Login></soap:Body></soap:Envelope>`
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method: "POST",
+			URL:    "/soap",
+			Body:   snapshot.ParseBody([]byte(raw), "text/xml"),
+		},
+		Response: snapshot.Response{
+			Status: 200,
+			Body:   snapshot.ParseBody([]byte(`<Result><token>abc</token></Result>`), "application/xml"),
+		},
+	}
+
+	redactSnapshot(snap, []string{
+		"request.body.data.soap:Envelope.soap:Body.Login.password",
+		"*.token",
+	})
+
+	login := snap.Request.Body.(*snapshot.EncodedBody).Data.(map[string]any)["soap:Envelope"].(map[string]any)["soap:Body"].(map[string]any)["Login"].(map[string]any)
+	if login["password"] != redactedValue {
+		t.Errorf("expected XML password to be redacted, got %v", login["password"])
+	}
+	if login["user"] != "alice" {
+		t.Errorf("expected user to be untouched, got %v", login["user"])
+	}
+	result := snap.Response.Body.(*snapshot.EncodedBody).Data.(map[string]any)["Result"].(map[string]any)
+	if result["token"] != redactedValue {
+		t.Errorf("expected XML token to be redacted, got %v", result["token"])
+	}
+}
+
+func TestRedactSnapshot_FormBody(t *testing.T) {
+	snap := &snapshot.Snapshot{
+		Request: snapshot.Request{
+			Method: "POST",
+			URL:    "/login",
+			Body:   snapshot.ParseBody([]byte("user=alice&password=hunter2"), "application/x-www-form-urlencoded"),
+		},
+	}
+
+	redactSnapshot(snap, []string{"*.password"})
+
+	form := snap.Request.Body.(*snapshot.EncodedBody).Data.(map[string]any)
+	if form["password"] != redactedValue {
+		t.Errorf("expected form password to be redacted, got %v", form["password"])
+	}
+	if form["user"] != "alice" {
+		t.Errorf("expected user to be untouched, got %v", form["user"])
+	}
+}
+
+func TestRedactSnapshot_Events(t *testing.T) {
+	newSnap := func() *snapshot.Snapshot {
+		return &snapshot.Snapshot{
+			Response: snapshot.Response{
+				Status: 200,
+				Events: []snapshot.Event{
+					{ID: "1", Data: map[string]any{"token": "t1", "user": "alice"}},
+					{ID: "2", Data: "session s3cr3t"},
+				},
+			},
+		}
+	}
+
+	snap := newSnap()
+	redactSnapshot(snap, []string{"*.token", "response.events[1].data"})
+	first := snap.Response.Events[0].Data.(map[string]any)
+	if first["token"] != redactedValue || first["user"] != "alice" {
+		t.Errorf("expected only token to be redacted, got %v", first)
+	}
+	if snap.Response.Events[1].Data != redactedValue {
+		t.Errorf("expected second event data to be redacted, got %v", snap.Response.Events[1].Data)
+	}
+
+	snap = newSnap()
+	redactSnapshot(snap, []string{"response.events[*].data.user"})
+	if first := snap.Response.Events[0].Data.(map[string]any); first["user"] != redactedValue || first["token"] != "t1" {
+		t.Errorf("expected only user to be redacted, got %v", first)
+	}
+}
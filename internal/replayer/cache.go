@@ -0,0 +1,209 @@
+package replayer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Cache remembers snapshots that passed cleanly, keyed by the snapshot file's
+// content hash, the service build fingerprint and the config hash. A snapshot
+// whose key is unchanged since it last passed can be skipped.
+type Cache struct {
+	path        string
+	fingerprint string
+	configHash  string
+
+	mu      sync.Mutex
+	entries map[string]CacheEntry // snapshot path -> last clean pass
+}
+
+// CacheEntry records the key a snapshot last passed with.
+type CacheEntry struct {
+	Key      string    `json:"key"`
+	PassedAt time.Time `json:"passed_at"`
+}
+
+// OpenCache loads the cache at path for the given service fingerprint. A
+// missing cache file starts an empty cache.
+func OpenCache(path, fingerprint string, cfg *config.Config) (*Cache, error) {
+	if fingerprint == "" {
+		return nil, errors.New("result caching requires a service build fingerprint")
+	}
+	configHash, err := ConfigHash(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{path: path, fingerprint: fingerprint, configHash: configHash, entries: make(map[string]CacheEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading replay cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("parsing replay cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Key returns the cache key for the snapshot file at path.
+func (c *Cache) Key(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("hashing snapshot: %w", err)
+	}
+	h := sha256.New()
+	h.Write(data)
+	// Separators keep the three parts from running into each other
+	h.Write([]byte{0})
+	h.Write([]byte(c.fingerprint))
+	h.Write([]byte{0})
+	h.Write([]byte(c.configHash))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Passed reports whether the snapshot at path last passed with key.
+func (c *Cache) Passed(path, key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	return ok && entry.Key == key
+}
+
+// Record stores a clean pass of the snapshot at path. Results that failed,
+// errored or produced warnings are forgotten so they run again.
+func (c *Cache) Record(path, key string, result TestResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if result.Passed && result.Error == "" && len(result.Diffs) == 0 {
+		c.entries[path] = CacheEntry{Key: key, PassedAt: time.Now().UTC()}
+	} else {
+		delete(c.entries, path)
+	}
+}
+
+// Save writes the cache back to disk.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("marshaling replay cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("creating replay cache directory: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0o644); err != nil {
+		return fmt.Errorf("writing replay cache: %w", err)
+	}
+	return nil
+}
+
+// ConfigHash returns a SHA-256 of the effective configuration, so any config
+// change invalidates cached results. How many snapshots are replayed at once
+// doesn't change their results and is left out.
+func ConfigHash(cfg *config.Config) (string, error) {
+	effective := *cfg
+	effective.Replay.Parallel = false
+	effective.Replay.Workers = 0
+	data, err := json.Marshal(&effective)
+	if err != nil {
+		return "", fmt.Errorf("hashing config: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Fingerprint returns the service build fingerprint by running
+// replay.fingerprint_command (e.g. "git rev-parse HEAD") and trimming its
+// output. It returns "" when no command is configured.
+func Fingerprint(cfg *config.Config) (string, error) {
+	command := cfg.Replay.FingerprintCommand
+	if command == "" {
+		return "", nil
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running fingerprint command %q: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	fingerprint := strings.TrimSpace(string(out))
+	if fingerprint == "" {
+		return "", fmt.Errorf("fingerprint command %q printed nothing", command)
+	}
+	return fingerprint, nil
+}
+
+// ReplayAllCached is like ReplayAll but skips snapshots that passed with the
+// same cache key before, returning a passing result marked Cached for them.
+// Snapshots linked by depends_on are always replayed, since their steps
+// build on each other's DB state. New clean passes are recorded in the
+// cache; call Save to persist them.
+func (r *Replayer) ReplayAllCached(snapshots []*snapshot.Snapshot, paths []string, cache *Cache) []TestResult {
+	results := make([]TestResult, len(snapshots))
+	keys := make([]string, len(snapshots))
+
+	chains, _ := planChains(snapshots)
+	chained := make(map[int]bool)
+	for _, c := range chains {
+		for _, i := range c.steps {
+			chained[i] = true
+		}
+	}
+
+	var runSnaps []*snapshot.Snapshot
+	var runPaths []string
+	var runIdx []int
+	for i, snap := range snapshots {
+		key, err := cache.Key(paths[i])
+		if err == nil && !chained[i] && cache.Passed(paths[i], key) {
+			results[i] = TestResult{
+				SnapshotID:   snap.ID,
+				SnapshotPath: paths[i],
+				Method:       snap.Request.Method,
+				URL:          snap.Request.URL,
+				Tags:         snap.Tags,
+				Passed:       true,
+				Cached:       true,
+			}
+			continue
+		}
+		keys[i] = key
+		runSnaps = append(runSnaps, snap)
+		runPaths = append(runPaths, paths[i])
+		runIdx = append(runIdx, i)
+	}
+
+	for j, result := range r.ReplayAll(runSnaps, runPaths) {
+		i := runIdx[j]
+		results[i] = result
+		if keys[i] != "" && !result.Skipped {
+			cache.Record(paths[i], keys[i], result)
+		}
+	}
+	return results
+}
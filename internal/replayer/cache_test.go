@@ -0,0 +1,190 @@
+package replayer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/asserter"
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func writeSnapshotFile(t *testing.T, dir, name string, snap *snapshot.Snapshot) string {
+	t.Helper()
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCache_KeyDependsOnContentFingerprintAndConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newTestConfig("http://localhost:8080")
+	path := writeSnapshotFile(t, dir, "a.snapshot.json", &snapshot.Snapshot{ID: "a"})
+
+	cache, err := OpenCache(filepath.Join(dir, "cache.json"), "build-1", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := cache.Key(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := OpenCache(filepath.Join(dir, "cache.json"), "build-2", cfg)
+	if k, _ := other.Key(path); k == key {
+		t.Error("expected a different fingerprint to change the key")
+	}
+
+	changed := newTestConfig("http://localhost:9090")
+	other, _ = OpenCache(filepath.Join(dir, "cache.json"), "build-1", changed)
+	if k, _ := other.Key(path); k == key {
+		t.Error("expected a config change to change the key")
+	}
+
+	parallel := newTestConfig("http://localhost:8080")
+	parallel.Replay.Parallel, parallel.Replay.Workers = true, 8
+	other, _ = OpenCache(filepath.Join(dir, "cache.json"), "build-1", parallel)
+	if k, _ := other.Key(path); k != key {
+		t.Error("expected the worker count not to change the key")
+	}
+
+	writeSnapshotFile(t, dir, "a.snapshot.json", &snapshot.Snapshot{ID: "a", Tags: []string{"edited"}})
+	if k, _ := cache.Key(path); k == key {
+		t.Error("expected a content change to change the key")
+	}
+}
+
+func TestCache_RecordOnlyCleanPasses(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "nested", "cache.json")
+	cache, err := OpenCache(cachePath, "build-1", newTestConfig("http://localhost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Record("clean", "k1", TestResult{Passed: true})
+	cache.Record("warned", "k2", TestResult{Passed: true, Diffs: []asserter.Diff{{Severity: asserter.SeverityWarning}}})
+	cache.Record("failed", "k3", TestResult{Passed: false})
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := OpenCache(cachePath, "build-1", newTestConfig("http://localhost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.Passed("clean", "k1") {
+		t.Error("expected clean pass to be cached")
+	}
+	if reloaded.Passed("clean", "other-key") {
+		t.Error("expected a different key to miss")
+	}
+	if reloaded.Passed("warned", "k2") || reloaded.Passed("failed", "k3") {
+		t.Error("expected only clean passes to be cached")
+	}
+
+	reloaded.Record("clean", "k1", TestResult{Error: "boom"})
+	if reloaded.Passed("clean", "k1") {
+		t.Error("expected an error to evict the cached pass")
+	}
+}
+
+func TestOpenCache_RequiresFingerprint(t *testing.T) {
+	if _, err := OpenCache(filepath.Join(t.TempDir(), "cache.json"), "", newTestConfig("http://localhost")); err == nil {
+		t.Error("expected error without a fingerprint")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	cfg := &config.Config{}
+	if fp, err := Fingerprint(cfg); err != nil || fp != "" {
+		t.Errorf("expected no fingerprint without a command, got %q %v", fp, err)
+	}
+
+	cfg.Replay.FingerprintCommand = "echo '  abc123  '"
+	if fp, err := Fingerprint(cfg); err != nil || fp != "abc123" {
+		t.Errorf("expected trimmed command output, got %q %v", fp, err)
+	}
+
+	cfg.Replay.FingerprintCommand = "true"
+	if _, err := Fingerprint(cfg); err == nil {
+		t.Error("expected error for empty output")
+	}
+
+	cfg.Replay.FingerprintCommand = "exit 3"
+	if _, err := Fingerprint(cfg); err == nil {
+		t.Error("expected error for failing command")
+	}
+}
+
+func TestReplayAllCached_SkipsUnchangedPasses(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := newTestConfig(server.URL)
+	r := &Replayer{config: cfg, snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}}}
+
+	passing := &snapshot.Snapshot{ID: "pass", Request: snapshot.Request{Method: "GET", URL: "/ok"},
+		Response: snapshot.Response{Status: 200, Body: map[string]any{"ok": true}}}
+	failing := &snapshot.Snapshot{ID: "fail", Request: snapshot.Request{Method: "GET", URL: "/ok"},
+		Response: snapshot.Response{Status: 201, Body: map[string]any{"ok": true}}}
+	snaps := []*snapshot.Snapshot{passing, failing}
+	paths := []string{
+		writeSnapshotFile(t, dir, "pass.snapshot.json", passing),
+		writeSnapshotFile(t, dir, "fail.snapshot.json", failing),
+	}
+
+	cachePath := filepath.Join(dir, "cache.json")
+	cache, err := OpenCache(cachePath, "build-1", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := r.ReplayAllCached(snaps, paths, cache)
+	if first[0].Cached || !first[0].Passed || first[1].Passed {
+		t.Fatalf("unexpected first run results: %+v", first)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err = OpenCache(cachePath, "build-1", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits.Store(0)
+	second := r.ReplayAllCached(snaps, paths, cache)
+	if !second[0].Cached || !second[0].Passed || second[0].SnapshotPath != paths[0] {
+		t.Errorf("expected passing snapshot to be served from cache, got %+v", second[0])
+	}
+	if second[1].Cached || second[1].Passed {
+		t.Errorf("expected failing snapshot to run again, got %+v", second[1])
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected only the failing snapshot to hit the service, got %d requests", hits.Load())
+	}
+
+	// A new service build invalidates everything
+	cache, _ = OpenCache(cachePath, "build-2", cfg)
+	hits.Store(0)
+	r.ReplayAllCached(snaps, paths, cache)
+	if hits.Load() != 2 {
+		t.Errorf("expected both snapshots to run for a new build, got %d requests", hits.Load())
+	}
+}
@@ -0,0 +1,169 @@
+package replayer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// chain is a group of snapshots linked by depends_on, replayed in order on
+// one DB state like the steps of a scenario.
+type chain struct {
+	steps []int  // indexes into the snapshots being replayed, in replay order
+	err   string // why the chain cannot be replayed; every step is reported with it
+}
+
+// planChains groups the snapshots that depend on others, or that others
+// depend on, into chains, ordered so every snapshot comes after its
+// dependencies and otherwise in recording order. The indexes of the
+// remaining snapshots are returned as rest. A chain whose dependencies are
+// missing or form a cycle is returned with err set.
+func planChains(snapshots []*snapshot.Snapshot) (chains []chain, rest []int) {
+	byID := make(map[string]int, len(snapshots))
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		byID[snapshots[i].ID] = i
+	}
+
+	// Union the snapshots linked by depends_on into groups
+	parent := make([]int, len(snapshots))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	linked := make([]bool, len(snapshots))
+	missing := make(map[int]string)
+	for i, snap := range snapshots {
+		for _, id := range snap.DependsOn {
+			linked[i] = true
+			j, ok := byID[id]
+			if !ok {
+				missing[i] = id
+				continue
+			}
+			linked[j] = true
+			parent[find(i)] = find(j)
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range snapshots {
+		if !linked[i] {
+			rest = append(rest, i)
+			continue
+		}
+		root := find(i)
+		if groups[root] == nil {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+	sort.Slice(roots, func(a, b int) bool { return groups[roots[a]][0] < groups[roots[b]][0] })
+
+	for _, root := range roots {
+		members := groups[root]
+		c := chain{steps: members}
+		for _, i := range members {
+			if id, ok := missing[i]; ok {
+				c.err = fmt.Sprintf("Snapshot %s depends on snapshot %s, which was not found", snapshots[i].ID, id)
+				break
+			}
+		}
+		if c.err == "" {
+			c.steps, c.err = orderChain(snapshots, members, byID)
+		}
+		chains = append(chains, c)
+	}
+	return chains, rest
+}
+
+// orderChain sorts the members of a chain so that every snapshot follows
+// the snapshots it depends on, taking the earliest recorded snapshot whose
+// dependencies have run at each step.
+func orderChain(snapshots []*snapshot.Snapshot, members []int, byID map[string]int) ([]int, string) {
+	pending := make(map[int]int, len(members)) // dependencies not yet ordered
+	dependents := make(map[int][]int)
+	for _, i := range members {
+		for _, id := range snapshots[i].DependsOn {
+			j := byID[id]
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	var ready, order []int
+	for _, i := range members {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Slice(ready, func(a, b int) bool {
+			ta, tb := snapshots[ready[a]].Timestamp, snapshots[ready[b]].Timestamp
+			if !ta.Equal(tb) {
+				return ta.Before(tb)
+			}
+			return ready[a] < ready[b]
+		})
+		i := ready[0]
+		ready = ready[1:]
+		order = append(order, i)
+		for _, d := range dependents[i] {
+			if pending[d]--; pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	if len(order) < len(members) {
+		var cycle []string
+		for _, i := range members {
+			if pending[i] > 0 {
+				cycle = append(cycle, snapshots[i].ID)
+			}
+		}
+		return members, fmt.Sprintf("Dependency cycle between snapshots %s", strings.Join(cycle, ", "))
+	}
+	return order, ""
+}
+
+// replayChains replays each chain with replaySteps, storing the results at
+// the chain's indexes. Chains that cannot be replayed are reported as errors
+// on every step.
+func (r *Replayer) replayChains(chains []chain, snapshots []*snapshot.Snapshot, paths []string, results []TestResult, stopped *atomic.Bool) {
+	for _, c := range chains {
+		snaps := make([]*snapshot.Snapshot, len(c.steps))
+		ps := make([]string, len(c.steps))
+		for k, i := range c.steps {
+			snaps[k], ps[k] = snapshots[i], paths[i]
+		}
+		if c.err != "" {
+			for k, snap := range snaps {
+				results[c.steps[k]] = TestResult{
+					SnapshotID:   snap.ID,
+					SnapshotPath: ps[k],
+					Method:       snap.Request.Method,
+					URL:          snap.Request.URL,
+					Tags:         snap.Tags,
+					Error:        c.err,
+				}
+			}
+			if r.config.Replay.FailFast {
+				stopped.Store(true)
+			}
+			continue
+		}
+		for k, result := range r.replaySteps(stopped, snaps, ps) {
+			results[c.steps[k]] = result
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package replayer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestReplayAll_DependsOn(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		order = append(order, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	state := func(name string) map[string][]map[string]any {
+		return map[string][]map[string]any{"items": {{"name": name}}}
+	}
+	snap := func(id string, before, after string, dependsOn ...string) *snapshot.Snapshot {
+		return &snapshot.Snapshot{
+			ID:            id,
+			DependsOn:     dependsOn,
+			DBStateBefore: state(before),
+			DBStateAfter:  state(after),
+			Request:       snapshot.Request{Method: "GET", URL: "/" + id},
+			Response:      snapshot.Response{Status: 204},
+		}
+	}
+	// update was recorded on the state create left, not its own recorded
+	// state before, so it only passes if that state is carried forward
+	snaps := []*snapshot.Snapshot{
+		snap("update", "stale", "created", "create"),
+		snap("other", "other", "other"),
+		snap("create", "created", "created"),
+		snap("orphan", "x", "x", "missing"),
+	}
+	paths := []string{"update.json", "other.json", "create.json", "orphan.json"}
+
+	r := &Replayer{
+		config:      newTestConfig(server.URL),
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+	}
+	results := r.ReplayAll(snaps, paths)
+
+	for _, i := range []int{0, 1, 2} {
+		if !results[i].Passed || results[i].Error != "" || results[i].SnapshotPath != paths[i] {
+			t.Errorf("expected %s to pass, got passed=%v error=%q diffs=%v", paths[i], results[i].Passed, results[i].Error, results[i].Diffs)
+		}
+	}
+	if !strings.Contains(results[3].Error, "depends on snapshot missing, which was not found") {
+		t.Errorf("expected a missing dependency error, got %q", results[3].Error)
+	}
+	if got := strings.Join(order, " "); got != "/create /update /other" {
+		t.Errorf("expected the chain first, in dependency order, got %s", got)
+	}
+}
+
+func TestPlanChains(t *testing.T) {
+	snap := func(id string, dependsOn ...string) *snapshot.Snapshot {
+		return &snapshot.Snapshot{ID: id, DependsOn: dependsOn}
+	}
+	snaps := []*snapshot.Snapshot{
+		snap("c", "b"),
+		snap("solo"),
+		snap("b", "a"),
+		snap("a"),
+		snap("x", "y"),
+		snap("y", "x"),
+		snap("d", "a"),
+	}
+
+	chains, rest := planChains(snaps)
+	if len(rest) != 1 || rest[0] != 1 {
+		t.Errorf("expected only solo outside chains, got %v", rest)
+	}
+	if len(chains) != 2 {
+		t.Fatalf("expected 2 chains, got %d", len(chains))
+	}
+	var ids []string
+	for _, i := range chains[0].steps {
+		ids = append(ids, snaps[i].ID)
+	}
+	if got := strings.Join(ids, " "); got != "a b c d" || chains[0].err != "" {
+		t.Errorf("expected a b c d, got %s (err %q)", got, chains[0].err)
+	}
+	if !strings.Contains(chains[1].err, "cycle between snapshots x, y") {
+		t.Errorf("expected a cycle error, got %q", chains[1].err)
+	}
+}
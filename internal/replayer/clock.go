@@ -0,0 +1,76 @@
+package replayer
+
+import (
+	"maps"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Clock value formats, set by replay.clock.format.
+const (
+	ClockFormatRFC3339 = "rfc3339" // 2024-01-02T03:04:05.123Z (default)
+	ClockFormatUnix    = "unix"    // seconds since the epoch
+	ClockFormatUnixMs  = "unix_ms" // milliseconds since the epoch
+)
+
+// clockValue returns the time snap was recorded at in replay.clock.format.
+func (r *Replayer) clockValue(snap *snapshot.Snapshot) string {
+	t := snap.Timestamp.UTC()
+	switch r.config.Replay.Clock.Format {
+	case ClockFormatUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case ClockFormatUnixMs:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	default:
+		return t.Format(time.RFC3339Nano)
+	}
+}
+
+// WithClockHeader returns snap with replay.clock.header added to its
+// request, set to the time it was recorded at. snap itself is not
+// modified. Snapshots without a recording time, such as imported ones,
+// are returned as they are.
+func (r *Replayer) WithClockHeader(snap *snapshot.Snapshot) *snapshot.Snapshot {
+	header := r.config.Replay.Clock.Header
+	if header == "" || snap.Timestamp.IsZero() {
+		return snap
+	}
+	pinned := *snap
+	pinned.Request.Headers = maps.Clone(snap.Request.Headers)
+	if pinned.Request.Headers == nil {
+		pinned.Request.Headers = make(map[string]string)
+	}
+	pinned.Request.Headers[header] = r.clockValue(snap)
+	return &pinned
+}
+
+// clockEnv returns the variables that start a managed service at the time
+// snap was recorded: replay.clock.env_var, and libfaketime's with
+// replay.clock.faketime. libfaketime is given an absolute time in the
+// service's local time zone, without the "@" that would start a running
+// clock there, so the service's clock stays frozen at the recorded time.
+func (r *Replayer) clockEnv(snap *snapshot.Snapshot) []string {
+	clock := r.config.Replay.Clock
+	if snap.Timestamp.IsZero() {
+		return nil
+	}
+	var env []string
+	if clock.EnvVar != "" {
+		env = append(env, clock.EnvVar+"="+r.clockValue(snap))
+	}
+	if clock.Faketime {
+		preload := "LD_PRELOAD"
+		if runtime.GOOS == "darwin" {
+			preload = "DYLD_INSERT_LIBRARIES"
+			env = append(env, "DYLD_FORCE_FLAT_NAMESPACE=1")
+		}
+		env = append(env,
+			preload+"="+clock.FaketimeLib,
+			"FAKETIME="+snap.Timestamp.Local().Format(time.DateTime),
+		)
+	}
+	return env
+}
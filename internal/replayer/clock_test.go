@@ -0,0 +1,89 @@
+package replayer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestReplayOne_ClockHeader(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-Fake-Now")
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	recorded := time.Date(2024, 3, 1, 12, 30, 0, 500_000_000, time.UTC)
+	tests := []struct {
+		format    string
+		timestamp time.Time
+		want      string
+	}{
+		{"", recorded, "2024-03-01T12:30:00.5Z"},
+		{ClockFormatUnix, recorded, "1709296200"},
+		{ClockFormatUnixMs, recorded, "1709296200500"},
+		{"", time.Time{}, ""}, // imported snapshots have no recording time
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+tt.want, func(t *testing.T) {
+			cfg := newTestConfig(server.URL)
+			cfg.Replay.Clock.Header = "X-Fake-Now"
+			cfg.Replay.Clock.Format = tt.format
+			r := &Replayer{config: cfg, snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}}}
+
+			snap := &snapshot.Snapshot{
+				ID:        "c1",
+				Timestamp: tt.timestamp,
+				Request:   snapshot.Request{Method: "GET", URL: "/now"},
+				Response:  snapshot.Response{Status: 204},
+			}
+			got = ""
+			if result := r.ReplayOne(snap, "c1.json"); !result.Passed {
+				t.Fatalf("expected a pass, got error %q diffs %v", result.Error, result.Diffs)
+			}
+			if got != tt.want {
+				t.Errorf("expected X-Fake-Now %q, got %q", tt.want, got)
+			}
+			if snap.Request.Headers != nil {
+				t.Errorf("expected the snapshot unchanged, got headers %v", snap.Request.Headers)
+			}
+		})
+	}
+}
+
+func TestReplayOne_ClockEnv(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	env := filepath.Join(t.TempDir(), "env.log")
+	cfg := newTestConfig(server.URL)
+	cfg.Service.Command = `echo "$FAKE_NOW|$LD_PRELOAD$DYLD_INSERT_LIBRARIES|$FAKETIME" > ` + env + `; exec sleep 10`
+	cfg.Service.StartupTimeMs = 10
+	cfg.Replay.Clock = config.ClockConfig{EnvVar: "FAKE_NOW", Format: ClockFormatUnix, Faketime: true, FaketimeLib: "/opt/libfaketime.so"}
+	r := &Replayer{config: cfg, snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}}}
+
+	recorded := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	snap := &snapshot.Snapshot{ID: "c1", Timestamp: recorded, Request: snapshot.Request{Method: "GET", URL: "/now"}, Response: snapshot.Response{Status: 204}}
+	if result := r.ReplayOne(snap, "c1.json"); !result.Passed {
+		t.Fatalf("expected a pass, got error %q diffs %v", result.Error, result.Diffs)
+	}
+
+	data, err := os.ReadFile(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1709296200|/opt/libfaketime.so|" + recorded.Local().Format(time.DateTime)
+	if got := strings.TrimSpace(string(data)); got != want {
+		t.Errorf("expected the service environment %q, got %q", want, got)
+	}
+}
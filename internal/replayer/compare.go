@@ -0,0 +1,129 @@
+package replayer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/asserter"
+	"github.com/esse/snapshot-tester/internal/httpclient"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// CompareAll fires the request of every snapshot at both service.base_url
+// and compareURL and compares the two live responses with each other, with
+// the response from service.base_url as the expected one. The recorded
+// response is not used. Both environments are live deployments, so no DB
+// state is restored, no mock server or service is started and no hooks run.
+// Parallel replay and fail-fast apply as in ReplayAll.
+func (r *Replayer) CompareAll(snapshots []*snapshot.Snapshot, paths []string, compareURL string) []TestResult {
+	results := make([]TestResult, len(snapshots))
+	var stopped atomic.Bool
+	compare := func(i int) {
+		results[i] = r.runOrSkip(&stopped, snapshots[i], paths[i], func() TestResult {
+			return r.compareOne(snapshots[i], paths[i], compareURL)
+		})
+	}
+
+	if r.config.Replay.Parallel && len(snapshots) > 1 {
+		runPool(r.workerCount(len(snapshots)), len(snapshots), func(_, i int) { compare(i) })
+	} else {
+		for i := range snapshots {
+			compare(i)
+		}
+	}
+	return r.markQuarantined(results)
+}
+
+// compareOne fires snap's request at both environments and diffs the
+// responses. ActualResponse is the response from compareURL.
+func (r *Replayer) compareOne(snap *snapshot.Snapshot, path, compareURL string) TestResult {
+	start := time.Now()
+	result := TestResult{
+		SnapshotID:   snap.ID,
+		SnapshotPath: path,
+		Method:       snap.Request.Method,
+		URL:          snap.Request.URL,
+		Tags:         snap.Tags,
+	}
+
+	snap, err := r.withBodies(snap)
+	if err != nil {
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+	snap, err = snapshot.SubstituteVariables(snap, r.config.Replay.Variables)
+	if err != nil {
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	base, baseMessages, err := r.fireAt(r.config.Service.BaseURL, snap)
+	if err != nil {
+		result.Error = fmt.Sprintf("Failed to send request to %s: %v", r.config.Service.BaseURL, err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	fired := time.Now()
+	compared, comparedMessages, err := r.fireAt(compareURL, snap)
+	result.Latency = time.Since(fired)
+	if err != nil {
+		result.Error = fmt.Sprintf("Failed to send request to %s: %v", compareURL, err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.ActualResponse = compared
+	result.ActualMessages = comparedMessages
+	result.Diffs = r.diffResponses(snap, base, baseMessages, compared, comparedMessages)
+	result.Passed = !asserter.HasFailures(result.Diffs)
+	result.Duration = time.Since(start)
+	return result
+}
+
+// fireAt sends snap's request, or replays its WebSocket conversation, to
+// the deployment at baseURL. The response is redacted as recorded.
+func (r *Replayer) fireAt(baseURL string, snap *snapshot.Snapshot) (*snapshot.Response, []snapshot.Message, error) {
+	var resp *snapshot.Response
+	var messages []snapshot.Message
+	var err error
+	if isWebSocket(snap) {
+		resp, messages, err = httpclient.FireWebSocketWith(baseURL, snap.Request, snap.WebSocket, r.timeoutMs(snap), httpclient.Options{TLS: r.serviceTLS})
+	} else {
+		resp, err = r.fireRequestTo(baseURL, snap)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	takeQueries(resp)
+	r.RedactActual(resp)
+	return resp, messages, nil
+}
+
+// diffResponses compares the response of the compared environment with
+// that of the base one, the same way replay compares it with a snapshot.
+func (r *Replayer) diffResponses(snap *snapshot.Snapshot, base *snapshot.Response, baseMessages []snapshot.Message, compared *snapshot.Response, comparedMessages []snapshot.Message) []asserter.Diff {
+	opts := r.assertOptions(snap)
+	diffs := asserter.AssertResponse(map[string]any{
+		"status":       base.Status,
+		"content_type": snapshot.NormalizeContentType(base.Headers[snapshot.HeaderContentType]),
+		"body":         base.Body,
+	}, map[string]any{
+		"status":       compared.Status,
+		"content_type": snapshot.NormalizeContentType(compared.Headers[snapshot.HeaderContentType]),
+		"body":         compared.Body,
+	}, opts)
+	if isWebSocket(snap) {
+		diffs = append(diffs, asserter.AssertWebSocket(baseMessages, comparedMessages, opts)...)
+	}
+	if len(base.Trailers) > 0 || len(compared.Trailers) > 0 {
+		diffs = append(diffs, asserter.AssertTrailers(base.Trailers, compared.Trailers, opts)...)
+	}
+	if len(base.Events) > 0 || len(compared.Events) > 0 {
+		diffs = append(diffs, asserter.AssertEvents(base.Events, compared.Events, opts)...)
+	}
+	asserter.MarkWarnOnly(diffs, opts)
+	return diffs
+}
@@ -0,0 +1,75 @@
+package replayer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestCompareAll(t *testing.T) {
+	serve := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"id": float64(1), "version": version})
+		}))
+	}
+	staging := serve("v1")
+	defer staging.Close()
+	canary := serve("v2")
+	defer canary.Close()
+
+	snap := &snapshot.Snapshot{
+		ID:      "c1",
+		Request: snapshot.Request{Method: "GET", URL: "/api/users/1"},
+		// The recorded response is not compared
+		Response: snapshot.Response{Status: 404},
+	}
+
+	tests := []struct {
+		name         string
+		compareURL   string
+		ignoreFields []string
+		wantPassed   bool
+		wantDiff     string
+		wantError    string
+	}{
+		{"same environment", staging.URL, nil, true, "", ""},
+		{"different response", canary.URL, nil, false, "response.body.version", ""},
+		{"ignored difference", canary.URL, []string{"response.body.version"}, true, "", ""},
+		{"unreachable", "http://127.0.0.1:1", nil, false, "", "Failed to send request to http://127.0.0.1:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(staging.URL)
+			cfg.Replay.TimeoutMs = 1000
+			cfg.Replay.IgnoreFields = tt.ignoreFields
+			r := &Replayer{config: cfg}
+
+			results := r.CompareAll([]*snapshot.Snapshot{snap}, []string{"c1.json"}, tt.compareURL)
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(results))
+			}
+			result := results[0]
+
+			if !strings.HasPrefix(result.Error, tt.wantError) || (tt.wantError == "") != (result.Error == "") {
+				t.Errorf("expected error %q, got %q", tt.wantError, result.Error)
+			}
+			if tt.wantError != "" {
+				return
+			}
+			if result.Passed != tt.wantPassed {
+				t.Errorf("expected passed=%v, got diffs: %v", tt.wantPassed, result.Diffs)
+			}
+			if tt.wantDiff != "" && (len(result.Diffs) != 1 || result.Diffs[0].Path != tt.wantDiff) {
+				t.Errorf("expected one diff at %s, got %v", tt.wantDiff, result.Diffs)
+			}
+			if result.ActualResponse == nil || result.ActualResponse.Status != 200 {
+				t.Errorf("expected the compared response as the actual one, got %+v", result.ActualResponse)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package replayer
+
+import (
+	"fmt"
+
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+// CheckExitPolicy reports whether results stay within policy, returning an
+// error naming the first limit exceeded. Quarantined snapshots are not
+// counted, nor are skipped ones, as config validation keeps exit policies
+// and fail-fast apart.
+func CheckExitPolicy(policy config.ExitPolicyConfig, results []TestResult) error {
+	replayed, failed, errored := 0, 0, 0
+	for _, r := range results {
+		if r.Skipped {
+			continue
+		}
+		replayed++
+		switch {
+		case r.Quarantined:
+		case r.Error != "":
+			errored++
+		case !r.Passed:
+			failed++
+		}
+	}
+
+	if err := checkLimits("failed", failed, replayed, policy.MaxFailures, policy.MaxFailureRate); err != nil {
+		return err
+	}
+	return checkLimits("errored", errored, replayed, policy.MaxErrors, policy.MaxErrorRate)
+}
+
+// checkLimits checks that count of total snapshots stays within maxCount
+// and maxRate, or is zero when neither is set.
+func checkLimits(what string, count, total int, maxCount *int, maxRate *float64) error {
+	if count == 0 {
+		return nil
+	}
+	if maxCount == nil && maxRate == nil {
+		return fmt.Errorf("%d snapshot(s) %s", count, what)
+	}
+	if maxCount != nil && count > *maxCount {
+		return fmt.Errorf("%d snapshot(s) %s, more than the %d tolerated", count, what, *maxCount)
+	}
+	if rate := float64(count) / float64(total); maxRate != nil && rate > *maxRate {
+		return fmt.Errorf("%.1f%% of snapshots %s (%d of %d), more than the %.1f%% tolerated", rate*100, what, count, total, *maxRate*100)
+	}
+	return nil
+}
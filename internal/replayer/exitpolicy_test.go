@@ -0,0 +1,56 @@
+package replayer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+func TestCheckExitPolicy(t *testing.T) {
+	intp := func(n int) *int { return &n }
+	ratep := func(f float64) *float64 { return &f }
+
+	// 10 replayed snapshots: 6 pass, 2 fail, 1 errors, 1 quarantined
+	// failure, plus one skipped by fail-fast
+	results := []TestResult{
+		{Passed: true}, {Passed: true}, {Passed: true}, {Passed: true}, {Passed: true}, {Passed: true},
+		{Passed: false}, {Passed: false},
+		{Error: "connection refused"},
+		{Passed: false, Quarantined: true},
+		{Skipped: true},
+	}
+
+	tests := []struct {
+		name    string
+		policy  config.ExitPolicyConfig
+		wantErr string
+	}{
+		{"no limits", config.ExitPolicyConfig{}, "2 snapshot(s) failed"},
+		{"failures within count", config.ExitPolicyConfig{MaxFailures: intp(2), MaxErrors: intp(1)}, ""},
+		{"failures over count", config.ExitPolicyConfig{MaxFailures: intp(1), MaxErrors: intp(1)}, "2 snapshot(s) failed, more than the 1 tolerated"},
+		{"failures within rate", config.ExitPolicyConfig{MaxFailureRate: ratep(0.2), MaxErrors: intp(1)}, ""},
+		{"failures over rate", config.ExitPolicyConfig{MaxFailureRate: ratep(0.1), MaxErrors: intp(1)}, "20.0% of snapshots failed (2 of 10)"},
+		{"count and rate both apply", config.ExitPolicyConfig{MaxFailures: intp(5), MaxFailureRate: ratep(0.1), MaxErrors: intp(1)}, "20.0% of snapshots failed"},
+		{"errors counted separately", config.ExitPolicyConfig{MaxFailures: intp(2)}, "1 snapshot(s) errored"},
+		{"errors over count", config.ExitPolicyConfig{MaxFailures: intp(2), MaxErrors: intp(0)}, "1 snapshot(s) errored, more than the 0 tolerated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckExitPolicy(tt.policy, results)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if err := CheckExitPolicy(config.ExitPolicyConfig{}, results[:6]); err != nil {
+		t.Errorf("expected passing results to pass, got %v", err)
+	}
+}
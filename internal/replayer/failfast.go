@@ -0,0 +1,35 @@
+package replayer
+
+import (
+	"sync/atomic"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// replayOrSkip replays snap unless stopped is set, in which case it returns
+// a result marked Skipped. With replay.fail_fast, a result that failed or
+// errored sets stopped, unless it is quarantined, so snapshots that have
+// not started yet are skipped; those already running on other workers still
+// finish.
+func (r *Replayer) replayOrSkip(stopped *atomic.Bool, snap *snapshot.Snapshot, path string) TestResult {
+	return r.runOrSkip(stopped, snap, path, func() TestResult { return r.ReplayOne(snap, path) })
+}
+
+// runOrSkip is replayOrSkip with run in place of ReplayOne.
+func (r *Replayer) runOrSkip(stopped *atomic.Bool, snap *snapshot.Snapshot, path string, run func() TestResult) TestResult {
+	if stopped.Load() {
+		return TestResult{
+			SnapshotID:   snap.ID,
+			SnapshotPath: path,
+			Method:       snap.Request.Method,
+			URL:          snap.Request.URL,
+			Tags:         snap.Tags,
+			Skipped:      true,
+		}
+	}
+	result := run()
+	if r.config.Replay.FailFast && (!result.Passed || result.Error != "") && !r.quarantine.Has(snap.ID) {
+		stopped.Store(true)
+	}
+	return result
+}
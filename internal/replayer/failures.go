@@ -0,0 +1,89 @@
+package replayer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/mock"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Files written for each failed snapshot by WriteFailures.
+const (
+	FailureResponseFile  = "response.json"
+	FailureDBStateFile   = "db_state.json"
+	FailureMockCallsFile = "mock_calls.json"
+)
+
+// WriteFailures dumps the actual response, DB state and mock call log of every
+// failed or errored result under dir. Each snapshot gets its own directory that
+// mirrors its location under snapshotDir, e.g.
+// dir/users-service/GET_users/001_<id>/response.json. Returns the number of
+// failures written.
+func WriteFailures(dir, snapshotDir string, results []TestResult) (int, error) {
+	written := 0
+	for _, r := range results {
+		if (r.Passed && r.Error == "") || r.Skipped {
+			continue
+		}
+		target := filepath.Join(dir, failureDirName(snapshotDir, r.SnapshotPath))
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return written, fmt.Errorf("creating failure directory: %w", err)
+		}
+
+		files := []struct {
+			name  string
+			value any
+		}{
+			{FailureResponseFile, r.ActualResponse},
+			{FailureDBStateFile, r.ActualDBState},
+			{FailureMockCallsFile, r.MockCalls},
+		}
+		for _, f := range files {
+			// Skip artifacts that were never captured, e.g. when the request failed
+			if isNilArtifact(f.value) {
+				continue
+			}
+			data, err := json.MarshalIndent(f.value, "", "  ")
+			if err != nil {
+				return written, fmt.Errorf("marshaling %s for %s: %w", f.name, r.SnapshotPath, err)
+			}
+			if err := os.WriteFile(filepath.Join(target, f.name), data, 0o644); err != nil {
+				return written, fmt.Errorf("writing %s: %w", f.name, err)
+			}
+		}
+		written++
+	}
+	return written, nil
+}
+
+// failureDirName returns the snapshot path relative to snapshotDir with the
+// ".snapshot.<ext>" suffix removed. Paths outside snapshotDir fall back to
+// the file name alone so nothing is ever written outside the failures dir.
+func failureDirName(snapshotDir, snapshotPath string) string {
+	rel, err := filepath.Rel(snapshotDir, snapshotPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(snapshotPath)
+	}
+	if i := strings.LastIndex(rel, ".snapshot."); i >= 0 {
+		rel = rel[:i]
+	}
+	return rel
+}
+
+func isNilArtifact(v any) bool {
+	switch a := v.(type) {
+	case nil:
+		return true
+	case *snapshot.Response:
+		return a == nil
+	case map[string][]map[string]any:
+		return a == nil
+	case []mock.RecordedCall:
+		return a == nil
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package replayer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestWriteFailures(t *testing.T) {
+	snapDir := filepath.Join(t.TempDir(), "snapshots")
+	outDir := t.TempDir()
+
+	results := []TestResult{
+		{
+			SnapshotPath: filepath.Join(snapDir, "svc", "GET_users", "001_abc.snapshot.json"),
+			Passed:       true,
+		},
+		{
+			SnapshotPath:   filepath.Join(snapDir, "svc", "POST_users", "001_def.snapshot.json"),
+			ActualResponse: &snapshot.Response{Status: 500},
+			ActualDBState:  map[string][]map[string]any{"users": {}},
+		},
+		{
+			SnapshotPath: filepath.Join(snapDir, "svc", "DELETE_users", "001_ghi.snapshot.yaml"),
+			Error:        "connection refused",
+		},
+	}
+
+	n, err := WriteFailures(outDir, snapDir, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 failures written, got %d", n)
+	}
+
+	failed := filepath.Join(outDir, "svc", "POST_users", "001_def")
+	for _, name := range []string{FailureResponseFile, FailureDBStateFile} {
+		if _, err := os.Stat(filepath.Join(failed, name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(failed, FailureMockCallsFile)); !os.IsNotExist(err) {
+		t.Error("expected no mock call log when no calls were captured")
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "svc", "GET_users")); !os.IsNotExist(err) {
+		t.Error("expected passing snapshots to be skipped")
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "svc", "DELETE_users", "001_ghi")); err != nil {
+		t.Errorf("expected directory for errored snapshot: %v", err)
+	}
+}
+
+func TestFailureDirName_OutsideSnapshotDir(t *testing.T) {
+	got := failureDirName("/data/snapshots", "/elsewhere/001_x.snapshot.json")
+	if got != "001_x" {
+		t.Errorf("expected base name fallback, got %q", got)
+	}
+}
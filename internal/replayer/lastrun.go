@@ -0,0 +1,92 @@
+package replayer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LastRun lists the snapshots that did not pass in the previous replay run,
+// so `replay --failed` can run just those again.
+type LastRun struct {
+	FinishedAt time.Time `json:"finished_at"`
+	Total      int       `json:"total"`  // snapshots replayed by the last run of the whole suite
+	Failed     []string  `json:"failed"` // paths of the snapshots that failed, errored or were skipped by fail-fast
+}
+
+// SaveLastRun writes the outcome of a run of the whole suite to path,
+// replacing the previous run's.
+func SaveLastRun(path string, results []TestResult) error {
+	run := LastRun{FinishedAt: time.Now().UTC(), Total: len(results), Failed: lastRunFailures(results)}
+	return writeLastRun(path, &run)
+}
+
+// MergeLastRun updates the outcome recorded in path with a run of some of
+// the snapshots: those of them that failed before and now pass are dropped,
+// new failures are added, and the failures of snapshots the run didn't
+// replay are kept. Without a recorded run it writes one as SaveLastRun does.
+func MergeLastRun(path string, results []TestResult) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return SaveLastRun(path, results)
+	}
+	run, err := LoadLastRun(path)
+	if err != nil {
+		return err
+	}
+	replayed := make(map[string]bool, len(results))
+	for _, r := range results {
+		replayed[r.SnapshotPath] = true
+	}
+	failed := []string{}
+	for _, p := range run.Failed {
+		if !replayed[p] {
+			failed = append(failed, p)
+		}
+	}
+	run.Failed = append(failed, lastRunFailures(results)...)
+	run.FinishedAt = time.Now().UTC()
+	return writeLastRun(path, run)
+}
+
+func lastRunFailures(results []TestResult) []string {
+	failed := []string{}
+	for _, r := range results {
+		if r.Skipped || !r.Passed || r.Error != "" {
+			failed = append(failed, r.SnapshotPath)
+		}
+	}
+	return failed
+}
+
+func writeLastRun(path string, run *LastRun) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling last run: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating last run directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing last run: %w", err)
+	}
+	return nil
+}
+
+// LoadLastRun reads the outcome of the previous replay run from path.
+func LoadLastRun(path string) (*LastRun, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no previous replay run recorded in %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading last run: %w", err)
+	}
+	var run LastRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("parsing last run %s: %w", path, err)
+	}
+	return &run, nil
+}
@@ -0,0 +1,80 @@
+package replayer
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLastRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", ".last-run.json")
+
+	if _, err := LoadLastRun(path); err == nil || !strings.Contains(err.Error(), "no previous replay run") {
+		t.Errorf("expected a missing run error, got %v", err)
+	}
+
+	results := []TestResult{
+		{SnapshotPath: "a.json", Passed: true},
+		{SnapshotPath: "b.json"},
+		{SnapshotPath: "c.json", Passed: true, Error: "Failed to send request"},
+		{SnapshotPath: "d.json", Skipped: true},
+	}
+	if err := SaveLastRun(path, results); err != nil {
+		t.Fatal(err)
+	}
+	run, err := LoadLastRun(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b.json", "c.json", "d.json"}; !slices.Equal(run.Failed, want) {
+		t.Errorf("expected failed %v, got %v", want, run.Failed)
+	}
+	if run.Total != 4 || run.FinishedAt.IsZero() {
+		t.Errorf("unexpected run %+v", run)
+	}
+
+	// A clean run leaves nothing to re-run
+	if err := SaveLastRun(path, results[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if run, err = LoadLastRun(path); err != nil || len(run.Failed) != 0 {
+		t.Errorf("expected no failures, got %+v (err %v)", run, err)
+	}
+}
+
+func TestMergeLastRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".last-run.json")
+
+	// Without a recorded run, a partial run is recorded as is
+	if err := MergeLastRun(path, []TestResult{{SnapshotPath: "a.json"}}); err != nil {
+		t.Fatal(err)
+	}
+	if run, err := LoadLastRun(path); err != nil || !slices.Equal(run.Failed, []string{"a.json"}) {
+		t.Errorf("expected the partial run's failures, got %+v (err %v)", run, err)
+	}
+	if err := SaveLastRun(path, []TestResult{
+		{SnapshotPath: "a.json"},
+		{SnapshotPath: "b.json"},
+		{SnapshotPath: "c.json", Passed: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MergeLastRun(path, []TestResult{
+		{SnapshotPath: "a.json", Passed: true},
+		{SnapshotPath: "c.json", Passed: true, Error: "Failed to send request"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	run, err := LoadLastRun(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b.json", "c.json"}; !slices.Equal(run.Failed, want) {
+		t.Errorf("expected failed %v, got %v", want, run.Failed)
+	}
+	if run.Total != 3 {
+		t.Errorf("expected the suite's total to be kept, got %d", run.Total)
+	}
+}
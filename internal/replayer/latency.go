@@ -0,0 +1,53 @@
+package replayer
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/asserter"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// latencyOptions returns the latency thresholds for the endpoint of req:
+// those of the first replay.latency.endpoints rule matching it, with the
+// thresholds the rule leaves out taken from replay.latency.
+func (r *Replayer) latencyOptions(req snapshot.Request) asserter.LatencyOptions {
+	latency := r.config.Replay.Latency
+	opts := asserter.LatencyOptions{
+		Tolerance: latency.Tolerance,
+		MinDelta:  time.Duration(latency.MinDeltaMs) * time.Millisecond,
+		MaxDelta:  time.Duration(latency.MaxDeltaMs) * time.Millisecond,
+		Fail:      latency.Fail,
+	}
+	if len(latency.Endpoints) == 0 {
+		return opts
+	}
+
+	urlPath := req.URL
+	if u, err := url.Parse(req.URL); err == nil {
+		urlPath = u.Path
+	}
+	for _, rule := range latency.Endpoints {
+		if rule.Method != "" && !strings.EqualFold(rule.Method, req.Method) {
+			continue
+		}
+		if !snapshot.MatchPath(rule.Path, urlPath) {
+			continue
+		}
+		if rule.Tolerance != nil {
+			opts.Tolerance = *rule.Tolerance
+		}
+		if rule.MinDeltaMs != nil {
+			opts.MinDelta = time.Duration(*rule.MinDeltaMs) * time.Millisecond
+		}
+		if rule.MaxDeltaMs != nil {
+			opts.MaxDelta = time.Duration(*rule.MaxDeltaMs) * time.Millisecond
+		}
+		if rule.Fail != nil {
+			opts.Fail = *rule.Fail
+		}
+		break
+	}
+	return opts
+}
@@ -0,0 +1,39 @@
+package replayer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/asserter"
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestLatencyOptions(t *testing.T) {
+	tolerance, maxDelta, fail := 2.0, int64(1000), true
+	cfg := newTestConfig("http://localhost")
+	cfg.Replay.Latency = config.LatencyConfig{
+		Tolerance:  0.5,
+		MinDeltaMs: 20,
+		Endpoints: []config.LatencyRule{
+			{Method: "POST", Path: "/reports/*", Tolerance: &tolerance, MaxDeltaMs: &maxDelta},
+			{Path: "/reports/*", Fail: &fail},
+		},
+	}
+	r := &Replayer{config: cfg}
+
+	tests := []struct {
+		name string
+		req  snapshot.Request
+		want asserter.LatencyOptions
+	}{
+		{"no rule", snapshot.Request{Method: "GET", URL: "/users"}, asserter.LatencyOptions{Tolerance: 0.5, MinDelta: 20 * time.Millisecond}},
+		{"first rule", snapshot.Request{Method: "post", URL: "/reports/monthly?year=2026"}, asserter.LatencyOptions{Tolerance: 2, MinDelta: 20 * time.Millisecond, MaxDelta: time.Second}},
+		{"second rule", snapshot.Request{Method: "GET", URL: "/reports/monthly"}, asserter.LatencyOptions{Tolerance: 0.5, MinDelta: 20 * time.Millisecond, Fail: true}},
+	}
+	for _, tt := range tests {
+		if got := r.latencyOptions(tt.req); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package replayer
+
+import (
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func (r *Replayer) timeoutMs(snap *snapshot.Snapshot) int {
+	return TimeoutMs(r.config, snap)
+}
+
+// TimeoutMs returns the request timeout for snap: its own replay.timeout_ms
+// if it sets one, otherwise the configured one.
+func TimeoutMs(cfg *config.Config, snap *snapshot.Snapshot) int {
+	if snap.Replay != nil && snap.Replay.TimeoutMs > 0 {
+		return snap.Replay.TimeoutMs
+	}
+	return cfg.Replay.TimeoutMs
+}
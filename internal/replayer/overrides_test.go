@@ -0,0 +1,164 @@
+package replayer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestReplayOne_SnapshotOverrides(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/flaky":
+			if requests.Add(1) <= 3 {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": float64(1), "generated_at": "now"})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		url       string
+		options   *snapshot.ReplayOptions
+		wantError string
+		wantDiffs int
+	}{
+		{"config timeout", "/slow", nil, "Failed to send request", 0},
+		{"snapshot timeout", "/slow", &snapshot.ReplayOptions{TimeoutMs: 2000, IgnoreFields: []string{"response.body.generated_at"}}, "", 0},
+		{"config ignore fields", "/fast", nil, "", 1},
+		{"snapshot ignore fields", "/fast", &snapshot.ReplayOptions{IgnoreFields: []string{"*.generated_at"}}, "", 0},
+		{"snapshot retry attempts", "/flaky", &snapshot.ReplayOptions{RetryAttempts: 4, IgnoreFields: []string{"*.generated_at"}}, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(server.URL)
+			cfg.Replay.TimeoutMs = 50
+			cfg.Replay.Retry.DelayMs = 1
+			r := &Replayer{
+				config:      cfg,
+				snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+			}
+
+			result := r.ReplayOne(&snapshot.Snapshot{
+				ID:      "o1",
+				Request: snapshot.Request{Method: "GET", URL: tt.url},
+				Response: snapshot.Response{
+					Status:  200,
+					Headers: map[string]string{"Content-Type": "application/json"},
+					Body:    map[string]any{"id": float64(1), "generated_at": "then"},
+				},
+				Replay: tt.options,
+			}, "o1.json")
+
+			if !strings.HasPrefix(result.Error, tt.wantError) || (tt.wantError == "") != (result.Error == "") {
+				t.Fatalf("expected error %q, got %q", tt.wantError, result.Error)
+			}
+			if tt.wantError == "" && len(result.Diffs) != tt.wantDiffs {
+				t.Errorf("expected %d diffs, got %v", tt.wantDiffs, result.Diffs)
+			}
+		})
+	}
+}
+
+func TestReplayOne_Variables(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"path": r.URL.Path, "tenant": r.Header.Get("X-Tenant")})
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.Replay.Variables = map[string]any{"tenant": "acme"}
+	snapshotter := &mockSnapshotter{state: map[string][]map[string]any{}}
+	r := &Replayer{config: cfg, snapshotter: snapshotter}
+
+	snap := &snapshot.Snapshot{
+		ID:      "v1",
+		Request: snapshot.Request{Method: "GET", URL: "/tenants/{{tenant}}", Headers: map[string]string{"X-Tenant": "{{tenant}}"}},
+		Response: snapshot.Response{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    map[string]any{"path": "/tenants/{{tenant}}", "tenant": "{{tenant}}"},
+		},
+		DBStateBefore: map[string][]map[string]any{"tenants": {{"name": "{{tenant}}"}}},
+		DBStateAfter:  map[string][]map[string]any{"tenants": {{"name": "{{tenant}}"}}},
+	}
+	result := r.ReplayOne(snap, "v1.json")
+	if !result.Passed || result.Error != "" {
+		t.Fatalf("expected the substituted snapshot to pass, got error %q, diffs %v", result.Error, result.Diffs)
+	}
+	if name := snapshotter.state["tenants"][0]["name"]; name != "acme" {
+		t.Errorf("expected the substituted DB state restored, got %v", name)
+	}
+	if result.URL != "/tenants/{{tenant}}" {
+		t.Errorf("expected the result to name the recorded URL, got %q", result.URL)
+	}
+}
+
+func TestReplayOne_WarnOnly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": float64(1), "generated_at": "now"})
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.Replay.WarnOnly = []string{"db.audit_log"}
+	r := &Replayer{
+		config:      cfg,
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+	}
+	snap := &snapshot.Snapshot{
+		ID:      "w1",
+		Request: snapshot.Request{Method: "GET", URL: "/users/1"},
+		Response: snapshot.Response{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    map[string]any{"id": float64(1), "generated_at": "then"},
+		},
+		DBStateBefore: map[string][]map[string]any{"audit_log": {}},
+		DBStateAfter:  map[string][]map[string]any{"audit_log": {{"action": "read"}}},
+	}
+
+	result := r.ReplayOne(snap, "w1.json")
+	if result.Passed {
+		t.Fatalf("expected the response difference to fail, got diffs %v", result.Diffs)
+	}
+	if result.ActualDBState == nil {
+		t.Error("expected a failed result to keep the actual DB state")
+	}
+	for _, d := range result.Diffs {
+		if strings.HasPrefix(d.Path, "db.audit_log") && !d.IsWarning() {
+			t.Errorf("expected %s to be a warning", d.Path)
+		}
+	}
+
+	snap.Replay = &snapshot.ReplayOptions{WarnOnly: []string{"response.body.generated_at"}}
+	result = r.ReplayOne(snap, "w1.json")
+	if !result.Passed || result.Error != "" {
+		t.Fatalf("expected only warnings, got error %q, diffs %v", result.Error, result.Diffs)
+	}
+	if len(result.Diffs) < 2 {
+		t.Errorf("expected the differences still reported, got %v", result.Diffs)
+	}
+	if result.ActualDBState != nil {
+		t.Error("expected a passing result not to keep the actual DB state")
+	}
+	if len(cfg.Replay.WarnOnly) != 1 {
+		t.Errorf("expected the snapshot's warn_only not to leak into the config, got %v", cfg.Replay.WarnOnly)
+	}
+}
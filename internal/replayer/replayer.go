@@ -1,108 +1,392 @@
 package replayer
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
-	"sync"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/esse/snapshot-tester/internal/asserter"
 	"github.com/esse/snapshot-tester/internal/config"
 	"github.com/esse/snapshot-tester/internal/db"
+	"github.com/esse/snapshot-tester/internal/hooks"
+	"github.com/esse/snapshot-tester/internal/hostrule"
 	"github.com/esse/snapshot-tester/internal/httpclient"
 	"github.com/esse/snapshot-tester/internal/mock"
+	"github.com/esse/snapshot-tester/internal/protobuf"
+	"github.com/esse/snapshot-tester/internal/redact"
+	"github.com/esse/snapshot-tester/internal/service"
 	"github.com/esse/snapshot-tester/internal/snapshot"
+	"github.com/esse/snapshot-tester/internal/sqlcapture"
 )
 
 // TestResult represents the result of replaying a single snapshot.
 type TestResult struct {
-	SnapshotID   string
-	SnapshotPath string
-	Passed       bool
-	Diffs        []asserter.Diff
-	Duration     time.Duration
-	Error        string
+	SnapshotID     string
+	SnapshotPath   string
+	Method         string
+	URL            string
+	Tags           []string
+	Passed         bool
+	Cached         bool // skipped because it passed before with the same cache key
+	Skipped        bool // not replayed because replay.fail_fast stopped the run after an earlier failure
+	Quarantined    bool // listed in the quarantine file: a failure is reported separately and doesn't fail the run
+	Diffs          []asserter.Diff
+	ActualResponse *snapshot.Response          // nil if the request could not be sent
+	ActualMessages []snapshot.Message          // WebSocket conversation as replayed, for upgraded connections
+	ActualQueries  []snapshot.Query            // SQL the service executed, with the sqlcapture driver
+	ActualDBHash   string                      // SHA-256 of the actual DB state after the request
+	ActualDBState  map[string][]map[string]any `json:"-"` // full DB state after the request, for failure dumps; nil for passing snapshots
+	MockCalls      []mock.RecordedCall
+	Duration       time.Duration
+	Latency        time.Duration // time the service took to answer the replayed request
+	Error          string
+	ServiceLogs    string // output of the managed service while the snapshot was replayed
+	Attempts       int    // tries it took; more than 1 when requests that got no answer were retried
+
+	unanswered bool // the request got no answer from the service; see replay.retry
 }
 
 // Replayer replays snapshots against a running service.
 type Replayer struct {
 	config      *config.Config
 	snapshotter db.Snapshotter
+	hooks       *hooks.Runner
+	workerEnv   []string        // set on isolated workers; passed to their service instances
+	jar         http.CookieJar  // set while ReplayAll threads cookies between snapshots
+	continued   bool            // set while ReplayScenario runs a step after the first
+	proto       *protobuf.Codec // decodes protobuf responses; nil unless descriptors are configured
+	serviceTLS  *tls.Config     // client certificate and CA for reaching the service; nil for the defaults
+
+	quarantine *snapshot.Quarantine // snapshots whose failures don't stop a fail-fast run; nil if none
+	teardown   func() error         // removes the database container of replay.test_database.provision; nil if none
+
+	resolveBodies func(*snapshot.Snapshot) (*snapshot.Snapshot, error) // reads sidecar bodies; see SetBodyResolver
+
+	// Shared by every snapshot with service.restart: run; see runService
+	runMock *mock.Server
+	runProc *service.Process
+	runErr  error
+	runLogs int64 // offset of the service output not yet attached to a result
 }
 
 // New creates a new Replayer.
 func New(cfg *config.Config) (*Replayer, error) {
-	connStr := cfg.Database.ConnectionString
-	if cfg.Replay.TestDatabase.ConnectionString != "" {
-		connStr = cfg.Replay.TestDatabase.ConnectionString
+	codec, err := protobuf.New(cfg.Protobuf)
+	if err != nil {
+		return nil, fmt.Errorf("loading protobuf descriptors: %w", err)
 	}
-
-	snapshotter, err := db.NewSnapshotter(cfg.Database.Type, connStr, cfg.Database.Tables, cfg.Database.Namespaces)
+	serviceTLS, err := httpclient.LoadTLS(cfg.Service.ClientCert, cfg.Service.ClientKey, cfg.Service.CACert)
 	if err != nil {
+		return nil, err
+	}
+	cfg, teardown, err := provisionTestDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+	snapshotter, err := OpenTestDatabases(cfg)
+	if err != nil {
+		if teardown != nil {
+			teardown()
+		}
 		return nil, fmt.Errorf("connecting to test database: %w", err)
 	}
 
 	return &Replayer{
 		config:      cfg,
 		snapshotter: snapshotter,
+		hooks:       hooks.New(cfg.Hooks),
+		proto:       codec,
+		serviceTLS:  serviceTLS,
+		teardown:    teardown,
 	}, nil
 }
 
-// ReplayOne replays a single snapshot and returns the result.
+// provisionTestDatabase starts the database container of
+// replay.test_database.provision, if set, and returns a copy of cfg that
+// replays against it, with a function that removes the container again.
+func provisionTestDatabase(cfg *config.Config) (*config.Config, func() error, error) {
+	td := cfg.Replay.TestDatabase
+	if td.Provision == "" {
+		return cfg, nil, nil
+	}
+	d := cfg.Database
+	slog.Info("starting test database container", "type", d.Type, "image", td.Image)
+	connString, teardown, err := db.Provision(d.Type, td.Image, td.Schema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("provisioning test database: %w", err)
+	}
+	provisioned := *cfg
+	provisioned.Replay.TestDatabase.ConnectionString = connString
+	return &provisioned, teardown, nil
+}
+
+// Config returns the configuration snapshots are replayed with, which
+// points at the provisioned database with replay.test_database.provision.
+func (r *Replayer) Config() *config.Config {
+	return r.config
+}
+
+// Protobuf returns the codec for protobuf bodies, or nil if no descriptors
+// are configured.
+func (r *Replayer) Protobuf() *protobuf.Codec {
+	return r.proto
+}
+
+// OpenTestDatabases connects to the databases snapshots are replayed
+// against, using replay.test_database connection strings where set.
+func OpenTestDatabases(cfg *config.Config) (db.Snapshotter, error) {
+	var targets []db.Target
+	for _, d := range cfg.DatabaseList() {
+		targets = append(targets, db.Target{
+			Name:       d.Name,
+			Type:       d.Type,
+			ConnString: cfg.ReplayConnectionString(d),
+			Tables:     d.Tables,
+			Namespaces: d.Namespaces,
+
+			ExcludeColumns: d.ExcludeColumns,
+			Filters:        d.Filters,
+			RestoreMode:    d.RestoreMode,
+
+			IncludeViews: d.IncludeViews,
+			RefreshViews: d.RefreshMaterializedViews,
+		})
+	}
+	return db.Open(targets)
+}
+
+// SetQuarantine sets the quarantined snapshots, whose results are marked
+// Quarantined and whose failures don't stop a run with replay.fail_fast.
+func (r *Replayer) SetQuarantine(q *snapshot.Quarantine) {
+	r.quarantine = q
+}
+
+// markQuarantined marks the results of quarantined snapshots, including
+// those that never reached ReplayOne, such as snapshots skipped by
+// fail-fast.
+func (r *Replayer) markQuarantined(results []TestResult) []TestResult {
+	for i := range results {
+		results[i].Quarantined = r.quarantine.Has(results[i].SnapshotID)
+	}
+	return results
+}
+
+// SetBodyResolver sets the function that reads the sidecar body files of
+// snapshots loaded with Store.LazyBodies, typically Store.ResolveBodies. It
+// runs just before each snapshot is replayed, so a run holds the large
+// bodies of one snapshot at a time.
+func (r *Replayer) SetBodyResolver(resolve func(*snapshot.Snapshot) (*snapshot.Snapshot, error)) {
+	r.resolveBodies = resolve
+}
+
+// withBodies returns snap with its sidecar bodies read, if a body resolver
+// is set.
+func (r *Replayer) withBodies(snap *snapshot.Snapshot) (*snapshot.Snapshot, error) {
+	if r.resolveBodies == nil {
+		return snap, nil
+	}
+	return r.resolveBodies(snap)
+}
+
+// Hooks returns the lifecycle hook runner, for registering Go callbacks.
+func (r *Replayer) Hooks() *hooks.Runner {
+	return r.hooks
+}
+
+// ReplayOne replays a single snapshot, running the before_replay and
+// after_replay hooks around it, and returns the result.
 func (r *Replayer) ReplayOne(snap *snapshot.Snapshot, path string) TestResult {
+	hookCtx := hooks.Context{
+		Event:        hooks.EventBeforeReplay,
+		SnapshotID:   snap.ID,
+		SnapshotPath: path,
+		Method:       snap.Request.Method,
+		URL:          snap.Request.URL,
+	}
+	if err := r.hooks.Run(hookCtx); err != nil {
+		return TestResult{
+			SnapshotID:   snap.ID,
+			SnapshotPath: path,
+			Method:       snap.Request.Method,
+			URL:          snap.Request.URL,
+			Tags:         snap.Tags,
+			Error:        fmt.Sprintf("before_replay hook failed: %v", err),
+			Quarantined:  r.quarantine.Has(snap.ID),
+		}
+	}
+
+	result := r.replayWithRetry(snap, path)
+	result.Quarantined = r.quarantine.Has(snap.ID)
+
+	hookCtx.Event = hooks.EventAfterReplay
+	switch {
+	case result.Error != "":
+		hookCtx.Result = hooks.ResultError
+	case result.Passed:
+		hookCtx.Result = hooks.ResultPass
+	default:
+		hookCtx.Result = hooks.ResultFail
+	}
+	// after_replay failures are logged rather than masking the replay result
+	if err := r.hooks.Run(hookCtx); err != nil {
+		slog.Warn("after_replay hook failed", "snapshot", path, "error", err)
+	}
+	return result
+}
+
+func (r *Replayer) replay(snap *snapshot.Snapshot, path string) (result TestResult) {
 	start := time.Now()
-	result := TestResult{
+	result = TestResult{
 		SnapshotID:   snap.ID,
 		SnapshotPath: path,
+		Method:       snap.Request.Method,
+		URL:          snap.Request.URL,
+		Tags:         snap.Tags,
 	}
 
-	// 1. Restore db_state_before
-	if err := r.snapshotter.RestoreAll(snap.DBStateBefore); err != nil {
-		result.Error = fmt.Sprintf("Failed to restore DB state: %v", err)
+	snap, err := r.withBodies(snap)
+	if err != nil {
+		result.Error = err.Error()
 		result.Duration = time.Since(start)
 		return result
 	}
+	// Fill in replay.variables, e.g. the IDs of the tenant replayed against
+	snap, err = snapshot.SubstituteVariables(snap, r.config.Replay.Variables)
+	if err != nil {
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+	// Tell the service when the request was recorded, with replay.clock.header
+	snap = r.WithClockHeader(snap)
 
-	// 2. Start mock server if there are outgoing requests
+	scope, err := r.assertScope(snap)
+	if err != nil {
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// Fail early if the tables changed shape since recording; the row-level
+	// diffs that would follow are much harder to read
+	if err := r.checkSchema(snap); err != nil {
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// 1. Restore db_state_before, unless this step of a scenario continues
+	// from the state the previous steps left
+	if !r.continued {
+		if err := r.snapshotter.RestoreAll(snap.DBStateBefore); err != nil {
+			result.Error = fmt.Sprintf("Failed to restore DB state: %v", err)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	// 2. Start the mock server and, if service.command is set, the service
+	// with the mock URL injected: once for the run with service.restart:
+	// run, otherwise for this snapshot. Isolated workers always start their
+	// own instance. With replay.mock_address the mock server runs for every
+	// snapshot, since a service started some other way may call it anyway.
 	var mockServer *mock.Server
-	var svc *managedService
-	if len(snap.OutgoingRequests) > 0 {
-		mockServer = mock.NewServer(snap.OutgoingRequests)
-		addr, err := mockServer.Start()
+	if r.config.Service.Command != "" && r.config.Service.Restart == RestartRun {
+		var svc *service.Process
+		var err error
+		mockServer, svc, err = r.runService()
 		if err != nil {
-			result.Error = fmt.Sprintf("Failed to start mock server: %v", err)
+			result.Error = fmt.Sprintf("Failed to start service: %v", err)
 			result.Duration = time.Since(start)
 			return result
 		}
-		defer mockServer.Stop()
-
-		mockURL := fmt.Sprintf("http://%s", addr)
-		envVar := r.config.Service.MockEnvVar
-		slog.Info("mock server started", "url", mockURL, "env_var", envVar)
-
-		// If a service command is configured, start the service with the mock URL injected
+		mockServer.Load(snap.OutgoingRequests)
+		// Output since the previous snapshot, startup output for the first
+		defer func() { result.ServiceLogs, r.runLogs = svc.LogsSince(r.runLogs) }()
+	} else {
+		var env []string
+		if len(snap.OutgoingRequests) > 0 || r.config.Service.Command != "" || r.config.Replay.MockAddress != "" {
+			var err error
+			if mockServer, env, err = r.startMock(snap.OutgoingRequests); err != nil {
+				result.Error = fmt.Sprintf("Failed to start mock server: %v", err)
+				result.Duration = time.Since(start)
+				return result
+			}
+			defer mockServer.Stop()
+		}
 		if r.config.Service.Command != "" {
-			svc, err = startService(r.config, []string{
-				fmt.Sprintf("%s=%s", envVar, mockURL),
-			})
+			env = append(env, r.workerEnv...)
+			svc, err := service.Start(r.config, append(env, r.clockEnv(snap)...))
 			if err != nil {
 				result.Error = fmt.Sprintf("Failed to start service: %v", err)
+				var startErr *service.StartError
+				if errors.As(err, &startErr) {
+					result.ServiceLogs = startErr.Logs
+				}
 				result.Duration = time.Since(start)
 				return result
 			}
+			// Collected once the service has stopped, so its shutdown output and
+			// anything still in its pipes are included
+			defer func() { result.ServiceLogs = svc.Logs() }()
 			defer svc.Stop()
 		}
 	}
 
-	// 3. Fire the request
-	actualResp, err := r.fireRequest(snap.Request)
+	// With replay.assert: diff, what the request changes is measured from
+	// the state just before it
+	var actualDBBefore map[string][]map[string]any
+	if scope == AssertDiff && snap.ImportedFrom == "" {
+		if actualDBBefore, err = r.snapshotter.SnapshotAll(); err != nil {
+			result.Error = fmt.Sprintf("Failed to snapshot DB before: %v", err)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	// 3. Fire the request, replaying the conversation of an upgraded connection
+	var actualResp *snapshot.Response
+	var actualMessages []snapshot.Message
+	fired := time.Now()
+	if isWebSocket(snap) {
+		actualResp, actualMessages, err = httpclient.FireWebSocketWith(r.config.Service.BaseURL, snap.Request, snap.WebSocket, r.timeoutMs(snap), httpclient.Options{TLS: r.serviceTLS})
+	} else {
+		actualResp, err = r.fireRequest(snap)
+	}
+	result.Latency = time.Since(fired)
 	if err != nil {
 		result.Error = fmt.Sprintf("Failed to send request: %v", err)
+		result.unanswered = true
 		result.Duration = time.Since(start)
 		return result
 	}
 
+	actualQueries := takeQueries(actualResp)
+
+	// Pseudonymize the actual response the same way it was recorded so
+	// HMAC-redacted fields compare equal when the underlying values match
+	r.RedactActual(actualResp)
+	result.ActualResponse = actualResp
+	result.ActualMessages = actualMessages
+	result.ActualQueries = actualQueries
+	if mockServer != nil {
+		result.MockCalls = mockServer.Calls()
+	}
+
 	// 4. Snapshot DB after
+	if err := db.RefreshViews(r.snapshotter); err != nil {
+		result.Error = fmt.Sprintf("Failed to refresh materialized views: %v", err)
+		result.Duration = time.Since(start)
+		return result
+	}
 	actualDBAfter, err := r.snapshotter.SnapshotAll()
 	if err != nil {
 		result.Error = fmt.Sprintf("Failed to snapshot DB after: %v", err)
@@ -110,7 +394,74 @@ func (r *Replayer) ReplayOne(snap *snapshot.Snapshot, path string) TestResult {
 		return result
 	}
 
-	// 5. Compare response
+	result.ActualDBHash = db.HashState(actualDBAfter)
+
+	// 5. Compare response and DB state, or only the one replay.assert selects
+	opts := r.assertOptions(snap)
+	checkResponse := scope == AssertAll || scope == AssertResponse
+	checkDB := scope != AssertResponse
+
+	var respDiffs []asserter.Diff
+	if checkResponse {
+		expectedResp := map[string]any{
+			"status":       snap.Response.Status,
+			"content_type": snapshot.NormalizeContentType(snap.Response.Headers[snapshot.HeaderContentType]),
+			"body":         snap.Response.Body,
+		}
+		actualRespMap := map[string]any{
+			"status":       actualResp.Status,
+			"content_type": snapshot.NormalizeContentType(actualResp.Headers[snapshot.HeaderContentType]),
+			"body":         actualResp.Body,
+		}
+
+		respDiffs = asserter.AssertResponse(expectedResp, actualRespMap, opts)
+		if isWebSocket(snap) {
+			respDiffs = append(respDiffs, asserter.AssertWebSocket(snap.WebSocket, actualMessages, opts)...)
+		}
+		if len(snap.Response.Trailers) > 0 || len(actualResp.Trailers) > 0 {
+			respDiffs = append(respDiffs, asserter.AssertTrailers(snap.Response.Trailers, actualResp.Trailers, opts)...)
+		}
+		if len(snap.Response.Events) > 0 || len(actualResp.Events) > 0 {
+			respDiffs = append(respDiffs, asserter.AssertEvents(snap.Response.Events, actualResp.Events, opts)...)
+		}
+	}
+	if snap.Queries != nil && scope == AssertAll {
+		respDiffs = append(respDiffs, asserter.AssertQueries(snap.Queries, actualQueries, opts)...)
+	}
+	// Snapshots imported from other tools have no DB state to compare; a
+	// recorded snapshot is always compared, even against an empty state
+	var dbDiffs []asserter.Diff
+	if snap.ImportedFrom == "" && checkDB {
+		if scope == AssertDiff {
+			for _, table := range untouchedTables(snap, actualDBBefore, actualDBAfter, r.config.Replay.RowKeys) {
+				opts.IgnoreTables[table] = true
+			}
+		}
+		dbDiffs = asserter.AssertDBState(snap.DBStateAfter, db.LegacyBinaryState(snap.DBStateAfter, actualDBAfter), opts)
+	}
+	// A WebSocket conversation lasts as long as the client keeps it open, so
+	// only plain requests are timed
+	if snap.Timing != nil && !isWebSocket(snap) && checkResponse {
+		recorded := time.Duration(snap.Timing.UpstreamMs) * time.Millisecond
+		respDiffs = append(respDiffs, asserter.AssertLatency(recorded, result.Latency, r.latencyOptions(snap.Request))...)
+	}
+
+	result.Diffs = append(respDiffs, dbDiffs...)
+	asserter.MarkWarnOnly(result.Diffs, opts)
+	result.Passed = !asserter.HasFailures(result.Diffs)
+	if !result.Passed {
+		// Kept for failure dumps and --update-failed only, so a long run
+		// doesn't hold a copy of the database for every snapshot
+		result.ActualDBState = actualDBAfter
+	}
+	result.Duration = time.Since(start)
+
+	return result
+}
+
+// assertOptions returns the comparison options set in the config, with
+// the fields snap's replay options ignore added.
+func (r *Replayer) assertOptions(snap *snapshot.Snapshot) *asserter.Options {
 	orderInsensitive := make(map[string]bool)
 	for _, table := range r.config.Replay.OrderInsensitive {
 		orderInsensitive[table] = true
@@ -122,62 +473,326 @@ func (r *Replayer) ReplayOne(snap *snapshot.Snapshot, path string) TestResult {
 	}
 
 	// Merge ignore_fields from recording and replay configs
-	ignoreFields := append(r.config.Recording.IgnoreFields, r.config.Replay.IgnoreFields...)
+	var ignoreFields []string
+	ignoreFields = append(ignoreFields, r.config.Recording.IgnoreFields...)
+	ignoreFields = append(ignoreFields, r.config.Replay.IgnoreFields...)
+	if snap.Replay != nil {
+		ignoreFields = append(ignoreFields, snap.Replay.IgnoreFields...)
+	}
+	warnOnly := r.config.Replay.WarnOnly
+	if snap.Replay != nil && len(snap.Replay.WarnOnly) > 0 {
+		warnOnly = append(append([]string(nil), warnOnly...), snap.Replay.WarnOnly...)
+	}
 
-	opts := &asserter.Options{
+	return &asserter.Options{
 		IgnoreFields:     ignoreFields,
 		OrderInsensitive: orderInsensitive,
 		IgnoreTables:     ignoreTables,
+		AllowAdditive:    r.config.Replay.AllowAdditive,
+
+		NullEqualsMissing:       r.config.Replay.NullEqualsMissing,
+		EmptyArrayEqualsMissing: r.config.Replay.EmptyArrayEqualsMissing,
+
+		RowKeys: r.config.Replay.RowKeys,
+
+		Matchers: r.config.Replay.Matchers,
+
+		WarnOnly: warnOnly,
 	}
+}
 
-	expectedResp := map[string]any{
-		"status": snap.Response.Status,
-		"body":   snap.Response.Body,
+// takeQueries removes the queries reported by sqlcapture.Middleware from
+// the actual response headers and returns them, or nil if none were.
+func takeQueries(resp *snapshot.Response) []snapshot.Query {
+	value, ok := resp.Headers[sqlcapture.Header]
+	if !ok {
+		return nil
 	}
-	actualRespMap := map[string]any{
-		"status": actualResp.Status,
-		"body":   actualResp.Body,
+	delete(resp.Headers, sqlcapture.Header)
+	queries, err := sqlcapture.Decode(value)
+	if err != nil {
+		slog.Warn("ignoring reported queries", "error", err)
+		return nil
 	}
+	return queries
+}
 
-	respDiffs := asserter.AssertResponse(expectedResp, actualRespMap, opts)
-	dbDiffs := asserter.AssertDBState(snap.DBStateAfter, actualDBAfter, opts)
+// checkSchema compares the schema recorded with the snapshot, if any, with
+// the current database schema.
+func (r *Replayer) checkSchema(snap *snapshot.Snapshot) error {
+	if len(snap.DBSchema) == 0 {
+		return nil
+	}
+	ss, ok := r.snapshotter.(db.SchemaSnapshotter)
+	if !ok {
+		return nil
+	}
+	current, err := ss.SnapshotSchema()
+	if err != nil {
+		return fmt.Errorf("Failed to read DB schema: %v", err)
+	}
+	if diffs := db.DiffSchema(snap.DBSchema, current); len(diffs) > 0 {
+		return fmt.Errorf("DB schema changed since recording: %s", strings.Join(diffs, "; "))
+	}
+	return nil
+}
 
-	result.Diffs = append(respDiffs, dbDiffs...)
-	result.Passed = len(result.Diffs) == 0
-	result.Duration = time.Since(start)
+// ReplayAll replays multiple snapshots and returns all results, in the
+// order of snapshots. Snapshots linked by depends_on are replayed first, as
+// chains on one DB state (see planChains). The others are replayed one by
+// one; if config.Replay.Parallel is true, up to config.Replay.Workers at
+// once, on isolated workers if config.Replay.Isolation is set. With
+// config.Replay.FailFast, snapshots not yet started when one fails or
+// errors are returned as Skipped. The run is wrapped in the
+// before_replay_run and after_replay_run hooks.
+func (r *Replayer) ReplayAll(snapshots []*snapshot.Snapshot, paths []string) []TestResult {
+	return r.withRunHooks(snapshots, paths, func() []TestResult {
+		return r.replayAll(snapshots, paths)
+	})
+}
 
-	return result
+func (r *Replayer) replayAll(snapshots []*snapshot.Snapshot, paths []string) []TestResult {
+	var stopped atomic.Bool
+	chains, rest := planChains(snapshots)
+	if len(chains) == 0 {
+		return r.replayIndependent(&stopped, snapshots, paths)
+	}
+
+	results := make([]TestResult, len(snapshots))
+	r.replayChains(chains, snapshots, paths, results, &stopped)
+
+	restSnaps := make([]*snapshot.Snapshot, len(rest))
+	restPaths := make([]string, len(rest))
+	for k, i := range rest {
+		restSnaps[k], restPaths[k] = snapshots[i], paths[i]
+	}
+	for k, result := range r.replayIndependent(&stopped, restSnaps, restPaths) {
+		results[rest[k]] = result
+	}
+	return results
 }
 
-// ReplayAll replays multiple snapshots and returns all results.
-// If config.Replay.Parallel is true, snapshots are replayed concurrently.
-func (r *Replayer) ReplayAll(snapshots []*snapshot.Snapshot, paths []string) []TestResult {
+// replayIndependent replays snapshots that each restore their own DB state.
+func (r *Replayer) replayIndependent(stopped *atomic.Bool, snapshots []*snapshot.Snapshot, paths []string) []TestResult {
+	if r.config.Replay.Parallel && r.config.Replay.Isolation == IsolationDatabase && len(snapshots) > 1 {
+		return r.replayIsolated(stopped, snapshots, paths)
+	}
+
 	results := make([]TestResult, len(snapshots))
 
+	if r.config.Replay.CookieJar {
+		r.replayWithCookies(stopped, snapshots, paths, results)
+		return results
+	}
+
 	if r.config.Replay.Parallel && len(snapshots) > 1 {
-		var wg sync.WaitGroup
-		wg.Add(len(snapshots))
+		runPool(r.workerCount(len(snapshots)), len(snapshots), func(_, i int) {
+			results[i] = r.replayOrSkip(stopped, snapshots[i], paths[i])
+		})
+	} else {
 		for i, snap := range snapshots {
-			go func(idx int, s *snapshot.Snapshot, p string) {
-				defer wg.Done()
-				results[idx] = r.ReplayOne(s, p)
-			}(i, snap, paths[i])
+			results[i] = r.replayOrSkip(stopped, snap, paths[i])
 		}
-		wg.Wait()
-	} else {
+	}
+
+	return results
+}
+
+// ReplayScenario replays the steps of a scenario in order. Only the DB
+// state before the first step is restored: each later step runs against the
+// state the earlier ones left, as it did when recorded, and cookies the
+// service sets are threaded through the steps. Every step is replayed even
+// if an earlier one fails, so the report shows where the flow diverged,
+// unless config.Replay.FailFast skips the steps after it. Like ReplayAll,
+// the run is wrapped in the before_replay_run and after_replay_run hooks.
+func (r *Replayer) ReplayScenario(snapshots []*snapshot.Snapshot, paths []string) []TestResult {
+	return r.withRunHooks(snapshots, paths, func() []TestResult {
+		var stopped atomic.Bool
+		return r.replaySteps(&stopped, snapshots, paths)
+	})
+}
+
+// withRunHooks runs the before_replay_run hooks, then replay, then the
+// after_replay_run hooks with the overall result: error if any snapshot
+// errored, fail if any failed, pass otherwise. If a before_replay_run hook
+// fails, nothing is replayed and every snapshot is reported as errored.
+// Empty runs skip the hooks.
+func (r *Replayer) withRunHooks(snapshots []*snapshot.Snapshot, paths []string, replay func() []TestResult) []TestResult {
+	if len(snapshots) == 0 {
+		return replay()
+	}
+	if err := r.hooks.Run(hooks.Context{Event: hooks.EventBeforeReplayRun, Snapshots: len(snapshots)}); err != nil {
+		results := make([]TestResult, len(snapshots))
 		for i, snap := range snapshots {
-			results[i] = r.ReplayOne(snap, paths[i])
+			results[i] = TestResult{
+				SnapshotID:   snap.ID,
+				SnapshotPath: paths[i],
+				Method:       snap.Request.Method,
+				URL:          snap.Request.URL,
+				Tags:         snap.Tags,
+				Error:        fmt.Sprintf("before_replay_run hook failed: %v", err),
+			}
 		}
+		return r.markQuarantined(results)
 	}
 
+	results := r.markQuarantined(replay())
+
+	hookCtx := hooks.Context{Event: hooks.EventAfterReplayRun, Snapshots: len(results), Result: hooks.ResultPass}
+	for _, result := range results {
+		if result.Error != "" {
+			hookCtx.Result = hooks.ResultError
+			break
+		}
+		if !result.Passed {
+			hookCtx.Result = hooks.ResultFail
+		}
+	}
+	if err := r.hooks.Run(hookCtx); err != nil {
+		slog.Warn("after_replay_run hook failed", "error", err)
+	}
 	return results
 }
 
-// Close cleans up resources.
+// replaySteps replays snapshots in order on one DB state, as ReplayScenario
+// describes.
+func (r *Replayer) replaySteps(stopped *atomic.Bool, snapshots []*snapshot.Snapshot, paths []string) []TestResult {
+	jar, _ := cookiejar.New(nil)
+	r.jar = jar
+	defer func() {
+		r.jar = nil
+		r.continued = false
+	}()
+
+	results := make([]TestResult, len(snapshots))
+	for i, snap := range snapshots {
+		r.continued = i > 0
+		results[i] = r.replayOrSkip(stopped, snap, paths[i])
+	}
+	return results
+}
+
+// startMock starts a mock server answering the given outgoing requests and
+// returns it with the variables that point a service at it. It listens on
+// replay.mock_address if set, otherwise on a random loopback port.
+func (r *Replayer) startMock(outgoing []snapshot.OutgoingRequest) (*mock.Server, []string, error) {
+	mockServer := mock.NewServer(outgoing)
+	if rules := r.config.Recording.OutgoingHosts; len(rules) > 0 {
+		mockServer.SetPassthrough(func(authority string) bool {
+			return hostrule.Action(rules, authority) == hostrule.Passthrough
+		})
+	}
+	var addr string
+	var err error
+	if r.config.Replay.MockAddress != "" {
+		addr, err = mockServer.StartAt(r.config.Replay.MockAddress)
+	} else {
+		addr, err = mockServer.StartOn(mockHost(r.config.Service.BaseURL))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	mockURL := (&url.URL{Scheme: "http", Host: addr}).String()
+	envVar := r.config.Service.MockEnvVar
+	slog.Info("mock server started", "url", mockURL, "env_var", envVar)
+	return mockServer, serviceEnv(r.config, envVar, mockURL), nil
+}
+
+// runService returns the mock server and service shared by every snapshot
+// with service.restart: run, starting them the first time. A service that
+// fails to start is not retried for later snapshots.
+func (r *Replayer) runService() (*mock.Server, *service.Process, error) {
+	if r.runMock != nil || r.runErr != nil {
+		return r.runMock, r.runProc, r.runErr
+	}
+	mockServer, env, err := r.startMock(nil)
+	if err != nil {
+		r.runErr = fmt.Errorf("starting mock server: %w", err)
+		return nil, nil, r.runErr
+	}
+	proc, err := service.Start(r.config, env)
+	if err != nil {
+		mockServer.Stop()
+		r.runErr = err
+		return nil, nil, err
+	}
+	r.runMock, r.runProc = mockServer, proc
+	return mockServer, proc, nil
+}
+
+// Close stops the service started for the run, if any, and cleans up
+// resources.
 func (r *Replayer) Close() error {
-	return r.snapshotter.Close()
+	if r.runMock != nil {
+		r.runProc.Stop()
+		r.runMock.Stop()
+	}
+	err := r.snapshotter.Close()
+	if r.teardown != nil {
+		if rmErr := r.teardown(); rmErr != nil {
+			slog.Warn("failed to remove test database container", "error", rmErr)
+		}
+	}
+	return err
+}
+
+// RedactActual applies hmac-mode redaction to a replayed response. Masked
+// redaction is not applied since [REDACTED] can never match a live value.
+func (r *Replayer) RedactActual(resp *snapshot.Response) {
+	rec := r.config.Recording
+	if rec.RedactMode != redact.ModeHMAC || len(rec.RedactFields) == 0 {
+		return
+	}
+	snap := &snapshot.Snapshot{Response: *resp}
+	redact.Snapshot(snap, rec.RedactFields, redact.New(rec.RedactMode, rec.RedactKey))
+	*resp = snap.Response
 }
 
-func (r *Replayer) fireRequest(req snapshot.Request) (*snapshot.Response, error) {
-	return httpclient.FireRequest(r.config.Service.BaseURL, req, r.config.Replay.TimeoutMs)
+// isWebSocket reports whether snap recorded an upgraded WebSocket connection.
+func isWebSocket(snap *snapshot.Snapshot) bool {
+	return len(snap.WebSocket) > 0 || snap.Response.Status == http.StatusSwitchingProtocols
+}
+
+func (r *Replayer) fireRequest(snap *snapshot.Snapshot) (*snapshot.Response, error) {
+	return r.fireRequestTo(r.config.Service.BaseURL, snap)
+}
+
+// fireRequestTo is fireRequest against another deployment of the service.
+func (r *Replayer) fireRequestTo(baseURL string, snap *snapshot.Snapshot) (*snapshot.Response, error) {
+	req := snap.Request
+	opts := httpclient.Options{
+		MaxEvents:    len(snap.Response.Events),
+		Jar:          r.jar,
+		MaxBodyBytes: r.config.Recording.MaxBodyBytes,
+		Head:         len(r.config.Recording.RedactFields) == 0,
+		TLS:          r.serviceTLS,
+	}
+	resp, err := httpclient.FireRequestWith(baseURL, req, r.timeoutMs(snap), opts)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = r.proto.DecodeResponseBody(req.Method, req.URL, resp.Headers[snapshot.HeaderContentType], resp.Body)
+	return resp, nil
+}
+
+// replayWithCookies replays snapshots one at a time in the order they were
+// recorded, so a flow spread over several endpoints (log in, then use the
+// session) runs in sequence, and cookies the service sets during replay
+// replace the stale ones the later snapshots recorded. Results keep the
+// order of snapshots.
+func (r *Replayer) replayWithCookies(stopped *atomic.Bool, snapshots []*snapshot.Snapshot, paths []string, results []TestResult) {
+	jar, _ := cookiejar.New(nil)
+	r.jar = jar
+	defer func() { r.jar = nil }()
+
+	order := make([]int, len(snapshots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return snapshots[order[a]].Timestamp.Before(snapshots[order[b]].Timestamp)
+	})
+	for _, i := range order {
+		results[i] = r.replayOrSkip(stopped, snapshots[i], paths[i])
+	}
 }
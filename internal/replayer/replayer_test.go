@@ -3,11 +3,23 @@ package replayer
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/esse/snapshot-tester/internal/asserter"
 	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/db"
+	"github.com/esse/snapshot-tester/internal/hooks"
+	"github.com/esse/snapshot-tester/internal/redact"
 	"github.com/esse/snapshot-tester/internal/snapshot"
 )
 
@@ -137,6 +149,33 @@ func TestReplayOne_Success(t *testing.T) {
 	}
 }
 
+func TestReplayOne_ImportedSkipsDB(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	r := &Replayer{
+		config:      newTestConfig(server.URL),
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+	}
+	// Restored rows the snapshot doesn't expect afterwards
+	snap := &snapshot.Snapshot{
+		ID:            "imp1",
+		DBStateBefore: map[string][]map[string]any{"users": {{"id": float64(1)}}},
+		Request:       snapshot.Request{Method: "GET", URL: "/health"},
+		Response:      snapshot.Response{Status: 204},
+	}
+
+	if result := r.ReplayOne(snap, "imp1.json"); result.Passed {
+		t.Error("expected a recorded snapshot without db_state_after to be compared against the database")
+	}
+	snap.ImportedFrom = "har"
+	if result := r.ReplayOne(snap, "imp1.json"); !result.Passed || result.Error != "" {
+		t.Errorf("expected an imported snapshot to skip the DB comparison, got error %q, diffs %v", result.Error, result.Diffs)
+	}
+}
+
 func TestReplayOne_ResponseMismatch(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -414,6 +453,97 @@ func TestReplayOne_WithOutgoingRequests(t *testing.T) {
 	if result.Error != "" {
 		t.Fatalf("unexpected error: %s", result.Error)
 	}
+	if result.MockCalls == nil {
+		t.Error("expected mock call log to be attached when a mock server ran")
+	}
+}
+
+func TestReplayOne_FailureArtifacts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(map[string]any{"error": "boom"})
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	dbState := map[string][]map[string]any{"users": {{"id": float64(1)}}}
+
+	r := &Replayer{
+		config:      cfg,
+		snapshotter: &mockSnapshotter{state: dbState},
+	}
+
+	snap := &snapshot.Snapshot{
+		ID:            "artifacts1",
+		Tags:          []string{"smoke"},
+		DBStateBefore: dbState,
+		Request:       snapshot.Request{Method: "POST", URL: "/api/users"},
+		Response:      snapshot.Response{Status: 201},
+		DBStateAfter:  dbState,
+	}
+
+	result := r.ReplayOne(snap, "/test/path.json")
+
+	if result.Method != "POST" || result.URL != "/api/users" || len(result.Tags) != 1 {
+		t.Errorf("expected snapshot metadata on result, got %+v", result)
+	}
+	if result.ActualResponse == nil || result.ActualResponse.Status != 500 {
+		t.Fatalf("expected actual response with status 500, got %+v", result.ActualResponse)
+	}
+	if result.ActualDBHash != db.HashState(dbState) {
+		t.Errorf("expected DB hash %s, got %s", db.HashState(dbState), result.ActualDBHash)
+	}
+	if result.MockCalls != nil {
+		t.Errorf("expected no mock calls without outgoing requests, got %v", result.MockCalls)
+	}
+	if len(result.Diffs) == 0 || result.Diffs[0].Kind != asserter.DiffKindStatusMismatch {
+		t.Errorf("expected a status_mismatch diff, got %+v", result.Diffs)
+	}
+}
+
+func TestReplayOne_HMACRedactedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(map[string]any{"id": float64(1), "email": "alice@example.com"})
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.Recording.RedactFields = []string{"response.body.email"}
+	cfg.Recording.RedactMode = redact.ModeHMAC
+	cfg.Recording.RedactKey = "test-key"
+
+	redactor := redact.New(cfg.Recording.RedactMode, cfg.Recording.RedactKey)
+	dbState := map[string][]map[string]any{"users": {}}
+
+	r := &Replayer{
+		config:      cfg,
+		snapshotter: &mockSnapshotter{state: dbState},
+	}
+
+	snap := &snapshot.Snapshot{
+		ID:            "hmac1",
+		DBStateBefore: dbState,
+		Request:       snapshot.Request{Method: "GET", URL: "/api/users/1"},
+		Response: snapshot.Response{
+			Status: 200,
+			Body:   map[string]any{"id": float64(1), "email": redactor("alice@example.com")},
+		},
+		DBStateAfter: dbState,
+	}
+
+	result := r.ReplayOne(snap, "/test/path.json")
+	if !result.Passed {
+		t.Errorf("expected pseudonymized field to match, got diffs: %v", result.Diffs)
+	}
+
+	snap.Response.Body = map[string]any{"id": float64(1), "email": redactor("bob@example.com")}
+	result = r.ReplayOne(snap, "/test/path.json")
+	if result.Passed {
+		t.Error("expected mismatch when the pseudonymized value differs")
+	}
 }
 
 func TestClose(t *testing.T) {
@@ -430,3 +560,470 @@ func TestClose(t *testing.T) {
 		t.Error("expected snapshotter to be closed")
 	}
 }
+
+func TestReplayOne_Hooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	r := &Replayer{
+		config:      newTestConfig(server.URL),
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+		hooks:       hooks.New(config.HooksConfig{}),
+	}
+	var events []string
+	r.Hooks().Register(hooks.EventBeforeReplay, func(ctx hooks.Context) error {
+		events = append(events, ctx.Event+":"+ctx.SnapshotID)
+		return nil
+	})
+	r.Hooks().Register(hooks.EventAfterReplay, func(ctx hooks.Context) error {
+		events = append(events, ctx.Event+":"+ctx.Result)
+		return nil
+	})
+
+	snap := &snapshot.Snapshot{
+		ID:       "hooked",
+		Request:  snapshot.Request{Method: "GET", URL: "/"},
+		Response: snapshot.Response{Status: 201},
+	}
+	result := r.ReplayOne(snap, "/test/path.json")
+
+	if result.Passed {
+		t.Fatal("expected status mismatch")
+	}
+	if len(events) != 2 || events[0] != "before_replay:hooked" || events[1] != "after_replay:fail" {
+		t.Errorf("unexpected hook events %v", events)
+	}
+}
+
+func TestReplayOne_BeforeReplayHookFailure(t *testing.T) {
+	r := &Replayer{
+		config:      newTestConfig("http://127.0.0.1:1"),
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+		hooks:       hooks.New(config.HooksConfig{}),
+	}
+	r.Hooks().Register(hooks.EventBeforeReplay, func(hooks.Context) error {
+		return fmt.Errorf("migrations failed")
+	})
+
+	result := r.ReplayOne(&snapshot.Snapshot{ID: "x"}, "/test/path.json")
+	if !strings.Contains(result.Error, "migrations failed") {
+		t.Errorf("expected hook error on result, got %q", result.Error)
+	}
+}
+
+func TestReplayAll_RunHooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	r := &Replayer{
+		config:      newTestConfig(server.URL),
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+		hooks:       hooks.New(config.HooksConfig{}),
+	}
+	var events []string
+	for _, event := range []string{hooks.EventBeforeReplayRun, hooks.EventBeforeReplay, hooks.EventAfterReplayRun} {
+		r.Hooks().Register(event, func(ctx hooks.Context) error {
+			events = append(events, fmt.Sprintf("%s:%d:%s", ctx.Event, ctx.Snapshots, ctx.Result))
+			return nil
+		})
+	}
+
+	snaps := []*snapshot.Snapshot{
+		{ID: "a", Request: snapshot.Request{Method: "GET", URL: "/a"}, Response: snapshot.Response{Status: 200}},
+		{ID: "b", Request: snapshot.Request{Method: "GET", URL: "/b"}, Response: snapshot.Response{Status: 201}},
+	}
+	r.ReplayAll(snaps, []string{"a.json", "b.json"})
+	want := "before_replay_run:2: before_replay:0: before_replay:0: after_replay_run:2:fail"
+	if got := strings.Join(events, " "); got != want {
+		t.Errorf("unexpected hook events %s, want %s", got, want)
+	}
+
+	r.Hooks().Register(hooks.EventBeforeReplayRun, func(hooks.Context) error {
+		return fmt.Errorf("queue reset failed")
+	})
+	events = nil
+	for _, result := range r.ReplayAll(snaps, []string{"a.json", "b.json"}) {
+		if !strings.Contains(result.Error, "queue reset failed") {
+			t.Errorf("expected the run hook error on %s, got %q", result.SnapshotPath, result.Error)
+		}
+	}
+	if len(events) != 1 {
+		t.Errorf("expected nothing replayed after the run hook failed, got %v", events)
+	}
+}
+
+func TestReplayOne_EquivalentContentTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "Application/JSON")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	r := &Replayer{
+		config:      newTestConfig(server.URL),
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+	}
+
+	snap := &snapshot.Snapshot{
+		ID:      "ct1",
+		Request: snapshot.Request{Method: "GET", URL: "/api/status"},
+		Response: snapshot.Response{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+			Body:    map[string]any{"ok": true},
+		},
+	}
+
+	result := r.ReplayOne(snap, "/test/path.json")
+	if !result.Passed {
+		t.Errorf("expected equivalent content types to match, got diffs: %v", result.Diffs)
+	}
+}
+
+// schemaSnapshotter adds a fixed table schema to mockSnapshotter.
+type schemaSnapshotter struct {
+	mockSnapshotter
+	schema map[string]snapshot.TableSchema
+}
+
+func (s *schemaSnapshotter) SnapshotSchema() (map[string]snapshot.TableSchema, error) {
+	return s.schema, nil
+}
+
+func TestReplayOne_SchemaChanged(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	recorded := map[string]snapshot.TableSchema{
+		"users": {Columns: []snapshot.ColumnSchema{{Name: "id", Type: "integer"}, {Name: "email", Type: "text"}}},
+	}
+	current := map[string]snapshot.TableSchema{
+		"users": {Columns: []snapshot.ColumnSchema{{Name: "id", Type: "integer"}, {Name: "email", Type: "varchar(255)"}}},
+	}
+	snapshotter := &schemaSnapshotter{mockSnapshotter: mockSnapshotter{state: map[string][]map[string]any{}}, schema: current}
+	r := &Replayer{config: newTestConfig(server.URL), snapshotter: snapshotter}
+
+	snap := &snapshot.Snapshot{
+		ID:       "schema1",
+		Request:  snapshot.Request{Method: "GET", URL: "/"},
+		Response: snapshot.Response{Status: 200},
+		DBSchema: recorded,
+	}
+	result := r.ReplayOne(snap, "schema.json")
+
+	if result.Passed {
+		t.Error("expected schema change to fail the replay")
+	}
+	if !strings.Contains(result.Error, "users.email: type text, now varchar(255)") {
+		t.Errorf("expected schema diff in error, got %q", result.Error)
+	}
+	if requests != 0 {
+		t.Error("expected replay to stop before firing the request")
+	}
+
+	// Matching schema replays normally
+	snapshotter.schema = recorded
+	if result := r.ReplayOne(snap, "schema.json"); result.Error != "" {
+		t.Errorf("unexpected error with matching schema: %s", result.Error)
+	}
+}
+
+func TestReplayAll_CookieJar(t *testing.T) {
+	var issued int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login":
+			// Every login issues a new session, as with in-memory sessions
+			issued++
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: fmt.Sprintf("s%d", issued), Path: "/"})
+			json.NewEncoder(w).Encode(map[string]any{"ok": true})
+		case "/me":
+			c, err := r.Cookie("session")
+			theme, _ := r.Cookie("theme")
+			if err != nil || c.Value != fmt.Sprintf("s%d", issued) || theme == nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]any{"ok": false})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"ok": true})
+		}
+	}))
+	defer server.Close()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	snap := func(id, method, url string, at time.Duration, headers map[string]string) *snapshot.Snapshot {
+		return &snapshot.Snapshot{
+			ID:            id,
+			Timestamp:     start.Add(at),
+			DBStateBefore: map[string][]map[string]any{},
+			Request:       snapshot.Request{Method: method, URL: url, Headers: headers},
+			Response:      snapshot.Response{Status: 200, Body: map[string]any{"ok": true}},
+			DBStateAfter:  map[string][]map[string]any{},
+		}
+	}
+	// Loaded by path, the profile snapshot comes before the login that
+	// preceded it while recording
+	snaps := []*snapshot.Snapshot{
+		snap("me", "GET", "/me", time.Second, map[string]string{"Cookie": "session=recorded; theme=dark"}),
+		snap("login", "POST", "/login", 0, nil),
+	}
+	paths := []string{"GET_me/001.json", "POST_login/001.json"}
+
+	cfg := newTestConfig(server.URL)
+	r := &Replayer{config: cfg, snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}}}
+
+	results := r.ReplayAll(snaps, paths)
+	if results[0].Passed {
+		t.Fatal("expected the stale recorded cookie to fail without the jar")
+	}
+
+	cfg.Replay.CookieJar = true
+	results = r.ReplayAll(snaps, paths)
+	for i, res := range results {
+		if !res.Passed {
+			t.Errorf("result %d (%s): expected pass, got error %q diffs %v", i, res.SnapshotID, res.Error, res.Diffs)
+		}
+	}
+	if r.jar != nil {
+		t.Error("expected the jar to be dropped after ReplayAll")
+	}
+}
+
+func TestReplayAll_ServiceRestart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		restart    string
+		wantStarts int
+		wantLogs   []string // service logs of each result
+	}{
+		{RestartSnapshot, 2, []string{"started\n", "started\n"}},
+		{RestartRun, 1, []string{"started\n", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.restart, func(t *testing.T) {
+			starts := filepath.Join(t.TempDir(), "starts.log")
+			cfg := newTestConfig(server.URL)
+			cfg.Service.Command = `echo "$SNAPSHOT_MOCK_URL $HTTP_PROXY" >> ` + starts + `; echo started; exec sleep 10`
+			cfg.Service.StartupTimeMs = 10
+			cfg.Service.Restart = tt.restart
+			r := &Replayer{
+				config:      cfg,
+				snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+			}
+
+			snaps := []*snapshot.Snapshot{
+				{ID: "s1", Request: snapshot.Request{Method: "GET", URL: "/a"}, Response: snapshot.Response{Status: 204}},
+				{ID: "s2", Request: snapshot.Request{Method: "GET", URL: "/b"}, Response: snapshot.Response{Status: 204}},
+			}
+			results := r.ReplayAll(snaps, []string{"a.json", "b.json"})
+			r.Close()
+
+			for i, res := range results {
+				if !res.Passed {
+					t.Errorf("result %d: expected a pass, got error %q diffs %v", i, res.Error, res.Diffs)
+				}
+				if res.ServiceLogs != tt.wantLogs[i] {
+					t.Errorf("result %d: expected service logs %q, got %q", i, tt.wantLogs[i], res.ServiceLogs)
+				}
+			}
+			data, err := os.ReadFile(starts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if len(lines) != tt.wantStarts {
+				t.Fatalf("expected the service to start %d times, got %q", tt.wantStarts, lines)
+			}
+			// The mock server is injected both by name and as the HTTP proxy
+			if urls := strings.Fields(lines[0]); len(urls) != 2 || urls[0] != urls[1] || !strings.HasPrefix(urls[0], "http://127.0.0.1:") {
+				t.Errorf("expected the mock URL in SNAPSHOT_MOCK_URL and HTTP_PROXY, got %q", lines[0])
+			}
+		})
+	}
+}
+
+func TestReplayAll_ParallelWorkerLimit(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.Replay.Parallel = true
+	cfg.Replay.Workers = 2
+	r := &Replayer{
+		config:      cfg,
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+	}
+
+	var snaps []*snapshot.Snapshot
+	var paths []string
+	for i := 0; i < 8; i++ {
+		snaps = append(snaps, &snapshot.Snapshot{
+			ID:       fmt.Sprintf("w%d", i),
+			Request:  snapshot.Request{Method: "GET", URL: fmt.Sprintf("/items/%d", i)},
+			Response: snapshot.Response{Status: 204},
+		})
+		paths = append(paths, fmt.Sprintf("%d.json", i))
+	}
+
+	results := r.ReplayAll(snaps, paths)
+	for i, res := range results {
+		if res.SnapshotID != snaps[i].ID || !res.Passed {
+			t.Errorf("result %d: expected %s to pass, got %s passed=%v error=%q", i, snaps[i].ID, res.SnapshotID, res.Passed, res.Error)
+		}
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("expected at most 2 snapshots replayed at once, got %d", p)
+	}
+}
+
+func TestReplayAll_FailFast(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.Replay.FailFast = true
+	r := &Replayer{
+		config:      cfg,
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+	}
+
+	var snaps []*snapshot.Snapshot
+	var paths []string
+	for i, status := range []int{204, 500, 204, 204} {
+		snaps = append(snaps, &snapshot.Snapshot{
+			ID:       fmt.Sprintf("f%d", i),
+			Request:  snapshot.Request{Method: "GET", URL: fmt.Sprintf("/items/%d", i)},
+			Response: snapshot.Response{Status: status},
+		})
+		paths = append(paths, fmt.Sprintf("%d.json", i))
+	}
+
+	results := r.ReplayAll(snaps, paths)
+	if !results[0].Passed || results[1].Passed || results[1].Skipped {
+		t.Errorf("expected the first snapshot to pass and the second to fail, got %+v %+v", results[0], results[1])
+	}
+	for _, res := range results[2:] {
+		if !res.Skipped || res.SnapshotID == "" {
+			t.Errorf("expected %s to be skipped after the failure, got %+v", res.SnapshotPath, res)
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected 2 requests before stopping, got %d", n)
+	}
+
+	cfg.Replay.FailFast = false
+	for _, res := range r.ReplayAll(snaps, paths) {
+		if res.Skipped {
+			t.Errorf("expected every snapshot replayed without fail_fast, %s was skipped", res.SnapshotPath)
+		}
+	}
+
+	// A quarantined failure doesn't stop the run
+	cfg.Replay.FailFast = true
+	quarantine, err := snapshot.LoadQuarantine(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	quarantine.Add(snaps[1], paths[1], "flaky")
+	r.SetQuarantine(quarantine)
+	for i, res := range r.ReplayAll(snaps, paths) {
+		if res.Skipped {
+			t.Errorf("expected every snapshot replayed after a quarantined failure, %s was skipped", res.SnapshotPath)
+		}
+		if res.Quarantined != (i == 1) {
+			t.Errorf("expected only the quarantined snapshot's result to be marked, %s is %v", res.SnapshotPath, res.Quarantined)
+		}
+	}
+	if res := r.ReplayOne(snaps[1], paths[1]); !res.Quarantined {
+		t.Error("expected ReplayOne to mark the result of a quarantined snapshot")
+	}
+}
+
+func TestReplayOne_MockAddress(t *testing.T) {
+	// Reserve a port for the mock server, as it would be configured
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockAddr := l.Addr().String()
+	l.Close()
+
+	// A service started elsewhere, sending its outgoing calls through the
+	// mock address as its HTTP proxy
+	proxyURL, _ := url.Parse("http://" + mockAddr)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := client.Get("http://payments.example.com/balance")
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		defer resp.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(server.URL)
+	cfg.Replay.MockAddress = mockAddr
+	r := &Replayer{
+		config:      cfg,
+		snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+	}
+
+	snap := &snapshot.Snapshot{
+		ID:      "mockaddr1",
+		Request: snapshot.Request{Method: "GET", URL: "/balance"},
+		OutgoingRequests: []snapshot.OutgoingRequest{{
+			Method:   "GET",
+			URL:      "http://payments.example.com/balance",
+			Response: &snapshot.Response{Status: 200, Body: map[string]any{"balance": float64(42)}},
+		}},
+		Response: snapshot.Response{Status: 200, Body: map[string]any{"balance": float64(42)}},
+	}
+
+	// Twice, so the address is freed again after each snapshot
+	for i := 0; i < 2; i++ {
+		result := r.ReplayOne(snap, "mockaddr1.json")
+		if result.Error != "" {
+			t.Fatalf("unexpected error: %s", result.Error)
+		}
+		if !result.Passed {
+			t.Errorf("expected the recorded call to be answered, got diffs: %v", result.Diffs)
+		}
+		if len(result.MockCalls) != 1 {
+			t.Errorf("expected 1 mock call, got %d", len(result.MockCalls))
+		}
+	}
+}
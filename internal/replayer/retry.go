@@ -0,0 +1,31 @@
+package replayer
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// replayWithRetry replays snap, trying again while its request gets no
+// answer from the service, up to replay.retry.attempts times in all. The
+// wait between tries starts at replay.retry.delay_ms and doubles each time.
+// Each try restores the DB state the way the first did. A snapshot's
+// replay.retry_attempts replaces the configured number of attempts.
+func (r *Replayer) replayWithRetry(snap *snapshot.Snapshot, path string) TestResult {
+	retry := r.config.Replay.Retry
+	if snap.Replay != nil && snap.Replay.RetryAttempts > 0 {
+		retry.Attempts = snap.Replay.RetryAttempts
+	}
+	delay := time.Duration(retry.DelayMs) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		result := r.replay(snap, path)
+		result.Attempts = attempt
+		if !result.unanswered || attempt >= retry.Attempts {
+			return result
+		}
+		slog.Warn("request got no answer, retrying", "snapshot", path, "attempt", attempt, "error", result.Error, "delay", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,70 @@
+package replayer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestReplayOne_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		drops        int32 // connections closed without an answer before answering
+		status       int   // status answered afterwards
+		attempts     int
+		wantAttempts int
+		wantRequests int32
+		wantPassed   bool
+		wantError    string
+	}{
+		{"recovers", 2, 204, 3, 3, 3, true, ""},
+		{"gives up", 5, 204, 2, 2, 2, false, "Failed to send request"},
+		{"assertion failures are not retried", 0, 500, 3, 1, 1, false, ""},
+		{"no retries by default", 1, 204, 0, 1, 1, false, "Failed to send request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= tt.drops {
+					conn, _, _ := w.(http.Hijacker).Hijack()
+					conn.Close()
+					return
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			cfg := newTestConfig(server.URL)
+			cfg.Replay.Retry.Attempts = tt.attempts
+			cfg.Replay.Retry.DelayMs = 1
+			r := &Replayer{
+				config:      cfg,
+				snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}},
+			}
+
+			result := r.ReplayOne(&snapshot.Snapshot{
+				ID:       "r1",
+				Request:  snapshot.Request{Method: "POST", URL: "/orders"},
+				Response: snapshot.Response{Status: 204},
+			}, "r1.json")
+
+			if result.Attempts != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, result.Attempts)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("expected %d requests, got %d", tt.wantRequests, n)
+			}
+			if result.Passed != tt.wantPassed {
+				t.Errorf("expected passed=%v, got %v (error %q)", tt.wantPassed, result.Passed, result.Error)
+			}
+			if !strings.Contains(result.Error, tt.wantError) || (tt.wantError == "" && result.Error != "") {
+				t.Errorf("expected error %q, got %q", tt.wantError, result.Error)
+			}
+		})
+	}
+}
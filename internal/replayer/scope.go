@@ -0,0 +1,64 @@
+package replayer
+
+import (
+	"fmt"
+
+	"github.com/esse/snapshot-tester/internal/db"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Assertion scopes, set by replay.assert or a snapshot's replay.assert.
+const (
+	AssertAll      = "all"      // the response and the DB state (default)
+	AssertResponse = "response" // only the HTTP response: status, content type, body, messages, trailers, events and latency
+	AssertDB       = "db"       // only the DB state after the request
+	AssertDiff     = "diff"     // only the tables the request changed, when recorded or when replayed
+)
+
+// assertScope returns what to compare for snap: its own replay.assert if
+// it sets one, otherwise the configured one.
+func (r *Replayer) assertScope(snap *snapshot.Snapshot) (string, error) {
+	scope := r.config.Replay.Assert
+	if snap.Replay != nil && snap.Replay.Assert != "" {
+		scope = snap.Replay.Assert
+	}
+	switch scope {
+	case "":
+		return AssertAll, nil
+	case AssertAll, AssertResponse, AssertDB, AssertDiff:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("invalid replay.assert %q (want %s, %s, %s or %s)", scope, AssertAll, AssertResponse, AssertDB, AssertDiff)
+	}
+}
+
+// untouchedTables returns the tables that neither the recorded request nor
+// the replayed one changed. The replayed changes are those from
+// actualBefore, the DB state just before the request was fired, so state
+// left by earlier steps of a scenario doesn't count as a change.
+func untouchedTables(snap *snapshot.Snapshot, actualBefore, actualAfter map[string][]map[string]any, rowKeys map[string][]string) []string {
+	recorded := snap.DBDiff
+	if recorded == nil {
+		recorded = db.ComputeDiff(snap.DBStateBefore, snap.DBStateAfter, rowKeys)
+	}
+	replayed := db.ComputeDiff(actualBefore, actualAfter, rowKeys)
+
+	tables := make(map[string]bool)
+	for table := range snap.DBStateAfter {
+		tables[table] = true
+	}
+	for table := range actualAfter {
+		tables[table] = true
+	}
+	var untouched []string
+	for table := range tables {
+		if !changed(recorded[table]) && !changed(replayed[table]) {
+			untouched = append(untouched, table)
+		}
+	}
+	return untouched
+}
+
+func changed(diff snapshot.TableDiff) bool {
+	return len(diff.Added) > 0 || len(diff.Removed) > 0 || len(diff.Modified) > 0
+}
@@ -0,0 +1,102 @@
+package replayer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestReplayOne_AssertScope(t *testing.T) {
+	snapshotter := &mockSnapshotter{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Creates user 2 with a different name than recorded, and a
+		// different response
+		after := make(map[string][]map[string]any)
+		for table, rows := range snapshotter.state {
+			after[table] = rows
+		}
+		after["users"] = append(append([]map[string]any{}, after["users"]...), map[string]any{"id": float64(2), "name": r.URL.Query().Get("name")})
+		snapshotter.state = after
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": float64(2), "version": "v2"})
+	}))
+	defer server.Close()
+
+	users := []map[string]any{{"id": float64(1), "name": "alice"}}
+	snap := &snapshot.Snapshot{
+		ID:      "s1",
+		Request: snapshot.Request{Method: "POST", URL: "/users?name=bob"},
+		Response: snapshot.Response{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    map[string]any{"id": float64(2), "version": "v1"},
+		},
+		DBStateBefore: map[string][]map[string]any{"users": users, "audit": {{"id": float64(1)}}},
+		DBStateAfter: map[string][]map[string]any{
+			"users": {users[0], {"id": float64(2), "name": "bob"}},
+			"audit": {{"id": float64(1)}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		config    string
+		snapshot  string
+		url       string
+		wantDiffs []string
+	}{
+		{"all", "", "", "/users?name=bob", []string{"response.body.version", "db.audit.length", "db.audit[1]"}},
+		{"response only", AssertResponse, "", "/users?name=bob", []string{"response.body.version"}},
+		{"db only", AssertDB, "", "/users?name=bob", []string{"db.audit.length", "db.audit[1]"}},
+		{"diff ignores untouched tables", AssertDiff, "", "/users?name=bob", nil},
+		{"diff compares touched tables", AssertDiff, "", "/users?name=carol", []string{"db.users[1].name"}},
+		{"snapshot overrides config", AssertDB, AssertResponse, "/users?name=bob", []string{"response.body.version"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(server.URL)
+			cfg.Replay.Assert = tt.config
+			// A scenario step continues from the state earlier steps left,
+			// here an audit row the recording didn't have
+			snapshotter.state = map[string][]map[string]any{"users": users, "audit": {{"id": float64(1)}, {"id": float64(2)}}}
+			r := &Replayer{config: cfg, snapshotter: snapshotter, continued: true}
+
+			s := *snap
+			s.Request.URL = tt.url
+			if tt.snapshot != "" {
+				s.Replay = &snapshot.ReplayOptions{Assert: tt.snapshot}
+			}
+			result := r.ReplayOne(&s, "s1.json")
+			if result.Error != "" {
+				t.Fatalf("unexpected error: %s", result.Error)
+			}
+
+			var paths []string
+			for _, d := range result.Diffs {
+				paths = append(paths, d.Path)
+			}
+			if len(paths) != len(tt.wantDiffs) {
+				t.Fatalf("expected diffs at %v, got %v", tt.wantDiffs, result.Diffs)
+			}
+			for i := range paths {
+				if paths[i] != tt.wantDiffs[i] {
+					t.Errorf("expected diffs at %v, got %v", tt.wantDiffs, paths)
+					break
+				}
+			}
+			if result.Passed != (len(tt.wantDiffs) == 0) {
+				t.Errorf("expected passed=%v", len(tt.wantDiffs) == 0)
+			}
+		})
+	}
+
+	r := &Replayer{config: newTestConfig(server.URL), snapshotter: snapshotter}
+	s := *snap
+	s.Replay = &snapshot.ReplayOptions{Assert: "headers"}
+	if result := r.ReplayOne(&s, "s1.json"); result.Error != `invalid replay.assert "headers" (want all, response, db or diff)` {
+		t.Errorf("expected an invalid replay.assert error, got %q", result.Error)
+	}
+}
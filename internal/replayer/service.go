@@ -1,78 +1,44 @@
 package replayer
 
 import (
-	"context"
 	"fmt"
-	"log/slog"
-	"os"
-	"os/exec"
-	"runtime"
-	"time"
+	"net"
 
 	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/httpclient"
+	"github.com/esse/snapshot-tester/internal/service"
 )
 
-// managedService manages the lifecycle of a service started via config command.
-type managedService struct {
-	cmd    *exec.Cmd
-	cancel context.CancelFunc
-}
-
-// startService launches the service as a subprocess with the given environment
-// variables injected. It waits for startupTimeMs before returning.
-func startService(cfg *config.Config, extraEnv []string) (*managedService, error) {
-	if cfg.Service.Command == "" {
-		return nil, nil
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(ctx, "cmd", "/C", cfg.Service.Command)
-	} else {
-		cmd = exec.CommandContext(ctx, "sh", "-c", cfg.Service.Command)
-	}
+// EnvServiceSocket tells a managed service which unix socket to listen on
+// when service.base_url is a unix:// URL.
+const EnvServiceSocket = service.EnvSocket
 
-	// Inherit current environment and add extras
-	cmd.Env = append(os.Environ(), extraEnv...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Start(); err != nil {
-		cancel()
-		return nil, fmt.Errorf("starting service command %q: %w", cfg.Service.Command, err)
-	}
+// Service restart policies, set by service.restart.
+const (
+	RestartSnapshot = "snapshot" // a fresh instance for every snapshot (default)
+	RestartRun      = "run"      // one instance for the whole replay run
+)
 
-	slog.Info("service started", "pid", cmd.Process.Pid, "command", cfg.Service.Command)
-	for _, env := range extraEnv {
-		slog.Debug("service env injected", "env", env)
+// serviceEnv returns the variables injected into a managed service: the mock
+// server URL, both in mockEnvVar and as the HTTP proxy, for unix socket
+// targets the socket path, and the connection string of a provisioned test
+// database.
+func serviceEnv(cfg *config.Config, mockEnvVar, mockURL string) []string {
+	env := []string{fmt.Sprintf("%s=%s", mockEnvVar, mockURL)}
+	env = append(env, service.ProxyEnv(mockURL, false)...)
+	if cfg.Replay.TestDatabase.Provision != "" {
+		env = append(env, fmt.Sprintf("%s=%s", EnvDatabaseURL, cfg.Replay.TestDatabase.ConnectionString))
 	}
-
-	// Wait for service startup
-	startupTime := time.Duration(cfg.Service.StartupTimeMs) * time.Millisecond
-	time.Sleep(startupTime)
-
-	return &managedService{cmd: cmd, cancel: cancel}, nil
+	return append(env, service.SocketEnv(cfg)...)
 }
 
-// Stop terminates the managed service.
-func (s *managedService) Stop() {
-	if s == nil {
-		return
-	}
-	s.cancel()
-	// Wait briefly for graceful shutdown
-	done := make(chan struct{})
-	go func() {
-		s.cmd.Wait()
-		close(done)
-	}()
-	select {
-	case <-done:
-		slog.Info("service stopped", "pid", s.cmd.Process.Pid)
-	case <-time.After(5 * time.Second):
-		slog.Warn("service did not stop gracefully, killing", "pid", s.cmd.Process.Pid)
-		s.cmd.Process.Kill()
+// mockHost returns the loopback address the mock server listens on: IPv6
+// when the service itself is addressed by an IPv6 literal, IPv4 otherwise.
+func mockHost(baseURL string) string {
+	if target, err := httpclient.ParseTarget(baseURL); err == nil {
+		if ip := net.ParseIP(target.URL.Hostname()); ip != nil && ip.To4() == nil {
+			return "::1"
+		}
 	}
+	return "127.0.0.1"
 }
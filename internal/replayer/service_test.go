@@ -1,92 +1,44 @@
 package replayer
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/esse/snapshot-tester/internal/config"
 )
 
-func TestStartService_EmptyCommand(t *testing.T) {
-	cfg := &config.Config{
-		Service: config.ServiceConfig{
-			Command:       "",
-			StartupTimeMs: 10,
-		},
+func TestServiceEnv(t *testing.T) {
+	cfg := &config.Config{Service: config.ServiceConfig{BaseURL: "unix:///tmp/app.sock"}}
+	env := serviceEnv(cfg, "SNAPSHOT_MOCK_URL", "http://127.0.0.1:1234")
+	want := []string{
+		"SNAPSHOT_MOCK_URL=http://127.0.0.1:1234",
+		"HTTP_PROXY=http://127.0.0.1:1234",
+		"http_proxy=http://127.0.0.1:1234",
+		EnvServiceSocket + "=/tmp/app.sock",
 	}
-
-	svc, err := startService(cfg, nil)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if svc != nil {
-		t.Error("expected nil service for empty command")
-	}
-}
-
-func TestStartService_ShortLivedCommand(t *testing.T) {
-	// Even if the command exits quickly, Start() succeeds because sh starts fine.
-	// This verifies the service can be started and stopped cleanly for short-lived processes.
-	cfg := &config.Config{
-		Service: config.ServiceConfig{
-			Command:       "echo hello",
-			StartupTimeMs: 10,
-		},
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("unexpected env for unix target: %v", env)
 	}
 
-	svc, err := startService(cfg, nil)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	cfg.Service.BaseURL = "http://localhost:8080"
+	env = serviceEnv(cfg, "MOCK", "http://[::1]:1234")
+	want = []string{"MOCK=http://[::1]:1234", "HTTP_PROXY=http://[::1]:1234", "http_proxy=http://[::1]:1234"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("unexpected env for http target: %v", env)
 	}
-	if svc == nil {
-		t.Fatal("expected non-nil service")
-	}
-	svc.Stop()
 }
 
-func TestStartService_WithExtraEnv(t *testing.T) {
-	cfg := &config.Config{
-		Service: config.ServiceConfig{
-			Command:       "sleep 0.01",
-			StartupTimeMs: 50,
-		},
-	}
-
-	svc, err := startService(cfg, []string{"TEST_VAR=test_value"})
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+func TestMockHost(t *testing.T) {
+	tests := map[string]string{
+		"http://localhost:8080":    "127.0.0.1",
+		"http://127.0.0.1:8080":    "127.0.0.1",
+		"http://[::1]:8080":        "::1",
+		"http://[::ffff:10.0.0.1]": "127.0.0.1",
+		"unix:///tmp/app.sock":     "127.0.0.1",
 	}
-	if svc == nil {
-		t.Fatal("expected non-nil service")
-	}
-	defer svc.Stop()
-
-	if svc.cmd == nil {
-		t.Error("expected non-nil cmd")
+	for baseURL, want := range tests {
+		if got := mockHost(baseURL); got != want {
+			t.Errorf("mockHost(%q) = %q, want %q", baseURL, got, want)
+		}
 	}
 }
-
-func TestManagedService_StopNil(t *testing.T) {
-	// Stop on nil should not panic
-	var svc *managedService
-	svc.Stop() // should be a no-op
-}
-
-func TestStartService_StopGracefully(t *testing.T) {
-	cfg := &config.Config{
-		Service: config.ServiceConfig{
-			Command:       "sleep 10",
-			StartupTimeMs: 10,
-		},
-	}
-
-	svc, err := startService(cfg, nil)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if svc == nil {
-		t.Fatal("expected non-nil service")
-	}
-
-	// Stop should terminate the process
-	svc.Stop()
-}
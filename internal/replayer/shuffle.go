@@ -0,0 +1,18 @@
+package replayer
+
+import (
+	"math/rand"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Shuffle reorders snapshots and their paths pseudo-randomly from seed.
+// The same seed gives the same order for the same snapshots, so an order
+// in which one snapshot leaks state into another can be replayed again.
+// Snapshots linked by depends_on still replay after their dependencies.
+func Shuffle(snapshots []*snapshot.Snapshot, paths []string, seed int64) {
+	rand.New(rand.NewSource(seed)).Shuffle(len(snapshots), func(i, j int) {
+		snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
+		paths[i], paths[j] = paths[j], paths[i]
+	})
+}
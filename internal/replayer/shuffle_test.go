@@ -0,0 +1,60 @@
+package replayer
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func TestShuffle(t *testing.T) {
+	load := func() ([]*snapshot.Snapshot, []string) {
+		var snaps []*snapshot.Snapshot
+		var paths []string
+		for i := range 20 {
+			id := fmt.Sprintf("s%02d", i)
+			snaps = append(snaps, &snapshot.Snapshot{ID: id})
+			paths = append(paths, id+".json")
+		}
+		return snaps, paths
+	}
+	ids := func(snaps []*snapshot.Snapshot) []string {
+		var out []string
+		for _, s := range snaps {
+			out = append(out, s.ID)
+		}
+		return out
+	}
+
+	snaps, paths := load()
+	original := ids(snaps)
+	Shuffle(snaps, paths, 42)
+	first := ids(snaps)
+
+	if slices.Equal(first, original) {
+		t.Error("expected the order to change")
+	}
+	for i, s := range snaps {
+		if paths[i] != s.ID+".json" {
+			t.Errorf("path %s moved away from snapshot %s", paths[i], s.ID)
+		}
+	}
+	sorted := slices.Clone(first)
+	slices.Sort(sorted)
+	if !slices.Equal(sorted, original) {
+		t.Errorf("expected the same snapshots, got %v", first)
+	}
+
+	snaps, paths = load()
+	Shuffle(snaps, paths, 42)
+	if again := ids(snaps); !slices.Equal(again, first) {
+		t.Errorf("expected seed 42 to give %v again, got %v", first, again)
+	}
+
+	snaps, paths = load()
+	Shuffle(snaps, paths, 7)
+	if other := ids(snaps); slices.Equal(other, first) {
+		t.Error("expected another seed to give another order")
+	}
+}
@@ -0,0 +1,197 @@
+package replayer
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/esse/snapshot-tester/internal/db"
+	"github.com/esse/snapshot-tester/internal/httpclient"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// IsolationDatabase gives each parallel replay worker its own copy of the
+// test database and its own service instance.
+const IsolationDatabase = "database"
+
+// DefaultWorkers is the number of snapshots replayed at once in parallel
+// replay when replay.workers is unset.
+const DefaultWorkers = 4
+
+// Environment variables passed to the service instance of an isolated worker.
+// EnvDatabaseURL is also passed with replay.test_database.provision.
+const (
+	EnvWorker      = "SNAPSHOT_WORKER"       // worker number, from 1
+	EnvDatabaseURL = "SNAPSHOT_DATABASE_URL" // connection string of the worker's database copy, or of a provisioned test database
+	EnvServicePort = "SNAPSHOT_SERVICE_PORT" // port the service must listen on
+)
+
+// worker is a Replayer bound to its own copy of the test database and its
+// own service port.
+type worker struct {
+	*Replayer
+	drop func() error
+}
+
+// replayIsolated replays snapshots on replay.workers workers. Each worker
+// replays against a private copy of the test database and starts its own
+// service instance for every snapshot, so snapshots never see each other's
+// writes.
+func (r *Replayer) replayIsolated(stopped *atomic.Bool, snapshots []*snapshot.Snapshot, paths []string) []TestResult {
+	results := make([]TestResult, len(snapshots))
+	fail := func(err error) []TestResult {
+		for i, snap := range snapshots {
+			results[i] = TestResult{
+				SnapshotID:   snap.ID,
+				SnapshotPath: paths[i],
+				Method:       snap.Request.Method,
+				URL:          snap.Request.URL,
+				Tags:         snap.Tags,
+				Error:        fmt.Sprintf("Failed to set up replay workers: %v", err),
+			}
+		}
+		return results
+	}
+
+	n := r.workerCount(len(snapshots))
+
+	// PostgreSQL cannot copy a database that has open connections, so the
+	// shared connection is closed while the workers run
+	if err := r.snapshotter.Close(); err != nil {
+		return fail(err)
+	}
+	defer func() {
+		snapshotter, err := OpenTestDatabases(r.config)
+		if err != nil {
+			slog.Warn("failed to reconnect to test database", "error", err)
+			return
+		}
+		r.snapshotter = snapshotter
+	}()
+
+	var workers []*worker
+	defer func() {
+		for _, w := range workers {
+			w.Close()
+			if err := w.drop(); err != nil {
+				slog.Warn("failed to remove worker database", "error", err)
+			}
+		}
+	}()
+	for i := 1; i <= n; i++ {
+		w, err := r.newWorker(i)
+		if err != nil {
+			return fail(fmt.Errorf("worker %d: %w", i, err))
+		}
+		workers = append(workers, w)
+	}
+
+	runPool(len(workers), len(snapshots), func(w, i int) {
+		results[i] = workers[w].replayOrSkip(stopped, snapshots[i], paths[i])
+	})
+	return results
+}
+
+// workerCount returns the number of parallel workers to replay count
+// snapshots with: replay.workers, or DefaultWorkers, but never more than
+// there are snapshots.
+func (r *Replayer) workerCount(count int) int {
+	n := r.config.Replay.Workers
+	if n <= 0 {
+		n = DefaultWorkers
+	}
+	return min(n, count)
+}
+
+// runPool calls job for every index in [0, count) on n goroutines, passing
+// the number of the goroutine running it, from 0. It returns when all jobs
+// are done.
+func runPool(n, count int, job func(worker, i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range jobs {
+				job(w, i)
+			}
+		}(w)
+	}
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// newWorker copies the test database and picks a free port for worker n.
+func (r *Replayer) newWorker(n int) (*worker, error) {
+	databases := r.config.DatabaseList()
+	if len(databases) != 1 {
+		return nil, fmt.Errorf("isolation supports a single database only")
+	}
+	d := databases[0]
+
+	target, err := httpclient.ParseTarget(r.config.Service.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if target.SocketPath != "" {
+		return nil, fmt.Errorf("isolation requires a TCP service.base_url")
+	}
+	port, err := freePort(target.URL.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("finding a free port: %w", err)
+	}
+
+	connString, drop, err := db.CloneDatabase(d.Type, r.config.ReplayConnectionString(d), n)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := *r.config
+	u := *target.URL
+	u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	if target.H2C {
+		u.Scheme = httpclient.SchemeH2C
+	}
+	cfg.Service.BaseURL = u.String()
+	cfg.Replay.TestDatabase.ConnectionString = connString
+
+	snapshotter, err := OpenTestDatabases(&cfg)
+	if err != nil {
+		drop()
+		return nil, err
+	}
+	return &worker{
+		Replayer: &Replayer{
+			config:        &cfg,
+			snapshotter:   snapshotter,
+			hooks:         r.hooks,
+			proto:         r.proto,
+			serviceTLS:    r.serviceTLS,
+			quarantine:    r.quarantine,
+			resolveBodies: r.resolveBodies,
+			workerEnv: []string{
+				fmt.Sprintf("%s=%d", EnvWorker, n),
+				fmt.Sprintf("%s=%s", EnvDatabaseURL, connString),
+				fmt.Sprintf("%s=%d", EnvServicePort, port),
+			},
+		},
+		drop: drop,
+	}, nil
+}
+
+// freePort asks the OS for a port that is free on host.
+func freePort(host string) (int, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
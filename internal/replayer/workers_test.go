@@ -0,0 +1,189 @@
+package replayer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestNewWorker_SQLite(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "app.db")
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO users VALUES (1, 'Alice')"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	cfg := newTestConfig("http://127.0.0.1:8080")
+	cfg.Database.ConnectionString = dbPath
+	r := &Replayer{config: cfg}
+
+	w, err := r.newWorker(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.drop()
+	defer w.Close()
+
+	clonePath := w.config.Replay.TestDatabase.ConnectionString
+	if clonePath == dbPath {
+		t.Fatal("expected the worker to use a copy of the database")
+	}
+	u, err := url.Parse(w.config.Service.BaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Hostname() != "127.0.0.1" || u.Port() == "8080" {
+		t.Errorf("expected a new port on 127.0.0.1, got %s", w.config.Service.BaseURL)
+	}
+	if cfg.Service.BaseURL != "http://127.0.0.1:8080" {
+		t.Errorf("expected the shared config to be unchanged, got %s", cfg.Service.BaseURL)
+	}
+
+	wantEnv := []string{
+		EnvWorker + "=2",
+		EnvDatabaseURL + "=" + clonePath,
+		EnvServicePort + "=" + u.Port(),
+	}
+	if fmt.Sprint(w.workerEnv) != fmt.Sprint(wantEnv) {
+		t.Errorf("workerEnv = %v, want %v", w.workerEnv, wantEnv)
+	}
+
+	// Writes through the worker do not reach the original database
+	if err := w.snapshotter.RestoreAll(map[string][]map[string]any{"users": {}}); err != nil {
+		t.Fatal(err)
+	}
+	conn, err = sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var n int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected the original to keep 1 user, got %d", n)
+	}
+}
+
+func TestReplayAll_IsolatedSetupFailure(t *testing.T) {
+	cfg := newTestConfig("http://127.0.0.1:8080")
+	cfg.Database.ConnectionString = filepath.Join(t.TempDir(), "missing", "app.db")
+	cfg.Service.Command = "true"
+	cfg.Replay.Parallel = true
+	cfg.Replay.Isolation = IsolationDatabase
+
+	mock := &mockSnapshotter{state: map[string][]map[string]any{}}
+	r := &Replayer{config: cfg, snapshotter: mock}
+
+	snaps := []*snapshot.Snapshot{
+		{ID: "a", Request: snapshot.Request{Method: "GET", URL: "/a"}},
+		{ID: "b", Request: snapshot.Request{Method: "GET", URL: "/b"}},
+	}
+	results := r.ReplayAll(snaps, []string{"a.json", "b.json"})
+
+	if !mock.closed {
+		t.Error("expected the shared connection to be closed before copying")
+	}
+	for i, res := range results {
+		if res.SnapshotID != snaps[i].ID || !strings.HasPrefix(res.Error, "Failed to set up replay workers") {
+			t.Errorf("result %d: got ID %q, error %q", i, res.SnapshotID, res.Error)
+		}
+	}
+}
+
+func TestReplayAll_IsolatedBodyFiles(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.db")
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	cfg := newTestConfig("http://127.0.0.1:8080")
+	cfg.Database.ConnectionString = dbPath
+	cfg.Service.Command = fmt.Sprintf("exec '%s' -test.run='^TestEchoServiceHelperProcess$'", os.Args[0])
+	cfg.Service.ReadyCheck = "tcp"
+	cfg.Service.ReadyTimeoutMs = 10000
+	cfg.Replay.Parallel = true
+	cfg.Replay.Isolation = IsolationDatabase
+	cfg.Replay.Workers = 2
+	t.Setenv("REPLAYER_TEST_SERVICE", "1")
+
+	// Bodies above the threshold are kept in sidecar files, and replay
+	// loads snapshots with references to them
+	store := snapshot.NewStore(filepath.Join(dir, "snapshots"), "json")
+	store.BodyFileThreshold = 16
+	store.LazyBodies = true
+	body := map[string]any{"payload": strings.Repeat("x", 64)}
+	headers := map[string]string{snapshot.HeaderContentType: "application/json"}
+	var snaps []*snapshot.Snapshot
+	var paths []string
+	for _, id := range []string{"a", "b"} {
+		path, err := store.Save(&snapshot.Snapshot{
+			ID:            id,
+			Service:       "test-service",
+			Request:       snapshot.Request{Method: "POST", URL: "/echo/" + id, Headers: headers, Body: body},
+			Response:      snapshot.Response{Status: 200, Headers: headers, Body: body},
+			DBStateBefore: map[string][]map[string]any{"users": {}},
+			DBStateAfter:  map[string][]map[string]any{"users": {}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		snap, err := store.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snaps = append(snaps, snap)
+		paths = append(paths, path)
+	}
+
+	r := &Replayer{config: cfg, snapshotter: &mockSnapshotter{state: map[string][]map[string]any{}}}
+	r.SetBodyResolver(store.ResolveBodies)
+	for _, res := range r.ReplayAll(snaps, paths) {
+		if !res.Passed {
+			t.Errorf("%s: expected a pass, got error %q diffs %v", res.SnapshotID, res.Error, res.Diffs)
+		}
+	}
+}
+
+// TestEchoServiceHelperProcess is the service of isolated replay tests: it
+// answers every request with the payload field of its body on the
+// worker's port.
+func TestEchoServiceHelperProcess(t *testing.T) {
+	if os.Getenv("REPLAYER_TEST_SERVICE") == "" {
+		t.Skip("only runs as the service of isolated replay tests")
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", os.Getenv(EnvServicePort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"payload": body["payload"]})
+	}))
+}
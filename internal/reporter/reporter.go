@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/esse/snapshot-tester/internal/asserter"
 	"github.com/esse/snapshot-tester/internal/replayer"
@@ -36,32 +38,104 @@ func Report(results []replayer.TestResult, format Format) (string, error) {
 	}
 }
 
+// skippedReason explains results that were not replayed, in the JUnit and
+// TAP reports.
+const skippedReason = "not replayed: an earlier snapshot failed (fail_fast)"
+
+// quarantinedReason marks failures of quarantined snapshots, which JUnit
+// reports as skipped and TAP as TODO, so they don't fail the build.
+const quarantinedReason = "quarantined"
+
+// durationText renders how long a snapshot took, and how many tries when
+// it was retried.
+func durationText(r replayer.TestResult) string {
+	if r.Attempts > 1 {
+		return fmt.Sprintf("%s, %d attempts", r.Duration, r.Attempts)
+	}
+	return r.Duration.String()
+}
+
 func reportText(results []replayer.TestResult) string {
-	var sb strings.Builder
-	passed, failed, errored := 0, 0, 0
+	var sb, qb strings.Builder
+	passed, failed, errored, cached, skipped, quarantined := 0, 0, 0, 0, 0, 0
 
 	for _, r := range results {
-		if r.Error != "" {
+		if r.Skipped {
+			skipped++
+		} else if r.Quarantined && (r.Error != "" || !r.Passed) {
+			// Listed after the others, so they don't read as failures
+			quarantined++
+			qb.WriteString(failureText(r))
+		} else if r.Error != "" {
 			errored++
-			sb.WriteString(fmt.Sprintf("ERROR %s (%s)\n", r.SnapshotPath, r.Duration))
-			sb.WriteString(fmt.Sprintf("  %s\n\n", r.Error))
+			sb.WriteString(failureText(r))
+		} else if r.Cached {
+			passed++
+			cached++
+			sb.WriteString(fmt.Sprintf("PASS  %s (cached)\n", r.SnapshotPath))
 		} else if r.Passed {
 			passed++
-			sb.WriteString(fmt.Sprintf("PASS  %s (%s)\n", r.SnapshotPath, r.Duration))
+			sb.WriteString(fmt.Sprintf("PASS  %s (%s)\n", r.SnapshotPath, durationText(r)))
+			if warnings := asserter.Warnings(r.Diffs); len(warnings) > 0 {
+				sb.WriteString(asserter.FormatDiffs(warnings))
+				sb.WriteString("\n")
+			}
 		} else {
 			failed++
-			sb.WriteString(fmt.Sprintf("FAIL  %s (%s)\n", r.SnapshotPath, r.Duration))
-			sb.WriteString(asserter.FormatDiffs(r.Diffs))
-			sb.WriteString("\n")
+			sb.WriteString(failureText(r))
 		}
 	}
 
-	sb.WriteString(fmt.Sprintf("\nResults: %d passed, %d failed, %d errors, %d total\n",
-		passed, failed, errored, len(results)))
+	if quarantined > 0 {
+		sb.WriteString(fmt.Sprintf("\nQuarantined snapshots that did not pass (not counted as failures): %d\n\n", quarantined))
+		sb.WriteString(qb.String())
+	}
+	if skipped > 0 {
+		sb.WriteString(fmt.Sprintf("Stopped after the first failure (fail_fast): %d snapshot(s) not replayed\n", skipped))
+	}
+
+	summary := fmt.Sprintf("%d passed", passed)
+	if cached > 0 {
+		summary = fmt.Sprintf("%d passed (%d cached)", passed, cached)
+	}
+	summary += fmt.Sprintf(", %d failed, %d errors", failed, errored)
+	if quarantined > 0 {
+		summary += fmt.Sprintf(", %d quarantined", quarantined)
+	}
+	if skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+	sb.WriteString(fmt.Sprintf("\nResults: %s, %d total\n", summary, len(results)))
+
+	return sb.String()
+}
 
+// failureText renders a result that errored or failed, with its error or
+// differences and the service output.
+func failureText(r replayer.TestResult) string {
+	var sb strings.Builder
+	if r.Error != "" {
+		sb.WriteString(fmt.Sprintf("ERROR %s (%s)\n", r.SnapshotPath, durationText(r)))
+		sb.WriteString(fmt.Sprintf("  %s\n", r.Error))
+	} else {
+		sb.WriteString(fmt.Sprintf("FAIL  %s (%s)\n", r.SnapshotPath, durationText(r)))
+		sb.WriteString(asserter.FormatDiffs(r.Diffs))
+	}
+	sb.WriteString(serviceLogsText(r.ServiceLogs))
+	sb.WriteString("\n")
 	return sb.String()
 }
 
+// serviceLogsText renders the managed service's output, indented under the
+// result it belongs to.
+func serviceLogsText(logs string) string {
+	logs = strings.TrimRight(logs, "\n")
+	if logs == "" {
+		return ""
+	}
+	return "  Service logs:\n    " + strings.ReplaceAll(logs, "\n", "\n    ") + "\n"
+}
+
 // JUnit XML types
 type junitTestSuites struct {
 	XMLName xml.Name         `xml:"testsuites"`
@@ -74,15 +148,29 @@ type junitTestSuite struct {
 	Tests    int             `xml:"tests,attr"`
 	Failures int             `xml:"failures,attr"`
 	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
 	Cases    []junitTestCase `xml:"testcase"`
 }
 
 type junitTestCase struct {
-	XMLName   xml.Name      `xml:"testcase"`
-	Name      string        `xml:"name,attr"`
-	Time      string        `xml:"time,attr"`
-	Failure   *junitFailure `xml:"failure,omitempty"`
-	Error     *junitError   `xml:"error,omitempty"`
+	XMLName    xml.Name         `xml:"testcase"`
+	Name       string           `xml:"name,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitFailure    `xml:"failure,omitempty"`
+	Error      *junitError      `xml:"error,omitempty"`
+	Skipped    *junitSkipped    `xml:"skipped,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+	SystemErr  string           `xml:"system-err,omitempty"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
 }
 
 type junitFailure struct {
@@ -95,8 +183,12 @@ type junitError struct {
 	Body    string `xml:",chardata"`
 }
 
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
 func reportJUnit(results []replayer.TestResult) (string, error) {
-	failures, errors := 0, 0
+	failures, errors, skipped := 0, 0, 0
 	var cases []junitTestCase
 
 	for _, r := range results {
@@ -105,7 +197,21 @@ func reportJUnit(results []replayer.TestResult) (string, error) {
 			Time: fmt.Sprintf("%.3f", r.Duration.Seconds()),
 		}
 
-		if r.Error != "" {
+		if r.Skipped {
+			skipped++
+			tc.Skipped = &junitSkipped{Message: skippedReason}
+			cases = append(cases, tc)
+			continue
+		}
+
+		if r.Quarantined && (r.Error != "" || !r.Passed) {
+			skipped++
+			message := r.Error
+			if message == "" {
+				message = fmt.Sprintf("%d differences found", len(r.Diffs))
+			}
+			tc.Skipped = &junitSkipped{Message: quarantinedReason + ": " + message}
+		} else if r.Error != "" {
 			errors++
 			tc.Error = &junitError{
 				Message: r.Error,
@@ -115,10 +221,17 @@ func reportJUnit(results []replayer.TestResult) (string, error) {
 			failures++
 			tc.Failure = &junitFailure{
 				Message: fmt.Sprintf("%d differences found", len(r.Diffs)),
-				Body:    asserter.FormatDiffs(r.Diffs),
+				Body:    truncateOutput(asserter.FormatDiffs(r.Diffs)),
 			}
 		}
 
+		// Attach debugging context to anything that did not pass
+		if r.Error != "" || !r.Passed {
+			tc.Properties = junitResultProperties(r)
+			tc.SystemOut = junitSystemOut(r)
+			tc.SystemErr = truncateOutput(r.ServiceLogs)
+		}
+
 		cases = append(cases, tc)
 	}
 
@@ -129,6 +242,7 @@ func reportJUnit(results []replayer.TestResult) (string, error) {
 				Tests:    len(results),
 				Failures: failures,
 				Errors:   errors,
+				Skipped:  skipped,
 				Cases:    cases,
 			},
 		},
@@ -142,19 +256,117 @@ func reportJUnit(results []replayer.TestResult) (string, error) {
 	return xml.Header + string(data), nil
 }
 
+// junitMaxOutputBytes caps the size of failure bodies and system-out so a
+// multi-megabyte response cannot bloat the report past what CI UIs render.
+const junitMaxOutputBytes = 64 * 1024
+
+func truncateOutput(s string) string {
+	if len(s) <= junitMaxOutputBytes {
+		return s
+	}
+	// Back up to a rune boundary so the cut never produces invalid UTF-8
+	cut := junitMaxOutputBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("\n... [truncated %d bytes]", len(s)-cut)
+}
+
+func junitResultProperties(r replayer.TestResult) *junitProperties {
+	props := []junitProperty{
+		{Name: "snapshot.id", Value: r.SnapshotID},
+		{Name: "snapshot.path", Value: r.SnapshotPath},
+		{Name: "request.method", Value: r.Method},
+		{Name: "request.url", Value: r.URL},
+	}
+	if len(r.Tags) > 0 {
+		props = append(props, junitProperty{Name: "snapshot.tags", Value: strings.Join(r.Tags, ",")})
+	}
+	if r.Quarantined {
+		props = append(props, junitProperty{Name: "snapshot.quarantined", Value: "true"})
+	}
+	if r.ActualResponse != nil {
+		props = append(props, junitProperty{Name: "actual.status", Value: fmt.Sprintf("%d", r.ActualResponse.Status)})
+	}
+	return &junitProperties{Properties: props}
+}
+
+// junitSystemOut renders the actual response and a per-table summary of DB differences.
+func junitSystemOut(r replayer.TestResult) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Request: %s %s\n", r.Method, r.URL))
+
+	if r.ActualResponse != nil {
+		sb.WriteString(fmt.Sprintf("\nActual response (status %d):\n", r.ActualResponse.Status))
+		if r.ActualResponse.Body != nil {
+			body, err := json.MarshalIndent(r.ActualResponse.Body, "", "  ")
+			if err != nil {
+				body = []byte(fmt.Sprintf("%v", r.ActualResponse.Body))
+			}
+			sb.Write(body)
+			sb.WriteString("\n")
+		}
+	}
+
+	if summary := dbDiffSummary(r.Diffs); summary != "" {
+		sb.WriteString("\nDB differences:\n")
+		sb.WriteString(summary)
+	}
+
+	return truncateOutput(sb.String())
+}
+
+// dbDiffSummary counts DB differences per table, e.g. "  users: 2 difference(s)".
+func dbDiffSummary(diffs []asserter.Diff) string {
+	counts := make(map[string]int)
+	var tables []string
+	for _, d := range diffs {
+		if !strings.HasPrefix(d.Path, "db.") {
+			continue
+		}
+		// Table names may be schema-qualified, so cut at the row selector
+		// rather than the first "."
+		table := strings.TrimPrefix(d.Path, "db.")
+		if i := strings.Index(table, "["); i >= 0 {
+			table = table[:i]
+		}
+		table = strings.TrimSuffix(table, ".length")
+		if counts[table] == 0 {
+			tables = append(tables, table)
+		}
+		counts[table]++
+	}
+	sort.Strings(tables)
+
+	var sb strings.Builder
+	for _, t := range tables {
+		sb.WriteString(fmt.Sprintf("  %s: %d difference(s)\n", t, counts[t]))
+	}
+	return sb.String()
+}
+
 func reportTAP(results []replayer.TestResult) string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("TAP version 13\n1..%d\n", len(results)))
 
 	for i, r := range results {
 		num := i + 1
-		if r.Error != "" {
-			sb.WriteString(fmt.Sprintf("not ok %d - %s\n", num, r.SnapshotPath))
+		if r.Skipped {
+			sb.WriteString(fmt.Sprintf("ok %d - %s # SKIP %s\n", num, r.SnapshotPath, skippedReason))
+		} else if r.Error != "" {
+			sb.WriteString(fmt.Sprintf("not ok %d - %s%s\n", num, r.SnapshotPath, tapDirective(r)))
 			sb.WriteString(fmt.Sprintf("  ---\n  error: %s\n  ...\n", r.Error))
+		} else if r.Cached {
+			sb.WriteString(fmt.Sprintf("ok %d - %s # cached\n", num, r.SnapshotPath))
 		} else if r.Passed {
 			sb.WriteString(fmt.Sprintf("ok %d - %s\n", num, r.SnapshotPath))
+			if warnings := asserter.Warnings(r.Diffs); len(warnings) > 0 {
+				for _, d := range warnings {
+					sb.WriteString(fmt.Sprintf("# warning: %s: %s\n", d.Path, d.Message))
+				}
+			}
 		} else {
-			sb.WriteString(fmt.Sprintf("not ok %d - %s\n", num, r.SnapshotPath))
+			sb.WriteString(fmt.Sprintf("not ok %d - %s%s\n", num, r.SnapshotPath, tapDirective(r)))
 			sb.WriteString("  ---\n")
 			for _, d := range r.Diffs {
 				sb.WriteString(fmt.Sprintf("  - path: %s\n    message: %s\n", d.Path, d.Message))
@@ -166,6 +378,15 @@ func reportTAP(results []replayer.TestResult) string {
 	return sb.String()
 }
 
+// tapDirective marks failures of quarantined snapshots as TODO, which TAP
+// consumers don't count as failures.
+func tapDirective(r replayer.TestResult) string {
+	if r.Quarantined {
+		return " # TODO " + quarantinedReason
+	}
+	return ""
+}
+
 func reportJSON(results []replayer.TestResult) (string, error) {
 	data, err := json.MarshalIndent(results, "", "  ")
 	if err != nil {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/esse/snapshot-tester/internal/asserter"
 	"github.com/esse/snapshot-tester/internal/replayer"
+	"github.com/esse/snapshot-tester/internal/snapshot"
 )
 
 func sampleResults() []replayer.TestResult {
@@ -101,3 +102,240 @@ func TestReportJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestReportJUnit_FailureContext(t *testing.T) {
+	results := []replayer.TestResult{
+		{
+			SnapshotID:   "fail1",
+			SnapshotPath: "snapshots/svc/POST_users/001.snapshot.json",
+			Method:       "POST",
+			URL:          "/users",
+			Tags:         []string{"users", "smoke"},
+			Duration:     100 * time.Millisecond,
+			ActualResponse: &snapshot.Response{
+				Status: 500,
+				Body:   map[string]any{"error": "boom"},
+			},
+			Diffs: []asserter.Diff{
+				{Path: "response.status", Expected: 201, Actual: 500, Message: "Status code mismatch"},
+				{Path: "db.users.length", Expected: 2, Actual: 1, Message: "Row count mismatch"},
+				{Path: "db.users[1]", Message: "Missing row in actual"},
+				{Path: "db.audit.events[0].kind", Message: "Value mismatch"},
+			},
+		},
+	}
+
+	output, err := Report(results, FormatJUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<property name="snapshot.id" value="fail1"></property>`,
+		`<property name="request.method" value="POST"></property>`,
+		`<property name="snapshot.tags" value="users,smoke"></property>`,
+		`<property name="actual.status" value="500"></property>`,
+		"<system-out>",
+		"Actual response (status 500)",
+		"boom",
+		"users: 2 difference(s)",
+		"audit.events: 1 difference(s)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected JUnit output to contain %q\n%s", want, output)
+		}
+	}
+}
+
+func TestReportJUnit_PassHasNoSystemOut(t *testing.T) {
+	output, err := Report(sampleResults()[:1], FormatJUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(output, "<system-out>") || strings.Contains(output, "<properties>") {
+		t.Errorf("expected passing cases to omit debugging context\n%s", output)
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	long := strings.Repeat("x", junitMaxOutputBytes+10)
+	got := truncateOutput(long)
+	if !strings.HasSuffix(got, "[truncated 10 bytes]") {
+		t.Errorf("expected truncation marker, got suffix %q", got[len(got)-30:])
+	}
+	if truncateOutput("short") != "short" {
+		t.Error("expected short output to be unchanged")
+	}
+}
+
+func TestReportJSON_FailureArtifacts(t *testing.T) {
+	results := []replayer.TestResult{
+		{
+			SnapshotID:     "fail1",
+			ActualResponse: &snapshot.Response{Status: 500},
+			ActualDBHash:   "abc123",
+			Diffs: []asserter.Diff{
+				{Path: "response.status", Kind: asserter.DiffKindStatusMismatch, Expected: 201, Actual: 500, Message: "Status code mismatch"},
+			},
+		},
+	}
+	output, err := Report(results, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"ActualResponse"`, `"ActualDBHash": "abc123"`, `"kind": "status_mismatch"`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected JSON output to contain %s\n%s", want, output)
+		}
+	}
+}
+
+func TestReportText_PassWithWarnings(t *testing.T) {
+	results := []replayer.TestResult{
+		{
+			SnapshotPath: "snapshots/svc/GET_users/001.snapshot.json",
+			Passed:       true,
+			Diffs: []asserter.Diff{
+				{Path: "response.body.nickname", Severity: asserter.SeverityWarning, Message: "Unexpected field (additive change tolerated)"},
+			},
+		},
+	}
+	output, err := Report(results, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "PASS") || !strings.Contains(output, "response.body.nickname [warning]") {
+		t.Errorf("expected passing result to list warnings\n%s", output)
+	}
+}
+
+func TestReportText_Cached(t *testing.T) {
+	results := append(sampleResults(), replayer.TestResult{
+		SnapshotPath: "snapshots/svc/GET_orders/001.snapshot.json",
+		Passed:       true,
+		Cached:       true,
+	})
+
+	output, err := Report(results, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "PASS  snapshots/svc/GET_orders/001.snapshot.json (cached)") {
+		t.Errorf("expected cached result to be marked, got:\n%s", output)
+	}
+	if !strings.Contains(output, "2 passed (1 cached), 1 failed, 1 errors, 4 total") {
+		t.Errorf("expected cached count in summary, got:\n%s", output)
+	}
+
+	tap, _ := Report(results, FormatTAP)
+	if !strings.Contains(tap, "ok 4 - snapshots/svc/GET_orders/001.snapshot.json # cached") {
+		t.Errorf("expected cached TAP line, got:\n%s", tap)
+	}
+}
+
+func TestReportText_Attempts(t *testing.T) {
+	results := []replayer.TestResult{
+		{SnapshotPath: "a.json", Passed: true, Duration: 2 * time.Millisecond, Attempts: 3},
+		{SnapshotPath: "b.json", Error: "Failed to send request: EOF", Duration: time.Millisecond, Attempts: 2},
+		{SnapshotPath: "c.json", Passed: true, Duration: time.Millisecond, Attempts: 1},
+	}
+	output, err := Report(results, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"PASS  a.json (2ms, 3 attempts)", "ERROR b.json (1ms, 2 attempts)", "PASS  c.json (1ms)\n"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in the report, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestReport_Skipped(t *testing.T) {
+	results := sampleResults()
+	results = append(results, replayer.TestResult{SnapshotPath: "d.json", Skipped: true})
+
+	text, err := Report(results, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(text, "d.json") || !strings.Contains(text, "1 skipped, 4 total") {
+		t.Errorf("expected the skipped snapshot only in the summary, got:\n%s", text)
+	}
+
+	junit, err := Report(results, FormatJUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(junit, `skipped="1"`) || !strings.Contains(junit, "<skipped message=") {
+		t.Errorf("expected a skipped test case in JUnit output, got:\n%s", junit)
+	}
+
+	tap, err := Report(results, FormatTAP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(tap, "ok 4 - d.json # SKIP") {
+		t.Errorf("expected a TAP skip directive, got:\n%s", tap)
+	}
+}
+
+func TestReport_Quarantined(t *testing.T) {
+	results := sampleResults()
+	results[1].Quarantined = true
+	results[2].Quarantined = true
+
+	text, err := Report(results, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "1 passed, 0 failed, 0 errors, 2 quarantined, 3 total") {
+		t.Errorf("expected quarantined failures counted separately, got:\n%s", text)
+	}
+	section := strings.Index(text, "Quarantined snapshots")
+	if section < 0 || strings.Index(text, "FAIL  snapshots/svc/POST_users") < section || strings.Index(text, "ERROR snapshots/svc/DELETE_users") < section {
+		t.Errorf("expected the quarantined failures listed in their own section, got:\n%s", text)
+	}
+
+	junit, err := Report(results, FormatJUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`failures="0"`, `errors="0"`, `skipped="2"`, `<skipped message="quarantined: 1 differences found">`, `<skipped message="quarantined: connection refused">`, `name="snapshot.quarantined" value="true"`} {
+		if !strings.Contains(junit, want) {
+			t.Errorf("expected JUnit output to contain %q\n%s", want, junit)
+		}
+	}
+
+	tap, err := Report(results, FormatTAP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"not ok 2 - snapshots/svc/POST_users/001.snapshot.json # TODO quarantined", "not ok 3 - snapshots/svc/DELETE_users/001.snapshot.json # TODO quarantined"} {
+		if !strings.Contains(tap, want) {
+			t.Errorf("expected TAP output to contain %q\n%s", want, tap)
+		}
+	}
+}
+
+func TestReport_ServiceLogs(t *testing.T) {
+	results := sampleResults()
+	results[1].ServiceLogs = "starting\npanic: nil map\n"
+	results[2].ServiceLogs = "listen tcp :8080: address already in use\n"
+
+	text, err := Report(results, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"  Service logs:\n    starting\n    panic: nil map\n", "    listen tcp :8080"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected text output to contain %q\n%s", want, text)
+		}
+	}
+
+	junit, err := Report(results, FormatJUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(junit, "<system-err>starting&#xA;panic: nil map&#xA;</system-err>") {
+		t.Errorf("expected the service logs in system-err\n%s", junit)
+	}
+}
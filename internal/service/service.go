@@ -0,0 +1,322 @@
+// Package service runs the service under test as a subprocess, for record
+// and replay: it injects environment variables, waits until the service is
+// ready and keeps the tail of its output.
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/httpclient"
+)
+
+// EnvSocket tells a managed service which unix socket to listen on when
+// service.base_url is a unix:// URL.
+const EnvSocket = "SNAPSHOT_SERVICE_SOCKET"
+
+// SocketEnv returns the EnvSocket variable for unix socket targets, or nil.
+func SocketEnv(cfg *config.Config) []string {
+	if target, err := httpclient.ParseTarget(cfg.Service.BaseURL); err == nil && target.SocketPath != "" {
+		return []string{fmt.Sprintf("%s=%s", EnvSocket, target.SocketPath)}
+	}
+	return nil
+}
+
+// ProxyEnv returns the variables routing a service's outgoing HTTP calls
+// through the proxy at proxyURL, in both the upper and lower case forms
+// runtimes look for. With https set, HTTPS calls are routed too.
+func ProxyEnv(proxyURL string, https bool) []string {
+	names := []string{"HTTP_PROXY", "http_proxy"}
+	if https {
+		names = append(names, "HTTPS_PROXY", "https_proxy")
+	}
+	env := make([]string, len(names))
+	for i, name := range names {
+		env[i] = name + "=" + proxyURL
+	}
+	return env
+}
+
+// Readiness checks run after starting a managed service, set by
+// service.ready_check.
+const (
+	ReadyCheckSleep = "sleep" // wait startup_time_ms (default)
+	ReadyCheckTCP   = "tcp"   // poll until the service accepts connections
+	ReadyCheckHTTP  = "http"  // poll service.ready_path until it answers 2xx
+)
+
+// Readiness polling: the pause between probes and the longest a single
+// probe may take.
+const (
+	readyPollInterval = 100 * time.Millisecond
+	readyProbeTimeout = time.Second
+)
+
+// maxLogBytes caps the service output kept; the start of longer output is
+// dropped.
+const maxLogBytes = 64 * 1024
+
+// Process is a service started from service.command.
+type Process struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	logs   *tailBuffer
+	done   chan struct{} // closed once the process has exited
+}
+
+// StartError reports a managed service that exited or never became
+// ready, with the output it wrote before it was stopped.
+type StartError struct {
+	Err  error
+	Logs string
+}
+
+func (e *StartError) Error() string { return e.Err.Error() }
+func (e *StartError) Unwrap() error { return e.Err }
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	max     int
+	written int64 // bytes written in total, including dropped ones
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.written += int64(len(p))
+	b.buf.Write(p)
+	if over := b.buf.Len() - b.max; over > 0 {
+		b.buf.Next(over)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// since returns what was written after the first n bytes, as far as it is
+// still kept, and the total written so far.
+func (b *tailBuffer) since(n int64) (string, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data := b.buf.Bytes()
+	if newer := b.written - n; newer < int64(len(data)) {
+		data = data[len(data)-int(max(newer, 0)):]
+	}
+	return string(data), b.written
+}
+
+// Start launches the service as a subprocess with the given environment
+// variables injected. It returns once the service is ready (see waitReady);
+// a service that exits or never becomes ready is stopped and reported with
+// its output as a *StartError.
+func Start(cfg *config.Config, extraEnv []string) (*Process, error) {
+	if cfg.Service.Command == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", cfg.Service.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", cfg.Service.Command)
+	}
+
+	// Inherit current environment and add extras. Output still goes to the
+	// console and is also kept for the test result.
+	cmd.Env = append(os.Environ(), extraEnv...)
+	logs := &tailBuffer{max: maxLogBytes}
+	cmd.Stdout = io.MultiWriter(os.Stdout, logs)
+	cmd.Stderr = io.MultiWriter(os.Stderr, logs)
+	// Don't wait forever on output pipes held open by the service's children
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("starting service command %q: %w", cfg.Service.Command, err)
+	}
+
+	slog.Info("service started", "pid", cmd.Process.Pid, "command", cfg.Service.Command)
+	for _, env := range extraEnv {
+		slog.Debug("service env injected", "env", env)
+	}
+
+	svc := &Process{cmd: cmd, cancel: cancel, logs: logs, done: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(svc.done)
+	}()
+
+	if err := svc.waitReady(cfg); err != nil {
+		svc.Stop()
+		return nil, &StartError{Err: err, Logs: svc.Logs()}
+	}
+	return svc, nil
+}
+
+// waitReady waits for the service to start. Without a readiness check it
+// sleeps for startup_time_ms; otherwise it probes the service until a probe
+// succeeds, failing as soon as the process exits or once ready_timeout_ms
+// has passed.
+func (s *Process) waitReady(cfg *config.Config) error {
+	var probe func(context.Context) error
+	var err error
+	switch cfg.Service.ReadyCheck {
+	case ReadyCheckTCP:
+		probe, err = tcpProbe(cfg.Service.BaseURL)
+	case ReadyCheckHTTP:
+		probe, err = httpProbe(cfg)
+	default:
+		time.Sleep(time.Duration(cfg.Service.StartupTimeMs) * time.Millisecond)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(cfg.Service.ReadyTimeoutMs) * time.Millisecond
+	start := time.Now()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), readyProbeTimeout)
+		err := probe(ctx)
+		cancel()
+		if err == nil {
+			slog.Info("service ready", "pid", s.cmd.Process.Pid, "after", time.Since(start).Round(time.Millisecond))
+			return nil
+		}
+		select {
+		case <-s.done:
+			return fmt.Errorf("service exited before becoming ready (%v)", s.cmd.ProcessState)
+		case <-deadline.C:
+			return fmt.Errorf("service not ready after %v: %w", timeout, err)
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+// tcpProbe returns a probe that succeeds once the service at baseURL
+// accepts connections, on its port or unix socket.
+func tcpProbe(baseURL string) (func(context.Context) error, error) {
+	target, err := httpclient.ParseTarget(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	network, addr := "tcp", target.URL.Host
+	if target.SocketPath != "" {
+		network, addr = "unix", target.SocketPath
+	} else if target.URL.Port() == "" {
+		port := "80"
+		if target.URL.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(target.URL.Hostname(), port)
+	}
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}, nil
+}
+
+// httpProbe returns a probe that succeeds once a GET of service.ready_path
+// answers with a 2xx status.
+func httpProbe(cfg *config.Config) (func(context.Context) error, error) {
+	target, err := httpclient.ParseTarget(cfg.Service.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if target.TLS, err = httpclient.LoadTLS(cfg.Service.ClientCert, cfg.Service.ClientKey, cfg.Service.CACert); err != nil {
+		return nil, err
+	}
+	path := cfg.Service.ReadyPath
+	if path == "" {
+		path = "/"
+	}
+	readyURL := target.BaseURL() + path
+	client := &http.Client{Transport: target.Transport()}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, readyURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s returned %d", path, resp.StatusCode)
+		}
+		return nil
+	}, nil
+}
+
+// Logs returns the stdout and stderr output of the service so far,
+// interleaved as written.
+func (s *Process) Logs() string {
+	if s == nil {
+		return ""
+	}
+	return s.logs.String()
+}
+
+// LogsSince returns the output written after the first offset bytes, as far
+// as it is still kept, and the offset to pass next time, e.g. to split the
+// output of a long-running service by snapshot.
+func (s *Process) LogsSince(offset int64) (string, int64) {
+	if s == nil {
+		return "", 0
+	}
+	return s.logs.since(offset)
+}
+
+// LogOffset returns the offset to pass to LogsSince for the output written
+// from now on.
+func (s *Process) LogOffset() int64 {
+	if s == nil {
+		return 0
+	}
+	s.logs.mu.Lock()
+	defer s.logs.mu.Unlock()
+	return s.logs.written
+}
+
+// Stop terminates the service.
+func (s *Process) Stop() {
+	if s == nil {
+		return
+	}
+	s.cancel()
+	// Wait briefly for graceful shutdown
+	select {
+	case <-s.done:
+		slog.Info("service stopped", "pid", s.cmd.Process.Pid)
+	case <-time.After(5 * time.Second):
+		slog.Warn("service did not stop gracefully, killing", "pid", s.cmd.Process.Pid)
+		s.cmd.Process.Kill()
+	}
+}
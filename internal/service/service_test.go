@@ -0,0 +1,268 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/esse/snapshot-tester/internal/config"
+)
+
+func TestStart_EmptyCommand(t *testing.T) {
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Command:       "",
+			StartupTimeMs: 10,
+		},
+	}
+
+	svc, err := Start(cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc != nil {
+		t.Error("expected nil service for empty command")
+	}
+}
+
+func TestStart_ShortLivedCommand(t *testing.T) {
+	// Even if the command exits quickly, Start() succeeds because sh starts fine.
+	// This verifies the service can be started and stopped cleanly for short-lived processes.
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Command:       "echo hello",
+			StartupTimeMs: 10,
+		},
+	}
+
+	svc, err := Start(cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc == nil {
+		t.Fatal("expected non-nil service")
+	}
+	svc.Stop()
+}
+
+func TestStart_WithExtraEnv(t *testing.T) {
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Command:       "sleep 0.01",
+			StartupTimeMs: 50,
+		},
+	}
+
+	svc, err := Start(cfg, []string{"TEST_VAR=test_value"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc == nil {
+		t.Fatal("expected non-nil service")
+	}
+	defer svc.Stop()
+
+	if svc.cmd == nil {
+		t.Error("expected non-nil cmd")
+	}
+}
+
+func TestProcess_StopNil(t *testing.T) {
+	// Stop on nil should not panic
+	var svc *Process
+	svc.Stop() // should be a no-op
+}
+
+func TestStart_StopGracefully(t *testing.T) {
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Command:       "sleep 10",
+			StartupTimeMs: 10,
+		},
+	}
+
+	svc, err := Start(cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc == nil {
+		t.Fatal("expected non-nil service")
+	}
+
+	// Stop should terminate the process
+	svc.Stop()
+}
+
+func TestStart_Logs(t *testing.T) {
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			Command:       "echo out; echo err >&2",
+			StartupTimeMs: 50,
+		},
+	}
+
+	svc, err := Start(cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.Stop()
+	logs := svc.Logs()
+	if !strings.Contains(logs, "out\n") || !strings.Contains(logs, "err\n") {
+		t.Errorf("expected stdout and stderr in the logs, got %q", logs)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 5}
+	b.Write([]byte("abc"))
+	b.Write([]byte("defg"))
+	if got := b.String(); got != "cdefg" {
+		t.Errorf("expected the last 5 bytes, got %q", got)
+	}
+	if got, next := b.since(3); got != "defg" || next != 7 {
+		t.Errorf("expected the bytes after the first 3 and offset 7, got %q %d", got, next)
+	}
+	if got, _ := b.since(0); got != "cdefg" {
+		t.Errorf("expected what is still kept, got %q", got)
+	}
+	if got, _ := b.since(7); got != "" {
+		t.Errorf("expected nothing new, got %q", got)
+	}
+	if off := (&Process{logs: b}).LogOffset(); off != 7 {
+		t.Errorf("expected the offset of the next output, got %d", off)
+	}
+	if off := (*Process)(nil).LogOffset(); off != 0 {
+		t.Errorf("expected no offset without a process, got %d", off)
+	}
+}
+
+func TestProxyEnv(t *testing.T) {
+	want := []string{"HTTP_PROXY=http://p:1", "http_proxy=http://p:1", "HTTPS_PROXY=http://p:1", "https_proxy=http://p:1"}
+	if got := ProxyEnv("http://p:1", true); !reflect.DeepEqual(got, want) {
+		t.Errorf("ProxyEnv() = %v, want %v", got, want)
+	}
+	if got := ProxyEnv("http://p:1", false); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("ProxyEnv() without https = %v, want %v", got, want[:2])
+	}
+}
+
+// closedPort returns a loopback address nothing listens on.
+func closedPort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestStart_ReadyCheckTCP(t *testing.T) {
+	addr := closedPort(t)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { ln.Close() })
+	}()
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			BaseURL:        "http://" + addr,
+			Command:        "sleep 10",
+			ReadyTimeoutMs: 10000,
+			ReadyCheck:     ReadyCheckTCP,
+		},
+	}
+
+	start := time.Now()
+	svc, err := Start(cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer svc.Stop()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected Start to return once the port opened, took %v", elapsed)
+	}
+}
+
+func TestStart_ReadyCheckFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		timeout int
+		wantErr string
+		wantLog string
+	}{
+		{"exits", "echo boom; exit 3", 10000, "exited before becoming ready", "boom"},
+		{"times out", "echo waiting; sleep 10", 300, "not ready after 300ms", "waiting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Service: config.ServiceConfig{
+					BaseURL:        "http://" + closedPort(t),
+					Command:        tt.command,
+					ReadyTimeoutMs: tt.timeout,
+					ReadyCheck:     ReadyCheckTCP,
+				},
+			}
+			start := time.Now()
+			svc, err := Start(cfg, nil)
+			if err == nil {
+				svc.Stop()
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %q in the error, got %v", tt.wantErr, err)
+			}
+			var startErr *StartError
+			if !errors.As(err, &startErr) || !strings.Contains(startErr.Logs, tt.wantLog) {
+				t.Errorf("expected the service output %q with the error, got %#v", tt.wantLog, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected Start to fail fast, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestStart_ReadyCheckHTTP(t *testing.T) {
+	var probes atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/healthz" {
+			http.NotFound(w, r)
+			return
+		}
+		if probes.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer target.Close()
+	cfg := &config.Config{
+		Service: config.ServiceConfig{
+			BaseURL:        target.URL + "/api",
+			Command:        "sleep 10",
+			ReadyTimeoutMs: 10000,
+			ReadyCheck:     ReadyCheckHTTP,
+			ReadyPath:      "/healthz",
+		},
+	}
+
+	svc, err := Start(cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer svc.Stop()
+	if n := probes.Load(); n != 3 {
+		t.Errorf("expected readiness after 3 probes, got %d", n)
+	}
+}
@@ -0,0 +1,118 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// AuditLogFile is the name of the append-only audit log kept in the snapshot directory.
+const AuditLogFile = ".audit.jsonl"
+
+// Audit actions recorded for snapshot modifications.
+const (
+	AuditActionUpdate     = "update"
+	AuditActionDelete     = "delete"
+	AuditActionQuarantine = "quarantine" // added to the quarantine list
+	AuditActionRelease    = "release"    // removed from the quarantine list
+)
+
+// AuditEntry records a single modification of a snapshot file.
+type AuditEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	User       string    `json:"user"`
+	Command    string    `json:"command"`
+	Action     string    `json:"action"`
+	Path       string    `json:"path"`
+	SnapshotID string    `json:"snapshot_id,omitempty"`
+}
+
+// AuditLog appends entries to a JSON-lines file. Entries are never rewritten.
+type AuditLog struct {
+	Path    string
+	User    string
+	Command string
+}
+
+// NewAuditLog creates an audit log in baseDir attributing entries to the
+// current OS user and the given command.
+func NewAuditLog(baseDir, command string) *AuditLog {
+	return &AuditLog{
+		Path:    filepath.Join(baseDir, AuditLogFile),
+		User:    currentUser(),
+		Command: command,
+	}
+}
+
+// Record appends an entry for the given action.
+func (a *AuditLog) Record(action, path, snapshotID string) error {
+	entry := AuditEntry{
+		Timestamp:  time.Now().UTC(),
+		User:       a.User,
+		Command:    a.Command,
+		Action:     action,
+		Path:       path,
+		SnapshotID: snapshotID,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshaling audit entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.Path), 0o755); err != nil {
+		return fmt.Errorf("creating audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(a.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	return nil
+}
+
+// ReadAuditLog returns all entries from the audit log in baseDir, oldest first.
+// A missing log yields no entries.
+func ReadAuditLog(baseDir string) ([]AuditEntry, error) {
+	f, err := os.Open(filepath.Join(baseDir, AuditLogFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("parsing audit log line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,99 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreAudit_UpdateAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	store.Audit = NewAuditLog(dir, "snapshot-tester update")
+	store.Audit.User = "alice"
+
+	snap := &Snapshot{
+		ID:       "audit1",
+		Service:  "svc",
+		Request:  Request{Method: "GET", URL: "/users"},
+		Response: Response{Status: 200},
+	}
+	path, err := store.Save(snap)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Save is not a modification of existing evidence and is not audited
+	entries, err := ReadAuditLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no audit entries after Save, got %d", len(entries))
+	}
+
+	snap.Response.Status = 201
+	if err := store.Update(path, snap); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	store.Audit.Command = "snapshot-tester delete"
+	if err := store.Delete(path); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected snapshot file to be removed")
+	}
+
+	entries, err = ReadAuditLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(entries))
+	}
+	if entries[0].Action != AuditActionUpdate || entries[0].Command != "snapshot-tester update" {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Action != AuditActionDelete || entries[1].Command != "snapshot-tester delete" {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+	for _, e := range entries {
+		if e.User != "alice" || e.Path != path || e.SnapshotID != "audit1" || e.Timestamp.IsZero() {
+			t.Errorf("incomplete audit entry: %+v", e)
+		}
+	}
+
+	// The audit log must not be picked up as a snapshot
+	all, _, err := store.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 0 {
+		t.Errorf("expected no snapshots after delete, got %d", len(all))
+	}
+}
+
+func TestReadAuditLog_Missing(t *testing.T) {
+	entries, err := ReadAuditLog(filepath.Join(t.TempDir(), "nope"))
+	if err != nil {
+		t.Fatalf("expected no error for missing log, got %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries, got %d", len(entries))
+	}
+}
+
+func TestStoreDelete_MissingFile(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	store.Audit = NewAuditLog(dir, "test")
+
+	if err := store.Delete(filepath.Join(dir, "missing.snapshot.json")); err == nil {
+		t.Fatal("expected error deleting a missing snapshot")
+	}
+	entries, _ := ReadAuditLog(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected failed delete not to be audited, got %d entries", len(entries))
+	}
+}
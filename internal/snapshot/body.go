@@ -3,29 +3,66 @@ package snapshot
 import (
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
 )
 
 // BodyEncoding indicates how a body was encoded in the snapshot.
 const (
-	BodyEncodingJSON   = ""       // default: stored as parsed JSON
-	BodyEncodingText   = "text"   // stored as UTF-8 string
-	BodyEncodingBase64 = "base64" // stored as base64 (for binary payloads like protobuf)
+	BodyEncodingJSON    = ""        // default: stored as parsed JSON
+	BodyEncodingText    = "text"    // stored as UTF-8 string
+	BodyEncodingBase64  = "base64"  // stored as base64 (for binary payloads like protobuf)
+	BodyEncodingXML     = "xml"     // stored as a structured element tree (see ParseXML)
+	BodyEncodingMsgPack = "msgpack" // stored as the decoded document (see ParseMsgPack)
+	BodyEncodingCBOR    = "cbor"    // stored as the decoded document (see ParseCBOR)
+	BodyEncodingForm    = "form"    // stored as a field map (see ParseForm)
+	BodyEncodingNDJSON  = "ndjson"  // stored as the list of line values (see ParseNDJSON)
+
+	// Stored as the JSON form of a protobuf message, or of each message of a
+	// gRPC body, with its type in Type; encoded by the protobuf package
+	BodyEncodingProtobuf = "protobuf"
+	BodyEncodingGRPC     = "grpc"
 )
 
 // EncodedBody wraps a body payload with its encoding metadata.
 // For JSON bodies, Body is the parsed object and Encoding is empty.
 // For text bodies, Body is a string and Encoding is "text".
 // For binary bodies, Body is a base64 string and Encoding is "base64".
+// For XML bodies, Body is the element tree from ParseXML and Encoding is "xml".
+// For MessagePack and CBOR bodies, Body is the decoded document and Encoding
+// is "msgpack" or "cbor".
+// For form bodies, Body is the field map from ParseForm and Encoding is "form".
+// For newline-delimited JSON, Body is the list of values and Encoding is
+// "ndjson".
+// For protobuf bodies, Body is the message as JSON (a list of messages for
+// gRPC) and Type names the message type.
 type EncodedBody struct {
 	Data     any    `json:"data" yaml:"data"`
 	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+	Type     string `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// Structured reports whether Data holds a decoded document (XML, msgpack,
+// CBOR, form, NDJSON or protobuf) whose fields can be addressed, rather than an opaque string.
+func (b *EncodedBody) Structured() bool {
+	switch b.Encoding {
+	case BodyEncodingXML, BodyEncodingMsgPack, BodyEncodingCBOR, BodyEncodingForm, BodyEncodingNDJSON, BodyEncodingProtobuf, BodyEncodingGRPC:
+		return true
+	}
+	return false
 }
 
 // ParseBody interprets raw bytes based on content type.
 // JSON content types are parsed into structured data.
 // Text content types are stored as UTF-8 strings.
-// Binary content (protobuf, msgpack, grpc, octet-stream) is base64-encoded.
+// Form bodies are parsed into a map of fields, and newline-delimited JSON
+// into a list with one value per line.
+// MessagePack and CBOR documents are decoded into structured data when JSON
+// can represent them.
+// Other binary content (protobuf, grpc, octet-stream) is base64-encoded.
+// Textual bodies in a non-UTF-8 charset declared by the Content-Type are
+// converted to UTF-8 first; EncodeCharset converts them back for transport.
 func ParseBody(raw []byte, contentType string) any {
 	if len(raw) == 0 {
 		return nil
@@ -33,6 +70,18 @@ func ParseBody(raw []byte, contentType string) any {
 
 	ct := strings.ToLower(contentType)
 
+	// Decode msgpack/CBOR so diffs show fields; anything JSON can't hold
+	// (byte strings, extension types) falls through to base64
+	if isMsgPackContentType(ct) {
+		if v, err := ParseMsgPack(raw); err == nil {
+			return &EncodedBody{Data: v, Encoding: BodyEncodingMsgPack}
+		}
+	} else if isCBORContentType(ct) {
+		if v, err := ParseCBOR(raw); err == nil {
+			return &EncodedBody{Data: v, Encoding: BodyEncodingCBOR}
+		}
+	}
+
 	// Binary content types: store as base64
 	if isBinaryContentType(ct) {
 		return &EncodedBody{
@@ -41,6 +90,16 @@ func ParseBody(raw []byte, contentType string) any {
 		}
 	}
 
+	raw, transcoded := DecodeCharset(raw, contentType)
+
+	// NDJSON content types contain "json" but hold one document per line
+	if isNDJSONContentType(ct) {
+		if values, err := ParseNDJSON(raw); err == nil {
+			return &EncodedBody{Data: values, Encoding: BodyEncodingNDJSON}
+		}
+		return string(raw)
+	}
+
 	// Try JSON parse first (works for application/json, application/json-rpc, etc.)
 	if isJSONContentType(ct) || ct == "" {
 		var parsed any
@@ -49,6 +108,24 @@ func ParseBody(raw []byte, contentType string) any {
 		}
 	}
 
+	// Parse XML (including SOAP) into an element tree; malformed XML stays a string
+	if isXMLContentType(ct) {
+		parse := ParseXML
+		if transcoded {
+			parse = parseXMLUTF8
+		}
+		if tree, err := parse(raw); err == nil {
+			return &EncodedBody{Data: tree, Encoding: BodyEncodingXML}
+		}
+	}
+
+	// Parse forms into fields; bodies that aren't valid forms stay a string
+	if isFormContentType(ct) {
+		if form, err := ParseForm(raw); err == nil {
+			return &EncodedBody{Data: form, Encoding: BodyEncodingForm}
+		}
+	}
+
 	// Fall back to string for text types, base64 for anything else
 	if isTextContentType(ct) {
 		return string(raw)
@@ -83,6 +160,15 @@ func DecodeBody(body any) ([]byte, error) {
 	// Check if it's an EncodedBody (could come back as map from JSON deserialization)
 	if m, ok := body.(map[string]any); ok {
 		if enc, hasEnc := m["encoding"]; hasEnc {
+			eb := &EncodedBody{Data: m["data"]}
+			eb.Encoding, _ = enc.(string)
+			eb.Type, _ = m["type"].(string)
+			if encoded, ok, err := encodeDocument(eb); ok {
+				return encoded, err
+			}
+			if tree, isTree := m["data"].(map[string]any); isTree && enc == BodyEncodingXML {
+				return EncodeXML(tree)
+			}
 			data, ok := m["data"].(string)
 			if !ok {
 				encoded, err := json.Marshal(body)
@@ -103,6 +189,12 @@ func DecodeBody(body any) ([]byte, error) {
 
 	// Check native EncodedBody struct
 	if eb, ok := body.(*EncodedBody); ok {
+		if encoded, ok, err := encodeDocument(eb); ok {
+			return encoded, err
+		}
+		if tree, isTree := eb.Data.(map[string]any); isTree && eb.Encoding == BodyEncodingXML {
+			return EncodeXML(tree)
+		}
 		data, ok := eb.Data.(string)
 		if !ok {
 			return json.Marshal(body)
@@ -123,6 +215,60 @@ func DecodeBody(body any) ([]byte, error) {
 	return json.Marshal(body)
 }
 
+// BodyEncoder encodes a body stored in an encoding this package can't
+// encode itself, such as protobuf, which needs the message descriptors.
+type BodyEncoder func(body *EncodedBody) ([]byte, error)
+
+var (
+	bodyEncodersMu sync.RWMutex
+	bodyEncoders   = make(map[string]BodyEncoder)
+)
+
+// RegisterBodyEncoder makes DecodeBody use enc for bodies stored with the
+// given encoding, replacing any encoder registered before.
+func RegisterBodyEncoder(encoding string, enc BodyEncoder) {
+	bodyEncodersMu.Lock()
+	defer bodyEncodersMu.Unlock()
+	bodyEncoders[encoding] = enc
+}
+
+// encodeDocument re-encodes msgpack, CBOR, form, NDJSON and registered
+// encodings, which can hold documents of any shape, including bare strings.
+// ok is false for other encodings.
+func encodeDocument(eb *EncodedBody) (encoded []byte, ok bool, err error) {
+	switch eb.Encoding {
+	case BodyEncodingMsgPack:
+		encoded, err = EncodeMsgPack(eb.Data)
+	case BodyEncodingCBOR:
+		encoded, err = EncodeCBOR(eb.Data)
+	case BodyEncodingForm:
+		form, isForm := eb.Data.(map[string]any)
+		if !isForm {
+			return nil, true, fmt.Errorf("form body must be a map of fields")
+		}
+		encoded = EncodeForm(form)
+	case BodyEncodingTruncated:
+		return nil, true, ErrTruncatedBody
+	case BodyEncodingNDJSON:
+		values, isList := eb.Data.([]any)
+		if !isList {
+			return nil, true, fmt.Errorf("ndjson body must be a list of values")
+		}
+		encoded, err = EncodeNDJSON(values)
+	case BodyEncodingProtobuf, BodyEncodingGRPC:
+		bodyEncodersMu.RLock()
+		enc := bodyEncoders[eb.Encoding]
+		bodyEncodersMu.RUnlock()
+		if enc == nil {
+			return nil, true, fmt.Errorf("%s body of type %s needs protobuf descriptors to be encoded", eb.Encoding, eb.Type)
+		}
+		encoded, err = enc(eb)
+	default:
+		return nil, false, nil
+	}
+	return encoded, true, err
+}
+
 func isBinaryContentType(ct string) bool {
 	binaryTypes := []string{
 		"application/grpc",
@@ -151,6 +297,10 @@ func isJSONContentType(ct string) bool {
 	return strings.Contains(ct, "json") || strings.Contains(ct, "json-rpc")
 }
 
+func isXMLContentType(ct string) bool {
+	return strings.Contains(ct, "xml") && !strings.Contains(ct, "html")
+}
+
 func isTextContentType(ct string) bool {
 	return strings.HasPrefix(ct, "text/") ||
 		strings.Contains(ct, "xml") ||
@@ -2,6 +2,7 @@ package snapshot
 
 import (
 	"encoding/base64"
+	"reflect"
 	"testing"
 )
 
@@ -86,25 +87,92 @@ func TestParseBody_XML(t *testing.T) {
 	raw := []byte(`<request><method>doSomething</method></request>`)
 	result := ParseBody(raw, "application/xml")
 
-	s, ok := result.(string)
-	if !ok {
-		t.Fatalf("expected string for XML body, got %T", result)
+	eb, ok := result.(*EncodedBody)
+	if !ok || eb.Encoding != BodyEncodingXML {
+		t.Fatalf("expected XML EncodedBody, got %T %v", result, result)
+	}
+	tree := eb.Data.(map[string]any)
+	req, ok := tree["request"].(map[string]any)
+	if !ok || req["method"] != "doSomething" {
+		t.Errorf("unexpected XML tree %v", tree)
+	}
+
+	decoded, err := DecodeBody(eb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != string(raw) {
+		t.Errorf("expected round trip to %s, got %s", raw, decoded)
 	}
-	if s != string(raw) {
-		t.Errorf("expected XML preserved as string")
+}
+
+func TestParseBody_MalformedXMLStaysString(t *testing.T) {
+	raw := []byte(`<request><method>oops</request>`)
+	if _, ok := ParseBody(raw, "text/xml").(string); !ok {
+		t.Error("expected malformed XML to be stored as a string")
 	}
 }
 
 func TestParseBody_FormURLEncoded(t *testing.T) {
-	raw := []byte("username=alice&password=secret")
+	raw := []byte("username=alice&password=s%26cret&role=admin&role=dev")
 	result := ParseBody(raw, "application/x-www-form-urlencoded")
 
-	s, ok := result.(string)
-	if !ok {
-		t.Fatalf("expected string for form body, got %T", result)
+	eb, ok := result.(*EncodedBody)
+	if !ok || eb.Encoding != BodyEncodingForm {
+		t.Fatalf("expected form EncodedBody, got %T %v", result, result)
+	}
+	want := map[string]any{"username": "alice", "password": "s&cret", "role": []any{"admin", "dev"}}
+	if !reflect.DeepEqual(eb.Data, want) {
+		t.Errorf("unexpected form fields %v", eb.Data)
+	}
+
+	decoded, err := DecodeBody(map[string]any{"data": eb.Data, "encoding": "form"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != "password=s%26cret&role=admin&role=dev&username=alice" {
+		t.Errorf("unexpected re-encoded form %q", decoded)
+	}
+
+	// Malformed forms stay strings
+	if s, ok := ParseBody([]byte("a=%zz"), "application/x-www-form-urlencoded").(string); !ok || s != "a=%zz" {
+		t.Errorf("expected malformed form to be stored as a string, got %v", s)
+	}
+}
+
+func TestParseBody_NDJSON(t *testing.T) {
+	raw := []byte("{\"id\":1,\"name\":\"a\"}\n\n{\"id\":2,\"name\":\"b\"}\n")
+	for _, ct := range []string{"application/x-ndjson", "application/jsonl; charset=utf-8"} {
+		eb, ok := ParseBody(raw, ct).(*EncodedBody)
+		if !ok || eb.Encoding != BodyEncodingNDJSON {
+			t.Fatalf("%s: expected ndjson EncodedBody, got %v", ct, eb)
+		}
+		want := []any{
+			map[string]any{"id": float64(1), "name": "a"},
+			map[string]any{"id": float64(2), "name": "b"},
+		}
+		if !reflect.DeepEqual(eb.Data, want) {
+			t.Errorf("%s: unexpected lines %v", ct, eb.Data)
+		}
+	}
+
+	// A single line is still a list
+	eb, ok := ParseBody([]byte(`{"id":1}`), "application/x-ndjson").(*EncodedBody)
+	if !ok || !reflect.DeepEqual(eb.Data, []any{map[string]any{"id": float64(1)}}) {
+		t.Errorf("expected a one-line list, got %v", eb)
 	}
-	if s != "username=alice&password=secret" {
-		t.Errorf("unexpected form body: %q", s)
+
+	decoded, err := DecodeBody(map[string]any{"data": []any{map[string]any{"id": float64(1)}, "x"}, "encoding": "ndjson"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != "{\"id\":1}\n\"x\"\n" {
+		t.Errorf("unexpected re-encoded body %q", decoded)
+	}
+
+	// Bodies with a line that isn't JSON stay strings
+	if s, ok := ParseBody([]byte("{\"id\":1}\nnot json\n"), "application/x-ndjson").(string); !ok || s != "{\"id\":1}\nnot json\n" {
+		t.Errorf("expected invalid NDJSON to be stored as a string, got %v", s)
 	}
 }
 
@@ -0,0 +1,301 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// bodiesDir holds bodies written to their own files when BodyFileThreshold
+// is set. Like statesDir, it cannot clash with a service directory.
+const bodiesDir = "_bodies"
+
+// BodyEncodingFile marks a body kept in a sidecar file under bodiesDir.
+// Data is the file's path relative to the snapshot directory. Store.Load
+// replaces such bodies with their content, unless Store.LazyBodies defers
+// that to ResolveBodies.
+const BodyEncodingFile = "file"
+
+// externalizeBodies moves bodies of at least BodyFileThreshold bytes out of
+// snap into sidecar files. snap must be a copy the caller may modify; the
+// outgoing requests it shares with the original are copied first.
+func (s *Store) externalizeBodies(snap *Snapshot) error {
+	var err error
+	if snap.Request.Body, err = s.externalizeBody(snap.Request.Body, snap.Request.Headers); err != nil {
+		return err
+	}
+	if snap.Response.Body, err = s.externalizeBody(snap.Response.Body, snap.Response.Headers); err != nil {
+		return err
+	}
+	if isBodyFileRef(snap.Response.Body) && len(snap.Response.Chunks) > 0 {
+		// The chunks' data is the body again; their sizes and timing are
+		// enough to split the body file at the recorded boundaries
+		chunks := make([]Chunk, len(snap.Response.Chunks))
+		for i, c := range snap.Response.Chunks {
+			chunks[i] = Chunk{Size: c.Size, OffsetMs: c.OffsetMs}
+		}
+		snap.Response.Chunks = chunks
+	}
+	if len(snap.OutgoingRequests) == 0 {
+		return nil
+	}
+	outgoing := make([]OutgoingRequest, len(snap.OutgoingRequests))
+	for i, o := range snap.OutgoingRequests {
+		if o.Body, err = s.externalizeBody(o.Body, o.Headers); err != nil {
+			return err
+		}
+		if o.Response != nil {
+			resp := *o.Response
+			if resp.Body, err = s.externalizeBody(resp.Body, resp.Headers); err != nil {
+				return err
+			}
+			o.Response = &resp
+		}
+		outgoing[i] = o
+	}
+	snap.OutgoingRequests = outgoing
+	return nil
+}
+
+// externalizeBody writes a large body to a sidecar file as the bytes sent
+// over the wire, so a PDF is stored as a PDF, and returns a reference to it.
+// Bodies that would not parse back to the same value, such as
+// protobuf-decoded ones or ones their Content-Type doesn't describe, stay
+// inline.
+func (s *Store) externalizeBody(body any, headers map[string]string) (any, error) {
+	if s.BodyFileThreshold <= 0 || body == nil || isBodyFileRef(body) {
+		return body, nil
+	}
+	var raw []byte
+	if text, ok := body.(string); ok {
+		raw = []byte(text) // DecodeBody would quote it as JSON
+	} else {
+		var err error
+		if raw, err = DecodeBody(body); err != nil {
+			return body, nil
+		}
+	}
+	if len(raw) < s.BodyFileThreshold {
+		return body, nil
+	}
+	contentType := headerValue(headers, HeaderContentType)
+	want, err := json.Marshal(body)
+	if err != nil {
+		return body, nil
+	}
+	got, err := json.Marshal(ParseBody(raw, contentType))
+	if err != nil || !bytes.Equal(got, want) {
+		return body, nil
+	}
+
+	sum := sha256.Sum256(raw)
+	digest := hex.EncodeToString(sum[:])
+	rel := path.Join(bodiesDir, digest[:2], digest+bodyFileExtension(contentType))
+	file := filepath.Join(s.BaseDir, filepath.FromSlash(rel))
+	if _, err := os.Stat(file); err == nil {
+		return &EncodedBody{Data: rel, Encoding: BodyEncodingFile}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return nil, fmt.Errorf("creating bodies directory: %w", err)
+	}
+	// Write to a temporary file and rename, as for DB states
+	tmp, err := os.CreateTemp(filepath.Dir(file), digest+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("writing body file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("writing body file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("writing body file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return nil, fmt.Errorf("writing body file: %w", err)
+	}
+	return &EncodedBody{Data: rel, Encoding: BodyEncodingFile}, nil
+}
+
+// ResolveBodies returns a copy of snap with the bodies it keeps in sidecar
+// files read, for a snapshot loaded with LazyBodies. snap itself keeps the
+// references, so a list of snapshots only holds large bodies while one is
+// in use.
+func (s *Store) ResolveBodies(snap *Snapshot) (*Snapshot, error) {
+	resolved := *snap
+	if len(snap.OutgoingRequests) > 0 {
+		resolved.OutgoingRequests = make([]OutgoingRequest, len(snap.OutgoingRequests))
+		for i, o := range snap.OutgoingRequests {
+			if o.Response != nil {
+				resp := *o.Response
+				o.Response = &resp
+			}
+			resolved.OutgoingRequests[i] = o
+		}
+	}
+	if err := s.resolveBodies(&resolved); err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+// resolveBodies reads the sidecar files snap's bodies refer to.
+func (s *Store) resolveBodies(snap *Snapshot) error {
+	var err error
+	if snap.Request.Body, err = s.resolveBody(snap.Request.Body, snap.Request.Headers); err != nil {
+		return err
+	}
+	if snap.Response.Body, err = s.resolveBody(snap.Response.Body, snap.Response.Headers); err != nil {
+		return err
+	}
+	for i := range snap.OutgoingRequests {
+		o := &snap.OutgoingRequests[i]
+		if o.Body, err = s.resolveBody(o.Body, o.Headers); err != nil {
+			return err
+		}
+		if o.Response != nil {
+			if o.Response.Body, err = s.resolveBody(o.Response.Body, o.Response.Headers); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) resolveBody(body any, headers map[string]string) (any, error) {
+	m, ok := body.(map[string]any)
+	if !ok || m["encoding"] != BodyEncodingFile {
+		return body, nil
+	}
+	rel, _ := m["data"].(string)
+	clean := path.Clean(rel)
+	if !strings.HasPrefix(clean, bodiesDir+"/") || clean != rel {
+		return nil, fmt.Errorf("invalid body file reference %q", rel)
+	}
+	raw, err := os.ReadFile(filepath.Join(s.BaseDir, filepath.FromSlash(clean)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("body file %s not found in %s", rel, s.BaseDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading body file: %w", err)
+	}
+	return ParseBody(raw, headerValue(headers, HeaderContentType)), nil
+}
+
+func isBodyFileRef(body any) bool {
+	switch b := body.(type) {
+	case *EncodedBody:
+		return b.Encoding == BodyEncodingFile
+	case map[string]any:
+		return b["encoding"] == BodyEncodingFile
+	}
+	return false
+}
+
+// bodyFileRefPattern matches the body file references in raw snapshot data.
+var bodyFileRefPattern = regexp.MustCompile(bodiesDir + `/[0-9a-f]{2}/[0-9a-f]{64}(?:\.[a-z0-9]+)?`)
+
+// removeUnusedBodyFiles removes the body files the raw data of a deleted
+// snapshot refers to, unless another snapshot still does. Body files are
+// shared by content, so every snapshot file referring to any is checked.
+func (s *Store) removeUnusedBodyFiles(data []byte) error {
+	refs := bodyFileRefPattern.FindAll(data, -1)
+	if len(refs) == 0 {
+		return nil
+	}
+	s.bodiesMu.Lock()
+	defer s.bodiesMu.Unlock()
+
+	unused := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		unused[string(ref)] = true
+	}
+	paths, err := s.snapshotPaths()
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		other, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("reading snapshot file: %w", err)
+		}
+		if !hasBodyRefs(other) {
+			continue
+		}
+		for ref := range unused {
+			if bytes.Contains(other, []byte(ref)) {
+				delete(unused, ref)
+			}
+		}
+		if len(unused) == 0 {
+			return nil
+		}
+	}
+	for ref := range unused {
+		err := os.Remove(filepath.Join(s.BaseDir, filepath.FromSlash(ref)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removing body file: %w", err)
+		}
+	}
+	return nil
+}
+
+// hasBodyRefs reports whether raw snapshot data refers to body files.
+func hasBodyRefs(data []byte) bool {
+	return bytes.Contains(data, []byte(bodiesDir+"/"))
+}
+
+// bodyFileExtensions names sidecar files by content type, so they open in
+// the right application. The table is fixed rather than taken from the
+// system's MIME database, so file names are the same on every machine.
+var bodyFileExtensions = map[string]string{
+	"application/json":         ".json",
+	"application/pdf":          ".pdf",
+	"application/xml":          ".xml",
+	"application/zip":          ".zip",
+	"application/gzip":         ".gz",
+	"application/octet-stream": ".bin",
+	"image/gif":                ".gif",
+	"image/jpeg":               ".jpg",
+	"image/png":                ".png",
+	"image/svg+xml":            ".svg",
+	"image/webp":               ".webp",
+	"text/csv":                 ".csv",
+	"text/html":                ".html",
+	"text/plain":               ".txt",
+	"text/xml":                 ".xml",
+}
+
+func bodyFileExtension(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ".bin"
+	}
+	if ext, ok := bodyFileExtensions[mediaType]; ok {
+		return ext
+	}
+	return ".bin"
+}
+
+// headerValue looks up a recorded header regardless of its case.
+func headerValue(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
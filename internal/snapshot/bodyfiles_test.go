@@ -0,0 +1,184 @@
+package snapshot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStoreBodyFiles(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	store.BodyFileThreshold = 64
+
+	pdf := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte{0xff, 0x00, 0x7f}, 40)...)
+	text := strings.Repeat("needle in a large text body ", 4)
+	path, err := store.Save(&Snapshot{
+		ID:      "report",
+		Service: "api",
+		Tags:    []string{"reports"},
+		Request: Request{
+			Method:  "POST",
+			URL:     "/reports",
+			Headers: map[string]string{"Content-Type": "text/plain"},
+			Body:    ParseBody([]byte(text), "text/plain"),
+		},
+		Response: Response{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "application/pdf"},
+			Body:    ParseBody(pdf, "application/pdf"),
+		},
+		OutgoingRequests: []OutgoingRequest{{
+			Method:   "GET",
+			URL:      "/small",
+			Response: &Response{Status: 200, Body: map[string]any{"ok": true}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, bodiesDir, "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 body files, got %v", files)
+	}
+	var pdfFile string
+	for _, f := range files {
+		if strings.HasSuffix(f, ".pdf") {
+			pdfFile = f
+		}
+	}
+	if data, _ := os.ReadFile(pdfFile); !bytes.Equal(data, pdf) {
+		t.Errorf("expected the PDF to be stored as is in a .pdf file, got %v", files)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "needle") || !strings.Contains(string(data), `"encoding": "file"`) {
+		t.Errorf("expected large bodies to be referenced rather than embedded:\n%s", data)
+	}
+	if !strings.Contains(string(data), `"ok": true`) {
+		t.Errorf("expected small bodies to stay inline:\n%s", data)
+	}
+
+	// Readers resolve body files without any setting
+	loaded, err := NewStore(dir, "json").Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Request.Body != text {
+		t.Errorf("expected request body to be resolved, got %v", loaded.Request.Body)
+	}
+	if decoded, err := DecodeBody(loaded.Response.Body); err != nil || !bytes.Equal(decoded, pdf) {
+		t.Errorf("expected response body to be resolved, got %v (%v)", loaded.Response.Body, err)
+	}
+
+	// Saving a loaded snapshot again reuses the body files
+	if err := store.Update(path, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := filepath.Glob(filepath.Join(dir, bodiesDir, "*", "*")); !reflect.DeepEqual(again, files) {
+		t.Errorf("expected body files to be reused, got %v", again)
+	}
+
+	tagged, _, err := store.LoadByTag([]string{"reports"})
+	if err != nil || len(tagged) != 1 || tagged[0].Request.Body != text {
+		t.Errorf("expected LoadByTag to resolve body files, got %v (%v)", tagged, err)
+	}
+
+	results, err := store.Grep(GrepOptions{Pattern: regexp.MustCompile("needle")})
+	if err != nil || len(results) != 1 {
+		t.Errorf("expected grep to search body files, got %v (%v)", results, err)
+	}
+}
+
+func TestStoreBodyFiles_Lazy(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	store.BodyFileThreshold = 16
+
+	text := strings.Repeat("streamed ", 8)
+	path, err := store.Save(&Snapshot{
+		ID:      "stream",
+		Service: "api",
+		Request: Request{Method: "GET", URL: "/export"},
+		Response: Response{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "text/plain"},
+			Body:    text,
+			Chunks:  []Chunk{{Size: 36, Data: text[:36]}, {Size: 36, OffsetMs: 5, Data: text[36:]}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.LazyBodies = true
+	snap, err := store.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isBodyFileRef(snap.Response.Body) {
+		t.Fatalf("expected the body file left unread, got %#v", snap.Response.Body)
+	}
+	if c := snap.Response.Chunks; len(c) != 2 || c[1].Size != 36 || c[1].OffsetMs != 5 || c[0].Data != nil {
+		t.Errorf("expected chunk sizes and timing without their data, got %+v", c)
+	}
+
+	resolved, err := store.ResolveBodies(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Response.Body != text {
+		t.Errorf("expected the body read on demand, got %#v", resolved.Response.Body)
+	}
+	if !isBodyFileRef(snap.Response.Body) {
+		t.Error("expected the loaded snapshot to keep its reference")
+	}
+}
+
+func TestStoreBodyFiles_KeepsLossyBodiesInline(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	store.BodyFileThreshold = 8
+
+	// A JSON body recorded without a Content-Type parses back the same way,
+	// but one whose Content-Type says text would come back as a string
+	path, err := store.Save(&Snapshot{
+		ID:       "lossy",
+		Service:  "api",
+		Request:  Request{Method: "GET", URL: "/users"},
+		Response: Response{Status: 200, Headers: map[string]string{"Content-Type": "text/plain"}, Body: map[string]any{"name": "Alice Smith"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, bodiesDir, "*", "*")); len(files) != 0 {
+		t.Errorf("expected no body files, got %v", files)
+	}
+	loaded, err := store.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Response.Body, map[string]any{"name": "Alice Smith"}) {
+		t.Errorf("unexpected body %v", loaded.Response.Body)
+	}
+}
+
+func TestStoreBodyFiles_InvalidReference(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "x.snapshot.json")
+	os.WriteFile(path, []byte(`{"id":"x","request":{"method":"GET","url":"/","body":{"data":"_bodies/../../etc/passwd","encoding":"file"}},"response":{"status":200}}`), 0o644)
+	if _, err := NewStore(dir, "json").Load(path); err == nil || !strings.Contains(err.Error(), "invalid body file reference") {
+		t.Errorf("expected invalid reference error, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package snapshot
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// defaultCharset is implied when a Content-Type declares no charset, so an
+// explicit charset=utf-8 is redundant.
+const defaultCharset = "utf-8"
+
+// NormalizeContentType returns a canonical form of a Content-Type value so
+// equivalent headers compare equal: the media type and parameter names are
+// lowercased, whitespace is removed and a redundant UTF-8 charset is dropped.
+// For example "Application/JSON; charset=UTF-8" becomes "application/json",
+// while "text/plain; charset=ISO-8859-1" becomes "text/plain; charset=iso-8859-1".
+// Values that cannot be parsed are only lowercased and trimmed.
+func NormalizeContentType(contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if cs, ok := params["charset"]; ok {
+		cs = strings.ToLower(cs)
+		if isUTF8Charset(cs) {
+			delete(params, "charset")
+		} else {
+			params["charset"] = cs
+		}
+	}
+	if formatted := mime.FormatMediaType(mediaType, params); formatted != "" {
+		return formatted
+	}
+	return mediaType
+}
+
+// ContentCharset returns the lowercased charset parameter of a Content-Type,
+// or "" when none is declared.
+func ContentCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(params["charset"])
+}
+
+// DecodeCharset converts raw from the charset declared in contentType to
+// UTF-8. It reports whether a conversion happened; bodies without a charset,
+// already in UTF-8 or in an unknown charset are returned unchanged.
+func DecodeCharset(raw []byte, contentType string) ([]byte, bool) {
+	enc := lookupCharset(ContentCharset(contentType))
+	if enc == nil {
+		return raw, false
+	}
+	decoded, err := enc.NewDecoder().Bytes(raw)
+	if err != nil {
+		return raw, false
+	}
+	return decoded, true
+}
+
+// EncodeCharset reverses DecodeCharset, converting UTF-8 data back to the
+// charset declared in contentType before it is sent over the wire.
+func EncodeCharset(data []byte, contentType string) ([]byte, error) {
+	enc := lookupCharset(ContentCharset(contentType))
+	if enc == nil {
+		return data, nil
+	}
+	encoded, err := enc.NewEncoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("encoding body as %s: %w", ContentCharset(contentType), err)
+	}
+	return encoded, nil
+}
+
+// lookupCharset returns the encoding for a charset label, or nil when the
+// label is empty, unknown or UTF-8 (which needs no conversion).
+func lookupCharset(charset string) encoding.Encoding {
+	if charset == "" || isUTF8Charset(charset) {
+		return nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil
+	}
+	if name, _ := htmlindex.Name(enc); name == defaultCharset {
+		return nil
+	}
+	return enc
+}
+
+func isUTF8Charset(charset string) bool {
+	return charset == defaultCharset || charset == "utf8"
+}
@@ -0,0 +1,83 @@
+package snapshot
+
+import (
+	"testing"
+)
+
+func TestNormalizeContentType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"application/json", "application/json"},
+		{"application/json; charset=utf-8", "application/json"},
+		{"Application/JSON;Charset=UTF-8", "application/json"},
+		{"text/plain; charset=ISO-8859-1", "text/plain; charset=iso-8859-1"},
+		{"multipart/form-data; boundary=XyZ", "multipart/form-data; boundary=XyZ"},
+		{"", ""},
+		{" Not A Type ", "not a type"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeContentType(tt.in); got != tt.want {
+			t.Errorf("NormalizeContentType(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCharset_RoundTrip(t *testing.T) {
+	latin1 := []byte("caf\xe9")
+	decoded, ok := DecodeCharset(latin1, "text/plain; charset=ISO-8859-1")
+	if !ok || string(decoded) != "café" {
+		t.Fatalf("expected café, got %q (transcoded=%v)", decoded, ok)
+	}
+
+	encoded, err := EncodeCharset(decoded, "text/plain; charset=iso-8859-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != string(latin1) {
+		t.Errorf("expected original bytes back, got %q", encoded)
+	}
+}
+
+func TestDecodeCharset_NoConversion(t *testing.T) {
+	for _, ct := range []string{"", "application/json", "text/plain; charset=utf-8", "text/plain; charset=bogus"} {
+		raw := []byte("café")
+		got, ok := DecodeCharset(raw, ct)
+		if ok || string(got) != "café" {
+			t.Errorf("%q: expected body unchanged, got %q (transcoded=%v)", ct, got, ok)
+		}
+	}
+}
+
+func TestParseBody_NonUTF8Charsets(t *testing.T) {
+	text := ParseBody([]byte("na\xefve"), "text/plain; charset=windows-1252")
+	if text != "naïve" {
+		t.Errorf("expected text decoded to UTF-8, got %q", text)
+	}
+
+	jsonBody := ParseBody([]byte("{\"name\":\"Jos\xe9\"}"), "application/json; charset=iso-8859-1")
+	m, ok := jsonBody.(map[string]any)
+	if !ok || m["name"] != "José" {
+		t.Errorf("expected JSON decoded to UTF-8, got %v", jsonBody)
+	}
+
+	xmlBody := ParseBody([]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><city>K\xf6ln</city>"), "text/xml; charset=iso-8859-1")
+	eb, ok := xmlBody.(*EncodedBody)
+	if !ok {
+		t.Fatalf("expected XML body, got %T", xmlBody)
+	}
+	if city := eb.Data.(map[string]any)["city"]; city != "Köln" {
+		t.Errorf("expected XML decoded once to UTF-8, got %q", city)
+	}
+}
+
+func TestParseXML_DeclaredEncoding(t *testing.T) {
+	tree, err := ParseXML([]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><city>K\xf6ln</city>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree["city"] != "Köln" {
+		t.Errorf("expected declared encoding to be honored, got %q", tree["city"])
+	}
+}
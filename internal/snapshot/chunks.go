@@ -0,0 +1,10 @@
+package snapshot
+
+// Chunk is one piece of a streamed response body, as the recording proxy
+// received it from the service. Chunks are recorded alongside the body for
+// reference; replay compares the whole body.
+type Chunk struct {
+	Size     int   `json:"size" yaml:"size"`
+	OffsetMs int64 `json:"offset_ms" yaml:"offset_ms"` // time from the response headers to the chunk
+	Data     any   `json:"data,omitempty" yaml:"data,omitempty"`
+}
@@ -0,0 +1,101 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// HeaderContentEncoding is the header naming the compression of a body.
+// Snapshots keep it as recorded and store the body decompressed, so replay
+// and mocks can compress the body again the same way.
+const HeaderContentEncoding = "Content-Encoding"
+
+// contentCodings splits a Content-Encoding value into its codings in the
+// order they were applied, dropping identity.
+func contentCodings(contentEncoding string) []string {
+	var codings []string
+	for _, c := range strings.Split(contentEncoding, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c != "" && c != "identity" {
+			codings = append(codings, c)
+		}
+	}
+	return codings
+}
+
+// DecompressBody reverses the Content-Encoding of a body. gzip, deflate and
+// br are supported; other codings return an error and the raw body.
+func DecompressBody(raw []byte, contentEncoding string) ([]byte, error) {
+	codings := contentCodings(contentEncoding)
+	if len(raw) == 0 || len(codings) == 0 {
+		return raw, nil
+	}
+	data := raw
+	for i := len(codings) - 1; i >= 0; i-- {
+		r, err := decompressor(codings[i], data)
+		if err != nil {
+			return raw, fmt.Errorf("decoding %s body: %w", codings[i], err)
+		}
+		decoded, err := io.ReadAll(r)
+		if err != nil {
+			return raw, fmt.Errorf("decoding %s body: %w", codings[i], err)
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+func decompressor(coding string, data []byte) (io.Reader, error) {
+	switch coding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		// deflate is meant to be zlib-wrapped, but some servers send raw deflate
+		if r, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+			return r, nil
+		}
+		return flate.NewReader(bytes.NewReader(data)), nil
+	case "br":
+		return brotli.NewReader(bytes.NewReader(data)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding")
+	}
+}
+
+// CompressBody applies a Content-Encoding to a body, reversing
+// DecompressBody before the body is sent over the wire.
+func CompressBody(data []byte, contentEncoding string) ([]byte, error) {
+	codings := contentCodings(contentEncoding)
+	if len(data) == 0 || len(codings) == 0 {
+		return data, nil
+	}
+	for _, coding := range codings {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch coding {
+		case "gzip", "x-gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "br":
+			w = brotli.NewWriter(&buf)
+		default:
+			return nil, fmt.Errorf("encoding body as %s: unsupported content encoding", coding)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("encoding body as %s: %w", coding, err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("encoding body as %s: %w", coding, err)
+		}
+		data = buf.Bytes()
+	}
+	return data, nil
+}
@@ -0,0 +1,54 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/flate"
+	"testing"
+)
+
+func TestCompressBody_RoundTrip(t *testing.T) {
+	body := []byte(`{"items":[1,2,3],"note":"compressed"}`)
+	for _, enc := range []string{"gzip", "x-gzip", "deflate", "br", "gzip, br", "identity", ""} {
+		compressed, err := CompressBody(body, enc)
+		if err != nil {
+			t.Fatalf("%q: %v", enc, err)
+		}
+		decoded, err := DecompressBody(compressed, enc)
+		if err != nil {
+			t.Fatalf("%q: %v", enc, err)
+		}
+		if !bytes.Equal(decoded, body) {
+			t.Errorf("%q: round trip = %q, want %q", enc, decoded, body)
+		}
+	}
+}
+
+func TestDecompressBody_RawDeflate(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write([]byte("hello"))
+	w.Close()
+
+	decoded, err := DecompressBody(buf.Bytes(), "deflate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != "hello" {
+		t.Errorf("expected hello, got %q", decoded)
+	}
+}
+
+func TestDecompressBody_Unsupported(t *testing.T) {
+	raw := []byte{0x28, 0xb5, 0x2f, 0xfd}
+	decoded, err := DecompressBody(raw, "zstd")
+	if err == nil {
+		t.Error("expected an error for an unsupported encoding")
+	}
+	if !bytes.Equal(decoded, raw) {
+		t.Error("expected the raw body back")
+	}
+
+	if _, err := DecompressBody([]byte("not gzip"), "gzip"); err == nil {
+		t.Error("expected an error for a corrupt body")
+	}
+}
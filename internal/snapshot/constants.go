@@ -10,6 +10,7 @@ const (
 	HeaderContentType     = "Content-Type"
 	HeaderAuthorization   = "Authorization"
 	HeaderWWWAuthenticate = "WWW-Authenticate"
+	HeaderSOAPAction      = "SOAPAction"
 )
 
 // Snapshot file format identifiers.
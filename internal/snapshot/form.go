@@ -0,0 +1,75 @@
+package snapshot
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+func isFormContentType(ct string) bool {
+	return strings.HasPrefix(ct, "application/x-www-form-urlencoded")
+}
+
+// ParseForm decodes an application/x-www-form-urlencoded body into a map.
+// Fields that appear once map to their value; repeated fields map to the
+// list of their values in order.
+func ParseForm(raw []byte) (map[string]any, error) {
+	values, err := url.ParseQuery(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	form := make(map[string]any, len(values))
+	for k, vs := range values {
+		if len(vs) == 1 {
+			form[k] = vs[0]
+			continue
+		}
+		list := make([]any, len(vs))
+		for i, v := range vs {
+			list[i] = v
+		}
+		form[k] = list
+	}
+	return form, nil
+}
+
+// EncodeForm reverses ParseForm. Fields are written in sorted order, so a
+// body may differ from the recorded one in field order only.
+func EncodeForm(form map[string]any) []byte {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		values, ok := form[k].([]any)
+		if !ok {
+			values = []any{form[k]}
+		}
+		for _, v := range values {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(k))
+			b.WriteByte('=')
+			b.WriteString(url.QueryEscape(formValue(v)))
+		}
+	}
+	return []byte(b.String())
+}
+
+// formValue renders a stored field value; values are strings unless a
+// snapshot was edited or redacted into another type.
+func formValue(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,203 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Scopes that Grep can be restricted to.
+const (
+	GrepScopeRequestURL   = "request.url"
+	GrepScopeRequestBody  = "request.body"
+	GrepScopeResponseBody = "response.body"
+	GrepScopeDB           = "db"
+)
+
+// GrepScopes lists the valid values for GrepOptions.Scope.
+var GrepScopes = []string{GrepScopeRequestURL, GrepScopeRequestBody, GrepScopeResponseBody, GrepScopeDB}
+
+// grepValueMaxLen caps how much of a matched value is kept for display.
+const grepValueMaxLen = 120
+
+// GrepOptions configures a search over snapshot contents.
+type GrepOptions struct {
+	Pattern *regexp.Regexp
+	Scope   string      // one of GrepScopes, or empty to search all of them
+	Filter  ListOptions // metadata filters applied before contents are searched
+}
+
+// GrepMatch is a single field in a snapshot whose key or value matched.
+type GrepMatch struct {
+	Field string // e.g. response.body.users[0].email
+	Value string // matched value, rendered and shortened for display
+}
+
+// GrepResult groups the matches found in one snapshot.
+type GrepResult struct {
+	Info    SnapshotInfo
+	Matches []GrepMatch
+}
+
+// Grep searches snapshot contents for fields whose key or value matches the
+// pattern. For literal patterns the raw JSON file is checked before decoding,
+// so non-matching files are never parsed; the rest are narrowed by the
+// metadata index before their files are read, and request.url searches are
+// answered from the index alone.
+func (s *Store) Grep(opts GrepOptions) ([]GrepResult, error) {
+	if opts.Pattern == nil {
+		return nil, fmt.Errorf("grep pattern is required")
+	}
+	paths, err := s.snapshotPaths()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := s.indexedInfos(paths)
+	if err != nil {
+		return nil, err
+	}
+	literal := rawPrefilterable(opts.Pattern)
+
+	var results []GrepResult
+	for i, path := range paths {
+		info := infos[i]
+		if opts.Filter.hasFilters() && !opts.Filter.matches(info) {
+			continue
+		}
+
+		var matches []GrepMatch
+		if opts.Scope == GrepScopeRequestURL {
+			// The URL is part of the metadata, so the file is never read
+			if opts.Pattern.MatchString(info.URL) {
+				matches = append(matches, GrepMatch{Field: GrepScopeRequestURL, Value: info.URL})
+			}
+		} else {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", path, err)
+			}
+			// YAML may fold long strings across lines, so only JSON files are
+			// prefiltered, and only when their DB states and bodies are inline
+			if literal && strings.HasSuffix(path, ".snapshot."+FormatJSON) && !hasStateRefs(data) && !hasBodyRefs(data) && !opts.Pattern.Match(data) {
+				continue
+			}
+			snap := &Snapshot{}
+			if err := s.unmarshal(data, snap); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", path, err)
+			}
+			if err := s.resolveStates(snap); err != nil {
+				return nil, fmt.Errorf("loading %s: %w", path, err)
+			}
+			if err := s.resolveBodies(snap); err != nil {
+				return nil, fmt.Errorf("loading %s: %w", path, err)
+			}
+			matches = grepSnapshot(snap, opts.Pattern, opts.Scope)
+		}
+
+		if len(matches) > 0 {
+			results = append(results, GrepResult{Info: info, Matches: matches})
+		}
+	}
+	return results, nil
+}
+
+// grepSnapshot searches the sections of snap selected by scope.
+func grepSnapshot(snap *Snapshot, pattern *regexp.Regexp, scope string) []GrepMatch {
+	var matches []GrepMatch
+	if scope == "" || scope == GrepScopeRequestURL {
+		if pattern.MatchString(snap.Request.URL) {
+			matches = append(matches, GrepMatch{Field: GrepScopeRequestURL, Value: snap.Request.URL})
+		}
+	}
+	if scope == "" || scope == GrepScopeRequestBody {
+		matches = grepValue(matches, pattern, GrepScopeRequestBody, toGeneric(snap.Request.Body))
+	}
+	if scope == "" || scope == GrepScopeResponseBody {
+		matches = grepValue(matches, pattern, GrepScopeResponseBody, toGeneric(snap.Response.Body))
+	}
+	if scope == "" || scope == GrepScopeDB {
+		matches = grepValue(matches, pattern, "db_state_before", toGeneric(snap.DBStateBefore))
+		matches = grepValue(matches, pattern, "db_state_after", toGeneric(snap.DBStateAfter))
+	}
+	return matches
+}
+
+// grepValue walks v and appends a match for every key or scalar value that
+// matches pattern. Map keys are visited in sorted order for stable output.
+func grepValue(matches []GrepMatch, pattern *regexp.Regexp, path string, v any) []GrepMatch {
+	switch val := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "." + k
+			if pattern.MatchString(k) {
+				matches = append(matches, GrepMatch{Field: child, Value: renderGrepValue(val[k])})
+				continue
+			}
+			matches = grepValue(matches, pattern, child, val[k])
+		}
+	case []any:
+		for i, item := range val {
+			matches = grepValue(matches, pattern, fmt.Sprintf("%s[%d]", path, i), item)
+		}
+	case nil:
+		// nothing to match
+	default:
+		text, ok := val.(string)
+		if !ok {
+			text = renderGrepValue(val)
+		}
+		if pattern.MatchString(text) {
+			matches = append(matches, GrepMatch{Field: path, Value: renderGrepValue(val)})
+		}
+	}
+	return matches
+}
+
+// renderGrepValue renders v as compact JSON, shortened for display.
+func renderGrepValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	if runes := []rune(string(data)); len(runes) > grepValueMaxLen {
+		return string(runes[:grepValueMaxLen]) + "..."
+	}
+	return string(data)
+}
+
+// toGeneric round-trips v through JSON so it can be walked as maps and slices.
+func toGeneric(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+// rawPrefilterable reports whether the pattern can be tested against raw JSON
+// bytes without false negatives: it must be a plain literal with no characters
+// that JSON might escape.
+func rawPrefilterable(pattern *regexp.Regexp) bool {
+	expr := pattern.String()
+	if regexp.QuoteMeta(expr) != expr {
+		return false
+	}
+	for _, r := range expr {
+		if r >= 0x80 || strings.ContainsRune(`<>&"'\`, r) {
+			return false
+		}
+	}
+	return true
+}
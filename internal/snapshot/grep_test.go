@@ -0,0 +1,126 @@
+package snapshot
+
+import (
+	"regexp"
+	"testing"
+)
+
+func saveGrepFixtures(t *testing.T, store *Store) {
+	t.Helper()
+	fixtures := []*Snapshot{
+		{
+			ID:       "a",
+			Service:  "svc",
+			Tags:     []string{"users"},
+			Request:  Request{Method: "POST", URL: "/users", Body: map[string]any{"email": "alice@example.com"}},
+			Response: Response{Status: 201, Body: map[string]any{"id": float64(1), "email": "alice@example.com"}},
+			DBStateAfter: map[string][]map[string]any{
+				"users": {{"id": float64(1), "email": "alice@example.com"}},
+			},
+		},
+		{
+			ID:       "b",
+			Service:  "svc",
+			Request:  Request{Method: "GET", URL: "/orders"},
+			Response: Response{Status: 200, Body: []any{map[string]any{"total": float64(42)}}},
+		},
+	}
+	for _, snap := range fixtures {
+		if _, err := store.Save(snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStoreGrep(t *testing.T) {
+	store := NewStore(t.TempDir(), "json")
+	saveGrepFixtures(t, store)
+
+	results, err := store.Grep(GrepOptions{Pattern: regexp.MustCompile("alice")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Info.ID != "a" {
+		t.Fatalf("expected only snapshot a to match, got %+v", results)
+	}
+	fields := map[string]bool{}
+	for _, m := range results[0].Matches {
+		fields[m.Field] = true
+	}
+	for _, want := range []string{"request.body.email", "response.body.email", "db_state_after.users[0].email"} {
+		if !fields[want] {
+			t.Errorf("expected match at %s, got %v", want, results[0].Matches)
+		}
+	}
+}
+
+func TestStoreGrep_Scope(t *testing.T) {
+	store := NewStore(t.TempDir(), "json")
+	saveGrepFixtures(t, store)
+
+	results, err := store.Grep(GrepOptions{Pattern: regexp.MustCompile("alice"), Scope: GrepScopeDB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(results[0].Matches) != 1 || results[0].Matches[0].Field != "db_state_after.users[0].email" {
+		t.Errorf("expected a single DB match, got %+v", results)
+	}
+
+	results, err = store.Grep(GrepOptions{Pattern: regexp.MustCompile("^/ord"), Scope: GrepScopeRequestURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Info.ID != "b" {
+		t.Errorf("expected URL match on snapshot b, got %+v", results)
+	}
+}
+
+func TestStoreGrep_KeysAndNumbers(t *testing.T) {
+	store := NewStore(t.TempDir(), "yaml")
+	saveGrepFixtures(t, store)
+
+	results, err := store.Grep(GrepOptions{Pattern: regexp.MustCompile("^total$"), Scope: GrepScopeResponseBody})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Matches[0].Field != "response.body[0].total" || results[0].Matches[0].Value != "42" {
+		t.Errorf("expected key match with value, got %+v", results)
+	}
+
+	results, err = store.Grep(GrepOptions{Pattern: regexp.MustCompile("42")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Info.ID != "b" {
+		t.Errorf("expected numeric value match, got %+v", results)
+	}
+}
+
+func TestStoreGrep_Filter(t *testing.T) {
+	store := NewStore(t.TempDir(), "json")
+	saveGrepFixtures(t, store)
+
+	results, err := store.Grep(GrepOptions{Pattern: regexp.MustCompile("alice"), Filter: ListOptions{Method: "get"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected method filter to exclude matches, got %+v", results)
+	}
+}
+
+func TestRawPrefilterable(t *testing.T) {
+	cases := map[string]bool{
+		"alice":      true,
+		"alice.*":    false,
+		"<script>":   false,
+		"café":       false,
+		"(?i)alice":  false,
+		"user_email": true,
+	}
+	for expr, want := range cases {
+		if got := rawPrefilterable(regexp.MustCompile(expr)); got != want {
+			t.Errorf("rawPrefilterable(%q) = %v, want %v", expr, got, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// indexFile is the metadata index kept in the snapshot directory, so listing
+// and grep filter snapshots without reading every file. Entries are keyed by
+// path relative to the directory and refreshed when a file's size or
+// modification time changes; the index is a cache and safe to delete.
+const indexFile = ".index.json"
+
+// indexEntry is the cached metadata of one snapshot file.
+type indexEntry struct {
+	ModTime   int64     `json:"mtime"` // UnixNano
+	Size      int64     `json:"size"`
+	ID        string    `json:"id"`
+	Service   string    `json:"service"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Status    int       `json:"status"`
+	Tags      []string  `json:"tags,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (e indexEntry) info(path string) SnapshotInfo {
+	return SnapshotInfo{
+		ID:        e.ID,
+		Path:      path,
+		Service:   e.Service,
+		Method:    e.Method,
+		URL:       e.URL,
+		Status:    e.Status,
+		Tags:      e.Tags,
+		Timestamp: e.Timestamp,
+	}
+}
+
+// indexedInfos returns the metadata of the snapshot files at paths, from the
+// index where it is current and from the files otherwise, and brings the
+// index up to date. Failing to write the index is not an error, so a
+// read-only snapshot directory can still be listed.
+func (s *Store) indexedInfos(paths []string) ([]SnapshotInfo, error) {
+	index := s.loadIndex()
+	fresh := make(map[string]indexEntry, len(paths))
+	changed := len(index) != len(paths)
+
+	infos := make([]SnapshotInfo, 0, len(paths))
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := filepath.Rel(s.BaseDir, path)
+		if err != nil {
+			key = path
+		}
+		entry, ok := index[key]
+		if !ok || entry.ModTime != stat.ModTime().UnixNano() || entry.Size != stat.Size() {
+			info, err := s.loadInfo(path)
+			if err != nil {
+				return nil, err
+			}
+			timestamp, _ := info.Timestamp.(time.Time)
+			entry = indexEntry{
+				ModTime:   stat.ModTime().UnixNano(),
+				Size:      stat.Size(),
+				ID:        info.ID,
+				Service:   info.Service,
+				Method:    info.Method,
+				URL:       info.URL,
+				Status:    info.Status,
+				Tags:      info.Tags,
+				Timestamp: timestamp,
+			}
+			changed = true
+		}
+		fresh[key] = entry
+		infos = append(infos, entry.info(path))
+	}
+
+	if changed {
+		s.saveIndex(fresh)
+	}
+	return infos, nil
+}
+
+// loadIndex reads the metadata index, or returns an empty one if it is
+// missing or unreadable.
+func (s *Store) loadIndex() map[string]indexEntry {
+	index := make(map[string]indexEntry)
+	data, err := os.ReadFile(filepath.Join(s.BaseDir, indexFile))
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return make(map[string]indexEntry)
+	}
+	return index
+}
+
+func (s *Store) saveIndex(index map[string]indexEntry) {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return
+	}
+	tmp, err := writeTemp(s.BaseDir, data)
+	if err != nil {
+		return
+	}
+	if err := os.Rename(tmp, filepath.Join(s.BaseDir, indexFile)); err != nil {
+		os.Remove(tmp)
+	}
+}
@@ -0,0 +1,70 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestStoreGrep_UsesIndex(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	saveGrepFixtures(t, store)
+
+	results, err := store.Grep(GrepOptions{Pattern: regexp.MustCompile("users"), Scope: GrepScopeRequestURL})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("expected 1 result, got %v (err %v)", results, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, indexFile)); err != nil {
+		t.Fatalf("expected the index to be written: %v", err)
+	}
+
+	// Unchanged files are not read again: a URL search still answers from
+	// the index although the file's contents no longer match it
+	path := results[0].Info.Path
+	stat, _ := os.Stat(path)
+	data, _ := os.ReadFile(path)
+	hidden := regexp.MustCompile(`"/users"`).ReplaceAll(data, []byte(`"/xxxxx"`))
+	if err := os.WriteFile(path, hidden, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, stat.ModTime(), stat.ModTime())
+	results, err = store.Grep(GrepOptions{Pattern: regexp.MustCompile("users"), Scope: GrepScopeRequestURL})
+	if err != nil || len(results) != 1 {
+		t.Errorf("expected the indexed URL to match, got %v (err %v)", results, err)
+	}
+}
+
+func TestStoreListFiltered_RefreshesIndex(t *testing.T) {
+	store := NewStore(t.TempDir(), "json")
+	saveGrepFixtures(t, store)
+
+	infos, _, err := store.ListFiltered(ListOptions{Tag: "orders"})
+	if err != nil || len(infos) != 0 {
+		t.Fatalf("expected no tagged snapshots, got %v (err %v)", infos, err)
+	}
+
+	all, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range all {
+		if info.ID != "b" {
+			continue
+		}
+		snap, err := store.Load(info.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snap.Tags = []string{"orders", "reporting"}
+		if err := store.Update(info.Path, snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, _, err = store.ListFiltered(ListOptions{Tag: "orders"})
+	if err != nil || len(infos) != 1 || infos[0].ID != "b" {
+		t.Errorf("expected the updated snapshot, got %v (err %v)", infos, err)
+	}
+}
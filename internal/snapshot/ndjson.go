@@ -0,0 +1,63 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ndjsonContentTypes are the media types of newline-delimited JSON bodies.
+var ndjsonContentTypes = []string{
+	"application/x-ndjson",
+	"application/ndjson",
+	"application/jsonl",
+	"application/x-jsonlines",
+	"application/jsonlines",
+}
+
+func isNDJSONContentType(ct string) bool {
+	for _, t := range ndjsonContentTypes {
+		if strings.HasPrefix(ct, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNDJSON decodes a newline-delimited JSON body into the list of its
+// values, one per line. Blank lines are skipped; any other line that isn't
+// JSON is an error.
+func ParseNDJSON(raw []byte) ([]any, error) {
+	values := []any{}
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var v any
+		if err := json.Unmarshal(line, &v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return nil, errors.New("no JSON values")
+	}
+	return values, nil
+}
+
+// EncodeNDJSON reverses ParseNDJSON, writing each value on its own line
+// followed by a newline.
+func EncodeNDJSON(values []any) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, v := range values {
+		line, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,34 @@
+package snapshot
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchPath matches a URL path against a glob where * matches within a
+// segment and ** matches any number of segments, e.g. /api/** or /users/*.
+// Every config field that selects requests by path uses it.
+func MatchPath(pattern, urlPath string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(urlPath, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
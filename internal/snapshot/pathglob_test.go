@@ -0,0 +1,25 @@
+package snapshot
+
+import "testing"
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/health", "/health", true},
+		{"/health", "/healthz", false},
+		{"/users/*", "/users/7", true},
+		{"/users/*", "/users/7/orders", false},
+		{"/api/**", "/api", true},
+		{"/api/**", "/api/v1/users/7", true},
+		{"/api/**/orders", "/api/v1/users/7/orders", true},
+		{"/api/**/orders", "/api/v1/users/7", false},
+		{"/**/*.js", "/static/js/app.js", true},
+	}
+	for _, tt := range tests {
+		if got := MatchPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
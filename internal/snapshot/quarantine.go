@@ -0,0 +1,120 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// QuarantineFile is the name of the file in the snapshot directory listing
+// quarantined snapshots.
+const QuarantineFile = ".quarantine.json"
+
+// QuarantineEntry is a known-flaky snapshot. It is still replayed, but its
+// failures are reported separately and don't fail the run.
+type QuarantineEntry struct {
+	SnapshotID string    `json:"snapshot_id"`
+	Path       string    `json:"path"`
+	Reason     string    `json:"reason,omitempty"`
+	AddedBy    string    `json:"added_by"`
+	AddedAt    time.Time `json:"added_at"`
+}
+
+// Quarantine is the list of quarantined snapshots kept in a snapshot
+// directory. Snapshots are identified by ID, so moving a file keeps it in
+// quarantine.
+type Quarantine struct {
+	path    string
+	entries map[string]QuarantineEntry // snapshot ID -> entry
+}
+
+// LoadQuarantine reads the quarantine list of the snapshot directory
+// baseDir. A missing file yields an empty list.
+func LoadQuarantine(baseDir string) (*Quarantine, error) {
+	q := &Quarantine{path: filepath.Join(baseDir, QuarantineFile), entries: make(map[string]QuarantineEntry)}
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading quarantine list: %w", err)
+	}
+	var entries []QuarantineEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing quarantine list %s: %w", q.path, err)
+	}
+	for _, e := range entries {
+		q.entries[e.SnapshotID] = e
+	}
+	return q, nil
+}
+
+// Has reports whether the snapshot with the given ID is quarantined. A nil
+// quarantine has no snapshots.
+func (q *Quarantine) Has(id string) bool {
+	if q == nil {
+		return false
+	}
+	_, ok := q.entries[id]
+	return ok
+}
+
+// Add quarantines snap, saved at path, and reports whether it wasn't
+// quarantined already.
+func (q *Quarantine) Add(snap *Snapshot, path, reason string) bool {
+	if q.Has(snap.ID) {
+		return false
+	}
+	q.entries[snap.ID] = QuarantineEntry{
+		SnapshotID: snap.ID,
+		Path:       path,
+		Reason:     reason,
+		AddedBy:    currentUser(),
+		AddedAt:    time.Now().UTC(),
+	}
+	return true
+}
+
+// Remove releases the snapshot with the given ID from quarantine and
+// reports whether it was quarantined.
+func (q *Quarantine) Remove(id string) bool {
+	if !q.Has(id) {
+		return false
+	}
+	delete(q.entries, id)
+	return true
+}
+
+// Entries returns the quarantined snapshots, oldest first.
+func (q *Quarantine) Entries() []QuarantineEntry {
+	entries := make([]QuarantineEntry, 0, len(q.entries))
+	for _, e := range q.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].AddedAt.Equal(entries[j].AddedAt) {
+			return entries[i].AddedAt.Before(entries[j].AddedAt)
+		}
+		return entries[i].SnapshotID < entries[j].SnapshotID
+	})
+	return entries
+}
+
+// Save writes the quarantine list back to disk.
+func (q *Quarantine) Save() error {
+	data, err := json.MarshalIndent(q.Entries(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling quarantine list: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		return fmt.Errorf("creating quarantine directory: %w", err)
+	}
+	if err := os.WriteFile(q.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing quarantine list: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package snapshot
+
+import (
+	"testing"
+)
+
+func TestQuarantine(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := LoadQuarantine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Entries()) != 0 {
+		t.Fatalf("expected an empty quarantine, got %v", q.Entries())
+	}
+
+	flaky := &Snapshot{ID: "flaky1"}
+	if !q.Add(flaky, "api/GET_users/001.snapshot.json", "races with the cache warmer") {
+		t.Error("expected the snapshot to be added")
+	}
+	if q.Add(flaky, "api/GET_users/001.snapshot.json", "") {
+		t.Error("expected a second add to report it was quarantined already")
+	}
+	q.Add(&Snapshot{ID: "flaky2"}, "api/GET_orders/001.snapshot.json", "")
+	if err := q.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = LoadQuarantine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := q.Entries()
+	if len(entries) != 2 || entries[0].SnapshotID != "flaky1" || entries[0].Reason != "races with the cache warmer" {
+		t.Fatalf("unexpected entries after reload: %+v", entries)
+	}
+	if !q.Has("flaky2") || q.Has("stable") {
+		t.Error("expected only the quarantined snapshots to be reported")
+	}
+
+	if !q.Remove("flaky1") || q.Remove("flaky1") {
+		t.Error("expected flaky1 to be removed exactly once")
+	}
+	if q.Has("flaky1") {
+		t.Error("expected flaky1 to be released")
+	}
+}
@@ -0,0 +1,212 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scenariosDir holds the scenario files grouping snapshots into ordered
+// flows. Like statesDir, it cannot clash with a service directory.
+const scenariosDir = "_scenarios"
+
+// Scenario is an ordered sequence of snapshots recorded one after another,
+// such as login, create and delete, which the replayer executes in order
+// against the DB state captured before the first step.
+type Scenario struct {
+	Name    string         `json:"name"`
+	Service string         `json:"service,omitempty"`
+	Created time.Time      `json:"created"`
+	Steps   []ScenarioStep `json:"steps"`
+}
+
+// ScenarioStep refers to one snapshot of a scenario.
+type ScenarioStep struct {
+	ID   string `json:"id"`
+	Path string `json:"path"` // relative to the snapshot directory, slash-separated
+}
+
+var scenarioNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateScenarioName reports whether name can be used as a scenario file
+// name: letters, digits, ".", "_" and "-", starting with a letter or digit.
+func ValidateScenarioName(name string) error {
+	if !scenarioNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid scenario name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// AddScenarioStep appends the snapshot saved at snapPath to the named
+// scenario, creating the scenario if needed. Calls on the same Store are
+// serialized; recorders in separate processes must not share a scenario.
+func (s *Store) AddScenarioStep(name string, snap *Snapshot, snapPath string) error {
+	if err := ValidateScenarioName(name); err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(s.BaseDir, snapPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("snapshot %s is outside %s", snapPath, s.BaseDir)
+	}
+
+	s.scenarioMu.Lock()
+	defer s.scenarioMu.Unlock()
+	sc, err := s.loadScenarioFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		sc = &Scenario{Name: name, Service: snap.Service, Created: time.Now().UTC()}
+	} else if err != nil {
+		return err
+	}
+	sc.Steps = append(sc.Steps, ScenarioStep{ID: snap.ID, Path: filepath.ToSlash(rel)})
+	return s.writeScenario(name, sc)
+}
+
+// removeScenarioSteps drops the steps referring to the snapshot at snapPath
+// from every scenario, and removes scenarios left without steps.
+func (s *Store) removeScenarioSteps(snapPath string) error {
+	rel, err := filepath.Rel(s.BaseDir, snapPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+
+	s.scenarioMu.Lock()
+	defer s.scenarioMu.Unlock()
+	names, err := s.Scenarios()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		sc, err := s.loadScenarioFile(name)
+		if err != nil {
+			return err
+		}
+		steps := make([]ScenarioStep, 0, len(sc.Steps))
+		for _, step := range sc.Steps {
+			if step.Path != rel {
+				steps = append(steps, step)
+			}
+		}
+		if len(steps) == len(sc.Steps) {
+			continue
+		}
+		if len(steps) == 0 {
+			if err := os.Remove(s.scenarioPath(name)); err != nil {
+				return fmt.Errorf("removing scenario: %w", err)
+			}
+			continue
+		}
+		sc.Steps = steps
+		if err := s.writeScenario(name, sc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) writeScenario(name string, sc *Scenario) error {
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling scenario: %w", err)
+	}
+	file := s.scenarioPath(name)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return fmt.Errorf("creating scenarios directory: %w", err)
+	}
+	// Write to a temporary file and rename, as for DB states, so a replay
+	// started while recording never reads a partial scenario
+	tmp, err := os.CreateTemp(filepath.Dir(file), name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing scenario: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing scenario: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing scenario: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("writing scenario: %w", err)
+	}
+	return nil
+}
+
+// LoadScenario reads the named scenario and the snapshots of its steps, in
+// order, with their paths.
+func (s *Store) LoadScenario(name string) (*Scenario, []*Snapshot, []string, error) {
+	if err := ValidateScenarioName(name); err != nil {
+		return nil, nil, nil, err
+	}
+	sc, err := s.loadScenarioFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil, fmt.Errorf("scenario %s not found in %s", name, filepath.Join(s.BaseDir, scenariosDir))
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	snapshots := make([]*Snapshot, 0, len(sc.Steps))
+	paths := make([]string, 0, len(sc.Steps))
+	for i, step := range sc.Steps {
+		clean := path.Clean(step.Path)
+		if clean != step.Path || path.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+			return nil, nil, nil, fmt.Errorf("scenario %s: invalid path %q in step %d", name, step.Path, i+1)
+		}
+		p := filepath.Join(s.BaseDir, filepath.FromSlash(clean))
+		snap, err := s.Load(p)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("scenario %s: step %d (%s): %w", name, i+1, step.ID, err)
+		}
+		snapshots = append(snapshots, snap)
+		paths = append(paths, p)
+	}
+	return sc, snapshots, paths, nil
+}
+
+// Scenarios returns the names of all recorded scenarios, sorted.
+func (s *Store) Scenarios() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.BaseDir, scenariosDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing scenarios: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Store) loadScenarioFile(name string) (*Scenario, error) {
+	data, err := os.ReadFile(s.scenarioPath(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("reading scenario: %w", err)
+	}
+	var sc Scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("parsing scenario %s: %w", name, err)
+	}
+	return &sc, nil
+}
+
+func (s *Store) scenarioPath(name string) string {
+	return filepath.Join(s.BaseDir, scenariosDir, name+".json")
+}
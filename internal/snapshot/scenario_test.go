@@ -0,0 +1,91 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStoreScenario(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+
+	var ids []string
+	for _, req := range []Request{
+		{Method: "POST", URL: "/login"},
+		{Method: "POST", URL: "/items"},
+		{Method: "DELETE", URL: "/items/1"},
+	} {
+		snap := &Snapshot{ID: GenerateID(), Service: "api", Request: req}
+		path, err := store.Save(snap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddScenarioStep("crud", snap, path); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, snap.ID)
+	}
+
+	sc, snaps, paths, err := store.LoadScenario("crud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Name != "crud" || sc.Service != "api" || len(sc.Steps) != 3 {
+		t.Fatalf("unexpected scenario %+v", sc)
+	}
+	var got []string
+	for i, snap := range snaps {
+		got = append(got, snap.ID)
+		if !strings.HasPrefix(paths[i], dir) {
+			t.Errorf("expected step paths under the snapshot directory, got %s", paths[i])
+		}
+	}
+	if !reflect.DeepEqual(got, ids) {
+		t.Errorf("expected steps in recording order %v, got %v", ids, got)
+	}
+
+	// Scenario files are not snapshots
+	all, _, err := store.LoadAll()
+	if err != nil || len(all) != 3 {
+		t.Errorf("expected 3 snapshots, got %d (%v)", len(all), err)
+	}
+	if names, err := store.Scenarios(); err != nil || !reflect.DeepEqual(names, []string{"crud"}) {
+		t.Errorf("expected [crud], got %v (%v)", names, err)
+	}
+}
+
+func TestStoreScenario_Errors(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+
+	for _, name := range []string{"", "../up", "a/b", ".hidden"} {
+		if err := ValidateScenarioName(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+	if _, _, _, err := store.LoadScenario("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	snap := &Snapshot{ID: "a", Service: "api", Request: Request{Method: "GET", URL: "/"}}
+	path, err := store.Save(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddScenarioStep("flow", snap, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := store.LoadScenario("flow"); err == nil || !strings.Contains(err.Error(), "step 1") {
+		t.Errorf("expected the missing step to be reported, got %v", err)
+	}
+
+	if err := store.AddScenarioStep("flow", snap, filepath.Join(t.TempDir(), "x.snapshot.json")); err == nil {
+		t.Error("expected a snapshot outside the store to be rejected")
+	}
+}
@@ -0,0 +1,358 @@
+package snapshot
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Fields a selector expression can compare.
+const (
+	SelectorFieldID      = "id"
+	SelectorFieldService = "service"
+	SelectorFieldMethod  = "method" // compared case-insensitively
+	SelectorFieldURL     = "url"    // request URL as recorded, with its query string
+	SelectorFieldPath    = "path"   // request URL path, without the query string
+	SelectorFieldStatus  = "status" // recorded response status; the only field ordered with < <= > >=
+	SelectorFieldTag     = "tag"    // = and ~ match if any tag does; != and !~ if none does
+)
+
+// SelectorFields lists the fields a selector expression can compare.
+var SelectorFields = []string{SelectorFieldID, SelectorFieldService, SelectorFieldMethod, SelectorFieldURL, SelectorFieldPath, SelectorFieldStatus, SelectorFieldTag}
+
+// Selector chooses snapshots by their metadata with an expression such as
+//
+//	method=POST && path~"/api/users" && status<500
+//
+// Comparisons are field op value, where op is one of = != ~ !~ < <= > >=
+// (~ matches a regular expression) and value is a bare word or a quoted
+// string. Comparisons combine with &&, || and !, and group with parentheses;
+// && binds tighter than ||.
+type Selector struct {
+	expr string
+	root selectorNode
+}
+
+// ParseSelector parses a selector expression.
+func ParseSelector(expr string) (*Selector, error) {
+	tokens, err := lexSelector(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	p := &selectorParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEnd {
+		err = fmt.Errorf("unexpected %s at offset %d", p.peek(), p.peek().pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	return &Selector{expr: expr, root: root}, nil
+}
+
+// Matches reports whether the snapshot described by info is selected.
+func (s *Selector) Matches(info SnapshotInfo) bool {
+	return s.root.match(info)
+}
+
+// String returns the expression the selector was parsed from.
+func (s *Selector) String() string {
+	return s.expr
+}
+
+type selectorNode interface {
+	match(info SnapshotInfo) bool
+}
+
+type andNode struct{ left, right selectorNode }
+
+func (n andNode) match(info SnapshotInfo) bool { return n.left.match(info) && n.right.match(info) }
+
+type orNode struct{ left, right selectorNode }
+
+func (n orNode) match(info SnapshotInfo) bool { return n.left.match(info) || n.right.match(info) }
+
+type notNode struct{ operand selectorNode }
+
+func (n notNode) match(info SnapshotInfo) bool { return !n.operand.match(info) }
+
+// compareNode is a single field op value comparison.
+type compareNode struct {
+	field string
+	op    string
+	value string
+	num   int            // value as a number, for ordered comparisons of status
+	re    *regexp.Regexp // compiled value, for ~ and !~
+}
+
+func (n compareNode) match(info SnapshotInfo) bool {
+	if n.field == SelectorFieldTag {
+		// Negated operators select snapshots where no tag matches
+		positive := strings.TrimPrefix(n.op, "!")
+		for _, tag := range info.Tags {
+			if n.compare(positive, tag) {
+				return positive == n.op
+			}
+		}
+		return positive != n.op
+	}
+	switch n.op {
+	case "<":
+		return info.Status < n.num
+	case "<=":
+		return info.Status <= n.num
+	case ">":
+		return info.Status > n.num
+	case ">=":
+		return info.Status >= n.num
+	}
+	return n.compare(n.op, n.fieldValue(info))
+}
+
+// compare applies a string operator to a single value.
+func (n compareNode) compare(op, value string) bool {
+	switch op {
+	case "=":
+		return n.equal(value)
+	case "!=":
+		return !n.equal(value)
+	case "~":
+		return n.re.MatchString(value)
+	default: // "!~"
+		return !n.re.MatchString(value)
+	}
+}
+
+func (n compareNode) equal(value string) bool {
+	if n.field == SelectorFieldMethod {
+		return strings.EqualFold(value, n.value)
+	}
+	return value == n.value
+}
+
+func (n compareNode) fieldValue(info SnapshotInfo) string {
+	switch n.field {
+	case SelectorFieldID:
+		return info.ID
+	case SelectorFieldService:
+		return info.Service
+	case SelectorFieldMethod:
+		return info.Method
+	case SelectorFieldURL:
+		return info.URL
+	case SelectorFieldPath:
+		if u, err := url.Parse(info.URL); err == nil {
+			return u.Path
+		}
+		path, _, _ := strings.Cut(info.URL, "?")
+		return path
+	default: // SelectorFieldStatus
+		return strconv.Itoa(info.Status)
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEnd     tokenKind = iota
+	tokenWord              // field name or bare value
+	tokenString            // quoted value
+	tokenCompare           // = != ~ !~ < <= > >=
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type selectorToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t selectorToken) String() string {
+	if t.kind == tokenEnd {
+		return "end of filter"
+	}
+	return strconv.Quote(t.text)
+}
+
+// selectorOperators are matched longest first.
+var selectorOperators = []struct {
+	text string
+	kind tokenKind
+}{
+	{"&&", tokenAnd}, {"||", tokenOr},
+	{"==", tokenCompare}, {"!=", tokenCompare}, {"!~", tokenCompare}, {"<=", tokenCompare}, {">=", tokenCompare},
+	{"=", tokenCompare}, {"~", tokenCompare}, {"<", tokenCompare}, {">", tokenCompare},
+	{"!", tokenNot}, {"(", tokenOpen}, {")", tokenClose},
+}
+
+func lexSelector(expr string) ([]selectorToken, error) {
+	var tokens []selectorToken
+	i := 0
+next:
+	for i < len(expr) {
+		c := rune(expr[i])
+		if unicode.IsSpace(c) {
+			i++
+			continue
+		}
+		if c == '"' {
+			value, n, err := lexString(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w at offset %d", err, i)
+			}
+			tokens = append(tokens, selectorToken{tokenString, value, i})
+			i += n
+			continue
+		}
+		for _, op := range selectorOperators {
+			if strings.HasPrefix(expr[i:], op.text) {
+				text := op.text
+				if text == "==" {
+					text = "="
+				}
+				tokens = append(tokens, selectorToken{op.kind, text, i})
+				i += len(op.text)
+				continue next
+			}
+		}
+		start := i
+		for i < len(expr) && !unicode.IsSpace(rune(expr[i])) && !strings.ContainsRune(`"&|=!~<>()`, rune(expr[i])) {
+			i++
+		}
+		if i == start {
+			return nil, fmt.Errorf("unexpected %q at offset %d", expr[i], i)
+		}
+		tokens = append(tokens, selectorToken{tokenWord, expr[start:i], start})
+	}
+	return append(tokens, selectorToken{kind: tokenEnd, pos: len(expr)}), nil
+}
+
+// lexString reads a double-quoted string at the start of s, where \" and \\
+// are escapes, and returns its value and length in s.
+func lexString(s string) (string, int, error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return sb.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+				i++
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+type selectorParser struct {
+	tokens []selectorToken
+	pos    int
+}
+
+func (p *selectorParser) peek() selectorToken { return p.tokens[p.pos] }
+
+func (p *selectorParser) next() selectorToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *selectorParser) parseOr() (selectorNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek().kind == tokenOr {
+		p.next()
+		var right selectorNode
+		if right, err = p.parseAnd(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *selectorParser) parseAnd() (selectorNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek().kind == tokenAnd {
+		p.next()
+		var right selectorNode
+		if right, err = p.parseUnary(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *selectorParser) parseUnary() (selectorNode, error) {
+	switch t := p.next(); t.kind {
+	case tokenNot:
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	case tokenOpen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenClose {
+			return nil, fmt.Errorf("expected \")\" at offset %d, got %s", closing.pos, closing)
+		}
+		return inner, nil
+	case tokenWord:
+		return p.parseComparison(t)
+	default:
+		return nil, fmt.Errorf("expected a comparison at offset %d, got %s", t.pos, t)
+	}
+}
+
+func (p *selectorParser) parseComparison(field selectorToken) (selectorNode, error) {
+	name := strings.ToLower(field.text)
+	known := false
+	for _, f := range SelectorFields {
+		known = known || f == name
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown field %q at offset %d (valid fields: %s)", field.text, field.pos, strings.Join(SelectorFields, ", "))
+	}
+
+	op := p.next()
+	if op.kind != tokenCompare {
+		return nil, fmt.Errorf("expected an operator after %q at offset %d, got %s", field.text, op.pos, op)
+	}
+	value := p.next()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, fmt.Errorf("expected a value after %q at offset %d, got %s", field.text+op.text, value.pos, value)
+	}
+
+	node := compareNode{field: name, op: op.text, value: value.text}
+	var err error
+	switch op.text {
+	case "~", "!~":
+		if node.re, err = regexp.Compile(value.text); err != nil {
+			return nil, fmt.Errorf("invalid regular expression at offset %d: %w", value.pos, err)
+		}
+	case "<", "<=", ">", ">=":
+		if name != SelectorFieldStatus {
+			return nil, fmt.Errorf("%s at offset %d only applies to %s", op.text, op.pos, SelectorFieldStatus)
+		}
+		fallthrough
+	default:
+		if name == SelectorFieldStatus {
+			if node.num, err = strconv.Atoi(value.text); err != nil {
+				return nil, fmt.Errorf("status must be a number at offset %d, got %s", value.pos, value)
+			}
+			node.value = strconv.Itoa(node.num)
+		}
+	}
+	return node, nil
+}
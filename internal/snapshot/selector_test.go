@@ -0,0 +1,109 @@
+package snapshot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelector_Matches(t *testing.T) {
+	info := SnapshotInfo{
+		ID:      "create-user",
+		Service: "users",
+		Method:  "POST",
+		URL:     "/api/users?notify=true",
+		Status:  201,
+		Tags:    []string{"smoke", "users"},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`method=POST && path~"/api/users" && status<500`, true},
+		{`method=post`, true},
+		{`method==GET`, false},
+		{`path="/api/users"`, true},
+		{`url="/api/users"`, false},
+		{`url~"notify=true$"`, true},
+		{`status>=200 && status<300`, true},
+		{`status=201`, true},
+		{`status!=201`, false},
+		{`status~^2`, true},
+		{`tag=smoke`, true},
+		{`tag=slow`, false},
+		{`tag!=slow`, true},
+		{`tag!=smoke`, false},
+		{`tag~^us`, true},
+		{`tag!~^us`, false},
+		{`service=orders || id=create-user`, true},
+		{`service=orders || id=other && status=201`, false},
+		{`(service=orders || id=create-user) && status=201`, true},
+		{`!method=GET`, true},
+		{`!(method=POST && tag=smoke)`, false},
+		{`id="create-user"`, true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSelector(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := sel.Matches(info); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelector_Errors(t *testing.T) {
+	tests := map[string]string{
+		``:                      "expected a comparison",
+		`method`:                "expected an operator",
+		`method=`:               "expected a value",
+		`verb=GET`:              "unknown field",
+		`path<"/a"`:             "only applies to status",
+		`status>abc`:            "status must be a number",
+		`path~"("`:              "invalid regular expression",
+		`path="/a`:              "unterminated string",
+		`(method=GET`:           `expected ")"`,
+		`method=GET status=200`: "unexpected",
+		`method=GET &&`:         "expected a comparison",
+	}
+	for expr, want := range tests {
+		_, err := ParseSelector(expr)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseSelector(%q): expected an error containing %q, got %v", expr, want, err)
+		}
+	}
+}
+
+func TestStore_LoadSelected(t *testing.T) {
+	store := NewStore(t.TempDir(), FormatJSON)
+	for _, snap := range []*Snapshot{
+		{ID: "a", Service: "svc", Request: Request{Method: "GET", URL: "/users"}, Response: Response{Status: 200}},
+		{ID: "b", Service: "svc", Request: Request{Method: "POST", URL: "/users"}, Response: Response{Status: 201}},
+		{ID: "c", Service: "svc", Request: Request{Method: "POST", URL: "/orders"}, Response: Response{Status: 500}},
+	} {
+		if _, err := store.Save(snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sel, err := ParseSelector(`method=POST && status<500`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaps, paths, err := store.LoadSelected(sel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 || snaps[0].ID != "b" || len(paths) != 1 {
+		t.Errorf("expected only snapshot b, got %d snapshot(s): %v", len(snaps), paths)
+	}
+
+	infos, total, err := store.ListFiltered(ListOptions{Selector: sel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || infos[0].ID != "b" {
+		t.Errorf("expected ListFiltered to apply the selector, got %d match(es)", total)
+	}
+}
@@ -0,0 +1,46 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ValidateSessionName reports whether name can be used as a recording
+// session directory: letters, digits, ".", "_" and "-", starting with a
+// letter or digit, so sessions never collide with _states, _bodies and
+// _scenarios.
+func ValidateSessionName(name string) error {
+	if !scenarioNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid session name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// clearEndpoint deletes the snapshots in an endpoint directory the first
+// time Save writes to it, when the store overwrites, as Delete does. Later
+// saves to the same endpoint add to the snapshots of this run.
+func (s *Store) clearEndpoint(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cleared[dir] {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading snapshot directory: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !isSnapshotFile(e.Name()) {
+			continue
+		}
+		if err := s.Delete(filepath.Join(dir, e.Name())); err != nil {
+			return fmt.Errorf("removing old snapshot: %w", err)
+		}
+	}
+	if s.cleared == nil {
+		s.cleared = make(map[string]bool)
+	}
+	s.cleared[dir] = true
+	return nil
+}
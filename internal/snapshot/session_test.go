@@ -0,0 +1,150 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreSession(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	store.Session = "nightly"
+
+	path, err := store.Save(&Snapshot{ID: "a", Service: "api", Request: Request{Method: "GET", URL: "/users"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "nightly", "api", "GET_users", "001_a.snapshot.json")
+	if path != want {
+		t.Errorf("expected %s, got %s", want, path)
+	}
+
+	// Replay loads every session from the snapshot directory
+	_, paths, err := NewStore(dir, "json").LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != want {
+		t.Errorf("expected LoadAll to find the session snapshot, got %v", paths)
+	}
+}
+
+func TestStoreOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	users := Request{Method: "GET", URL: "/users"}
+
+	old := NewStore(dir, "json")
+	for _, id := range []string{"old1", "old2"} {
+		if _, err := old.Save(&Snapshot{ID: id, Service: "api", Request: users}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := old.Save(&Snapshot{ID: "other", Service: "api", Request: Request{Method: "GET", URL: "/items"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(dir, "json")
+	store.Overwrite = true
+	var saved []string
+	for _, id := range []string{"new1", "new2"} {
+		path, err := store.Save(&Snapshot{ID: id, Service: "api", Request: users})
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, filepath.Base(path))
+	}
+	if strings.Join(saved, ",") != "001_new1.snapshot.json,002_new2.snapshot.json" {
+		t.Errorf("expected the run's snapshots to be numbered from 1, got %v", saved)
+	}
+
+	_, paths, err := store.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range paths {
+		names = append(names, filepath.Base(p))
+	}
+	if len(names) != 3 || strings.Contains(strings.Join(names, ","), "old") {
+		t.Errorf("expected only /users snapshots to be replaced, got %v", names)
+	}
+}
+
+func TestStoreOverwrite_CleansUp(t *testing.T) {
+	dir := t.TempDir()
+	users := Request{Method: "GET", URL: "/users"}
+	large := func(text string) Response {
+		return Response{Status: 200, Body: strings.Repeat(text, 20)}
+	}
+
+	old := NewStore(dir, "json")
+	old.BodyFileThreshold = 64
+	oldPath, err := old.Save(&Snapshot{ID: "old", Service: "api", Request: users, Response: large("only in old ")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	itemsPath, err := old.Save(&Snapshot{ID: "items", Service: "api", Request: Request{Method: "GET", URL: "/items"}, Response: large("shared ")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Save(&Snapshot{ID: "shared", Service: "api", Request: users, Response: large("shared ")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.AddScenarioStep("flow", &Snapshot{ID: "old", Service: "api"}, oldPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.AddScenarioStep("only-old", &Snapshot{ID: "old", Service: "api"}, oldPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.AddScenarioStep("flow", &Snapshot{ID: "items", Service: "api"}, itemsPath); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(dir, "json")
+	store.Overwrite = true
+	store.Audit = NewAuditLog(dir, "record --overwrite")
+	if _, err := store.Save(&Snapshot{ID: "new", Service: "api", Request: users}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, bodiesDir, "*", "*"))
+	if len(files) != 1 {
+		t.Errorf("expected only the body file still referred to by /items to be kept, got %v", files)
+	}
+	names, err := store.Scenarios()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "flow" {
+		t.Errorf("expected the scenario left without steps to be removed, got %v", names)
+	}
+	sc, err := store.loadScenarioFile("flow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.Steps) != 1 || sc.Steps[0].ID != "items" {
+		t.Errorf("expected the steps of removed snapshots to be dropped, got %v", sc.Steps)
+	}
+
+	entries, err := ReadAuditLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != AuditActionDelete {
+		t.Errorf("expected both removed snapshots in the audit log, got %+v", entries)
+	}
+}
+
+func TestValidateSessionName(t *testing.T) {
+	for _, name := range []string{"nightly", "2026-10-18", "v1.2_rc"} {
+		if err := ValidateSessionName(name); err != nil {
+			t.Errorf("expected %q to be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "_states", "../up", "a/b"} {
+		if err := ValidateSessionName(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
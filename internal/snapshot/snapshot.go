@@ -2,7 +2,7 @@ package snapshot
 
 import (
 	"crypto/rand"
-	"encoding/hex"
+	"sync"
 	"time"
 )
 
@@ -12,12 +12,22 @@ type Snapshot struct {
 	Timestamp        time.Time                    `json:"timestamp" yaml:"timestamp"`
 	Service          string                       `json:"service" yaml:"service"`
 	Tags             []string                     `json:"tags,omitempty" yaml:"tags,omitempty"`
+	DependsOn        []string                     `json:"depends_on,omitempty" yaml:"depends_on,omitempty"` // IDs of snapshots replayed first, whose DB state this one continues from
 	DBStateBefore    map[string][]map[string]any  `json:"db_state_before" yaml:"db_state_before"`
+	DBStateBeforeRef string                       `json:"db_state_before_ref,omitempty" yaml:"db_state_before_ref,omitempty"` // digest of a shared state file, with recording.dedup_db_states
 	Request          Request                      `json:"request" yaml:"request"`
 	OutgoingRequests []OutgoingRequest            `json:"outgoing_requests,omitempty" yaml:"outgoing_requests,omitempty"`
 	Response         Response                     `json:"response" yaml:"response"`
+	WebSocket        []Message                    `json:"websocket,omitempty" yaml:"websocket,omitempty"` // messages of an upgraded connection, in order
 	DBStateAfter     map[string][]map[string]any  `json:"db_state_after" yaml:"db_state_after"`
+	DBStateAfterRef  string                       `json:"db_state_after_ref,omitempty" yaml:"db_state_after_ref,omitempty"`
 	DBDiff           map[string]TableDiff         `json:"db_diff" yaml:"db_diff"`
+	DBSchema         map[string]TableSchema       `json:"db_schema,omitempty" yaml:"db_schema,omitempty"` // with recording.capture_schema
+	Queries          []Query                      `json:"queries,omitempty" yaml:"queries,omitempty"` // SQL the service executed, with the sqlcapture driver
+	Timing           *Timing                      `json:"timing,omitempty" yaml:"timing,omitempty"`
+	Replay           *ReplayOptions               `json:"replay,omitempty" yaml:"replay,omitempty"` // overrides of the replay config for this snapshot
+	ImportedFrom     string                       `json:"imported_from,omitempty" yaml:"imported_from,omitempty"` // format the snapshot was imported from, e.g. "har"; such snapshots carry no DB state
+	ServiceLogs      string                       `json:"service_logs,omitempty" yaml:"service_logs,omitempty"` // output of the service while it handled the request, with record --start-service
 }
 
 // Request represents the incoming HTTP request.
@@ -33,15 +43,42 @@ type Response struct {
 	Status  int               `json:"status" yaml:"status"`
 	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
 	Body    any               `json:"body,omitempty" yaml:"body,omitempty"`
+	Events  []Event           `json:"events,omitempty" yaml:"events,omitempty"` // Server-Sent Events, in place of the body
+	Chunks  []Chunk           `json:"chunks,omitempty" yaml:"chunks,omitempty"` // boundaries of a streamed body, when recording.capture_chunks is set
+	Trailers map[string]string `json:"trailers,omitempty" yaml:"trailers,omitempty"` // HTTP trailers sent after the body, e.g. grpc-status
 }
 
 // OutgoingRequest represents an outgoing HTTP call made by the service.
 type OutgoingRequest struct {
-	Method   string            `json:"method" yaml:"method"`
-	URL      string            `json:"url" yaml:"url"`
-	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
-	Body     any               `json:"body,omitempty" yaml:"body,omitempty"`
-	Response *Response         `json:"response,omitempty" yaml:"response,omitempty"`
+	Method     string            `json:"method" yaml:"method"`
+	URL        string            `json:"url" yaml:"url"`
+	Headers    map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body       any               `json:"body,omitempty" yaml:"body,omitempty"`
+	Response   *Response         `json:"response,omitempty" yaml:"response,omitempty"`
+	DurationMs int64             `json:"duration_ms,omitempty" yaml:"duration_ms,omitempty"` // time the upstream took to answer, when recorded
+}
+
+// Query is an SQL statement the service executed while handling the request,
+// in the order executed.
+type Query struct {
+	SQL  string `json:"sql" yaml:"sql"`
+	Args []any  `json:"args,omitempty" yaml:"args,omitempty"` // binary values as {"data": ..., "encoding": "base64"}
+}
+
+// Timing records how long a request took when it was recorded.
+type Timing struct {
+	DurationMs int64 `json:"duration_ms" yaml:"duration_ms"` // from receiving the request to saving its snapshot, including DB snapshots
+	UpstreamMs int64 `json:"upstream_ms" yaml:"upstream_ms"` // from forwarding the request to the end of the service's response
+}
+
+// ReplayOptions overrides the replay config for one snapshot, e.g. a longer
+// timeout for an endpoint that legitimately takes long.
+type ReplayOptions struct {
+	TimeoutMs     int      `json:"timeout_ms,omitempty" yaml:"timeout_ms,omitempty"`         // in place of replay.timeout_ms
+	IgnoreFields  []string `json:"ignore_fields,omitempty" yaml:"ignore_fields,omitempty"`   // in addition to ignore_fields
+	RetryAttempts int      `json:"retry_attempts,omitempty" yaml:"retry_attempts,omitempty"` // in place of replay.retry.attempts
+	Assert        string   `json:"assert,omitempty" yaml:"assert,omitempty"`                 // in place of replay.assert
+	WarnOnly      []string `json:"warn_only,omitempty" yaml:"warn_only,omitempty"`           // in addition to replay.warn_only
 }
 
 // TableDiff represents changes to a single database table.
@@ -57,9 +94,98 @@ type ModifiedRow struct {
 	After  map[string]any `json:"after" yaml:"after"`
 }
 
-// GenerateID creates a random hex ID.
+// TableSchema describes a table's columns and indexes at recording time.
+type TableSchema struct {
+	Columns []ColumnSchema `json:"columns" yaml:"columns"`
+	Indexes []IndexSchema  `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+}
+
+// ColumnSchema describes a single column.
+type ColumnSchema struct {
+	Name     string `json:"name" yaml:"name"`
+	Type     string `json:"type" yaml:"type"`
+	Nullable bool   `json:"nullable" yaml:"nullable"`
+}
+
+// IndexSchema describes an index by its key columns, in order.
+type IndexSchema struct {
+	Name    string   `json:"name" yaml:"name"`
+	Columns []string `json:"columns" yaml:"columns"`
+	Unique  bool     `json:"unique,omitempty" yaml:"unique,omitempty"`
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ulidMu       sync.Mutex
+	ulidLastMs   uint64
+	ulidLastRand [10]byte
+)
+
+// GenerateID creates a ULID: a 26-character, lexicographically sortable ID made
+// of a 48-bit millisecond timestamp and 80 bits of randomness. IDs generated in
+// the same millisecond by this process increment the random part, so they stay
+// strictly ordered.
 func GenerateID() string {
-	b := make([]byte, 6)
-	_, _ = rand.Read(b)
-	return hex.EncodeToString(b)
+	return newULID(time.Now())
+}
+
+func newULID(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+
+	ulidMu.Lock()
+	var entropy [10]byte
+	if ms == ulidLastMs {
+		entropy = ulidLastRand
+		incrementEntropy(&entropy)
+	} else {
+		_, _ = rand.Read(entropy[:])
+	}
+	ulidLastMs = ms
+	ulidLastRand = entropy
+	ulidMu.Unlock()
+
+	var id [16]byte
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+	copy(id[6:], entropy[:])
+	return encodeCrockford(id)
+}
+
+func incrementEntropy(e *[10]byte) {
+	for i := len(e) - 1; i >= 0; i-- {
+		e[i]++
+		if e[i] != 0 {
+			return
+		}
+	}
+}
+
+// encodeCrockford encodes 128 bits as 26 base32 characters (the first
+// character carries only 3 bits).
+func encodeCrockford(id [16]byte) string {
+	out := make([]byte, 26)
+	// Process the 128-bit value as big-endian, 5 bits at a time from the end
+	var carry uint16
+	bits := 0
+	pos := 25
+	for i := 15; i >= 0; i-- {
+		carry |= uint16(id[i]) << bits
+		bits += 8
+		for bits >= 5 && pos >= 0 {
+			out[pos] = crockford[carry&0x1F]
+			carry >>= 5
+			bits -= 5
+			pos--
+		}
+	}
+	if pos >= 0 {
+		out[pos] = crockford[carry&0x1F]
+	}
+	return string(out)
 }
@@ -0,0 +1,45 @@
+package snapshot
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateID_ULIDFormat(t *testing.T) {
+	id := GenerateID()
+	if len(id) != 26 {
+		t.Fatalf("expected 26-character ULID, got %q", id)
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(crockford, c) {
+			t.Fatalf("unexpected character %q in %q", c, id)
+		}
+	}
+}
+
+func TestNewULID_TimestampPrefix(t *testing.T) {
+	// Reference value from the ULID specification
+	id := newULID(time.UnixMilli(1469918176385))
+	if id[:10] != "01ARYZ6S41" {
+		t.Errorf("expected timestamp prefix 01ARYZ6S41, got %s", id[:10])
+	}
+}
+
+func TestGenerateID_Sortable(t *testing.T) {
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = GenerateID()
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Error("expected IDs generated in sequence to sort chronologically")
+	}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate ID %s", id)
+		}
+		seen[id] = true
+	}
+}
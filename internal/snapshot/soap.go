@@ -0,0 +1,86 @@
+package snapshot
+
+import (
+	"mime"
+	"sort"
+	"strings"
+)
+
+// SOAPOperation returns the name of the SOAP operation a request invokes,
+// since SOAP services take every operation at one URL. The operation is the
+// last part of the SOAPAction header, or of the action parameter of a SOAP
+// 1.2 Content-Type, and otherwise the first element in the envelope's Body.
+// It returns "" for requests that aren't SOAP calls.
+func SOAPOperation(headers map[string]string, body any) string {
+	action := strings.Trim(headerValue(headers, HeaderSOAPAction), `"`)
+	if action == "" {
+		if _, params, err := mime.ParseMediaType(headerValue(headers, HeaderContentType)); err == nil {
+			action = params["action"]
+		}
+	}
+	if action != "" {
+		if i := strings.LastIndexAny(action, "/#:"); i >= 0 {
+			action = action[i+1:]
+		}
+		if action != "" {
+			return action
+		}
+	}
+
+	var doc map[string]any
+	switch b := body.(type) {
+	case *EncodedBody:
+		if b.Encoding == BodyEncodingXML {
+			doc, _ = b.Data.(map[string]any)
+		}
+	case map[string]any:
+		if b["encoding"] == BodyEncodingXML {
+			doc, _ = b["data"].(map[string]any)
+		}
+	}
+	envelope, _ := xmlChild(doc, "Envelope").(map[string]any)
+	soapBody, _ := xmlChild(envelope, "Body").(map[string]any)
+	return xmlLocalName(firstXMLElement(soapBody))
+}
+
+// xmlChild returns the child element of a parsed XML element with the given
+// local name, whatever its namespace prefix.
+func xmlChild(element map[string]any, local string) any {
+	for name, v := range element {
+		if xmlLocalName(name) == local && !isXMLMetaKey(name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// firstXMLElement returns the name of the first child element of a parsed
+// XML element, or "".
+func firstXMLElement(element map[string]any) string {
+	if order, ok := element[XMLOrderKey].([]any); ok && len(order) > 0 {
+		name, _ := order[0].(string)
+		return name
+	}
+	var names []string
+	for name := range element {
+		if !isXMLMetaKey(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+func isXMLMetaKey(name string) bool {
+	return strings.HasPrefix(name, XMLAttrPrefix) || strings.HasPrefix(name, "#") || name == XMLDeclKey
+}
+
+func xmlLocalName(name string) string {
+	if i := strings.LastIndex(name, xmlPrefixSep); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,51 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSOAPOperation(t *testing.T) {
+	envelope := ParseBody([]byte(`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:m="urn:stock">`+
+		`<soapenv:Header><m:Trace>1</m:Trace></soapenv:Header>`+
+		`<soapenv:Body><m:GetPrice><m:Symbol>ACME</m:Symbol></m:GetPrice></soapenv:Body></soapenv:Envelope>`), "text/xml")
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		body    any
+		want    string
+	}{
+		{"action URL", map[string]string{"Soapaction": `"http://example.com/stock/GetQuote"`}, envelope, "GetQuote"},
+		{"action URN", map[string]string{"SOAPAction": "urn:stock#GetQuote"}, nil, "GetQuote"},
+		{"SOAP 1.2 action", map[string]string{"Content-Type": `application/soap+xml; charset=utf-8; action="urn:stock:GetQuote"`}, nil, "GetQuote"},
+		{"empty action uses body", map[string]string{"SOAPAction": `""`}, envelope, "GetPrice"},
+		{"loaded body", nil, map[string]any{"encoding": "xml", "data": envelope.(*EncodedBody).Data}, "GetPrice"},
+		{"not SOAP", map[string]string{"Content-Type": "application/json"}, map[string]any{"op": "GetPrice"}, ""},
+		{"XML without envelope", nil, ParseBody([]byte(`<GetPrice/>`), "application/xml"), ""},
+	}
+	for _, tt := range tests {
+		if got := SOAPOperation(tt.headers, tt.body); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStoreSave_SOAPOperationDirectories(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	for _, op := range []string{"GetPrice", "SetPrice"} {
+		path, err := store.Save(&Snapshot{
+			ID:       op,
+			Service:  "stock",
+			Request:  Request{Method: "POST", URL: "/ws", Headers: map[string]string{"SOAPAction": "urn:stock#" + op}},
+			Response: Response{Status: 200},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(dir, "stock", "POST_ws_"+op); filepath.Dir(path) != want {
+			t.Errorf("expected %s in %s, got %s", op, want, path)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package snapshot
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentTypeEventStream is the content type of Server-Sent Events responses.
+const ContentTypeEventStream = "text/event-stream"
+
+// Event is one Server-Sent Event. Data is parsed JSON when the event's data
+// holds JSON, a string otherwise.
+type Event struct {
+	ID       string `json:"id,omitempty" yaml:"id,omitempty"`
+	Event    string `json:"event,omitempty" yaml:"event,omitempty"`
+	Data     any    `json:"data" yaml:"data"`
+	Retry    int    `json:"retry,omitempty" yaml:"retry,omitempty"`
+	OffsetMs int64  `json:"offset_ms" yaml:"offset_ms"` // time from the response headers to the event; not compared on replay
+}
+
+// IsEventStream reports whether a Content-Type denotes a Server-Sent Events
+// stream.
+func IsEventStream(contentType string) bool {
+	return NormalizeContentType(contentType) == ContentTypeEventStream
+}
+
+// EventParser splits a text/event-stream body into events as it arrives,
+// stamping each with its offset from start.
+type EventParser struct {
+	Events []Event
+
+	start   time.Time
+	pending []byte // bytes after the last complete line
+	data    []string
+	current Event
+}
+
+// NewEventParser returns a parser for a stream that started at start.
+func NewEventParser(start time.Time) *EventParser {
+	return &EventParser{start: start}
+}
+
+// Write feeds stream bytes to the parser. It never fails.
+func (p *EventParser) Write(b []byte) (int, error) {
+	p.pending = append(p.pending, b...)
+	for {
+		i := bytes.IndexAny(p.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+		// A \r at the very end may be the first half of \r\n
+		if p.pending[i] == '\r' && i == len(p.pending)-1 {
+			break
+		}
+		line := string(p.pending[:i])
+		next := i + 1
+		if p.pending[i] == '\r' && p.pending[i+1] == '\n' {
+			next++
+		}
+		p.pending = p.pending[next:]
+		p.line(line)
+	}
+	return len(b), nil
+}
+
+// line processes one line of the stream, following the HTML event stream
+// interpretation rules.
+func (p *EventParser) line(line string) {
+	if line == "" {
+		p.dispatch()
+		return
+	}
+	if strings.HasPrefix(line, ":") {
+		return // comment
+	}
+	field, value, _ := strings.Cut(line, ":")
+	value = strings.TrimPrefix(value, " ")
+	switch field {
+	case "event":
+		p.current.Event = value
+	case "data":
+		p.data = append(p.data, value)
+	case "id":
+		if !strings.Contains(value, "\x00") {
+			p.current.ID = value
+		}
+	case "retry":
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			p.current.Retry = n
+		}
+	}
+}
+
+// dispatch completes the current event. Events without data are dropped,
+// as browsers do.
+func (p *EventParser) dispatch() {
+	if len(p.data) > 0 {
+		e := p.current
+		e.Data = ParseBody([]byte(strings.Join(p.data, "\n")), "")
+		if e.Data == nil {
+			e.Data = ""
+		}
+		e.OffsetMs = time.Since(p.start).Milliseconds()
+		p.Events = append(p.Events, e)
+	}
+	p.current = Event{}
+	p.data = nil
+}
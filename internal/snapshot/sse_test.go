@@ -0,0 +1,43 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventParser(t *testing.T) {
+	stream := ": keep-alive\n\n" +
+		"id: 1\nevent: update\ndata: {\"n\":1}\n\n" +
+		"data: line one\r\ndata: line two\r\n\r\n" +
+		"retry: 3000\ndata:no space\r\r" +
+		"event: ignored\n\n" +
+		"data: incomplete"
+
+	p := NewEventParser(time.Now())
+	// Feed byte by byte so lines and \r\n pairs split across writes
+	for i := 0; i < len(stream); i++ {
+		p.Write([]byte{stream[i]})
+	}
+
+	want := []Event{
+		{ID: "1", Event: "update", Data: map[string]any{"n": float64(1)}},
+		{Data: "line one\nline two"},
+		{Data: "no space", Retry: 3000},
+	}
+	for i := range p.Events {
+		p.Events[i].OffsetMs = 0
+	}
+	if !reflect.DeepEqual(p.Events, want) {
+		t.Errorf("events = %#v, want %#v", p.Events, want)
+	}
+}
+
+func TestIsEventStream(t *testing.T) {
+	if !IsEventStream("text/event-stream; charset=utf-8") {
+		t.Error("expected text/event-stream to be an event stream")
+	}
+	if IsEventStream("text/plain") {
+		t.Error("expected text/plain not to be an event stream")
+	}
+}
@@ -0,0 +1,142 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// statesDir holds the DB states shared between snapshots when DedupStates
+// is set. Service directories never start with "_", so it cannot clash with
+// one.
+const statesDir = "_states"
+
+// stateRefPrefix starts every DB state reference; the rest is the hex
+// SHA-256 of the state's JSON encoding.
+const stateRefPrefix = "sha256:"
+
+// encode marshals snap for writing. With DedupStates, non-empty DB states
+// are written once to the states directory and the snapshot refers to them
+// by digest instead of embedding them. With BodyFileThreshold, large bodies
+// are written to body files the same way.
+func (s *Store) encode(snap *Snapshot) ([]byte, error) {
+	out := *snap
+	if err := s.externalizeBodies(&out); err != nil {
+		return nil, err
+	}
+	out.DBStateBeforeRef, out.DBStateAfterRef = "", ""
+	if s.DedupStates {
+		var err error
+		if out.DBStateBeforeRef, err = s.storeState(snap.DBStateBefore); err != nil {
+			return nil, err
+		}
+		if out.DBStateAfterRef, err = s.storeState(snap.DBStateAfter); err != nil {
+			return nil, err
+		}
+		if out.DBStateBeforeRef != "" {
+			out.DBStateBefore = nil
+		}
+		if out.DBStateAfterRef != "" {
+			out.DBStateAfter = nil
+		}
+	}
+	return s.marshal(&out)
+}
+
+// storeState writes state to the states directory unless an identical state
+// is already there, and returns its reference. Empty states are not stored
+// and return "".
+func (s *Store) storeState(state map[string][]map[string]any) (string, error) {
+	if len(state) == 0 {
+		return "", nil
+	}
+	// json.Marshal sorts map keys, so equal states always get the same digest
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", fmt.Errorf("marshaling DB state: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+
+	path := s.statePath(digest)
+	if _, err := os.Stat(path); err == nil {
+		return stateRefPrefix + digest, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("creating states directory: %w", err)
+	}
+	// Write to a temporary file and rename, so concurrent writers of the same
+	// state never expose a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), digest+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("writing DB state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("writing DB state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("writing DB state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("writing DB state: %w", err)
+	}
+	return stateRefPrefix + digest, nil
+}
+
+// resolveStates loads the DB states snap refers to by digest.
+func (s *Store) resolveStates(snap *Snapshot) error {
+	var err error
+	if snap.DBStateBeforeRef != "" && snap.DBStateBefore == nil {
+		if snap.DBStateBefore, err = s.loadState(snap.DBStateBeforeRef); err != nil {
+			return err
+		}
+	}
+	if snap.DBStateAfterRef != "" && snap.DBStateAfter == nil {
+		if snap.DBStateAfter, err = s.loadState(snap.DBStateAfterRef); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) loadState(ref string) (map[string][]map[string]any, error) {
+	digest, ok := strings.CutPrefix(ref, stateRefPrefix)
+	if !ok || len(digest) != sha256.Size*2 {
+		return nil, fmt.Errorf("invalid DB state reference %q", ref)
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return nil, fmt.Errorf("invalid DB state reference %q", ref)
+	}
+	data, err := os.ReadFile(s.statePath(digest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("DB state %s not found in %s", ref, filepath.Join(s.BaseDir, statesDir))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading DB state: %w", err)
+	}
+	var state map[string][]map[string]any
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing DB state %s: %w", ref, err)
+	}
+	return state, nil
+}
+
+// hasStateRefs reports whether raw snapshot data refers to shared DB states.
+func hasStateRefs(data []byte) bool {
+	return bytes.Contains(data, []byte("db_state_before_ref")) || bytes.Contains(data, []byte("db_state_after_ref"))
+}
+
+// statePath spreads state files over subdirectories named by the first two
+// digest characters, like git objects.
+func (s *Store) statePath(digest string) string {
+	return filepath.Join(s.BaseDir, statesDir, digest[:2], digest+".json")
+}
@@ -0,0 +1,115 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStoreDedupStates(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	store.DedupStates = true
+
+	fixture := map[string][]map[string]any{
+		"users": {{"id": float64(1), "name": "Alice"}},
+	}
+	var paths []string
+	for _, id := range []string{"a", "b"} {
+		path, err := store.Save(&Snapshot{
+			ID:            id,
+			Service:       "api",
+			Request:       Request{Method: "GET", URL: "/users"},
+			DBStateBefore: fixture,
+			DBStateAfter:  map[string][]map[string]any{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	states, err := filepath.Glob(filepath.Join(dir, statesDir, "*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 {
+		t.Fatalf("expected the shared state to be stored once, got %v", states)
+	}
+
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Alice") || !strings.Contains(string(data), `"db_state_before_ref": "sha256:`) {
+		t.Errorf("expected the state to be referenced rather than embedded:\n%s", data)
+	}
+
+	// Readers resolve references whether or not they dedup themselves
+	loaded, err := NewStore(dir, "json").Load(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.DBStateBefore, fixture) {
+		t.Errorf("expected state to be resolved, got %v", loaded.DBStateBefore)
+	}
+	if loaded.DBStateAfter == nil || len(loaded.DBStateAfter) != 0 {
+		t.Errorf("expected empty state to stay inline, got %v", loaded.DBStateAfter)
+	}
+
+	infos, err := store.List()
+	if err != nil || len(infos) != 2 {
+		t.Errorf("expected state files not to be listed as snapshots, got %v (%v)", infos, err)
+	}
+
+	results, err := store.Grep(GrepOptions{Pattern: regexp.MustCompile("Alice")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("expected grep to search referenced states, got %d results", len(results))
+	}
+}
+
+func TestStoreDedupStates_UpdateWithoutDedupInlines(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "yaml")
+	store.DedupStates = true
+	path, err := store.Save(&Snapshot{
+		ID:            "a",
+		Service:       "api",
+		Request:       Request{Method: "GET", URL: "/"},
+		DBStateBefore: map[string][]map[string]any{"t": {{"id": 1}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := NewStore(dir, "yaml")
+	snap, err := plain.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Update(path, snap); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "db_state_before_ref") {
+		t.Errorf("expected the reference to be replaced by the inline state:\n%s", data)
+	}
+}
+
+func TestLoadState_InvalidRef(t *testing.T) {
+	store := NewStore(t.TempDir(), "json")
+	for _, ref := range []string{"md5:abc", "sha256:../../etc/passwd", "sha256:" + strings.Repeat("z", 64)} {
+		if _, err := store.loadState(ref); err == nil {
+			t.Errorf("%s: expected error", ref)
+		}
+	}
+}
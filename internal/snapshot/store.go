@@ -2,11 +2,15 @@ package snapshot
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,7 +18,23 @@ import (
 // Store handles reading and writing snapshots to disk.
 type Store struct {
 	BaseDir string
-	Format  string // "json" or "yaml"
+	Format  string    // "json" or "yaml"
+	Audit   *AuditLog // Optional: records Update and Delete calls
+
+	DedupStates bool // Store DB states once under _states and refer to them by digest
+
+	BodyFileThreshold int // Write bodies of at least this many bytes to files under _bodies (0 = never)
+
+	LazyBodies bool // Load leaves references to body files for ResolveBodies to read
+
+	Session   string // Save into this subdirectory of BaseDir (see ValidateSessionName)
+	Overwrite bool   // Save replaces an endpoint's existing snapshots on the first save to it
+
+	mu      sync.Mutex
+	cleared map[string]bool // endpoint directories already emptied, with Overwrite
+
+	bodiesMu   sync.RWMutex // held for reading while snapshots are written, for writing while unused body files are removed
+	scenarioMu sync.Mutex   // serializes writes to scenario files
 }
 
 // NewStore creates a new Store.
@@ -22,34 +42,86 @@ func NewStore(baseDir, format string) *Store {
 	return &Store{BaseDir: baseDir, Format: format}
 }
 
+// ErrDuplicateID is returned by Save when a snapshot with the same ID already
+// exists for the endpoint.
+var ErrDuplicateID = errors.New("snapshot ID already exists")
+
+// maxSaveAttempts bounds retries when concurrent writers race for a sequence number.
+const maxSaveAttempts = 100
+
 // Save writes a snapshot to disk, organized by service and endpoint.
+// Files are created exclusively, so concurrent recorders writing to the same
+// directory never overwrite each other, and only once fully written, so a
+// failed save leaves nothing behind.
 func (s *Store) Save(snap *Snapshot) (string, error) {
 	dir := s.dirForSnapshot(snap)
+	if s.Overwrite {
+		if err := s.clearEndpoint(dir); err != nil {
+			return "", err
+		}
+	}
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return "", fmt.Errorf("creating snapshot directory: %w", err)
 	}
 
-	// Determine next sequence number
-	seq, err := s.nextSeqNumber(dir)
+	// A body file the snapshot refers to must not be removed as unused
+	// before the snapshot is written
+	s.bodiesMu.RLock()
+	defer s.bodiesMu.RUnlock()
+	data, err := s.encode(snap)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("marshaling snapshot: %w", err)
 	}
 
 	ext := s.extension()
 	slug := sanitizeForFilename(snap.ID)
-	filename := fmt.Sprintf("%03d_%s.snapshot.%s", seq, slug, ext)
-	path := filepath.Join(dir, filename)
 
-	data, err := s.marshal(snap)
+	tmp, err := writeTemp(dir, data)
 	if err != nil {
-		return "", fmt.Errorf("marshaling snapshot: %w", err)
+		return "", fmt.Errorf("writing snapshot file: %w", err)
 	}
+	defer os.Remove(tmp)
 
-	if err := os.WriteFile(path, data, 0o644); err != nil {
-		return "", fmt.Errorf("writing snapshot file: %w", err)
+	for attempt := 0; attempt < maxSaveAttempts; attempt++ {
+		// Determine next sequence number
+		seq, err := s.nextSeqNumber(dir)
+		if err != nil {
+			return "", err
+		}
+		if s.idExists(dir, slug) {
+			return "", fmt.Errorf("%w: %s", ErrDuplicateID, snap.ID)
+		}
+
+		filename := fmt.Sprintf("%03d_%s.snapshot.%s", seq, slug, ext)
+		path := filepath.Join(dir, filename)
+
+		// A hard link claims the name atomically and fails if it is taken
+		err = os.Link(tmp, path)
+		if errors.Is(err, fs.ErrExist) {
+			// Another writer claimed this sequence number; rescan and retry
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("writing snapshot file: %w", err)
+		}
+		return path, nil
 	}
+	return "", fmt.Errorf("writing snapshot file: no free sequence number in %s", dir)
+}
 
-	return path, nil
+// idExists reports whether a snapshot file for the given ID slug is already in dir.
+func (s *Store) idExists(dir, slug string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if i := strings.IndexByte(name, '_'); i >= 0 && strings.HasPrefix(name[i+1:], slug+".snapshot.") {
+			return true
+		}
+	}
+	return false
 }
 
 // Load reads a snapshot from a specific file path.
@@ -63,6 +135,14 @@ func (s *Store) Load(path string) (*Snapshot, error) {
 	if err := s.unmarshal(data, snap); err != nil {
 		return nil, fmt.Errorf("parsing snapshot file: %w", err)
 	}
+	if err := s.resolveStates(snap); err != nil {
+		return nil, err
+	}
+	if !s.LazyBodies {
+		if err := s.resolveBodies(snap); err != nil {
+			return nil, err
+		}
+	}
 
 	return snap, nil
 }
@@ -79,7 +159,7 @@ func (s *Store) LoadAll() ([]*Snapshot, []string, error) {
 		if info.IsDir() {
 			return nil
 		}
-		if !strings.HasSuffix(path, ".snapshot."+FormatJSON) && !strings.HasSuffix(path, ".snapshot."+FormatYAML) && !strings.HasSuffix(path, ".snapshot."+FormatYML) {
+		if !isSnapshotFile(path) {
 			return nil
 		}
 
@@ -99,8 +179,10 @@ func (s *Store) LoadAll() ([]*Snapshot, []string, error) {
 }
 
 // LoadByTag loads all snapshots that have at least one of the given tags.
+// Tags are checked on the metadata first, so DB states and body files are
+// only read for the snapshots returned.
 func (s *Store) LoadByTag(tags []string) ([]*Snapshot, []string, error) {
-	all, allPaths, err := s.LoadAll()
+	paths, err := s.snapshotPaths()
 	if err != nil {
 		return nil, nil, err
 	}
@@ -112,11 +194,19 @@ func (s *Store) LoadByTag(tags []string) ([]*Snapshot, []string, error) {
 
 	var filtered []*Snapshot
 	var filteredPaths []string
-	for i, snap := range all {
-		for _, t := range snap.Tags {
+	for _, path := range paths {
+		info, err := s.loadInfo(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		for _, t := range info.Tags {
 			if tagSet[t] {
+				snap, err := s.Load(path)
+				if err != nil {
+					return nil, nil, fmt.Errorf("loading %s: %w", path, err)
+				}
 				filtered = append(filtered, snap)
-				filteredPaths = append(filteredPaths, allPaths[i])
+				filteredPaths = append(filteredPaths, path)
 				break
 			}
 		}
@@ -124,41 +214,326 @@ func (s *Store) LoadByTag(tags []string) ([]*Snapshot, []string, error) {
 	return filtered, filteredPaths, nil
 }
 
+// LoadSelected loads all snapshots the selector matches, ordered by path.
+// The selector is checked on the metadata first, so DB states and body files
+// are only read for the snapshots returned.
+func (s *Store) LoadSelected(sel *Selector) ([]*Snapshot, []string, error) {
+	paths, err := s.snapshotPaths()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var selected []*Snapshot
+	var selectedPaths []string
+	for _, path := range paths {
+		info, err := s.loadInfo(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		if !sel.Matches(info) {
+			continue
+		}
+		snap, err := s.Load(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		selected = append(selected, snap)
+		selectedPaths = append(selectedPaths, path)
+	}
+	return selected, selectedPaths, nil
+}
+
+// WithDependencies returns snapshots and paths with the snapshots they
+// depend on through depends_on, directly or through others, appended when
+// they are missing. Dependencies are looked up by ID in the store;
+// those that cannot be found are left out for the replayer to report.
+func (s *Store) WithDependencies(snapshots []*Snapshot, paths []string) ([]*Snapshot, []string, error) {
+	have := make(map[string]bool, len(snapshots))
+	var wanted []string
+	for _, snap := range snapshots {
+		have[snap.ID] = true
+		wanted = append(wanted, snap.DependsOn...)
+	}
+
+	var byID map[string]string
+	for len(wanted) > 0 {
+		id := wanted[0]
+		wanted = wanted[1:]
+		if have[id] {
+			continue
+		}
+		have[id] = true
+		if byID == nil {
+			// Only index the store once a dependency is actually missing
+			all, err := s.snapshotPaths()
+			if err != nil {
+				return nil, nil, err
+			}
+			byID = make(map[string]string, len(all))
+			for _, path := range all {
+				info, err := s.loadInfo(path)
+				if err != nil {
+					return nil, nil, fmt.Errorf("loading %s: %w", path, err)
+				}
+				if _, dup := byID[info.ID]; !dup {
+					byID[info.ID] = path
+				}
+			}
+		}
+		path, ok := byID[id]
+		if !ok {
+			continue
+		}
+		snap, err := s.Load(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		snapshots = append(snapshots, snap)
+		paths = append(paths, path)
+		wanted = append(wanted, snap.DependsOn...)
+	}
+	return snapshots, paths, nil
+}
+
 // Update replaces a snapshot file with an updated snapshot.
 func (s *Store) Update(path string, snap *Snapshot) error {
-	data, err := s.marshal(snap)
+	s.bodiesMu.RLock()
+	defer s.bodiesMu.RUnlock()
+	data, err := s.encode(snap)
 	if err != nil {
 		return fmt.Errorf("marshaling snapshot: %w", err)
 	}
-	return os.WriteFile(path, data, 0o644)
+	tmp, err := writeTemp(filepath.Dir(path), data)
+	if err != nil {
+		return fmt.Errorf("writing snapshot file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writing snapshot file: %w", err)
+	}
+	return s.audit(AuditActionUpdate, path, snap.ID)
+}
+
+// writeTemp writes data to a new temporary file in dir, from which it can be
+// linked or renamed into place, and returns its path. The file is removed if
+// writing fails.
+func writeTemp(dir string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, ".save-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Delete removes a snapshot file, along with the body files no other
+// snapshot refers to and the snapshot's steps in scenarios.
+func (s *Store) Delete(path string) error {
+	// Read the metadata first so the audit entry can name the snapshot being removed
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading snapshot file: %w", err)
+	}
+	info, err := s.infoFromData(path, data)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("deleting snapshot file: %w", err)
+	}
+	if err := s.audit(AuditActionDelete, path, info.ID); err != nil {
+		return err
+	}
+	if err := s.removeUnusedBodyFiles(data); err != nil {
+		return err
+	}
+	return s.removeScenarioSteps(path)
+}
+
+func (s *Store) audit(action, path, snapshotID string) error {
+	if s.Audit == nil {
+		return nil
+	}
+	if err := s.Audit.Record(action, path, snapshotID); err != nil {
+		return fmt.Errorf("recording audit entry: %w", err)
+	}
+	return nil
 }
 
 // List returns metadata about all snapshots.
 func (s *Store) List() ([]SnapshotInfo, error) {
-	all, paths, err := s.LoadAll()
+	infos, _, err := s.ListFiltered(ListOptions{})
+	return infos, err
+}
+
+// ListOptions filters and paginates ListFiltered. Zero values match everything.
+type ListOptions struct {
+	Service  string
+	Method   string // case-insensitive
+	Tag      string
+	Status   int
+	Selector *Selector // from ParseSelector; nil matches everything
+	Offset   int
+	Limit    int // 0 = no limit
+}
+
+func (o ListOptions) hasFilters() bool {
+	return o.Service != "" || o.Method != "" || o.Tag != "" || o.Status != 0 || o.Selector != nil
+}
+
+func (o ListOptions) matches(info SnapshotInfo) bool {
+	if o.Selector != nil && !o.Selector.Matches(info) {
+		return false
+	}
+	if o.Service != "" && info.Service != o.Service {
+		return false
+	}
+	if o.Method != "" && !strings.EqualFold(info.Method, o.Method) {
+		return false
+	}
+	if o.Status != 0 && info.Status != o.Status {
+		return false
+	}
+	if o.Tag != "" {
+		for _, t := range info.Tags {
+			if t == o.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ListFiltered returns one page of snapshot metadata matching opts, ordered by
+// path, along with the total number of matches. Only metadata fields are
+// decoded, and without filters only the files on the requested page are read;
+// filters are applied to the metadata index.
+func (s *Store) ListFiltered(opts ListOptions) ([]SnapshotInfo, int, error) {
+	paths, err := s.snapshotPaths()
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	infos := make([]SnapshotInfo, len(all))
-	for i, snap := range all {
-		infos[i] = SnapshotInfo{
-			ID:        snap.ID,
-			Path:      paths[i],
-			Service:   snap.Service,
-			Method:    snap.Request.Method,
-			URL:       snap.Request.URL,
-			Status:    snap.Response.Status,
-			Tags:      snap.Tags,
-			Timestamp: snap.Timestamp,
+	if !opts.hasFilters() {
+		total := len(paths)
+		page := paginate(paths, opts.Offset, opts.Limit)
+		infos := make([]SnapshotInfo, 0, len(page))
+		for _, path := range page {
+			info, err := s.loadInfo(path)
+			if err != nil {
+				return nil, 0, fmt.Errorf("loading %s: %w", path, err)
+			}
+			infos = append(infos, info)
 		}
+		return infos, total, nil
+	}
+
+	infos, err := s.indexedInfos(paths)
+	if err != nil {
+		return nil, 0, err
+	}
+	var matched []SnapshotInfo
+	for _, info := range infos {
+		if opts.matches(info) {
+			matched = append(matched, info)
+		}
+	}
+	return paginate(matched, opts.Offset, opts.Limit), len(matched), nil
+}
+
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
 	}
+	return items
+}
 
-	sort.Slice(infos, func(i, j int) bool {
-		return infos[i].Path < infos[j].Path
+// snapshotPaths returns the paths of all snapshot files under the base directory, sorted.
+func (s *Store) snapshotPaths() ([]string, error) {
+	var paths []string
+	err := filepath.Walk(s.BaseDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && isSnapshotFile(path) {
+			paths = append(paths, path)
+		}
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func isSnapshotFile(path string) bool {
+	return strings.HasSuffix(path, ".snapshot."+FormatJSON) || strings.HasSuffix(path, ".snapshot."+FormatYAML) || strings.HasSuffix(path, ".snapshot."+FormatYML)
+}
+
+// snapshotMeta mirrors the metadata fields of Snapshot so listing can skip
+// decoding request/response bodies and DB states.
+type snapshotMeta struct {
+	ID        string    `json:"id" yaml:"id"`
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp"`
+	Service   string    `json:"service" yaml:"service"`
+	Tags      []string  `json:"tags" yaml:"tags"`
+	Request   struct {
+		Method string `json:"method" yaml:"method"`
+		URL    string `json:"url" yaml:"url"`
+	} `json:"request" yaml:"request"`
+	Response struct {
+		Status int `json:"status" yaml:"status"`
+	} `json:"response" yaml:"response"`
+}
 
-	return infos, nil
+func (s *Store) loadInfo(path string) (SnapshotInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("reading snapshot file: %w", err)
+	}
+	return s.infoFromData(path, data)
+}
+
+// infoFromData decodes only the metadata of an already-read snapshot file.
+func (s *Store) infoFromData(path string, data []byte) (SnapshotInfo, error) {
+	var meta snapshotMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		if yerr := yaml.Unmarshal(data, &meta); yerr != nil {
+			return SnapshotInfo{}, fmt.Errorf("parsing snapshot file: %w", yerr)
+		}
+	}
+	return SnapshotInfo{
+		ID:        meta.ID,
+		Path:      path,
+		Service:   meta.Service,
+		Method:    meta.Request.Method,
+		URL:       meta.Request.URL,
+		Status:    meta.Response.Status,
+		Tags:      meta.Tags,
+		Timestamp: meta.Timestamp,
+	}, nil
 }
 
 // SnapshotInfo is a summary of a snapshot for listing.
@@ -175,7 +550,11 @@ type SnapshotInfo struct {
 
 func (s *Store) dirForSnapshot(snap *Snapshot) string {
 	endpoint := fmt.Sprintf("%s_%s", snap.Request.Method, sanitizeForFilename(snap.Request.URL))
-	return filepath.Join(s.BaseDir, sanitizeForFilename(snap.Service), endpoint)
+	// SOAP services take every operation at one URL
+	if op := SOAPOperation(snap.Request.Headers, snap.Request.Body); op != "" {
+		endpoint += "_" + sanitizeForFilename(op)
+	}
+	return filepath.Join(s.BaseDir, s.Session, sanitizeForFilename(snap.Service), endpoint)
 }
 
 func (s *Store) nextSeqNumber(dir string) (int, error) {
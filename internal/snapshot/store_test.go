@@ -1,8 +1,11 @@
 package snapshot
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -213,3 +216,197 @@ func TestStoreUpdate(t *testing.T) {
 func matchesSuffix(path, suffix string) bool {
 	return len(path) >= len(suffix) && path[len(path)-len(suffix):] == suffix
 }
+
+func TestStoreListFiltered(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+
+	fixtures := []*Snapshot{
+		{ID: "a", Service: "svc", Tags: []string{"smoke"}, Request: Request{Method: "GET", URL: "/users"}, Response: Response{Status: 200}},
+		{ID: "b", Service: "svc", Request: Request{Method: "POST", URL: "/users"}, Response: Response{Status: 201}},
+		{ID: "c", Service: "svc", Tags: []string{"smoke"}, Request: Request{Method: "GET", URL: "/orders"}, Response: Response{Status: 500}},
+		{ID: "d", Service: "other", Request: Request{Method: "GET", URL: "/health"}, Response: Response{Status: 200}},
+	}
+	for _, snap := range fixtures {
+		snap.DBStateBefore = map[string][]map[string]any{"users": {{"id": 1}}}
+		if _, err := store.Save(snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		opts      ListOptions
+		wantIDs   []string
+		wantTotal int
+	}{
+		{"all", ListOptions{}, []string{"d", "c", "a", "b"}, 4},
+		{"service", ListOptions{Service: "svc"}, []string{"c", "a", "b"}, 3},
+		{"method case-insensitive", ListOptions{Method: "get"}, []string{"d", "c", "a"}, 3},
+		{"tag", ListOptions{Tag: "smoke"}, []string{"c", "a"}, 2},
+		{"status", ListOptions{Status: 200}, []string{"d", "a"}, 2},
+		{"combined", ListOptions{Service: "svc", Method: "GET", Status: 500}, []string{"c"}, 1},
+		{"page", ListOptions{Offset: 1, Limit: 2}, []string{"c", "a"}, 4},
+		{"filtered page", ListOptions{Method: "GET", Offset: 2, Limit: 5}, []string{"a"}, 3},
+		{"offset past end", ListOptions{Offset: 10}, []string{}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			infos, total, err := store.ListFiltered(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("expected total %d, got %d", tt.wantTotal, total)
+			}
+			var ids []string
+			for _, info := range infos {
+				ids = append(ids, info.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("expected IDs %v, got %v", tt.wantIDs, ids)
+			}
+		})
+	}
+}
+
+func TestStoreList_YAMLMetadata(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "yaml")
+	ts := time.Date(2026, 2, 7, 14, 30, 0, 0, time.UTC)
+
+	if _, err := store.Save(&Snapshot{ID: "y1", Timestamp: ts, Service: "svc", Tags: []string{"t"}, Request: Request{Method: "PUT", URL: "/x"}, Response: Response{Status: 204}}); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(infos))
+	}
+	info := infos[0]
+	if info.ID != "y1" || info.Method != "PUT" || info.URL != "/x" || info.Status != 204 || info.Service != "svc" || len(info.Tags) != 1 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if got, ok := info.Timestamp.(time.Time); !ok || !got.Equal(ts) {
+		t.Errorf("expected timestamp %v, got %v", ts, info.Timestamp)
+	}
+}
+
+func TestStoreSave_DuplicateID(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	snap := &Snapshot{ID: "dup", Service: "svc", Request: Request{Method: "GET", URL: "/x"}}
+
+	if _, err := store.Save(snap); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Save(snap); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("expected ErrDuplicateID, got %v", err)
+	}
+}
+
+func TestStoreSave_LeavesNoPartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+	snap := &Snapshot{ID: "dup", Service: "svc", Request: Request{Method: "GET", URL: "/x"}}
+
+	path, err := store.Save(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Save(snap); err == nil {
+		t.Fatal("expected the duplicate save to fail")
+	}
+	snap.Tags = []string{"updated"}
+	if err := store.Update(path, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("expected only the saved snapshot, got %v", names)
+	}
+	if loaded, err := store.Load(path); err != nil || len(loaded.Tags) != 1 {
+		t.Errorf("expected the updated snapshot, got %+v (err %v)", loaded, err)
+	}
+}
+
+func TestStoreSave_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, "json")
+
+	const n = 20
+	var wg sync.WaitGroup
+	paths := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			snap := &Snapshot{ID: GenerateID(), Service: "svc", Request: Request{Method: "GET", URL: "/x"}}
+			paths[i], errs[i] = store.Save(snap)
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("save %d failed: %v", i, errs[i])
+		}
+		if seen[paths[i]] {
+			t.Fatalf("two snapshots were written to %s", paths[i])
+		}
+		seen[paths[i]] = true
+	}
+	all, _, err := store.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != n {
+		t.Errorf("expected %d snapshots on disk, got %d", n, len(all))
+	}
+}
+
+func TestStore_WithDependencies(t *testing.T) {
+	store := NewStore(t.TempDir(), FormatJSON)
+	var paths []string
+	for _, snap := range []*Snapshot{
+		{ID: "login", Service: "svc", Request: Request{Method: "POST", URL: "/login"}},
+		{ID: "create", Service: "svc", DependsOn: []string{"login"}, Request: Request{Method: "POST", URL: "/items"}},
+		{ID: "update", Service: "svc", DependsOn: []string{"create", "gone"}, Request: Request{Method: "PUT", URL: "/items/1"}},
+	} {
+		path, err := store.Save(snap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	update, err := store.Load(paths[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaps, got, err := store.WithDependencies([]*Snapshot{update}, paths[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, snap := range snaps {
+		ids = append(ids, snap.ID)
+	}
+	if strings.Join(ids, " ") != "update create login" || len(got) != 3 || got[2] != paths[0] {
+		t.Errorf("expected update with its dependencies, got %v at %v", ids, got)
+	}
+}
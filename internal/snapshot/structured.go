@@ -0,0 +1,175 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// errNotStructured reports a binary document holding values JSON can't
+// represent, such as byte strings, extension types or non-string map keys.
+// Such bodies are kept base64-encoded.
+var errNotStructured = errors.New("value has no JSON equivalent")
+
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]any(nil)),
+}.DecMode()
+
+// Deterministic encoding (sorted keys, shortest integers) keeps re-encoded
+// bodies stable across runs.
+var cborEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+func isMsgPackContentType(ct string) bool {
+	return strings.Contains(ct, "msgpack")
+}
+
+func isCBORContentType(ct string) bool {
+	return strings.HasPrefix(ct, "application/cbor") || strings.Contains(ct, "+cbor")
+}
+
+// ParseMsgPack decodes a MessagePack document into JSON-compatible values.
+func ParseMsgPack(raw []byte) (any, error) {
+	r := bytes.NewReader(raw)
+	var v any
+	if err := msgpack.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%d bytes after the msgpack value", r.Len())
+	}
+	return toJSONValue(v)
+}
+
+// EncodeMsgPack reverses ParseMsgPack. Map keys are sorted and whole numbers
+// are written as integers, since the stored JSON no longer tells 1 from 1.0.
+func EncodeMsgPack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	if err := enc.Encode(fromJSONValue(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseCBOR decodes a CBOR document into JSON-compatible values.
+func ParseCBOR(raw []byte) (any, error) {
+	var v any
+	if err := cborDecMode.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return toJSONValue(v)
+}
+
+// EncodeCBOR reverses ParseCBOR using deterministic encoding, writing whole
+// numbers as integers like EncodeMsgPack.
+func EncodeCBOR(v any) ([]byte, error) {
+	return cborEncMode.Marshal(fromJSONValue(v))
+}
+
+// toJSONValue converts a decoded msgpack or CBOR value into the types
+// encoding/json produces, failing on anything JSON can't hold.
+func toJSONValue(v any) (any, error) {
+	switch x := v.(type) {
+	case nil, bool, string:
+		return x, nil
+	case int8:
+		return int64(x), nil
+	case int16:
+		return int64(x), nil
+	case int32:
+		return int64(x), nil
+	case int64:
+		return x, nil
+	case int:
+		return int64(x), nil
+	case uint8:
+		return int64(x), nil
+	case uint16:
+		return int64(x), nil
+	case uint32:
+		return int64(x), nil
+	case uint64:
+		return x, nil
+	case float32:
+		return toJSONFloat(float64(x))
+	case float64:
+		return toJSONFloat(x)
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			c, err := toJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			c, err := toJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = c
+		}
+		return out, nil
+	case map[any]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			key, ok := k.(string)
+			if !ok {
+				return nil, errNotStructured
+			}
+			c, err := toJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = c
+		}
+		return out, nil
+	default:
+		return nil, errNotStructured
+	}
+}
+
+func toJSONFloat(f float64) (any, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, errNotStructured
+	}
+	return f, nil
+}
+
+// fromJSONValue prepares a stored body for encoding: whole float64 values
+// (as all numbers are after a JSON round trip) become integers.
+func fromJSONValue(v any) any {
+	switch x := v.(type) {
+	case float64:
+		if x == math.Trunc(x) && x >= math.MinInt64 && x < math.MaxInt64 {
+			return int64(x)
+		}
+		return x
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = fromJSONValue(e)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			out[k] = fromJSONValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
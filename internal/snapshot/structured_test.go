@@ -0,0 +1,83 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseBody_MsgPackAndCBOR(t *testing.T) {
+	doc := map[string]any{"id": 1, "name": "Alice", "score": 9.5, "tags": []any{"a", "b"}, "meta": nil}
+	msgpackRaw, err := EncodeMsgPack(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cborRaw, err := EncodeCBOR(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		raw         []byte
+		contentType string
+		encoding    string
+	}{
+		{"msgpack", msgpackRaw, "application/msgpack", BodyEncodingMsgPack},
+		{"x-msgpack", msgpackRaw, "application/x-msgpack", BodyEncodingMsgPack},
+		{"cbor", cborRaw, "application/cbor", BodyEncodingCBOR},
+		{"cbor suffix", cborRaw, "application/vnd.example+cbor", BodyEncodingCBOR},
+	}
+	for _, tt := range tests {
+		eb, ok := ParseBody(tt.raw, tt.contentType).(*EncodedBody)
+		if !ok || eb.Encoding != tt.encoding {
+			t.Errorf("%s: expected %s EncodedBody, got %#v", tt.name, tt.encoding, eb)
+			continue
+		}
+
+		// Round trip through the stored JSON form, as replay does
+		stored, err := json.Marshal(eb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var loaded any
+		json.Unmarshal(stored, &loaded)
+		want := map[string]any{"id": float64(1), "name": "Alice", "score": 9.5, "tags": []any{"a", "b"}, "meta": nil}
+		if data := loaded.(map[string]any)["data"]; !reflect.DeepEqual(data, want) {
+			t.Errorf("%s: stored document %v, want %v", tt.name, data, want)
+		}
+
+		decoded, err := DecodeBody(loaded)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(decoded) != string(tt.raw) {
+			t.Errorf("%s: re-encoded body %x, want %x", tt.name, decoded, tt.raw)
+		}
+	}
+}
+
+func TestParseBody_MsgPackWithoutJSONEquivalent(t *testing.T) {
+	// {"blob": bin8 0x01 0x02}: byte strings stay opaque
+	raw := []byte{0x81, 0xa4, 'b', 'l', 'o', 'b', 0xc4, 0x02, 0x01, 0x02}
+	eb, ok := ParseBody(raw, "application/msgpack").(*EncodedBody)
+	if !ok || eb.Encoding != BodyEncodingBase64 {
+		t.Fatalf("expected base64 EncodedBody, got %#v", eb)
+	}
+
+	// Malformed CBOR also falls back to base64
+	eb, ok = ParseBody([]byte{0xff, 0x00}, "application/cbor").(*EncodedBody)
+	if !ok || eb.Encoding != BodyEncodingBase64 {
+		t.Errorf("expected base64 EncodedBody for malformed CBOR, got %#v", eb)
+	}
+}
+
+func TestDecodeBody_MsgPackScalar(t *testing.T) {
+	decoded, err := DecodeBody(&EncodedBody{Data: "ok", Encoding: BodyEncodingMsgPack})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != "\xa2ok" {
+		t.Errorf("expected msgpack fixstr, got %x", decoded)
+	}
+}
@@ -0,0 +1,88 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"unicode/utf8"
+)
+
+// BodyEncodingTruncated marks a body larger than recording.max_body_bytes.
+// Data holds the body's size in bytes, its SHA-256 and its first bytes (see
+// BodyDigest.Body); the rest was not kept.
+const BodyEncodingTruncated = "truncated"
+
+// ErrTruncatedBody is returned by DecodeBody for truncated bodies, which
+// cannot be sent again.
+var ErrTruncatedBody = errors.New("body was truncated when recorded")
+
+// BodyDigest is an io.Writer that measures and hashes a body while keeping
+// only its first bytes, so oversized bodies never sit in memory.
+type BodyDigest struct {
+	limit int64
+	head  []byte
+	size  int64
+	hash  hash.Hash
+}
+
+// NewBodyDigest returns a BodyDigest keeping up to limit bytes.
+func NewBodyDigest(limit int64) *BodyDigest {
+	return &BodyDigest{limit: limit, hash: sha256.New()}
+}
+
+func (d *BodyDigest) Write(p []byte) (int, error) {
+	if room := d.limit - int64(len(d.head)); room > 0 {
+		d.head = append(d.head, p[:min(int64(len(p)), room)]...)
+	}
+	d.size += int64(len(p))
+	d.hash.Write(p)
+	return len(p), nil
+}
+
+// Truncated reports whether more than the limit was written.
+func (d *BodyDigest) Truncated() bool {
+	return d.size > d.limit
+}
+
+// Bytes returns the bytes kept, which are the whole body unless Truncated.
+func (d *BodyDigest) Bytes() []byte {
+	return d.head
+}
+
+// Body returns the truncation marker stored in place of the body. With
+// head set, the first bytes are kept too: as text when they are UTF-8, and
+// base64-encoded otherwise.
+func (d *BodyDigest) Body(head bool) *EncodedBody {
+	data := map[string]any{
+		"size":   d.size,
+		"sha256": hex.EncodeToString(d.hash.Sum(nil)),
+	}
+	if !head {
+		return &EncodedBody{Data: data, Encoding: BodyEncodingTruncated}
+	}
+	text := d.head
+	// Don't let the cut split a character
+	for i := 0; i < utf8.UTFMax-1 && len(text) > 0 && !utf8.Valid(text); i++ {
+		text = text[:len(text)-1]
+	}
+	if utf8.Valid(text) {
+		data["head"] = string(text)
+	} else {
+		data["head"] = base64.StdEncoding.EncodeToString(d.head)
+		data["head_encoding"] = BodyEncodingBase64
+	}
+	return &EncodedBody{Data: data, Encoding: BodyEncodingTruncated}
+}
+
+// IsTruncatedBody reports whether a body is a truncation marker.
+func IsTruncatedBody(body any) bool {
+	switch b := body.(type) {
+	case *EncodedBody:
+		return b.Encoding == BodyEncodingTruncated
+	case map[string]any:
+		return b["encoding"] == BodyEncodingTruncated
+	}
+	return false
+}
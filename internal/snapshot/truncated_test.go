@@ -0,0 +1,55 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBodyDigest(t *testing.T) {
+	body := "héllo, this body is larger than the limit"
+	d := NewBodyDigest(2)
+	d.Write([]byte(body[:10]))
+	d.Write([]byte(body[10:]))
+
+	if !d.Truncated() || string(d.Bytes()) != body[:2] {
+		t.Fatalf("expected only the first 2 bytes to be kept, got %q", d.Bytes())
+	}
+	sum := sha256.Sum256([]byte(body))
+	marker := d.Body(true)
+	data := marker.Data.(map[string]any)
+	if marker.Encoding != BodyEncodingTruncated || data["size"] != int64(len(body)) || data["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected marker %v", marker)
+	}
+	// The cut falls inside "é", which is left out
+	if data["head"] != "h" || data["head_encoding"] != nil {
+		t.Errorf("expected the head to end before the split character, got %q", data["head"])
+	}
+	if _, ok := d.Body(false).Data.(map[string]any)["head"]; ok {
+		t.Error("expected no head when not asked for")
+	}
+
+	small := NewBodyDigest(100)
+	small.Write([]byte("short"))
+	if small.Truncated() || string(small.Bytes()) != "short" {
+		t.Errorf("expected a body under the limit to be kept whole, got %q", small.Bytes())
+	}
+
+	binary := NewBodyDigest(4)
+	binary.Write([]byte{0xff, 0xfe, 0x00, 0x01, 0x02})
+	if got := binary.Body(true).Data.(map[string]any); got["head"] != "//4AAQ==" || got["head_encoding"] != BodyEncodingBase64 {
+		t.Errorf("expected a binary head to be base64-encoded, got %v", got)
+	}
+}
+
+func TestDecodeBody_Truncated(t *testing.T) {
+	marker := map[string]any{"encoding": "truncated", "data": map[string]any{"size": 10.0, "sha256": strings.Repeat("0", 64)}}
+	if !IsTruncatedBody(marker) {
+		t.Error("expected loaded marker to be recognized")
+	}
+	if _, err := DecodeBody(marker); !errors.Is(err, ErrTruncatedBody) {
+		t.Errorf("expected ErrTruncatedBody, got %v", err)
+	}
+}
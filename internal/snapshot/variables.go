@@ -0,0 +1,121 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// templateVariable matches a {{name}} placeholder, spaces inside the braces
+// allowed.
+var templateVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// ValidateVariableName checks that name can be used as {{name}} in a
+// snapshot.
+func ValidateVariableName(name string) error {
+	if !variableName.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q: must start with a letter or underscore and contain only letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// SubstituteVariables returns a copy of snap with every {{name}} placeholder
+// in its string values replaced by vars[name], in the request, responses,
+// DB states and outgoing requests alike. In bodies and rows, a string that
+// is nothing but one placeholder takes the value itself, so
+// {"user_id": "{{user_id}}"} can become a number; elsewhere the value is
+// formatted into the string. Placeholders of names not in vars are left as
+// they are. snap itself is not modified.
+func SubstituteVariables(snap *Snapshot, vars map[string]any) (*Snapshot, error) {
+	if len(vars) == 0 {
+		return snap, nil
+	}
+	// Work on a deep copy
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, fmt.Errorf("substituting variables: %w", err)
+	}
+	var resolved Snapshot
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		return nil, fmt.Errorf("substituting variables: %w", err)
+	}
+	substituteFields(reflect.ValueOf(&resolved).Elem(), vars)
+	return &resolved, nil
+}
+
+// substituteFields replaces placeholders in the strings of v, a typed
+// part of a snapshot, and in the decoded JSON values it holds.
+func substituteFields(v reflect.Value, vars map[string]any) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			substituteFields(v.Elem(), vars)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				substituteFields(v.Field(i), vars)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			substituteFields(v.Index(i), vars)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			item := reflect.New(v.Type().Elem()).Elem()
+			item.Set(v.MapIndex(key))
+			substituteFields(item, vars)
+			v.SetMapIndex(key, item)
+		}
+	case reflect.String:
+		v.SetString(substituteString(v.String(), vars))
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if value := substitute(v.Interface(), vars); value != nil {
+			v.Set(reflect.ValueOf(value))
+		} else {
+			v.Set(reflect.Zero(v.Type()))
+		}
+	}
+}
+
+// substitute replaces placeholders in a decoded JSON value.
+func substitute(v any, vars map[string]any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = substitute(item, vars)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = substitute(item, vars)
+		}
+		return v
+	case string:
+		if m := templateVariable.FindStringSubmatch(v); m != nil && m[0] == v {
+			if value, ok := vars[m[1]]; ok {
+				return value
+			}
+		}
+		return substituteString(v, vars)
+	default:
+		return v
+	}
+}
+
+func substituteString(s string, vars map[string]any) string {
+	return templateVariable.ReplaceAllStringFunc(s, func(placeholder string) string {
+		name := templateVariable.FindStringSubmatch(placeholder)[1]
+		if value, ok := vars[name]; ok {
+			return fmt.Sprint(value)
+		}
+		return placeholder
+	})
+}
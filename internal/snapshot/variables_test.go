@@ -0,0 +1,74 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubstituteVariables(t *testing.T) {
+	snap := &Snapshot{
+		ID: "v1",
+		Request: Request{
+			Method:  "GET",
+			URL:     "/tenants/{{tenant}}/users/{{ user_id }}",
+			Headers: map[string]string{"X-Tenant": "{{tenant}}", "X-User": "{{user_id}}"},
+		},
+		Response: Response{
+			Status: 200,
+			Body:   map[string]any{"id": "{{user_id}}", "tenant": "{{tenant}}", "label": "user {{user_id}} of {{tenant}}", "note": "{{unknown}}", "tags": []any{"{{tenant}}"}},
+		},
+		DBStateBefore: map[string][]map[string]any{"users": {{"id": "{{user_id}}", "tenant": "{{tenant}}"}}},
+		OutgoingRequests: []OutgoingRequest{
+			{Method: "GET", URL: "http://billing/{{tenant}}", Response: &Response{Status: 200, Body: map[string]any{"plan": "{{plan}}"}}},
+		},
+		DBDiff: map[string]TableDiff{"users": {Added: []map[string]any{{"id": "{{user_id}}"}}}},
+	}
+	vars := map[string]any{"tenant": "acme", "user_id": 42, "plan": nil}
+
+	got, err := SubstituteVariables(snap, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Request.URL != "/tenants/acme/users/42" {
+		t.Errorf("unexpected URL %q", got.Request.URL)
+	}
+	if want := map[string]string{"X-Tenant": "acme", "X-User": "42"}; !reflect.DeepEqual(got.Request.Headers, want) {
+		t.Errorf("expected headers %v, got %v", want, got.Request.Headers)
+	}
+	wantBody := map[string]any{"id": 42, "tenant": "acme", "label": "user 42 of acme", "note": "{{unknown}}", "tags": []any{"acme"}}
+	if !reflect.DeepEqual(got.Response.Body, wantBody) {
+		t.Errorf("expected body %v, got %v", wantBody, got.Response.Body)
+	}
+	if row := got.DBStateBefore["users"][0]; row["id"] != 42 || row["tenant"] != "acme" {
+		t.Errorf("unexpected DB row %v", row)
+	}
+	if out := got.OutgoingRequests[0]; out.URL != "http://billing/acme" || out.Response.Body.(map[string]any)["plan"] != nil {
+		t.Errorf("unexpected outgoing request %+v", out)
+	}
+	if id := got.DBDiff["users"].Added[0]["id"]; id != 42 {
+		t.Errorf("unexpected db_diff row id %v", id)
+	}
+
+	// The original is left as recorded
+	if snap.Request.URL != "/tenants/{{tenant}}/users/{{ user_id }}" || snap.Response.Body.(map[string]any)["id"] != "{{user_id}}" || snap.Request.Headers["X-Tenant"] != "{{tenant}}" {
+		t.Errorf("expected the original snapshot unchanged, got %+v", snap)
+	}
+
+	if same, _ := SubstituteVariables(snap, nil); same != snap {
+		t.Error("expected the snapshot itself without variables")
+	}
+}
+
+func TestValidateVariableName(t *testing.T) {
+	for _, name := range []string{"user_id", "tenant.id", "_x", "api-key2"} {
+		if err := ValidateVariableName(name); err != nil {
+			t.Errorf("%q: unexpected error %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "1st", "user id", "{{x}}"} {
+		if err := ValidateVariableName(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+}
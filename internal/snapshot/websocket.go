@@ -0,0 +1,72 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// WebSocket message directions.
+const (
+	DirectionClient = "client" // sent by the client to the service
+	DirectionServer = "server" // sent by the service to the client
+)
+
+// WebSocket message types.
+const (
+	MessageText   = "text"
+	MessageBinary = "binary"
+	MessageClose  = "close"
+)
+
+// Message is one message of a recorded WebSocket connection. Text messages
+// are stored like bodies: parsed JSON when they hold JSON, strings
+// otherwise. Binary messages are base64-encoded. Close messages carry their
+// status code, if any.
+type Message struct {
+	Direction string `json:"direction" yaml:"direction"`
+	Type      string `json:"type" yaml:"type"`
+	Data      any    `json:"data,omitempty" yaml:"data,omitempty"`
+}
+
+// NewMessage builds a message from a raw payload.
+func NewMessage(direction, msgType string, payload []byte) Message {
+	m := Message{Direction: direction, Type: msgType}
+	switch msgType {
+	case MessageText:
+		if len(payload) > 0 {
+			m.Data = ParseBody(payload, "")
+		}
+	case MessageBinary:
+		if len(payload) > 0 {
+			m.Data = ParseBody(payload, "application/octet-stream")
+		}
+	case MessageClose:
+		if len(payload) >= 2 {
+			m.Data = int(binary.BigEndian.Uint16(payload))
+		}
+	}
+	return m
+}
+
+// Payload returns the raw payload to send for the message.
+func (m Message) Payload() ([]byte, error) {
+	if m.Data == nil {
+		return nil, nil
+	}
+	if m.Type == MessageClose {
+		var code int
+		switch v := m.Data.(type) {
+		case int:
+			code = v
+		case float64:
+			code = int(v)
+		default:
+			return nil, fmt.Errorf("close message data must be a status code, got %T", m.Data)
+		}
+		return binary.BigEndian.AppendUint16(nil, uint16(code)), nil
+	}
+	if s, ok := m.Data.(string); ok {
+		return []byte(s), nil
+	}
+	return DecodeBody(m.Data)
+}
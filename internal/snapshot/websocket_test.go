@@ -0,0 +1,44 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMessage_RoundTrip(t *testing.T) {
+	tests := []struct {
+		msgType  string
+		payload  []byte
+		wantData any
+	}{
+		{MessageText, []byte("hello"), "hello"},
+		{MessageText, []byte(`{"op":"ping"}`), map[string]any{"op": "ping"}},
+		{MessageBinary, []byte{0x00, 0xff}, &EncodedBody{Data: "AP8=", Encoding: BodyEncodingBase64}},
+		{MessageClose, []byte{0x03, 0xe8}, 1000},
+		{MessageClose, nil, nil},
+	}
+	for _, tt := range tests {
+		m := NewMessage(DirectionClient, tt.msgType, tt.payload)
+		if !reflect.DeepEqual(m.Data, tt.wantData) {
+			t.Errorf("%s %q: data = %#v, want %#v", tt.msgType, tt.payload, m.Data, tt.wantData)
+		}
+
+		// Messages are sent from what a snapshot file holds
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var loaded Message
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			t.Fatal(err)
+		}
+		payload, err := loaded.Payload()
+		if err != nil {
+			t.Fatalf("%s %q: %v", tt.msgType, tt.payload, err)
+		}
+		if string(payload) != string(tt.payload) {
+			t.Errorf("%s: payload = %q, want %q", tt.msgType, payload, tt.payload)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Keys with special meaning in the structured XML representation. Element
+// names never start with these characters, so they cannot collide.
+const (
+	XMLAttrPrefix = "@"      // "@name" holds the value of attribute name
+	XMLTextKey    = "#text"  // text of an element that also has attributes or children
+	XMLOrderKey   = "#order" // child element names in document order, when siblings have different names
+	XMLDeclKey    = "?xml"   // contents of the <?xml ...?> declaration, on the root map
+	xmlPrefixSep  = ":"
+	xmlDeclTarget = "xml"
+)
+
+// ParseXML converts an XML document into nested maps suitable for
+// element-level comparison and redaction:
+//
+//   - the root map holds the document element under its qualified name
+//     (e.g. "soap:Envelope") and the declaration under "?xml"
+//   - an element with only text becomes that string
+//   - otherwise an element becomes a map of "@attr" values, "#text" and
+//     child elements; repeated children become arrays
+//   - "#order" records sibling order so EncodeXML can reproduce it
+//
+// Namespace prefixes are kept as written, so the document can be rebuilt
+// faithfully. Comments and DOCTYPE directives are dropped.
+func ParseXML(raw []byte) (map[string]any, error) {
+	return parseXML(raw, xmlCharsetReader)
+}
+
+// parseXMLUTF8 parses a document that was already converted to UTF-8, so an
+// encoding named in its declaration is not applied a second time.
+func parseXMLUTF8(raw []byte) (map[string]any, error) {
+	return parseXML(raw, func(_ string, input io.Reader) (io.Reader, error) { return input, nil })
+}
+
+// xmlCharsetReader decodes documents whose declaration names a non-UTF-8
+// encoding, e.g. <?xml version="1.0" encoding="ISO-8859-1"?>.
+func xmlCharsetReader(label string, input io.Reader) (io.Reader, error) {
+	enc := lookupCharset(strings.ToLower(label))
+	if enc == nil {
+		if isUTF8Charset(strings.ToLower(label)) {
+			return input, nil
+		}
+		return nil, fmt.Errorf("unsupported XML encoding %q", label)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+func parseXML(raw []byte, charsetReader func(string, io.Reader) (io.Reader, error)) (map[string]any, error) {
+	type frame struct {
+		name     string
+		node     map[string]any
+		order    []any
+		names    map[string]bool
+		text     strings.Builder
+		children int
+	}
+
+	root := make(map[string]any)
+	var stack []*frame
+	dec := xml.NewDecoder(bytes.NewReader(raw))
+	dec.Strict = true
+	dec.CharsetReader = charsetReader
+
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 && hasRootElement(root) {
+				return nil, fmt.Errorf("multiple root elements")
+			}
+			f := &frame{name: xmlQualifiedName(t.Name), node: make(map[string]any), names: make(map[string]bool)}
+			for _, a := range t.Attr {
+				f.node[XMLAttrPrefix+xmlQualifiedName(a.Name)] = a.Value
+			}
+			stack = append(stack, f)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected closing tag </%s>", xmlQualifiedName(t.Name))
+			}
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if xmlQualifiedName(t.Name) != f.name {
+				return nil, fmt.Errorf("element <%s> closed by </%s>", f.name, xmlQualifiedName(t.Name))
+			}
+
+			var value any
+			text := f.text.String()
+			if len(f.node) == 0 && f.children == 0 {
+				value = text
+			} else {
+				if trimmed := strings.TrimSpace(text); trimmed != "" {
+					f.node[XMLTextKey] = trimmed
+				}
+				if len(f.names) > 1 {
+					f.node[XMLOrderKey] = f.order
+				}
+				value = f.node
+			}
+
+			if len(stack) == 0 {
+				root[f.name] = value
+				continue
+			}
+			parent := stack[len(stack)-1]
+			parent.children++
+			parent.names[f.name] = true
+			parent.order = append(parent.order, f.name)
+			switch existing := parent.node[f.name].(type) {
+			case nil:
+				parent.node[f.name] = value
+			case []any:
+				parent.node[f.name] = append(existing, value)
+			default:
+				parent.node[f.name] = []any{existing, value}
+			}
+		case xml.ProcInst:
+			if t.Target == xmlDeclTarget && len(stack) == 0 {
+				root[XMLDeclKey] = strings.TrimSpace(string(t.Inst))
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unclosed element <%s>", stack[len(stack)-1].name)
+	}
+	if !hasRootElement(root) {
+		return nil, fmt.Errorf("no root element")
+	}
+	return root, nil
+}
+
+// EncodeXML rebuilds an XML document from the representation produced by
+// ParseXML. Values changed after parsing (e.g. redacted) are written as text.
+func EncodeXML(root map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	if decl, ok := root[XMLDeclKey].(string); ok {
+		buf.WriteString("<?xml " + decl + "?>")
+	}
+	for _, name := range xmlChildNames(root) {
+		if err := writeXMLElement(&buf, name, root[name]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(buf *bytes.Buffer, name string, value any) error {
+	switch v := value.(type) {
+	case []any:
+		// Repeated siblings with the same name
+		for _, item := range v {
+			if err := writeXMLElement(buf, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		buf.WriteString("<" + name)
+		attrs := make([]string, 0)
+		for k := range v {
+			if strings.HasPrefix(k, XMLAttrPrefix) {
+				attrs = append(attrs, k)
+			}
+		}
+		sort.Strings(attrs)
+		for _, k := range attrs {
+			buf.WriteString(" " + strings.TrimPrefix(k, XMLAttrPrefix) + `="`)
+			xml.EscapeText(buf, []byte(xmlScalar(v[k])))
+			buf.WriteString(`"`)
+		}
+		buf.WriteString(">")
+		if text, ok := v[XMLTextKey]; ok {
+			xml.EscapeText(buf, []byte(xmlScalar(text)))
+		}
+		if err := writeXMLChildren(buf, v); err != nil {
+			return err
+		}
+		buf.WriteString("</" + name + ">")
+		return nil
+	default:
+		buf.WriteString("<" + name + ">")
+		xml.EscapeText(buf, []byte(xmlScalar(v)))
+		buf.WriteString("</" + name + ">")
+		return nil
+	}
+}
+
+// writeXMLChildren writes child elements in "#order" when recorded, falling
+// back to sorted names for maps built by hand.
+func writeXMLChildren(buf *bytes.Buffer, node map[string]any) error {
+	order, ok := node[XMLOrderKey].([]any)
+	if !ok {
+		for _, name := range xmlChildNames(node) {
+			if err := writeXMLElement(buf, name, node[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	next := make(map[string]int)
+	for _, o := range order {
+		name, ok := o.(string)
+		if !ok {
+			return fmt.Errorf("invalid %s entry %v", XMLOrderKey, o)
+		}
+		child := node[name]
+		if items, isList := child.([]any); isList {
+			i := next[name]
+			if i >= len(items) {
+				continue
+			}
+			next[name] = i + 1
+			child = items[i]
+		} else if next[name] > 0 {
+			continue
+		} else {
+			next[name] = 1
+		}
+		if err := writeXMLElement(buf, name, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xmlChildNames returns the element keys of node (excluding attributes and
+// special keys), sorted.
+func xmlChildNames(node map[string]any) []string {
+	var names []string
+	for k := range node {
+		if strings.HasPrefix(k, XMLAttrPrefix) || strings.HasPrefix(k, "#") || k == XMLDeclKey {
+			continue
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func xmlScalar(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	default:
+		return fmt.Sprintf("%v", s)
+	}
+}
+
+func xmlQualifiedName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + xmlPrefixSep + n.Local
+}
+
+func hasRootElement(root map[string]any) bool {
+	for k := range root {
+		if k != XMLDeclKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const soapEnvelope = `<?xml version="1.0" encoding="UTF-8"?>` +
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">` +
+	`<soap:Header><auth:Token xmlns:auth="urn:auth">secret</auth:Token></soap:Header>` +
+	`<soap:Body><GetUserResponse><user id="1"><name>Alice</name><email>a@example.com</email></user>` +
+	`<user id="2"><name>Bob</name><email>b@example.com</email></user><total>2</total></GetUserResponse></soap:Body>` +
+	`</soap:Envelope>`
+
+func TestParseXML_Structure(t *testing.T) {
+	tree, err := ParseXML([]byte(soapEnvelope))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree[XMLDeclKey] != `version="1.0" encoding="UTF-8"` {
+		t.Errorf("unexpected declaration %v", tree[XMLDeclKey])
+	}
+	env := tree["soap:Envelope"].(map[string]any)
+	if env["@xmlns:soap"] != "http://schemas.xmlsoap.org/soap/envelope/" {
+		t.Errorf("expected namespace attribute, got %v", env)
+	}
+	resp := env["soap:Body"].(map[string]any)["GetUserResponse"].(map[string]any)
+	users, ok := resp["user"].([]any)
+	if !ok || len(users) != 2 {
+		t.Fatalf("expected repeated elements as array, got %v", resp["user"])
+	}
+	first := users[0].(map[string]any)
+	if first["@id"] != "1" || first["email"] != "a@example.com" {
+		t.Errorf("unexpected user element %v", first)
+	}
+	if resp["total"] != "2" {
+		t.Errorf("expected text-only element as string, got %v", resp["total"])
+	}
+}
+
+func TestEncodeXML_RoundTrip(t *testing.T) {
+	tree, err := ParseXML([]byte(soapEnvelope))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Snapshots are stored as JSON, so round-trip through it like a saved file would
+	data, _ := json.Marshal(tree)
+	var loaded map[string]any
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := EncodeXML(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != soapEnvelope {
+		t.Errorf("round trip mismatch\nwant %s\ngot  %s", soapEnvelope, out)
+	}
+}
+
+func TestEncodeXML_PreservesMixedSiblingOrder(t *testing.T) {
+	raw := `<list><a>1</a><b>2</b><a>3</a></list>`
+	tree, err := ParseXML([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := EncodeXML(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != raw {
+		t.Errorf("expected %s, got %s", raw, out)
+	}
+}
+
+func TestEncodeXML_EscapesRedactedValues(t *testing.T) {
+	tree := map[string]any{"login": map[string]any{"password": "<secret & stuff>"}}
+	out, err := EncodeXML(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `<login><password>&lt;secret &amp; stuff&gt;</password></login>` {
+		t.Errorf("unexpected output %s", out)
+	}
+}
+
+func TestParseXML_Errors(t *testing.T) {
+	for _, raw := range []string{"", "not xml", "<a><b></a>", "<a/><b/>", "<a>"} {
+		if _, err := ParseXML([]byte(raw)); err == nil {
+			t.Errorf("expected error for %q", raw)
+		}
+	}
+}
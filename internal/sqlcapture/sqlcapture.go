@@ -0,0 +1,157 @@
+// Package sqlcapture records the SQL statements a service executes while
+// handling each request, so snapshots can verify the queries as well as the
+// response and DB state. The service opens its database through a driver
+// wrapped by Wrap or Register and wraps its handler with Middleware, which
+// reports each request's queries to the recorder and replayer in the Header
+// response header.
+package sqlcapture
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Header carries the queries of a request, as base64-encoded JSON, on the
+// response. The recorder and replayer remove it from what they store.
+const Header = "X-Snapshot-Queries"
+
+// Log collects the queries executed with a context.
+type Log struct {
+	mu      sync.Mutex
+	queries []snapshot.Query
+}
+
+type logKey struct{}
+
+// NewContext returns a context whose statements are recorded into a new Log.
+func NewContext(ctx context.Context) (context.Context, *Log) {
+	l := &Log{}
+	return context.WithValue(ctx, logKey{}, l), l
+}
+
+// Queries returns the queries recorded so far.
+func (l *Log) Queries() []snapshot.Query {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]snapshot.Query(nil), l.queries...)
+}
+
+// record adds a statement to the context's log, if it has one. Statements
+// executed without the request's context can't be attributed and are not
+// recorded.
+func record(ctx context.Context, query string, args []driver.NamedValue) {
+	l, ok := ctx.Value(logKey{}).(*Log)
+	if !ok {
+		return
+	}
+	q := snapshot.Query{SQL: query}
+	for _, a := range args {
+		q.Args = append(q.Args, argValue(a.Value))
+	}
+	l.mu.Lock()
+	l.queries = append(l.queries, q)
+	l.mu.Unlock()
+}
+
+// argValue converts a driver value for JSON, encoding binary values the way
+// binary columns are.
+func argValue(v driver.Value) any {
+	switch v := v.(type) {
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return map[string]any{"data": base64.StdEncoding.EncodeToString(v), "encoding": "base64"}
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
+
+// Middleware records the queries each request executes with its context
+// (r.Context()) and reports them in the Header response header. Headers are
+// sent with the first write of the body, so statements executed after it
+// are left out.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, l := NewContext(r.Context())
+		cw := &captureWriter{ResponseWriter: w, log: l}
+		next.ServeHTTP(cw, r.WithContext(ctx))
+		cw.setHeader()
+	})
+}
+
+// captureWriter sets the Header header just before the response headers are
+// sent.
+type captureWriter struct {
+	http.ResponseWriter
+	log  *Log
+	sent bool
+}
+
+func (w *captureWriter) setHeader() {
+	if w.sent {
+		return
+	}
+	w.sent = true
+	if value, err := Encode(w.log.Queries()); err == nil {
+		w.Header().Set(Header, value)
+	}
+}
+
+func (w *captureWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) Flush() {
+	w.setHeader()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Encode returns the Header value for queries.
+func Encode(queries []snapshot.Query) (string, error) {
+	if queries == nil {
+		queries = []snapshot.Query{}
+	}
+	data, err := json.Marshal(queries)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decode parses a Header value.
+func Decode(value string) ([]snapshot.Query, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s header: %w", Header, err)
+	}
+	var queries []snapshot.Query
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("decoding %s header: %w", Header, err)
+	}
+	return queries, nil
+}
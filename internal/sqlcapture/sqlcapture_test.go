@@ -0,0 +1,97 @@
+package sqlcapture
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+func init() {
+	Register("sqlite3-sqlcapture-test", &sqlite3.SQLiteDriver{})
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3-sqlcapture-test", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, avatar BLOB)`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMiddleware(t *testing.T) {
+	db := openTestDB(t)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if _, err := db.ExecContext(ctx, `INSERT INTO users (id, name, avatar) VALUES (?, ?, ?)`, 1, "Ann", []byte{0xff, 0x00}); err != nil {
+			t.Fatal(err)
+		}
+		stmt, err := db.PrepareContext(ctx, `SELECT name FROM users WHERE id = ?`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stmt.Close()
+		var name string
+		if err := stmt.QueryRowContext(ctx, 1).Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		// Not executed with the request's context
+		db.Exec(`SELECT 1`)
+		w.Write([]byte(name))
+		// After the headers were sent
+		db.ExecContext(ctx, `SELECT 2`)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Body.String() != "Ann" {
+		t.Fatalf("unexpected response %q", rec.Body.String())
+	}
+
+	queries, err := Decode(rec.Header().Get(Header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []snapshot.Query{
+		{SQL: `INSERT INTO users (id, name, avatar) VALUES (?, ?, ?)`, Args: []any{float64(1), "Ann", map[string]any{"data": "/wA=", "encoding": "base64"}}},
+		{SQL: `SELECT name FROM users WHERE id = ?`, Args: []any{float64(1)}},
+	}
+	if !reflect.DeepEqual(queries, want) {
+		t.Errorf("expected %+v, got %+v", want, queries)
+	}
+}
+
+func TestMiddleware_NoQueries(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	queries, err := Decode(rec.Header().Get(Header))
+	if err != nil || queries == nil || len(queries) != 0 {
+		t.Errorf("expected an empty, reported query list, got %v (%v)", queries, err)
+	}
+}
+
+func TestNewContext(t *testing.T) {
+	db := openTestDB(t)
+	ctx, log := NewContext(context.Background())
+	if _, err := db.ExecContext(ctx, `DELETE FROM users`); err != nil {
+		t.Fatal(err)
+	}
+	if got := log.Queries(); len(got) != 1 || got[0].SQL != `DELETE FROM users` || got[0].Args != nil {
+		t.Errorf("unexpected queries %+v", got)
+	}
+}
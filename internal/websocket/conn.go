@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Relay copies frames from src to dst until a close frame has been
+// forwarded or reading fails, calling onMessage for every complete data or
+// close message. mask must be set when dst is the server, since frames from
+// a client are masked. Pings and pongs are forwarded but not reported.
+func Relay(src io.Reader, dst io.Writer, mask bool, onMessage func(opcode byte, payload []byte)) error {
+	var asm assembler
+	for {
+		f, err := ReadFrame(src)
+		if err != nil {
+			return err
+		}
+		if err := WriteFrame(dst, f, mask); err != nil {
+			return err
+		}
+		opcode, payload, complete, err := asm.add(f)
+		if err != nil {
+			return err
+		}
+		if !complete || opcode == OpPing || opcode == OpPong {
+			continue
+		}
+		onMessage(opcode, payload)
+		if opcode == OpClose {
+			return nil
+		}
+	}
+}
+
+// Conn is the client side of a WebSocket connection.
+type Conn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	asm       assembler
+	closeSent bool
+}
+
+// Handshake sends req over conn as an opening handshake, replacing any
+// handshake headers it carries. If the service switches protocols it
+// returns the connection; otherwise the Conn is nil and the response holds
+// the service's reply.
+func Handshake(conn net.Conn, req *http.Request) (*Conn, *http.Response, error) {
+	key := NewKey()
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Del("Sec-WebSocket-Extensions")
+	req.Header.Del("Sec-WebSocket-Accept")
+
+	if err := req.Write(conn); err != nil {
+		return nil, nil, fmt.Errorf("sending handshake: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading handshake response: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, resp, nil
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != AcceptKey(key) {
+		return nil, resp, fmt.Errorf("invalid Sec-WebSocket-Accept %q", got)
+	}
+	return &Conn{conn: conn, r: r}, resp, nil
+}
+
+// WriteMessage sends a message in a single frame.
+func (c *Conn) WriteMessage(opcode byte, payload []byte) error {
+	if opcode == OpClose {
+		c.closeSent = true
+	}
+	return WriteFrame(c.conn, &Frame{Fin: true, Opcode: opcode, Payload: payload}, true)
+}
+
+// ReadMessage returns the next data or close message. Pings are answered
+// and pongs skipped; a close from the service is echoed back.
+func (c *Conn) ReadMessage() (opcode byte, payload []byte, err error) {
+	for {
+		f, err := ReadFrame(c.r)
+		if err != nil {
+			return 0, nil, err
+		}
+		opcode, payload, complete, err := c.asm.add(f)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !complete {
+			continue
+		}
+		switch opcode {
+		case OpPing:
+			if err := WriteFrame(c.conn, &Frame{Fin: true, Opcode: OpPong, Payload: payload}, true); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			if !c.closeSent {
+				_ = c.WriteMessage(OpClose, ClosePayload(CloseCode(payload)))
+			}
+		}
+		return opcode, payload, nil
+	}
+}
+
+// SetReadDeadline sets the deadline for ReadMessage.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close closes the underlying connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,247 @@
+// Package websocket implements the parts of the WebSocket protocol (RFC
+// 6455) needed to relay connections while recording them and to replay
+// recorded connections: the opening handshake and frame encoding.
+// Extensions such as permessage-deflate are not supported; the recorder
+// strips them from the handshake.
+package websocket
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Frame opcodes.
+const (
+	OpContinuation byte = 0x0
+	OpText         byte = 0x1
+	OpBinary       byte = 0x2
+	OpClose        byte = 0x8
+	OpPing         byte = 0x9
+	OpPong         byte = 0xA
+)
+
+// acceptGUID is appended to the client key to compute Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxPayload bounds a single frame, so a corrupt length cannot make the
+// proxy allocate gigabytes.
+const maxPayload = 64 << 20
+
+// Frame is a single WebSocket frame with its payload unmasked.
+type Frame struct {
+	Fin     bool
+	Opcode  byte
+	Payload []byte
+}
+
+// IsControl reports whether the frame is a close, ping or pong frame.
+func (f *Frame) IsControl() bool {
+	return f.Opcode&0x8 != 0
+}
+
+// IsUpgrade reports whether a request asks to switch to the WebSocket
+// protocol.
+func IsUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AcceptKey returns the Sec-WebSocket-Accept value for a client key.
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// NewKey returns a random Sec-WebSocket-Key.
+func NewKey() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+// ReadFrame reads one frame from r and unmasks its payload.
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	f := &Frame{Fin: head[0]&0x80 != 0, Opcode: head[0] & 0x0f}
+	if head[0]&0x70 != 0 {
+		return nil, errors.New("websocket: reserved bits set; extensions are not supported")
+	}
+	masked := head[1]&0x80 != 0
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxPayload {
+		return nil, fmt.Errorf("websocket: frame of %d bytes exceeds the %d byte limit", length, maxPayload)
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return nil, err
+		}
+	}
+	f.Payload = make([]byte, length)
+	if _, err := io.ReadFull(r, f.Payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		maskBytes(key, f.Payload)
+	}
+	return f, nil
+}
+
+// WriteFrame writes f to w. Frames sent by a client must be masked; frames
+// sent by a server must not be.
+func WriteFrame(w io.Writer, f *Frame, mask bool) error {
+	buf := make([]byte, 0, 14+len(f.Payload))
+	b0 := f.Opcode
+	if f.Fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	var b1 byte
+	if mask {
+		b1 = 0x80
+	}
+	switch n := len(f.Payload); {
+	case n < 126:
+		buf = append(buf, b1|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, b1|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, b1|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	payload := f.Payload
+	if mask {
+		var key [4]byte
+		_, _ = rand.Read(key[:])
+		buf = append(buf, key[:]...)
+		payload = append([]byte(nil), payload...)
+		maskBytes(key, payload)
+	}
+	buf = append(buf, payload...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+// assembler joins fragmented data frames into messages. Control frames may
+// arrive between the fragments of a message and are returned on their own.
+type assembler struct {
+	opcode byte
+	buf    []byte
+}
+
+// add feeds a frame and returns the completed message, if any.
+func (a *assembler) add(f *Frame) (opcode byte, payload []byte, complete bool, err error) {
+	if f.IsControl() {
+		return f.Opcode, f.Payload, true, nil
+	}
+	if f.Opcode == OpContinuation {
+		if a.opcode == 0 {
+			return 0, nil, false, errors.New("websocket: continuation frame without a message")
+		}
+		a.buf = append(a.buf, f.Payload...)
+	} else {
+		if a.opcode != 0 {
+			return 0, nil, false, errors.New("websocket: new message before the previous one ended")
+		}
+		a.opcode = f.Opcode
+		a.buf = append([]byte(nil), f.Payload...)
+	}
+	if !f.Fin {
+		return 0, nil, false, nil
+	}
+	opcode, payload = a.opcode, a.buf
+	a.opcode, a.buf = 0, nil
+	return opcode, payload, true, nil
+}
+
+// CloseCode returns the status code of a close frame payload, or 0 if it
+// carries none.
+func CloseCode(payload []byte) int {
+	if len(payload) < 2 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+// ClosePayload returns a close frame payload for a status code; 0 means no
+// code.
+func ClosePayload(code int) []byte {
+	if code == 0 {
+		return nil
+	}
+	return binary.BigEndian.AppendUint16(nil, uint16(code))
+}
+
+// MessageType returns the snapshot message type of a data or close opcode.
+func MessageType(opcode byte) string {
+	switch opcode {
+	case OpText:
+		return snapshot.MessageText
+	case OpClose:
+		return snapshot.MessageClose
+	default:
+		return snapshot.MessageBinary
+	}
+}
+
+// Opcode returns the opcode of a snapshot message type.
+func Opcode(msgType string) (byte, error) {
+	switch msgType {
+	case snapshot.MessageText:
+		return OpText, nil
+	case snapshot.MessageBinary:
+		return OpBinary, nil
+	case snapshot.MessageClose:
+		return OpClose, nil
+	default:
+		return 0, fmt.Errorf("unknown WebSocket message type %q", msgType)
+	}
+}
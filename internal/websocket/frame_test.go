@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestFrame_RoundTrip(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 65535, 65536} {
+		for _, mask := range []bool{false, true} {
+			payload := bytes.Repeat([]byte{'x'}, size)
+			var buf bytes.Buffer
+			if err := WriteFrame(&buf, &Frame{Fin: true, Opcode: OpBinary, Payload: payload}, mask); err != nil {
+				t.Fatal(err)
+			}
+			if masked := buf.Bytes()[1]&0x80 != 0; masked != mask {
+				t.Errorf("size %d: masked = %v, want %v", size, masked, mask)
+			}
+			f, err := ReadFrame(&buf)
+			if err != nil {
+				t.Fatalf("size %d, mask %v: %v", size, mask, err)
+			}
+			if !f.Fin || f.Opcode != OpBinary || !bytes.Equal(f.Payload, payload) {
+				t.Errorf("size %d, mask %v: got fin=%v opcode=%d len=%d", size, mask, f.Fin, f.Opcode, len(f.Payload))
+			}
+		}
+	}
+}
+
+func TestReadFrame_RejectsExtensions(t *testing.T) {
+	// RSV1 set, as permessage-deflate would
+	if _, err := ReadFrame(bytes.NewReader([]byte{0xc1, 0x00})); err == nil {
+		t.Error("expected an error for a compressed frame")
+	}
+}
+
+func TestAssembler_Fragments(t *testing.T) {
+	var a assembler
+	frames := []*Frame{
+		{Opcode: OpText, Payload: []byte("hel")},
+		{Fin: true, Opcode: OpPing, Payload: []byte("p")},
+		{Fin: true, Opcode: OpContinuation, Payload: []byte("lo")},
+	}
+
+	op, payload, complete, err := a.add(frames[0])
+	if err != nil || complete {
+		t.Fatalf("first fragment: complete=%v err=%v", complete, err)
+	}
+	op, payload, complete, _ = a.add(frames[1])
+	if !complete || op != OpPing || string(payload) != "p" {
+		t.Errorf("expected the interleaved ping on its own, got %d %q", op, payload)
+	}
+	op, payload, complete, _ = a.add(frames[2])
+	if !complete || op != OpText || string(payload) != "hello" {
+		t.Errorf("expected text \"hello\", got %d %q complete=%v", op, payload, complete)
+	}
+
+	if _, _, _, err := a.add(&Frame{Fin: true, Opcode: OpContinuation}); err == nil {
+		t.Error("expected an error for a stray continuation frame")
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455, section 1.3
+	if got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("AcceptKey = %q", got)
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		connection, upgrade string
+		want                bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"keep-alive, Upgrade", "WebSocket", true},
+		{"keep-alive", "websocket", false},
+		{"Upgrade", "h2c", false},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Connection", tt.connection)
+		r.Header.Set("Upgrade", tt.upgrade)
+		if got := IsUpgrade(r); got != tt.want {
+			t.Errorf("Connection %q, Upgrade %q: got %v, want %v", tt.connection, tt.upgrade, got, tt.want)
+		}
+	}
+}
+
+func TestCloseCode(t *testing.T) {
+	if got := CloseCode(ClosePayload(1001)); got != 1001 {
+		t.Errorf("got %d, want 1001", got)
+	}
+	if got := CloseCode(nil); got != 0 {
+		t.Errorf("got %d for an empty payload, want 0", got)
+	}
+}
@@ -0,0 +1,37 @@
+// Package asserter compares expected and actual responses and database
+// states using the same rules as `snapshot-tester replay`.
+package asserter
+
+import (
+	asserterpkg "github.com/esse/snapshot-tester/internal/asserter"
+)
+
+// Comparison types.
+type (
+	Diff    = asserterpkg.Diff
+	Options = asserterpkg.Options
+)
+
+// SeverityWarning marks a difference that is reported but does not fail.
+const SeverityWarning = asserterpkg.SeverityWarning
+
+// AssertResponse compares expected and actual responses, each given as a map
+// with "status" and "body" keys.
+func AssertResponse(expected, actual map[string]any, opts *Options) []Diff {
+	return asserterpkg.AssertResponse(expected, actual, opts)
+}
+
+// AssertDBState compares expected and actual database states keyed by table.
+func AssertDBState(expected, actual map[string][]map[string]any, opts *Options) []Diff {
+	return asserterpkg.AssertDBState(expected, actual, opts)
+}
+
+// HasFailures reports whether any diff is a failure rather than a warning.
+func HasFailures(diffs []Diff) bool {
+	return asserterpkg.HasFailures(diffs)
+}
+
+// FormatDiffs renders diffs as human-readable text.
+func FormatDiffs(diffs []Diff) string {
+	return asserterpkg.FormatDiffs(diffs)
+}
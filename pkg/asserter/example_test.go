@@ -0,0 +1,19 @@
+package asserter_test
+
+import (
+	"fmt"
+
+	"github.com/esse/snapshot-tester/pkg/asserter"
+)
+
+func ExampleAssertResponse() {
+	expected := map[string]any{"status": 200, "body": map[string]any{"name": "Alice", "id": "__ANY__"}}
+	actual := map[string]any{"status": 200, "body": map[string]any{"name": "Bob", "id": float64(7)}}
+
+	diffs := asserter.AssertResponse(expected, actual, &asserter.Options{})
+	for _, d := range diffs {
+		fmt.Printf("%s: %v -> %v\n", d.Path, d.Expected, d.Actual)
+	}
+	// Output:
+	// response.body.name: Alice -> Bob
+}
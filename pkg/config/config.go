@@ -0,0 +1,46 @@
+// Package config exposes the snapshot-tester configuration for programs that
+// embed recording or replay. It mirrors the YAML file format documented in
+// the README.
+package config
+
+import (
+	configpkg "github.com/esse/snapshot-tester/internal/config"
+)
+
+// Configuration types. Fields map one-to-one to the YAML configuration keys.
+// Every type used by a Config field is aliased here.
+type (
+	Config             = configpkg.Config
+	ServiceConfig      = configpkg.ServiceConfig
+	DatabaseConfig     = configpkg.DatabaseConfig
+	RecordingConfig    = configpkg.RecordingConfig
+	ReplayConfig       = configpkg.ReplayConfig
+	TestDatabaseConfig = configpkg.TestDatabaseConfig
+	RateLimitConfig    = configpkg.RateLimitConfig
+	AuthConfig         = configpkg.AuthConfig
+	AuthToken          = configpkg.AuthToken
+	HooksConfig        = configpkg.HooksConfig
+	ProtobufConfig     = configpkg.ProtobufConfig
+	ProtobufMessage    = configpkg.ProtobufMessage
+)
+
+// Recording rules.
+type (
+	TagRule          = configpkg.TagRule
+	SampleRule       = configpkg.SampleRule
+	OutgoingHostRule = configpkg.OutgoingHostRule
+)
+
+// Replay settings.
+type (
+	RetryConfig      = configpkg.RetryConfig
+	LatencyConfig    = configpkg.LatencyConfig
+	LatencyRule      = configpkg.LatencyRule
+	ExitPolicyConfig = configpkg.ExitPolicyConfig
+	ClockConfig      = configpkg.ClockConfig
+)
+
+// Load reads, validates and applies defaults to the configuration file at path.
+func Load(path string) (*Config, error) {
+	return configpkg.Load(path)
+}
@@ -0,0 +1,31 @@
+// Package hooks exposes the lifecycle hook types, so programs embedding the
+// recorder or replayer can register Go callbacks via their Hooks method.
+package hooks
+
+import (
+	hookspkg "github.com/esse/snapshot-tester/internal/hooks"
+)
+
+// Hook types.
+type (
+	Context = hookspkg.Context
+	Func    = hookspkg.Func
+	Runner  = hookspkg.Runner
+)
+
+// Hook events.
+const (
+	EventBeforeRecord    = hookspkg.EventBeforeRecord
+	EventBeforeReplayRun = hookspkg.EventBeforeReplayRun
+	EventBeforeReplay    = hookspkg.EventBeforeReplay
+	EventAfterReplay     = hookspkg.EventAfterReplay
+	EventAfterReplayRun  = hookspkg.EventAfterReplayRun
+)
+
+// Replay results passed to after_replay and after_replay_run hooks in
+// Context.Result.
+const (
+	ResultPass  = hookspkg.ResultPass
+	ResultFail  = hookspkg.ResultFail
+	ResultError = hookspkg.ResultError
+)
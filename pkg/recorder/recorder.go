@@ -0,0 +1,46 @@
+// Package recorder records service interactions as snapshots. A Recorder is
+// an http.Handler, so it can be mounted in an existing server instead of
+// running the standalone proxy. Go services can also record in-process by
+// wrapping their own handler with Recorder.Middleware, e.g. in integration
+// tests:
+//
+//	rec, err := recorder.New(cfg, nil) // cfg.Service.BaseURL may be empty
+//	// ...
+//	defer rec.Close()
+//	srv := httptest.NewServer(rec.Middleware(app.Routes()))
+package recorder
+
+import (
+	"github.com/esse/snapshot-tester/internal/config"
+	recorderpkg "github.com/esse/snapshot-tester/internal/recorder"
+	"github.com/esse/snapshot-tester/internal/redact"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Recorder proxies requests to the configured service and saves a snapshot
+// of each interaction. Use ServeHTTP to embed it, Middleware to wrap a
+// handler or Start to listen on the configured proxy port; call Close when
+// done.
+type Recorder = recorderpkg.Recorder
+
+// Redactor replaces a sensitive value before it is written to a snapshot.
+type Redactor = redact.Redactor
+
+// ReviewFunc decides whether a captured snapshot is saved; see
+// Recorder.SetReview.
+type ReviewFunc = recorderpkg.ReviewFunc
+
+// New creates a recorder for cfg that tags every snapshot with tags.
+func New(cfg *config.Config, tags []string) (*Recorder, error) {
+	return recorderpkg.New(cfg, tags)
+}
+
+// NewRedactor returns a Redactor for the given mode ("mask" or "hmac").
+func NewRedactor(mode, key string) Redactor {
+	return redact.New(mode, key)
+}
+
+// RedactSnapshot redacts the given field paths in snap in place.
+func RedactSnapshot(snap *snapshot.Snapshot, fields []string, redactor Redactor) {
+	redact.Snapshot(snap, fields, redactor)
+}
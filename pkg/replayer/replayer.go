@@ -0,0 +1,37 @@
+// Package replayer replays recorded snapshots against a running service and
+// reports the differences, as `snapshot-tester replay` does.
+package replayer
+
+import (
+	"github.com/esse/snapshot-tester/internal/config"
+	"github.com/esse/snapshot-tester/internal/mock"
+	replayerpkg "github.com/esse/snapshot-tester/internal/replayer"
+	"github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Replayer restores database state, fires each snapshot's request and
+// compares the outcome. Call Close when done.
+type Replayer = replayerpkg.Replayer
+
+// TestResult is the outcome of replaying one snapshot.
+type TestResult = replayerpkg.TestResult
+
+// RecordedCall is an outgoing call received by the mock server during replay.
+type RecordedCall = mock.RecordedCall
+
+// New creates a replayer for cfg, connecting to the test database.
+func New(cfg *config.Config) (*Replayer, error) {
+	return replayerpkg.New(cfg)
+}
+
+// WriteFailures writes the actual results of failed replays under dir,
+// mirroring the snapshot layout under snapshotDir.
+func WriteFailures(dir, snapshotDir string, results []TestResult) (int, error) {
+	return replayerpkg.WriteFailures(dir, snapshotDir, results)
+}
+
+// Shuffle reorders snapshots and their paths pseudo-randomly from seed, as
+// `replay --shuffle` does. The same seed gives the same order.
+func Shuffle(snapshots []*snapshot.Snapshot, paths []string, seed int64) {
+	replayerpkg.Shuffle(snapshots, paths, seed)
+}
@@ -0,0 +1,80 @@
+// Package snapshot exposes the snapshot data model and the file-based store
+// used by snapshot-tester, so other tools can read, write and query
+// recorded snapshots.
+package snapshot
+
+import (
+	snapshotpkg "github.com/esse/snapshot-tester/internal/snapshot"
+)
+
+// Snapshot data model. See the README for the on-disk format.
+type (
+	Snapshot        = snapshotpkg.Snapshot
+	Request         = snapshotpkg.Request
+	Response        = snapshotpkg.Response
+	OutgoingRequest = snapshotpkg.OutgoingRequest
+	TableDiff       = snapshotpkg.TableDiff
+	ModifiedRow     = snapshotpkg.ModifiedRow
+	TableSchema     = snapshotpkg.TableSchema
+	ColumnSchema    = snapshotpkg.ColumnSchema
+	IndexSchema     = snapshotpkg.IndexSchema
+	ReplayOptions   = snapshotpkg.ReplayOptions
+)
+
+// Store types.
+type (
+	Store        = snapshotpkg.Store
+	SnapshotInfo = snapshotpkg.SnapshotInfo
+	ListOptions  = snapshotpkg.ListOptions
+	GrepOptions  = snapshotpkg.GrepOptions
+	GrepResult   = snapshotpkg.GrepResult
+	GrepMatch    = snapshotpkg.GrepMatch
+	Selector     = snapshotpkg.Selector
+)
+
+// Quarantine types.
+type (
+	Quarantine      = snapshotpkg.Quarantine
+	QuarantineEntry = snapshotpkg.QuarantineEntry
+)
+
+// Supported snapshot file formats.
+const (
+	FormatJSON = snapshotpkg.FormatJSON
+	FormatYAML = snapshotpkg.FormatYAML
+)
+
+// ErrDuplicateID is returned by Store.Save when a snapshot with the same ID
+// already exists in the target directory.
+var ErrDuplicateID = snapshotpkg.ErrDuplicateID
+
+// NewStore creates a store rooted at baseDir that writes snapshots in the
+// given format (json or yaml).
+func NewStore(baseDir, format string) *Store {
+	return snapshotpkg.NewStore(baseDir, format)
+}
+
+// ParseSelector parses a selector expression such as
+// `method=POST && status<500`, for ListOptions.Selector and
+// Store.LoadSelected.
+func ParseSelector(expr string) (*Selector, error) {
+	return snapshotpkg.ParseSelector(expr)
+}
+
+// LoadQuarantine reads the list of quarantined snapshots kept in the
+// snapshot directory baseDir, for Replayer.SetQuarantine.
+func LoadQuarantine(baseDir string) (*Quarantine, error) {
+	return snapshotpkg.LoadQuarantine(baseDir)
+}
+
+// SubstituteVariables returns a copy of snap with its {{name}}
+// placeholders replaced by vars[name], the way replay fills in
+// replay.variables.
+func SubstituteVariables(snap *Snapshot, vars map[string]any) (*Snapshot, error) {
+	return snapshotpkg.SubstituteVariables(snap, vars)
+}
+
+// GenerateID returns a new sortable snapshot ID.
+func GenerateID() string {
+	return snapshotpkg.GenerateID()
+}
@@ -0,0 +1,38 @@
+package snapshot_test
+
+import (
+	"testing"
+
+	"github.com/esse/snapshot-tester/pkg/snapshot"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	store := snapshot.NewStore(t.TempDir(), snapshot.FormatJSON)
+
+	snap := &snapshot.Snapshot{
+		ID:       snapshot.GenerateID(),
+		Service:  "api",
+		Request:  snapshot.Request{Method: "GET", URL: "/users"},
+		Response: snapshot.Response{Status: 200},
+	}
+	path, err := store.Save(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID != snap.ID || loaded.Response.Status != 200 {
+		t.Errorf("unexpected snapshot %+v", loaded)
+	}
+
+	infos, total, err := store.ListFiltered(snapshot.ListOptions{Method: "GET"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || infos[0].Path != path {
+		t.Errorf("unexpected listing %+v", infos)
+	}
+}
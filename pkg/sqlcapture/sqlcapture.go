@@ -0,0 +1,52 @@
+// Package sqlcapture records the SQL statements a Go service executes while
+// handling each request, so snapshots verify the queries as well as the
+// response and DB state. Open the database through a driver registered with
+// Register and wrap the service's handler with Middleware, typically in
+// test builds only:
+//
+//	sqlcapture.Register("sqlite3-captured", &sqlite3.SQLiteDriver{})
+//	db, err := sql.Open("sqlite3-captured", dsn)
+//	// ...
+//	http.ListenAndServe(addr, sqlcapture.Middleware(routes))
+//
+// Only statements executed with the request's context, e.g.
+// db.QueryContext(r.Context(), ...), are attributed to it.
+package sqlcapture
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+
+	sqlcapturepkg "github.com/esse/snapshot-tester/internal/sqlcapture"
+)
+
+// Header is the response header Middleware reports queries in.
+const Header = sqlcapturepkg.Header
+
+// Log collects the queries executed with a context.
+type Log = sqlcapturepkg.Log
+
+// Register makes an instrumented version of d available to sql.Open under
+// name.
+func Register(name string, d driver.Driver) {
+	sqlcapturepkg.Register(name, d)
+}
+
+// Wrap returns an instrumented version of d, to register under a name of
+// your choice.
+func Wrap(d driver.Driver) driver.Driver {
+	return sqlcapturepkg.Wrap(d)
+}
+
+// Middleware records the queries each request executes and reports them to
+// the recorder and replayer.
+func Middleware(next http.Handler) http.Handler {
+	return sqlcapturepkg.Middleware(next)
+}
+
+// NewContext returns a context whose statements are recorded into a new Log,
+// for capturing queries outside of an HTTP handler.
+func NewContext(ctx context.Context) (context.Context, *Log) {
+	return sqlcapturepkg.NewContext(ctx)
+}